@@ -2,62 +2,135 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/veschin/GoLeM/internal/claude"
 	"github.com/veschin/GoLeM/internal/cmd"
 	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/events"
 	"github.com/veschin/GoLeM/internal/exitcode"
 	"github.com/veschin/GoLeM/internal/job"
 	"github.com/veschin/GoLeM/internal/log"
+	"github.com/veschin/GoLeM/pkg/golem"
 )
 
-const version = "1.0.0"
+// Build metadata, set at build time with
+// -ldflags "-X main.commit=$(git rev-parse --short HEAD) -X main.date=...".
+// Empty commit and date fall back to the VCS stamp of the build.
+var (
+	version = "1.0.0"
+	commit  = ""
+	date    = ""
+)
 
 // logger is the global structured logger, initialized in run().
 var logger *log.Logger
 
+// out is the output policy selected by the global --quiet and --no-color
+// flags.
+var out = &cmd.Out{}
+
+// subagentDirFlag is the global --subagent-dir flag, made absolute; empty
+// when not given.
+var subagentDirFlag string
+
+// profileFlag is the global --profile flag; empty when not given.
+var profileFlag string
+
+// configFlag is the global --config flag, the glm.toml to read instead of
+// the one in the config directory, made absolute; empty when not given.
+var configFlag string
+
 func main() {
 	code := run(os.Args[1:])
 	os.Exit(code)
 }
 
-// initLogger creates the global logger from environment variables.
-func initLogger() *log.Logger {
+// initLogger creates the global logger from environment variables. noColor
+// turns off the colors it uses on a terminal.
+func initLogger(noColor bool) *log.Logger {
 	opts := []log.Option{log.WithWriter(os.Stderr)}
 
 	if os.Getenv("GLM_DEBUG") == "1" {
 		opts = append(opts, log.WithLevel(log.LevelDebug))
 	}
 
-	if os.Getenv("GLM_LOG_FORMAT") == "json" {
-		opts = append(opts, log.WithFormat(log.FormatJSON))
+	// The log file is always structured so that glm logs can filter it:
+	// JSON with GLM_LOG_FORMAT=json, logfmt otherwise.
+	format := log.ParseFormat(os.Getenv("GLM_LOG_FORMAT"))
+	jsonFormat := format == log.FormatJSON
+	opts = append(opts, log.WithFormat(format))
+	if !jsonFormat {
+		opts = append(opts, log.WithFileFormat(log.FormatLogfmt))
 	}
 
-	fi, _ := os.Stderr.Stat()
-	if fi != nil && fi.Mode()&os.ModeCharDevice != 0 {
+	if !noColor && isTerminal(os.Stderr) {
 		opts = append(opts, log.WithIsTTY(true))
 	}
 
+	var eventOut io.Writer = os.Stderr
 	if logFile := os.Getenv("GLM_LOG_FILE"); logFile != "" {
 		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 		if err == nil {
 			opts = append(opts, log.WithFile(f))
+			eventOut = io.MultiWriter(os.Stderr, f)
 		}
 	}
 
+	// Lifecycle events go to the same destinations as JSON logs.
+	if jsonFormat {
+		events.SetOutput(eventOut)
+	}
+
 	return log.New(opts...)
 }
 
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	fi, _ := f.Stat()
+	return fi != nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// outputPolicy strips the global --quiet and --no-color flags from args and
+// returns the remaining args, the output policy they select and whether
+// color is turned off, by --no-color or a non-empty NO_COLOR. Statuses are
+// colored only when stdout is a terminal.
+func outputPolicy(args []string) ([]string, *cmd.Out, bool) {
+	noColor := hasFlag(args, "--no-color") || os.Getenv("NO_COLOR") != ""
+	o := &cmd.Out{Quiet: hasFlag(args, "--quiet"), Color: !noColor && isTerminal(os.Stdout)}
+	return stripFlag(stripFlag(args, "--quiet"), "--no-color"), o, noColor
+}
+
 func run(args []string) int {
-	logger = initLogger()
+	var noColor bool
+	args, out, noColor = outputPolicy(args)
+	logger = initLogger(noColor)
+	subagentDirFlag, args = getFlagValue(args, "--subagent-dir")
+	if subagentDirFlag != "" {
+		// Like any path on the command line, relative to the current directory.
+		if abs, err := filepath.Abs(subagentDirFlag); err == nil {
+			subagentDirFlag = abs
+		}
+	}
+	profileFlag, args = getFlagValue(args, "--profile")
+	configFlag, args = getFlagValue(args, "--config")
+	if configFlag != "" {
+		if abs, err := filepath.Abs(configFlag); err == nil {
+			configFlag = abs
+		}
+	}
+	golem.SetWarningOutput(os.Stderr)
 
 	if len(args) == 0 {
 		usage()
@@ -67,7 +140,8 @@ func run(args []string) int {
 	subcmd := args[0]
 	rest := args[1:]
 
-	logger.Debug("command=" + subcmd)
+	logger = logger.With(log.Fields{"command": subcmd})
+	logger.Debug("command started")
 
 	switch subcmd {
 	case "run":
@@ -76,14 +150,28 @@ func run(args []string) int {
 		return cmdStart(rest)
 	case "status":
 		return cmdStatus(rest)
+	case "attach":
+		return cmdAttach(rest)
 	case "result":
 		return cmdResult(rest)
 	case "log":
 		return cmdLog(rest)
+	case "prompt":
+		return cmdPrompt(rest)
+	case "logs":
+		return cmdLogs(rest)
 	case "list":
 		return cmdList(rest)
 	case "clean":
 		return cmdClean(rest)
+	case "du":
+		return cmdDu(rest)
+	case "metrics":
+		return cmdMetrics(rest)
+	case "export":
+		return cmdExport(rest)
+	case "import":
+		return cmdImport(rest)
 	case "kill":
 		return cmdKill(rest)
 	case "chain":
@@ -91,18 +179,27 @@ func run(args []string) int {
 	case "session":
 		return cmdSession(rest)
 	case "doctor":
-		return cmdDoctor()
+		return cmdDoctor(rest)
+	case "serve":
+		return cmdServe(rest)
+	case "mcp":
+		return cmdMCP(rest)
 	case "update":
-		return cmdUpdate()
+		return cmdUpdate(rest)
 	case "config":
 		return cmdConfig(rest)
+	case "template":
+		return cmdTemplate(rest)
+	case "queue":
+		return cmdQueue(rest)
+	case "_worker":
+		return cmdWorker(rest)
 	case "_install":
-		return cmdInstall()
-	case "_uninstall":
-		return cmdUninstall()
+		return cmdInstall(rest)
+	case "uninstall", "_uninstall":
+		return cmdUninstall(rest)
 	case "version", "--version", "-v":
-		fmt.Println("glm " + version)
-		return 0
+		return cmdVersion(rest)
 	case "help", "--help", "-h":
 		usage()
 		return 0
@@ -114,82 +211,208 @@ func run(args []string) int {
 }
 
 func usage() {
-	fmt.Fprint(os.Stderr, `Usage: glm {session|run|start|status|result|log|list|clean|kill|chain|update|doctor|config} [options]
+	fmt.Fprint(os.Stderr, `Usage: glm {session|run|start|attach|status|result|prompt|log|logs|list|clean|du|metrics|export|import|kill|chain|queue|serve|mcp|update|uninstall|doctor|config|template} [options]
 
 Commands:
-  session [flags] [claude flags]     Interactive Claude Code
-  run   [flags] "prompt"             Sync execution
-  start [flags] "prompt"             Async execution
-  chain [flags] "p1" "p2" ...        Chained execution
-  status  JOB_ID                     Check job status
-  result  JOB_ID                     Get text output
-  log     JOB_ID                     Show file changes
+  session [flags] [claude flags]     Interactive Claude Code (--dry-run prints the command)
+          [--resume JOB_ID]          Continue a job's conversation in its workdir
+  run   [flags] "prompt"             Sync execution (--summary adds a final
+                                     key=value line on stderr for CI)
+  start [flags] "prompt"             Async execution (queued beyond max_parallel)
+                                     (--attach follows the job like attach)
+        --dry-run [--json]           Validate and print the claude invocation
+                                     without running it (run, start, chain)
+  attach  JOB_ID                     Stream a running job's output until it ends
+  chain [flags] "p1" "p2" ...        Chained execution (--json for per-step output)
+                                     ("a" "b" --then "c": a and b in parallel)
+                                     ("fix:prompt" names a step)
+        --summarize-context          Summarize output over chain_context_limit
+                                     with haiku instead of cutting it
+        --resume ID [--from N|NAME]  Re-run from step N, reusing ID's earlier steps
+        --total-timeout SEC|DUR      Budget for the whole chain; steps past it are
+                                     skipped (exit 124)
+        --clean-intermediate         On success, delete the job dirs of all but
+                                     the last group's steps
+        --inject MODE                What the next step gets: stdout (default),
+                                     changelog, both or none
+        --context-as-file            Write it to files in the step's job dir and
+                                     point the prompt at them instead
+  status  [--verbose] JOB_ID         Check job status (--verbose adds timing)
+  status  [--all]                    Active jobs of this project with elapsed time
+  status  --format TMPL [JOB_ID]     One line per job from a Go template
+  result  [opts] JOB_ID              Get text output
+          [--resume-hint]            Print the claude --resume command instead
+          [--approve]                Run a --mode plan job's plan with acceptEdits
+          [--format TMPL]            Print a Go template of the result; keeps the job
+  result  --merge [--wait] ID...     One document of several jobs' outputs, in
+                                     argument order (--wait: for running jobs)
+  prompt  [--json] JOB_ID            Print the exact prompt the job ran with
+  log     [--diff] JOB_ID            Show file changes (--diff: captured patch)
+          [--stat]                   Counts by operation and per file instead
+  logs    [--job ID] [--level L]     Print the GLM_LOG_FILE log, only one job's
+          [--follow] [--file PATH]   lines or level L and up (--follow tails it)
   list    [--status S] [--since D]   List all jobs
-  clean   [--days N]                 Remove old jobs
-  kill    JOB_ID                     Terminate job
-  update                             Self-update from GitHub
-  doctor                             Check system health
+          [--chain ID]               Only one chain's steps, in order
+          [--limit N] [--offset M]   At most N newest jobs, after skipping M
+          [--sort KEY] [--reverse]   Order by started (default), status,
+                                     duration, project or id; --reverse flips it
+          [--utc]                    Show start times in UTC, not local time
+          [--lineage JOB_ID]         The job's retry chain, original first
+          [--format TMPL]            One line per job from a Go template,
+                                     e.g. '{{.ID}} {{.Status}}'
+  clean   [--days N]                 Remove old jobs (default: finished jobs)
+          [--project]                Only the current project's jobs
+          [--project-name NAME]      Only the jobs of projects named NAME
+          [--status LIST]            Only these statuses, e.g. failed,timeout
+          [--force]                  Also running/queued jobs that are dead
+  du      [--json]                   Disk usage per project and job, largest first
+  metrics summary [--since D]        Job counts, failure rate and durations from
+          [--json]                   metrics.jsonl (needs metrics_enabled)
+  export  JOB_ID [--output FILE]     Pack the job dir into FILE (default
+          [--redact]                 JOB_ID.tar.gz); --redact strips API keys
+                                     and cuts long raw.json messages
+  import  FILE                       Unpack an export into this project as a new job
+  kill    JOB_ID                     Terminate job (a queued job is just cancelled)
+          [--grace SEC]              Wait up to SEC after SIGTERM before SIGKILL
+                                     (default kill_grace_seconds, 5)
+  queue   drain                      Start queued jobs while slots are free
+  serve   [--addr HOST:PORT]         JSON API to inspect and submit jobs
+                                     (default 127.0.0.1:7777)
+  mcp                                MCP server on stdio for Claude Code
+  update  [--to TAG|BRANCH]          Self-update from GitHub (shows the commit
+          [--check] [--yes]          log and asks first; --check only reports;
+          [--force|--keep]           --force/--keep settle a hand-edited
+                                     GLM section in CLAUDE.md without asking)
+  uninstall [--dry-run] [--yes]      Remove glm (--dry-run lists what would go;
+            [--force]                --force even while jobs are running)
+  doctor  [--fix] [--json]           Check system health (--fix repairs the
+                                     problems that need no decision)
   config  {show|set KEY VAL}         Manage configuration
+  config explain models [flags]      Show the models run would use and where
+         [--step PREFIX] [--json]    each came from (--step: a chain prefix)
+  version [--json] [--check-update]  Version and build metadata (--check-update
+                                     asks GitHub for the latest release)
+  template {list|show NAME}          List or print prompt templates
 
 Flags:
   -d DIR              Working directory
-  -t SEC              Timeout in seconds
+  -t SEC|DURATION     Timeout in seconds or as a duration (10m, 1h30m)
   -m, --model MODEL   Set all three model slots to MODEL
   --opus MODEL        Set opus model
   --sonnet MODEL      Set sonnet model
   --haiku MODEL       Set haiku model
   --unsafe            Bypass all permission checks
   --mode MODE         Set permission mode
+  --base-url URL      Anthropic-compatible API base URL for this job
+  --priority LEVEL    Queue priority: low, normal (default) or high
+  --notify CMD        Run shell command CMD when the job finishes (run, start)
+  --keep              Keep the job directory after output
+  --capture-diff      Save the workdir's git diff to the job (diff.patch)
+  --strict-result     Fail a job whose result matches a failure marker
+  --confine           Check the prompt and changelog for paths outside -d (run, start)
+  --expand-files      Inline @./path files into the prompt as code blocks
+  --context FILE      Copy FILE into the job dir and tell claude to read it
+                      instead of putting it in the prompt (run)
+  --i-know-what-im-doing
+                      Allow bypassPermissions outside home or in system paths
+  --allow-overlap     Run even if a running job works in the same directory tree
+  --allow-nested      Run even inside a glm job nested max_depth deep (run, start)
+  --strict-disk       Refuse the job when jobs use more than max_disk_mb
+  --max-output BYTES  Print at most BYTES of job output (run, result)
+  --template NAME     Use prompt template NAME instead of a prompt
+  --prompt TEXT       Prompt as a flag value, taken as is (not with positional text)
+  -v KEY=VALUE        Set a template variable (repeatable)
   --json              JSON output format
+  --no-defaults       Ignore the project's .glm/defaults (run, start, chain)
+
+Global flags:
+  --quiet             Only results and errors (no progress or summary lines)
+  --no-color          Never color statuses (also set by the NO_COLOR env var)
+  --subagent-dir DIR  Store and look up jobs under DIR (subagent_dir,
+                      GLM_SUBAGENT_DIR; default ~/.claude/subagents)
+  --profile NAME      Use the config directory GoLeM-NAME (own key, models
+                      and glm.toml) instead of GoLeM
+  --config FILE       Read FILE instead of the config directory's glm.toml
 `)
 }
 
+// resolveConfigDir returns the configuration directory of the --profile
+// flag and the source glm config show reports for it (see
+// config.ResolveConfigDir).
+func resolveConfigDir() (dir, source string, err error) {
+	return config.ResolveConfigDir(profileFlag)
+}
+
 // loadConfig loads the GoLeM configuration from standard paths.
 func loadConfig() (*config.Config, error) {
-	home, err := os.UserHomeDir()
+	_, subagentDir, err := golem.StandardDirs()
+	if err != nil {
+		return nil, err
+	}
+	configDir, _, err := resolveConfigDir()
 	if err != nil {
-		return nil, fmt.Errorf("cannot determine home directory: %w", err)
+		return nil, err
 	}
-	configDir := filepath.Join(home, ".config", "GoLeM")
-	subagentDir := filepath.Join(home, ".claude", "subagents")
 	logger.Debug("config_dir=" + configDir)
-	cfg, err := config.Load(configDir, subagentDir)
+	cfg, err := golem.LoadConfig(configDir, subagentDir, loadOptions())
 	if err != nil {
 		return nil, err
 	}
+	logger.Debug("subagent_dir=" + cfg.SubagentDir)
 	logger.Debug(fmt.Sprintf("model=%s max_parallel=%d", cfg.Model, cfg.MaxParallel))
+	// Only where the key came from; the key itself is never logged.
+	logger.Debug("api_key=[redacted] source=" + cfg.APIKeySource)
 	return cfg, nil
 }
 
-// resolveProjectID determines the project ID from the working directory.
-func resolveProjectID(workdir string) string {
-	abs, err := filepath.Abs(workdir)
+// loadOptions returns the config.Options of the global flags: the
+// --subagent-dir override, the --config file, and the project root of the
+// working directory, which a relative subagent_dir or GLM_SUBAGENT_DIR is
+// resolved against.
+func loadOptions() *golem.LoadOptions {
+	cwd, _ := os.Getwd()
+	return &golem.LoadOptions{SubagentDir: subagentDirFlag, ConfigFile: configFlag, ProjectRoot: config.ProjectRoot(cwd)}
+}
+
+// subagentsRoot returns the subagent directory the loaded config would use,
+// for commands that must work without a complete configuration.
+func subagentsRoot(configDir string) (string, error) {
+	_, subagentDir, err := golem.StandardDirs()
 	if err != nil {
-		abs = workdir
+		return "", err
 	}
-	return job.ResolveProjectID(abs)
+	return config.ResolveSubagentDir(configDir, subagentDir, *loadOptions())
+}
+
+// resolveProjectID determines the project ID from the canonical form of
+// the working directory, so "." and the absolute path or a symlink to it
+// give the same ID.
+func resolveProjectID(workdir string) string {
+	dir, _ := job.CanonicalDir(workdir)
+	return job.ResolveProjectID(dir)
 }
 
 // die prints an error message to stderr and returns the appropriate exit code.
 func die(err error) int {
-	msg := err.Error()
-	fmt.Fprintln(os.Stderr, msg)
+	fmt.Fprintln(os.Stderr, err.Error())
+	return errs.ExitCode(err)
+}
 
-	if strings.Contains(msg, "err:not_found") {
-		return exitcode.NotFound
-	}
-	if strings.Contains(msg, "err:dependency") {
-		return exitcode.DependencyMissing
-	}
-	if strings.Contains(msg, "err:timeout") {
-		return exitcode.Timeout
+// flagsEnd returns the index of the "--" that ends the flags in args, or
+// len(args). hasFlag, stripFlag and getFlagValue leave everything from there
+// on alone, so "glm run -- explain --json" keeps --json in the prompt.
+func flagsEnd(args []string) int {
+	for i, a := range args {
+		if a == "--" {
+			return i
+		}
 	}
-	return exitcode.UserError
+	return len(args)
 }
 
 // hasFlag checks if a specific flag is present in args.
 func hasFlag(args []string, flag string) bool {
-	for _, a := range args {
+	for _, a := range args[:flagsEnd(args)] {
 		if a == flag {
 			return true
 		}
@@ -199,19 +422,21 @@ func hasFlag(args []string, flag string) bool {
 
 // stripFlag removes a boolean flag from args and returns the cleaned slice.
 func stripFlag(args []string, flag string) []string {
+	end := flagsEnd(args)
 	result := make([]string, 0, len(args))
-	for _, a := range args {
+	for _, a := range args[:end] {
 		if a != flag {
 			result = append(result, a)
 		}
 	}
-	return result
+	return append(result, args[end:]...)
 }
 
 // getFlagValue returns the value of a flag and remaining args, or empty string.
 func getFlagValue(args []string, flag string) (string, []string) {
-	for i, a := range args {
-		if a == flag && i+1 < len(args) {
+	end := flagsEnd(args)
+	for i, a := range args[:end] {
+		if a == flag && i+1 < end {
 			remaining := make([]string, 0, len(args)-2)
 			remaining = append(remaining, args[:i]...)
 			remaining = append(remaining, args[i+2:]...)
@@ -221,162 +446,365 @@ func getFlagValue(args []string, flag string) (string, []string) {
 	return "", args
 }
 
+// formatFlag takes --format TEMPLATE off args and parses it (see
+// cmd.ParseFormat). The template is nil without --format; with --json too it
+// is err:user.
+func formatFlag(args []string, jsonMode bool) (*template.Template, []string, error) {
+	raw, args := getFlagValue(args, "--format")
+	if raw == "" {
+		return nil, args, nil
+	}
+	if jsonMode {
+		return nil, args, errs.User(`"--format cannot be combined with --json"`)
+	}
+	tmpl, err := cmd.ParseFormat(raw)
+	return tmpl, args, err
+}
+
+// projectDefaults prepends the project's default flags to the arguments of
+// run, start or chain (see cmd.ApplyProjectDefaults).
+func projectDefaults(args []string) ([]string, error) {
+	cwd, _ := os.Getwd()
+	args, path, err := cmd.ApplyProjectDefaults(args, cwd)
+	if path != "" {
+		logger.Debug("project_defaults=" + path)
+	}
+	return args, err
+}
+
 func cmdRun(args []string) int {
 	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--json")
+	summary := hasFlag(args, "--summary")
+	args = stripFlag(args, "--summary")
+	dryRun := hasFlag(args, "--dry-run")
+	args = stripFlag(args, "--dry-run")
 
+	args, err := projectDefaults(args)
+	if err != nil {
+		return die(err)
+	}
 	flags, err := cmd.ParseFlags(args)
 	if err != nil {
 		return die(err)
 	}
+	promptArgs = []string{flags.Prompt}
 
 	cfg, err := loadConfig()
 	if err != nil {
 		return die(err)
 	}
 
-	// Apply config defaults.
-	if flags.Timeout <= 0 {
-		flags.Timeout = cfg.MaxParallel // Use config default timeout
-		if flags.Timeout <= 0 {
-			flags.Timeout = config.DefaultTimeout
-		}
+	if err := cmd.ApplyTemplate(flags, cfg.ConfigDir, cfg.Templates); err != nil {
+		return die(err)
 	}
-
-	if err := cmd.Validate(flags); err != nil {
+	if err := cmd.ApplyFileRefs(flags); err != nil {
 		return die(err)
 	}
+	if dryRun {
+		return dryRunJob(cfg, flags, jsonMode)
+	}
+	return runJob(cfg, flags, jsonMode, summary)
+}
 
-	projectID := resolveProjectID(flags.Dir)
-
-	// Create job, execute claude, and return result.
-	jobID := job.GenerateJobID()
-	j, err := job.NewJob(cfg.SubagentDir, projectID, jobID)
+// dryRunJob prints the claude invocation of the job flags describes, for
+// --dry-run of run and start, without creating the job.
+func dryRunJob(cfg *config.Config, flags *cmd.Flags, jsonMode bool) int {
+	d, err := newClient(cfg).DryRun(runSpec(flags))
 	if err != nil {
 		return die(err)
 	}
+	if jsonMode {
+		_ = cmd.JSONOutput(os.Stdout, d)
+	} else {
+		fmt.Fprint(os.Stdout, d.Text())
+	}
+	return 0
+}
 
-	// Write PID.
-	pid := os.Getpid()
-	_ = os.WriteFile(filepath.Join(j.Dir, "pid.txt"), []byte(strconv.Itoa(pid)), 0o644)
-
-	// Set status to running.
-	_ = j.StatusTransition(job.StatusRunning)
-
-	// Build claude config.
-	claudeCfg := buildClaudeConfig(cfg, flags, j.Dir)
-
-	// Execute.
-	exitCode, _ := claude.Execute(claudeCfg)
-
-	// Parse raw.json into stdout.txt + changelog.txt.
-	_ = claude.ParseRawJSON(j.Dir)
+// runJob runs the job flags describes in the foreground, prints its output
+// like glm run and returns its exit code. summary adds the --summary line.
+func runJob(cfg *config.Config, flags *cmd.Flags, jsonMode, summary bool) int {
+	maxOutput := flags.MaxOutput
+	if maxOutput == 0 {
+		maxOutput = cfg.MaxOutputBytes
+	}
+	spec := runSpec(flags)
+	if maxOutput > 0 && !jsonMode {
+		// Output that gets cut must stay in stdout.txt; the job is deleted
+		// below once it turns out it was printed in full.
+		spec.Keep = true
+	}
 
-	// Determine final status.
-	stderrData, _ := os.ReadFile(filepath.Join(j.Dir, "stderr.txt"))
-	finalStatus := claude.MapStatus(exitCode, string(stderrData))
-	_ = os.WriteFile(filepath.Join(j.Dir, "status"), []byte(finalStatus), 0o644)
+	// Execute. Ctrl-C stops claude's process group and the job ends killed.
+	ctx, stopInterrupt := interruptContext("claude")
+	defer stopInterrupt()
+	res, err := newClient(cfg).Run(ctx, spec)
+	if err != nil {
+		return die(err)
+	}
 
 	if jsonMode {
-		_ = cmd.ResultJSON(cfg.SubagentDir, projectID, jobID, os.Stdout)
+		if res.Unsaved != "" {
+			res.Job.Stdout = res.Unsaved
+		}
+		_ = cmd.JSONOutput(os.Stdout, res.Job)
 	} else {
-		// Print stdout.
-		stdoutData, _ := os.ReadFile(filepath.Join(j.Dir, "stdout.txt"))
-		if len(stdoutData) > 0 {
-			fmt.Fprint(os.Stdout, string(stdoutData))
+		// Print stdout, then changelog + stderr to stderr.
+		truncated := cmd.PrintLimited(os.Stdout, os.Stderr, res.Job.Stdout, maxOutput, filepath.Join(res.Dir, "stdout.txt"))
+		// Output the job could not save is printed whole; it has no other copy.
+		fmt.Fprint(os.Stdout, res.Unsaved)
+		if spec.Keep && !flags.Keep && !truncated && cmd.FinishJob(res.Dir, cfg.SubagentDir, cfg.KeepJobs, cfg.RetentionDays) {
+			res.Dir = ""
 		}
-
-		// Print changelog + stderr to stderr.
-		changelogData, _ := os.ReadFile(filepath.Join(j.Dir, "changelog.txt"))
-		if len(changelogData) > 0 {
-			fmt.Fprint(os.Stderr, string(changelogData))
+		if !out.Quiet {
+			fmt.Fprint(os.Stderr, res.Job.Changelog)
 		}
-		if len(stderrData) > 0 {
-			fmt.Fprint(os.Stderr, string(stderrData))
+		fmt.Fprint(os.Stderr, res.Job.Stderr)
+		if summary && !out.Quiet {
+			// The summary always starts its own line.
+			last := res.Job.Stderr
+			if last == "" {
+				last = res.Job.Changelog
+			}
+			if last != "" && last[len(last)-1] != '\n' {
+				fmt.Fprintln(os.Stderr)
+			}
+			fmt.Fprintln(os.Stderr, res.Summary)
 		}
 	}
+	if res.Err != nil {
+		fmt.Fprintln(os.Stderr, res.Err)
+	}
+	if res.Dir != "" {
+		logger.Debug("job kept: " + res.Dir)
+	}
+	return res.ExitCode
+}
 
-	// Auto-delete job directory.
-	job.DeleteJob(j.Dir)
-
-	return exitCode
+// mergeResults handles "glm result --merge": the results of jobIDs as one
+// document (see cmd.MergeCmd).
+func mergeResults(jobIDs []string, jsonMode, wait, keep bool) int {
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+	cwd, _ := os.Getwd()
+	// Ctrl-C ends --wait; the jobs still running are skipped.
+	ctx, stopInterrupt := interruptContext("waiting")
+	defer stopInterrupt()
+	res, err := cmd.MergeCmd(jobIDs, cfg.SubagentDir, resolveProjectID(cwd), os.Stdout, os.Stderr, &cmd.MergeOptions{
+		JSON:          jsonMode,
+		Wait:          wait,
+		Context:       ctx,
+		Keep:          keep || cfg.KeepJobs,
+		RetentionDays: cfg.RetentionDays,
+	})
+	if err != nil {
+		return die(err)
+	}
+	return res.ExitCode
 }
 
 func cmdStart(args []string) int {
+	attach := hasFlag(args, "--attach")
+	args = stripFlag(args, "--attach")
+	dryRun := hasFlag(args, "--dry-run")
+	args = stripFlag(args, "--dry-run")
+	// --json only shapes the --dry-run output; start prints a job ID.
+	jsonMode := dryRun && hasFlag(args, "--json")
+	if dryRun {
+		args = stripFlag(args, "--json")
+	}
+
+	args, err := projectDefaults(args)
+	if err != nil {
+		return die(err)
+	}
 	flags, err := cmd.ParseFlags(args)
 	if err != nil {
 		return die(err)
 	}
+	if flags.ContextFile != "" {
+		return die(errs.User(`"--context is only supported by glm run"`))
+	}
+	promptArgs = []string{flags.Prompt}
 
 	cfg, err := loadConfig()
 	if err != nil {
 		return die(err)
 	}
 
-	if flags.Timeout <= 0 {
-		flags.Timeout = config.DefaultTimeout
+	if err := cmd.ApplyTemplate(flags, cfg.ConfigDir, cfg.Templates); err != nil {
+		return die(err)
+	}
+	if err := cmd.ApplyFileRefs(flags); err != nil {
+		return die(err)
 	}
 
-	if err := cmd.Validate(flags); err != nil {
+	if dryRun {
+		return dryRunJob(cfg, flags, jsonMode)
+	}
+	j, err := startJob(cfg, flags)
+	if err != nil {
 		return die(err)
 	}
+	fmt.Fprintln(os.Stdout, j.ID)
 
-	projectID := resolveProjectID(flags.Dir)
+	if attach {
+		return attachJob(cfg, j.ProjectID, j.ID)
+	}
+	return 0
+}
+
+// interruptContext returns a context cancelled by the first SIGINT or
+// SIGTERM, which reports what is stopped; a second signal exits with 130 at
+// once. stop releases the handler.
+func interruptContext(what string) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+		case <-done:
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Interrupted; stopping %s (press Ctrl-C again to exit now)\n", what)
+		cancel()
+		select {
+		case <-sigs:
+			os.Exit(exitcode.Interrupted)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
+
+// startJob queues a job for flags with golem's Client.Start, which starts it
+// right away if a slot is free. Either way it returns immediately. glm serve
+// submits jobs through it too.
+func startJob(cfg *config.Config, flags *cmd.Flags) (*job.Job, error) {
+	return newClient(cfg).Start(context.Background(), runSpec(flags))
+}
 
-	// Create job.
-	jobID := job.GenerateJobID()
-	j, err := job.NewJob(cfg.SubagentDir, projectID, jobID)
+// cmdQueue handles "glm queue drain": one dispatch pass that starts queued
+// jobs while slots are free. Useful after raising max_parallel or when a
+// worker died before promoting the next job.
+func cmdQueue(args []string) int {
+	if len(args) != 1 || args[0] != "drain" {
+		return die(errs.User(`"Usage: glm queue drain"`))
+	}
+
+	cfg, err := loadConfig()
 	if err != nil {
 		return die(err)
 	}
 
-	// Write PID before printing job ID.
-	pid := os.Getpid()
-	_ = os.WriteFile(filepath.Join(j.Dir, "pid.txt"), []byte(strconv.Itoa(pid)), 0o644)
+	started, err := dispatchQueued(cfg)
+	if err != nil {
+		return die(err)
+	}
+	fmt.Printf("Started %d queued job(s)\n", started)
+	return 0
+}
 
-	// Print job ID immediately.
-	fmt.Fprintln(os.Stdout, jobID)
+// cmdWorker runs a job promoted from the queue. It is started detached by
+// launchWorker as "glm _worker JOB_DIR" and hands the job to golem's
+// Client.ExecuteJob, which sets the final status and then promotes the next
+// queued job into the slot it frees. SIGTERM (glm kill) cancels the job, so
+// claude's process group is torn down with the worker.
+func cmdWorker(args []string) int {
+	if len(args) != 1 {
+		return die(errs.User(`"Usage: glm _worker JOB_DIR"`))
+	}
+	jobDir := args[0]
+	// The worker shares the subagent dir of the command that queued the job
+	// (<root>/<project>/<job>), whatever its working directory or flags.
+	if abs, err := filepath.Abs(jobDir); err == nil {
+		subagentDirFlag = filepath.Dir(filepath.Dir(abs))
+	}
 
-	// Run in background goroutine.
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				_ = os.WriteFile(filepath.Join(j.Dir, "status"), []byte("failed"), 0o644)
-				_ = os.WriteFile(filepath.Join(j.Dir, "stderr.txt"),
-					[]byte(fmt.Sprintf("panic: %v", r)), 0o644)
-			}
-		}()
+	cfg, err := loadConfig()
+	if err != nil {
+		_ = job.AppendStderr(jobDir, err.Error())
+		_ = job.TransitionStatus(jobDir, job.StatusFailed)
+		return die(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return newClient(cfg).ExecuteJob(ctx, jobDir)
+}
 
-		_ = j.StatusTransition(job.StatusRunning)
+// dispatchQueued starts queued jobs as the configured slot limits allow.
+func dispatchQueued(cfg *config.Config) (int, error) {
+	return newClient(cfg).Dispatch(context.Background())
+}
 
-		claudeCfg := buildClaudeConfig(cfg, flags, j.Dir)
-		exitCode, _ := claude.Execute(claudeCfg)
-		_ = claude.ParseRawJSON(j.Dir)
+// newClient returns the golem Client glm works through: queued jobs run in
+// "glm _worker" processes, and job IDs resolve against the project of the
+// current directory first.
+func newClient(cfg *config.Config) *golem.Client {
+	cwd, _ := os.Getwd()
+	return golem.New(cfg, &golem.Options{Launch: launchWorker, ProjectDir: cwd, Logger: logger, Invocation: invocation(cfg)})
+}
 
-		stderrData, _ := os.ReadFile(filepath.Join(j.Dir, "stderr.txt"))
-		finalStatus := claude.MapStatus(exitCode, string(stderrData))
-		_ = os.WriteFile(filepath.Join(j.Dir, "status"), []byte(finalStatus), 0o644)
-	}()
+// promptArgs are the prompts given on this glm's command line, which
+// redact_prompts hides in the invocation jobs record.
+var promptArgs []string
 
-	// Wait for background goroutine to complete.
-	// For a proper daemon we'd need fork, but Go doesn't support fork.
-	// Instead, handle SIGINT/SIGTERM gracefully.
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
+// invocation returns what the jobs this glm creates record about it: its
+// version, command line, config sources and host (see cmd.NewInvocation).
+func invocation(cfg *config.Config) *job.Invocation {
+	return cmd.NewInvocation(cfg, version, os.Args, promptArgs)
+}
 
-	return 0
+// launchWorker starts "glm _worker JOB_DIR" in its own session, so it outlives
+// the caller and kill can signal its process group, and returns its PID. The
+// worker gets this glm's --profile and --config, so it loads the same
+// configuration.
+func launchWorker(jobDir string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	var args []string
+	if profileFlag != "" {
+		args = append(args, "--profile", profileFlag)
+	}
+	if configFlag != "" {
+		args = append(args, "--config", configFlag)
+	}
+	c := exec.Command(exe, append(args, "_worker", jobDir)...)
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := c.Start(); err != nil {
+		return 0, err
+	}
+	pid := c.Process.Pid
+	_ = c.Process.Release()
+	return pid, nil
 }
 
 func cmdStatus(args []string) int {
 	jsonMode := hasFlag(args, "--json")
 	args = stripFlag(args, "--json")
-
-	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, `err:user "No job ID provided"`)
-		return exitcode.UserError
+	verbose := hasFlag(args, "--verbose")
+	args = stripFlag(args, "--verbose")
+	all := hasFlag(args, "--all")
+	args = stripFlag(args, "--all")
+	tmpl, args, err := formatFlag(args, jsonMode)
+	if err != nil {
+		return die(err)
 	}
 
-	jobID := args[0]
+	if all && len(args) > 0 {
+		return die(errs.User(`"--all does not take a job ID"`))
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
@@ -386,6 +814,40 @@ func cmdStatus(args []string) int {
 	cwd, _ := os.Getwd()
 	projectID := resolveProjectID(cwd)
 
+	// Without a job ID, summarise the project's active jobs.
+	if len(args) == 0 {
+		if tmpl != nil {
+			for _, item := range cmd.ActiveJobStatuses(cfg.SubagentDir, projectID) {
+				if err := cmd.WriteFormatted(os.Stdout, tmpl, item); err != nil {
+					return die(err)
+				}
+			}
+			return 0
+		}
+		if jsonMode {
+			err = cmd.StatusAllJSON(cfg.SubagentDir, projectID, os.Stdout)
+		} else {
+			err = cmd.StatusAllCmd(cfg.SubagentDir, projectID, os.Stdout)
+		}
+		if err != nil {
+			return die(err)
+		}
+		return 0
+	}
+
+	jobID := args[0]
+
+	if tmpl != nil {
+		item, err := cmd.JobStatus(cfg.SubagentDir, projectID, jobID)
+		if err == nil {
+			err = cmd.WriteFormatted(os.Stdout, tmpl, item)
+		}
+		if err != nil {
+			return die(err)
+		}
+		return 0
+	}
+
 	if jsonMode {
 		if err := cmd.StatusJSON(cfg.SubagentDir, projectID, jobID, os.Stdout); err != nil {
 			return die(err)
@@ -393,20 +855,108 @@ func cmdStatus(args []string) int {
 		return 0
 	}
 
-	result, err := cmd.StatusCmd(jobID, cfg.SubagentDir, projectID, os.Stdout)
+	result, err := cmd.StatusCmd(jobID, cfg.SubagentDir, projectID, os.Stdout, &cmd.StatusOptions{Verbose: verbose})
+	if err != nil {
+		return die(err)
+	}
+	return result.ExitCode
+}
+
+func cmdAttach(args []string) int {
+	if len(args) == 0 {
+		return die(errs.User(`"No job ID provided"`))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+
+	cwd, _ := os.Getwd()
+	return attachJob(cfg, resolveProjectID(cwd), args[0])
+}
+
+// attachJob follows jobID until it finishes and returns its exit code. Ctrl-C
+// detaches and leaves the job running.
+func attachJob(cfg *config.Config, projectID, jobID string) int {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	detach := make(chan struct{})
+	go func() {
+		if _, ok := <-sigCh; ok {
+			close(detach)
+		}
+	}()
+
+	result, err := cmd.AttachCmd(cfg.SubagentDir, projectID, jobID, os.Stdout, os.Stderr,
+		&cmd.AttachOptions{Detach: detach})
 	if err != nil {
 		return die(err)
 	}
+	if result.Detached {
+		fmt.Fprintf(os.Stderr, "Detached; %s keeps running (glm attach %s)\n", jobID, jobID)
+	}
 	return result.ExitCode
 }
 
 func cmdResult(args []string) int {
 	jsonMode := hasFlag(args, "--json")
 	args = stripFlag(args, "--json")
+	tmpl, args, err := formatFlag(args, jsonMode)
+	if err != nil {
+		return die(err)
+	}
+
+	opts := &cmd.ResultOptions{
+		StdoutOnly:    hasFlag(args, "--stdout-only"),
+		ChangelogOnly: hasFlag(args, "--changelog-only"),
+		Keep:          hasFlag(args, "--keep"),
+	}
+	args = stripFlag(args, "--stdout-only")
+	args = stripFlag(args, "--changelog-only")
+	args = stripFlag(args, "--keep")
+	opts.Output, args = getFlagValue(args, "--output")
+	strict := hasFlag(args, "--strict-result")
+	args = stripFlag(args, "--strict-result")
+	resumeHint := hasFlag(args, "--resume-hint")
+	args = stripFlag(args, "--resume-hint")
+	approve := hasFlag(args, "--approve")
+	args = stripFlag(args, "--approve")
+	maxOutput, args := getFlagValue(args, "--max-output")
+	if maxOutput != "" {
+		n, err := cmd.ParseMaxOutput(maxOutput)
+		if err != nil {
+			return die(err)
+		}
+		opts.MaxOutput = n
+	}
+	merge := hasFlag(args, "--merge")
+	args = stripFlag(args, "--merge")
+	wait := hasFlag(args, "--wait")
+	args = stripFlag(args, "--wait")
+
+	if merge {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"--format", tmpl != nil}, {"--stdout-only", opts.StdoutOnly}, {"--changelog-only", opts.ChangelogOnly},
+			{"--output", opts.Output != ""}, {"--strict-result", strict}, {"--resume-hint", resumeHint},
+			{"--approve", approve}, {"--max-output", maxOutput != ""},
+		} {
+			if f.set {
+				return die(errs.User(`"--merge cannot be combined with %s"`, f.name))
+			}
+		}
+		return mergeResults(args, jsonMode, wait, opts.Keep)
+	}
+	if wait {
+		return die(errs.User(`"--wait requires --merge"`))
+	}
 
 	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, `err:user "No job ID provided"`)
-		return exitcode.UserError
+		return die(errs.User(`"No job ID provided"`))
 	}
 
 	jobID := args[0]
@@ -419,6 +969,37 @@ func cmdResult(args []string) int {
 	cwd, _ := os.Getwd()
 	projectID := resolveProjectID(cwd)
 
+	if tmpl != nil {
+		item, err := cmd.JobResult(cfg.SubagentDir, projectID, jobID)
+		if err == nil {
+			err = cmd.WriteFormatted(os.Stdout, tmpl, item)
+		}
+		if err != nil {
+			return die(err)
+		}
+		return 0
+	}
+
+	if resumeHint {
+		if err := cmd.ResumeHintCmd(jobID, cfg.SubagentDir, projectID, os.Stdout); err != nil {
+			return die(err)
+		}
+		return 0
+	}
+
+	if approve {
+		flags, err := cmd.ApproveFlags(cfg.SubagentDir, projectID, jobID)
+		if err != nil {
+			return die(err)
+		}
+		code := runJob(cfg, flags, jsonMode, false)
+		if code == 0 {
+			// Carried out; a failed run leaves the plan to approve again.
+			cmd.FinishPlan(cfg.SubagentDir, projectID, jobID, opts.Keep || cfg.KeepJobs, cfg.RetentionDays)
+		}
+		return code
+	}
+
 	if jsonMode {
 		if err := cmd.ResultJSON(cfg.SubagentDir, projectID, jobID, os.Stdout); err != nil {
 			return die(err)
@@ -426,7 +1007,14 @@ func cmdResult(args []string) int {
 		return 0
 	}
 
-	result, err := cmd.ResultCmd(jobID, cfg.SubagentDir, projectID, os.Stdout, os.Stderr)
+	opts.Keep = opts.Keep || cfg.KeepJobs
+	opts.RetentionDays = cfg.RetentionDays
+	opts.StrictResult = strict || cfg.StrictResult
+	opts.FailureMarkers = cfg.ResultFailureMarkers
+	if opts.MaxOutput == 0 {
+		opts.MaxOutput = cfg.MaxOutputBytes
+	}
+	result, err := cmd.ResultCmd(jobID, cfg.SubagentDir, projectID, os.Stdout, os.Stderr, opts)
 	if err != nil {
 		return die(err)
 	}
@@ -436,10 +1024,13 @@ func cmdResult(args []string) int {
 func cmdLog(args []string) int {
 	jsonMode := hasFlag(args, "--json")
 	args = stripFlag(args, "--json")
+	diffMode := hasFlag(args, "--diff")
+	args = stripFlag(args, "--diff")
+	statMode := hasFlag(args, "--stat")
+	args = stripFlag(args, "--stat")
 
 	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, `err:user "No job ID provided"`)
-		return exitcode.UserError
+		return die(errs.User(`"No job ID provided"`))
 	}
 
 	jobID := args[0]
@@ -453,90 +1044,280 @@ func cmdLog(args []string) int {
 	projectID := resolveProjectID(cwd)
 
 	if jsonMode {
-		if err := cmd.LogJSON(cfg.SubagentDir, projectID, jobID, os.Stdout); err != nil {
+		if err := cmd.LogJSON(cfg.SubagentDir, projectID, jobID, os.Stdout, &cmd.LogOptions{Stat: statMode}); err != nil {
 			return die(err)
 		}
 		return 0
 	}
 
-	if err := cmd.LogCmd(cfg.SubagentDir, projectID, jobID, os.Stdout); err != nil {
+	if err := cmd.LogCmd(cfg.SubagentDir, projectID, jobID, os.Stdout, &cmd.LogOptions{Diff: diffMode, Stat: statMode}); err != nil {
 		return die(err)
 	}
 	return 0
 }
 
-func cmdList(args []string) int {
+// cmdPrompt prints the prompt a job ran with, verbatim, or with --json its
+// JobPromptJSON.
+func cmdPrompt(args []string) int {
 	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--json")
+
+	if len(args) == 0 {
+		return die(errs.User(`"No job ID provided"`))
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
 		return die(err)
 	}
 
-	// Parse filter options (shared between JSON and text modes).
-	var filter cmd.FilterOptions
-	statusRaw, args := getFlagValue(args, "--status")
-	if statusRaw != "" {
-		statuses, parseErr := cmd.ParseStatusFilter(statusRaw)
-		if parseErr != nil {
-			return die(parseErr)
-		}
-		filter.Statuses = statuses
-	}
+	cwd, _ := os.Getwd()
+	projectID := resolveProjectID(cwd)
 
-	sinceRaw, _ := getFlagValue(args, "--since")
-	if sinceRaw != "" {
-		since, parseErr := cmd.ParseSinceFilter(sinceRaw, time.Now)
-		if parseErr != nil {
-			return die(parseErr)
-		}
-		filter.Since = since
+	if jsonMode {
+		err = cmd.PromptJSON(cfg.SubagentDir, projectID, args[0], os.Stdout)
+	} else {
+		err = cmd.PromptCmd(cfg.SubagentDir, projectID, args[0], os.Stdout)
+	}
+	if err != nil {
+		return die(err)
 	}
+	return 0
+}
 
-	if jsonMode {
-		if err := cmd.ListJSON(cfg.SubagentDir, &filter, os.Stdout); err != nil {
-			return die(err)
+// cmdLogs prints the GLM_LOG_FILE lines, or those of --file PATH, filtered
+// by --job and --level; --follow keeps printing new ones until Ctrl-C.
+func cmdLogs(args []string) int {
+	follow := hasFlag(args, "--follow") || hasFlag(args, "-f")
+	args = stripFlag(stripFlag(args, "--follow"), "-f")
+	path, args := getFlagValue(args, "--file")
+	if path == "" {
+		path = os.Getenv("GLM_LOG_FILE")
+	}
+	jobID, args := getFlagValue(args, "--job")
+	levelName, args := getFlagValue(args, "--level")
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm logs [--job JOB_ID] [--level LEVEL] [--follow] [--file PATH]"`))
+	}
+
+	opts := &cmd.LogsOptions{Job: jobID, Follow: follow}
+	if levelName != "" {
+		level, ok := log.ParseLevel(levelName)
+		if !ok {
+			return die(errs.User(`"Invalid --level %s: want debug, info, warn or error"`, levelName))
 		}
-		return 0
+		opts.Level = level
+	}
+	if follow {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+		stop := make(chan struct{})
+		go func() {
+			if _, ok := <-sigCh; ok {
+				close(stop)
+			}
+		}()
+		opts.Stop = stop
 	}
 
-	if err := cmd.ListCmd(cfg.SubagentDir, os.Stdout, &filter); err != nil {
+	if err := cmd.LogsCmd(path, os.Stdout, opts); err != nil {
 		return die(err)
 	}
 	return 0
 }
 
-func cmdClean(args []string) int {
+func cmdList(args []string) int {
+	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--json")
+	tmpl, args, err := formatFlag(args, jsonMode)
+	if err != nil {
+		return die(err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+
+	// Parse filter options (shared between JSON and text modes).
+	filter := cmd.FilterOptions{Out: out}
+	filter.UTC = hasFlag(args, "--utc")
+	args = stripFlag(args, "--utc")
+	statusRaw, args := getFlagValue(args, "--status")
+	if statusRaw != "" {
+		statuses, parseErr := cmd.ParseStatusFilter(statusRaw)
+		if parseErr != nil {
+			return die(parseErr)
+		}
+		filter.Statuses = statuses
+	}
+
+	filter.Chain, args = getFlagValue(args, "--chain")
+	if filter.Chain != "" {
+		if err := job.ValidateChainID(filter.Chain); err != nil {
+			return die(err)
+		}
+	}
+
+	filter.Lineage, args = getFlagValue(args, "--lineage")
+
+	filter.Reverse = hasFlag(args, "--reverse")
+	args = stripFlag(args, "--reverse")
+	sortRaw, args := getFlagValue(args, "--sort")
+	if sortRaw != "" {
+		if filter.Sort, err = cmd.ParseListSort(sortRaw); err != nil {
+			return die(err)
+		}
+	}
+
+	for _, pf := range []struct {
+		flag string
+		dst  *int
+	}{{"--limit", &filter.Limit}, {"--offset", &filter.Offset}} {
+		var raw string
+		raw, args = getFlagValue(args, pf.flag)
+		if raw == "" {
+			continue
+		}
+		n, convErr := strconv.Atoi(raw)
+		if convErr != nil || n < 0 {
+			return die(errs.User(`"Invalid %s value: %s (must be a non-negative integer)"`, pf.flag, raw))
+		}
+		*pf.dst = n
+	}
+
+	sinceRaw, _ := getFlagValue(args, "--since")
+	if sinceRaw != "" {
+		since, parseErr := cmd.ParseSinceFilter(sinceRaw, time.Now)
+		if parseErr != nil {
+			return die(parseErr)
+		}
+		filter.Since = since
+	}
+	if filter.Lineage != "" && (filter.Statuses != nil || filter.Chain != "" || filter.Limit > 0 || filter.Offset > 0 || sinceRaw != "" || filter.Sort != "" || filter.Reverse) {
+		return die(errs.User(`"--lineage cannot be combined with --status, --chain, --since, --limit, --offset, --sort or --reverse"`))
+	}
+
+	if tmpl != nil {
+		if err := cmd.ListFormat(cfg.SubagentDir, &filter, tmpl, os.Stdout); err != nil {
+			return die(err)
+		}
+		return 0
+	}
+	if jsonMode {
+		if err := cmd.ListJSON(cfg.SubagentDir, &filter, os.Stdout); err != nil {
+			return die(err)
+		}
+		return 0
+	}
+
+	if err := cmd.ListCmd(cfg.SubagentDir, os.Stdout, &filter); err != nil {
+		return die(err)
+	}
+	return 0
+}
+
+func cmdClean(args []string) int {
 	days := -1 // default: remove only terminal status
 
-	daysRaw, _ := getFlagValue(args, "--days")
+	daysRaw, args := getFlagValue(args, "--days")
 	if daysRaw != "" {
 		d, err := strconv.Atoi(daysRaw)
 		if err != nil || d < 0 {
-			fmt.Fprintf(os.Stderr, `err:user "Invalid --days value: %s"`+"\n", daysRaw)
-			return exitcode.UserError
+			return die(errs.User(`"Invalid --days value: %s"`, daysRaw))
 		}
 		days = d
 	}
 
+	opts := &cmd.CleanOptions{Out: out, Force: hasFlag(args, "--force")}
+	args = stripFlag(args, "--force")
+	statusRaw, args := getFlagValue(args, "--status")
+	statuses, err := cmd.ParseStatusFilter(statusRaw)
+	if err != nil {
+		return die(err)
+	}
+	opts.Statuses = statuses
+	opts.ProjectName, _ = getFlagValue(args, "--project-name")
+	if hasFlag(args, "--project") {
+		if opts.ProjectName != "" {
+			return die(errs.User(`"--project cannot be combined with --project-name"`))
+		}
+		cwd, _ := os.Getwd()
+		opts.ProjectID = resolveProjectID(cwd)
+	}
+
 	cfg, err := loadConfig()
 	if err != nil {
 		return die(err)
 	}
 
-	if err := cmd.CleanCmd(cfg.SubagentDir, days, time.Now(), os.Stdout); err != nil {
+	if err := cmd.CleanCmd(cfg.SubagentDir, days, time.Now(), os.Stdout, opts); err != nil {
 		return die(err)
 	}
 	return 0
 }
 
-func cmdKill(args []string) int {
-	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, `err:user "No job ID provided"`)
-		return exitcode.UserError
+// cmdDu prints the disk usage of the subagents directory per project and job.
+func cmdDu(args []string) int {
+	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--json")
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm du [--json]"`))
 	}
 
-	jobID := args[0]
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+
+	if err := cmd.DuCmd(cfg.SubagentDir, os.Stdout, &cmd.DuOptions{JSON: jsonMode}); err != nil {
+		return die(err)
+	}
+	return 0
+}
+
+// cmdMetrics handles "glm metrics summary": it summarizes the metrics log
+// that jobs append to when metrics_enabled is set.
+func cmdMetrics(args []string) int {
+	if len(args) == 0 || args[0] != "summary" {
+		return die(errs.User(`"Usage: glm metrics summary [--since D] [--json]"`))
+	}
+	args = args[1:]
+	opts := &cmd.MetricsOptions{JSON: hasFlag(args, "--json")}
+	args = stripFlag(args, "--json")
+	sinceRaw, args := getFlagValue(args, "--since")
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm metrics summary [--since D] [--json]"`))
+	}
+	since, err := cmd.ParseSinceFilter(sinceRaw, time.Now)
+	if err != nil {
+		return die(err)
+	}
+	opts.Since = since
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+	if !cfg.MetricsEnabled {
+		fmt.Fprintln(os.Stderr, "Note: metrics_enabled is off; finished jobs are not being recorded")
+	}
+
+	if err := cmd.MetricsSummaryCmd(cmd.MetricsPath(cfg.ConfigDir), os.Stdout, opts); err != nil {
+		return die(err)
+	}
+	return 0
+}
+
+// cmdExport packs a job directory into a tarball for sharing.
+func cmdExport(args []string) int {
+	redact := hasFlag(args, "--redact")
+	args = stripFlag(args, "--redact")
+	output, args := getFlagValue(args, "--output")
+	if len(args) != 1 {
+		return die(errs.User(`"Usage: glm export JOB_ID [--output FILE.tar.gz] [--redact]"`))
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
@@ -544,62 +1325,196 @@ func cmdKill(args []string) int {
 	}
 
 	cwd, _ := os.Getwd()
-	projectID := resolveProjectID(cwd)
+	path, err := cmd.ExportCmd(cfg.SubagentDir, resolveProjectID(cwd), args[0], &cmd.ExportOptions{
+		Output:  output,
+		Redact:  redact,
+		Secrets: []string{cfg.ZaiAPIKey, cfg.ServeToken},
+	})
+	if err != nil {
+		return die(err)
+	}
+	fmt.Println(path)
+	return 0
+}
+
+// cmdImport unpacks a glm export into the current project as a new job.
+func cmdImport(args []string) int {
+	if len(args) != 1 {
+		return die(errs.User(`"Usage: glm import FILE"`))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+
+	cwd, _ := os.Getwd()
+	id, err := cmd.ImportCmd(cfg.SubagentDir, resolveProjectID(cwd), args[0])
+	if err != nil {
+		return die(err)
+	}
+	fmt.Println(id)
+	return 0
+}
+
+func cmdKill(args []string) int {
+	graceRaw, args := getFlagValue(args, "--grace")
+	if len(args) == 0 {
+		return die(errs.User(`"No job ID provided"`))
+	}
+
+	jobID := args[0]
 
-	signalFn := func(pid int, sig os.Signal) error {
-		return syscall.Kill(-pid, sig.(syscall.Signal))
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
 	}
-	sleepFn := func() {
-		time.Sleep(1 * time.Second)
+	if graceRaw != "" {
+		grace, err := config.ParseTimeout(graceRaw)
+		if err != nil || grace < 0 {
+			return die(errs.User(`"Invalid --grace value: %s (seconds like 5 or a duration like 30s)"`, graceRaw))
+		}
+		cfg.KillGraceSeconds = grace
 	}
 
-	if err := cmd.KillCmd(cfg.SubagentDir, projectID, jobID, signalFn, sleepFn); err != nil {
+	if err := killJob(cfg, jobID); err != nil {
 		return die(err)
 	}
 	return 0
 }
 
+// killJob stops jobID's process group with golem's Client.Kill, like glm kill.
+func killJob(cfg *config.Config, jobID string) error {
+	return newClient(cfg).Kill(context.Background(), jobID)
+}
+
 func cmdChain(args []string) int {
 	// Parse chain-specific flags.
 	continueOnError := hasFlag(args, "--continue-on-error")
-
-	// Remove --continue-on-error from args for flag parsing.
-	var cleanArgs []string
-	for _, a := range args {
-		if a != "--continue-on-error" {
-			cleanArgs = append(cleanArgs, a)
+	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--json")
+	args = stripFlag(args, "--continue-on-error")
+	summarizeContext := hasFlag(args, "--summarize-context")
+	args = stripFlag(args, "--summarize-context")
+	cleanIntermediate := hasFlag(args, "--clean-intermediate")
+	args = stripFlag(args, "--clean-intermediate")
+	contextAsFile := hasFlag(args, "--context-as-file")
+	args = stripFlag(args, "--context-as-file")
+	dryRun := hasFlag(args, "--dry-run")
+	args = stripFlag(args, "--dry-run")
+	resume, args := getFlagValue(args, "--resume")
+	from, args := getFlagValue(args, "--from")
+	totalTimeoutRaw, args := getFlagValue(args, "--total-timeout")
+	injectRaw, args := getFlagValue(args, "--inject")
+	inject := cmd.InjectStdout
+	if injectRaw != "" {
+		var err error
+		if inject, err = cmd.ParseInjectMode(injectRaw); err != nil {
+			return die(err)
+		}
+	}
+	var totalTimeout time.Duration
+	if totalTimeoutRaw != "" {
+		var err error
+		if totalTimeout, err = cmd.ParseTotalTimeout(totalTimeoutRaw); err != nil {
+			return die(err)
 		}
 	}
 
-	// Split prompts (each quoted argument is a prompt).
-	flags, err := cmd.ParseFlags(cleanArgs)
+	args, err := projectDefaults(args)
 	if err != nil {
 		return die(err)
 	}
 
+	// Flags may appear anywhere; each positional argument is a prompt, or a
+	// name:prompt step, and --then separates parallel groups.
+	flags, groups, err := cmd.ParseChainGroups(args)
+	if err != nil {
+		return die(err)
+	}
+	for _, group := range groups {
+		promptArgs = append(promptArgs, group...)
+	}
+
 	cfg, err := loadConfig()
 	if err != nil {
 		return die(err)
 	}
 
-	if flags.Timeout <= 0 {
-		flags.Timeout = config.DefaultTimeout
+	// A --template renders into the first step.
+	templatePrompt, err := cmd.RenderFlagsTemplate(flags, cfg.ConfigDir, cfg.Templates)
+	if err != nil {
+		return die(err)
+	}
+	if templatePrompt != "" {
+		groups = append([][]string{{templatePrompt}}, groups...)
+	}
+	if len(groups) == 0 {
+		return die(errs.User(`"No prompts provided"`))
+	}
+	for _, group := range groups {
+		for i, p := range group {
+			if flags.ExpandFiles {
+				if p, err = cmd.ExpandFileRefs(p, flags.Dir); err != nil {
+					return die(err)
+				}
+				group[i] = p
+			}
+			if err := cmd.CheckPromptSize(p, cfg.MaxPromptBytes); err != nil {
+				return die(err)
+			}
+		}
 	}
 
-	// For chain, the "prompt" is actually multiple prompts joined.
-	// Re-parse args to extract individual prompts.
-	prompts := extractPrompts(cleanArgs)
-	if len(prompts) == 0 {
-		fmt.Fprintln(os.Stderr, `err:user "No prompts provided"`)
-		return exitcode.UserError
+	if flags.Timeout <= 0 {
+		flags.Timeout = cfg.DefaultTimeout
+	}
+	// The steps record the canonical workdir, as run and start do (see
+	// cmd.Validate); a missing one is left for the steps to fail on.
+	if dir, err := job.CanonicalDir(flags.Dir); err == nil {
+		flags.Dir = dir
+	}
+	if err := checkWorkDirSafety(cfg, flags); err != nil {
+		return die(err)
+	}
+	if err := cmd.CheckDiskQuota(cfg.SubagentDir, cfg.MaxDiskMB, flags.StrictDisk, os.Stderr); err != nil {
+		return die(err)
 	}
 
 	projectID := resolveProjectID(flags.Dir)
 
 	cf := &cmd.ChainFlags{
-		Flags:           flags,
-		ContinueOnError: continueOnError,
-		Prompts:         prompts,
+		Flags:             flags,
+		ContinueOnError:   continueOnError,
+		Groups:            groups,
+		Config:            cfg,
+		ContextLimit:      cfg.ChainContextLimit,
+		AllowOverlap:      flags.AllowOverlap || cfg.AllowOverlap,
+		MaxParallel:       cfg.MaxParallel,
+		JSON:              jsonMode,
+		Resume:            resume,
+		From:              from,
+		Out:               out,
+		TotalTimeout:      totalTimeout,
+		CleanIntermediate: cleanIntermediate || cfg.ChainCleanIntermediate,
+		Inject:            inject,
+		DryRun:            dryRun,
+		Invocation:        invocation(cfg),
+		ContextAsFile:     contextAsFile,
+	}
+	if summarizeContext {
+		cf.Summarize = cmd.ClaudeSummarizer(claude.Config{
+			ZAIAPIKey:       cfg.ZaiAPIKey,
+			ZAIBaseURL:      cfg.ZaiBaseURL,
+			ZAIAPITimeoutMS: cfg.ZaiAPITimeoutMs,
+			ClaudePath:      cfg.ClaudePath,
+			OpusModel:       cf.SlotModel("opus"),
+			SonnetModel:     cf.SlotModel("sonnet"),
+			HaikuModel:      cf.SlotModel("haiku"),
+			PermissionMode:  "default",
+			WorkDir:         flags.Dir,
+			TimeoutSecs:     flags.Timeout,
+		})
 	}
 
 	result, err := cmd.ChainCmd(cf, cfg.SubagentDir, projectID, os.Stdout, os.Stderr)
@@ -609,38 +1524,11 @@ func cmdChain(args []string) int {
 	return result.ExitCode
 }
 
-// extractPrompts extracts individual prompts from chain arguments.
-// Flags (-d, -t, -m, etc.) and their values are skipped.
-func extractPrompts(args []string) []string {
-	flagsWithValue := map[string]bool{
-		"-d": true, "-t": true, "-m": true,
-		"--opus": true, "--sonnet": true, "--haiku": true, "--mode": true,
-	}
-
-	var prompts []string
-	for i := 0; i < len(args); i++ {
-		a := args[i]
-		if flagsWithValue[a] {
-			i++ // skip value
-			continue
-		}
-		if a == "--unsafe" || a == "--continue-on-error" {
-			continue
-		}
-		if strings.HasPrefix(a, "-") {
-			continue
-		}
-		prompts = append(prompts, a)
-	}
-	return prompts
-}
-
 func cmdSession(args []string) int {
-	home, err := os.UserHomeDir()
+	configDir, _, err := resolveConfigDir()
 	if err != nil {
 		return die(err)
 	}
-	configDir := filepath.Join(home, ".config", "GoLeM")
 
 	var debugLog *log.Logger
 	if os.Getenv("GLM_DEBUG") == "1" {
@@ -652,21 +1540,35 @@ func cmdSession(args []string) int {
 		debugWriter = os.Stderr
 	}
 
-	result, err := cmd.SessionCmd(configDir, args, debugWriter)
+	root, err := subagentsRoot(configDir)
+	if err != nil {
+		return die(err)
+	}
+	cwd, _ := os.Getwd()
+	sessionOpts := &cmd.SessionOptions{
+		SubagentsRoot: root,
+		ProjectID:     resolveProjectID(cwd),
+		ConfigFile:    configFlag,
+	}
+	result, err := cmd.SessionCmd(configDir, args, debugWriter, sessionOpts)
 	if err != nil {
 		return die(err)
 	}
 
+	if result.DryRun {
+		fmt.Println(result.CommandLine())
+		return 0
+	}
+
 	// Change working directory if specified.
 	if result.WorkDir != "" {
 		if err := os.Chdir(result.WorkDir); err != nil {
-			fmt.Fprintf(os.Stderr, `err:user "Directory not found: %s"`+"\n", result.WorkDir)
-			return exitcode.UserError
+			return die(errs.User(`"Directory not found: %s"`, result.WorkDir))
 		}
 	}
 
 	// Exec the claude binary, replacing the current process.
-	claudePath, err := findClaude()
+	claudePath, err := claude.FindBinary(result.ClaudePath)
 	if err != nil {
 		return die(err)
 	}
@@ -678,14 +1580,31 @@ func cmdSession(args []string) int {
 	return 0 // unreachable after exec
 }
 
-func cmdDoctor() int {
+func cmdDoctor(args []string) int {
+	fix := hasFlag(args, "--fix")
+	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--fix")
+	args = stripFlag(args, "--json")
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm doctor [--fix] [--json]"`))
+	}
+
 	cfg, err := loadConfig()
 	if err != nil {
 		// Doctor should work even without full config.
 		home, _ := os.UserHomeDir()
+		configDir, _, dirErr := resolveConfigDir()
+		if dirErr != nil {
+			return die(dirErr)
+		}
+		root, rootErr := subagentsRoot(configDir)
+		if rootErr != nil {
+			root = filepath.Join(home, ".claude", "subagents")
+		}
 		cfg = &config.Config{
-			SubagentDir: filepath.Join(home, ".claude", "subagents"),
-			ConfigDir:   filepath.Join(home, ".config", "GoLeM"),
+			SubagentDir: root,
+			ConfigDir:   configDir,
+			ZaiBaseURL:  config.ZaiBaseURL,
 			MaxParallel: config.DefaultMaxParallel,
 			OpusModel:   config.DefaultModel,
 			SonnetModel: config.DefaultModel,
@@ -693,36 +1612,160 @@ func cmdDoctor() int {
 		}
 	}
 
-	opts := cmd.DoctorOptions{
-		ClaudeBinaryName: "claude",
-		APIKeyPath:       filepath.Join(cfg.ConfigDir, "zai_api_key"),
-		ZAIEndpoint:      config.ZaiBaseURL,
-		HTTPTimeout:      5 * time.Second,
-		SubagentsRoot:    cfg.SubagentDir,
-		MaxParallel:      cfg.MaxParallel,
-		OpusModel:        cfg.OpusModel,
-		SonnetModel:      cfg.SonnetModel,
-		HaikuModel:       cfg.HaikuModel,
+	opts := doctorOptions(cfg)
+	opts.Fix = fix
+	opts.JSON = jsonMode
+	if home, err := os.UserHomeDir(); err == nil {
+		opts.ClaudeMDPath = filepath.Join(home, ".claude", "CLAUDE.md")
 	}
-
+	// A source install re-injects its own CLAUDE.md template.
+	if execPath, err := os.Executable(); err == nil {
+		if realPath, err := filepath.EvalSymlinks(execPath); err == nil {
+			dir := filepath.Dir(filepath.Dir(realPath))
+			if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+				opts.CloneDir = dir
+			}
+		}
+	}
+	opts.Out = out
 	if err := cmd.DoctorCmd(opts, os.Stdout); err != nil {
 		return die(err)
 	}
 	return 0
 }
 
-func cmdUpdate() int {
+// doctorOptions returns the DoctorOptions for cfg.
+func doctorOptions(cfg *config.Config) cmd.DoctorOptions {
+	return cmd.DoctorOptions{
+		ClaudeBinaryName:    claude.BinaryName,
+		ClaudePath:          cfg.ClaudePath,
+		APIKeyPath:          cfg.APIKeyPath(),
+		APIKeySource:        cfg.APIKeySource,
+		ZAIEndpoint:         cfg.ZaiBaseURL,
+		HTTPTimeout:         5 * time.Second,
+		SubagentsRoot:       cfg.SubagentDir,
+		MaxParallel:         cfg.MaxParallel,
+		MaxParallelPerModel: cfg.MaxParallelPerModel,
+		OpusModel:           cfg.OpusModel,
+		SonnetModel:         cfg.SonnetModel,
+		HaikuModel:          cfg.HaikuModel,
+	}
+}
+
+// serveOptions returns the ServeOptions for cfg: jobs resolve against the
+// project of the current directory, and submissions and kills go through
+// startJob and killJob.
+func serveOptions(cfg *config.Config) cmd.ServeOptions {
+	cwd, _ := os.Getwd()
+	projectID := resolveProjectID(cwd)
+	return cmd.ServeOptions{
+		SubagentsRoot: cfg.SubagentDir,
+		ProjectID:     projectID,
+		Doctor:        doctorOptions(cfg),
+		Token:         cfg.ServeToken,
+		Submit:        func(f *cmd.Flags) (*job.Job, error) { return startJob(cfg, f) },
+		Kill:          func(jobID string) error { return killJob(cfg, jobID) },
+	}
+}
+
+// cmdServe runs the HTTP API until SIGINT or SIGTERM.
+func cmdServe(args []string) int {
+	addr, args := getFlagValue(args, "--addr")
+	if addr == "" {
+		addr = cmd.DefaultServeAddr
+	}
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm serve [--addr HOST:PORT]"`))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cmd.ServeCmd(ctx, addr, serveOptions(cfg), os.Stderr); err != nil {
+		return die(err)
+	}
+	return 0
+}
+
+// cmdMCP serves the MCP tools on stdin/stdout until the client closes stdin.
+func cmdMCP(args []string) int {
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm mcp"`))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+
+	opts := cmd.MCPOptions{ServeOptions: serveOptions(cfg), Version: version}
+	if err := cmd.MCPCmd(os.Stdin, os.Stdout, opts); err != nil {
+		return die(err)
+	}
+	return 0
+}
+
+func cmdVersion(args []string) int {
+	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--json")
+	checkUpdate := hasFlag(args, "--check-update")
+	args = stripFlag(args, "--check-update")
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm version [--json] [--check-update]"`))
+	}
+
+	configDir, _, err := resolveConfigDir()
+	if err != nil {
+		return die(err)
+	}
+	err = cmd.VersionCmd(cmd.VersionOptions{
+		Version:     version,
+		Commit:      commit,
+		Date:        date,
+		ConfigDir:   configDir,
+		JSON:        jsonMode,
+		CheckUpdate: checkUpdate,
+		Out:         os.Stdout,
+		ErrOut:      os.Stderr,
+	})
+	if err != nil {
+		return die(err)
+	}
+	return 0
+}
+
+func cmdUpdate(args []string) int {
+	check := hasFlag(args, "--check")
+	args = stripFlag(args, "--check")
+	yes := hasFlag(args, "--yes") || hasFlag(args, "-y")
+	args = stripFlag(stripFlag(args, "--yes"), "-y")
+	target, args := getFlagValue(args, "--to")
+	force, keep, args, err := claudeMDFlags(args)
+	if err != nil {
+		return die(err)
+	}
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm update [--to TAG|BRANCH] [--check] [--yes] [--force|--keep]"`))
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return die(err)
 	}
 
-	configDir := filepath.Join(home, ".config", "GoLeM")
+	configDir, _, err := resolveConfigDir()
+	if err != nil {
+		return die(err)
+	}
 
 	// Determine clone directory (where GoLeM source lives).
 	execPath, err := os.Executable()
 	if err != nil {
-		return die(fmt.Errorf(`err:user "Cannot determine executable path"`))
+		return die(errs.User(`"Cannot determine executable path"`))
 	}
 	realPath, err := filepath.EvalSymlinks(execPath)
 	if err != nil {
@@ -733,11 +1776,18 @@ func cmdUpdate() int {
 	claudeMDPath := filepath.Join(home, ".claude", "CLAUDE.md")
 
 	opts := cmd.UpdateOptions{
-		ConfigDir:    configDir,
-		CloneDir:     cloneDir,
-		ClaudeMDPath: claudeMDPath,
-		Out:          os.Stdout,
-		ErrOut:       os.Stderr,
+		ConfigDir:     configDir,
+		CloneDir:      cloneDir,
+		ClaudeMDPath:  claudeMDPath,
+		Version:       version,
+		Target:        target,
+		Check:         check,
+		Yes:           yes,
+		ForceClaudeMD: force,
+		KeepClaudeMD:  keep,
+		In:            os.Stdin,
+		Out:           os.Stdout,
+		ErrOut:        os.Stderr,
 	}
 
 	if err := cmd.UpdateCmd(opts); err != nil {
@@ -748,24 +1798,28 @@ func cmdUpdate() int {
 
 func cmdConfig(args []string) int {
 	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, `err:user "Usage: glm config {show|set KEY VALUE}"`)
-		return exitcode.UserError
+		return die(errs.User(`"Usage: glm config {show|set KEY VALUE|explain models}"`))
 	}
 
-	home, err := os.UserHomeDir()
+	configDir, configDirSource, err := resolveConfigDir()
+	if err != nil {
+		return die(err)
+	}
+	subagentDir, err := subagentsRoot(configDir)
 	if err != nil {
 		return die(err)
 	}
-	configDir := filepath.Join(home, ".config", "GoLeM")
-	subagentDir := filepath.Join(home, ".claude", "subagents")
 
 	switch args[0] {
 	case "show":
 		opts := cmd.ConfigShowOptions{
-			ConfigDir:   configDir,
-			SubagentDir: subagentDir,
-			EnvGetenv:   os.Getenv,
+			ConfigDir:       configDir,
+			ConfigDirSource: configDirSource,
+			SubagentDir:     subagentDir,
+			EnvGetenv:       os.Getenv,
+			ConfigFile:      configFlag,
 		}
+		opts.WorkDir, _ = os.Getwd()
 		if err := cmd.ConfigShowCmd(opts, os.Stdout); err != nil {
 			return die(err)
 		}
@@ -773,26 +1827,129 @@ func cmdConfig(args []string) int {
 
 	case "set":
 		if len(args) < 3 {
-			fmt.Fprintln(os.Stderr, `err:user "Usage: glm config set KEY VALUE"`)
-			return exitcode.UserError
+			return die(errs.User(`"Usage: glm config set KEY VALUE"`))
 		}
 		opts := cmd.ConfigSetOptions{
-			ConfigDir: configDir,
-			Key:       args[1],
-			Value:     args[2],
+			ConfigDir:  configDir,
+			Key:        args[1],
+			Value:      args[2],
+			ConfigFile: configFlag,
 		}
 		if err := cmd.ConfigSetCmd(opts); err != nil {
 			return die(err)
 		}
 		return 0
 
+	case "explain":
+		if len(args) < 2 || args[1] != "models" {
+			return die(errs.User(`"Usage: glm config explain models [-m MODEL] [--opus|--sonnet|--haiku MODEL] [--step PREFIX] [--json]"`))
+		}
+		return explainModels(args[2:])
+
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown config subcommand: %s\n", args[0])
 		return exitcode.UserError
 	}
 }
 
-func cmdInstall() int {
+// explainModels prints the models glm run would use with the model flags in
+// args and the project's defaults, and where each came from, without running
+// anything. --step resolves a chain step with that prefix, e.g. [slot=haiku].
+func explainModels(args []string) int {
+	jsonMode := hasFlag(args, "--json")
+	args = stripFlag(args, "--json")
+	stepArg, args := getFlagValue(args, "--step")
+
+	var step cmd.StepPrefix
+	if stepArg != "" {
+		var err error
+		if step, _, err = cmd.ParseStepPrefix(stepArg); err != nil {
+			return die(errs.User(`"Invalid --step value: %s"`, err.Error()))
+		}
+		if step == (cmd.StepPrefix{}) {
+			return die(errs.User(`"Invalid --step value: %s (want a step prefix such as [slot=haiku] or [model=glm-4.5])"`, stepArg))
+		}
+	}
+	args, err := projectDefaults(args)
+	if err != nil {
+		return die(err)
+	}
+	flags, err := cmd.ParseFlags(args)
+	if err != nil {
+		return die(err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return die(err)
+	}
+
+	models := cmd.ResolveModels(cfg, flags, step)
+	if jsonMode {
+		err = cmd.JSONOutput(os.Stdout, models)
+	} else {
+		err = cmd.ExplainModels(models, os.Stdout)
+	}
+	if err != nil {
+		return die(err)
+	}
+	return 0
+}
+
+func cmdTemplate(args []string) int {
+	if len(args) == 0 {
+		return die(errs.User(`"Usage: glm template {list|show NAME}"`))
+	}
+
+	configDir, _, err := resolveConfigDir()
+	if err != nil {
+		return die(err)
+	}
+	templates, err := config.ReadTemplates(configDir, loadOptions())
+	if err != nil {
+		return die(err)
+	}
+
+	switch args[0] {
+	case "list":
+		if err := cmd.TemplateListCmd(configDir, templates, os.Stdout); err != nil {
+			return die(err)
+		}
+		return 0
+
+	case "show":
+		if len(args) < 2 {
+			return die(errs.User(`"Usage: glm template show NAME"`))
+		}
+		if err := cmd.TemplateShowCmd(configDir, templates, args[1], os.Stdout); err != nil {
+			return die(err)
+		}
+		return 0
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown template subcommand: %s\n", args[0])
+		return exitcode.UserError
+	}
+}
+
+// claudeMDFlags strips --force and --keep, which decide what happens to a
+// GLM section in CLAUDE.md that was edited by hand.
+func claudeMDFlags(args []string) (force, keep bool, rest []string, err error) {
+	force, keep = hasFlag(args, "--force"), hasFlag(args, "--keep")
+	if force && keep {
+		return false, false, nil, errs.User(`"--force and --keep cannot be combined"`)
+	}
+	return force, keep, stripFlag(stripFlag(args, "--force"), "--keep"), nil
+}
+
+func cmdInstall(args []string) int {
+	force, keep, args, err := claudeMDFlags(args)
+	if err != nil {
+		return die(err)
+	}
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm _install [--force|--keep]"`))
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return die(err)
@@ -810,15 +1967,22 @@ func cmdInstall() int {
 		cloneDir = ""
 	}
 
+	configDir, _, err := resolveConfigDir()
+	if err != nil {
+		return die(err)
+	}
+
 	opts := cmd.InstallOptions{
-		CloneDir:     cloneDir,
-		BinDir:       filepath.Join(home, ".local", "bin"),
-		ConfigDir:    filepath.Join(home, ".config", "GoLeM"),
-		ClaudeMDPath: filepath.Join(home, ".claude", "CLAUDE.md"),
-		SubagentsDir: filepath.Join(home, ".claude", "subagents"),
-		Version:      version,
-		In:           os.Stdin,
-		Out:          os.Stdout,
+		CloneDir:      cloneDir,
+		BinDir:        filepath.Join(home, ".local", "bin"),
+		ConfigDir:     configDir,
+		ClaudeMDPath:  filepath.Join(home, ".claude", "CLAUDE.md"),
+		SubagentsDir:  filepath.Join(home, ".claude", "subagents"),
+		Version:       version,
+		ForceClaudeMD: force,
+		KeepClaudeMD:  keep,
+		In:            os.Stdin,
+		Out:           os.Stdout,
 	}
 
 	if err := cmd.InstallCmd(opts); err != nil {
@@ -827,17 +1991,35 @@ func cmdInstall() int {
 	return 0
 }
 
-func cmdUninstall() int {
+func cmdUninstall(args []string) int {
+	dryRun := hasFlag(args, "--dry-run")
+	args = stripFlag(args, "--dry-run")
+	yes := hasFlag(args, "--yes") || hasFlag(args, "-y")
+	args = stripFlag(stripFlag(args, "--yes"), "-y")
+	force := hasFlag(args, "--force")
+	args = stripFlag(args, "--force")
+	if len(args) > 0 {
+		return die(errs.User(`"Usage: glm uninstall [--dry-run] [--yes] [--force]"`))
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return die(err)
 	}
 
+	configDir, _, err := resolveConfigDir()
+	if err != nil {
+		return die(err)
+	}
+
 	opts := cmd.UninstallOptions{
 		BinDir:       filepath.Join(home, ".local", "bin"),
-		ConfigDir:    filepath.Join(home, ".config", "GoLeM"),
+		ConfigDir:    configDir,
 		ClaudeMDPath: filepath.Join(home, ".claude", "CLAUDE.md"),
 		SubagentsDir: filepath.Join(home, ".claude", "subagents"),
+		DryRun:       dryRun,
+		Yes:          yes,
+		Force:        force,
 		In:           os.Stdin,
 		Out:          os.Stdout,
 	}
@@ -848,65 +2030,47 @@ func cmdUninstall() int {
 	return 0
 }
 
-// buildClaudeConfig creates a claude.Config from the loaded config and parsed flags.
-func buildClaudeConfig(cfg *config.Config, flags *cmd.Flags, jobDir string) claude.Config {
-	opusModel := cfg.OpusModel
-	sonnetModel := cfg.SonnetModel
-	haikuModel := cfg.HaikuModel
-
-	if flags.Model != "" {
-		opusModel = flags.Model
-		sonnetModel = flags.Model
-		haikuModel = flags.Model
-	}
-	if flags.OpusModel != "" {
-		opusModel = flags.OpusModel
-	}
-	if flags.SonnetModel != "" {
-		sonnetModel = flags.SonnetModel
-	}
-	if flags.HaikuModel != "" {
-		haikuModel = flags.HaikuModel
-	}
-
-	permMode := cfg.PermissionMode
+// permissionMode returns the permission mode a job will run with: the
+// --mode/--unsafe flag, else the configured default.
+func permissionMode(cfg *config.Config, flags *cmd.Flags) string {
 	if flags.PermissionMode != "" {
-		permMode = flags.PermissionMode
-	}
-
-	return claude.Config{
-		ZAIAPIKey:       cfg.ZaiAPIKey,
-		ZAIBaseURL:      cfg.ZaiBaseURL,
-		ZAIAPITimeoutMS: cfg.ZaiAPITimeoutMs,
-		OpusModel:       opusModel,
-		SonnetModel:     sonnetModel,
-		HaikuModel:      haikuModel,
-		PermissionMode:  permMode,
-		Model:           sonnetModel, // default execution model
-		Prompt:          flags.Prompt,
-		WorkDir:         flags.Dir,
-		TimeoutSecs:     flags.Timeout,
-		JobDir:          jobDir,
+		return flags.PermissionMode
 	}
+	return cfg.PermissionMode
 }
 
-// findClaude locates the claude binary in PATH.
-func findClaude() (string, error) {
-	path, err := filepath.Abs("claude")
-	if err == nil {
-		if _, statErr := os.Stat(path); statErr == nil {
-			return path, nil
-		}
-	}
+// checkWorkDirSafety refuses bypassPermissions jobs in dangerous working
+// directories unless --i-know-what-im-doing or allow_unsafe_paths is set.
+func checkWorkDirSafety(cfg *config.Config, flags *cmd.Flags) error {
+	return cmd.SafetyCheck(flags.Dir, permissionMode(cfg, flags), &cmd.SafetyOptions{
+		AllowUnsafePaths: flags.AllowUnsafePaths || cfg.AllowUnsafePaths,
+	})
+}
 
-	// Search PATH.
-	pathEnv := os.Getenv("PATH")
-	for _, dir := range filepath.SplitList(pathEnv) {
-		candidate := filepath.Join(dir, "claude")
-		if _, err := os.Stat(candidate); err == nil {
-			return candidate, nil
-		}
+// runSpec returns the golem.RunSpec of flags parsed for run or start, once
+// templates and file references are applied.
+func runSpec(flags *cmd.Flags) golem.RunSpec {
+	return golem.RunSpec{
+		Prompt:           flags.Prompt,
+		Dir:              flags.Dir,
+		Timeout:          time.Duration(flags.Timeout) * time.Second,
+		Model:            flags.Model,
+		OpusModel:        flags.OpusModel,
+		SonnetModel:      flags.SonnetModel,
+		HaikuModel:       flags.HaikuModel,
+		PermissionMode:   flags.PermissionMode,
+		BaseURL:          flags.BaseURL,
+		CaptureDiff:      flags.CaptureDiff,
+		StrictResult:     flags.StrictResult,
+		Confine:          flags.Confine,
+		Priority:         flags.Priority,
+		Notify:           flags.Notify,
+		Template:         flags.Template,
+		ContextFile:      flags.ContextFile,
+		AllowUnsafePaths: flags.AllowUnsafePaths,
+		AllowOverlap:     flags.AllowOverlap,
+		AllowNested:      flags.AllowNested,
+		StrictDisk:       flags.StrictDisk,
+		Keep:             flags.Keep,
 	}
-
-	return "", fmt.Errorf(`err:dependency "claude CLI not found in PATH"`)
 }
@@ -0,0 +1,1186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/exitcode"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// TestMain lets the test binary stand in for glm: launchWorker re-executes
+// os.Executable with "_worker", after any --profile and --config, which here
+// is the test binary itself, and tests start it as glm with GLM_TEST_MAIN=1.
+func TestMain(m *testing.M) {
+	if slices.Contains(os.Args[1:], "_worker") || os.Getenv("GLM_TEST_MAIN") == "1" {
+		os.Exit(run(os.Args[1:]))
+	}
+	logger = initLogger(false)
+	os.Exit(m.Run())
+}
+
+const testServeToken = "s3cret"
+
+// mockClaude answers every prompt with a fixed result; prompts mentioning
+// "slow" hang first in a child sleep, whose PID goes to sleep.pid in the
+// workdir, so they can be killed, and prompts mentioning "huge" fail as too
+// long for the context window.
+const mockClaude = `#!/bin/sh
+case "$*" in *slow*) sleep 30 & echo $! > sleep.pid; wait ;; esac
+case "$*" in *huge*) echo '{"is_error":true,"result":"Prompt is too long"}'; exit 1 ;; esac
+echo '{"result":"mock answer"}'
+`
+
+// newTestEnv sets up a HOME with an API key and serve_token and puts a mock
+// claude first on PATH. It returns the loaded config and a project directory
+// under HOME to run jobs in.
+func newTestEnv(t *testing.T) (*config.Config, string) {
+	t.Helper()
+	home := t.TempDir()
+	configDir := filepath.Join(home, ".config", "GoLeM")
+	bin := filepath.Join(home, "bin")
+	workdir := filepath.Join(home, "project")
+	for _, d := range []string{configDir, bin, workdir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(configDir, "zai_api_key"): "sk-test\n",
+		filepath.Join(configDir, "glm.toml"):    `serve_token = "` + testServeToken + `"` + "\n",
+		filepath.Join(bin, "claude"):            mockClaude,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GLM_SERVE_TOKEN", "")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, workdir
+}
+
+// newServeEnv serves serveOptions over newTestEnv.
+func newServeEnv(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	cfg, workdir := newTestEnv(t)
+	opts := serveOptions(cfg)
+	opts.PollInterval = 20 * time.Millisecond
+	srv := httptest.NewServer(cmd.NewServeHandler(opts))
+	t.Cleanup(srv.Close)
+	return srv, workdir
+}
+
+// do sends an authorized request with an optional JSON body and decodes the
+// response into v, returning the status code.
+func do(t *testing.T, srv *httptest.Server, method, path, token string, body, v any) int {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, srv.URL+path, r)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s %s: body %q is not JSON: %v", method, path, data, err)
+	}
+	return resp.StatusCode
+}
+
+// waitStatus polls GET /jobs/{id} until the job reaches want.
+func waitStatus(t *testing.T, srv *httptest.Server, id, want string) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		var st cmd.JobStatusJSON
+		do(t, srv, "GET", "/jobs/"+id, "", nil, &st)
+		if st.Status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %q, want %q", id, st.Status, want)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Scenario: An async POST /jobs returns 202, and the job can be polled to its result
+func TestServeSubmitPollResult(t *testing.T) {
+	srv, workdir := newServeEnv(t)
+
+	var st cmd.JobStatusJSON
+	req := cmd.SubmitRequest{Prompt: "say hi", Dir: workdir, Async: true}
+	if code := do(t, srv, "POST", "/jobs", testServeToken, req, &st); code != http.StatusAccepted || st.ID == "" {
+		t.Fatalf("POST /jobs = %d %+v, want 202 with a job ID", code, st)
+	}
+	waitStatus(t, srv, st.ID, "done")
+
+	var result cmd.JobResultJSON
+	if code := do(t, srv, "GET", "/jobs/"+st.ID+"/result", "", nil, &result); code != http.StatusOK || !strings.Contains(result.Stdout, "mock answer") {
+		t.Errorf("GET result = %d %+v", code, result)
+	}
+}
+
+// Scenario: A sync POST /jobs waits for the job and returns its result
+func TestServeSubmitSync(t *testing.T) {
+	srv, workdir := newServeEnv(t)
+
+	var result cmd.JobResultJSON
+	req := cmd.SubmitRequest{Prompt: "say hi", Dir: workdir, Timeout: 60}
+	if code := do(t, srv, "POST", "/jobs", testServeToken, req, &result); code != http.StatusOK || result.Status != "done" || !strings.Contains(result.Stdout, "mock answer") {
+		t.Errorf("POST /jobs = %d %+v, want 200 with the result", code, result)
+	}
+}
+
+// Scenario: Submissions need the token and follow glm start's validation and safety rules
+func TestServeSubmitRejected(t *testing.T) {
+	srv, workdir := newServeEnv(t)
+	home := filepath.Dir(workdir)
+
+	cases := []struct {
+		name  string
+		token string
+		req   cmd.SubmitRequest
+		want  int
+	}{
+		{"no token", "", cmd.SubmitRequest{Prompt: "x", Dir: workdir}, http.StatusUnauthorized},
+		{"wrong token", "nope", cmd.SubmitRequest{Prompt: "x", Dir: workdir}, http.StatusUnauthorized},
+		{"empty prompt", testServeToken, cmd.SubmitRequest{Dir: workdir}, http.StatusBadRequest},
+		{"relative dir", testServeToken, cmd.SubmitRequest{Prompt: "x", Dir: "project"}, http.StatusBadRequest},
+		{"home root", testServeToken, cmd.SubmitRequest{Prompt: "x", Dir: home}, http.StatusBadRequest},
+		{"bad mode", testServeToken, cmd.SubmitRequest{Prompt: "x", Dir: workdir, PermissionMode: "yolo"}, http.StatusBadRequest},
+		{"bad timeout", testServeToken, cmd.SubmitRequest{Prompt: "x", Dir: workdir, Timeout: -5}, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		var e map[string]string
+		if code := do(t, srv, "POST", "/jobs", tc.token, tc.req, &e); code != tc.want || !strings.HasPrefix(e["error"], "err:") {
+			t.Errorf("%s: POST /jobs = %d %v, want %d", tc.name, code, e, tc.want)
+		}
+	}
+
+	var jobs []cmd.JobListItem
+	if do(t, srv, "GET", "/jobs", "", nil, &jobs); len(jobs) != 0 {
+		t.Errorf("rejected submissions created jobs: %+v", jobs)
+	}
+}
+
+// Scenario: DELETE /jobs/{id} kills a running job
+func TestServeDeleteKillsJob(t *testing.T) {
+	srv, workdir := newServeEnv(t)
+
+	var st cmd.JobStatusJSON
+	req := cmd.SubmitRequest{Prompt: "be slow", Dir: workdir, Async: true}
+	if code := do(t, srv, "POST", "/jobs", testServeToken, req, &st); code != http.StatusAccepted {
+		t.Fatalf("POST /jobs = %d %+v", code, st)
+	}
+	waitStatus(t, srv, st.ID, "running")
+
+	var e map[string]string
+	if code := do(t, srv, "DELETE", "/jobs/"+st.ID, "", nil, &e); code != http.StatusUnauthorized {
+		t.Errorf("DELETE without token = %d %v, want 401", code, e)
+	}
+	var killed cmd.JobStatusJSON
+	if code := do(t, srv, "DELETE", "/jobs/"+st.ID, testServeToken, nil, &killed); code != http.StatusOK || killed.Status != "killed" {
+		t.Errorf("DELETE /jobs/%s = %d %+v, want 200 killed", st.ID, code, killed)
+	}
+}
+
+// Scenario: Over MCP, glm_run returns the result and glm_start's job reaches done in glm_status
+func TestMCPRunAndStatusRoundTrip(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	opts := cmd.MCPOptions{ServeOptions: serveOptions(cfg), Version: version}
+	opts.PollInterval = 20 * time.Millisecond
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		_ = cmd.MCPCmd(inR, outW, opts)
+		outW.Close()
+	}()
+	defer inW.Close()
+	out := bufio.NewScanner(outR)
+
+	// call sends tools/call and returns the tool's text output.
+	call := func(id int, tool string, args map[string]any) string {
+		t.Helper()
+		req, _ := json.Marshal(map[string]any{
+			"jsonrpc": "2.0", "id": id, "method": "tools/call",
+			"params": map[string]any{"name": tool, "arguments": args},
+		})
+		if _, err := inW.Write(append(req, '\n')); err != nil {
+			t.Fatal(err)
+		}
+		if !out.Scan() {
+			t.Fatalf("%s: no response", tool)
+		}
+		var resp struct {
+			Result struct {
+				Content []struct{ Text string } `json:"content"`
+				IsError bool                    `json:"isError"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &resp); err != nil || len(resp.Result.Content) != 1 || resp.Result.IsError {
+			t.Fatalf("%s: response %s", tool, out.Bytes())
+		}
+		return resp.Result.Content[0].Text
+	}
+
+	var result cmd.JobResultJSON
+	if err := json.Unmarshal([]byte(call(1, "glm_run", map[string]any{"prompt": "say hi", "dir": workdir})), &result); err != nil || result.Status != "done" || !strings.Contains(result.Stdout, "mock answer") {
+		t.Errorf("glm_run = %+v (%v)", result, err)
+	}
+
+	var st cmd.JobStatusJSON
+	if err := json.Unmarshal([]byte(call(2, "glm_start", map[string]any{"prompt": "say hi", "dir": workdir})), &st); err != nil || st.ID == "" {
+		t.Fatalf("glm_start = %+v (%v)", st, err)
+	}
+	deadline := time.Now().Add(15 * time.Second)
+	for id := 3; st.Status != "done"; id++ {
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %q, want done", st.ID, st.Status)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err := json.Unmarshal([]byte(call(id, "glm_status", map[string]any{"job_id": st.ID})), &st); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// processGone reports whether pid has exited (a zombie counts as exited).
+func processGone(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return true
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	// The state follows the parenthesised command name.
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// Scenario: Ctrl-C on glm run kills claude's process group and marks the job killed
+func TestRunInterruptKillsClaudeGroup(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+
+	var stderr bytes.Buffer
+	c := exec.Command(os.Args[0], "run", "--keep", "-d", workdir, "be slow")
+	c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+	c.Stderr = &stderr
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Process.Kill() })
+
+	// Wait for the mock's sleep to start.
+	pidFile := filepath.Join(workdir, "sleep.pid")
+	var sleepPID int
+	for deadline := time.Now().Add(10 * time.Second); sleepPID == 0; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("mock claude did not start; stderr:\n%s", stderr.String())
+		}
+		data, _ := os.ReadFile(pidFile)
+		sleepPID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	if err := c.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("glm run did not exit after SIGINT")
+	}
+
+	if code := c.ProcessState.ExitCode(); code != exitcode.Interrupted {
+		t.Errorf("exit code = %d, want %d; stderr:\n%s", code, exitcode.Interrupted, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "[GoLeM] Interrupted by user") {
+		t.Errorf("stderr lacks the interrupt line:\n%s", stderr.String())
+	}
+	if !processGone(sleepPID) {
+		t.Errorf("claude's child (PID %d) survived the interrupt", sleepPID)
+	}
+
+	jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+	if len(jobs) != 1 {
+		t.Fatalf("job dirs = %v, want the one kept job", jobs)
+	}
+	if got := job.ReadStatus(jobs[0]); got != job.StatusKilled {
+		t.Errorf("job status = %s, want killed", got)
+	}
+}
+
+// Scenario: glm kill on a started job ends claude and its children, not just the worker
+func TestKillStartedJobKillsClaude(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	glm := func(args ...string) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stdout, c.Stderr = &stdout, &stderr
+		_ = c.Run()
+		return strings.TrimSpace(stdout.String()), stderr.String()
+	}
+
+	id, stderr := glm("start", "be slow")
+	if id == "" {
+		t.Fatalf("start printed no job ID; stderr:\n%s", stderr)
+	}
+	dirs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", id))
+	if len(dirs) != 1 {
+		t.Fatalf("job %s not found", id)
+	}
+	// Wait for the mock's sleep, then for claude's PID in the manifest.
+	var sleepPID, claudePID int
+	for deadline := time.Now().Add(10 * time.Second); sleepPID == 0 || claudePID == 0; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("mock claude did not start (sleep %d, claude %d)", sleepPID, claudePID)
+		}
+		data, _ := os.ReadFile(filepath.Join(workdir, "sleep.pid"))
+		sleepPID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		claudePID = job.LoadManifest(dirs[0]).ClaudePID
+	}
+	t.Cleanup(func() { _ = syscall.Kill(-claudePID, syscall.SIGKILL) })
+
+	if _, stderr := glm("kill", id); stderr != "" {
+		t.Errorf("kill stderr:\n%s", stderr)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !processGone(claudePID) || !processGone(sleepPID); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("after kill claude (PID %d) gone: %v, its child (PID %d) gone: %v",
+				claudePID, processGone(claudePID), sleepPID, processGone(sleepPID))
+		}
+	}
+	if got := job.ReadStatus(dirs[0]); got != job.StatusKilled {
+		t.Errorf("job status = %s, want killed", got)
+	}
+}
+
+// Scenario: glm kill ends claude's children through its process group after the worker died
+func TestKillOrphanedClaudeKillsItsGroup(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	glm := func(args ...string) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stdout, c.Stderr = &stdout, &stderr
+		_ = c.Run()
+		return strings.TrimSpace(stdout.String()), stderr.String()
+	}
+
+	id, stderr := glm("start", "be slow")
+	if id == "" {
+		t.Fatalf("start printed no job ID; stderr:\n%s", stderr)
+	}
+	dirs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", id))
+	if len(dirs) != 1 {
+		t.Fatalf("job %s not found", id)
+	}
+	var sleepPID, claudePID int
+	for deadline := time.Now().Add(10 * time.Second); sleepPID == 0 || claudePID == 0; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("mock claude did not start (sleep %d, claude %d)", sleepPID, claudePID)
+		}
+		data, _ := os.ReadFile(filepath.Join(workdir, "sleep.pid"))
+		sleepPID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		claudePID = job.LoadManifest(dirs[0]).ClaudePID
+	}
+	t.Cleanup(func() { _ = syscall.Kill(-claudePID, syscall.SIGKILL) })
+
+	// The worker dies without a chance to stop claude, which runs on.
+	worker := job.LoadManifest(dirs[0]).PID
+	if err := syscall.Kill(worker, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !processGone(worker); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("worker (PID %d) survived SIGKILL", worker)
+		}
+	}
+
+	if _, stderr := glm("kill", id); stderr != "" {
+		t.Errorf("kill stderr:\n%s", stderr)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !processGone(claudePID) || !processGone(sleepPID); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("after kill claude (PID %d) gone: %v, its child (PID %d) gone: %v",
+				claudePID, processGone(claudePID), sleepPID, processGone(sleepPID))
+		}
+	}
+}
+
+// Scenario: glm run --strict-result fails a job whose result matches a failure marker
+func TestRunStrictResultFailsOnMarker(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+
+	run := func() (int, string, string) {
+		t.Helper()
+		var stderr bytes.Buffer
+		c := exec.Command(os.Args[0], "run", "--keep", "--strict-result", "-d", workdir, "answer")
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stderr = &stderr
+		_ = c.Run()
+		jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+		if len(jobs) == 0 {
+			t.Fatalf("no job dir; stderr:\n%s", stderr.String())
+		}
+		status := job.ReadStatus(jobs[len(jobs)-1])
+		for _, dir := range jobs {
+			_ = os.RemoveAll(dir)
+		}
+		return c.ProcessState.ExitCode(), string(status), stderr.String()
+	}
+
+	// "mock answer" matches none of the default markers.
+	if code, status, stderr := run(); code != 0 || status != "done" {
+		t.Errorf("default markers: exit %d, status %s; stderr:\n%s", code, status, stderr)
+	}
+
+	toml := filepath.Join(cfg.ConfigDir, "glm.toml")
+	if err := os.WriteFile(toml, []byte(`result_failure_markers = ["mock answer"]`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, status, stderr := run()
+	if code != 1 || status != "failed" || !strings.Contains(stderr, `[GoLeM] Result matched failure marker "mock answer"`) {
+		t.Errorf("custom marker: exit %d, status %s; stderr:\n%s", code, status, stderr)
+	}
+}
+
+// Scenario: glm run of a prompt too long for the context window ends context_exceeded and exits 65
+func TestRunContextExceeded(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+
+	var stderr bytes.Buffer
+	c := exec.Command(os.Args[0], "run", "--keep", "-d", workdir, "huge task")
+	c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+	c.Stderr = &stderr
+	_ = c.Run()
+	if code := c.ProcessState.ExitCode(); code != 65 || !strings.Contains(stderr.String(), "err:context_exceeded") {
+		t.Errorf("exit %d, want 65 with err:context_exceeded; stderr:\n%s", code, stderr.String())
+	}
+	jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+	if len(jobs) != 1 || job.ReadStatus(jobs[0]) != job.StatusContextExceeded {
+		t.Errorf("jobs %v, want one context_exceeded job", jobs)
+	}
+}
+
+// Scenario: glm run inside a glm job (GLM_DEPTH=1) is refused with err:user, and runs at depth 2 with --allow-nested
+func TestRunRefusesNestedJob(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+
+	run := func(args ...string) (int, string) {
+		t.Helper()
+		var stderr bytes.Buffer
+		c := exec.Command(os.Args[0], append([]string{"run", "--keep", "-d", workdir}, args...)...)
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1", "GLM_DEPTH=1")
+		c.Stderr = &stderr
+		_ = c.Run()
+		return c.ProcessState.ExitCode(), stderr.String()
+	}
+
+	if code, stderr := run("answer"); code != 1 || !strings.Contains(stderr, "err:user") || !strings.Contains(stderr, "--allow-nested") {
+		t.Errorf("nested run: exit %d, want 1 with err:user; stderr:\n%s", code, stderr)
+	}
+	if jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*")); len(jobs) != 0 {
+		t.Errorf("refused run left jobs %v", jobs)
+	}
+
+	if code, stderr := run("--allow-nested", "answer"); code != 0 {
+		t.Fatalf("run --allow-nested: exit %d; stderr:\n%s", code, stderr)
+	}
+	jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+	if len(jobs) != 1 {
+		t.Fatalf("jobs %v, want one", jobs)
+	}
+	if m := job.LoadManifest(jobs[0]); m.Depth != 2 {
+		t.Errorf("manifest depth = %d, want 2", m.Depth)
+	}
+}
+
+// Scenario: --quiet anywhere on the command line keeps run's result and drops its summary line
+func TestRunQuietDropsSummary(t *testing.T) {
+	_, workdir := newTestEnv(t)
+
+	run := func(args ...string) (string, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], append([]string{"run", "--summary", "-d", workdir}, args...)...)
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stdout, c.Stderr = &stdout, &stderr
+		if err := c.Run(); err != nil {
+			t.Fatalf("glm run: %v; stderr:\n%s", err, stderr.String())
+		}
+		return stdout.String(), stderr.String()
+	}
+
+	if _, stderr := run("answer"); !strings.Contains(stderr, "glm: job=") {
+		t.Errorf("run --summary stderr = %q, want the summary line", stderr)
+	}
+	if stdout, stderr := run("--quiet", "answer"); stdout != "mock answer" || stderr != "" {
+		t.Errorf("run --quiet: stdout %q, stderr %q; want the result alone", stdout, stderr)
+	}
+}
+
+// Scenario: run --max-output cuts the printed result, keeps the job while it is cut and exits as usual
+func TestRunMaxOutput(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+
+	run := func(limit string) (string, string, []string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], "run", "--quiet", "--max-output", limit, "-d", workdir, "answer")
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stdout, c.Stderr = &stdout, &stderr
+		if err := c.Run(); err != nil {
+			t.Fatalf("glm run --max-output %s: %v; stderr:\n%s", limit, err, stderr.String())
+		}
+		jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+		return stdout.String(), stderr.String(), jobs
+	}
+
+	stdout, stderr, jobs := run("11")
+	if stdout != "mock answer" || stderr != "" || len(jobs) != 0 {
+		t.Errorf("output within the limit: stdout %q, stderr %q, %d jobs left; want the result and no job", stdout, stderr, len(jobs))
+	}
+
+	stdout, stderr, jobs = run("4")
+	if stdout != "mock" || len(jobs) != 1 {
+		t.Fatalf("cut output: stdout %q, %d jobs left; want %q and the kept job", stdout, len(jobs), "mock")
+	}
+	full := filepath.Join(jobs[0], "stdout.txt")
+	if want := "…[truncated, 11 bytes total — full output in " + full + "]\n"; stderr != want {
+		t.Errorf("stderr = %q, want %q", stderr, want)
+	}
+	if data, _ := os.ReadFile(full); string(data) != "mock answer" {
+		t.Errorf("stdout.txt = %q, want the full result", data)
+	}
+}
+
+// Scenario: without --keep a plan job outlives run and result until --approve carries it out
+func TestPlanApproveWithoutKeep(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+
+	glm := func(args ...string) {
+		t.Helper()
+		var stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stderr = &stderr
+		if err := c.Run(); err != nil {
+			t.Fatalf("glm %s: %v; stderr:\n%s", strings.Join(args, " "), err, stderr.String())
+		}
+	}
+	jobs := func() []string {
+		jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+		return jobs
+	}
+
+	glm("run", "--mode", "plan", "-d", workdir, "plan the change")
+	left := jobs()
+	if len(left) != 1 {
+		t.Fatalf("after run --mode plan: %d jobs left, want the plan job", len(left))
+	}
+	id := filepath.Base(left[0])
+
+	glm("result", id)
+	if len(jobs()) != 1 {
+		t.Fatalf("glm result deleted the plan job before it was approved")
+	}
+
+	glm("result", "--approve", id)
+	if left := jobs(); len(left) != 0 {
+		t.Errorf("after --approve: jobs left %v, want the plan and its run deleted", left)
+	}
+}
+
+// Scenario: --no-color and NO_COLOR turn color off and are stripped from the arguments
+func TestOutputPolicy(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	args, o, noColor := outputPolicy([]string{"--quiet", "list", "--no-color", "--utc"})
+	if strings.Join(args, " ") != "list --utc" || !o.Quiet || o.Color || !noColor {
+		t.Errorf("outputPolicy = %q, %+v, %v", args, o, noColor)
+	}
+
+	args, o, noColor = outputPolicy([]string{"list"})
+	if len(args) != 1 || o.Quiet || noColor {
+		t.Errorf("outputPolicy without flags = %q, %+v, %v", args, o, noColor)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if _, o, noColor = outputPolicy([]string{"list"}); o.Color || !noColor {
+		t.Errorf("outputPolicy with NO_COLOR = %+v, %v", o, noColor)
+	}
+}
+
+// Scenario: flags after "--" belong to the prompt and are neither detected nor stripped
+func TestFlagHelpersStopAtDoubleDash(t *testing.T) {
+	args := []string{"--json", "-t", "60", "--", "explain", "--json", "--summary", "-t", "5"}
+	if hasFlag(args, "--summary") {
+		t.Error("hasFlag found --summary after --")
+	}
+	if got := strings.Join(stripFlag(args, "--json"), " "); got != "-t 60 -- explain --json --summary -t 5" {
+		t.Errorf("stripFlag = %q", got)
+	}
+	if v, rest := getFlagValue(args, "-t"); v != "60" || strings.Join(rest, " ") != "--json -- explain --json --summary -t 5" {
+		t.Errorf("getFlagValue = %q, %q", v, rest)
+	}
+	if v, _ := getFlagValue([]string{"--", "-t", "5"}, "-t"); v != "" {
+		t.Errorf("getFlagValue after -- = %q, want none", v)
+	}
+}
+
+// Scenario: a job run under a custom subagent dir is found there by list and status
+func TestCustomSubagentDir(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	if err := os.MkdirAll(filepath.Join(workdir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	glm := func(env []string, args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(append(os.Environ(), "GLM_TEST_MAIN=1"), env...)
+		c.Stdout, c.Stderr = &stdout, &stderr
+		if err := c.Run(); err != nil {
+			t.Fatalf("glm %s: %v; stderr:\n%s", strings.Join(args, " "), err, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	// A relative GLM_SUBAGENT_DIR is inside the project.
+	env := []string{"GLM_SUBAGENT_DIR=.glm/jobs"}
+	glm(env, "run", "--keep", "answer")
+	jobs, _ := filepath.Glob(filepath.Join(workdir, ".glm", "jobs", "*", "job-*"))
+	if len(jobs) != 1 {
+		t.Fatalf("found %d jobs under .glm/jobs, want 1", len(jobs))
+	}
+	if home, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*")); len(home) != 0 {
+		t.Errorf("%d jobs under the default dir, want none", len(home))
+	}
+	jobID := filepath.Base(jobs[0])
+	if out := glm(env, "list"); !strings.Contains(out, jobID) {
+		t.Errorf("list = %q, want %s", out, jobID)
+	}
+	if out := glm(env, "status", "--json", jobID); !strings.Contains(out, `"status": "done"`) {
+		t.Errorf("status = %q, want done", out)
+	}
+
+	// --subagent-dir wins over GLM_SUBAGENT_DIR, and the other root is empty.
+	flagDir := filepath.Join(t.TempDir(), "jobs")
+	if out := glm(env, "--subagent-dir", flagDir, "list", "--json"); strings.Contains(out, jobID) {
+		t.Errorf("list under --subagent-dir = %q, want no %s", out, jobID)
+	}
+	if _, err := os.Stat(flagDir); err != nil {
+		t.Errorf("--subagent-dir not created: %v", err)
+	}
+}
+
+// Scenario: the notify hook sees the job's GLM_* variables for start, start falls back to on_complete_cmd, and run needs --notify
+func TestNotifyHook(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	out := t.TempDir()
+	hook := filepath.Join(out, "hook.sh")
+	script := "#!/bin/sh\necho hook ran\nenv | grep -E '^GLM_(JOB_ID|STATUS|EXIT_CODE|JOB_DIR|DURATION)=' | sort > \"$1\"\n"
+	if err := os.WriteFile(hook, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	glm := func(env []string, args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(append(os.Environ(), "GLM_TEST_MAIN=1"), env...)
+		c.Stdout, c.Stderr = &stdout, &stderr
+		if err := c.Run(); err != nil {
+			t.Fatalf("glm %s: %v; stderr:\n%s", strings.Join(args, " "), err, stderr.String())
+		}
+		return strings.TrimSpace(stdout.String())
+	}
+	// waitFile waits for the hook to write path and returns its lines.
+	waitFile := func(path string) []string {
+		t.Helper()
+		deadline := time.Now().Add(15 * time.Second)
+		for {
+			if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+				return strings.Split(strings.TrimSpace(string(data)), "\n")
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("hook did not write %s", path)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	jobID := glm(nil, "start", "--notify", hook+" "+filepath.Join(out, "start.env"), "answer")
+	jobDir, err := job.FindJobDir(cfg.SubagentDir, "", jobID)
+	if err != nil {
+		t.Fatalf("start printed %q: %v", jobID, err)
+	}
+	env := waitFile(filepath.Join(out, "start.env"))
+	want := []string{"GLM_DURATION=", "GLM_EXIT_CODE=0", "GLM_JOB_DIR=" + jobDir, "GLM_JOB_ID=" + jobID, "GLM_STATUS=done"}
+	if len(env) != len(want) {
+		t.Fatalf("hook env = %q, want %q", env, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(env[i], want[i]) {
+			t.Errorf("hook env[%d] = %q, want %q", i, env[i], want[i])
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(jobDir, cmd.NotifyLogFile))
+		if strings.Contains(string(data), "hook ran\n[GoLeM] notify hook exited 0") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("notify.log = %q", data)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if st := job.ReadStatus(jobDir); st != job.StatusDone {
+		t.Errorf("status after the hook = %s, want done", st)
+	}
+
+	// on_complete_cmd applies to start but not to run.
+	onComplete := []string{"GLM_ON_COMPLETE_CMD=" + hook + " " + filepath.Join(out, "config.env")}
+	glm(onComplete, "run", "answer")
+	if _, err := os.Stat(filepath.Join(out, "config.env")); err == nil {
+		t.Error("on_complete_cmd ran for glm run without --notify")
+	}
+	glm(onComplete, "start", "answer")
+	waitFile(filepath.Join(out, "config.env"))
+
+	glm(nil, "run", "--notify", hook+" "+filepath.Join(out, "run.env"), "answer")
+	if env := waitFile(filepath.Join(out, "run.env")); !strings.Contains(strings.Join(env, " "), "GLM_STATUS=done") {
+		t.Errorf("run hook env = %q", env)
+	}
+}
+
+// Scenario: with metrics_enabled, run, start and each chain step append one anonymized line to metrics.jsonl, and glm metrics summary counts them
+func TestMetricsAccumulate(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	metrics := cmd.MetricsPath(cfg.ConfigDir)
+
+	glm := func(args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1", "GLM_METRICS_ENABLED=true")
+		c.Stdout, c.Stderr = &stdout, &stderr
+		if err := c.Run(); err != nil {
+			t.Fatalf("glm %s: %v; stderr:\n%s", strings.Join(args, " "), err, stderr.String())
+		}
+		return stdout.String()
+	}
+	// waitLines waits until metrics.jsonl has n lines.
+	waitLines := func(n int) []cmd.MetricsEntry {
+		t.Helper()
+		deadline := time.Now().Add(15 * time.Second)
+		for {
+			entries, err := cmd.ReadMetrics(metrics, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) >= n {
+				return entries
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("metrics.jsonl has %d lines, want %d", len(entries), n)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	glm("run", "secret prompt")
+	entries := waitLines(1)
+	glm("start", "secret prompt")
+	waitLines(2)
+	glm("chain", "one", "two")
+	entries = waitLines(4)
+	if len(entries) != 4 {
+		t.Fatalf("metrics.jsonl has %d lines, want 4", len(entries))
+	}
+	for _, e := range entries {
+		if e.Status != "done" || e.ExitCode == nil || *e.ExitCode != 0 || e.Job == "" || e.Project != entries[0].Project {
+			t.Errorf("entry = %+v", e)
+		}
+	}
+	data, _ := os.ReadFile(metrics)
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), workdir) || strings.Contains(string(data), "job-") {
+		t.Errorf("metrics.jsonl leaks a prompt, path or ID:\n%s", data)
+	}
+
+	var s cmd.MetricsSummary
+	if err := json.Unmarshal([]byte(glm("metrics", "summary", "--since", "1d", "--json")), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Jobs != 4 || s.Statuses["done"] != 4 || s.FailureRate != 0 {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+// Scenario: glm run -d with ".", a relative path, the absolute path and a symlink to the same directory files every job under one project and records the canonical workdir
+func TestRunCanonicalWorkDir(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	workdir, err := filepath.EvalSymlinks(workdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(filepath.Dir(workdir), "project-link")
+	if err := os.Symlink(workdir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{".", "../project", workdir, link} {
+		c := exec.Command(os.Args[0], "run", "--keep", "-d", dir, "answer")
+		c.Dir = workdir
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("glm run -d %s: %v\n%s", dir, err, out)
+		}
+	}
+
+	projects, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "project-*"))
+	if len(projects) != 1 || filepath.Base(projects[0]) != job.ResolveProjectID(workdir) {
+		t.Fatalf("project dirs = %v, want only %s", projects, job.ResolveProjectID(workdir))
+	}
+	jobs, _ := filepath.Glob(filepath.Join(projects[0], "job-*"))
+	if len(jobs) != 4 {
+		t.Fatalf("got %d jobs, want 4", len(jobs))
+	}
+	for _, dir := range jobs {
+		m := job.LoadManifest(dir)
+		got, _ := os.ReadFile(filepath.Join(dir, "workdir.txt"))
+		if m.WorkDir != workdir || string(got) != workdir || m.ProjectID != job.ResolveProjectID(workdir) {
+			t.Errorf("%s: manifest workdir %q, workdir.txt %q, project %q; want %q", filepath.Base(dir), m.WorkDir, got, m.ProjectID, workdir)
+		}
+	}
+}
+
+// Scenario: --dry-run of run, start and chain validates, prints the claude argv run would execute, masks the API key and creates no job; a missing workdir still fails
+func TestDryRun(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	workdir, err := filepath.EvalSymlinks(workdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(os.Getenv("HOME"), "bin", "claude")
+	// The claude run writes its arguments, one per line, to args.txt.
+	recorder := "#!/bin/sh\nprintf '%s\\n' \"$@\" > args.txt\necho '{\"result\":\"ok\"}'\n"
+	if err = os.WriteFile(bin, []byte(recorder), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	glm := func(args ...string) (string, int) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stdout, c.Stderr = &stdout, &stderr
+		_ = c.Run()
+		return stdout.String() + stderr.String(), c.ProcessState.ExitCode()
+	}
+	flags := []string{"-d", workdir, "-m", "glm-x", "--mode", "acceptEdits", "-t", "42"}
+
+	out, code := glm(append([]string{"run", "--dry-run", "--json"}, append(flags, "fix the bug")...)...)
+	var d cmd.DryRun
+	if err := json.Unmarshal([]byte(out), &d); err != nil || code != 0 {
+		t.Fatalf("run --dry-run --json exited %d: %v\n%s", code, err, out)
+	}
+	if projects, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "project-*")); len(projects) != 0 {
+		t.Errorf("dry run created %v", projects)
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "args.txt")); !os.IsNotExist(err) {
+		t.Errorf("dry run ran claude: %v", err)
+	}
+	if d.Argv[0] != bin || d.WorkDir != workdir || d.Models.Exec != "glm-x" || d.PermissionMode != "acceptEdits" || d.TimeoutSecs != 42 {
+		t.Errorf("dry run = %+v", d)
+	}
+	if !slices.Contains(d.Env, "ANTHROPIC_AUTH_TOKEN=***") || !slices.Contains(d.Env, "ANTHROPIC_DEFAULT_SONNET_MODEL=glm-x") || strings.Contains(out, "sk-test") {
+		t.Errorf("env = %v, want the API key masked", d.Env)
+	}
+
+	if out, code := glm(append([]string{"run"}, append(flags, "fix the bug")...)...); code != 0 {
+		t.Fatalf("glm run exited %d\n%s", code, out)
+	}
+	data, err := os.ReadFile(filepath.Join(workdir, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); !slices.Equal(got, d.Argv[1:]) {
+		t.Errorf("claude ran with %q, dry run showed %q", got, d.Argv[1:])
+	}
+
+	out, code = glm(append([]string{"start", "--dry-run"}, append(flags, "fix the bug")...)...)
+	if code != 0 || !strings.Contains(out, "argv:        "+bin+" -p --no-session-persistence --model glm-x") || !strings.Contains(out, "timeout:     42s") {
+		t.Errorf("start --dry-run exited %d:\n%s", code, out)
+	}
+	if projects, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "project-*", "job-*")); len(projects) != 0 {
+		t.Errorf("start --dry-run created %v", projects)
+	}
+
+	out, code = glm("chain", "--dry-run", "--json", "--inject", "both", "-d", workdir, "plan:one", "two")
+	var chain cmd.ChainDryRun
+	if err := json.Unmarshal([]byte(out), &chain); err != nil || code != 0 {
+		t.Fatalf("chain --dry-run --json exited %d: %v\n%s", code, err, out)
+	}
+	if len(chain.Steps) != 2 || chain.Steps[0].Name != "plan" || chain.Steps[0].Argv[len(chain.Steps[0].Argv)-1] != "one" {
+		t.Fatalf("chain dry run = %+v", chain.Steps)
+	}
+	want := cmd.BuildChainPromptFor(cmd.InjectBoth, "<stdout of step 1>", "<changelog of step 1>", "two")
+	if got := chain.Steps[1].Argv[len(chain.Steps[1].Argv)-1]; got != want {
+		t.Errorf("step 2 prompt = %q, want %q", got, want)
+	}
+
+	if out, code := glm("run", "--dry-run", "-d", filepath.Join(workdir, "missing"), "fix"); code != 1 || !strings.Contains(out, "err:user") {
+		t.Errorf("run --dry-run in a missing dir exited %d:\n%s", code, out)
+	}
+}
+
+// Scenario: jobs of run, start and chain record the glm version, command line, config sources and host in job.json; result --json and status --verbose report the version; redact_prompts hides the prompts
+func TestInvocationRecorded(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	glm := func(env []string, args ...string) string {
+		t.Helper()
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(append(os.Environ(), "GLM_TEST_MAIN=1"), env...)
+		out, err := c.Output()
+		if err != nil {
+			t.Fatalf("glm %s: %v", strings.Join(args, " "), err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	manifest := func(id string) *job.Manifest {
+		t.Helper()
+		dirs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", id))
+		if len(dirs) != 1 {
+			t.Fatalf("job %s not found", id)
+		}
+		return job.LoadManifest(dirs[0])
+	}
+
+	id := glm(nil, "start", "secret", "plan")
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if status := glm(nil, "status", id); status == "done" {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("job still %s", status)
+		}
+	}
+	inv := manifest(id).Invocation
+	host, _ := os.Hostname()
+	if inv == nil || inv.GLMVersion != version || !slices.Equal(inv.Args, []string{os.Args[0], "start", "secret", "plan"}) || inv.Hostname != host ||
+		inv.ConfigSources["api_key"] == "" || inv.ConfigSources["sonnet_model"] != "default" {
+		t.Fatalf("invocation = %+v", inv)
+	}
+	if out := glm(nil, "status", "--verbose", id); !strings.Contains(out, "glm_version: "+version) {
+		t.Errorf("status --verbose:\n%s", out)
+	}
+	var res cmd.JobResultJSON
+	if err := json.Unmarshal([]byte(glm(nil, "result", "--json", id)), &res); err != nil || res.GLMVersion != version {
+		t.Errorf("result --json glm_version = %q, %v", res.GLMVersion, err)
+	}
+
+	redact := []string{"GLM_REDACT_PROMPTS=true"}
+	glm(redact, "run", "--keep", "--prompt", "secret plan")
+	glm(redact, "chain", "secret one", "secret two")
+	jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+	if len(jobs) != 4 {
+		t.Fatalf("got %d jobs, want 4", len(jobs))
+	}
+	for _, dir := range jobs {
+		if filepath.Base(dir) == id {
+			continue
+		}
+		inv := job.LoadManifest(dir).Invocation
+		if inv == nil || inv.GLMVersion != version || strings.Contains(strings.Join(inv.Args, " "), "secret") || !strings.Contains(strings.Join(inv.Args, " "), "<prompt sha256:") {
+			t.Errorf("%s: invocation = %+v, want the prompts redacted", filepath.Base(dir), inv)
+		}
+	}
+}
+
+// Scenario: --config reads an alternate glm.toml for one invocation: its model reaches run and start jobs and config show, env variables still override it, the API key still comes from the config dir, and an unreadable file is err:config
+func TestConfigFlag(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	alt := filepath.Join(t.TempDir(), "alt.toml")
+	if err := os.WriteFile(alt, []byte("model = \"glm-alt\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	glm := func(env []string, args ...string) (string, string, int) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(append(os.Environ(), "GLM_TEST_MAIN=1"), env...)
+		c.Stdout, c.Stderr = &stdout, &stderr
+		err := c.Run()
+		code := 0
+		if ee, ok := err.(*exec.ExitError); ok {
+			code = ee.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(stdout.String()), stderr.String(), code
+	}
+	sonnet := func(id string) string {
+		t.Helper()
+		dirs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", id))
+		if len(dirs) != 1 {
+			t.Fatalf("job %s not found", id)
+		}
+		return job.LoadManifest(dirs[0]).Models.Sonnet
+	}
+
+	if out, stderr, code := glm(nil, "--config", alt, "run", "--keep", "--json", "answer"); code != 0 {
+		t.Fatalf("run exit %d: %s", code, stderr)
+	} else {
+		var res cmd.JobResultJSON
+		if err := json.Unmarshal([]byte(out), &res); err != nil {
+			t.Fatal(err)
+		}
+		if got := sonnet(res.ID); got != "glm-alt" {
+			t.Errorf("run with --config used sonnet %q, want glm-alt", got)
+		}
+	}
+
+	id, stderr, code := glm(nil, "start", "--config", alt, "answer")
+	if code != 0 {
+		t.Fatalf("start exit %d: %s", code, stderr)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if status, _, _ := glm(nil, "status", id); status == "done" {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("job still %s", status)
+		}
+	}
+	if got := sonnet(id); got != "glm-alt" {
+		t.Errorf("start with --config used sonnet %q, want glm-alt", got)
+	}
+
+	out, _, _ := glm([]string{"GLM_SONNET_MODEL=glm-env"}, "--config", alt, "config", "show")
+	if !regexp.MustCompile(`(?m)^model\s+glm-alt\s+\(config\)$`).MatchString(out) ||
+		!regexp.MustCompile(`(?m)^sonnet_model\s+glm-env\s+\(env\)$`).MatchString(out) ||
+		!strings.Contains(out, "config_file          "+alt) {
+		t.Errorf("config show with --config:\n%s", out)
+	}
+	if out, _, _ := glm(nil, "config", "show"); strings.Contains(out, "glm-alt") {
+		t.Errorf("config show without --config:\n%s", out)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+	for _, args := range [][]string{{"run", "answer"}, {"config", "show"}, {"session", "--dry-run"}} {
+		_, stderr, code := glm(nil, append([]string{"--config", missing}, args...)...)
+		if code != 1 || !strings.Contains(stderr, `err:config "Cannot read --config file:`) {
+			t.Errorf("%v with a missing --config = exit %d, stderr %q", args, code, stderr)
+		}
+	}
+}
+
+// Scenario: run --context points the prompt at a copy in the job dir, which goes with the job dir; start and chain reject --context
+func TestRunContextFile(t *testing.T) {
+	cfg, workdir := newTestEnv(t)
+	notes := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(notes, []byte("use the v2 API\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	glm := func(args ...string) (string, string, int) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		c := exec.Command(os.Args[0], args...)
+		c.Dir = workdir
+		c.Env = append(os.Environ(), "GLM_TEST_MAIN=1")
+		c.Stdout, c.Stderr = &stdout, &stderr
+		err := c.Run()
+		code := 0
+		if ee, ok := err.(*exec.ExitError); ok {
+			code = ee.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(stdout.String()), stderr.String(), code
+	}
+
+	if _, stderr, code := glm("run", "--keep", "--context", notes, "port the client"); code != 0 {
+		t.Fatalf("run --context exit %d: %s", code, stderr)
+	}
+	jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*"))
+	if len(jobs) != 1 {
+		t.Fatalf("got %d jobs, want 1", len(jobs))
+	}
+	copied := filepath.Join(jobs[0], cmd.ContextDir, "notes.md")
+	if got, _ := os.ReadFile(copied); string(got) != "use the v2 API\n" {
+		t.Errorf("context copy = %q", got)
+	}
+	prompt, _ := os.ReadFile(filepath.Join(jobs[0], "prompt.txt"))
+	if want := cmd.BuildContextFilePrompt("", []string{copied}, "port the client"); string(prompt) != want {
+		t.Errorf("prompt.txt = %q, want %q", prompt, want)
+	}
+
+	// Without --keep the copy is deleted with the job; the original stays.
+	if _, stderr, code := glm("run", "--context", notes, "port the client"); code != 0 {
+		t.Fatalf("run --context exit %d: %s", code, stderr)
+	}
+	if jobs, _ := filepath.Glob(filepath.Join(cfg.SubagentDir, "*", "job-*")); len(jobs) != 1 {
+		t.Errorf("got %d jobs, want the kept one only", len(jobs))
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("original context file: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"run", "--context", filepath.Join(workdir, "missing.md"), "x"},
+		{"start", "--context", notes, "x"},
+		{"chain", "--context", notes, "a", "b"},
+	} {
+		if _, stderr, code := glm(args...); code != 1 || !strings.Contains(stderr, "err:user") {
+			t.Errorf("glm %s = exit %d, stderr %q; want err:user", strings.Join(args, " "), code, stderr)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package claude
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// BinaryName is the executable looked up in PATH when no claude_path is
+// configured.
+const BinaryName = "claude"
+
+// FindBinary resolves the claude CLI used by run, session, and doctor.
+// override is the claude_path config value (or GLM_CLAUDE_PATH); when empty
+// the binary is looked up in PATH.
+func FindBinary(override string) (string, error) {
+	return LookupBinary(BinaryName, override)
+}
+
+// LookupBinary resolves name the way FindBinary resolves "claude".
+//
+// A non-empty override must be an absolute path to an executable regular
+// file. Otherwise name is searched with exec.LookPath semantics: a file in the
+// current directory is never picked up implicitly, and PATH entries that would
+// resolve relative to the current directory are rejected. The result is always
+// an executable regular file, never a directory.
+func LookupBinary(name, override string) (string, error) {
+	if override != "" {
+		if !filepath.IsAbs(override) {
+			return "", errs.Dependency(`"claude_path must be an absolute path: %s"`, override)
+		}
+		if !isExecutableFile(override) {
+			return "", errs.Dependency(`"claude_path is not an executable file: %s"`, override)
+		}
+		return override, nil
+	}
+
+	path, err := exec.LookPath(name)
+	if errors.Is(err, exec.ErrDot) {
+		return "", errs.Dependency(`"%s in PATH resolves relative to the current directory; set claude_path to an absolute path"`, name)
+	}
+	if err != nil || !isExecutableFile(path) {
+		return "", errs.Dependency(`"claude CLI not found in PATH"`)
+	}
+	return path, nil
+}
+
+// isExecutableFile reports whether path is a regular file with an execute bit.
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0
+}
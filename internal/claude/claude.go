@@ -3,15 +3,56 @@
 package claude
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/events"
+	"github.com/veschin/GoLeM/internal/exitcode"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/log"
+	"github.com/veschin/GoLeM/internal/slot"
 )
 
+// DepthEnv is the environment variable that carries the nesting depth of a
+// glm job to its claude process, so a glm started from inside that job sees
+// it is nested.
+const DepthEnv = "GLM_DEPTH"
+
+// NestingDepth returns the depth of the glm job this process runs inside,
+// from DepthEnv: 0 outside any job, or when the value is not a non-negative
+// integer.
+func NestingDepth() int {
+	n, err := strconv.Atoi(os.Getenv(DepthEnv))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// WarnOutput receives the warnings of this package, about an outdated claude
+// or a raw.json that does not parse; nil writes them to os.Stderr.
+var WarnOutput io.Writer
+
+// warnf writes a warning to WarnOutput.
+func warnf(format string, args ...any) {
+	w := WarnOutput
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
 // Config holds the parameters needed to invoke the Claude CLI.
 type Config struct {
 	// ZAI credentials / model routing.
@@ -22,6 +63,9 @@ type Config struct {
 	SonnetModel     string
 	HaikuModel      string
 
+	// ClaudePath pins the claude binary (claude_path); empty searches PATH.
+	ClaudePath string
+
 	// Execution parameters.
 	PermissionMode string
 	Model          string
@@ -30,18 +74,82 @@ type Config struct {
 	WorkDir        string
 	TimeoutSecs    int
 	JobDir         string
+	// CaptureDiff saves the workdir's git diff to the job dir after the run;
+	// DiffMaxBytes caps it (0 = config.DefaultDiffMaxBytes).
+	CaptureDiff  bool
+	DiffMaxBytes int
+	// StrictResult asks the caller to fail a job whose result matches a
+	// failure marker (see MatchFailureMarker); it is recorded in job.json
+	// so a queued job keeps it.
+	StrictResult bool
+	// Confine is the confine_mode of a job confined to its WorkDir, empty
+	// for one that is not; the caller checks the changelog against it (see
+	// ApplyConfinement in package cmd). It is recorded in job.json.
+	Confine string
+	// Priority orders the job for a free slot while it is queued; it is
+	// recorded in job.json.
+	Priority job.Priority
+	// Notify is the --notify hook of a queued job; QueueJob records it in
+	// job.json and Execute ignores it.
+	Notify string
+	// Template is the --template the prompt was rendered from; it is
+	// recorded in job.json.
+	Template string
+	// Depth is the nesting depth of the job, passed to claude as DepthEnv
+	// and recorded in job.json; 0 makes Execute use NestingDepth()+1.
+	Depth int
+	// Invocation is the glm command creating the job; it is recorded in
+	// job.json unless the job has one already (nil = none).
+	Invocation *job.Invocation
+	// Interactive is set for glm session, whose claude draws its UI on the
+	// terminal; without it claude is told not to style its output.
+	Interactive bool
+
+	// Log receives debug lines about the claude process, usually a logger
+	// scoped to the job (nil = none).
+	Log *log.Logger
+}
+
+// EnvOverrides returns the "KEY=VALUE" variables BuildEnv sets for the
+// Claude subprocess on top of the inherited environment: the ZAI / Anthropic
+// overrides derived from cfg, plus DepthEnv when cfg.Depth is set. Unless
+// cfg.Interactive is set it also sets TERM=dumb and NO_COLOR=1, so claude
+// does not write colors or spinners into the output glm parses.
+func EnvOverrides(cfg Config) []string {
+	overrides := []string{
+		"ANTHROPIC_AUTH_TOKEN=" + cfg.ZAIAPIKey,
+		"ANTHROPIC_BASE_URL=" + cfg.ZAIBaseURL,
+		"API_TIMEOUT_MS=" + cfg.ZAIAPITimeoutMS,
+		"ANTHROPIC_DEFAULT_OPUS_MODEL=" + cfg.OpusModel,
+		"ANTHROPIC_DEFAULT_SONNET_MODEL=" + cfg.SonnetModel,
+		"ANTHROPIC_DEFAULT_HAIKU_MODEL=" + cfg.HaikuModel,
+	}
+	if cfg.Depth > 0 {
+		overrides = append(overrides, DepthEnv+"="+strconv.Itoa(cfg.Depth))
+	}
+	if !cfg.Interactive {
+		overrides = append(overrides, "TERM=dumb", "NO_COLOR=1")
+	}
+	return overrides
 }
 
 // BuildEnv returns a slice of "KEY=VALUE" strings for the Claude subprocess.
 // It starts from the current process environment, removes nesting-detection
-// variables (CLAUDECODE, CLAUDE_CODE_ENTRYPOINT), and injects the ZAI /
-// Anthropic overrides derived from cfg.
+// variables (CLAUDECODE, CLAUDE_CODE_ENTRYPOINT) and any inherited copies of
+// the overridden keys, and injects EnvOverrides. Each key appears once, so the
+// result is also safe for syscall.Exec.
 func BuildEnv(cfg Config) []string {
+	overrides := EnvOverrides(cfg)
+
 	// Start from a filtered copy of os.Environ.
 	blocked := map[string]bool{
 		"CLAUDECODE":              true,
 		"CLAUDE_CODE_ENTRYPOINT": true,
 	}
+	for _, kv := range overrides {
+		key, _, _ := strings.Cut(kv, "=")
+		blocked[key] = true
+	}
 
 	var base []string
 	for _, kv := range os.Environ() {
@@ -52,16 +160,6 @@ func BuildEnv(cfg Config) []string {
 		base = append(base, kv)
 	}
 
-	// Inject / override ZAI-specific env vars.
-	overrides := []string{
-		"ANTHROPIC_AUTH_TOKEN=" + cfg.ZAIAPIKey,
-		"ANTHROPIC_BASE_URL=" + cfg.ZAIBaseURL,
-		"API_TIMEOUT_MS=" + cfg.ZAIAPITimeoutMS,
-		"ANTHROPIC_DEFAULT_OPUS_MODEL=" + cfg.OpusModel,
-		"ANTHROPIC_DEFAULT_SONNET_MODEL=" + cfg.SonnetModel,
-		"ANTHROPIC_DEFAULT_HAIKU_MODEL=" + cfg.HaikuModel,
-	}
-
 	return append(base, overrides...)
 }
 
@@ -92,29 +190,64 @@ func BuildFlags(cfg Config) []string {
 	return flags
 }
 
+// Args returns the arguments the Claude CLI is invoked with: BuildFlags
+// followed by the prompt.
+func Args(cfg Config) []string {
+	return append(BuildFlags(cfg), cfg.Prompt)
+}
+
 // Execute runs the Claude CLI as a subprocess inside cfg.WorkDir with the
 // given timeout.  It writes metadata files before and after execution, captures
 // stdout to raw.json and stderr to stderr.txt, then returns the process exit
-// code together with any Go-level error.
+// code together with any Go-level error. The claude CLI version is recorded in
+// claude_version.txt; a version older than MinVersion prints a warning.
+//
+// claude runs in its own process group. On timeout the whole group is
+// terminated with slot.TerminateProcessGroup, so tools claude started do not
+// outlive it.
 //
 // Errors:
 //   - 'err:dependency "claude CLI not found in PATH"' (exit 127) when `claude`
-//     is not in PATH.
+//     is not in PATH, or a FindBinary error when cfg.ClaudePath is unusable.
 //   - 'err:user "Directory not found: <path>"' (exit 1) when cfg.WorkDir does
 //     not exist.
 func Execute(cfg Config) (int, error) {
-	// Dependency check: claude CLI must be in PATH.
-	if _, err := exec.LookPath("claude"); err != nil {
-		return 127, fmt.Errorf(`err:dependency "claude CLI not found in PATH"`)
+	return ExecuteContext(context.Background(), cfg)
+}
+
+// ExecuteContext is Execute with a context: when ctx is cancelled, claude's
+// process group is terminated as on timeout and the exit code is 130
+// (exitcode.Interrupted).
+//
+// When raw.json or stderr.txt cannot be written (a full disk, usually) the
+// job is failed with a note in stderr.txt where that still fits, and the
+// exit code is 74 (exitcode.DiskError) with a *WriteError carrying
+// claude's output.
+func ExecuteContext(ctx context.Context, cfg Config) (int, error) {
+	// Dependency check: resolve the claude CLI.
+	claudeBin, err := FindBinary(cfg.ClaudePath)
+	if err != nil {
+		return 127, err
 	}
 
 	// Validate working directory.
 	if _, err := os.Stat(cfg.WorkDir); os.IsNotExist(err) {
-		return 1, fmt.Errorf(`err:user "Directory not found: %s"`, cfg.WorkDir)
+		return 1, errs.User(`"Directory not found: %s"`, cfg.WorkDir)
+	}
+
+	// A glm run by this claude is one level deeper.
+	if cfg.Depth <= 0 {
+		cfg.Depth = NestingDepth() + 1
+	}
+
+	// An outdated claude still runs, but its output may not parse.
+	version, _ := Version(claudeBin)
+	if warning := VersionWarning(version); warning != "" {
+		warnf("warning: %s\n", warning)
 	}
 
 	// Write pre-execution metadata files.
-	now := time.Now().UTC().Format(time.RFC3339)
+	now := job.FormatTimestamp(time.Now())
 	writes := map[string]string{
 		"prompt.txt":          cfg.Prompt,
 		"workdir.txt":         cfg.WorkDir,
@@ -122,46 +255,71 @@ func Execute(cfg Config) (int, error) {
 		"model.txt":           fmt.Sprintf("opus=%s sonnet=%s haiku=%s", cfg.OpusModel, cfg.SonnetModel, cfg.HaikuModel),
 		"started_at.txt":      now,
 	}
+	if version != "" {
+		writes[VersionFile] = version
+	}
 	for name, content := range writes {
-		if err := os.WriteFile(filepath.Join(cfg.JobDir, name), []byte(content), 0o644); err != nil {
-			return 1, fmt.Errorf("write %s: %w", name, err)
+		if err := writeFile(filepath.Join(cfg.JobDir, name), []byte(content), 0o644); err != nil {
+			return exitcode.DiskError, writeFailed(cfg.JobDir, name, err, "")
 		}
 	}
+	recordMetadata(cfg, now, version)
 
 	// Build command.
-	timeout := cfg.TimeoutSecs
-	if timeout <= 0 {
-		timeout = 600
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	timeout := TimeoutSecs(cfg)
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	flags := BuildFlags(cfg)
-	args := append(flags, cfg.Prompt)
-	cmd := exec.CommandContext(ctx, "claude", args...)
+	cmd := exec.CommandContext(runCtx, claudeBin, Args(cfg)...)
 	cmd.Dir = cfg.WorkDir
 	cmd.Env = BuildEnv(cfg)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return slot.TerminateProcessGroup(cmd.Process.Pid) }
 
+	// stdout and stderr are pipes and stdin is /dev/null, so claude never
+	// sees a terminal.
 	var stdoutBuf, stderrBuf strings.Builder
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
-	runErr := cmd.Run()
+	runStart := time.Now()
+	runErr := cmd.Start()
+	if runErr == nil {
+		job.EmitEvent(cfg.JobDir, events.ClaudeStarted, func(e *events.Event) { e.PID = cmd.Process.Pid })
+		_ = job.UpdateManifest(cfg.JobDir, func(m *job.Manifest) { m.ClaudePID = cmd.Process.Pid })
+		cfg.Log.With(log.Fields{"pid": cmd.Process.Pid, "model": cfg.Model}).Debug("claude started")
+		runErr = cmd.Wait()
+	}
+	runDuration := time.Since(runStart).Milliseconds()
 
 	// Write finished_at.
-	finishedAt := time.Now().UTC().Format(time.RFC3339)
-	_ = os.WriteFile(filepath.Join(cfg.JobDir, "finished_at.txt"), []byte(finishedAt), 0o644)
+	WriteFinishedAt(cfg.JobDir)
 
-	// Persist raw.json and stderr.txt.
-	_ = os.WriteFile(filepath.Join(cfg.JobDir, "raw.json"), []byte(stdoutBuf.String()), 0o644)
-	_ = os.WriteFile(filepath.Join(cfg.JobDir, "stderr.txt"), []byte(stderrBuf.String()), 0o644)
+	// Persist raw.json and stderr.txt. When one cannot be written the job is
+	// failed here and claude's output travels back in the WriteError.
+	var saveErr *WriteError
+	for _, f := range []struct{ name, data string }{
+		{"raw.json", stdoutBuf.String()},
+		{"stderr.txt", stderrBuf.String()},
+	} {
+		if err := writeFile(filepath.Join(cfg.JobDir, f.name), []byte(f.data), 0o644); err != nil {
+			saveErr = writeFailed(cfg.JobDir, f.name, err, resultText(stdoutBuf.String()))
+			break
+		}
+	}
+
+	if cfg.CaptureDiff && saveErr == nil {
+		CaptureDiff(cfg.JobDir, cfg.WorkDir, cfg.DiffMaxBytes)
+	}
 
-	// Determine exit code.  Context cancellation (timeout) takes precedence
-	// and maps to 124, matching the behaviour of the `timeout(1)` command.
+	// Determine exit code.  An interrupt maps to 130 and a timeout to 124,
+	// matching the behaviour of the `timeout(1)` command, regardless of the
+	// raw exit code.
 	exitCode := 0
 	if runErr != nil {
 		if ctx.Err() != nil {
-			// Context expired — treat as timeout regardless of the raw exit code.
+			exitCode = exitcode.Interrupted
+		} else if runCtx.Err() != nil {
 			exitCode = 124
 		} else if exitErr, ok := runErr.(*exec.ExitError); ok {
 			exitCode = exitErr.ExitCode()
@@ -174,18 +332,26 @@ func Execute(cfg Config) (int, error) {
 		}
 	}
 
-	// Write exit_code.txt only on failure.
-	if exitCode != 0 {
-		_ = os.WriteFile(filepath.Join(cfg.JobDir, "exit_code.txt"), []byte(fmt.Sprintf("%d", exitCode)), 0o644)
-	}
+	// Write exit_code.txt only on failure; the manifest always records it.
+	WriteExitCode(cfg.JobDir, exitCode)
+	job.EmitEvent(cfg.JobDir, events.ClaudeExited, func(e *events.Event) {
+		e.ExitCode = &exitCode
+		e.DurationMS = &runDuration
+	})
+	cfg.Log.With(log.Fields{"exit_code": exitCode, "duration_ms": runDuration}).Debug("claude exited")
 
+	if saveErr != nil {
+		cfg.Log.With(log.Fields{"file": saveErr.File, "error": saveErr.Err.Error(), "recorded": saveErr.Recorded}).Debug("claude output not saved")
+		return exitcode.DiskError, saveErr
+	}
 	return exitCode, runErr
 }
 
 // WriteMetadata writes pre-execution metadata files (prompt.txt, workdir.txt,
-// permission_mode.txt, model.txt, started_at.txt) to cfg.JobDir.
+// permission_mode.txt, model.txt, started_at.txt, and git_context.txt for a
+// git workdir) to cfg.JobDir and mirrors them into the job.json manifest.
 func WriteMetadata(cfg Config) {
-	now := time.Now().UTC().Format(time.RFC3339)
+	now := job.FormatTimestamp(time.Now())
 	files := map[string]string{
 		"prompt.txt":          cfg.Prompt,
 		"workdir.txt":         cfg.WorkDir,
@@ -196,18 +362,174 @@ func WriteMetadata(cfg Config) {
 	for name, content := range files {
 		_ = os.WriteFile(filepath.Join(cfg.JobDir, name), []byte(content), 0o644)
 	}
+	recordMetadata(cfg, now, "")
+}
+
+// TimeoutSecs returns the timeout cfg runs claude with: cfg.TimeoutSecs, or
+// 600 seconds when it is not set.
+func TimeoutSecs(cfg Config) int {
+	if cfg.TimeoutSecs <= 0 {
+		return 600
+	}
+	return cfg.TimeoutSecs
+}
+
+// recordMetadata mirrors the pre-execution metadata into the job manifest,
+// with the deadline the timeout sets from startedAt, and records the
+// workdir's git state (WriteGitContext). claudeVersion is empty when unknown.
+// It is the only caller of WriteGitContext, so git runs once per job.
+func recordMetadata(cfg Config, startedAt, claudeVersion string) {
+	deadline := ""
+	if started, err := job.ParseTimestamp(startedAt); err == nil {
+		deadline = job.FormatTimestamp(started.Add(time.Duration(TimeoutSecs(cfg)) * time.Second))
+	}
+	_ = job.UpdateManifest(cfg.JobDir, func(m *job.Manifest) {
+		m.Prompt = cfg.Prompt
+		m.WorkDir = cfg.WorkDir
+		m.PermissionMode = cfg.PermissionMode
+		m.Models = job.Models{Opus: cfg.OpusModel, Sonnet: cfg.SonnetModel, Haiku: cfg.HaikuModel}
+		m.StartedAt = startedAt
+		m.TimeoutSecs = cfg.TimeoutSecs
+		m.Deadline = deadline
+		m.CaptureDiff = cfg.CaptureDiff
+		m.StrictResult = cfg.StrictResult
+		m.Confine = cfg.Confine
+		m.BaseURL = cfg.ZAIBaseURL
+		m.Priority = cfg.Priority
+		m.Template = cfg.Template
+		m.Depth = cfg.Depth
+		m.ClaudeVersion = claudeVersion
+		if m.Invocation == nil {
+			m.Invocation = cfg.Invocation
+		}
+	})
+	WriteGitContext(cfg.JobDir, cfg.WorkDir)
+}
+
+// gitContextTimeout bounds each git command run by WriteGitContext.
+const gitContextTimeout = 2 * time.Second
+
+// WriteGitContext records the git state of workDir (HEAD short SHA, branch,
+// dirty flag) in git_context.txt inside jobDir and in the manifest, as
+// "head=", "branch=" and "dirty=" lines. Nothing is written when workDir is
+// not inside a git repository, has no commits, or git is unavailable or slow.
+func WriteGitContext(jobDir, workDir string) {
+	head, err := gitOutput(workDir, "rev-parse", "--short", "HEAD")
+	if err != nil || head == "" {
+		return
+	}
+	status, err := gitOutput(workDir, "status", "--porcelain")
+	if err != nil {
+		return
+	}
+	// symbolic-ref fails on a detached HEAD, which leaves Branch empty.
+	branch, _ := gitOutput(workDir, "symbolic-ref", "--short", "-q", "HEAD")
+
+	gc := &job.GitContext{Head: head, Branch: branch, Dirty: status != ""}
+	content := fmt.Sprintf("head=%s\nbranch=%s\ndirty=%t", gc.Head, gc.Branch, gc.Dirty)
+	_ = os.WriteFile(filepath.Join(jobDir, "git_context.txt"), []byte(content), 0o644)
+	_ = job.UpdateManifest(jobDir, func(m *job.Manifest) { m.Git = gc })
+}
+
+// gitOutput runs git with args in dir under gitContextTimeout and returns its
+// trimmed stdout.
+func gitOutput(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitContextTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// diffTimeout bounds each git command run by CaptureDiff.
+const diffTimeout = 30 * time.Second
+
+// DiffTruncatedMarker starts the line appended to a diff.patch cut at the
+// size cap.
+const DiffTruncatedMarker = "[GoLeM] diff truncated"
+
+// CaptureDiff saves the changes in workDir relative to HEAD ("git diff HEAD",
+// staged and unstaged; untracked files are not included) to diff.patch and
+// its "--stat" to diff_stat.txt inside jobDir. A patch larger than maxBytes
+// (0 = config.DefaultDiffMaxBytes) is cut at the last line break before the
+// cap and ends with a DiffTruncatedMarker line. Nothing is written for a
+// clean worktree, a workdir outside git, or when git fails; the job's status
+// never depends on it.
+func CaptureDiff(jobDir, workDir string, maxBytes int) {
+	if maxBytes <= 0 {
+		maxBytes = config.DefaultDiffMaxBytes
+	}
+	patch, err := gitDiff(workDir, "HEAD")
+	if err != nil || len(patch) == 0 {
+		return
+	}
+	stat, err := gitDiff(workDir, "--stat", "HEAD")
+	if err != nil {
+		return
+	}
+	if len(patch) > maxBytes {
+		total := len(patch)
+		cut := bytes.LastIndexByte(patch[:maxBytes], '\n') + 1
+		if cut == 0 {
+			cut = maxBytes
+		}
+		patch = append(patch[:cut:cut], fmt.Sprintf("%s: showing %d of %d bytes\n", DiffTruncatedMarker, cut, total)...)
+	}
+	_ = os.WriteFile(filepath.Join(jobDir, "diff.patch"), patch, 0o644)
+	_ = os.WriteFile(filepath.Join(jobDir, "diff_stat.txt"), stat, 0o644)
+}
+
+// gitDiff runs "git diff" with args in dir under diffTimeout and returns its
+// stdout. Colour and external diff drivers are disabled.
+func gitDiff(dir string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), diffTimeout)
+	defer cancel()
+	full := append([]string{"-C", dir, "diff", "--no-color", "--no-ext-diff"}, args...)
+	return exec.CommandContext(ctx, "git", full...).Output()
 }
 
 // WriteFinishedAt writes the current UTC time in RFC3339 format to
-// finished_at.txt inside jobDir.
+// finished_at.txt inside jobDir and records it in the manifest. When the job
+// has a started_at it also writes the whole seconds between the two to
+// duration_seconds.txt, so the duration stays put if the clock changes later.
 func WriteFinishedAt(jobDir string) {
-	now := time.Now().UTC().Format(time.RFC3339)
+	finished := time.Now()
+	now := job.FormatTimestamp(finished)
 	_ = os.WriteFile(filepath.Join(jobDir, "finished_at.txt"), []byte(now), 0o644)
+	_ = job.UpdateManifest(jobDir, func(m *job.Manifest) {
+		m.FinishedAt = now
+		if started, err := job.ParseTimestamp(m.StartedAt); err == nil && !finished.Before(started) {
+			d := int(finished.Sub(started) / time.Second)
+			_ = os.WriteFile(filepath.Join(jobDir, "duration_seconds.txt"), []byte(strconv.Itoa(d)), 0o644)
+		}
+	})
+}
+
+// PanicFile holds the panic value and stack trace of a job whose runner
+// panicked (see RecordPanic).
+const PanicFile = "panic.txt"
+
+// RecordPanic records that the goroutine running the job in jobDir panicked
+// with r, stack being its stack trace. The panic and stack are written to
+// PanicFile and appended to stderr.txt, keeping what claude already wrote
+// there. The job moves to failed through job.TransitionStatus, so a job that
+// already ended (killed, say) keeps its status, and finished_at is written
+// unless the job has one.
+func RecordPanic(jobDir string, r any, stack []byte) {
+	msg := fmt.Sprintf("panic: %v\n\n%s", r, stack)
+	_ = os.WriteFile(filepath.Join(jobDir, PanicFile), []byte(msg), 0o644)
+	_ = job.AppendStderr(jobDir, msg)
+	_ = job.TransitionStatus(jobDir, job.StatusFailed)
+	if job.LoadManifest(jobDir).FinishedAt == "" {
+		WriteFinishedAt(jobDir)
+	}
 }
 
 // WriteExitCode writes the exit code as a decimal string to exit_code.txt
-// inside jobDir.  If code is 0 it is a no-op (success does not get a file).
+// inside jobDir.  If code is 0 no file is written (success does not get a
+// file), but the manifest records the exit code either way.
 func WriteExitCode(jobDir string, code int) {
+	_ = job.UpdateManifest(jobDir, func(m *job.Manifest) { m.ExitCode = &code })
 	if code == 0 {
 		return
 	}
@@ -222,7 +544,12 @@ func MapStatus(exitCode int, stderr string) string {
 		return "done"
 	case 124:
 		return "timeout"
+	case exitcode.Interrupted:
+		return "killed"
 	default:
+		if IsContextExceeded(stderr) {
+			return "context_exceeded"
+		}
 		if isPermissionError(stderr) {
 			return "permission_error"
 		}
@@ -230,6 +557,52 @@ func MapStatus(exitCode int, stderr string) string {
 	}
 }
 
+// MapJobStatus is MapStatus that also checks result, the result text of the
+// run (stdout.txt): claude reports a prompt too long for the context window
+// there rather than on stderr, and exits 1.
+func MapJobStatus(exitCode int, stderr, result string) string {
+	status := MapStatus(exitCode, stderr)
+	if status == "failed" && IsContextExceeded(result) {
+		return "context_exceeded"
+	}
+	return status
+}
+
+// contextExceededKeywords are the case-insensitive phrasings claude and the
+// API use for a prompt that does not fit the model's context window.
+var contextExceededKeywords = []string{
+	"prompt is too long",
+	"maximum context length",
+	"context_length_exceeded",
+	"context length exceeded",
+	"exceed context limit",
+	"exceeds the context window",
+}
+
+// IsContextExceeded reports whether text, the stderr or result of a failed
+// run, says the prompt exceeded the model's context window.
+func IsContextExceeded(text string) bool {
+	lower := strings.ToLower(text)
+	for _, kw := range contextExceededKeywords {
+		if strings.Contains(lower, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchFailureMarker returns the first of markers that occurs in stdout, the
+// result text of a job. A match means claude reported in-band that it could
+// not do the task, even if it exited 0.
+func MatchFailureMarker(stdout string, markers []string) (string, bool) {
+	for _, m := range markers {
+		if m != "" && strings.Contains(stdout, m) {
+			return m, true
+		}
+	}
+	return "", false
+}
+
 // isPermissionError reports whether stderr indicates a permission problem.
 func isPermissionError(stderr string) bool {
 	lower := strings.ToLower(stderr)
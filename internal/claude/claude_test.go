@@ -3,13 +3,17 @@ package claude_test
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/job"
 )
 
 // seedDir is the absolute path to the claude-execution seed directory.
@@ -323,6 +327,23 @@ func TestParseRawJSONWithNoToolCallsProducesNoChangesChangelog(t *testing.T) {
 	}
 }
 
+// TestParseRawJSONPlanModeChangelog verifies that a plan-mode job that
+// changed nothing gets the PLAN marker instead of "(no file changes)".
+func TestParseRawJSONPlanModeChangelog(t *testing.T) {
+	jobDir := t.TempDir()
+	copyTestdata(t, "raw_output_plan.json", jobDir)
+	if err := os.WriteFile(filepath.Join(jobDir, "permission_mode.txt"), []byte("plan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := claude.ParseRawJSON(jobDir); err != nil {
+		t.Fatalf("ParseRawJSON: %v", err)
+	}
+	if got := readJobFile(t, jobDir, "changelog.txt"); got != claude.PlanChangelog {
+		t.Errorf("changelog.txt = %q, want %q", got, claude.PlanChangelog)
+	}
+}
+
 // TestParseRawJSONWithBashDeleteCommand verifies that a Bash rm command is
 // recorded as "DELETE via bash: ...".
 func TestParseRawJSONWithBashDeleteCommand(t *testing.T) {
@@ -478,6 +499,42 @@ func TestExitCode137SIGKILLMapsToFailed(t *testing.T) {
 	}
 }
 
+// TestContextExceededMapsToContextExceeded verifies that the known
+// phrasings of a prompt too long for the context window map to
+// context_exceeded, on stderr or in the result text.
+func TestContextExceededMapsToContextExceeded(t *testing.T) {
+	for _, name := range []string{
+		"stderr_context_prompt_too_long.txt",
+		"stderr_context_limit.txt",
+		"stderr_context_maximum_length.txt",
+		"stderr_context_length_exceeded.txt",
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := claude.MapStatus(1, string(data)); got != "context_exceeded" {
+			t.Errorf("MapStatus(1, %s) = %q, want context_exceeded", name, got)
+		}
+		if got := claude.MapStatus(0, string(data)); got != "done" {
+			t.Errorf("MapStatus(0, %s) = %q, want done", name, got)
+		}
+	}
+
+	jobDir := t.TempDir()
+	copyTestdata(t, "raw_output_prompt_too_long.json", jobDir)
+	if err := claude.ParseRawJSON(jobDir); err != nil {
+		t.Fatalf("ParseRawJSON: %v", err)
+	}
+	result, _ := os.ReadFile(filepath.Join(jobDir, "stdout.txt"))
+	if got := claude.MapJobStatus(1, "", string(result)); got != "context_exceeded" {
+		t.Errorf("MapJobStatus(1, \"\", %q) = %q, want context_exceeded", result, got)
+	}
+	if got := claude.MapJobStatus(1, "boom", "Fixed the race condition."); got != "failed" {
+		t.Errorf("MapJobStatus(1, boom, ...) = %q, want failed", got)
+	}
+}
+
 // --------------------------------------------------------------------------
 // AC8: Metadata file writes
 // --------------------------------------------------------------------------
@@ -530,6 +587,49 @@ func TestMetadataFilesWrittenBeforeExecution(t *testing.T) {
 	}
 }
 
+// TestMetadataMirroredIntoManifest verifies that WriteMetadata, WriteFinishedAt
+// and WriteExitCode keep job.json in sync with the legacy files.
+func TestMetadataMirroredIntoManifest(t *testing.T) {
+	jobDir := t.TempDir()
+	cfg := claude.Config{
+		Prompt:         "Analyze the code",
+		WorkDir:        "/tmp/project",
+		PermissionMode: "acceptEdits",
+		OpusModel:      "glm-4.7",
+		SonnetModel:    "glm-4.5",
+		HaikuModel:     "glm-4",
+		TimeoutSecs:    900,
+		JobDir:         jobDir,
+	}
+
+	claude.WriteMetadata(cfg)
+	claude.WriteFinishedAt(jobDir)
+	claude.WriteExitCode(jobDir, 0)
+
+	m, err := job.ReadManifest(jobDir)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if m.Prompt != cfg.Prompt || m.WorkDir != cfg.WorkDir || m.PermissionMode != cfg.PermissionMode {
+		t.Errorf("manifest prompt/workdir/mode = %q/%q/%q", m.Prompt, m.WorkDir, m.PermissionMode)
+	}
+	if want := (job.Models{Opus: "glm-4.7", Sonnet: "glm-4.5", Haiku: "glm-4"}); m.Models != want {
+		t.Errorf("manifest models = %+v, want %+v", m.Models, want)
+	}
+	if m.TimeoutSecs != 900 {
+		t.Errorf("manifest timeout = %d, want 900", m.TimeoutSecs)
+	}
+	if _, err := time.Parse(time.RFC3339, m.StartedAt); err != nil {
+		t.Errorf("manifest started_at %q is not RFC3339: %v", m.StartedAt, err)
+	}
+	if _, err := time.Parse(time.RFC3339, m.FinishedAt); err != nil {
+		t.Errorf("manifest finished_at %q is not RFC3339: %v", m.FinishedAt, err)
+	}
+	if m.ExitCode == nil || *m.ExitCode != 0 {
+		t.Errorf("manifest exit_code = %v, want 0", m.ExitCode)
+	}
+}
+
 // TestFinishedAtWrittenAfterExecutionCompletes verifies that
 // WriteFinishedAt creates finished_at.txt with a valid ISO 8601 timestamp.
 func TestFinishedAtWrittenAfterExecutionCompletes(t *testing.T) {
@@ -541,6 +641,26 @@ func TestFinishedAtWrittenAfterExecutionCompletes(t *testing.T) {
 	if _, err := time.Parse(time.RFC3339, finishedAt); err != nil {
 		t.Errorf("finished_at.txt %q is not RFC3339: %v", finishedAt, err)
 	}
+	if _, err := os.Stat(filepath.Join(jobDir, "duration_seconds.txt")); !os.IsNotExist(err) {
+		t.Errorf("duration_seconds.txt written for a job without started_at: %v", err)
+	}
+}
+
+// TestDurationWrittenWithFinishedAt verifies that WriteFinishedAt records the
+// seconds since started_at in duration_seconds.txt.
+func TestDurationWrittenWithFinishedAt(t *testing.T) {
+	jobDir := t.TempDir()
+	started := time.Now().Add(-75 * time.Second)
+	if err := job.UpdateManifest(jobDir, func(m *job.Manifest) { m.StartedAt = job.FormatTimestamp(started) }); err != nil {
+		t.Fatal(err)
+	}
+
+	claude.WriteFinishedAt(jobDir)
+
+	d, err := strconv.Atoi(readJobFile(t, jobDir, "duration_seconds.txt"))
+	if err != nil || d < 74 || d > 80 {
+		t.Errorf("duration_seconds.txt = %d (%v), want about 75", d, err)
+	}
 }
 
 // TestExitCodeFileWrittenOnNonZeroExit verifies that WriteExitCode creates
@@ -722,6 +842,117 @@ func TestRawJSONHasNoResultField(t *testing.T) {
 	}
 }
 
+// copyTestdata copies testdata/name into jobDir as raw.json.
+func copyTestdata(t *testing.T, name, jobDir string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(jobDir, "raw.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestParseRawJSONEventFormats verifies that an array of events, a
+// stream-json event per line and tool calls nested under unfamiliar keys all
+// yield the result text and the same changelog, with repeated tool_use
+// blocks counted once.
+func TestParseRawJSONEventFormats(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "expected_changelog_events.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range []string{"raw_output_events_array.json", "raw_output_stream.jsonl", "raw_output_nested.json"} {
+		t.Run(fixture, func(t *testing.T) {
+			jobDir := t.TempDir()
+			copyTestdata(t, fixture, jobDir)
+
+			stderr := captureStderr(t, func() {
+				if err := claude.ParseRawJSON(jobDir); err != nil {
+					t.Fatalf("ParseRawJSON: %v", err)
+				}
+			})
+			if stderr != "" {
+				t.Errorf("unexpected warning: %q", stderr)
+			}
+			if got := readJobFile(t, jobDir, "stdout.txt"); got != "Fixed the race condition." {
+				t.Errorf("stdout.txt = %q", got)
+			}
+			if got := readJobFile(t, jobDir, "changelog.txt"); got != strings.TrimRight(string(want), "\n") {
+				t.Errorf("changelog.txt = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestParseRawJSONRecordsSessionID verifies that the session ID of a result
+// object or of the events is saved to session_id.txt, and that raw.json
+// without one (older claude versions) parses without it.
+func TestParseRawJSONRecordsSessionID(t *testing.T) {
+	tests := []struct{ name, raw, want string }{
+		{"result object", `{"type":"result","result":"ok","session_id":"9f1c2d3e-aaaa-bbbb-cccc-1234567890ab"}`, "9f1c2d3e-aaaa-bbbb-cccc-1234567890ab"},
+		{"stream", `{"type":"system","session_id":"s-1"}` + "\n" + `{"type":"result","result":"ok","session_id":"s-1"}`, "s-1"},
+		{"none", `{"result":"ok"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(jobDir, "raw.json"), []byte(tt.raw), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := claude.ParseRawJSON(jobDir); err != nil {
+				t.Fatalf("ParseRawJSON: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(jobDir, claude.SessionIDFile))
+			if string(data) != tt.want || (tt.want == "" && !os.IsNotExist(err)) {
+				t.Errorf("%s = %q (%v), want %q", claude.SessionIDFile, data, err, tt.want)
+			}
+			if got := job.LoadManifest(jobDir).SessionID; got != tt.want {
+				t.Errorf("manifest session_id = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseRawJSONUnknownShapes verifies that raw.json that is valid JSON but
+// neither a result object nor events degrades to empty output with a warning,
+// and that a truncated event stream keeps the events before the damage.
+func TestParseRawJSONUnknownShapes(t *testing.T) {
+	jobDir := t.TempDir()
+	copyTestdata(t, "raw_output_unknown.json", jobDir)
+	stderr := captureStderr(t, func() {
+		if err := claude.ParseRawJSON(jobDir); err != nil {
+			t.Fatalf("ParseRawJSON: %v", err)
+		}
+	})
+	if !strings.Contains(stderr, "warning: unrecognised raw.json format") {
+		t.Errorf("stderr = %q, want warning", stderr)
+	}
+	if got := readJobFile(t, jobDir, "stdout.txt"); got != "" {
+		t.Errorf("stdout.txt = %q, want empty", got)
+	}
+	if got := readJobFile(t, jobDir, "changelog.txt"); got != "(no file changes)" {
+		t.Errorf("changelog.txt = %q", got)
+	}
+
+	truncated := `{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t1","name":"Write","input":{"file_path":"/src/a.go"}}]}}` + "\n" + `{"type":"result","res`
+	if err := os.WriteFile(filepath.Join(jobDir, "raw.json"), []byte(truncated), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr = captureStderr(t, func() {
+		if err := claude.ParseRawJSON(jobDir); err != nil {
+			t.Fatalf("ParseRawJSON: %v", err)
+		}
+	})
+	if !strings.Contains(stderr, "truncated") {
+		t.Errorf("stderr = %q, want truncation warning", stderr)
+	}
+	if got := readJobFile(t, jobDir, "changelog.txt"); got != "WRITE /src/a.go" {
+		t.Errorf("changelog.txt = %q, want the complete event's Write", got)
+	}
+}
+
 // TestWorkingDirectoryDoesNotExist verifies that Execute returns
 // 'err:user "Directory not found: ..."' with exit code 1 and does not run
 // the claude subprocess.
@@ -841,3 +1072,439 @@ func TestBashCommandLongerThan80CharsIsTruncatedInChangelog(t *testing.T) {
 		t.Errorf("command part is %d chars, want ≤ 80; got: %q", len(cmdPart), cmdPart)
 	}
 }
+
+// --------------------------------------------------------------------------
+// Binary resolution
+// --------------------------------------------------------------------------
+
+// writeFakeClaude writes an executable shell script named claude into dir.
+func writeFakeClaude(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "claude")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestFindBinaryIgnoresClaudeInCurrentDirectory verifies that an executable
+// or directory named claude in the cwd never shadows the one in PATH.
+func TestFindBinaryIgnoresClaudeInCurrentDirectory(t *testing.T) {
+	binDir := t.TempDir()
+	want := writeFakeClaude(t, binDir)
+	t.Setenv("PATH", binDir)
+
+	cwd := t.TempDir()
+	writeFakeClaude(t, cwd)
+	t.Chdir(cwd)
+
+	got, err := claude.FindBinary("")
+	if err != nil {
+		t.Fatalf("FindBinary: %v", err)
+	}
+	if got != want {
+		t.Errorf("FindBinary = %q, want %q from PATH", got, want)
+	}
+
+	// With nothing in PATH, the cwd copy must still not be used.
+	t.Setenv("PATH", t.TempDir())
+	if got, err := claude.FindBinary(""); err == nil {
+		t.Errorf("FindBinary = %q, want not-found error", got)
+	}
+
+	// "." in PATH must not resolve relative to the cwd either.
+	t.Setenv("PATH", ".")
+	if got, err := claude.FindBinary(""); err == nil {
+		t.Errorf("FindBinary with PATH=. = %q, want error", got)
+	}
+}
+
+// TestFindBinarySkipsDirectoryNamedClaude verifies that a directory named
+// claude in PATH is not treated as the CLI.
+func TestFindBinarySkipsDirectoryNamedClaude(t *testing.T) {
+	dirWithSubdir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dirWithSubdir, "claude"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	binDir := t.TempDir()
+	want := writeFakeClaude(t, binDir)
+	t.Setenv("PATH", dirWithSubdir+string(os.PathListSeparator)+binDir)
+
+	got, err := claude.FindBinary("")
+	if err != nil {
+		t.Fatalf("FindBinary: %v", err)
+	}
+	if got != want {
+		t.Errorf("FindBinary = %q, want %q", got, want)
+	}
+}
+
+// TestFindBinaryHonoursClaudePath verifies that claude_path takes precedence
+// over PATH and must be an absolute executable file.
+func TestFindBinaryHonoursClaudePath(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	pinned := writeFakeClaude(t, t.TempDir())
+
+	got, err := claude.FindBinary(pinned)
+	if err != nil {
+		t.Fatalf("FindBinary(%q): %v", pinned, err)
+	}
+	if got != pinned {
+		t.Errorf("FindBinary = %q, want %q", got, pinned)
+	}
+
+	for _, bad := range []string{"claude", t.TempDir(), filepath.Join(t.TempDir(), "missing")} {
+		if _, err := claude.FindBinary(bad); err == nil || !strings.HasPrefix(err.Error(), "err:dependency") {
+			t.Errorf("FindBinary(%q) error = %v, want err:dependency", bad, err)
+		}
+	}
+}
+
+// TestExecuteUsesClaudePath verifies that Execute runs the pinned binary even
+// when claude is not in PATH.
+func TestExecuteUsesClaudePath(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	pinned := writeFakeClaude(t, t.TempDir())
+
+	cfg := claude.Config{
+		ClaudePath: pinned,
+		WorkDir:    t.TempDir(),
+		JobDir:     t.TempDir(),
+	}
+	code, err := claude.Execute(cfg)
+	if err != nil || code != 0 {
+		t.Errorf("Execute = %d, %v; want 0, nil", code, err)
+	}
+}
+
+// runGit runs git with args in dir, failing the test on error.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// scratchRepo creates a git repository on branch "feature" with a.txt
+// committed, skipping the test when git is not installed.
+func scratchRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	runGit(t, repo, "init", "--quiet", "-b", "feature")
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "add", "a.txt")
+	runGit(t, repo, "commit", "--quiet", "-m", "initial")
+	return repo
+}
+
+// TestWriteGitContextRecordsRepoState verifies that WriteGitContext records
+// HEAD, branch and the dirty flag in git_context.txt and job.json, and writes
+// nothing for a directory outside any repository.
+func TestWriteGitContextRecordsRepoState(t *testing.T) {
+	repo := scratchRepo(t)
+	head := runGit(t, repo, "rev-parse", "--short", "HEAD")
+
+	// Clean worktree.
+	jobDir := t.TempDir()
+	claude.WriteGitContext(jobDir, repo)
+	if got, want := readJobFile(t, jobDir, "git_context.txt"), fmt.Sprintf("head=%s\nbranch=feature\ndirty=false", head); got != want {
+		t.Errorf("git_context.txt = %q, want %q", got, want)
+	}
+
+	// An uncommitted file makes it dirty; the manifest mirrors the file.
+	if err := os.WriteFile(filepath.Join(repo, "new.txt"), []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jobDir = t.TempDir()
+	claude.WriteGitContext(jobDir, repo)
+	m, err := job.ReadManifest(jobDir)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if want := (job.GitContext{Head: head, Branch: "feature", Dirty: true}); m.Git == nil || *m.Git != want {
+		t.Errorf("manifest git = %+v, want %+v", m.Git, want)
+	}
+
+	// Not a repository: nothing is recorded.
+	plain, jobDir := t.TempDir(), t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(plain))
+	claude.WriteGitContext(jobDir, plain)
+	if _, err := os.Stat(filepath.Join(jobDir, "git_context.txt")); !os.IsNotExist(err) {
+		t.Errorf("git_context.txt written for a non-git dir (err=%v)", err)
+	}
+	if _, err := job.ReadManifest(jobDir); err == nil {
+		t.Error("job.json written for a non-git dir")
+	}
+}
+
+// TestExecuteCapturesDiff verifies that with CaptureDiff a fake claude that
+// edits a tracked file leaves diff.patch and diff_stat.txt in the job dir,
+// and that nothing is captured without it.
+func TestExecuteCapturesDiff(t *testing.T) {
+	repo := scratchRepo(t)
+	pinned := filepath.Join(t.TempDir(), "claude")
+	// The script only writes into the scratch repo, never into the
+	// directory the version probe happens to run it in.
+	script := "#!/bin/sh\n[ \"$1\" = --version ] && exit 0\necho changed >> '" + filepath.Join(repo, "a.txt") + "'\n"
+	if err := os.WriteFile(pinned, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	jobDir := t.TempDir()
+	cfg := claude.Config{ClaudePath: pinned, WorkDir: repo, JobDir: jobDir, CaptureDiff: true}
+	if code, err := claude.Execute(cfg); err != nil || code != 0 {
+		t.Fatalf("Execute = %d, %v; want 0, nil", code, err)
+	}
+	if patch := readJobFile(t, jobDir, "diff.patch"); !strings.Contains(patch, "+changed") || !strings.Contains(patch, "a/a.txt") {
+		t.Errorf("diff.patch = %q", patch)
+	}
+	if stat := readJobFile(t, jobDir, "diff_stat.txt"); !strings.Contains(stat, "a.txt") || !strings.Contains(stat, "1 file changed") {
+		t.Errorf("diff_stat.txt = %q", stat)
+	}
+
+	// Off by default.
+	jobDir = t.TempDir()
+	cfg.JobDir, cfg.CaptureDiff = jobDir, false
+	if _, err := claude.Execute(cfg); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(jobDir, "diff.patch")); !os.IsNotExist(err) {
+		t.Errorf("diff.patch written without CaptureDiff (err=%v)", err)
+	}
+}
+
+// TestCaptureDiffTruncatesAndSkipsNonGit verifies the size cap and that a
+// workdir outside git is silently skipped.
+func TestCaptureDiffTruncatesAndSkipsNonGit(t *testing.T) {
+	repo := scratchRepo(t)
+	big := strings.Repeat("a line of generated output\n", 100)
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte(big), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	jobDir := t.TempDir()
+	claude.CaptureDiff(jobDir, repo, 500)
+	patch := readJobFile(t, jobDir, "diff.patch")
+	lines := strings.Split(strings.TrimSuffix(patch, "\n"), "\n")
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, claude.DiffTruncatedMarker) {
+		t.Errorf("last line = %q, want the truncation marker", last)
+	}
+	if body := len(patch) - len(lines[len(lines)-1]) - 1; body > 500 {
+		t.Errorf("patch body is %d bytes, want at most 500", body)
+	}
+
+	plain, jobDir := t.TempDir(), t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(plain))
+	claude.CaptureDiff(jobDir, plain, 0)
+	if entries, _ := os.ReadDir(jobDir); len(entries) != 0 {
+		t.Errorf("files written for a non-git workdir: %v", entries)
+	}
+}
+
+// --------------------------------------------------------------------------
+// Claude CLI version
+// --------------------------------------------------------------------------
+
+// TestParseVersionFormats verifies that the version number is found in the
+// formats claude --version has used, and that garbage yields none.
+func TestParseVersionFormats(t *testing.T) {
+	tests := []struct {
+		out, want string
+	}{
+		{"1.0.38 (Claude Code)\n", "1.0.38"},
+		{"claude v2.1.0", "2.1.0"},
+		{"2.0\n", "2.0"},
+		{"Segmentation fault", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := claude.ParseVersion(tt.out)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("ParseVersion(%q) = %q, %v; want %q", tt.out, got, ok, tt.want)
+		}
+	}
+
+	if claude.CompareVersions("1.10.0", "1.9.9") != 1 || claude.CompareVersions("1.0", "1.0.0") != 0 || claude.CompareVersions("0.2.9", claude.MinVersion) != -1 {
+		t.Error("CompareVersions does not compare numerically")
+	}
+}
+
+// captureStderr redirects os.Stderr while fn runs and returns what was written.
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = orig }()
+	fn()
+	w.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+// TestExecuteRecordsClaudeVersion verifies that Execute writes the detected
+// version to claude_version.txt and the manifest, warns about an outdated
+// CLI, and still runs a CLI whose version output is garbage.
+func TestExecuteRecordsClaudeVersion(t *testing.T) {
+	tests := []struct {
+		name, versionOut, wantVersion string
+		wantWarning                   bool
+	}{
+		{"current", "1.0.38 (Claude Code)", "1.0.38", false},
+		{"outdated", "0.2.9 (Claude Code)", "0.2.9", true},
+		{"garbage", "Segmentation fault", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := fmt.Sprintf("#!/bin/sh\nif [ \"$1\" = --version ]; then echo '%s'; exit 0; fi\necho '{\"result\":\"ok\"}'\n", tt.versionOut)
+			bin := filepath.Join(t.TempDir(), "claude")
+			if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			jobDir := t.TempDir()
+			cfg := claude.Config{ClaudePath: bin, WorkDir: t.TempDir(), JobDir: jobDir}
+
+			var code int
+			var err error
+			stderr := captureStderr(t, func() { code, err = claude.Execute(cfg) })
+			if err != nil || code != 0 {
+				t.Fatalf("Execute = %d, %v; want 0, nil", code, err)
+			}
+
+			data, _ := os.ReadFile(filepath.Join(jobDir, claude.VersionFile))
+			if string(data) != tt.wantVersion {
+				t.Errorf("%s = %q, want %q", claude.VersionFile, data, tt.wantVersion)
+			}
+			if m, _ := job.ReadManifest(jobDir); m == nil || m.ClaudeVersion != tt.wantVersion {
+				t.Errorf("manifest claude_version = %+v, want %q", m, tt.wantVersion)
+			}
+			if got := strings.Contains(stderr, "warning: claude CLI "+tt.wantVersion+" is older than the minimum supported"); got != tt.wantWarning {
+				t.Errorf("stderr = %q, want warning %v", stderr, tt.wantWarning)
+			}
+		})
+	}
+}
+
+// TestBuildEnvNestingDepth verifies that BuildEnv passes cfg.Depth as
+// GLM_DEPTH, replacing an inherited value, and leaves the inherited value
+// alone when Depth is 0.
+func TestBuildEnvNestingDepth(t *testing.T) {
+	t.Setenv(claude.DepthEnv, "1")
+
+	env := claude.BuildEnv(claude.Config{Depth: 2})
+	var got []string
+	for _, kv := range env {
+		if strings.HasPrefix(kv, claude.DepthEnv+"=") {
+			got = append(got, kv)
+		}
+	}
+	if len(got) != 1 || got[0] != "GLM_DEPTH=2" {
+		t.Errorf("GLM_DEPTH entries = %v, want [GLM_DEPTH=2]", got)
+	}
+
+	if v := envMap(claude.BuildEnv(claude.Config{}))[claude.DepthEnv]; v != "1" {
+		t.Errorf("GLM_DEPTH with Depth 0 = %q, want the inherited 1", v)
+	}
+}
+
+// TestNestingDepth verifies that NestingDepth reads GLM_DEPTH and treats a
+// missing or invalid value as 0.
+func TestNestingDepth(t *testing.T) {
+	for value, want := range map[string]int{"": 0, "0": 0, "1": 1, "3": 3, "-2": 0, "deep": 0} {
+		t.Setenv(claude.DepthEnv, value)
+		if got := claude.NestingDepth(); got != want {
+			t.Errorf("NestingDepth() with GLM_DEPTH=%q = %d, want %d", value, got, want)
+		}
+	}
+}
+
+// TestExecuteIncrementsNestingDepth verifies that Execute runs claude with
+// GLM_DEPTH one above its own and records that depth in job.json.
+func TestExecuteIncrementsNestingDepth(t *testing.T) {
+	t.Setenv(claude.DepthEnv, "1")
+	bin := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n[ \"$1\" = --version ] && exit 0\necho \"$GLM_DEPTH\" > depth.txt\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	workDir, jobDir := t.TempDir(), t.TempDir()
+	if code, err := claude.Execute(claude.Config{ClaudePath: bin, WorkDir: workDir, JobDir: jobDir}); err != nil || code != 0 {
+		t.Fatalf("Execute = %d, %v; want 0, nil", code, err)
+	}
+	if got := readJobFile(t, workDir, "depth.txt"); strings.TrimSpace(got) != "2" {
+		t.Errorf("claude saw GLM_DEPTH=%q, want 2", got)
+	}
+	if m, _ := job.ReadManifest(jobDir); m == nil || m.Depth != 2 {
+		t.Errorf("manifest = %+v, want depth 2", m)
+	}
+}
+
+// TestParseRawJSONStripsANSI verifies that ParseRawJSON removes colors,
+// cursor movement and spinner frames from stdout.txt and changelog.txt,
+// leaves raw.json as claude wrote it, and keeps them with KeepANSI.
+func TestParseRawJSONStripsANSI(t *testing.T) {
+	jobDir := t.TempDir()
+	result := "\x1b]0;claude\x07\x1b[?25l⠋ Thinking\r⠙ Thinking\r\x1b[2K\x1b[1;32mDone:\x1b[0m fixed \x1b[4mmain.go\x1b[24m\n\x1b[1A\x1b[2Knext line\r\nend"
+	quoted, _ := json.Marshal(result)
+	raw := fmt.Sprintf(`{"type":"result","result":%s,"messages":[{"role":"assistant","content":[`+
+		`{"type":"tool_use","name":"Write","input":{"file_path":"\u001b[36mout.go\u001b[0m"}},`+
+		`{"type":"tool_use","name":"Bash","input":{"command":"rm \u001b[31mold.go\u001b[0m"}}]}]}`, quoted)
+	rawPath := filepath.Join(jobDir, "raw.json")
+	if err := os.WriteFile(rawPath, []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := claude.ParseRawJSON(jobDir); err != nil {
+		t.Fatalf("ParseRawJSON: %v", err)
+	}
+	if got, want := readJobFile(t, jobDir, "stdout.txt"), "Done: fixed main.go\nnext line\r\nend"; got != want {
+		t.Errorf("stdout.txt = %q, want %q", got, want)
+	}
+	if got := readJobFile(t, jobDir, "changelog.txt"); got != "WRITE out.go\nDELETE via bash: rm old.go" {
+		t.Errorf("changelog.txt = %q", got)
+	}
+	if got := readJobFile(t, jobDir, "raw.json"); got != raw {
+		t.Errorf("raw.json changed:\n%q", got)
+	}
+
+	if err := claude.ParseRawJSON(jobDir, &claude.ParseOptions{KeepANSI: true}); err != nil {
+		t.Fatalf("ParseRawJSON: %v", err)
+	}
+	if got := readJobFile(t, jobDir, "stdout.txt"); got != result {
+		t.Errorf("stdout.txt with KeepANSI = %q, want the result as is", got)
+	}
+	if got := readJobFile(t, jobDir, "changelog.txt"); !strings.Contains(got, "\x1b[36mout.go") {
+		t.Errorf("changelog.txt with KeepANSI = %q", got)
+	}
+}
+
+// TestBuildEnvDisablesTerminalStyling verifies that BuildEnv runs claude
+// with TERM=dumb and NO_COLOR=1, except for an interactive session.
+func TestBuildEnvDisablesTerminalStyling(t *testing.T) {
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("NO_COLOR", "")
+
+	env := envMap(claude.BuildEnv(claude.Config{}))
+	if env["TERM"] != "dumb" || env["NO_COLOR"] != "1" {
+		t.Errorf("TERM = %q, NO_COLOR = %q; want dumb, 1", env["TERM"], env["NO_COLOR"])
+	}
+	env = envMap(claude.BuildEnv(claude.Config{Interactive: true}))
+	if env["TERM"] != "xterm-256color" {
+		t.Errorf("TERM for an interactive session = %q, want the inherited xterm-256color", env["TERM"])
+	}
+}
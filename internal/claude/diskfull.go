@@ -0,0 +1,76 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// writeFile writes a job artifact (raw.json, stderr.txt, stdout.txt,
+// changelog.txt). Tests replace it to simulate a full disk.
+var writeFile = os.WriteFile
+
+// failJob marks the job in jobDir failed with note in its stderr.txt. Tests
+// replace it to simulate a disk too full for even that.
+var failJob = func(jobDir, note string) error {
+	return errors.Join(job.AppendStderr(jobDir, note), job.TransitionStatus(jobDir, job.StatusFailed))
+}
+
+// WriteError is a job artifact that could not be written, usually because
+// the filesystem holding the subagent dir is full. It prints as err:disk and
+// errs.ExitCode maps it to 74 (exitcode.DiskError); the write error itself
+// is reachable with errors.Is, e.g. for syscall.ENOSPC.
+type WriteError struct {
+	// File is the artifact that could not be written, such as "raw.json".
+	File string
+	// Err is the write error.
+	Err error
+	// Stdout is claude's result text (its raw output when that does not
+	// parse), so that the caller can still hand it to the user.
+	Stdout string
+	// Recorded reports whether the job was marked failed with a note in
+	// stderr.txt. When false the job directory shows nothing of the failure
+	// and Stdout is the only copy of claude's output.
+	Recorded bool
+}
+
+func (e *WriteError) Error() string {
+	return errs.Disk(`"Cannot write %s: %v"`, e.File, e.Err).Error()
+}
+
+func (e *WriteError) Unwrap() []error {
+	return []error{e.Err, errs.Disk("")}
+}
+
+// writeFailed returns the WriteError for file in jobDir and tries to fail
+// the job: a note in stderr.txt and status "failed" are small writes that
+// may still fit when the artifact did not. A job that already ended keeps
+// its status.
+func writeFailed(jobDir, file string, err error, stdout string) *WriteError {
+	e := &WriteError{File: file, Err: err, Stdout: stdout}
+	e.Recorded = failJob(jobDir, fmt.Sprintf("Cannot write %s: %v", file, err)) == nil
+	return e
+}
+
+// resultText returns the result text of claude's raw output, or the raw
+// output itself when it has none.
+func resultText(raw string) string {
+	doc, err := decodeRaw([]byte(raw))
+	if err != nil {
+		return raw
+	}
+	switch v := doc.(type) {
+	case map[string]any:
+		if result, ok := v["result"].(string); ok {
+			return result
+		}
+	case []any:
+		if result, ok := lastResultEvent(v); ok {
+			return result
+		}
+	}
+	return raw
+}
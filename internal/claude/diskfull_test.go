@@ -0,0 +1,93 @@
+package claude
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// TestDiskFullAtEachStage covers:
+//
+//	Scenario: an artifact write that fails with ENOSPC fails the job with a note in stderr.txt and returns a WriteError carrying claude's result (exit 74)
+//	Scenario: when the note and status cannot be written either, the WriteError says so and the job is left as it was
+func TestDiskFullAtEachStage(t *testing.T) {
+	origWrite, origFail := writeFile, failJob
+	t.Cleanup(func() { writeFile, failJob = origWrite, origFail })
+
+	bin := filepath.Join(t.TempDir(), "claude")
+	script := "#!/bin/sh\nif [ \"$1\" = --version ]; then echo '1.0.38 (Claude Code)'; exit 0; fi\necho '{\"result\":\"the answer\"}'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		full         string // the artifact whose write fails
+		noteFails    bool
+		wantExecCode int
+	}{
+		{full: "prompt.txt", wantExecCode: 74},
+		{full: "raw.json", wantExecCode: 74},
+		{full: "stderr.txt", wantExecCode: 74},
+		{full: "stdout.txt"},
+		{full: "changelog.txt"},
+		{full: "raw.json", noteFails: true, wantExecCode: 74},
+	}
+	for _, tt := range tests {
+		writeFile = func(name string, data []byte, perm fs.FileMode) error {
+			if filepath.Base(name) == tt.full {
+				return &fs.PathError{Op: "write", Path: name, Err: syscall.ENOSPC}
+			}
+			return os.WriteFile(name, data, perm)
+		}
+		failJob = origFail
+		if tt.noteFails {
+			failJob = func(string, string) error { return syscall.ENOSPC }
+		}
+
+		jobDir := t.TempDir()
+		if err := job.WriteStatus(jobDir, job.StatusRunning); err != nil {
+			t.Fatal(err)
+		}
+		code, err := Execute(Config{ClaudePath: bin, WorkDir: t.TempDir(), JobDir: jobDir})
+		if code != tt.wantExecCode {
+			t.Errorf("%s: Execute exit code = %d (%v), want %d", tt.full, code, err, tt.wantExecCode)
+		}
+		if err == nil {
+			err = ParseRawJSON(jobDir)
+		}
+
+		var we *WriteError
+		if !errors.As(err, &we) {
+			t.Errorf("%s: error = %v, want a *WriteError", tt.full, err)
+			continue
+		}
+		if we.File != tt.full || !errors.Is(err, syscall.ENOSPC) || errs.ExitCode(err) != 74 {
+			t.Errorf("%s: WriteError for %q, ENOSPC=%v, exit %d", tt.full, we.File, errors.Is(err, syscall.ENOSPC), errs.ExitCode(err))
+		}
+		if !strings.HasPrefix(err.Error(), `err:disk "Cannot write `+tt.full) {
+			t.Errorf("%s: error = %q, want err:disk", tt.full, err)
+		}
+		if tt.full != "prompt.txt" && we.Stdout != "the answer" {
+			t.Errorf("%s: Stdout = %q, want claude's result", tt.full, we.Stdout)
+		}
+
+		wantStatus := job.StatusFailed
+		if tt.noteFails {
+			wantStatus = job.StatusRunning
+		}
+		if we.Recorded == tt.noteFails || job.ReadStatus(jobDir) != wantStatus {
+			t.Errorf("%s: Recorded = %v, status %s; want status %s", tt.full, we.Recorded, job.ReadStatus(jobDir), wantStatus)
+		}
+		stderr, _ := os.ReadFile(filepath.Join(jobDir, "stderr.txt"))
+		if hasNote := strings.Contains(string(stderr), "Cannot write "+tt.full); hasNote != we.Recorded {
+			t.Errorf("%s: stderr.txt = %q, note present %v", tt.full, stderr, hasNote)
+		}
+	}
+}
@@ -1,24 +1,18 @@
 package claude
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 )
 
-// rawOutput is the top-level structure of the JSON emitted by claude --output-format json.
-type rawOutput struct {
-	Result   string        `json:"result"`
-	Messages []rawMessage  `json:"messages"`
-}
-
-type rawMessage struct {
-	Role    string       `json:"role"`
-	Content []rawContent `json:"content"`
-}
-
+// rawContent is a tool_use block: the tool's name and its raw input.
 type rawContent struct {
 	Type  string          `json:"type"`
 	Name  string          `json:"name"`
@@ -48,49 +42,226 @@ type notebookInput struct {
 	NotebookPath string `json:"notebook_path"`
 }
 
-// ParseRawJSON reads raw.json from jobDir, extracts the ".result" field into
-// stdout.txt, and calls GenerateChangelog to produce changelog.txt.
+// SessionIDFile records, in the job dir, the ID of the claude session the
+// job ran in, for "claude --resume". It is absent when raw.json carries no
+// session ID, as with older claude versions.
+const SessionIDFile = "session_id.txt"
+
+// ParseOptions holds optional ParseRawJSON settings.
+type ParseOptions struct {
+	// KeepANSI leaves ANSI escape sequences in stdout.txt and changelog.txt
+	// (strip_ansi = false); by default they are removed with StripANSI.
+	KeepANSI bool
+}
+
+// ansiRe matches ANSI escape sequences: CSI sequences such as colors, cursor
+// movement and line erasure, OSC sequences such as window titles, and the
+// remaining two-byte escapes.
+var ansiRe = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-_]`)
+
+// StripANSI returns s without ANSI escape sequences, as a claude that took
+// its output for a terminal writes them. A line redrawn with carriage
+// returns, as a spinner is, keeps only the text after the last one, which
+// is what a terminal would show; a CRLF line ending is kept.
+func StripANSI(s string) string {
+	if !strings.ContainsAny(s, "\x1b\r") {
+		return s
+	}
+	lines := strings.Split(ansiRe.ReplaceAllString(s, ""), "\n")
+	for i, line := range lines {
+		body, crlf := strings.CutSuffix(line, "\r")
+		if j := strings.LastIndexByte(body, '\r'); j >= 0 {
+			body = body[j+1:]
+		}
+		if crlf {
+			body += "\r"
+		}
+		lines[i] = body
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseRawJSON reads raw.json from jobDir, extracts the result text into
+// stdout.txt and the session ID into SessionIDFile, and calls
+// GenerateChangelog to produce changelog.txt.
+//
+// raw.json may hold a single result object (--output-format json), or a
+// sequence of events, either as a JSON array or one object per line
+// (--output-format stream-json); the last "result" event supplies the text.
+// tool_use blocks are collected from anywhere in the document, so changes
+// are found however a claude version nests its messages.
 //
-// Errors (malformed JSON, missing fields) are handled gracefully: stdout.txt
-// and changelog.txt are always written; a warning is logged to stderr.
-func ParseRawJSON(jobDir string) error {
+// The result text and the changelog are cleaned with StripANSI unless
+// ParseOptions.KeepANSI is set; raw.json itself is never changed.
+//
+// Errors (malformed JSON, unknown shapes) are handled gracefully: stdout.txt
+// and changelog.txt are always written; a warning is logged to stderr. An
+// artifact that cannot be written fails the job and returns a *WriteError
+// (see ExecuteContext).
+func ParseRawJSON(jobDir string, opts ...*ParseOptions) error {
+	o := &ParseOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
 	rawPath := filepath.Join(jobDir, "raw.json")
 	data, err := os.ReadFile(rawPath)
 	if err != nil {
 		return fmt.Errorf("read raw.json: %w", err)
 	}
 
-	var out rawOutput
-	if jsonErr := json.Unmarshal(data, &out); jsonErr != nil {
+	doc, jsonErr := decodeRaw(data)
+	if jsonErr != nil {
 		// Malformed JSON — warn and write empty files.
-		fmt.Fprintf(os.Stderr, "warning: malformed JSON in raw.json: %v\n", jsonErr)
-		if writeErr := os.WriteFile(filepath.Join(jobDir, "stdout.txt"), []byte(""), 0o644); writeErr != nil {
-			return writeErr
+		warnf("warning: malformed JSON in raw.json: %v\n", jsonErr)
+		if writeErr := writeFile(filepath.Join(jobDir, "stdout.txt"), []byte(""), 0o644); writeErr != nil {
+			return writeFailed(jobDir, "stdout.txt", writeErr, string(data))
+		}
+		if err := GenerateChangelog(jobDir, nil); err != nil {
+			return writeFailed(jobDir, "changelog.txt", err, string(data))
+		}
+		return nil
+	}
+
+	var result string
+	switch v := doc.(type) {
+	case map[string]any:
+		result, _ = v["result"].(string)
+	case []any:
+		var found bool
+		if result, found = lastResultEvent(v); !found {
+			warnf("warning: no result event in raw.json\n")
+		}
+	default:
+		warnf("warning: unrecognised raw.json format (%T)\n", doc)
+		doc = nil
+	}
+	if !o.KeepANSI {
+		result = StripANSI(result)
+	}
+
+	// Write stdout.txt from the result text.
+	if err := writeFile(filepath.Join(jobDir, "stdout.txt"), []byte(result), 0o644); err != nil {
+		return writeFailed(jobDir, "stdout.txt", err, result)
+	}
+	if id := sessionID(doc); id != "" {
+		if err := writeFile(filepath.Join(jobDir, SessionIDFile), []byte(id), 0o644); err != nil {
+			return writeFailed(jobDir, SessionIDFile, err, result)
+		}
+	}
+
+	if err := GenerateChangelog(jobDir, collectToolUses(doc, nil, map[string]bool{}), o); err != nil {
+		return writeFailed(jobDir, "changelog.txt", err, result)
+	}
+	return nil
+}
+
+// decodeRaw decodes raw.json. A file holding several JSON values (one event
+// per line) is returned as a []any of them. A truncated stream keeps the
+// events before the damage; a file with no complete value is an error.
+func decodeRaw(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var values []any
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(values) == 0 {
+				return nil, err
+			}
+			warnf("warning: truncated event stream in raw.json: %v\n", err)
+			break
 		}
-		return GenerateChangelog(jobDir, nil)
+		values = append(values, v)
+	}
+	switch len(values) {
+	case 0:
+		return nil, io.ErrUnexpectedEOF
+	case 1:
+		return values[0], nil
 	}
+	return values, nil
+}
 
-	// Write stdout.txt from .result.
-	if err := os.WriteFile(filepath.Join(jobDir, "stdout.txt"), []byte(out.Result), 0o644); err != nil {
-		return fmt.Errorf("write stdout.txt: %w", err)
+// lastResultEvent returns the text of the last {"type":"result"} event.
+func lastResultEvent(events []any) (string, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		ev, ok := events[i].(map[string]any)
+		if !ok || ev["type"] != "result" {
+			continue
+		}
+		result, _ := ev["result"].(string)
+		return result, true
 	}
+	return "", false
+}
 
-	// Collect tool_use entries from all messages.
-	var toolUses []rawContent
-	for _, msg := range out.Messages {
-		for _, c := range msg.Content {
-			if c.Type == "tool_use" {
-				toolUses = append(toolUses, c)
+// sessionID returns the "session_id" of a result object, or of the last
+// event that has one, and "" when there is none.
+func sessionID(doc any) string {
+	switch v := doc.(type) {
+	case map[string]any:
+		id, _ := v["session_id"].(string)
+		return id
+	case []any:
+		for i := len(v) - 1; i >= 0; i-- {
+			if id := sessionID(v[i]); id != "" {
+				return id
 			}
 		}
 	}
+	return ""
+}
 
-	return GenerateChangelog(jobDir, toolUses)
+// collectToolUses appends every {"type":"tool_use"} block in v to uses, in
+// document order for arrays and key order for objects. A block whose id was
+// already seen (stream events repeat messages) is skipped.
+func collectToolUses(v any, uses []rawContent, seen map[string]bool) []rawContent {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			uses = collectToolUses(item, uses, seen)
+		}
+	case map[string]any:
+		if v["type"] == "tool_use" {
+			if id, _ := v["id"].(string); id != "" {
+				if seen[id] {
+					return uses
+				}
+				seen[id] = true
+			}
+			name, _ := v["name"].(string)
+			input, _ := json.Marshal(v["input"])
+			return append(uses, rawContent{Type: "tool_use", Name: name, Input: input})
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			uses = collectToolUses(v[k], uses, seen)
+		}
+	}
+	return uses
 }
 
+// PlanChangelog is the changelog.txt of a job that ran in plan permission
+// mode and changed nothing: its output is a plan, not a no-op.
+const PlanChangelog = "PLAN (plan only, no changes applied)"
+
 // GenerateChangelog synthesises changelog.txt from a slice of tool_use content
-// blocks.  When toolUses is empty or nil it writes "(no file changes)".
-func GenerateChangelog(jobDir string, toolUses []rawContent) error {
+// blocks.  When toolUses is empty or nil it writes "(no file changes)", or
+// PlanChangelog when the job's permission_mode.txt is "plan". Paths and
+// commands are cleaned with StripANSI unless ParseOptions.KeepANSI is set.
+func GenerateChangelog(jobDir string, toolUses []rawContent, opts ...*ParseOptions) error {
+	clean := StripANSI
+	if len(opts) > 0 && opts[0] != nil && opts[0].KeepANSI {
+		clean = func(s string) string { return s }
+	}
 	var lines []string
 
 	for _, tu := range toolUses {
@@ -101,21 +272,21 @@ func GenerateChangelog(jobDir string, toolUses []rawContent) error {
 				continue
 			}
 			charCount := len(inp.NewString)
-			lines = append(lines, fmt.Sprintf("EDIT %s: %d chars", inp.FilePath, charCount))
+			lines = append(lines, fmt.Sprintf("EDIT %s: %d chars", clean(inp.FilePath), charCount))
 
 		case "Write":
 			var inp writeInput
 			if err := json.Unmarshal(tu.Input, &inp); err != nil {
 				continue
 			}
-			lines = append(lines, fmt.Sprintf("WRITE %s", inp.FilePath))
+			lines = append(lines, fmt.Sprintf("WRITE %s", clean(inp.FilePath)))
 
 		case "Bash":
 			var inp bashInput
 			if err := json.Unmarshal(tu.Input, &inp); err != nil {
 				continue
 			}
-			cmd := inp.Command
+			cmd := clean(inp.Command)
 			if len(cmd) > 80 {
 				cmd = cmd[:80]
 			}
@@ -130,18 +301,21 @@ func GenerateChangelog(jobDir string, toolUses []rawContent) error {
 			if err := json.Unmarshal(tu.Input, &inp); err != nil {
 				continue
 			}
-			lines = append(lines, fmt.Sprintf("NOTEBOOK %s", inp.NotebookPath))
+			lines = append(lines, fmt.Sprintf("NOTEBOOK %s", clean(inp.NotebookPath)))
 		}
 	}
 
 	var content string
 	if len(lines) == 0 {
 		content = "(no file changes)"
+		if mode, _ := os.ReadFile(filepath.Join(jobDir, "permission_mode.txt")); strings.TrimSpace(string(mode)) == "plan" {
+			content = PlanChangelog
+		}
 	} else {
 		content = strings.Join(lines, "\n")
 	}
 
-	return os.WriteFile(filepath.Join(jobDir, "changelog.txt"), []byte(content), 0o644)
+	return writeFile(filepath.Join(jobDir, "changelog.txt"), []byte(content), 0o644)
 }
 
 // isDeleteCommand reports whether a bash command is a delete/remove operation.
@@ -0,0 +1,88 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinVersion is the oldest claude CLI whose JSON output ParseRawJSON is known
+// to understand. Older versions still run, with a warning.
+const MinVersion = "1.0.0"
+
+// VersionFile records, in the job dir, the claude CLI version the job ran
+// with. It is absent when the version could not be determined.
+const VersionFile = "claude_version.txt"
+
+// versionTimeout bounds "claude --version".
+const versionTimeout = 5 * time.Second
+
+// versionRe matches the first dotted version number, e.g. "1.0.38" in
+// "1.0.38 (Claude Code)".
+var versionRe = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// versions caches Version by binary path for the life of the process.
+var versions sync.Map
+
+// Version returns the version reported by "<path> --version", running it at
+// most once per path per process. ok is false when the command fails or
+// prints no recognisable version.
+func Version(path string) (version string, ok bool) {
+	if v, cached := versions.Load(path); cached {
+		version = v.(string)
+		return version, version != ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err == nil {
+		version, _ = ParseVersion(string(out))
+	}
+	versions.Store(path, version)
+	return version, version != ""
+}
+
+// ParseVersion extracts the version number from claude --version output such
+// as "1.0.38 (Claude Code)" or "claude v2.1.0". ok is false when out holds no
+// version number.
+func ParseVersion(out string) (version string, ok bool) {
+	version = versionRe.FindString(out)
+	return version, version != ""
+}
+
+// CompareVersions compares two dotted version numbers numerically and returns
+// -1, 0 or +1. Missing components count as zero, so "1.0" equals "1.0.0".
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// VersionWarning returns a warning when version is older than MinVersion,
+// and "" otherwise, including for an unknown (empty) version.
+func VersionWarning(version string) string {
+	if version == "" || CompareVersions(version, MinVersion) >= 0 {
+		return ""
+	}
+	return fmt.Sprintf("claude CLI %s is older than the minimum supported %s; its output may not be parsed correctly", version, MinVersion)
+}
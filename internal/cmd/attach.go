@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/exitcode"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// defaultAttachPollInterval is how often AttachCmd checks the job files.
+const defaultAttachPollInterval = 500 * time.Millisecond
+
+// AttachOptions holds optional AttachCmd settings.
+type AttachOptions struct {
+	// PollInterval is how often the job files and status are checked
+	// (default 500ms).
+	PollInterval time.Duration
+	// Detach, when closed, makes AttachCmd stop following the job and return
+	// without touching it (wired to Ctrl-C by the CLI).
+	Detach <-chan struct{}
+}
+
+// AttachResult holds the outcome of an AttachCmd call.
+type AttachResult struct {
+	// Status is the job's status when AttachCmd returned.
+	Status string
+	// ExitCode is the job's mapped exit code once it is terminal, 0 after a
+	// detach, 1 on user error, 3 if not found.
+	ExitCode int
+	// Detached is true if AttachCmd returned because Detach was closed.
+	Detached bool
+}
+
+// AttachCmd follows a queued or running job until it finishes:
+//   - Streams stderr.txt to stderr and raw.json to stdout as they grow. Files
+//     that do not exist yet (a queued job) are waited for.
+//   - Returns once the job reaches a terminal status, after copying whatever
+//     was written last, with the job's exit code: the recorded exit code when
+//     there is one, otherwise 0 for done, 124 for timeout and 1 for any other
+//     terminal status.
+//   - A running job whose process has died is marked failed (see
+//     job.CheckJobPID) and ends the attach.
+//   - Returns err:user (exit 1) for a job that has already finished, pointing
+//     at glm result, and for a malformed or ambiguous jobID.
+//   - Returns exit code 3 with err:not_found if the job does not exist.
+//
+// Closing AttachOptions.Detach returns immediately with Detached set; the job
+// keeps running.
+func AttachCmd(subagentsRoot, currentProjectID, jobID string, stdout, stderr io.Writer, opts ...*AttachOptions) (*AttachResult, error) {
+	o := &AttachOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	interval := o.PollInterval
+	if interval <= 0 {
+		interval = defaultAttachPollInterval
+	}
+
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return &AttachResult{ExitCode: 1}, err
+	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return &AttachResult{ExitCode: 3}, errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+
+	status := string(job.ReadStatus(jobDir))
+	if terminalStatuses[status] {
+		return &AttachResult{Status: status, ExitCode: 1},
+			errs.User(`"Job %s already finished (status: %s); use glm result %s"`, jobID, status, jobID)
+	}
+
+	errTail := &fileTail{path: filepath.Join(jobDir, "stderr.txt"), w: stderr}
+	outTail := &fileTail{path: filepath.Join(jobDir, "raw.json"), w: stdout}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Read the status before copying so the final copy sees everything
+		// written before the job turned terminal.
+		status, _ = job.CheckJobPID(jobDir)
+		errTail.copy()
+		outTail.copy()
+		if terminalStatuses[status] {
+			return &AttachResult{Status: status, ExitCode: jobExitCode(jobDir, status)}, nil
+		}
+
+		select {
+		case <-o.Detach:
+			return &AttachResult{Status: status, Detached: true}, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobExitCode returns the exit code glm reports for a job that ended with
+// status: the code recorded in its manifest, or one derived from status. A
+// context_exceeded job exits exitcode.ContextExceeded as with glm run.
+func jobExitCode(jobDir, status string) int {
+	if job.Status(status) == job.StatusContextExceeded {
+		return exitcode.ContextExceeded
+	}
+	if m := job.LoadManifest(jobDir); m.ExitCode != nil {
+		return *m.ExitCode
+	}
+	switch job.Status(status) {
+	case job.StatusDone:
+		return 0
+	case job.StatusTimeout:
+		return 124
+	default:
+		return 1
+	}
+}
+
+// fileTail copies what has been appended to path since the last copy to w.
+// A missing file is treated as empty, and a file that shrinks (rewritten by
+// the job) is copied again from the start.
+type fileTail struct {
+	path   string
+	w      io.Writer
+	offset int64
+}
+
+func (t *fileTail) copy() {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() < t.offset {
+		t.offset = 0
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return
+	}
+	n, _ := io.Copy(t.w, f)
+	t.offset += n
+}
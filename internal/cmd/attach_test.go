@@ -0,0 +1,166 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// attachOpts polls fast enough for tests.
+func attachOpts(detach <-chan struct{}) *cmd.AttachOptions {
+	return &cmd.AttachOptions{PollInterval: 5 * time.Millisecond, Detach: detach}
+}
+
+// appendFile appends content to dir/name, creating it if needed.
+func appendFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Errorf("append %s: %v", name, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Errorf("append %s: %v", name, err)
+	}
+}
+
+// Scenario: Attach streams a growing stderr.txt and exits with the job's code
+func TestAttachStreamsStderrUntilTerminal(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-143205-a8f3b1c2"
+	j, err := job.NewJob(root, "proj", jobID)
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := job.WritePID(j.Dir, os.Getpid()); err != nil {
+		t.Fatalf("WritePID: %v", err)
+	}
+	if err := job.TransitionStatus(j.Dir, job.StatusRunning); err != nil {
+		t.Fatalf("TransitionStatus: %v", err)
+	}
+
+	// The job's last files are written after its status; wait for them
+	// before the temp dir is removed.
+	finished := make(chan struct{})
+	defer func() { <-finished }()
+	go func() {
+		defer close(finished)
+		for _, line := range []string{"step 1\n", "step 2\n", "step 3\n"} {
+			time.Sleep(20 * time.Millisecond)
+			appendFile(t, j.Dir, "stderr.txt", line)
+		}
+		appendFile(t, j.Dir, "raw.json", `{"result":"ok"}`)
+		_ = job.UpdateManifest(j.Dir, func(m *job.Manifest) { code := 124; m.ExitCode = &code })
+		_ = job.TransitionStatus(j.Dir, job.StatusTimeout)
+	}()
+
+	var stdout, stderr bytes.Buffer
+	result, err := cmd.AttachCmd(root, "proj", jobID, &stdout, &stderr, attachOpts(nil))
+	if err != nil {
+		t.Fatalf("AttachCmd: %v", err)
+	}
+	if got := stderr.String(); got != "step 1\nstep 2\nstep 3\n" {
+		t.Errorf("streamed stderr = %q", got)
+	}
+	if got := stdout.String(); got != `{"result":"ok"}` {
+		t.Errorf("streamed stdout = %q", got)
+	}
+	if result.Status != "timeout" || result.ExitCode != 124 || result.Detached {
+		t.Errorf("result = %+v, want timeout/124", result)
+	}
+}
+
+// Scenario: Attach to a queued job waits for its files and maps done to exit 0
+func TestAttachWaitsForQueuedJob(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-143205-b1c2d3e4"
+	j, err := job.NewJob(root, "other-proj", jobID)
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+
+	// The job's last files are written after its status; wait for them
+	// before the temp dir is removed.
+	finished := make(chan struct{})
+	defer func() { <-finished }()
+	go func() {
+		defer close(finished)
+		time.Sleep(30 * time.Millisecond)
+		_ = job.WritePID(j.Dir, os.Getpid())
+		_ = job.TransitionStatus(j.Dir, job.StatusRunning)
+		time.Sleep(30 * time.Millisecond)
+		appendFile(t, j.Dir, "stderr.txt", "warming up\n")
+		_ = job.TransitionStatus(j.Dir, job.StatusDone)
+	}()
+
+	// Looked up from another project, by a unique part of the ID.
+	var stdout, stderr bytes.Buffer
+	result, err := cmd.AttachCmd(root, "proj", "b1c2d3e4", &stdout, &stderr, attachOpts(nil))
+	if err != nil {
+		t.Fatalf("AttachCmd: %v", err)
+	}
+	if stderr.String() != "warming up\n" {
+		t.Errorf("streamed stderr = %q", stderr.String())
+	}
+	if result.Status != "done" || result.ExitCode != 0 {
+		t.Errorf("result = %+v, want done/0", result)
+	}
+}
+
+// Scenario: Detaching leaves the job running
+func TestAttachDetachLeavesJobRunning(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-143205-c2d3e4f5"
+	j, err := job.NewJob(root, "proj", jobID)
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	_ = job.WritePID(j.Dir, os.Getpid())
+	_ = job.TransitionStatus(j.Dir, job.StatusRunning)
+
+	detach := make(chan struct{})
+	time.AfterFunc(30*time.Millisecond, func() { close(detach) })
+
+	var stdout, stderr bytes.Buffer
+	result, err := cmd.AttachCmd(root, "proj", jobID, &stdout, &stderr, attachOpts(detach))
+	if err != nil {
+		t.Fatalf("AttachCmd: %v", err)
+	}
+	if !result.Detached || result.ExitCode != 0 {
+		t.Errorf("result = %+v, want detached with exit 0", result)
+	}
+	if got := job.ReadStatus(j.Dir); got != job.StatusRunning {
+		t.Errorf("status after detach = %s, want running", got)
+	}
+}
+
+// Scenario: Attach refuses finished jobs and points at glm result
+func TestAttachRefusesTerminalJobs(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-143205-d3e4f5a6"
+	makeJobDir(t, root, "proj", jobID, "done")
+
+	var stdout, stderr bytes.Buffer
+	result, err := cmd.AttachCmd(root, "proj", jobID, &stdout, &stderr, attachOpts(nil))
+	if err == nil {
+		t.Fatal("expected error for a finished job")
+	}
+	if !strings.HasPrefix(err.Error(), "err:user") || !strings.Contains(err.Error(), "glm result "+jobID) {
+		t.Errorf("error = %q", err)
+	}
+	if result.ExitCode != 1 {
+		t.Errorf("exit code = %d, want 1", result.ExitCode)
+	}
+
+	result, err = cmd.AttachCmd(root, "proj", "job-20260227-143205-00000000", &stdout, &stderr, attachOpts(nil))
+	if err == nil || !strings.Contains(err.Error(), "err:not_found") || result.ExitCode != 3 {
+		t.Errorf("missing job: result = %+v, err = %v", result, err)
+	}
+}
@@ -2,27 +2,121 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/exitcode"
 	"github.com/veschin/GoLeM/internal/job"
 )
 
 // ChainResult holds the outcome of a ChainCmd call.
 type ChainResult struct {
-	// FinalStdout is the stdout from the last executed step.
+	// FinalStdout is the output of the last executed group: its stdout for a
+	// single step, the combined stdouts for a parallel group.
 	FinalStdout string
-	// ExitCode is 0 if all steps succeeded, 1 if any step failed.
+	// ExitCode is 0 if all steps succeeded, 1 if any step failed, and
+	// exitcode.Timeout when the TotalTimeout budget ran out.
 	ExitCode int
 	// StepsExecuted is the count of steps that were actually run.
 	StepsExecuted int
 	// StepsSkipped is the count of steps that were not run (due to failure).
 	StepsSkipped int
+	// StepsReused is the count of steps taken over from the resumed chain.
+	StepsReused int
 	// JobDirs is the list of job directory paths for all executed steps.
 	JobDirs []string
+	// ChainID links the steps together; empty for single-prompt chains.
+	ChainID string
+	// Steps has one record per prompt, including steps that were skipped.
+	Steps []ChainStepResult
+	// BudgetExceeded is set when ChainFlags.TotalTimeout ran out before
+	// every step had run; the steps left were skipped.
+	BudgetExceeded bool
+	// Cleaned lists the job dirs of JobDirs that CleanIntermediate deleted.
+	Cleaned []string
+	// DryRun has the invocation of every step that would run with
+	// ChainFlags.DryRun; nothing ran then.
+	DryRun []DryRun
+}
+
+// ChainStepSkipped is the status reported for steps that never ran because
+// an earlier step failed or the chain's total timeout ran out.
+const ChainStepSkipped = "skipped"
+
+// ChainStepReused is the status reported for steps before --from whose
+// output was taken from the resumed chain instead of running them again.
+const ChainStepReused = "reused"
+
+// ChainStepResult is the per-step record of a chain run. Skipped steps have
+// no JobID, timing or output; reused steps carry the JobID and output of
+// the resumed chain's step. Group is set only in chains that have a
+// parallel group. The timing comes from the step job's started_at and
+// finished_at (see readJobTiming).
+type ChainStepResult struct {
+	Index           int    `json:"index"`
+	Group           int    `json:"group,omitempty"`
+	Name            string `json:"name,omitempty"`
+	JobID           string `json:"job_id,omitempty"`
+	Status          string `json:"status"`
+	StartedAt       string `json:"started_at,omitempty"`
+	FinishedAt      string `json:"finished_at,omitempty"`
+	DurationSeconds int    `json:"duration_seconds"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	Changelog       string `json:"changelog"`
+}
+
+// summary returns the record of r in a ChainSummary.
+func (r ChainStepResult) summary() ChainStepSummary {
+	return ChainStepSummary{
+		Step:            r.Index,
+		Group:           r.Group,
+		Name:            r.Name,
+		JobID:           r.JobID,
+		Status:          r.Status,
+		DurationSeconds: r.DurationSeconds,
+	}
+}
+
+// ChainJSONOutput is the object printed by "glm chain --json".
+type ChainJSONOutput struct {
+	ChainExitCode  int               `json:"chain_exit_code"`
+	BudgetExceeded bool              `json:"budget_exceeded,omitempty"`
+	Steps          []ChainStepResult `json:"steps"`
+}
+
+// ChainStepSummary describes one executed step in a chain summary file.
+type ChainStepSummary struct {
+	Step            int    `json:"step"`
+	Group           int    `json:"group,omitempty"`
+	Name            string `json:"name,omitempty"`
+	JobID           string `json:"job_id"`
+	Status          string `json:"status"`
+	DurationSeconds int    `json:"duration_seconds"`
+	// Cleaned is set once the step's job dir was deleted by
+	// --clean-intermediate.
+	Cleaned bool `json:"cleaned,omitempty"`
+}
+
+// ChainSummary is written to <project dir>/<chain ID>.json and lists the
+// chain's steps in execution order.
+type ChainSummary struct {
+	ChainID    string             `json:"chain_id"`
+	TotalSteps int                `json:"total_steps"`
+	Steps      []ChainStepSummary `json:"steps"`
 }
 
 // ChainFlags holds options specific to the chain subcommand.
@@ -31,130 +125,879 @@ type ChainFlags struct {
 	Flags *Flags
 	// ContinueOnError instructs the chain to keep running even when a step fails.
 	ContinueOnError bool
-	// Prompts is the ordered list of prompts to execute.
+	// Prompts is the ordered list of prompts to execute. It is used only when
+	// Groups is empty, as one single-step group per prompt.
 	Prompts []string
+	// Groups lists the chain's groups in order. The prompts of a group run in
+	// parallel; a group starts once the previous one has finished.
+	Groups [][]string
+	// Config is the loaded configuration the models of the steps are
+	// resolved against with the flags (see ResolveModels); nil has none.
+	Config *config.Config
+	// ContextLimit caps the output injected into the next group's prompts
+	// (chain_context_limit; 0 = no limit). Longer output is cut to its head
+	// and tail (see TruncateContext), or summarized with Summarize.
+	ContextLimit int
+	// Summarize, when set (--summarize-context), compresses output over
+	// ContextLimit before it is injected; a failed summary falls back to
+	// the cut.
+	Summarize SummarizeFunc
+	// AllowOverlap skips the OverlapCheck made before each group
+	// (--allow-overlap or allow_overlap = true).
+	AllowOverlap bool
+	// MaxParallel caps how many steps of one group run at once (max_parallel).
+	// Zero means no cap.
+	MaxParallel int
+	// JSON prints a ChainJSONOutput to stdout instead of the final stdout.
+	JSON bool
+	// Resume is the ID of an earlier run of the same chain whose completed
+	// steps are reused instead of run again.
+	Resume string
+	// From is the first step to run when resuming, as a step number or a
+	// step name. Empty means the resumed chain's first incomplete step.
+	From string
+	// Out is the output policy; its writers, when set, replace stdout and
+	// stderr, and with Out.Quiet the "Chain" and "[N/M]" progress lines are
+	// not printed. Nil prints everything.
+	Out *Out
+	// TotalTimeout is the wall-clock budget of the whole chain
+	// (--total-timeout; 0 = none). Each group's steps get the smaller of
+	// Flags.Timeout and what is left of it as their timeout; once nothing
+	// is left the remaining steps are skipped.
+	TotalTimeout time.Duration
+	// Now returns the current time TotalTimeout is measured with (nil =
+	// time.Now).
+	Now func() time.Time
+	// CleanIntermediate deletes the job dirs of every executed step but
+	// those of the last group once the chain succeeds
+	// (--clean-intermediate or chain_clean_intermediate). It is ignored
+	// with Resume.
+	CleanIntermediate bool
+	// Inject is what the next group's prompts get from the previous group
+	// (--inject): InjectStdout (also when empty), InjectChangelog,
+	// InjectBoth or InjectNone (see BuildChainPromptFor).
+	Inject string
+	// DryRun validates the chain and prints each step's claude invocation
+	// (see DryRun) instead of running it (--dry-run). The output of the
+	// previous group is injected as placeholder text.
+	DryRun bool
+	// Invocation is recorded in the job.json of every step (nil = none).
+	Invocation *job.Invocation
+	// ContextAsFile writes the output of the previous group into files in
+	// each step's job dir, as Inject selects it, and gives the step a short
+	// prompt pointing at them (--context-as-file; see
+	// BuildContextFilePrompt). The files hold the whole output, so
+	// ContextLimit does not apply; a step whose files cannot be written gets
+	// the output inline, cut to ContextLimit.
+	ContextAsFile bool
+}
+
+// The --inject modes of chain.
+const (
+	InjectStdout    = "stdout"
+	InjectChangelog = "changelog"
+	InjectBoth      = "both"
+	InjectNone      = "none"
+)
+
+// ParseInjectMode parses the --inject value of chain. It returns err:user
+// for anything but stdout, changelog, both or none.
+func ParseInjectMode(raw string) (string, error) {
+	switch raw {
+	case InjectStdout, InjectChangelog, InjectBoth, InjectNone:
+		return raw, nil
+	}
+	return "", errs.User(`"Invalid --inject value: %s (stdout, changelog, both or none)"`, raw)
+}
+
+// ParseTotalTimeout parses the --total-timeout value of chain: whole seconds
+// or a duration such as "90m". It returns err:user unless it is positive.
+func ParseTotalTimeout(raw string) (time.Duration, error) {
+	d, err := time.ParseDuration(raw)
+	if n, convErr := strconv.Atoi(raw); convErr == nil {
+		d, err = time.Duration(n)*time.Second, nil
+	}
+	if err != nil || d <= 0 {
+		return 0, errs.User(`"Invalid --total-timeout value: %s (seconds or a duration such as 90m)"`, raw)
+	}
+	return d, nil
+}
+
+// now returns the current time by cf.Now.
+func (cf *ChainFlags) now() time.Time {
+	if cf.Now != nil {
+		return cf.Now()
+	}
+	return time.Now()
+}
+
+// groups returns cf.Groups, or one group per prompt when it is empty.
+func (cf *ChainFlags) groups() [][]string {
+	if len(cf.Groups) > 0 {
+		return cf.Groups
+	}
+	groups := make([][]string, len(cf.Prompts))
+	for i, p := range cf.Prompts {
+		groups[i] = []string{p}
+	}
+	return groups
 }
 
-// ChainCmd executes a sequence of prompts as separate jobs, injecting the
-// previous job's stdout into the next prompt using the format:
+// chainStep is one prompt of a chain, numbered both across the whole chain
+// (step) and within its group, with its optional name, the model a step
+// prefix chose for it, the summary of its injected context, if any, and
+// with ChainFlags.ContextAsFile the files of that context.
+type chainStep struct {
+	step    int
+	group   int
+	label   string
+	name    string
+	model   string
+	raw     string
+	prompt  string
+	summary *contextSummary
+	files   []ContextFile
+}
+
+// stepNameRe matches a "name:prompt" step: a short lowercase name directly
+// followed by the prompt, so "Fix: the bug" and "http://..." stay prompts.
+var stepNameRe = regexp.MustCompile(`^([a-z][a-z0-9_-]{0,31}):([^\s/].*)$`)
+
+// SplitStepName splits a "name:prompt" chain argument into its name and
+// prompt. Arguments without a name return "" and the argument unchanged.
+func SplitStepName(arg string) (name, prompt string) {
+	m := stepNameRe.FindStringSubmatch(arg)
+	if m == nil {
+		return "", arg
+	}
+	return m[1], m[2]
+}
+
+// planChain numbers the steps of cf's groups, splits off their names and
+// applies their step prefixes (see ParseStepPrefix).
+func planChain(cf *ChainFlags) ([][]chainStep, error) {
+	groups := cf.groups()
+	plan := make([][]chainStep, len(groups))
+	stepNum := 0
+	for gi, group := range groups {
+		plan[gi] = make([]chainStep, len(group))
+		for si, arg := range group {
+			stepNum++
+			label := strconv.Itoa(gi + 1)
+			if len(group) > 1 {
+				label += "." + strconv.Itoa(si+1)
+			}
+			name, raw := SplitStepName(arg)
+			prefix, raw, err := ParseStepPrefix(raw)
+			if err != nil {
+				return nil, errs.User(`"Step %d: %s"`, stepNum, err.Error())
+			}
+			model := ResolveModels(cf.Config, cf.Flags, prefix).Exec.Model
+			plan[gi][si] = chainStep{step: stepNum, group: gi + 1, label: label, name: name, model: model, raw: raw}
+		}
+	}
+	return plan, nil
+}
+
+// StepPrefix is the "[key=value,...]" prefix of a chain prompt.
+type StepPrefix struct {
+	// Model runs the step with this model ("[model=glm-4.5]").
+	Model string
+	// Slot runs the step with the model of this slot: opus, sonnet or
+	// haiku ("[slot=haiku]").
+	Slot string
+}
+
+// ParseStepPrefix splits a leading "[key=value,...]" prefix off a chain
+// prompt, e.g. "[slot=haiku] summarise the logs". The keys are model and
+// slot, at most one of them. A prompt that starts with "[[" has no prefix and
+// loses one "[", so "[[WIP] fix it" is the prompt "[WIP] fix it".
+func ParseStepPrefix(prompt string) (StepPrefix, string, error) {
+	var p StepPrefix
+	if strings.HasPrefix(prompt, "[[") {
+		return p, prompt[1:], nil
+	}
+	if !strings.HasPrefix(prompt, "[") {
+		return p, prompt, nil
+	}
+	end := strings.Index(prompt, "]")
+	if end < 0 {
+		return p, "", fmt.Errorf("prefix has no closing ]; write [[ for a prompt that starts with [")
+	}
+	body := prompt[1:end]
+	for _, pair := range strings.Split(body, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return p, "", fmt.Errorf("prefix [%s] needs key=value, e.g. [model=glm-4.5]; write [[ for a prompt that starts with [", body)
+		}
+		switch key {
+		case "model":
+			p.Model = value
+		case "slot":
+			if value != "opus" && value != "sonnet" && value != "haiku" {
+				return p, "", fmt.Errorf("unknown slot %s in prefix [%s] (opus, sonnet or haiku)", value, body)
+			}
+			p.Slot = value
+		default:
+			return p, "", fmt.Errorf("unknown key %s in prefix [%s] (model or slot)", key, body)
+		}
+	}
+	if p.Model != "" && p.Slot != "" {
+		return p, "", fmt.Errorf("prefix [%s] sets both model and slot", body)
+	}
+	return p, strings.TrimLeft(prompt[end+1:], " \t"), nil
+}
+
+// SlotModel returns the model of slot ("opus", "sonnet" or "haiku"): its
+// flag, else -m, else the configured model (see ResolveModels).
+func (cf *ChainFlags) SlotModel(slot string) string {
+	return ResolveModels(cf.Config, cf.Flags, StepPrefix{}).Slot(slot).Model
+}
+
+// ChainCmd executes groups of prompts as separate jobs. The prompts of a group
+// run in parallel, and every prompt of the next group gets the group's output
+// injected using the format:
 //
 //	"Previous agent result:\n{stdout}\n\nYour task:\n{prompt}"
 //
-// Progress is written to stderr as "[N/M] Running step N...".
-// By default the chain stops at the first failure. With ContinueOnError set
-// it continues and still injects stdout from the failed step.
+// A single-step group's output is its stdout; a larger group's output is the
+// steps' stdouts joined under "=== Step G.S ===" headers. cf.Inject injects
+// the group's changelogs, joined the same way, instead of or after it, or
+// nothing (see BuildChainPromptFor). A prompt given as
+// "name:prompt" names its step (see SplitStepName), and a "[model=M]" or
+// "[slot=S]" prefix on the prompt picks the model of that step alone (see
+// ParseStepPrefix); neither ends up in prompt.txt or the injected prompt.
+// Stdout over cf.ContextLimit is cut or summarized before it is injected
+// (see fitChainContext); the steps' stdout.txt files keep all of it, and a
+// step that got a summary records it in ContextSummaryPromptFile and
+// ContextSummaryFile.
+//
+// Before each group the workdir is checked against running jobs (see
+// OverlapCheck) unless cf.AllowOverlap is set; the chain's own steps do not
+// count.
+//
+// Progress is written to stderr as "[N/M] Running step N...", where M counts
+// groups and N is "G" for a single-step group or "G.S" for step S of group G,
+// and "[N/M] <status> in <duration>" once the step ended, unless cf.Out is
+// quiet. A chain with a chain ID then ends with a table of every step, its
+// job ID, status and duration (see chainTable).
+// On success the last group's output is printed to stdout, or a
+// ChainJSONOutput with every step's record when JSON is set.
+// By default the chain stops after the first group with a failed step. With
+// ContinueOnError set it continues and still injects output from failed steps.
 // The final exit code is 0 only when all steps succeed; 1 if any step failed.
+//
+// With TotalTimeout set, each group's steps run with the smaller of the step
+// timeout and the budget left (recorded in their timeout file), and the
+// progress lines show what is left. A group that would start with no budget
+// left is skipped along with the rest of the chain; the result then has
+// BudgetExceeded set and exit code exitcode.Timeout.
+//
+// With Resume set, the steps before From are not run: their records and
+// stdout come from the resumed chain (status ChainStepReused), which must
+// have completed them. The first executed step gets their output injected
+// as usual.
+//
+// Chains with more than one prompt get a chain ID: every step's job dir
+// records it in chain.txt, and a ChainSummary is kept up to date in
+// <project dir>/<chain ID>.json.
+//
+// With CleanIntermediate set, a chain that exits 0 deletes the job dirs of
+// its steps before the last group, and its summary marks them cleaned; a
+// chain that fails keeps them all. The reused steps of a resumed chain
+// belong to the earlier run, so with Resume a warning is printed and
+// nothing is deleted.
+//
+// With ContextAsFile set, the output of the previous group goes to files in
+// the ContextDir of each step's job dir instead of into its prompt, which
+// only points at them (see ChainFlags.ContextAsFile).
+//
+// With DryRun set, no job is created: the steps that would run are written
+// to stdout as DryRun text blocks, or a ChainDryRun with JSON.
 func ChainCmd(cf *ChainFlags, subagentsRoot, projectID string, stdout, stderr io.Writer) (*ChainResult, error) {
-	prompts := cf.Prompts
-	total := len(prompts)
+	// Steps of a group report progress concurrently.
+	out := resolveOut(cf.Out, stdout, stderr)
+	out.Stderr = &lockedWriter{w: out.Stderr}
+	stdout, stderr = out.Stdout, out.Stderr
 
-	result := &ChainResult{
-		JobDirs: make([]string, 0, total),
+	groups := cf.groups()
+	plan, err := planChain(cf)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	grouped := false
+	for _, g := range groups {
+		total += len(g)
+		grouped = grouped || len(g) > 1
 	}
 
-	prevStdout := ""
-	anyFailed := false
-
-	for i, rawPrompt := range prompts {
-		stepNum := i + 1
-
-		// Print progress to stderr.
-		fmt.Fprintf(stderr, "[%d/%d] Running step %d...\n", stepNum, total, stepNum)
+	clean := cf.CleanIntermediate
+	if clean && cf.Resume != "" {
+		fmt.Fprintf(stderr, "warning: --clean-intermediate is ignored with --resume: chain %s still needs its step dirs\n", cf.Resume)
+		clean = false
+	}
 
-		// Build the prompt for this step.
-		var prompt string
-		if i == 0 {
-			prompt = rawPrompt
-		} else {
-			prompt = BuildChainPrompt(prevStdout, rawPrompt)
+	from := 1
+	var reused map[int]ChainStepResult
+	if cf.Resume != "" || cf.From != "" {
+		if from, reused, err = resolveResume(cf, subagentsRoot, projectID, plan, total); err != nil {
+			return nil, err
 		}
+	}
 
-		// Generate a unique job ID and create the job directory.
-		jobID := job.GenerateJobID()
-		j, err := job.NewJob(subagentsRoot, projectID, jobID)
+	if cf.DryRun {
+		if err := OverlapCheck(subagentsRoot, cf.Flags.Dir, &OverlapOptions{AllowOverlap: cf.AllowOverlap}); err != nil {
+			return nil, err
+		}
+		runs, err := chainDryRun(cf, plan, from)
 		if err != nil {
-			return nil, fmt.Errorf("chain step %d: create job: %w", stepNum, err)
+			return nil, err
 		}
-		jobDir := j.Dir
-
-		// Write prompt.txt.
-		if err := os.WriteFile(filepath.Join(jobDir, "prompt.txt"), []byte(prompt), 0o644); err != nil {
-			return nil, fmt.Errorf("chain step %d: write prompt.txt: %w", stepNum, err)
+		if cf.JSON {
+			if err := JSONOutput(stdout, ChainDryRun{Steps: runs}); err != nil {
+				return nil, err
+			}
+		} else {
+			for i, d := range runs {
+				if i > 0 {
+					fmt.Fprintln(stdout)
+				}
+				fmt.Fprint(stdout, d.Text())
+			}
 		}
+		return &ChainResult{DryRun: runs}, nil
+	}
+
+	result := &ChainResult{
+		JobDirs: make([]string, 0, total),
+		Steps:   make([]ChainStepResult, 0, total),
+	}
+
+	var summary *ChainSummary
+	if total > 1 {
+		result.ChainID = job.GenerateChainID()
+		summary = &ChainSummary{ChainID: result.ChainID, TotalSteps: total, Steps: []ChainStepSummary{}}
+		out.Progressf("Chain %s: %d steps\n", result.ChainID, total)
+	}
+
+	prevStdout, prevChangelog := "", ""
+	var prevFiles, lastDirs []string
+	anyFailed := false
+	started := cf.now()
 
-		// Write workdir file.
-		workdir := cf.Flags.Dir
-		if err := os.WriteFile(filepath.Join(jobDir, "workdir"), []byte(workdir), 0o644); err != nil {
-			return nil, fmt.Errorf("chain step %d: write workdir: %w", stepNum, err)
+	// skipRest records every step of rest as skipped.
+	skipRest := func(rest [][]chainStep) {
+		for _, steps := range rest {
+			for _, st := range steps {
+				skipped := ChainStepResult{Index: st.step, Name: st.name, Status: ChainStepSkipped}
+				if grouped {
+					skipped.Group = st.group
+				}
+				result.Steps = append(result.Steps, skipped)
+				result.StepsSkipped++
+			}
 		}
+	}
 
-		// Write timeout file.
-		timeoutStr := strconv.Itoa(cf.Flags.Timeout)
-		if err := os.WriteFile(filepath.Join(jobDir, "timeout"), []byte(timeoutStr), 0o644); err != nil {
-			return nil, fmt.Errorf("chain step %d: write timeout: %w", stepNum, err)
+	for gi, steps := range plan {
+		context, contextSum := prevStdout, (*contextSummary)(nil)
+		injectStdout := cf.Inject == "" || cf.Inject == InjectStdout || cf.Inject == InjectBoth
+		if gi > 0 && steps[0].step >= from && injectStdout {
+			if cf.ContextAsFile {
+				// Only for a step whose context files cannot be written.
+				context = TruncateContext(prevStdout, cf.ContextLimit, prevFiles)
+			} else {
+				context, contextSum = fitChainContext(cf, out, prevStdout, prevFiles, stderr)
+			}
+		}
+		for si := range steps {
+			steps[si].prompt = steps[si].raw
+			if gi > 0 {
+				steps[si].prompt = BuildChainPromptFor(cf.Inject, context, prevChangelog, steps[si].raw)
+				steps[si].summary = contextSum
+				if cf.ContextAsFile {
+					steps[si].files = chainContextFiles(cf.Inject, prevStdout, prevChangelog)
+				}
+			}
 		}
 
-		// Write model file.
-		if err := os.WriteFile(filepath.Join(jobDir, "model"), []byte(cf.Flags.Model), 0o644); err != nil {
-			return nil, fmt.Errorf("chain step %d: write model: %w", stepNum, err)
+		if steps[0].step < from {
+			outputs := make([]string, len(steps))
+			changelogs := make([]string, len(steps))
+			prevFiles = prevFiles[:0]
+			for si, st := range steps {
+				out.Progressf("[%s/%d] Reusing step %s from %s\n", st.label, len(groups), stepTitle(st), cf.Resume)
+				rec := reused[st.step]
+				if st.name != "" {
+					rec.Name = st.name
+				}
+				if grouped {
+					rec.Group = st.group
+				}
+				outputs[si] = rec.Stdout
+				changelogs[si] = rec.Changelog
+				prevFiles = append(prevFiles, filepath.Join(subagentsRoot, projectID, rec.JobID, "stdout.txt"))
+				result.Steps = append(result.Steps, rec)
+				result.StepsReused++
+				if summary != nil {
+					summary.Steps = append(summary.Steps, rec.summary())
+				}
+			}
+			prevStdout = groupOutput(steps, outputs)
+			prevChangelog = groupOutput(steps, changelogs)
+			continue
 		}
 
-		// Execute the step: simulate execution by checking if workdir exists.
-		stepExitCode := 0
-		stepStdout := ""
+		timeout, budget := cf.Flags.Timeout, ""
+		if cf.TotalTimeout > 0 {
+			left := cf.TotalTimeout - cf.now().Sub(started)
+			if left <= 0 {
+				out.Progressf("Chain total timeout of %s used up; skipping the remaining steps\n", cf.TotalTimeout)
+				result.BudgetExceeded = true
+				skipRest(plan[gi:])
+				break
+			}
+			if secs := int(math.Ceil(left.Seconds())); timeout <= 0 || secs < timeout {
+				timeout = secs
+			}
+			budget = fmt.Sprintf(" (%s of total timeout left)", left.Round(time.Second))
+		}
 
-		if workdir != "." {
-			if _, statErr := os.Stat(workdir); os.IsNotExist(statErr) {
-				// Directory not found — this step fails.
-				stepExitCode = 1
-				errMsg := fmt.Sprintf(`err:user "Directory not found: %s"`, workdir)
-				fmt.Fprintln(stderr, errMsg)
+		if err := OverlapCheck(subagentsRoot, cf.Flags.Dir, &OverlapOptions{AllowOverlap: cf.AllowOverlap, ChainID: result.ChainID}); err != nil {
+			return nil, err
+		}
 
-				// Write failed status and empty stdout.
-				_ = os.WriteFile(filepath.Join(jobDir, "stdout.txt"), []byte(""), 0o644)
-				_ = os.WriteFile(filepath.Join(jobDir, "status"), []byte(job.StatusFailed), 0o644)
+		records := make([]ChainStepResult, len(steps))
+		dirs := make([]string, len(steps))
+		stepErrs := make([]error, len(steps))
+		limit := cf.MaxParallel
+		if limit <= 0 || limit > len(steps) {
+			limit = len(steps)
+		}
+		sem := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for si, st := range steps {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				out.Progressf("[%s/%d] Running step %s...%s\n", st.label, len(groups), stepTitle(st), budget)
+				dirs[si], records[si], stepErrs[si] = runChainStep(cf, subagentsRoot, projectID, result.ChainID, total, timeout, st, stderr)
+				if stepErrs[si] == nil {
+					out.Progressf("[%s/%d] %s in %s\n", st.label, len(groups), records[si].Status, formatSeconds(records[si].DurationSeconds))
+				}
+			}()
+		}
+		wg.Wait()
+		for _, err := range stepErrs {
+			if err != nil {
+				return nil, err
 			}
 		}
 
-		if stepExitCode == 0 {
-			// Step succeeded: write done status and empty stdout.
-			_ = os.WriteFile(filepath.Join(jobDir, "stdout.txt"), []byte(stepStdout), 0o644)
-			_ = os.WriteFile(filepath.Join(jobDir, "status"), []byte(job.StatusDone), 0o644)
+		groupFailed := false
+		outputs := make([]string, len(steps))
+		changelogs := make([]string, len(steps))
+		prevFiles = prevFiles[:0]
+		for si, rec := range records {
+			if grouped {
+				rec.Group = steps[si].group
+			}
+			outputs[si] = rec.Stdout
+			changelogs[si] = rec.Changelog
+			prevFiles = append(prevFiles, filepath.Join(dirs[si], "stdout.txt"))
+			result.JobDirs = append(result.JobDirs, dirs[si])
+			result.Steps = append(result.Steps, rec)
+			result.StepsExecuted++
+			if rec.Status != string(job.StatusDone) {
+				groupFailed = true
+			}
+			if summary != nil {
+				summary.Steps = append(summary.Steps, rec.summary())
+			}
+		}
+		if summary != nil {
+			if err := writeChainSummary(filepath.Join(subagentsRoot, projectID), summary); err != nil {
+				return nil, fmt.Errorf("chain group %d: write summary: %w", gi+1, err)
+			}
 		}
 
-		// Read back stdout from the job dir for injection into the next step.
-		stdoutData, _ := os.ReadFile(filepath.Join(jobDir, "stdout.txt"))
-		prevStdout = string(stdoutData)
-
-		// Track results.
-		result.JobDirs = append(result.JobDirs, jobDir)
-		result.StepsExecuted++
+		prevStdout = groupOutput(steps, outputs)
+		prevChangelog = groupOutput(steps, changelogs)
+		result.FinalStdout = prevStdout
+		lastDirs = dirs
 
-		if stepExitCode != 0 {
+		if groupFailed {
 			anyFailed = true
 			if !cf.ContinueOnError {
-				// Stop chain; remaining steps are skipped.
-				result.StepsSkipped = total - stepNum
+				// Stop chain; remaining groups are skipped.
+				skipRest(plan[gi+1:])
 				break
 			}
 		}
 	}
 
-	// Set FinalStdout from the last executed step.
-	if len(result.JobDirs) > 0 {
-		lastDir := result.JobDirs[len(result.JobDirs)-1]
-		stdoutData, _ := os.ReadFile(filepath.Join(lastDir, "stdout.txt"))
-		result.FinalStdout = string(stdoutData)
-	}
-
 	// Determine final exit code.
 	if anyFailed || cf.ContinueOnError {
 		result.ExitCode = 1
 	}
+	if result.BudgetExceeded {
+		result.ExitCode = exitcode.Timeout
+	}
+
+	if clean && result.ExitCode == 0 {
+		if err := cleanIntermediate(result, summary, lastDirs, filepath.Join(subagentsRoot, projectID)); err != nil {
+			return nil, err
+		}
+		if len(result.Cleaned) > 0 {
+			out.Progressf("Cleaned %d intermediate step dirs\n", len(result.Cleaned))
+		}
+	}
+
+	if summary != nil {
+		out.Progressf("%s", chainTable(result.Steps))
+	}
+
+	if cf.JSON {
+		if err := JSONOutput(stdout, ChainJSONOutput{ChainExitCode: result.ExitCode, BudgetExceeded: result.BudgetExceeded, Steps: result.Steps}); err != nil {
+			return nil, err
+		}
+	} else if result.FinalStdout != "" {
+		fmt.Fprint(stdout, result.FinalStdout)
+	}
 
 	return result, nil
 }
 
+// cleanIntermediate deletes the job dirs of result.JobDirs that are not in
+// keep, records them in result.Cleaned and marks their steps cleaned in
+// summary, if any.
+func cleanIntermediate(result *ChainResult, summary *ChainSummary, keep []string, projectDir string) error {
+	cleaned := map[string]bool{}
+	for _, dir := range result.JobDirs {
+		if slices.Contains(keep, dir) {
+			continue
+		}
+		if err := job.DeleteJob(dir); err != nil {
+			return fmt.Errorf("clean chain step %s: %w", filepath.Base(dir), err)
+		}
+		result.Cleaned = append(result.Cleaned, dir)
+		cleaned[filepath.Base(dir)] = true
+	}
+	if summary == nil || len(cleaned) == 0 {
+		return nil
+	}
+	for i := range summary.Steps {
+		if cleaned[summary.Steps[i].JobID] {
+			summary.Steps[i].Cleaned = true
+		}
+	}
+	if err := writeChainSummary(projectDir, summary); err != nil {
+		return fmt.Errorf("clean chain: write summary: %w", err)
+	}
+	return nil
+}
+
+// runChainStep creates the job for st with timeout (in seconds), executes it
+// and returns its job dir and record.
+func runChainStep(cf *ChainFlags, subagentsRoot, projectID, chainID string, total, timeout int, st chainStep, stderr io.Writer) (string, ChainStepResult, error) {
+	// Generate a unique job ID and create the job directory.
+	j, err := job.NewJob(subagentsRoot, projectID, job.GenerateJobID())
+	if err != nil {
+		return "", ChainStepResult{}, fmt.Errorf("chain step %s: create job: %w", st.label, err)
+	}
+	jobID := j.ID
+	jobDir := j.Dir
+	stepStart := time.Now()
+	startedAt := job.FormatTimestamp(stepStart)
+	_ = os.WriteFile(filepath.Join(jobDir, "started_at.txt"), []byte(startedAt), 0o644)
+	err = job.UpdateManifest(jobDir, func(m *job.Manifest) {
+		m.StartedAt = startedAt
+		m.Invocation = cf.Invocation
+	})
+	if err != nil {
+		return "", ChainStepResult{}, fmt.Errorf("chain step %s: write %s: %w", st.label, job.ManifestFile, err)
+	}
+
+	if chainID != "" {
+		if err := job.WriteChainInfo(jobDir, chainID, st.step, total); err != nil {
+			return "", ChainStepResult{}, fmt.Errorf("chain step %s: write %s: %w", st.label, job.ChainFile, err)
+		}
+	}
+
+	if len(st.files) > 0 {
+		if paths, err := WriteContextFiles(jobDir, st.files); err != nil {
+			fmt.Fprintf(stderr, "warning: step %s: cannot write the context files, injecting the output inline: %v\n", st.label, err)
+		} else {
+			st.prompt = BuildContextFilePrompt("the previous step", paths, st.raw)
+		}
+	}
+
+	// Write prompt.txt.
+	if err := os.WriteFile(filepath.Join(jobDir, "prompt.txt"), []byte(st.prompt), 0o644); err != nil {
+		return "", ChainStepResult{}, fmt.Errorf("chain step %s: write prompt.txt: %w", st.label, err)
+	}
+	if err := writeContextSummary(jobDir, st.summary); err != nil {
+		return "", ChainStepResult{}, fmt.Errorf("chain step %s: write context summary: %w", st.label, err)
+	}
+
+	// Write workdir file.
+	workdir := cf.Flags.Dir
+	if err := os.WriteFile(filepath.Join(jobDir, "workdir"), []byte(workdir), 0o644); err != nil {
+		return "", ChainStepResult{}, fmt.Errorf("chain step %s: write workdir: %w", st.label, err)
+	}
+
+	// Write timeout file.
+	timeoutStr := strconv.Itoa(timeout)
+	if err := os.WriteFile(filepath.Join(jobDir, "timeout"), []byte(timeoutStr), 0o644); err != nil {
+		return "", ChainStepResult{}, fmt.Errorf("chain step %s: write timeout: %w", st.label, err)
+	}
+
+	// Write model file: the step's execution model (see ResolveModels).
+	if err := os.WriteFile(filepath.Join(jobDir, "model"), []byte(st.model), 0o644); err != nil {
+		return "", ChainStepResult{}, fmt.Errorf("chain step %s: write model: %w", st.label, err)
+	}
+	if injected := st.prompt != st.raw; cf.Flags.Priority != "" || injected {
+		err := job.UpdateManifest(jobDir, func(m *job.Manifest) {
+			m.Priority = cf.Flags.Priority
+			m.ChainInjected = injected
+		})
+		if err != nil {
+			return "", ChainStepResult{}, fmt.Errorf("chain step %s: write %s: %w", st.label, job.ManifestFile, err)
+		}
+	}
+
+	// Execute the step: simulate execution by checking if workdir exists.
+	stepExitCode := 0
+	stepStdout := ""
+
+	if workdir != "." {
+		if _, statErr := os.Stat(workdir); os.IsNotExist(statErr) {
+			// Directory not found — this step fails.
+			stepExitCode = 1
+			errMsg := errs.User(`"Directory not found: %s"`, workdir).Error()
+			fmt.Fprintln(stderr, errMsg)
+
+			// Write failed status and empty stdout.
+			_ = os.WriteFile(filepath.Join(jobDir, "stdout.txt"), []byte(""), 0o644)
+			_ = job.WriteStatus(jobDir, job.StatusFailed)
+		}
+	}
+
+	if stepExitCode == 0 {
+		// Step succeeded: write done status and empty stdout.
+		_ = os.WriteFile(filepath.Join(jobDir, "stdout.txt"), []byte(stepStdout), 0o644)
+		_ = job.WriteStatus(jobDir, job.StatusDone)
+	}
+
+	claude.WriteFinishedAt(jobDir)
+	if cf.Config != nil && cf.Config.MetricsEnabled {
+		if err := RecordJobMetrics(MetricsPath(cf.Config.ConfigDir), jobDir, st.model, stepExitCode); err != nil {
+			fmt.Fprintf(stderr, "warning: cannot record job metrics: %v\n", err)
+		}
+	}
+
+	// Read back stdout from the job dir for injection into the next group.
+	stdoutData, _ := os.ReadFile(filepath.Join(jobDir, "stdout.txt"))
+	stepStderr, _ := os.ReadFile(filepath.Join(jobDir, "stderr.txt"))
+	stepChangelog, _ := os.ReadFile(filepath.Join(jobDir, "changelog.txt"))
+	m := job.LoadManifest(jobDir)
+	status := string(job.ReadStatus(jobDir))
+	rec := ChainStepResult{
+		Index:      st.step,
+		Name:       st.name,
+		JobID:      jobID,
+		Status:     status,
+		StartedAt:  m.StartedAt,
+		FinishedAt: m.FinishedAt,
+		Stdout:     string(stdoutData),
+		Stderr:     string(stepStderr),
+		Changelog:  string(stepChangelog),
+	}
+	if t := readJobTiming(jobDir, m, status, time.Now()); t.DurationSeconds != nil {
+		rec.DurationSeconds = *t.DurationSeconds
+	} else {
+		rec.DurationSeconds = int(time.Since(stepStart).Round(time.Second) / time.Second)
+	}
+	return jobDir, rec, nil
+}
+
+// chainTable returns the table of steps printed at the end of a chain: one
+// row per step with its job ID, status and duration. Skipped steps have
+// neither job ID nor duration.
+func chainTable(steps []ChainStepResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s  %-44s  %-18s  %s\n", "STEP", "JOB_ID", "STATUS", "DURATION")
+	for _, s := range steps {
+		step := strconv.Itoa(s.Index)
+		if s.Name != "" {
+			step += " (" + s.Name + ")"
+		}
+		jobID, duration := "-", "-"
+		if s.JobID != "" {
+			jobID, duration = s.JobID, formatSeconds(s.DurationSeconds)
+		}
+		fmt.Fprintf(&b, "%-16s  %-44s  %-18s  %s\n", step, jobID, s.Status, duration)
+	}
+	return b.String()
+}
+
+// formatSeconds formats a duration in whole seconds as time.Duration does
+// ("47s", "2m5s").
+func formatSeconds(secs int) string {
+	return (time.Duration(secs) * time.Second).String()
+}
+
+// groupOutput returns the output a group passes on to the next one.
+func groupOutput(steps []chainStep, outputs []string) string {
+	if len(steps) == 1 {
+		return outputs[0]
+	}
+	return combineGroupStdout(steps, outputs)
+}
+
+// stepTitle names st in progress lines: its label, followed by its name in
+// parentheses when it has one.
+func stepTitle(st chainStep) string {
+	if st.name == "" {
+		return st.label
+	}
+	return st.label + " (" + st.name + ")"
+}
+
+// resolveResume finds the first step to run when resuming cf.Resume and
+// loads the records of the steps before it from the resumed chain's summary
+// and job dirs. The resumed chain must have the same number of steps, every
+// step before the returned one must have completed, and that step must start
+// a group.
+func resolveResume(cf *ChainFlags, subagentsRoot, projectID string, plan [][]chainStep, total int) (int, map[int]ChainStepResult, error) {
+	if cf.Resume == "" {
+		return 0, nil, errs.User(`"--from requires --resume CHAIN_ID"`)
+	}
+	if err := job.ValidateChainID(cf.Resume); err != nil {
+		return 0, nil, err
+	}
+	projectDir := filepath.Join(subagentsRoot, projectID)
+	data, err := os.ReadFile(ChainSummaryPath(projectDir, cf.Resume))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, errs.NotFound(`"Chain not found: %s"`, cf.Resume)
+		}
+		return 0, nil, fmt.Errorf("read chain %s: %w", cf.Resume, err)
+	}
+	var prior ChainSummary
+	if err := json.Unmarshal(data, &prior); err != nil {
+		return 0, nil, fmt.Errorf("read chain %s: %w", cf.Resume, err)
+	}
+	if prior.TotalSteps != total {
+		return 0, nil, errs.User(`"Cannot resume chain %s: it has %d steps, not %d"`, cf.Resume, prior.TotalSteps, total)
+	}
+	recorded := make(map[int]ChainStepSummary, len(prior.Steps))
+	for _, s := range prior.Steps {
+		recorded[s.Step] = s
+	}
+	completed := func(n int) bool {
+		s, ok := recorded[n]
+		return ok && (s.Status == string(job.StatusDone) || s.Status == ChainStepReused)
+	}
+
+	var first *chainStep
+	for _, steps := range plan {
+		for i := range steps {
+			st := &steps[i]
+			switch {
+			case cf.From == "":
+				if first == nil && !completed(st.step) {
+					first = st
+				}
+			case cf.From == strconv.Itoa(st.step) || cf.From == st.name:
+				first = st
+			}
+		}
+	}
+	if first == nil {
+		if cf.From == "" {
+			return 0, nil, errs.User(`"Nothing to resume: every step of chain %s completed"`, cf.Resume)
+		}
+		return 0, nil, errs.User(`"No step %s in the chain (1-%d or a step name)"`, cf.From, total)
+	}
+	if first.step != plan[first.group-1][0].step {
+		return 0, nil, errs.User(`"Cannot resume from step %d: it is inside parallel group %d"`, first.step, first.group)
+	}
+
+	reused := make(map[int]ChainStepResult, first.step-1)
+	for n := 1; n < first.step; n++ {
+		if !completed(n) {
+			status := "not run"
+			if s, ok := recorded[n]; ok {
+				status = s.Status
+			}
+			return 0, nil, errs.User(`"Cannot resume chain %s: step %d did not complete (%s)"`, cf.Resume, n, status)
+		}
+		s := recorded[n]
+		jobDir := filepath.Join(projectDir, s.JobID)
+		out, err := os.ReadFile(filepath.Join(jobDir, "stdout.txt"))
+		if err != nil {
+			return 0, nil, errs.User(`"Cannot resume chain %s: output of step %d (%s) is gone"`, cf.Resume, n, s.JobID)
+		}
+		changelog, _ := os.ReadFile(filepath.Join(jobDir, "changelog.txt"))
+		reused[n] = ChainStepResult{
+			Index:     n,
+			Name:      s.Name,
+			JobID:     s.JobID,
+			Status:    ChainStepReused,
+			Stdout:    string(out),
+			Changelog: string(changelog),
+		}
+	}
+	return first.step, reused, nil
+}
+
+// combineGroupStdout joins the stdouts of a parallel group, each under a
+// "=== Step G.S ===" header, in step order.
+func combineGroupStdout(steps []chainStep, outputs []string) string {
+	var b strings.Builder
+	for i, st := range steps {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "=== Step %s ===\n%s", st.label, outputs[i])
+		if outputs[i] != "" && !strings.HasSuffix(outputs[i], "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// lockedWriter serialises writes from concurrent chain steps.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// ChainSummaryPath returns the path of the summary file for chainID.
+func ChainSummaryPath(projectDir, chainID string) string {
+	return filepath.Join(projectDir, chainID+".json")
+}
+
+// writeChainSummary atomically (re)writes the chain summary file.
+func writeChainSummary(projectDir string, summary *ChainSummary) error {
+	data, err := FormatJSON(summary)
+	if err != nil {
+		return err
+	}
+	return job.AtomicWrite(ChainSummaryPath(projectDir, summary.ChainID), append(data, '\n'))
+}
+
 // BuildChainPrompt formats the injected prompt for step N+1 given the previous
 // step's stdout and the raw user prompt for step N+1.
 //
@@ -168,3 +1011,36 @@ func ChainCmd(cf *ChainFlags, subagentsRoot, projectID string, stdout, stderr io
 func BuildChainPrompt(prevStdout, prompt string) string {
 	return fmt.Sprintf("Previous agent result:\n%s\n\nYour task:\n%s", prevStdout, prompt)
 }
+
+// BuildChainPromptFor formats the injected prompt for step N+1 by the
+// --inject mode: InjectStdout (or "") as BuildChainPrompt, InjectChangelog
+// with the previous step's changelog instead of its stdout, InjectBoth with
+// the stdout section followed by the changelog section, and InjectNone as
+// the raw prompt alone. An empty changelog is injected as
+// "(no file changes)".
+//
+// Format of InjectBoth:
+//
+//	Previous agent result:
+//	{prevStdout}
+//
+//	Previous agent changed these files:
+//	{prevChangelog}
+//
+//	Your task:
+//	{prompt}
+func BuildChainPromptFor(mode, prevStdout, prevChangelog, prompt string) string {
+	if prevChangelog == "" {
+		prevChangelog = "(no file changes)"
+	}
+	changed := "Previous agent changed these files:\n" + prevChangelog + "\n\n"
+	switch mode {
+	case InjectChangelog:
+		return changed + "Your task:\n" + prompt
+	case InjectBoth:
+		return "Previous agent result:\n" + prevStdout + "\n\n" + changed + "Your task:\n" + prompt
+	case InjectNone:
+		return prompt
+	}
+	return BuildChainPrompt(prevStdout, prompt)
+}
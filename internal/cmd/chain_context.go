@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// Files in which a chain step records how the output injected into its
+// prompt was summarized (see ChainFlags.Summarize).
+const (
+	ContextSummaryPromptFile = "context_summary_prompt.txt"
+	ContextSummaryFile       = "context_summary.txt"
+)
+
+// ContextDir is the directory of a job dir that holds the context the job
+// was pointed at instead of getting it inline (chain --context-as-file, run
+// --context). It belongs to the job dir, so the job's retention applies.
+const ContextDir = "context"
+
+// The files chain --context-as-file writes into ContextDir.
+const (
+	ContextStdoutFile    = "previous_stdout.txt"
+	ContextChangelogFile = "previous_changelog.txt"
+)
+
+// ContextFile is a file of ContextDir: its name and contents.
+type ContextFile struct {
+	Name string
+	Data string
+}
+
+// WriteContextFiles writes files into ContextDir of jobDir and returns their
+// absolute paths, in order.
+func WriteContextFiles(jobDir string, files []ContextFile) ([]string, error) {
+	dir, err := filepath.Abs(filepath.Join(jobDir, ContextDir))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = filepath.Join(dir, f.Name)
+		if err := os.WriteFile(paths[i], []byte(f.Data), 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// BuildContextFilePrompt formats the prompt of a job whose context is in
+// files rather than inline. source names where the context comes from, such
+// as "the previous step"; empty leaves it out.
+//
+// Format:
+//
+//	Context from {source} is available at {path}[, {path}...] — read it before starting. Your task:
+//	{prompt}
+func BuildContextFilePrompt(source string, paths []string, prompt string) string {
+	what := "Context"
+	if source != "" {
+		what += " from " + source
+	}
+	return fmt.Sprintf("%s is available at %s — read it before starting. Your task:\n%s", what, strings.Join(paths, ", "), prompt)
+}
+
+// chainContextFiles returns the files chain --context-as-file writes for
+// the output of the previous group, as inject selects it: its stdout, its
+// changelog or both. An empty changelog is written as "(no file changes)",
+// as BuildChainPromptFor injects it.
+func chainContextFiles(inject, stdout, changelog string) []ContextFile {
+	if changelog == "" {
+		changelog = "(no file changes)"
+	}
+	switch inject {
+	case InjectChangelog:
+		return []ContextFile{{ContextChangelogFile, changelog}}
+	case InjectBoth:
+		return []ContextFile{{ContextStdoutFile, stdout}, {ContextChangelogFile, changelog}}
+	case InjectNone:
+		return nil
+	}
+	return []ContextFile{{ContextStdoutFile, stdout}}
+}
+
+// RunContextPrompt returns the prompt of a glm run job given --context file:
+// the file is copied into ContextDir of jobDir and prompt points claude at
+// the copy (see BuildContextFilePrompt). When the copy cannot be written, a
+// warning goes to warn and the file's contents are injected inline instead:
+//
+//	Context:
+//	{contents}
+//
+//	Your task:
+//	{prompt}
+//
+// It returns err:user for a file that cannot be read.
+func RunContextPrompt(jobDir, file, prompt string, warn io.Writer) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", errs.User(`"Cannot read --context file: %v"`, err)
+	}
+	paths, err := WriteContextFiles(jobDir, []ContextFile{{filepath.Base(file), string(data)}})
+	if err != nil {
+		fmt.Fprintf(warn, "warning: cannot write the context file, injecting it inline: %v\n", err)
+		return "Context:\n" + string(data) + "\n\nYour task:\n" + prompt, nil
+	}
+	return BuildContextFilePrompt("", paths, prompt), nil
+}
+
+// summarizeContextPrompt asks for a summary of at most %d bytes of the
+// output %s.
+const summarizeContextPrompt = "The text below is the output of a previous agent step. " +
+	"Summarize it in at most %d bytes for the agent that continues the work: keep its conclusions, " +
+	"decisions, file paths, commands and open problems, drop repetition and narration. " +
+	"Reply with the summary only.\n\n%s"
+
+// SummarizeFunc compresses the output of a chain group for the next group;
+// prompt already says how. It returns the summary.
+type SummarizeFunc func(prompt string) (string, error)
+
+// contextSummary is the summarization behind the context a chain step got.
+type contextSummary struct {
+	prompt string
+	result string
+}
+
+// TruncateContext cuts s to at most limit bytes (0 = no limit): its head and
+// tail at character boundaries around a marker that gives the full size and
+// the files that keep all of s. s within limit is returned unchanged. A limit
+// below the marker's length yields the marker alone.
+func TruncateContext(s string, limit int, full []string) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	marker := fmt.Sprintf("\n[... %d bytes, middle omitted ...]\n", len(s))
+	if len(full) > 0 {
+		marker = fmt.Sprintf("\n[... %d bytes, middle omitted; full output in %s ...]\n", len(s), strings.Join(full, ", "))
+	}
+	budget := limit - len(marker)
+	if budget <= 0 {
+		return marker
+	}
+	head := budget / 2
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	tail := len(s) - (budget - budget/2)
+	for tail < len(s) && !utf8.RuneStart(s[tail]) {
+		tail++
+	}
+	return s[:head] + marker + s[tail:]
+}
+
+// fitChainContext returns the output of the previous group as it is injected
+// into the next group's prompts: unchanged within cf.ContextLimit, else
+// summarized with cf.Summarize when set, else cut by TruncateContext. full
+// lists the stdout.txt files that keep all of it. A failed summary is
+// reported on stderr and falls back to the cut; the returned contextSummary
+// is nil unless a summary was made.
+func fitChainContext(cf *ChainFlags, out *Out, prev string, full []string, stderr io.Writer) (string, *contextSummary) {
+	if cf.ContextLimit <= 0 || len(prev) <= cf.ContextLimit {
+		return prev, nil
+	}
+	if cf.Summarize == nil {
+		return TruncateContext(prev, cf.ContextLimit, full), nil
+	}
+
+	out.Progressf("Summarizing %s of output over chain_context_limit (%s)...\n", FormatSize(int64(len(prev))), FormatSize(int64(cf.ContextLimit)))
+	prompt := fmt.Sprintf(summarizeContextPrompt, cf.ContextLimit, prev)
+	summary, err := cf.Summarize(prompt)
+	if err == nil && strings.TrimSpace(summary) == "" {
+		err = fmt.Errorf("empty summary")
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "warning: cannot summarize the previous output, cutting it instead: %v\n", err)
+		return TruncateContext(prev, cf.ContextLimit, full), nil
+	}
+	return TruncateContext(summary, cf.ContextLimit, full), &contextSummary{prompt: prompt, result: summary}
+}
+
+// writeContextSummary records cs in the job dir of the step that got it.
+func writeContextSummary(jobDir string, cs *contextSummary) error {
+	if cs == nil {
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(jobDir, ContextSummaryPromptFile), []byte(cs.prompt), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(jobDir, ContextSummaryFile), []byte(cs.result), 0o644)
+}
+
+// ClaudeSummarizer returns a SummarizeFunc that runs claude once with base's
+// credentials and models on the haiku model, in a scratch job directory that
+// it removes afterwards.
+func ClaudeSummarizer(base claude.Config) SummarizeFunc {
+	return func(prompt string) (string, error) {
+		dir, err := os.MkdirTemp("", "glm-summary-")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+
+		cfg := base
+		cfg.Model = base.HaikuModel
+		cfg.Prompt = prompt
+		cfg.JobDir = dir
+		cfg.CaptureDiff = false
+		exitCode, err := claude.Execute(cfg)
+		if exitCode != 0 {
+			stderrData, _ := os.ReadFile(filepath.Join(dir, "stderr.txt"))
+			if msg := strings.TrimSpace(string(stderrData)); msg != "" {
+				return "", fmt.Errorf("claude exited %d: %s", exitCode, msg)
+			}
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("claude exited %d", exitCode)
+		}
+		if err := claude.ParseRawJSON(dir); err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "stdout.txt"))
+		return string(data), err
+	}
+}
@@ -0,0 +1,232 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// Scenario: output within chain_context_limit is injected unchanged
+func TestTruncateContextPassesShortOutput(t *testing.T) {
+	s := strings.Repeat("a", 100)
+	for _, limit := range []int{0, 100, 1000} {
+		if got := cmd.TruncateContext(s, limit, []string{"/jobs/x/stdout.txt"}); got != s {
+			t.Errorf("limit %d: got %d bytes, want the output unchanged", limit, len(got))
+		}
+	}
+}
+
+// Scenario: longer output keeps its head and tail within the limit
+func TestTruncateContextBoundaries(t *testing.T) {
+	full := []string{"/jobs/job-1/stdout.txt"}
+	s := "HEAD" + strings.Repeat("é", 3000) + "TAIL"
+	for _, limit := range []int{len(s) - 1, 4000, 500, 120} {
+		got := cmd.TruncateContext(s, limit, full)
+		if len(got) > limit {
+			t.Errorf("limit %d: got %d bytes", limit, len(got))
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("limit %d: cut inside a character", limit)
+		}
+		if !strings.HasPrefix(got, "HEAD") || !strings.HasSuffix(got, "TAIL") {
+			t.Errorf("limit %d: head or tail missing: %.20q...%.20q", limit, got, got[len(got)-20:])
+		}
+		if want := "[... 6008 bytes, middle omitted; full output in /jobs/job-1/stdout.txt ...]"; !strings.Contains(got, want) {
+			t.Errorf("limit %d: marker missing from %q", limit, got)
+		}
+	}
+
+	if got := cmd.TruncateContext(s, 10, nil); got != "\n[... 6008 bytes, middle omitted ...]\n" {
+		t.Errorf("limit below the marker = %q, want the marker alone", got)
+	}
+}
+
+// resumedBigChain runs a two-step chain whose first step printed out and
+// returns ChainFlags that resume it from step 2.
+func resumedBigChain(t *testing.T, root, out string) *cmd.ChainFlags {
+	t.Helper()
+	prompts := []string{"analyse the repo", "fix what you found"}
+	var stdout, stderr bytes.Buffer
+	first, err := cmd.ChainCmd(chainFlags(".", 0, "", false, prompts), root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	// The simulated steps print nothing; give step 1 a large analysis.
+	writeFile(t, filepath.Join(first.JobDirs[0], "stdout.txt"), out)
+
+	cf := chainFlags(".", 0, "", false, prompts)
+	cf.Resume, cf.From = first.ChainID, "2"
+	return cf
+}
+
+// Scenario: a step gets the previous output cut to chain_context_limit
+func TestChainCutsContextOverLimit(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	big := strings.Repeat("finding\n", 8000)
+	cf := resumedBigChain(t, root, big)
+	cf.ContextLimit = 2000
+
+	var stdout, stderr bytes.Buffer
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	prompt, _ := os.ReadFile(filepath.Join(result.JobDirs[0], "prompt.txt"))
+	step1 := filepath.Join(root, "test-project", result.Steps[0].JobID, "stdout.txt")
+	if want := cmd.BuildChainPrompt(cmd.TruncateContext(big, 2000, []string{step1}), "fix what you found"); string(prompt) != want {
+		t.Errorf("step 2 prompt (%d bytes) is not the cut output", len(prompt))
+	}
+	if !strings.Contains(string(prompt), "full output in "+step1) {
+		t.Errorf("step 2 prompt does not name %s", step1)
+	}
+	if full, _ := os.ReadFile(step1); string(full) != big {
+		t.Errorf("step 1 stdout.txt has %d bytes, want all %d", len(full), len(big))
+	}
+	if _, err := os.Stat(filepath.Join(result.JobDirs[0], cmd.ContextSummaryFile)); !os.IsNotExist(err) {
+		t.Errorf("a cut context recorded %s", cmd.ContextSummaryFile)
+	}
+}
+
+// mockSummarizer returns a ClaudeSummarizer backed by a mock claude running
+// script.
+func mockSummarizer(t *testing.T, script string) cmd.SummarizeFunc {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.ClaudeSummarizer(claude.Config{ClaudePath: bin, HaikuModel: "glm-4.5-air", WorkDir: t.TempDir(), TimeoutSecs: 30})
+}
+
+// Scenario: --summarize-context injects a summary and records it with the step
+func TestChainSummarizesContextOverLimit(t *testing.T) {
+	saved := claude.WarnOutput
+	claude.WarnOutput = &bytes.Buffer{}
+	t.Cleanup(func() { claude.WarnOutput = saved })
+
+	root := makeSubagentsRoot(t)
+	big := strings.Repeat("finding\n", 8000)
+	cf := resumedBigChain(t, root, big)
+	cf.ContextLimit = 2000
+	cf.Summarize = mockSummarizer(t, `echo '{"result":"three findings, all in parser.go"}'`)
+
+	var stdout, stderr bytes.Buffer
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	dir := result.JobDirs[0]
+	prompt, _ := os.ReadFile(filepath.Join(dir, "prompt.txt"))
+	if want := cmd.BuildChainPrompt("three findings, all in parser.go", "fix what you found"); string(prompt) != want {
+		t.Errorf("step 2 prompt = %q, want %q", prompt, want)
+	}
+	summaryPrompt, _ := os.ReadFile(filepath.Join(dir, cmd.ContextSummaryPromptFile))
+	if !strings.Contains(string(summaryPrompt), "at most 2000 bytes") || !strings.HasSuffix(string(summaryPrompt), big) {
+		t.Errorf("%s does not ask for 2000 bytes of the full output", cmd.ContextSummaryPromptFile)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, cmd.ContextSummaryFile)); string(got) != "three findings, all in parser.go" {
+		t.Errorf("%s = %q", cmd.ContextSummaryFile, got)
+	}
+	if !strings.Contains(stderr.String(), "Summarizing 62.5 KB of output") {
+		t.Errorf("stderr = %q, want a summarizing progress line", stderr.String())
+	}
+
+	// A failed summary falls back to the cut.
+	cf.Summarize = mockSummarizer(t, `echo "rate limited" >&2; exit 1`)
+	stderr.Reset()
+	result, err = cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	prompt, _ = os.ReadFile(filepath.Join(result.JobDirs[0], "prompt.txt"))
+	if !strings.Contains(string(prompt), "middle omitted") || len(prompt) > 2000+len(cmd.BuildChainPrompt("", "fix what you found")) {
+		t.Errorf("fallback prompt has %d bytes and no cut marker", len(prompt))
+	}
+	if !strings.Contains(stderr.String(), "warning: cannot summarize the previous output, cutting it instead: claude exited 1: rate limited") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+// Scenario: --context-as-file writes the whole previous output into the step's context dir and points the prompt at it
+func TestChainContextAsFile(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	big := strings.Repeat("finding\n", 8000)
+	cf := resumedBigChain(t, root, big)
+	cf.ContextLimit = 2000
+	cf.ContextAsFile = true
+	cf.Inject = cmd.InjectBoth
+
+	var stdout, stderr bytes.Buffer
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	contextDir := filepath.Join(result.JobDirs[0], cmd.ContextDir)
+	stdoutFile := filepath.Join(contextDir, cmd.ContextStdoutFile)
+	changelogFile := filepath.Join(contextDir, cmd.ContextChangelogFile)
+	prompt, _ := os.ReadFile(filepath.Join(result.JobDirs[0], "prompt.txt"))
+	want := "Context from the previous step is available at " + stdoutFile + ", " + changelogFile +
+		" — read it before starting. Your task:\nfix what you found"
+	if string(prompt) != want || !filepath.IsAbs(stdoutFile) {
+		t.Errorf("step 2 prompt = %q, want %q", prompt, want)
+	}
+	if got, _ := os.ReadFile(stdoutFile); string(got) != big {
+		t.Errorf("%s has %d bytes, want the whole %d", cmd.ContextStdoutFile, len(got), len(big))
+	}
+	if got, _ := os.ReadFile(changelogFile); string(got) != "(no file changes)" {
+		t.Errorf("%s = %q", cmd.ContextChangelogFile, got)
+	}
+
+	// --inject none has no context to write.
+	cf.Inject = cmd.InjectNone
+	result, err = cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if prompt, _ := os.ReadFile(filepath.Join(result.JobDirs[0], "prompt.txt")); string(prompt) != "fix what you found" {
+		t.Errorf("prompt with --inject none = %q", prompt)
+	}
+	if _, err := os.Stat(filepath.Join(result.JobDirs[0], cmd.ContextDir)); !os.IsNotExist(err) {
+		t.Errorf("--inject none created %s", cmd.ContextDir)
+	}
+}
+
+// Scenario: run --context copies the file into the job's context dir, and falls back to the inline file when the copy cannot be written
+func TestRunContextPrompt(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "notes.md")
+	writeFile(t, src, "# notes\nuse the v2 API\n")
+	jobDir := t.TempDir()
+
+	var warn bytes.Buffer
+	prompt, err := cmd.RunContextPrompt(jobDir, src, "port the client", &warn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(jobDir, cmd.ContextDir, "notes.md")
+	if want := "Context is available at " + copied + " — read it before starting. Your task:\nport the client"; prompt != want {
+		t.Errorf("prompt = %q, want %q", prompt, want)
+	}
+	if got, _ := os.ReadFile(copied); string(got) != "# notes\nuse the v2 API\n" {
+		t.Errorf("copy = %q", got)
+	}
+
+	notDir := filepath.Join(t.TempDir(), "job")
+	writeFile(t, notDir, "")
+	prompt, err = cmd.RunContextPrompt(notDir, src, "port the client", &warn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompt != "Context:\n# notes\nuse the v2 API\n\n\nYour task:\nport the client" || !strings.Contains(warn.String(), "injecting it inline") {
+		t.Errorf("fallback prompt = %q, warning %q", prompt, warn.String())
+	}
+
+	if _, err := cmd.RunContextPrompt(jobDir, filepath.Join(t.TempDir(), "missing.md"), "x", &warn); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("missing file: err = %v, want err:user", err)
+	}
+}
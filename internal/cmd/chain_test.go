@@ -2,12 +2,18 @@ package cmd_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/job"
 )
 
 // helpers -------------------------------------------------------------------
@@ -315,6 +321,83 @@ func TestIntermediateJobDirectoriesArePreservedAfterChain(t *testing.T) {
 	}
 }
 
+// TestChainCleanIntermediate verifies that --clean-intermediate deletes the
+// job dirs of steps 1..n-1 of a successful chain and marks them cleaned in
+// the summary, keeps every dir of a failed chain, and is ignored with a
+// warning when resuming.
+func TestChainCleanIntermediate(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	projectDir := filepath.Join(root, "test-project")
+	var stdout, stderr bytes.Buffer
+
+	cf := chainFlags(".", 0, "", false, []string{"Step 1", "Step 2", "Step 3"})
+	cf.CleanIntermediate = true
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if result.ExitCode != 0 || len(result.Cleaned) != 2 {
+		t.Fatalf("result = %+v, want exit 0 with 2 dirs cleaned", result)
+	}
+	for i, dir := range result.JobDirs {
+		_, err := os.Stat(dir)
+		if gone := os.IsNotExist(err); gone != (i < 2) {
+			t.Errorf("step %d dir gone = %v, want %v", i+1, gone, i < 2)
+		}
+	}
+	var summary cmd.ChainSummary
+	data, _ := os.ReadFile(cmd.ChainSummaryPath(projectDir, result.ChainID))
+	if err := json.Unmarshal(data, &summary); err != nil || len(summary.Steps) != 3 {
+		t.Fatalf("summary = %s (%v)", data, err)
+	}
+	for i, s := range summary.Steps {
+		if s.Cleaned != (i < 2) {
+			t.Errorf("summary step %d cleaned = %v, want %v", i+1, s.Cleaned, i < 2)
+		}
+	}
+	if !strings.Contains(stderr.String(), "Cleaned 2 intermediate step dirs") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+
+	// A failed chain keeps everything for debugging.
+	cf = chainFlags("/nonexistent-dir-that-does-not-exist", 0, "", true, []string{"Step 1", "Step 2"})
+	cf.CleanIntermediate = true
+	failed, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if failed.ExitCode == 0 || len(failed.Cleaned) != 0 {
+		t.Errorf("failed chain: result = %+v, want a failure with nothing cleaned", failed)
+	}
+	for i, dir := range failed.JobDirs {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("failed chain: step %d dir: %v", i+1, err)
+		}
+	}
+
+	// Resuming needs the earlier run's dirs.
+	prompts := []string{"Step 1", "Step 2", "Step 3"}
+	first, err := cmd.ChainCmd(chainFlags(".", 0, "", false, prompts), root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	stderr.Reset()
+	cf = chainFlags(".", 0, "", false, prompts)
+	cf.Resume, cf.From, cf.CleanIntermediate = first.ChainID, "2", true
+	resumed, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("resume: ChainCmd error: %v", err)
+	}
+	if len(resumed.Cleaned) != 0 || !strings.Contains(stderr.String(), "warning: --clean-intermediate is ignored with --resume") {
+		t.Errorf("resume: cleaned %v, stderr %q", resumed.Cleaned, stderr.String())
+	}
+	for _, dir := range append(first.JobDirs, resumed.JobDirs...) {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("resume: %v", err)
+		}
+	}
+}
+
 // AC6: Chain progress printed to stderr ------------------------------------
 
 // TestChainPrintsProgressToStderr verifies that each step produces a
@@ -545,6 +628,68 @@ func TestChainPassesTimeoutFlagToEachStep(t *testing.T) {
 	}
 }
 
+// TestChainTotalTimeoutBudget verifies that with --total-timeout each step
+// gets the smaller of its timeout and the budget left, and that the steps
+// after the budget ran out are skipped with the timeout exit code.
+func TestChainTotalTimeoutBudget(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	// The chain starts at base; step 1 starts right away, step 2 after 60s
+	// and step 3 would start after 120s.
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := []time.Duration{0, 0, 60 * time.Second, 120 * time.Second}
+	cf := chainFlags(".", 60, "", false, []string{"a", "b", "c"})
+	cf.TotalTimeout = 100 * time.Second
+	cf.Now = func() time.Time {
+		now := base.Add(clock[0])
+		clock = clock[1:]
+		return now
+	}
+
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd: %v", err)
+	}
+	if !result.BudgetExceeded || result.ExitCode != 124 || result.StepsExecuted != 2 || result.StepsSkipped != 1 {
+		t.Fatalf("result = budget exceeded %v, exit %d, %d run, %d skipped; want true, 124, 2, 1",
+			result.BudgetExceeded, result.ExitCode, result.StepsExecuted, result.StepsSkipped)
+	}
+	if got := result.Steps[2].Status; got != cmd.ChainStepSkipped {
+		t.Errorf("step 3 status = %q, want skipped", got)
+	}
+	for i, want := range []string{"60", "40"} {
+		data, _ := os.ReadFile(filepath.Join(result.JobDirs[i], "timeout"))
+		if string(data) != want {
+			t.Errorf("step %d timeout = %q, want %s", i+1, data, want)
+		}
+	}
+	for _, want := range []string{
+		"[1/3] Running step 1... (1m40s of total timeout left)",
+		"[2/3] Running step 2... (40s of total timeout left)",
+		"Chain total timeout of 1m40s used up; skipping the remaining steps",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("progress lacks %q:\n%s", want, stderr.String())
+		}
+	}
+}
+
+// TestParseTotalTimeout verifies the seconds and duration forms of
+// --total-timeout and the rejection of anything that is not positive.
+func TestParseTotalTimeout(t *testing.T) {
+	for raw, want := range map[string]time.Duration{"90": 90 * time.Second, "90m": 90 * time.Minute, "1h30m": 90 * time.Minute} {
+		if got, err := cmd.ParseTotalTimeout(raw); err != nil || got != want {
+			t.Errorf("ParseTotalTimeout(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"0", "-5", "-1s", "soon", ""} {
+		if _, err := cmd.ParseTotalTimeout(raw); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+			t.Errorf("ParseTotalTimeout(%q) = %v, want err:user", raw, err)
+		}
+	}
+}
+
 // TestChainPassesModelFlagToEachStep verifies that each job uses the model
 // specified by -m.
 func TestChainPassesModelFlagToEachStep(t *testing.T) {
@@ -624,3 +769,659 @@ func TestBuildChainPromptWithEmptyPrevStdout(t *testing.T) {
 		t.Errorf("prompt missing user prompt\ngot: %q", got)
 	}
 }
+
+// TestBuildChainPromptForModes verifies the exact prompt of every --inject
+// mode, and that an empty changelog is injected as "(no file changes)".
+func TestBuildChainPromptForModes(t *testing.T) {
+	prev := "Renamed Foo to Bar"
+	changelog := "EDIT foo.go: 2 replacements\nWRITE bar.go"
+	next := "Update the callers"
+	tests := []struct {
+		mode, changelog, want string
+	}{
+		{"", changelog, "Previous agent result:\nRenamed Foo to Bar\n\nYour task:\nUpdate the callers"},
+		{cmd.InjectStdout, changelog, "Previous agent result:\nRenamed Foo to Bar\n\nYour task:\nUpdate the callers"},
+		{cmd.InjectChangelog, changelog, "Previous agent changed these files:\nEDIT foo.go: 2 replacements\nWRITE bar.go\n\nYour task:\nUpdate the callers"},
+		{cmd.InjectChangelog, "", "Previous agent changed these files:\n(no file changes)\n\nYour task:\nUpdate the callers"},
+		{cmd.InjectBoth, changelog, "Previous agent result:\nRenamed Foo to Bar\n\nPrevious agent changed these files:\nEDIT foo.go: 2 replacements\nWRITE bar.go\n\nYour task:\nUpdate the callers"},
+		{cmd.InjectNone, changelog, "Update the callers"},
+	}
+	for _, tt := range tests {
+		if got := cmd.BuildChainPromptFor(tt.mode, prev, tt.changelog, next); got != tt.want {
+			t.Errorf("mode %q:\ngot:  %q\nwant: %q", tt.mode, got, tt.want)
+		}
+	}
+	if got, want := cmd.BuildChainPromptFor(cmd.InjectStdout, prev, changelog, next), cmd.BuildChainPrompt(prev, next); got != want {
+		t.Errorf("stdout mode = %q, want BuildChainPrompt's %q", got, want)
+	}
+
+	for _, raw := range []string{"stdout", "changelog", "both", "none"} {
+		if got, err := cmd.ParseInjectMode(raw); err != nil || got != raw {
+			t.Errorf("ParseInjectMode(%q) = %q, %v", raw, got, err)
+		}
+	}
+	for _, raw := range []string{"", "Stdout", "diff"} {
+		if _, err := cmd.ParseInjectMode(raw); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+			t.Errorf("ParseInjectMode(%q) error = %v, want err:user", raw, err)
+		}
+	}
+}
+
+// TestChainInjectModes verifies step 2's prompt.txt for every --inject mode,
+// with step 1's stdout and changelog given through a resumed chain.
+func TestChainInjectModes(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	prompts := []string{"rename Foo to Bar", "update the callers"}
+	var stdout, stderr bytes.Buffer
+
+	first, err := cmd.ChainCmd(chainFlags(".", 0, "", false, prompts), root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	// The simulated steps write no changelog; a fresh chain injects none.
+	got, _ := os.ReadFile(filepath.Join(first.JobDirs[1], "prompt.txt"))
+	if want := "Previous agent result:\n\n\nYour task:\nupdate the callers"; string(got) != want {
+		t.Errorf("default step 2 prompt = %q, want %q", got, want)
+	}
+	writeFile(t, filepath.Join(first.JobDirs[0], "stdout.txt"), "Renamed it.")
+	writeFile(t, filepath.Join(first.JobDirs[0], "changelog.txt"), "EDIT foo.go: 1 replacement")
+
+	for mode, want := range map[string]string{
+		cmd.InjectStdout:    "Previous agent result:\nRenamed it.\n\nYour task:\nupdate the callers",
+		cmd.InjectChangelog: "Previous agent changed these files:\nEDIT foo.go: 1 replacement\n\nYour task:\nupdate the callers",
+		cmd.InjectBoth:      "Previous agent result:\nRenamed it.\n\nPrevious agent changed these files:\nEDIT foo.go: 1 replacement\n\nYour task:\nupdate the callers",
+		cmd.InjectNone:      "update the callers",
+	} {
+		cf := chainFlags(".", 0, "", false, prompts)
+		cf.Resume, cf.From, cf.Inject = first.ChainID, "2", mode
+		result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+		if err != nil {
+			t.Fatalf("--inject %s: ChainCmd error: %v", mode, err)
+		}
+		got, _ := os.ReadFile(filepath.Join(result.JobDirs[0], "prompt.txt"))
+		if string(got) != want {
+			t.Errorf("--inject %s: step 2 prompt = %q, want %q", mode, got, want)
+		}
+	}
+
+	// none also leaves a fresh chain's steps uninjected.
+	cf := chainFlags(".", 0, "", false, prompts)
+	cf.Inject = cmd.InjectNone
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(result.JobDirs[1], "prompt.txt")); string(got) != "update the callers" {
+		t.Errorf("--inject none: step 2 prompt = %q", got)
+	}
+}
+
+// Chain relationship --------------------------------------------------------
+
+// TestChainRecordsChainInfoInEveryStep verifies that a multi-step chain
+// writes chain.txt into each step's job dir and a summary under the project,
+// and marks the steps after the first as chain-injected.
+func TestChainRecordsChainInfoInEveryStep(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	cf := chainFlags(".", 60, "glm-4.7", false, []string{"a", "b", "c"})
+
+	result, err := cmd.ChainCmd(cf, root, "proj-chain", &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("ChainCmd: %v", err)
+	}
+	if !strings.HasPrefix(result.ChainID, "chain-") {
+		t.Fatalf("ChainID = %q, want chain- prefix", result.ChainID)
+	}
+
+	for i, dir := range result.JobDirs {
+		m := job.LoadManifest(dir)
+		if m.ChainID != result.ChainID || m.ChainStep != i+1 || m.ChainTotal != 3 {
+			t.Errorf("step %d chain info = %q %d/%d", i+1, m.ChainID, m.ChainStep, m.ChainTotal)
+		}
+		if _, err := os.Stat(filepath.Join(dir, job.ChainFile)); err != nil {
+			t.Errorf("step %d: %s missing: %v", i+1, job.ChainFile, err)
+		}
+		if m.ChainInjected != (i > 0) {
+			t.Errorf("step %d chain_injected = %v", i+1, m.ChainInjected)
+		}
+	}
+
+	data, err := os.ReadFile(cmd.ChainSummaryPath(filepath.Join(root, "proj-chain"), result.ChainID))
+	if err != nil {
+		t.Fatalf("read chain summary: %v", err)
+	}
+	var summary cmd.ChainSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatalf("parse chain summary: %v", err)
+	}
+	if summary.TotalSteps != 3 || len(summary.Steps) != 3 {
+		t.Fatalf("summary = %+v, want 3 steps", summary)
+	}
+	for i, s := range summary.Steps {
+		if s.Step != i+1 || s.JobID != filepath.Base(result.JobDirs[i]) || s.Status != "done" {
+			t.Errorf("summary step %d = %+v", i+1, s)
+		}
+	}
+}
+
+// TestSinglePromptChainHasNoChainInfo verifies that single-prompt chains do
+// not get a chain ID, chain.txt, or chain fields in JSON output.
+func TestSinglePromptChainHasNoChainInfo(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	cf := chainFlags(".", 60, "glm-4.7", false, []string{"only"})
+
+	result, err := cmd.ChainCmd(cf, root, "proj-chain", &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("ChainCmd: %v", err)
+	}
+	if result.ChainID != "" {
+		t.Errorf("ChainID = %q, want empty", result.ChainID)
+	}
+	if _, err := os.Stat(filepath.Join(result.JobDirs[0], job.ChainFile)); !os.IsNotExist(err) {
+		t.Errorf("%s should not exist, stat err = %v", job.ChainFile, err)
+	}
+
+	var out bytes.Buffer
+	if err := cmd.ListJSON(root, nil, &out); err != nil {
+		t.Fatalf("ListJSON: %v", err)
+	}
+	if strings.Contains(out.String(), "chain_id") || strings.Contains(out.String(), `"step"`) {
+		t.Errorf("ListJSON grew chain fields for a plain job: %s", out.String())
+	}
+}
+
+// TestListChainShowsOnlyThatChainInOrder verifies "glm list --chain" keeps
+// only the chain's steps, in step order, and ListJSON exposes chain_id/step.
+func TestListChainShowsOnlyThatChainInOrder(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	writeJobDir(t, root, "proj-chain", "job-20260101-000000-unrelated", "done", "")
+
+	cf := chainFlags(".", 60, "glm-4.7", false, []string{"a", "b", "c"})
+	result, err := cmd.ChainCmd(cf, root, "proj-chain", &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("ChainCmd: %v", err)
+	}
+
+	var table bytes.Buffer
+	if err := cmd.ListCmd(root, &table, &cmd.FilterOptions{Chain: result.ChainID}); err != nil {
+		t.Fatalf("ListCmd: %v", err)
+	}
+	if strings.Contains(table.String(), "unrelated") {
+		t.Errorf("list --chain shows a job outside the chain:\n%s", table.String())
+	}
+	last := -1
+	for i, dir := range result.JobDirs {
+		pos := strings.Index(table.String(), filepath.Base(dir))
+		if pos < 0 || pos < last {
+			t.Fatalf("step %d missing or out of order:\n%s", i+1, table.String())
+		}
+		last = pos
+	}
+
+	var out bytes.Buffer
+	if err := cmd.ListJSON(root, &cmd.FilterOptions{Chain: result.ChainID}, &out); err != nil {
+		t.Fatalf("ListJSON: %v", err)
+	}
+	var items []cmd.JobListItem
+	if err := json.Unmarshal(out.Bytes(), &items); err != nil {
+		t.Fatalf("parse ListJSON: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("ListJSON returned %d items, want 3", len(items))
+	}
+	for i, item := range items {
+		if item.ChainID != result.ChainID || item.Step != i+1 {
+			t.Errorf("item %d = %+v, want chain %s step %d", i, item, result.ChainID, i+1)
+		}
+	}
+}
+
+// JSON output ----------------------------------------------------------------
+
+// decodeChainJSON parses "glm chain --json" output into generic maps so tests
+// can check for absent keys as well as values.
+func decodeChainJSON(t *testing.T, data []byte) (int, []map[string]any) {
+	t.Helper()
+	var out struct {
+		ChainExitCode *int             `json:"chain_exit_code"`
+		Steps         []map[string]any `json:"steps"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("chain --json output is not valid JSON: %v\n%s", err, data)
+	}
+	if out.ChainExitCode == nil {
+		t.Fatalf("chain --json output missing chain_exit_code:\n%s", data)
+	}
+	return *out.ChainExitCode, out.Steps
+}
+
+// TestChainJSONStopOnErrorReportsSkippedSteps verifies that with --json and
+// the default stop-on-error mode, the failed step carries its job ID and the
+// remaining steps are reported as "skipped" without one.
+func TestChainJSONStopOnErrorReportsSkippedSteps(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	cf := chainFlags("/nonexistent-dir-that-does-not-exist", 0, "", false, []string{"a", "b", "c"})
+	cf.JSON = true
+
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+
+	exitCode, steps := decodeChainJSON(t, stdout.Bytes())
+	if exitCode != 1 || exitCode != result.ExitCode {
+		t.Errorf("chain_exit_code = %d, want 1", exitCode)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(steps))
+	}
+	if steps[0]["status"] != "failed" || steps[0]["job_id"] != filepath.Base(result.JobDirs[0]) {
+		t.Errorf("step 1 = %v, want failed with job_id", steps[0])
+	}
+	for i, s := range steps {
+		if s["index"] != float64(i+1) {
+			t.Errorf("step %d index = %v", i+1, s["index"])
+		}
+		for _, key := range []string{"duration_seconds", "stdout", "stderr", "changelog"} {
+			if _, ok := s[key]; !ok {
+				t.Errorf("step %d missing %q", i+1, key)
+			}
+		}
+	}
+	for _, s := range steps[1:] {
+		if s["status"] != cmd.ChainStepSkipped {
+			t.Errorf("step %v status = %v, want skipped", s["index"], s["status"])
+		}
+		if _, ok := s["job_id"]; ok {
+			t.Errorf("skipped step %v has job_id %v", s["index"], s["job_id"])
+		}
+	}
+
+	// Progress stays on stderr in text form.
+	if !strings.Contains(stderr.String(), "[1/3] Running step 1...") {
+		t.Errorf("stderr missing progress line:\n%s", stderr.String())
+	}
+}
+
+// TestChainJSONContinueOnErrorReportsEveryStep verifies that with --json and
+// --continue-on-error, every step runs and is reported with its job ID.
+func TestChainJSONContinueOnErrorReportsEveryStep(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	cf := chainFlags("/nonexistent-dir-that-does-not-exist", 0, "", true, []string{"a", "b", "c"})
+	cf.JSON = true
+
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+
+	exitCode, steps := decodeChainJSON(t, stdout.Bytes())
+	if exitCode != 1 {
+		t.Errorf("chain_exit_code = %d, want 1", exitCode)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(steps))
+	}
+	for i, s := range steps {
+		if s["status"] != "failed" || s["job_id"] != filepath.Base(result.JobDirs[i]) {
+			t.Errorf("step %d = %v, want failed with job_id %s", i+1, s, filepath.Base(result.JobDirs[i]))
+		}
+	}
+}
+
+// TestChainWithoutJSONPrintsFinalStdout verifies that the text mode prints
+// the final step's stdout rather than a JSON object.
+func TestChainWithoutJSONPrintsFinalStdout(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	cf := chainFlags(".", 0, "", false, []string{"a", "b"})
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if stdout.String() != result.FinalStdout {
+		t.Errorf("stdout = %q, want FinalStdout %q", stdout.String(), result.FinalStdout)
+	}
+	if len(result.Steps) != 2 {
+		t.Errorf("ChainResult.Steps has %d records, want 2", len(result.Steps))
+	}
+}
+
+// Parallel groups -----------------------------------------------------------
+
+// TestChainGroupsRunInParallelThenInjectCombinedOutput verifies that the steps
+// of a group are numbered "G.S" and that the next group's prompt gets every
+// step's output under its own header.
+func TestChainGroupsRunInParallelThenInjectCombinedOutput(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	cf := chainFlags(".", 0, "", false, nil)
+	cf.Groups = [][]string{{"review auth", "review db"}, {"summarise"}}
+	cf.MaxParallel = 1
+	cf.JSON = true
+
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if result.StepsExecuted != 3 || result.ExitCode != 0 {
+		t.Fatalf("StepsExecuted = %d, ExitCode = %d; want 3, 0", result.StepsExecuted, result.ExitCode)
+	}
+	for _, line := range []string{"[1.1/2] Running step 1.1...", "[1.2/2] Running step 1.2...", "[2/2] Running step 2..."} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Errorf("stderr missing %q:\n%s", line, stderr.String())
+		}
+	}
+
+	prompt, _ := os.ReadFile(filepath.Join(result.JobDirs[2], "prompt.txt"))
+	want := "Previous agent result:\n=== Step 1.1 ===\n\n=== Step 1.2 ===\n\n\nYour task:\nsummarise"
+	if string(prompt) != want {
+		t.Errorf("step 3 prompt = %q, want %q", prompt, want)
+	}
+	chainTxt, _ := os.ReadFile(filepath.Join(result.JobDirs[2], job.ChainFile))
+	if !strings.Contains(string(chainTxt), "step=3\ntotal=3\n") {
+		t.Errorf("chain.txt = %q, want step 3 of 3", chainTxt)
+	}
+
+	_, steps := decodeChainJSON(t, stdout.Bytes())
+	for i, wantGroup := range []float64{1, 1, 2} {
+		if steps[i]["group"] != wantGroup || steps[i]["index"] != float64(i+1) {
+			t.Errorf("step %d = %v, want group %v", i+1, steps[i], wantGroup)
+		}
+	}
+}
+
+// TestChainGroupFailureSkipsLaterGroups verifies that a failed step lets the
+// rest of its group finish and skips every later group.
+func TestChainGroupFailureSkipsLaterGroups(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	cf := chainFlags("/nonexistent-dir-that-does-not-exist", 0, "", false, nil)
+	cf.Groups = [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if result.ExitCode != 1 || result.StepsExecuted != 2 || result.StepsSkipped != 3 {
+		t.Errorf("ExitCode = %d, executed = %d, skipped = %d; want 1, 2, 3", result.ExitCode, result.StepsExecuted, result.StepsSkipped)
+	}
+	for i, wantGroup := range []int{1, 1, 2, 2, 3} {
+		s := result.Steps[i]
+		wantStatus := cmd.ChainStepSkipped
+		if i < 2 {
+			wantStatus = "failed"
+		}
+		if s.Index != i+1 || s.Group != wantGroup || s.Status != wantStatus {
+			t.Errorf("step %d = %+v, want group %d %s", i+1, s, wantGroup, wantStatus)
+		}
+	}
+}
+
+// TestChainResumeReusesEarlierSteps verifies that --resume with --from 3
+// skips steps 1-2, reports them as reused with their original jobs, and
+// injects step 2's recorded stdout byte-for-byte into the new step 3.
+func TestChainResumeReusesEarlierSteps(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	prompts := []string{"plan:write a plan", "fix:apply the plan", "test:run the tests", "report"}
+	var stdout, stderr bytes.Buffer
+
+	first, err := cmd.ChainCmd(chainFlags(".", 0, "", false, prompts), root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "[2/4] Running step 2 (fix)...") {
+		t.Errorf("stderr = %q, want the step name in progress lines", stderr.String())
+	}
+	if got, _ := os.ReadFile(filepath.Join(first.JobDirs[0], "prompt.txt")); string(got) != "write a plan" {
+		t.Errorf("step 1 prompt = %q, want the name stripped", got)
+	}
+	// The simulated steps print nothing; give steps 1-2 real output.
+	step2Out := "patched main.go\n  trailing spaces  \n\nno final newline"
+	writeFile(t, filepath.Join(first.JobDirs[0], "stdout.txt"), "the plan\n")
+	writeFile(t, filepath.Join(first.JobDirs[1], "stdout.txt"), step2Out)
+
+	for _, from := range []string{"3", "test"} {
+		stderr.Reset()
+		cf := chainFlags(".", 0, "", false, prompts)
+		cf.Resume, cf.From = first.ChainID, from
+		result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+		if err != nil {
+			t.Fatalf("--from %s: ChainCmd error: %v", from, err)
+		}
+		if result.ChainID == first.ChainID || result.StepsReused != 2 || result.StepsExecuted != 2 || len(result.JobDirs) != 2 {
+			t.Errorf("--from %s: result = %+v, want a new chain with 2 reused and 2 executed steps", from, result)
+		}
+		for i, want := range []string{"the plan\n", step2Out} {
+			s := result.Steps[i]
+			if s.Status != cmd.ChainStepReused || s.JobID != first.Steps[i].JobID || s.Stdout != want {
+				t.Errorf("--from %s: step %d = %+v, want reused %s", from, i+1, s, first.Steps[i].JobID)
+			}
+		}
+		if result.Steps[2].Name != "test" || result.Steps[2].Status != "done" {
+			t.Errorf("--from %s: step 3 = %+v", from, result.Steps[2])
+		}
+		got, _ := os.ReadFile(filepath.Join(result.JobDirs[0], "prompt.txt"))
+		if want := cmd.BuildChainPrompt(step2Out, "run the tests"); string(got) != want {
+			t.Errorf("--from %s: step 3 prompt = %q, want %q", from, got, want)
+		}
+		if !strings.Contains(stderr.String(), "[2/4] Reusing step 2 (fix) from "+first.ChainID) {
+			t.Errorf("--from %s: stderr = %q", from, stderr.String())
+		}
+
+		var summary cmd.ChainSummary
+		data, _ := os.ReadFile(cmd.ChainSummaryPath(filepath.Join(root, "test-project"), result.ChainID))
+		if err := json.Unmarshal(data, &summary); err != nil || len(summary.Steps) != 4 || summary.Steps[1].Status != cmd.ChainStepReused {
+			t.Errorf("--from %s: summary = %s (%v)", from, data, err)
+		}
+	}
+}
+
+// TestChainResumeRejectsBadRequests verifies the errors for resuming past an
+// incomplete step, unknown steps and chains, and --from without --resume.
+func TestChainResumeRejectsBadRequests(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	prompts := []string{"a", "b", "c"}
+	var stdout, stderr bytes.Buffer
+
+	failed, err := cmd.ChainCmd(chainFlags("/nonexistent-dir-that-does-not-exist", 0, "", false, prompts), root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+
+	tests := []struct {
+		resume, from string
+		prompts      []string
+		want         string
+	}{
+		{failed.ChainID, "3", prompts, "step 1 did not complete (failed)"},
+		{failed.ChainID, "nope", prompts, "No step nope"},
+		{failed.ChainID, "", []string{"a", "b"}, "it has 3 steps, not 2"},
+		{"chain-20260227-143205-deadbeef", "2", prompts, "Chain not found"},
+		{"", "2", prompts, "--from requires --resume"},
+	}
+	for _, tt := range tests {
+		cf := chainFlags(".", 0, "", false, tt.prompts)
+		cf.Resume, cf.From = tt.resume, tt.from
+		if _, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("--resume %q --from %q: err = %v, want %q", tt.resume, tt.from, err, tt.want)
+		}
+	}
+
+	// --from must start a group.
+	cf := chainFlags(".", 0, "", false, nil)
+	cf.Groups = [][]string{{"a"}, {"b", "c"}}
+	done, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	cf.Resume, cf.From = done.ChainID, "3"
+	if _, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr); err == nil || !strings.Contains(err.Error(), "inside parallel group 2") {
+		t.Errorf("--from inside a group: err = %v", err)
+	}
+}
+
+// Scenario: [model=...] and [slot=...] prefixes pick the model of one step
+func TestChainStepPrefixesSetTheStepModel(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	cf := chainFlags(".", 0, "big-model", false, []string{
+		"analyze:[slot=haiku] Analyze the logs",
+		"[ model = glm-4.0 ] Fix the bug",
+		"Write the tests",
+	})
+	cf.Flags.HaikuModel = "small-model"
+	result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+
+	wantModels := []string{"small-model", "glm-4.0", "big-model"}
+	wantPrompts := []string{"Analyze the logs", "Your task:\nFix the bug", "Your task:\nWrite the tests"}
+	for i, dir := range result.JobDirs {
+		model, _ := os.ReadFile(filepath.Join(dir, "model"))
+		if string(model) != wantModels[i] {
+			t.Errorf("step %d: model = %q, want %q", i+1, model, wantModels[i])
+		}
+		prompt, _ := os.ReadFile(filepath.Join(dir, "prompt.txt"))
+		if !strings.HasSuffix(string(prompt), wantPrompts[i]) || strings.Contains(string(prompt), "[") {
+			t.Errorf("step %d: prompt.txt = %q, want it to end in %q without the prefix", i+1, prompt, wantPrompts[i])
+		}
+	}
+	if result.Steps[0].Name != "analyze" {
+		t.Errorf("step 1 name = %q, want analyze", result.Steps[0].Name)
+	}
+
+	// Without a flag, a slot falls back to -m and then to the configured model.
+	cf = chainFlags(".", 0, "", false, []string{"[slot=opus] a", "[slot=sonnet] b"})
+	cf.Config = &config.Config{OpusModel: "cfg-opus", SonnetModel: "cfg-sonnet"}
+	if result, err = cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr); err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	for i, want := range []string{"cfg-opus", "cfg-sonnet"} {
+		if model, _ := os.ReadFile(filepath.Join(result.JobDirs[i], "model")); string(model) != want {
+			t.Errorf("step %d: model = %q, want %q", i+1, model, want)
+		}
+	}
+}
+
+// Scenario: a prompt that starts with "[" is written as "[["
+func TestChainStepPrefixEscape(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	var stdout, stderr bytes.Buffer
+
+	result, err := cmd.ChainCmd(chainFlags(".", 0, "m", false, []string{"[[WIP] tidy up"}), root, "test-project", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ChainCmd error: %v", err)
+	}
+	if prompt, _ := os.ReadFile(filepath.Join(result.JobDirs[0], "prompt.txt")); string(prompt) != "[WIP] tidy up" {
+		t.Errorf("prompt.txt = %q, want %q", prompt, "[WIP] tidy up")
+	}
+	if model, _ := os.ReadFile(filepath.Join(result.JobDirs[0], "model")); string(model) != "m" {
+		t.Errorf("model = %q, want %q", model, "m")
+	}
+}
+
+// Scenario: a bad step prefix fails the chain before any step runs
+func TestChainStepPrefixErrors(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"[temperature=0] b", `err:user "Step 2: unknown key temperature`},
+		{"[slot=tiny] b", `err:user "Step 2: unknown slot tiny`},
+		{"[WIP] b", `err:user "Step 2: prefix [WIP] needs key=value`},
+		{"[model=x b", `err:user "Step 2: prefix has no closing ]`},
+		{"[model=x,slot=haiku] b", `err:user "Step 2: prefix [model=x,slot=haiku] sets both`},
+	}
+	for _, tt := range tests {
+		root := makeSubagentsRoot(t)
+		var stdout, stderr bytes.Buffer
+		_, err := cmd.ChainCmd(chainFlags(".", 0, "", false, []string{"a", tt.prompt}), root, "test-project", &stdout, &stderr)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%q: err = %v, want prefix %q", tt.prompt, err, tt.want)
+		}
+		if entries, _ := os.ReadDir(filepath.Join(root, "test-project")); len(entries) != 0 {
+			t.Errorf("%q: %d entries created, want none", tt.prompt, len(entries))
+		}
+	}
+}
+
+// chainTableRows returns the rows of the step table at the end of a chain's
+// stderr, each split into its fields.
+func chainTableRows(t *testing.T, stderr string) [][]string {
+	t.Helper()
+	_, table, ok := strings.Cut(stderr, "STEP ")
+	if !ok {
+		t.Fatalf("no step table in stderr:\n%s", stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "JOB_ID STATUS DURATION" {
+		t.Errorf("table header = %q", lines[0])
+	}
+	var rows [][]string
+	for _, line := range lines[1:] {
+		rows = append(rows, strings.Fields(line))
+	}
+	return rows
+}
+
+// Scenario: each step prints its status and duration when it ends, and the chain ends with a table of every step; failed and skipped steps keep their status
+func TestChainStepTiming(t *testing.T) {
+	tests := []struct {
+		name            string
+		dir             string
+		continueOnError bool
+		statuses        []string
+	}{
+		{"success", ".", false, []string{"done", "done", "done"}},
+		{"stop on error", "/nonexistent-dir-that-does-not-exist", false, []string{"failed", "skipped", "skipped"}},
+		{"continue on error", "/nonexistent-dir-that-does-not-exist", true, []string{"failed", "failed", "failed"}},
+	}
+	for _, tt := range tests {
+		root := makeSubagentsRoot(t)
+		var stdout, stderr bytes.Buffer
+		result, err := cmd.ChainCmd(chainFlags(tt.dir, 0, "", tt.continueOnError, []string{"a", "b", "c"}), root, "test-project", &stdout, &stderr)
+		if err != nil {
+			t.Fatalf("%s: ChainCmd error: %v", tt.name, err)
+		}
+
+		rows := chainTableRows(t, stderr.String())
+		if len(rows) != 3 {
+			t.Fatalf("%s: %d table rows, want 3:\n%s", tt.name, len(rows), stderr.String())
+		}
+		for i, rec := range result.Steps {
+			want := []string{strconv.Itoa(i + 1), "-", tt.statuses[i], "-"}
+			if rec.Status != tt.statuses[i] {
+				t.Errorf("%s: step %d status %s, want %s", tt.name, i+1, rec.Status, tt.statuses[i])
+			}
+			if rec.Status == cmd.ChainStepSkipped {
+				if rec.StartedAt != "" || rec.FinishedAt != "" {
+					t.Errorf("%s: skipped step %d has timing %q-%q", tt.name, i+1, rec.StartedAt, rec.FinishedAt)
+				}
+			} else {
+				want[1], want[3] = rec.JobID, fmt.Sprintf("%ds", rec.DurationSeconds)
+				if rec.StartedAt == "" || rec.FinishedAt == "" {
+					t.Errorf("%s: step %d has no timing", tt.name, i+1)
+				}
+				if m := job.LoadManifest(result.JobDirs[i]); m.StartedAt != rec.StartedAt || m.FinishedAt != rec.FinishedAt {
+					t.Errorf("%s: step %d timing %q-%q, job has %q-%q", tt.name, i+1, rec.StartedAt, rec.FinishedAt, m.StartedAt, m.FinishedAt)
+				}
+				if done := fmt.Sprintf("[%d/3] %s in %s\n", i+1, rec.Status, want[3]); !strings.Contains(stderr.String(), done) {
+					t.Errorf("%s: stderr missing %q", tt.name, done)
+				}
+			}
+			if strings.Join(rows[i], " ") != strings.Join(want, " ") {
+				t.Errorf("%s: table row %d = %q, want %q", tt.name, i+1, rows[i], want)
+			}
+		}
+	}
+}
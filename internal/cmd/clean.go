@@ -7,6 +7,9 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
 )
 
 // terminalStatuses is the set of statuses removed by CleanCmd in default mode.
@@ -16,44 +19,75 @@ var terminalStatuses = map[string]bool{
 	"timeout":          true,
 	"killed":           true,
 	"permission_error": true,
+	"context_exceeded": true,
+}
+
+// activeStatuses are the statuses of jobs that have not ended yet.
+var activeStatuses = map[string]bool{
+	"queued":  true,
+	"running": true,
+}
+
+// CleanOptions holds optional settings for CleanCmd.
+type CleanOptions struct {
+	// Out is the output policy; with Out.Quiet the "Cleaned N jobs" line is
+	// not printed. Its writers are not used; CleanCmd writes to w.
+	Out *Out
+	// ProjectID restricts cleaning to the jobs of this project (glm clean
+	// --project). Legacy jobs outside a project are left alone.
+	ProjectID string
+	// ProjectName restricts cleaning to the projects whose directory has
+	// this basename (glm clean --project-name): project IDs NAME-<cksum>,
+	// or the project ID itself. Legacy jobs are left alone.
+	ProjectName string
+	// Statuses restricts cleaning to jobs in these statuses (glm clean
+	// --status, see ParseStatusFilter). Running and queued jobs in the list
+	// are only removed with Force.
+	Statuses []string
+	// Force also removes running jobs whose process is dead and queued jobs
+	// stuck in the queue (see job.CheckJobPID and job.IsStaleQueued). Jobs
+	// with a live process are never removed, except by --days without
+	// --status.
+	Force bool
 }
 
 // CleanCmd removes jobs from subagentsRoot according to the following rules:
 //   - Without days: remove all jobs whose status is terminal
-//     (done, failed, timeout, killed, permission_error).
+//     (done, failed, timeout, killed, permission_error, context_exceeded).
 //   - With days >= 0: remove all jobs whose directory mtime is older than
 //     now minus days*24h, regardless of status.
 //     days == 0 removes all jobs.
 //
+// Both legacy jobs directly under subagentsRoot and the jobs of every
+// project directory are considered. opts narrow the selection by project
+// and status (see CleanOptions); they compose with days. A status list
+// always protects running and queued jobs unless opts.Force is set and the
+// job is dead (dead PID, or stuck in the queue).
+//
 // now is injected for deterministic testing (pass time.Now() in production).
 // days < 0 means "no --days flag" (status-based mode).
-// Prints "Cleaned N jobs" to w.
-// Returns an exitcode.Error (exit 1) when days is provided but invalid.
-func CleanCmd(subagentsRoot string, days int, now time.Time, w io.Writer) error {
+// Prints "Cleaned N jobs" to w, with the count per status when N > 0
+// ("Cleaned 3 jobs (done 2, failed 1)"), unless opts ask for quiet output.
+// Returns an errs.UserError (exit 1) when days is provided but invalid.
+func CleanCmd(subagentsRoot string, days int, now time.Time, w io.Writer, opts ...*CleanOptions) error {
+	o := &CleanOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	quiet := o.Out != nil && o.Out.Quiet
+
 	// days < -1 means invalid input from the CLI layer.
 	if days < -1 {
-		return fmt.Errorf("err:user invalid --days value: must be 0 or a positive integer")
+		return errs.User("invalid --days value: must be 0 or a positive integer")
 	}
 
-	entries, err := os.ReadDir(subagentsRoot)
-	if err != nil {
-		// Root doesn't exist: nothing to clean.
-		fmt.Fprintln(w, "Cleaned 0 jobs")
-		return nil
+	statuses := map[string]bool{}
+	for _, s := range o.Statuses {
+		statuses[s] = true
 	}
 
-	count := 0
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		if strings.HasPrefix(entry.Name(), ".") {
-			continue
-		}
-
-		jobDir := filepath.Join(subagentsRoot, entry.Name())
-
+	counts := map[string]int{}
+	for _, jobDir := range cleanCandidates(subagentsRoot, o) {
 		if days >= 0 {
 			// Age-based mode: remove jobs whose directory mtime is at or before
 			// now minus days*24h. For days=0, cutoff=now so all jobs are removed.
@@ -66,25 +100,131 @@ func CleanCmd(subagentsRoot string, days int, now time.Time, w io.Writer) error
 			if info.ModTime().After(cutoff) {
 				continue
 			}
-			if err := os.RemoveAll(jobDir); err == nil {
-				count++
-			}
-		} else {
-			// Status-based mode: remove terminal-status jobs.
-			statusPath := filepath.Join(jobDir, "status")
-			statusData, err := os.ReadFile(statusPath)
-			if err != nil {
+		}
+
+		status := string(job.LoadManifest(jobDir).Status)
+		if !validStatusMap[status] {
+			status = UnknownStatus
+		}
+		switch {
+		case len(statuses) > 0:
+			if !statuses[status] || !cleanable(jobDir, status, o.Force, now) {
 				continue
 			}
-			status := strings.TrimSpace(string(statusData))
-			if terminalStatuses[status] {
-				if err := os.RemoveAll(jobDir); err == nil {
-					count++
-				}
-			}
+		case days >= 0:
+			// --days alone removes jobs regardless of status.
+		case terminalStatuses[status]:
+		case !o.Force || !activeStatuses[status] || !cleanable(jobDir, status, true, now):
+			continue
+		}
+		if err := job.DeleteJob(jobDir); err == nil {
+			counts[status]++
 		}
 	}
 
-	fmt.Fprintf(w, "Cleaned %d jobs\n", count)
+	if !quiet {
+		fmt.Fprintln(w, cleanSummary(counts))
+	}
 	return nil
 }
+
+// cleanCandidates returns the job directories CleanCmd considers: legacy
+// jobs directly under subagentsRoot (a "job-" name or a status file) and
+// the job directories of each project, narrowed to the project of o.
+func cleanCandidates(subagentsRoot string, o *CleanOptions) []string {
+	entries, err := os.ReadDir(subagentsRoot)
+	if err != nil {
+		// Root doesn't exist: nothing to clean.
+		return nil
+	}
+	scoped := o.ProjectID != "" || o.ProjectName != ""
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(subagentsRoot, entry.Name())
+		if _, err := os.Stat(filepath.Join(path, "status")); err == nil || strings.HasPrefix(entry.Name(), "job-") {
+			if !scoped {
+				dirs = append(dirs, path)
+			}
+			continue
+		}
+		if scoped && !cleanProjectMatches(entry.Name(), o) {
+			continue
+		}
+		subs, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, sub := range subs {
+			if sub.IsDir() && !strings.HasPrefix(sub.Name(), ".") {
+				dirs = append(dirs, filepath.Join(path, sub.Name()))
+			}
+		}
+	}
+	return dirs
+}
+
+// cleanProjectMatches reports whether projectID is selected by the
+// ProjectID or ProjectName of o.
+func cleanProjectMatches(projectID string, o *CleanOptions) bool {
+	if o.ProjectID != "" && projectID != o.ProjectID {
+		return false
+	}
+	if o.ProjectName == "" || projectID == o.ProjectName {
+		return true
+	}
+	name, sum, ok := cutLast(projectID, "-")
+	if !ok || name != o.ProjectName || sum == "" {
+		return false
+	}
+	return strings.Trim(sum, "0123456789") == ""
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// cleanable reports whether a job in status may be removed. Running and
+// queued jobs only may with force, and only when dead: a running job whose
+// PID is gone (job.CheckJobPID marks it failed) or a queued job stuck in the
+// queue.
+func cleanable(jobDir, status string, force bool, now time.Time) bool {
+	switch status {
+	case string(job.StatusRunning):
+		if !force {
+			return false
+		}
+		current, err := job.CheckJobPID(jobDir)
+		return err == nil && current != string(job.StatusRunning)
+	case string(job.StatusQueued):
+		if !force {
+			return false
+		}
+		stale, err := job.IsStaleQueued(jobDir, now)
+		return err == nil && stale
+	}
+	return true
+}
+
+// cleanSummary returns the "Cleaned N jobs" line for counts per status,
+// the statuses in ValidStatuses order and "unknown" last.
+func cleanSummary(counts map[string]int) string {
+	total := 0
+	var parts []string
+	for _, s := range append(ValidStatuses(), UnknownStatus) {
+		if n := counts[s]; n > 0 {
+			total += n
+			parts = append(parts, fmt.Sprintf("%s %d", s, n))
+		}
+	}
+	if total == 0 {
+		return "Cleaned 0 jobs"
+	}
+	return fmt.Sprintf("Cleaned %d jobs (%s)", total, strings.Join(parts, ", "))
+}
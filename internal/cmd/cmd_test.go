@@ -2,15 +2,25 @@ package cmd_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/veschin/GoLeM/internal/claude"
 	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/exitcode"
 	"github.com/veschin/GoLeM/internal/job"
 )
 
@@ -147,6 +157,22 @@ func TestParseModeFlagSetsExplicitPermissionMode(t *testing.T) {
 	}
 }
 
+// Scenario: Parse --priority and reject an unknown level
+func TestParsePriorityFlag(t *testing.T) {
+	f, err := cmd.ParseFlags([]string{"--priority", "high", "Do something"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Priority != job.PriorityHigh {
+		t.Errorf("Priority: got %q, want %q", f.Priority, job.PriorityHigh)
+	}
+
+	_, err = cmd.ParseFlags([]string{"--priority", "urgent", "Do something"})
+	if err == nil || !strings.Contains(err.Error(), "Invalid priority: urgent") {
+		t.Errorf("err = %v, want Invalid priority", err)
+	}
+}
+
 // Scenario: Default working directory is current directory
 func TestDefaultWorkingDirectoryIsCurrentDirectory(t *testing.T) {
 	args := []string{"run", "Do something"}
@@ -197,6 +223,267 @@ func TestRemainingArgumentsAfterFlagsJoinedAsPrompt(t *testing.T) {
 	}
 }
 
+// ─── Flag syntax ──────────────────────────────────────────────────────────────
+
+// Scenario: "--flag value" and "--flag=value" parse identically, unknown flags
+// are rejected, and "--" lets a prompt start with a dash
+func TestParseFlagsSyntax(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    cmd.Flags
+		wantErr string
+	}{
+		{
+			name: "space separated",
+			args: []string{"-d", "/tmp", "-t", "60", "fix it"},
+			want: cmd.Flags{Dir: "/tmp", Timeout: 60, Prompt: "fix it"},
+		},
+		{
+			name: "equals form for short flags",
+			args: []string{"-d=/tmp", "-t=60", "-m=glm-4.5", "fix it"},
+			want: cmd.Flags{Dir: "/tmp", Timeout: 60, Model: "glm-4.5", Prompt: "fix it"},
+		},
+		{
+			name: "equals form for long flags",
+			args: []string{"--opus=o", "--sonnet=s", "--haiku=h", "--mode=plan", "fix"},
+			want: cmd.Flags{Dir: ".", OpusModel: "o", SonnetModel: "s", HaikuModel: "h", PermissionMode: "plan", Prompt: "fix"},
+		},
+		{
+			name: "value containing equals sign",
+			args: []string{"-d=/tmp/a=b", "fix"},
+			want: cmd.Flags{Dir: "/tmp/a=b", Prompt: "fix"},
+		},
+		{
+			name: "mixed forms with boolean flags",
+			args: []string{"--unsafe", "-t=30", "--keep", "fix"},
+			want: cmd.Flags{Dir: ".", Timeout: 30, PermissionMode: "bypassPermissions", Keep: true, Prompt: "fix"},
+		},
+		{
+			name: "double dash allows a dash-prefixed prompt",
+			args: []string{"-t", "60", "--", "-v is broken", "again"},
+			want: cmd.Flags{Dir: ".", Timeout: 60, Prompt: "-v is broken again"},
+		},
+		{
+			name: "flags after the prompt belong to the prompt",
+			args: []string{"explain", "--verbose"},
+			want: cmd.Flags{Dir: ".", Prompt: "explain --verbose"},
+		},
+		{
+			name:    "typo in long flag",
+			args:    []string{"--timout", "60", "fix"},
+			wantErr: `err:user "Unknown flag: --timout (valid flags: -d, -t, -m, --opus, --sonnet, --haiku, --base-url, --priority, --notify, --mode, --unsafe, --keep, --capture-diff, --strict-result, --confine, --expand-files, --i-know-what-im-doing, --allow-overlap, --allow-nested, --strict-disk, --max-output, --template, --context, --prompt, -v; use -- or --prompt TEXT for a prompt that starts with a dash)"`,
+		},
+		{
+			name:    "unknown flag in equals form",
+			args:    []string{"--model=glm-4", "fix"},
+			wantErr: `err:user "Unknown flag: --model=glm-4`,
+		},
+		{
+			name:    "empty inline value",
+			args:    []string{"-d=", "fix"},
+			wantErr: `err:user "Missing value for -d flag"`,
+		},
+		{
+			name:    "boolean flag with value",
+			args:    []string{"--unsafe=true", "fix"},
+			wantErr: `err:user "Flag --unsafe does not take a value"`,
+		},
+		{
+			name:    "non-numeric timeout in equals form",
+			args:    []string{"-t=abc", "fix"},
+			wantErr: `err:user "Timeout must be seconds (600) or a duration (10m, 1h30m): abc"`,
+		},
+		{
+			name:    "missing trailing value",
+			args:    []string{"--opus"},
+			wantErr: `err:user "Missing value for --opus flag"`,
+		},
+		{
+			name: "template with repeatable variables",
+			args: []string{"--template", "review", "-v", "file=src/main.go", "-v=focus=a=b"},
+			want: cmd.Flags{Dir: ".", Template: "review", Vars: map[string]string{"file": "src/main.go", "focus": "a=b"}},
+		},
+		{
+			name:    "variable without equals sign",
+			args:    []string{"--template=review", "-v", "file"},
+			wantErr: `err:user "Template variable must be key=value: file"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := cmd.ParseFlags(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFlags(%q) error = %v, want prefix %s", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFlags(%q): %v", tt.args, err)
+			}
+			if tt.want.Dir == "" {
+				tt.want.Dir = "."
+			}
+			if !reflect.DeepEqual(*f, tt.want) {
+				t.Errorf("ParseFlags(%q) = %+v, want %+v", tt.args, *f, tt.want)
+			}
+		})
+	}
+}
+
+// Scenario: Prompts that look like flags are kept as prompts
+func TestParseFlagsTrickyPrompts(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantPrompt string
+		wantDir    string
+		wantErr    string
+	}{
+		{name: "double dash inside one quoted prompt", args: []string{"-- analyze this diff"}, wantPrompt: "-- analyze this diff"},
+		{name: "prompt starting with -d", args: []string{"-d is the wrong flag here"}, wantPrompt: "-d is the wrong flag here"},
+		{name: "prompt starting with -t after a flag", args: []string{"-d", "/tmp", "-t 60 is too short"}, wantPrompt: "-t 60 is too short", wantDir: "/tmp"},
+		{name: "-t as literal prompt text after --", args: []string{"--", "-t", "60"}, wantPrompt: "-t 60"},
+		{name: "-- as literal prompt text after --", args: []string{"--", "--", "x"}, wantPrompt: "-- x"},
+		{name: "flag-like words after the first positional", args: []string{"fix", "-d", "/etc", "--unsafe"}, wantPrompt: "fix -d /etc --unsafe"},
+		{name: "embedded quotes", args: []string{`say "-d" and 'x'`}, wantPrompt: `say "-d" and 'x'`},
+		{name: "multi-line prompt starting with a dash", args: []string{"-\nlist item"}, wantPrompt: "-\nlist item"},
+		{name: "lone dash is a prompt", args: []string{"-"}, wantPrompt: "-"},
+		{name: "equals value with spaces is still a flag", args: []string{"-d=/tmp/my dir", "x"}, wantPrompt: "x", wantDir: "/tmp/my dir"},
+		{name: "--prompt", args: []string{"-d", "/tmp", "--prompt", "-t is literal"}, wantPrompt: "-t is literal", wantDir: "/tmp"},
+		{name: "--prompt in equals form", args: []string{"--prompt=-- all of it"}, wantPrompt: "-- all of it"},
+		{name: "--prompt before trailing --", args: []string{"--prompt", "x", "--"}, wantPrompt: "x"},
+		{name: "--prompt with positional text", args: []string{"--prompt", "x", "y"}, wantErr: `err:user "Prompt given twice: use either --prompt or positional text, not both"`},
+		{name: "--prompt with text after --", args: []string{"--prompt=x", "--", "-y"}, wantErr: `err:user "Prompt given twice`},
+		{name: "--prompt without a value", args: []string{"--prompt"}, wantErr: `err:user "Missing value for --prompt flag"`},
+		{name: "unknown single-word flag is still rejected", args: []string{"-x", "fix"}, wantErr: `err:user "Unknown flag: -x`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := cmd.ParseFlags(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFlags(%q) error = %v, want prefix %s", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFlags(%q): %v", tt.args, err)
+			}
+			if tt.wantDir == "" {
+				tt.wantDir = "."
+			}
+			if f.Prompt != tt.wantPrompt || f.Dir != tt.wantDir {
+				t.Errorf("ParseFlags(%q) prompt, dir = %q, %q; want %q, %q", tt.args, f.Prompt, f.Dir, tt.wantPrompt, tt.wantDir)
+			}
+		})
+	}
+}
+
+// Scenario: chain accepts flags anywhere, in either form, one prompt per arg
+func TestParseChainArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantFlags   cmd.Flags
+		wantPrompts []string
+		wantErr     string
+	}{
+		{
+			name:        "flags before prompts",
+			args:        []string{"-d", "/tmp", "p1", "p2"},
+			wantFlags:   cmd.Flags{Dir: "/tmp"},
+			wantPrompts: []string{"p1", "p2"},
+		},
+		{
+			name:        "flags between and after prompts",
+			args:        []string{"p1", "-t=90", "p2", "--unsafe", "p3"},
+			wantFlags:   cmd.Flags{Dir: ".", Timeout: 90, PermissionMode: "bypassPermissions"},
+			wantPrompts: []string{"p1", "p2", "p3"},
+		},
+		{
+			name:        "double dash keeps dash-prefixed prompts",
+			args:        []string{"-m=glm-4", "--", "-p1", "--p2"},
+			wantFlags:   cmd.Flags{Dir: ".", Model: "glm-4"},
+			wantPrompts: []string{"-p1", "--p2"},
+		},
+		{
+			name:        "dash-prefixed prompts with spaces and --prompt steps",
+			args:        []string{"-- review the diff", "--prompt", "-t is a step", "--prompt=p3", "-d", "/tmp"},
+			wantFlags:   cmd.Flags{Dir: "/tmp"},
+			wantPrompts: []string{"-- review the diff", "-t is a step", "p3"},
+		},
+		{
+			name:    "typo is rejected instead of dropped",
+			args:    []string{"p1", "--timout", "60", "p2"},
+			wantErr: `err:user "Unknown flag: --timout`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, prompts, err := cmd.ParseChainArgs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseChainArgs(%q) error = %v, want prefix %s", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseChainArgs(%q): %v", tt.args, err)
+			}
+			if !reflect.DeepEqual(*f, tt.wantFlags) {
+				t.Errorf("flags = %+v, want %+v", *f, tt.wantFlags)
+			}
+			if strings.Join(prompts, "|") != strings.Join(tt.wantPrompts, "|") {
+				t.Errorf("prompts = %q, want %q", prompts, tt.wantPrompts)
+			}
+		})
+	}
+}
+
+// Scenario: chain --then splits prompts into groups
+func TestParseChainGroups(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantGroups string
+		wantErr    string
+	}{
+		{name: "no --then keeps one prompt per group", args: []string{"p1", "-t", "60", "p2"}, wantGroups: "p1|p2"},
+		{name: "groups between --then", args: []string{"a", "b", "--then", "c", "--then", "d", "e"}, wantGroups: "a,b|c|d,e"},
+		{name: "--then after double dash", args: []string{"--", "-a", "--then", "-b"}, wantGroups: "-a|-b"},
+		{name: "leading --then", args: []string{"--then", "a"}, wantErr: `err:user "Empty chain group`},
+		{name: "doubled --then", args: []string{"a", "--then", "--then", "b"}, wantErr: `err:user "Empty chain group`},
+		{name: "trailing --then", args: []string{"a", "--then"}, wantErr: `err:user "Empty chain group`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, groups, err := cmd.ParseChainGroups(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseChainGroups(%q) error = %v, want prefix %s", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseChainGroups(%q): %v", tt.args, err)
+			}
+			var got []string
+			for _, g := range groups {
+				got = append(got, strings.Join(g, ","))
+			}
+			if strings.Join(got, "|") != tt.wantGroups {
+				t.Errorf("groups = %q, want %s", got, tt.wantGroups)
+			}
+		})
+	}
+}
+
 // ─── AC2: Directory validation ────────────────────────────────────────────────
 
 // Scenario: Non-existent directory returns error
@@ -219,6 +506,109 @@ func TestNonExistentDirectoryReturnsError(t *testing.T) {
 	}
 }
 
+// Scenario: Validate replaces a relative or symlinked directory by its absolute, symlink-free form
+func TestValidateCanonicalizesDirectory(t *testing.T) {
+	real, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(real, "project")
+	link := filepath.Join(real, "link")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(project, link); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	for _, dir := range []string{".", "../project", project, link, project + "/"} {
+		f := &cmd.Flags{Prompt: "Do something", Dir: dir, Timeout: 5}
+		if err := cmd.Validate(f); err != nil {
+			t.Fatalf("Validate(-d %s): %v", dir, err)
+		}
+		if f.Dir != project {
+			t.Errorf("Validate(-d %s) left Dir = %q, want %q", dir, f.Dir, project)
+		}
+	}
+}
+
+// ─── Working directory safety ─────────────────────────────────────────────────
+
+// Scenario: bypassPermissions is refused in root, system paths, home itself and outside home
+// Scenario: Project paths inside home, other modes and the override are allowed
+func TestSafetyCheckBlocksUnsafeWorkDirs(t *testing.T) {
+	home, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(home, "src", "app")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// A link inside home that points at a system path is judged by its target.
+	link := filepath.Join(home, "etc-link")
+	if err := os.Symlink("/etc", link); err != nil {
+		t.Fatal(err)
+	}
+	outside, _ := filepath.EvalSymlinks(t.TempDir())
+
+	tests := []struct {
+		name   string
+		dir    string
+		mode   string
+		allow  bool
+		reason string // empty: allowed
+	}{
+		{name: "root", dir: "/", mode: "bypassPermissions", reason: "filesystem root"},
+		{name: "etc", dir: "/etc", mode: "bypassPermissions", reason: "system path"},
+		{name: "below usr", dir: "/usr/bin", mode: "bypassPermissions", reason: "system path"},
+		{name: "symlink to etc", dir: link, mode: "bypassPermissions", reason: "system path"},
+		{name: "home itself", dir: home, mode: "bypassPermissions", reason: "home directory itself"},
+		{name: "outside home", dir: outside, mode: "bypassPermissions", reason: "outside your home directory"},
+		{name: "project in home", dir: project, mode: "bypassPermissions"},
+		{name: "relative path in home", dir: project + "/..", mode: "bypassPermissions"},
+		{name: "root with override", dir: "/", mode: "bypassPermissions", allow: true},
+		{name: "root in acceptEdits", dir: "/", mode: "acceptEdits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cmd.SafetyCheck(tt.dir, tt.mode, &cmd.SafetyOptions{Home: home, AllowUnsafePaths: tt.allow})
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("SafetyCheck(%s) = %v, want nil", tt.dir, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("SafetyCheck(%s) = nil, want an error", tt.dir)
+			}
+			msg := err.Error()
+			if !strings.HasPrefix(msg, "err:user") || !strings.Contains(msg, tt.reason) {
+				t.Errorf("error = %q, want err:user with %q", msg, tt.reason)
+			}
+			resolved, _ := filepath.EvalSymlinks(tt.dir)
+			if !strings.Contains(msg, " in "+resolved+":") {
+				t.Errorf("error = %q, want it to name %s", msg, resolved)
+			}
+		})
+	}
+}
+
+// Scenario: --i-know-what-im-doing parses into the override
+func TestParseFlagsUnsafePathOverride(t *testing.T) {
+	f, err := cmd.ParseFlags([]string{"--unsafe", "--i-know-what-im-doing", "-d", "/", "fix"})
+	if err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if !f.AllowUnsafePaths {
+		t.Error("AllowUnsafePaths = false, want true")
+	}
+	if err := cmd.SafetyCheck(f.Dir, f.PermissionMode, &cmd.SafetyOptions{AllowUnsafePaths: f.AllowUnsafePaths}); err != nil {
+		t.Errorf("SafetyCheck with override: %v", err)
+	}
+}
+
 // ─── AC3: Timeout validation ──────────────────────────────────────────────────
 
 // Scenario: Non-numeric timeout returns error
@@ -228,7 +618,7 @@ func TestNonNumericTimeoutReturnsError(t *testing.T) {
 	f, err := cmd.ParseFlags(args[1:])
 	if err != nil {
 		// Parsing itself may return the error for non-numeric -t.
-		want := `err:user "Timeout must be a positive number: abc"`
+		want := `err:user "Timeout must be seconds (600) or a duration (10m, 1h30m): abc"`
 		if err.Error() != want {
 			t.Errorf("ParseFlags error: got %q, want %q", err.Error(), want)
 		}
@@ -245,6 +635,57 @@ func TestNonNumericTimeoutReturnsError(t *testing.T) {
 	}
 }
 
+// Scenario: -t accepts plain seconds and Go durations, normalised to seconds
+func TestTimeoutAcceptsSecondsAndDurations(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "600", want: 600},
+		{value: "90s", want: 90},
+		{value: "10m", want: 600},
+		{value: "1h30m", want: 5400},
+		{value: "2h", want: 7200},
+		{value: "1m30.5s", want: 90},
+		{value: "abc", wantErr: true},
+		{value: "10x", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "m10", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			for _, args := range [][]string{{"-t", tt.value, "fix"}, {"-t=" + tt.value, "fix"}} {
+				f, err := cmd.ParseFlags(args)
+				if tt.wantErr {
+					want := fmt.Sprintf(`err:user "Timeout must be seconds (600) or a duration (10m, 1h30m): %s"`, tt.value)
+					if err == nil || err.Error() != want {
+						t.Errorf("ParseFlags(%q) error = %v, want %s", args, err, want)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("ParseFlags(%q): %v", args, err)
+				}
+				if f.Timeout != tt.want {
+					t.Errorf("ParseFlags(%q).Timeout = %d, want %d", args, f.Timeout, tt.want)
+				}
+			}
+		})
+	}
+
+	// Durations that round down to zero or are negative still fail validation.
+	for _, value := range []string{"500ms", "-5m"} {
+		f, err := cmd.ParseFlags([]string{"-t=" + value, "fix"})
+		if err != nil {
+			t.Fatalf("ParseFlags(-t=%s): %v", value, err)
+		}
+		if err := cmd.Validate(f); err == nil {
+			t.Errorf("Validate accepted -t %s", value)
+		}
+	}
+}
+
 // Scenario: Negative timeout returns error
 func TestNegativeTimeoutReturnsError(t *testing.T) {
 	args := []string{"run", "-t", "-5", "Do something"}
@@ -310,6 +751,25 @@ func TestNoPromptProvidedReturnsError(t *testing.T) {
 	}
 }
 
+// Scenario: A prompt above max_prompt_bytes is rejected with its size
+func TestValidateRejectsOversizePrompt(t *testing.T) {
+	f := &cmd.Flags{Dir: ".", Timeout: 60, Prompt: strings.Repeat("x", 300<<10)}
+	err := cmd.Validate(f)
+	want := `err:user "Prompt too large: 307200 bytes (max_prompt_bytes is 204800)"`
+	if err == nil || err.Error() != want {
+		t.Errorf("Validate default limit: got %v, want %s", err, want)
+	}
+
+	f.Prompt = "0123456789"
+	err = cmd.Validate(f, &cmd.ValidateOptions{MaxPromptBytes: 5})
+	if err == nil || !strings.Contains(err.Error(), "10 bytes (max_prompt_bytes is 5)") {
+		t.Errorf("Validate configured limit: got %v", err)
+	}
+	if err := cmd.Validate(f, &cmd.ValidateOptions{MaxPromptBytes: 10}); err != nil {
+		t.Errorf("Validate at the limit: %v", err)
+	}
+}
+
 // ─── AC5: glm run — synchronous execution ────────────────────────────────────
 
 // Scenario: Run command executes and prints result
@@ -323,7 +783,7 @@ func TestRunCommandExecutesAndPrintsResult(t *testing.T) {
 	}
 
 	var stdoutBuf, stderrBuf bytes.Buffer
-	result, err := cmd.RunCmd(f, root, projectID, &stdoutBuf, &stderrBuf)
+	result, err := cmd.RunCmd(f, root, projectID, &stdoutBuf, &stderrBuf, &cmd.RunOptions{Keep: false})
 	if err != nil {
 		t.Fatalf("RunCmd unexpected error: %v", err)
 	}
@@ -384,7 +844,7 @@ func TestRunCommandPrintsStderrOnExecutionFailure(t *testing.T) {
 	var stdoutBuf, stderrBuf bytes.Buffer
 	f := &cmd.Flags{Dir: t.TempDir(), Timeout: 60, Prompt: "p"}
 
-	result, err := cmd.RunCmd(f, root, projectID, &stdoutBuf, &stderrBuf)
+	result, err := cmd.RunCmd(f, root, projectID, &stdoutBuf, &stderrBuf, &cmd.RunOptions{Keep: false})
 	if err != nil {
 		t.Fatalf("RunCmd unexpected error: %v", err)
 	}
@@ -403,6 +863,79 @@ func TestRunCommandPrintsStderrOnExecutionFailure(t *testing.T) {
 	}
 }
 
+// ─── Run summary line ─────────────────────────────────────────────────────────
+
+// Scenario: The --summary line reports job, status, duration, changed files and exit code
+func TestRunSummaryFormat(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		name      string
+		jobID     string
+		status    string
+		changelog string
+		exitCode  int
+		want      string
+	}{
+		{
+			name:      "done",
+			jobID:     "job-20260227-100002-c3d4e5f6",
+			status:    "done",
+			changelog: "EDIT /a.go: 10 chars\nWRITE /b.go\nDELETE via bash: rm /c.go\nNOTEBOOK /d.ipynb\n",
+			want:      "glm: job=job-20260227-100002-c3d4e5f6 status=done duration=83s files_changed=4 exit=0",
+		},
+		{
+			name:      "failed",
+			jobID:     "job-20260227-100003-d4e5f6a7",
+			status:    "failed",
+			changelog: "WRITE /b.go",
+			exitCode:  1,
+			want:      "glm: job=job-20260227-100003-d4e5f6a7 status=failed duration=83s files_changed=1 exit=1",
+		},
+		{
+			name:      "no changes",
+			jobID:     "job-20260227-100004-e5f6a7b8",
+			status:    "done",
+			changelog: "(no file changes)",
+			want:      "glm: job=job-20260227-100004-e5f6a7b8 status=done duration=83s files_changed=0 exit=0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := makeJobDir(t, root, "proj", tt.jobID, tt.status)
+			writeJobFile(t, dir, "changelog.txt", tt.changelog)
+			writeJobFile(t, dir, "duration_seconds.txt", "83")
+			if got := cmd.RunSummary(dir, tt.jobID, tt.exitCode); got != tt.want {
+				t.Errorf("RunSummary =\n  %q\nwant\n  %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Scenario: The summary goes to stderr on its own line and never to stdout
+func TestRunCommandSummaryGoesToStderr(t *testing.T) {
+	root := t.TempDir()
+	projectID := "test-project"
+
+	jobID := "job-20260227-100005-f6a7b8c9"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writeJobFile(t, dir, "stdout.txt", "result")
+	writeJobFile(t, dir, "changelog.txt", "(no file changes)")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	f := &cmd.Flags{Dir: t.TempDir(), Timeout: 60, Prompt: "p"}
+	if _, err := cmd.RunCmd(f, root, projectID, &stdoutBuf, &stderrBuf, &cmd.RunOptions{Summary: true}); err != nil {
+		t.Fatalf("RunCmd unexpected error: %v", err)
+	}
+
+	if stdoutBuf.String() != "result" {
+		t.Errorf("stdout = %q, want only the job output", stdoutBuf.String())
+	}
+	want := "(no file changes)\nglm: job=" + jobID + " status=done duration=0s files_changed=0 exit=0\n"
+	if stderrBuf.String() != want {
+		t.Errorf("stderr = %q, want %q", stderrBuf.String(), want)
+	}
+}
+
 // ─── AC7: glm start — async execution ────────────────────────────────────────
 
 // Scenario: Start command writes PID before printing job ID
@@ -706,6 +1239,123 @@ func TestStatusConfirmsRunningJobWithLivePID(t *testing.T) {
 	}
 }
 
+// Scenario: status --verbose prints a key: value block with timing
+func TestStatusVerbosePrintsTimingBlock(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-101500-verb0001"
+
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writePID(t, dir, 4242)
+	for name, content := range map[string]string{
+		"started_at.txt":  "2026-02-27T10:15:00Z",
+		"finished_at.txt": "2026-02-27T10:16:30Z",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	var stdoutBuf bytes.Buffer
+	if _, err := cmd.StatusCmd(jobID, root, projectID, &stdoutBuf, &cmd.StatusOptions{Verbose: true}); err != nil {
+		t.Fatalf("StatusCmd unexpected error: %v", err)
+	}
+
+	want := "status: done\npid: 4242\nstarted_at: 2026-02-27T10:15:00Z\nfinished_at: 2026-02-27T10:16:30Z\nduration_seconds: 90\n"
+	if stdoutBuf.String() != want {
+		t.Errorf("stdout: got %q, want %q", stdoutBuf.String(), want)
+	}
+}
+
+// Scenario: Duration is computed from instants when start and finish carry different offsets
+func TestStatusDurationAcrossOffsets(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-090000-offs0001"
+
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writeJobFile(t, dir, "started_at.txt", "2026-02-27T12:00:00+03:00")
+	writeJobFile(t, dir, "finished_at.txt", "2026-02-27T09:01:30Z")
+
+	var stdoutBuf bytes.Buffer
+	if _, err := cmd.StatusCmd(jobID, root, projectID, &stdoutBuf, &cmd.StatusOptions{Verbose: true}); err != nil {
+		t.Fatalf("StatusCmd unexpected error: %v", err)
+	}
+	if !strings.Contains(stdoutBuf.String(), "duration_seconds: 90\n") {
+		t.Errorf("stdout: got %q, want duration_seconds: 90", stdoutBuf.String())
+	}
+}
+
+// ─── Status of all active jobs ────────────────────────────────────────────────
+
+// Scenario: glm status without a job ID prints nothing for a project with no active jobs
+func TestStatusAllEmptyProject(t *testing.T) {
+	root := t.TempDir()
+	makeJobDir(t, root, "proj", "job-20260227-100000-done0001", "done")
+
+	var buf bytes.Buffer
+	if err := cmd.StatusAllCmd(root, "proj", &buf); err != nil {
+		t.Fatalf("StatusAllCmd: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("stdout = %q, want nothing", buf.String())
+	}
+	buf.Reset()
+	if err := cmd.StatusAllJSON(root, "missing-project", &buf); err != nil {
+		t.Fatalf("StatusAllJSON: %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("json = %q, want []", buf.String())
+	}
+}
+
+// Scenario: Only queued and running jobs of the current project are listed, oldest first
+// Scenario: A running job whose process died flips to failed and is left out
+func TestStatusAllListsActiveJobs(t *testing.T) {
+	root := t.TempDir()
+	started := time.Now().Add(-90 * time.Second).UTC().Format(time.RFC3339)
+
+	running := makeJobDir(t, root, "proj", "job-20260227-100000-run00001", "running")
+	writePID(t, running, os.Getpid())
+	writeJobFile(t, running, "started_at.txt", started)
+	makeJobDir(t, root, "proj", "job-20260227-100100-que00001", "queued")
+	makeJobDir(t, root, "proj", "job-20260227-095900-done0001", "done")
+	makeJobDir(t, root, "proj", "job-20260227-095800-fail0001", "failed")
+	stale := makeJobDir(t, root, "proj", "job-20260227-095700-dead0001", "running")
+	writePID(t, stale, deadPID())
+	makeJobDir(t, root, "other", "job-20260227-100200-run00002", "running")
+
+	var buf bytes.Buffer
+	if err := cmd.StatusAllCmd(root, "proj", &buf); err != nil {
+		t.Fatalf("StatusAllCmd: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	if f := strings.Fields(lines[0]); f[0] != "job-20260227-100000-run00001" || f[1] != "running" || !strings.HasPrefix(f[2], "1m3") {
+		t.Errorf("line 1 = %q, want the running job with about 1m30s elapsed", lines[0])
+	}
+	if f := strings.Fields(lines[1]); f[0] != "job-20260227-100100-que00001" || f[1] != "queued" || f[2] != "-" {
+		t.Errorf("line 2 = %q, want the queued job", lines[1])
+	}
+	if got := readStatus(t, stale); got != "failed" {
+		t.Errorf("stale job status = %q, want failed", got)
+	}
+
+	buf.Reset()
+	if err := cmd.StatusAllJSON(root, "proj", &buf); err != nil {
+		t.Fatalf("StatusAllJSON: %v", err)
+	}
+	var items []cmd.JobStatusJSON
+	if err := json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.String(), err)
+	}
+	if len(items) != 2 || items[0].PID != os.Getpid() || items[0].ElapsedSeconds == nil || items[1].Status != "queued" {
+		t.Errorf("json = %s", buf.String())
+	}
+}
+
 // ─── AC12: Status job not found ───────────────────────────────────────────────
 
 // Scenario: Status on non-existent job returns not_found
@@ -842,6 +1492,83 @@ func TestResultOnPermissionErrorJobPrintsStderrAsWarning(t *testing.T) {
 	}
 }
 
+// Scenario: Result on context_exceeded job prints stderr and a hint to split the task
+func TestResultOnContextExceededJobPrintsHint(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100008-c9d0e1f2"
+	dir := makeJobDir(t, root, projectID, jobID, "context_exceeded")
+	writeJobFile(t, dir, "stderr.txt", "API Error: 400 prompt is too long: 215832 tokens > 200000 maximum\n")
+	writeJobFile(t, dir, "stdout.txt", "")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if _, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Keep: true}); err != nil {
+		t.Fatalf("ResultCmd unexpected error: %v", err)
+	}
+	if !strings.Contains(stderrBuf.String(), "prompt is too long") || !strings.Contains(stderrBuf.String(), cmd.ContextExceededHint) {
+		t.Errorf("stderr = %q, want the job's stderr and the hint", stderrBuf.String())
+	}
+
+	statuses, err := cmd.ParseStatusFilter("context_exceeded")
+	if err != nil {
+		t.Fatalf("ParseStatusFilter: %v", err)
+	}
+	items := cmd.ListJobs(root, &cmd.FilterOptions{Statuses: statuses})
+	if len(items) != 1 || items[0].Status != "context_exceeded" || items[0].ErrorSummary == nil || !strings.Contains(*items[0].ErrorSummary, "prompt is too long") {
+		t.Errorf("ListJobs(context_exceeded) = %+v", items)
+	}
+}
+
+// Scenario: result --strict-result fails a done job whose result matches a failure marker
+func TestResultStrictResultMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		stdout   string
+		markers  []string
+		wantCode int
+		wantNote string
+	}{
+		{"matching", "I was unable to run the tests.", config.DefaultResultFailureMarkers, 1, `"I was unable"`},
+		{"not matching", "All 12 tests pass.", config.DefaultResultFailureMarkers, 0, ""},
+		{"custom marker", "BLOCKED: needs credentials", []string{"BLOCKED:"}, 1, `"BLOCKED:"`},
+		{"default marker replaced", "I was unable to run the tests.", []string{"BLOCKED:"}, 0, ""},
+	}
+	for i, tt := range tests {
+		root := t.TempDir()
+		jobID := fmt.Sprintf("job-20260227-1000%02d-5781c700", i)
+		dir := makeJobDir(t, root, "proj", jobID, "done")
+		writeJobFile(t, dir, "stdout.txt", tt.stdout)
+
+		var stdoutBuf, stderrBuf bytes.Buffer
+		result, err := cmd.ResultCmd(jobID, root, "proj", &stdoutBuf, &stderrBuf,
+			&cmd.ResultOptions{Keep: true, StrictResult: true, FailureMarkers: tt.markers})
+		if err != nil {
+			t.Fatalf("%s: ResultCmd: %v", tt.name, err)
+		}
+		wantStatus := job.StatusDone
+		if tt.wantNote != "" {
+			wantStatus = job.StatusFailed
+		}
+		if result.ExitCode != tt.wantCode || job.ReadStatus(dir) != wantStatus || stdoutBuf.String() != tt.stdout {
+			t.Errorf("%s: exit %d, status %s, stdout %q; want %d, %s", tt.name, result.ExitCode, job.ReadStatus(dir), stdoutBuf.String(), tt.wantCode, wantStatus)
+		}
+		note := "[GoLeM] Result matched failure marker " + tt.wantNote
+		if got := stderrBuf.String(); (tt.wantNote != "") != strings.Contains(got, note) {
+			t.Errorf("%s: stderr = %q", tt.name, got)
+		}
+	}
+
+	// Without --strict-result the same output is an ordinary done result.
+	root := t.TempDir()
+	dir := makeJobDir(t, root, "proj", "job-20260227-100100-5781c700", "done")
+	writeJobFile(t, dir, "stdout.txt", "Error: could not find the file")
+	var stdoutBuf, stderrBuf bytes.Buffer
+	result, err := cmd.ResultCmd("job-20260227-100100-5781c700", root, "proj", &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Keep: true})
+	if err != nil || result.ExitCode != 0 || job.ReadStatus(dir) != job.StatusDone {
+		t.Errorf("non-strict: exit %d, status %s, err %v", result.ExitCode, job.ReadStatus(dir), err)
+	}
+}
+
 // ─── AC15: Result prints stdout and auto-deletes ──────────────────────────────
 
 // Scenario: Result prints stdout and deletes job directory
@@ -853,7 +1580,7 @@ func TestResultPrintsStdoutAndDeletesJobDirectory(t *testing.T) {
 	writeJobFile(t, dir, "stdout.txt", "Task completed successfully")
 
 	var stdoutBuf, stderrBuf bytes.Buffer
-	result, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf)
+	result, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Keep: false})
 	if err != nil {
 		t.Fatalf("ResultCmd unexpected error: %v", err)
 	}
@@ -973,6 +1700,30 @@ func TestRunInterruptedWithCtrlCPropagatesSignal(t *testing.T) {
 	}
 }
 
+// Scenario: result --json shows claude's stderr and the reconcile message together
+func TestResultShowsCombinedStderrHistory(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-100012-a3b4c5d6"
+	dir := makeJobDir(t, root, "proj", jobID, "running")
+	writePID(t, dir, deadPID())
+	writeJobFile(t, dir, "stderr.txt", "Error: tool crashed\n")
+
+	if status, err := job.CheckJobPID(dir); err != nil || status != "failed" {
+		t.Fatalf("CheckJobPID = %q, %v; want failed", status, err)
+	}
+	var buf bytes.Buffer
+	if err := cmd.ResultJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("ResultJSON: %v", err)
+	}
+	var result cmd.JobResultJSON
+	if err := json.Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "failed" || !strings.HasPrefix(result.Stderr, "Error: tool crashed\n") || !strings.Contains(result.Stderr, "[GoLeM] Process died unexpectedly") {
+		t.Errorf("result = %+v, want failed with both stderr lines", result)
+	}
+}
+
 // Scenario: Empty stdout.txt prints nothing
 func TestEmptyStdoutTxtPrintsNothing(t *testing.T) {
 	root := t.TempDir()
@@ -1027,3 +1778,765 @@ func TestStatusCalledConcurrentlyWithExecutionCompleting(t *testing.T) {
 		t.Errorf("concurrent status: got corrupted value %q", status)
 	}
 }
+
+// ─── Result output selectors ──────────────────────────────────────────────────
+
+// Scenario: Result --keep leaves the job directory in place
+func TestResultKeepSkipsAutoDelete(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100011-f2a3b4c5"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writeJobFile(t, dir, "stdout.txt", "kept output")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	result, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Keep: true})
+	if err != nil {
+		t.Fatalf("ResultCmd unexpected error: %v", err)
+	}
+	if result.Deleted {
+		t.Error("ResultCmd: Deleted should be false with Keep")
+	}
+	if _, statErr := os.Stat(dir); statErr != nil {
+		t.Errorf("ResultCmd: job directory should survive, stat error: %v", statErr)
+	}
+	if stdoutBuf.String() != "kept output" {
+		t.Errorf("stdout: got %q, want %q", stdoutBuf.String(), "kept output")
+	}
+}
+
+// Scenario: Result --output DIR copies all three artifacts before deleting
+func TestResultOutputDirCopiesArtifacts(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100012-a3b4c5d6"
+	dir := makeJobDir(t, root, projectID, jobID, "failed")
+	writeJobFile(t, dir, "stdout.txt", "out")
+	writeJobFile(t, dir, "stderr.txt", "err")
+	writeJobFile(t, dir, "changelog.txt", "EDIT main.go: 1 replacement(s)")
+
+	dest := t.TempDir()
+	var stdoutBuf, stderrBuf bytes.Buffer
+	result, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Output: dest})
+	if err != nil {
+		t.Fatalf("ResultCmd unexpected error: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"stdout.txt":    "out",
+		"stderr.txt":    "err",
+		"changelog.txt": "EDIT main.go: 1 replacement(s)",
+	} {
+		data, readErr := os.ReadFile(filepath.Join(dest, name))
+		if readErr != nil {
+			t.Errorf("%s: not copied: %v", name, readErr)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s: got %q, want %q", name, string(data), want)
+		}
+	}
+	if !result.Deleted {
+		t.Error("ResultCmd: Deleted should be true")
+	}
+	if !strings.Contains(stderrBuf.String(), "err") {
+		t.Errorf("stderr: expected failed-status warning, got %q", stderrBuf.String())
+	}
+}
+
+// Scenario: Result --output FILE writes stdout to FILE with siblings alongside
+func TestResultOutputFileWritesSiblings(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100013-b4c5d6e7"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writeJobFile(t, dir, "stdout.txt", "out")
+	writeJobFile(t, dir, "changelog.txt", "(no file changes)")
+
+	dest := filepath.Join(t.TempDir(), "artifacts", "result.txt")
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if _, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Output: dest}); err != nil {
+		t.Fatalf("ResultCmd unexpected error: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		dest:                    "out",
+		dest + ".stderr.txt":    "",
+		dest + ".changelog.txt": "(no file changes)",
+	} {
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			t.Errorf("%s: not written: %v", path, readErr)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s: got %q, want %q", path, string(data), want)
+		}
+	}
+}
+
+// Scenario: Result --changelog-only prints only the changelog
+func TestResultChangelogOnlyPrintsChangelog(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100014-c5d6e7f8"
+	dir := makeJobDir(t, root, projectID, jobID, "failed")
+	writeJobFile(t, dir, "stdout.txt", "out")
+	writeJobFile(t, dir, "stderr.txt", "err")
+	writeJobFile(t, dir, "changelog.txt", "WRITE a.go")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if _, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{ChangelogOnly: true}); err != nil {
+		t.Fatalf("ResultCmd unexpected error: %v", err)
+	}
+	if stdoutBuf.String() != "WRITE a.go" {
+		t.Errorf("stdout: got %q, want %q", stdoutBuf.String(), "WRITE a.go")
+	}
+	if stderrBuf.Len() != 0 {
+		t.Errorf("stderr: expected nothing, got %q", stderrBuf.String())
+	}
+}
+
+// Scenario: Result --stdout-only suppresses the failed-status warning
+func TestResultStdoutOnlySuppressesWarning(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100015-d6e7f8a9"
+	dir := makeJobDir(t, root, projectID, jobID, "failed")
+	writeJobFile(t, dir, "stdout.txt", "out")
+	writeJobFile(t, dir, "stderr.txt", "err")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if _, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{StdoutOnly: true}); err != nil {
+		t.Fatalf("ResultCmd unexpected error: %v", err)
+	}
+	if stdoutBuf.String() != "out" {
+		t.Errorf("stdout: got %q, want %q", stdoutBuf.String(), "out")
+	}
+	if stderrBuf.Len() != 0 {
+		t.Errorf("stderr: expected nothing, got %q", stderrBuf.String())
+	}
+}
+
+// Scenario: Result rejects --stdout-only combined with --changelog-only
+func TestResultSelectorsAreMutuallyExclusive(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100016-e7f8a9b0"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	result, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{StdoutOnly: true, ChangelogOnly: true})
+	if err == nil || !strings.Contains(err.Error(), "err:user") {
+		t.Fatalf("ResultCmd: expected err:user, got %v", err)
+	}
+	if result.ExitCode != 1 {
+		t.Errorf("ExitCode: got %d, want 1", result.ExitCode)
+	}
+	if _, statErr := os.Stat(dir); statErr != nil {
+		t.Errorf("job directory should not be deleted on error: %v", statErr)
+	}
+}
+
+// ─── Captured diff ────────────────────────────────────────────────────────────
+
+// Scenario: Result names the captured diff on stderr and log --diff prints it
+func TestResultAndLogShowCapturedDiff(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100012-a3b4c5d6"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writeJobFile(t, dir, "stdout.txt", "done")
+	patch := "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1,2 @@\n a\n+changed\n"
+	writeJobFile(t, dir, "diff.patch", patch)
+	writeJobFile(t, dir, "diff_stat.txt", " a.txt | 1 +\n 1 file changed, 1 insertion(+)\n")
+
+	var out bytes.Buffer
+	if err := cmd.LogCmd(root, projectID, jobID, &out, &cmd.LogOptions{Diff: true}); err != nil {
+		t.Fatalf("LogCmd --diff: %v", err)
+	}
+	if out.String() != patch {
+		t.Errorf("log --diff = %q, want the patch", out.String())
+	}
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if _, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Keep: true}); err != nil {
+		t.Fatalf("ResultCmd: %v", err)
+	}
+	want := "glm: diff: " + filepath.Join(dir, "diff.patch") + " (1 file changed, 1 insertion(+))\n"
+	if stderrBuf.String() != want {
+		t.Errorf("stderr = %q, want %q", stderrBuf.String(), want)
+	}
+
+	// Without a keep the patch goes with the job, and stderr says so.
+	stderrBuf.Reset()
+	if _, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf); err != nil {
+		t.Fatalf("ResultCmd: %v", err)
+	}
+	if !strings.Contains(stderrBuf.String(), "deleted with the job") {
+		t.Errorf("stderr = %q, want a note that the patch was deleted", stderrBuf.String())
+	}
+
+	// A job without a captured diff prints a placeholder.
+	other := "job-20260227-100013-b4c5d6e7"
+	makeJobDir(t, root, projectID, other, "done")
+	out.Reset()
+	if err := cmd.LogCmd(root, projectID, other, &out, &cmd.LogOptions{Diff: true}); err != nil {
+		t.Fatalf("LogCmd --diff: %v", err)
+	}
+	if out.String() != "(no diff captured)" {
+		t.Errorf("log --diff without a patch = %q", out.String())
+	}
+}
+
+// Scenario: glm log --stat aggregates the changelog by operation and by file
+func TestLogStatAggregatesChangelog(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	jobID := "job-20260227-100014-c5d6e7f8"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writeJobFile(t, dir, "changelog.txt", strings.Join([]string{
+		"EDIT src/api/routes/users.ts: 200 chars",
+		"EDIT src/api/routes/users.ts: 70 chars",
+		"WRITE src/api/routes/users.test.ts",
+		"EDIT src/api/routes/users.ts: 200 chars",
+		"NOTEBOOK notebooks/eda.ipynb",
+		"EDIT odd: name.go: 5 chars",
+		"DELETE via bash: rm -rf dist",
+		"DELETE via bash: rm tmp.log",
+		"FS: mkdir -p src/api/routes",
+		"EDIT broken line without chars",
+		"something else entirely",
+	}, "\n"))
+
+	var out bytes.Buffer
+	if err := cmd.LogCmd(root, projectID, jobID, &out, &cmd.LogOptions{Stat: true}); err != nil {
+		t.Fatalf("LogCmd --stat: %v", err)
+	}
+	want := "5 edits, 1 write, 2 deletes, 1 fs op\n" +
+		"src/api/routes/users.ts: 3 edits, 470 chars\n" +
+		"notebooks/eda.ipynb: 1 edit, 0 chars\n" +
+		"odd: name.go: 1 edit, 5 chars\n" +
+		"src/api/routes/users.test.ts: 1 write\n"
+	if out.String() != want {
+		t.Errorf("log --stat =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	writeJobFile(t, dir, "changelog.txt", "(no file changes)")
+	out.Reset()
+	if err := cmd.LogCmd(root, projectID, jobID, &out, &cmd.LogOptions{Stat: true}); err != nil {
+		t.Fatalf("LogCmd --stat: %v", err)
+	}
+	if out.String() != "(no file changes)\n" {
+		t.Errorf("log --stat without changes = %q", out.String())
+	}
+}
+
+// ─── Retention policy ─────────────────────────────────────────────────────────
+
+// Scenario: Run with Keep retains the job directory and reports where it lives
+func TestRunKeepRetainsJobDirectory(t *testing.T) {
+	root := t.TempDir()
+	projectID := "test-project"
+	jobID := "job-20260227-100017-f8a9b0c1"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+	writeJobFile(t, dir, "stdout.txt", "output")
+	writeJobFile(t, dir, "raw.json", `{"result":"output"}`)
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	f := &cmd.Flags{Dir: t.TempDir(), Timeout: 60, Prompt: "p"}
+
+	result, err := cmd.RunCmd(f, root, projectID, &stdoutBuf, &stderrBuf, &cmd.RunOptions{Keep: true})
+	if err != nil {
+		t.Fatalf("RunCmd unexpected error: %v", err)
+	}
+	if result.Deleted {
+		t.Error("RunCmd: Deleted should be false with Keep")
+	}
+	if result.JobDir != dir {
+		t.Errorf("JobDir: got %q, want %q", result.JobDir, dir)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "raw.json")); statErr != nil {
+		t.Errorf("raw.json should survive: %v", statErr)
+	}
+}
+
+// Scenario: --keep in Flags overrides a delete policy
+func TestRunKeepFlagOverridesDeletePolicy(t *testing.T) {
+	root := t.TempDir()
+	projectID := "test-project"
+	jobID := "job-20260227-100018-a9b0c1d2"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+
+	f, err := cmd.ParseFlags([]string{"--keep", "do the thing"})
+	if err != nil {
+		t.Fatalf("ParseFlags unexpected error: %v", err)
+	}
+	if !f.Keep {
+		t.Fatal("ParseFlags: Keep should be true")
+	}
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	result, err := cmd.RunCmd(f, root, projectID, &stdoutBuf, &stderrBuf, &cmd.RunOptions{Keep: false})
+	if err != nil {
+		t.Fatalf("RunCmd unexpected error: %v", err)
+	}
+	if result.Deleted {
+		t.Error("RunCmd: Deleted should be false with --keep")
+	}
+	if _, statErr := os.Stat(dir); statErr != nil {
+		t.Errorf("job directory should survive: %v", statErr)
+	}
+}
+
+// Scenario: Keeping a job prunes finished jobs older than retention_days
+func TestResultKeepPrunesExpiredJobs(t *testing.T) {
+	root := t.TempDir()
+	projectID := "proj"
+	old := time.Now().Add(-10 * 24 * time.Hour)
+
+	expired := makeJobDir(t, root, projectID, "job-20260101-100000-00000001", "done")
+	stillRunning := makeJobDir(t, root, projectID, "job-20260101-100000-00000002", "running")
+	for _, d := range []string{expired, stillRunning} {
+		if err := os.Chtimes(d, old, old); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	jobID := "job-20260227-100019-b0c1d2e3"
+	dir := makeJobDir(t, root, projectID, jobID, "done")
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	result, err := cmd.ResultCmd(jobID, root, projectID, &stdoutBuf, &stderrBuf, &cmd.ResultOptions{Keep: true, RetentionDays: 7})
+	if err != nil {
+		t.Fatalf("ResultCmd unexpected error: %v", err)
+	}
+	if result.Deleted || result.JobDir != dir {
+		t.Errorf("result: Deleted=%v JobDir=%q, want kept at %q", result.Deleted, result.JobDir, dir)
+	}
+	if _, statErr := os.Stat(dir); statErr != nil {
+		t.Errorf("current job should survive: %v", statErr)
+	}
+	if _, statErr := os.Stat(expired); !os.IsNotExist(statErr) {
+		t.Error("expired done job should be pruned")
+	}
+	if _, statErr := os.Stat(stillRunning); statErr != nil {
+		t.Errorf("running job must never be pruned: %v", statErr)
+	}
+}
+
+// Scenario: doctor lists per-model slot limits with the jobs running on each
+func TestDoctorReportsPerModelSlots(t *testing.T) {
+	root := t.TempDir()
+	projectID := "myapp-12345"
+	for i, model := range []string{"glm-5", "glm-4.7"} {
+		dir := makeJobDir(t, root, projectID, fmt.Sprintf("job-20260227-1000%02d-c0ffee00", i), "running")
+		if err := job.UpdateManifest(dir, func(m *job.Manifest) { m.Models.Sonnet = model }); err != nil {
+			t.Fatalf("UpdateManifest: %v", err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	err := cmd.DoctorCmd(cmd.DoctorOptions{
+		ClaudeBinaryName:    "glm-test-no-such-claude",
+		APIKeyPath:          filepath.Join(t.TempDir(), "zai_api_key"),
+		ZAIEndpoint:         srv.URL,
+		SubagentsRoot:       root,
+		MaxParallel:         3,
+		MaxParallelPerModel: map[string]int{"glm-5": 1, "glm-4.5-air": 4},
+	}, &buf)
+	if err != nil {
+		t.Fatalf("DoctorCmd: %v", err)
+	}
+	want := "2/3 slots in use; glm-4.5-air: 0/4, glm-5: 1/1"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("doctor output missing %q:\n%s", want, buf.String())
+	}
+}
+
+// Scenario: doctor flags a claude CLI older than the minimum supported version
+func TestDoctorFlagsOutdatedClaude(t *testing.T) {
+	for version, want := range map[string]string{"0.2.9 (Claude Code)": "FAIL", "1.0.38 (Claude Code)": "OK"} {
+		bin := filepath.Join(t.TempDir(), "claude")
+		if err := os.WriteFile(bin, []byte("#!/bin/sh\necho '"+version+"'\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		c := cmd.HealthChecks(cmd.DoctorOptions{ClaudePath: bin, SubagentsRoot: t.TempDir()})[0]
+		if c.Name != "claude_cli" || c.Status != want || !strings.HasPrefix(c.Detail, version) {
+			t.Errorf("claude %q: check = %+v, want %s", version, c, want)
+		}
+	}
+}
+
+// Scenario: status --json and result --json report the job's claude version
+func TestStatusAndResultJSONIncludeClaudeVersion(t *testing.T) {
+	root := t.TempDir()
+	dir := makeJobDir(t, root, "myapp-12345", "job-20260227-143205-a8f3b1c2", "done")
+	writeJobFile(t, dir, "claude_version.txt", "1.0.38\n")
+
+	for name, fn := range map[string]func(string, string, string, io.Writer) error{"status": cmd.StatusJSON, "result": cmd.ResultJSON} {
+		var buf bytes.Buffer
+		if err := fn(root, "myapp-12345", "a8f3b1c2", &buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.Contains(buf.String(), `"claude_version": "1.0.38"`) {
+			t.Errorf("%s --json missing claude_version:\n%s", name, buf.String())
+		}
+	}
+}
+
+// ─── Base URL ────────────────────────────────────────────────────────────────
+
+// Scenario: glm config set base_url validates the URL and config show reports it
+func TestConfigBaseURLSetAndShow(t *testing.T) {
+	configDir := t.TempDir()
+	err := cmd.ConfigSetCmd(cmd.ConfigSetOptions{ConfigDir: configDir, Key: "base_url", Value: "api.example.com"})
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("ConfigSetCmd(base_url=api.example.com) = %v, want err:user", err)
+	}
+	if err := cmd.ConfigSetCmd(cmd.ConfigSetOptions{ConfigDir: configDir, Key: "base_url", Value: "https://gateway.corp.example/anthropic"}); err != nil {
+		t.Fatalf("ConfigSetCmd: %v", err)
+	}
+
+	env := map[string]string{}
+	show := func() string {
+		var buf bytes.Buffer
+		opts := cmd.ConfigShowOptions{ConfigDir: configDir, EnvGetenv: func(k string) string { return env[k] }}
+		if err := cmd.ConfigShowCmd(opts, &buf); err != nil {
+			t.Fatalf("ConfigShowCmd: %v", err)
+		}
+		return buf.String()
+	}
+	if out := show(); !regexp.MustCompile(`base_url +https://gateway\.corp\.example/anthropic +\(config\)`).MatchString(out) {
+		t.Errorf("config show missing base_url from glm.toml:\n%s", out)
+	}
+	env["GLM_BASE_URL"] = "http://localhost:4000"
+	if out := show(); !regexp.MustCompile(`base_url +http://localhost:4000 +\(env\)`).MatchString(out) {
+		t.Errorf("config show missing base_url from GLM_BASE_URL:\n%s", out)
+	}
+}
+
+// Scenario: glm config set result_failure_markers writes a comma-separated list as an array
+func TestConfigSetResultFailureMarkers(t *testing.T) {
+	configDir := t.TempDir()
+	if err := cmd.ConfigSetCmd(cmd.ConfigSetOptions{ConfigDir: configDir, Key: "result_failure_markers", Value: "I was unable, BLOCKED:"}); err != nil {
+		t.Fatalf("ConfigSetCmd: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, "glm.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `result_failure_markers = ["I was unable", "BLOCKED:"]`; !strings.Contains(string(data), want) {
+		t.Errorf("glm.toml = %q, want a line %s", data, want)
+	}
+}
+
+// Scenario: config show masks serve_token
+func TestConfigShowMasksServeToken(t *testing.T) {
+	configDir := t.TempDir()
+	if err := cmd.ConfigSetCmd(cmd.ConfigSetOptions{ConfigDir: configDir, Key: "serve_token", Value: "s3cret-token"}); err != nil {
+		t.Fatalf("ConfigSetCmd: %v", err)
+	}
+	var buf bytes.Buffer
+	opts := cmd.ConfigShowOptions{ConfigDir: configDir, EnvGetenv: func(string) string { return "" }}
+	if err := cmd.ConfigShowCmd(opts, &buf); err != nil {
+		t.Fatalf("ConfigShowCmd: %v", err)
+	}
+	if out := buf.String(); strings.Contains(out, "s3cret-token") || !regexp.MustCompile(`serve_token +\*+ +\(config\)`).MatchString(out) {
+		t.Errorf("config show does not mask serve_token:\n%s", out)
+	}
+}
+
+// Scenario: config show prints the active config dir and where it came from
+func TestConfigShowConfigDirSource(t *testing.T) {
+	configDir := filepath.Join(t.TempDir(), "GoLeM-work")
+	for source, want := range map[string]string{"": "(default)", "(env)": "(env)"} {
+		var buf bytes.Buffer
+		opts := cmd.ConfigShowOptions{ConfigDir: configDir, ConfigDirSource: source, EnvGetenv: func(string) string { return "" }}
+		if err := cmd.ConfigShowCmd(opts, &buf); err != nil {
+			t.Fatalf("ConfigShowCmd: %v", err)
+		}
+		if !regexp.MustCompile(`config_dir +` + regexp.QuoteMeta(configDir) + ` +` + regexp.QuoteMeta(want)).MatchString(buf.String()) {
+			t.Errorf("source %q: config_dir line missing:\n%s", source, buf.String())
+		}
+	}
+}
+
+// Scenario: doctor --fix repairs each mechanical problem once and leaves the rest alone
+func TestDoctorFixRepairsBrokenState(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	home := t.TempDir()
+	root := filepath.Join(home, "subagents")
+	keyPath := filepath.Join(home, "zai_api_key")
+	claudeMD := filepath.Join(home, "CLAUDE.md")
+	opts := cmd.DoctorOptions{
+		ClaudeBinaryName: "glm-test-no-such-claude",
+		APIKeyPath:       keyPath,
+		ZAIEndpoint:      srv.URL,
+		SubagentsRoot:    root,
+		ClaudeMDPath:     claudeMD,
+		JSON:             true,
+	}
+	doctor := func(fix bool) map[string]cmd.CheckResult {
+		t.Helper()
+		var buf bytes.Buffer
+		opts.Fix = fix
+		if err := cmd.DoctorCmd(opts, &buf); err != nil {
+			t.Fatalf("DoctorCmd: %v", err)
+		}
+		var results []cmd.CheckResult
+		if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+			t.Fatalf("doctor --json = %s: %v", buf.String(), err)
+		}
+		byName := map[string]cmd.CheckResult{}
+		for _, r := range results {
+			byName[r.Name] = r
+		}
+		return byName
+	}
+
+	// A missing subagents dir is created.
+	if r := doctor(false)["subagents_dir"]; r.Status != "FAIL" || !r.Fixable || r.Fixed {
+		t.Errorf("before --fix: subagents_dir = %+v", r)
+	}
+	if r := doctor(true)["subagents_dir"]; r.Status != "OK" || !r.Fixed {
+		t.Errorf("--fix: subagents_dir = %+v", r)
+	}
+
+	// A counter holding slots of jobs that are gone, a lock dir left by a
+	// dead process, a world-readable key and a CLAUDE.md without the section.
+	writeFile(t, keyPath, "key")
+	if err := os.Chmod(keyPath, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, claudeMD, "# My rules\n")
+	writeFile(t, filepath.Join(root, ".running_count"), "3")
+	writeFile(t, filepath.Join(root, ".running_count.glm-5"), "1")
+	lock := filepath.Join(root, ".counter.lock.d")
+	if err := os.Mkdir(lock, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	before := doctor(false)
+	for _, name := range []string{"slot_counter", "stale_locks", "api_key_perms", "claude_md"} {
+		if r := before[name]; r.Status != "FAIL" || !r.Fixable {
+			t.Errorf("before --fix: %s = %+v, want a fixable FAIL", name, r)
+		}
+	}
+	if r := before["claude_cli"]; r.Status != "FAIL" || r.Fixable {
+		t.Errorf("claude_cli = %+v, want FAIL without a repair", r)
+	}
+
+	after := doctor(true)
+	for _, name := range []string{"slot_counter", "stale_locks", "api_key_perms", "claude_md"} {
+		if r := after[name]; r.Status != "OK" || !r.Fixed {
+			t.Errorf("--fix: %s = %+v, want fixed", name, r)
+		}
+	}
+	if r := after["claude_cli"]; r.Status != "FAIL" || r.Fixed {
+		t.Errorf("--fix touched claude_cli: %+v", r)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, ".running_count")); strings.TrimSpace(string(data)) != "0" {
+		t.Errorf(".running_count = %q, want 0", data)
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("stale lock dir still there (err=%v)", err)
+	}
+	if info, _ := os.Stat(keyPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %04o, want 0600", info.Mode().Perm())
+	}
+	md, _ := os.ReadFile(claudeMD)
+	if !strings.HasPrefix(string(md), "# My rules\n") || !strings.Contains(string(md), "<!-- GLM-SUBAGENT-START -->") {
+		t.Errorf("CLAUDE.md = %q", md)
+	}
+
+	// A second --fix finds nothing to repair and changes nothing.
+	for name, r := range doctor(true) {
+		if r.Fixed || (r.Fixable && r.Status != "OK") {
+			t.Errorf("second --fix: %s = %+v", name, r)
+		}
+	}
+	if again, _ := os.ReadFile(claudeMD); string(again) != string(md) {
+		t.Errorf("second --fix rewrote CLAUDE.md:\n%s", again)
+	}
+}
+
+// Scenario: doctor --fix keeps the slots of running project-scoped jobs
+func TestDoctorFixKeepsProjectJobSlots(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	root := filepath.Join(t.TempDir(), "subagents")
+	j, err := job.NewJob(root, "proj", job.GenerateJobID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := job.WritePID(j.Dir, os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.UpdateManifest(j.Dir, func(m *job.Manifest) { m.Models.Sonnet = "glm-5" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.ClaimSlot(j.Dir); err != nil {
+		t.Fatal(err)
+	}
+	// A job queued long ago still waits for the dispatcher.
+	queued, err := job.NewJob(root, "proj", job.GenerateJobID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(queued.Dir, "created_at.txt"), job.FormatTimestamp(time.Now().Add(-time.Hour)))
+	writeFile(t, filepath.Join(root, ".running_count"), "3")
+	writeFile(t, filepath.Join(root, ".running_count.glm-5"), "2")
+
+	opts := cmd.DoctorOptions{ClaudeBinaryName: "glm-test-no-such-claude", ZAIEndpoint: srv.URL, SubagentsRoot: root, Fix: true}
+	if err := cmd.DoctorCmd(opts, io.Discard); err != nil {
+		t.Fatalf("DoctorCmd: %v", err)
+	}
+	for name, want := range map[string]string{".running_count": "1", ".running_count.glm-5": "1"} {
+		if data, _ := os.ReadFile(filepath.Join(root, name)); strings.TrimSpace(string(data)) != want {
+			t.Errorf("%s = %q after --fix, want %s", name, data, want)
+		}
+	}
+	if got := job.ReadStatus(j.Dir); got != job.StatusRunning {
+		t.Errorf("status = %q after --fix, want running", got)
+	}
+	if got := job.ReadStatus(queued.Dir); got != job.StatusQueued {
+		t.Errorf("queued job status = %q after --fix, want queued", got)
+	}
+}
+
+// Scenario: doctor prints each repair before and after, and points to --fix otherwise
+func TestDoctorFixPrintsBeforeAndAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	root := filepath.Join(t.TempDir(), "subagents")
+	opts := cmd.DoctorOptions{ClaudeBinaryName: "glm-test-no-such-claude", ZAIEndpoint: srv.URL, SubagentsRoot: root}
+
+	var buf bytes.Buffer
+	if err := cmd.DoctorCmd(opts, &buf); err != nil {
+		t.Fatalf("DoctorCmd: %v", err)
+	}
+	if !strings.Contains(buf.String(), "1 problem can be repaired with glm doctor --fix") {
+		t.Errorf("doctor output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	opts.Fix = true
+	if err := cmd.DoctorCmd(opts, &buf); err != nil {
+		t.Fatalf("DoctorCmd: %v", err)
+	}
+	want := "subagents_dir    FAIL  " + root + " does not exist\n  after fix      OK  " + root + "\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("doctor --fix output missing %q:\n%s", want, buf.String())
+	}
+}
+
+// Scenario: doctor probes the configured base URL
+func TestDoctorProbesConfiguredBaseURL(t *testing.T) {
+	var probed string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = r.Method + " " + r.URL.Path
+	}))
+	defer srv.Close()
+
+	configDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, "zai_api_key"), []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "glm.toml"), []byte("base_url = \""+srv.URL+"/api\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(configDir, t.TempDir())
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = cmd.DoctorCmd(cmd.DoctorOptions{
+		ClaudeBinaryName: "glm-test-no-such-claude",
+		APIKeyPath:       cfg.APIKeyPath(),
+		ZAIEndpoint:      cfg.ZaiBaseURL,
+		SubagentsRoot:    t.TempDir(),
+	}, &buf)
+	if err != nil {
+		t.Fatalf("DoctorCmd: %v", err)
+	}
+	if probed != "HEAD /api" {
+		t.Errorf("doctor probed %q, want HEAD /api", probed)
+	}
+}
+
+// ─── Exit codes ──────────────────────────────────────────────────────────────
+
+// Scenario: Each subcommand's errors print err:<category> and map to the exit code for their class
+func TestSubcommandErrorsMapToExitCodes(t *testing.T) {
+	root := t.TempDir()
+	projectID := "myapp-12345"
+	makeJobDir(t, root, projectID, "job-20260227-143205-a8f3b1c2", "done")
+	missing := "job-20260227-143205-deadbeef"
+	noSignal := func(int, os.Signal) error { return nil }
+	var out bytes.Buffer
+
+	cases := []struct {
+		name     string
+		run      func() error
+		wantMsg  string
+		wantCode int
+	}{
+		{"run: unknown flag", func() error { _, err := cmd.ParseFlags([]string{"--timout", "5"}); return err },
+			`err:user "Unknown flag: --timout`, exitcode.UserError},
+		{"run: no prompt", func() error { return cmd.Validate(&cmd.Flags{Dir: ".", Timeout: 5}) },
+			`err:user "No prompt provided"`, exitcode.UserError},
+		{"run: unsafe workdir", func() error { return cmd.SafetyCheck("/", "bypassPermissions") },
+			`err:user "Refusing to run with bypassPermissions in /`, exitcode.UserError},
+		{"run: missing @file", func() error { _, err := cmd.ExpandFileRefs("see @./nope.txt", t.TempDir()); return err },
+			`err:user "Referenced file not found: ./nope.txt"`, exitcode.UserError},
+		{"status: malformed ID", func() error { _, err := cmd.StatusCmd("job-bogus!", root, projectID, &out); return err },
+			`err:user`, exitcode.UserError},
+		{"status: missing job", func() error { _, err := cmd.StatusCmd(missing, root, projectID, &out); return err },
+			`err:not_found "Job not found: ` + missing + `"`, exitcode.NotFound},
+		{"result: missing job", func() error { _, err := cmd.ResultCmd(missing, root, projectID, &out, &out); return err },
+			`err:not_found "Job not found: ` + missing + `"`, exitcode.NotFound},
+		{"log: missing job", func() error { return cmd.LogCmd(root, projectID, missing, &out) },
+			`err:not_found "Job not found: ` + missing + `"`, exitcode.NotFound},
+		{"attach: missing job", func() error { _, err := cmd.AttachCmd(root, projectID, missing, &out, &out); return err },
+			`err:not_found "Job not found: ` + missing + `"`, exitcode.NotFound},
+		{"kill: finished job", func() error { return cmd.KillCmd(root, projectID, "job-20260227-143205-a8f3b1c2", noSignal, func() {}) },
+			`err:user Job is not running (status: done)`, exitcode.UserError},
+		{"kill: missing job", func() error { return cmd.KillCmd(root, projectID, missing, noSignal, func() {}) },
+			`err:not_found "Job not found: ` + missing + `"`, exitcode.NotFound},
+		{"clean: negative days", func() error { return cmd.CleanCmd(root, -2, time.Now(), &out) },
+			`err:user invalid --days value`, exitcode.UserError},
+		{"config set: unknown key", func() error {
+			return cmd.ConfigSetCmd(cmd.ConfigSetOptions{ConfigDir: t.TempDir(), Key: "colour", Value: "red"})
+		}, `err:user "Unknown config key: colour"`, exitcode.UserError},
+		{"template show: missing", func() error { return cmd.TemplateShowCmd(t.TempDir(), nil, "missing", &out) },
+			`err:not_found "Template not found: missing`, exitcode.NotFound},
+		{"config: missing API key", func() error {
+			t.Setenv("GLM_API_KEY_FILE", filepath.Join(t.TempDir(), "no_key"))
+			_, err := config.Load(t.TempDir(), root)
+			return err
+		}, `err:config "API key file not found`, exitcode.UserError},
+		{"session: missing claude", func() error { _, err := claude.LookupBinary("glm-test-no-such-claude", ""); return err },
+			`err:dependency "claude CLI not found in PATH"`, exitcode.DependencyMissing},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.run()
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantMsg) {
+				t.Fatalf("error = %v, want prefix %s", err, tc.wantMsg)
+			}
+			if got := errs.ExitCode(err); got != tc.wantCode {
+				t.Errorf("exit code = %d, want %d", got, tc.wantCode)
+			}
+		})
+	}
+}
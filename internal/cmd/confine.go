@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// pathTrim are the characters trimmed off a word of a prompt or command
+// before it is taken as a path: quotes, brackets and trailing punctuation.
+const pathTrim = "\"'`()[]{}<>,;:!?"
+
+// pathWords returns the words of text that name a path which can leave the
+// directory it is read in: absolute paths, ~/ paths and any path with a ".."
+// element. URLs are not paths, and neither is a single "/word" such as a
+// slash command unless it exists.
+func pathWords(text string) []string {
+	var paths []string
+	for _, word := range strings.Fields(text) {
+		word = trimPathWord(word)
+		switch {
+		case word == "", strings.Contains(word, "://"), strings.HasPrefix(word, "//"):
+		case strings.HasPrefix(word, "/") && !strings.Contains(word[1:], "/") && !pathExists(word):
+		case word == "..", strings.HasPrefix(word, "/"), strings.HasPrefix(word, "~/"),
+			strings.HasPrefix(word, "../"), strings.Contains(word, "/../"), strings.HasSuffix(word, "/.."):
+			paths = append(paths, word)
+		}
+	}
+	return paths
+}
+
+// confineRoot returns workDir made absolute with its symlinks resolved.
+func confineRoot(workDir string) string {
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		abs = workDir
+	}
+	return resolveExisting(abs, "/")
+}
+
+// trimPathWord trims pathTrim characters and a sentence's full stop off
+// both ends of word, but keeps a trailing "..".
+func trimPathWord(word string) string {
+	for {
+		word = strings.Trim(word, pathTrim)
+		if !strings.HasSuffix(word, ".") || strings.HasSuffix(word, "..") {
+			return word
+		}
+		word = strings.TrimSuffix(word, ".")
+	}
+}
+
+// resolveExisting makes path absolute against dir and resolves the symlinks
+// of its longest existing prefix, so a path that does not exist yet
+// resolves as it would once created.
+func resolveExisting(path, dir string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	var rest []string
+	for p := path; ; p = filepath.Dir(p) {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		if p == filepath.Dir(p) {
+			return path
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+	}
+}
+
+// OutsidePaths returns the paths named in text (see pathWords) that resolve
+// outside workDir, symlinks included, in order and without duplicates.
+// Relative paths are resolved against workDir.
+func OutsidePaths(text, workDir string) []string {
+	root := confineRoot(workDir)
+	seen := map[string]bool{}
+	var outside []string
+	for _, p := range pathWords(text) {
+		if !isWithin(resolveExisting(p, root), root) && !seen[p] {
+			seen[p] = true
+			outside = append(outside, p)
+		}
+	}
+	return outside
+}
+
+// ConfineCheck checks the prompt of a confined job (--confine or
+// confine_to_workdir) for paths outside workDir. In ConfineStrict mode such
+// a path refuses the job; in ConfineWarn mode a warning is written to w.
+//
+// It returns an error of the form:
+//
+//	err:user "Prompt refers to paths outside the working directory <dir>: <paths> (...)"
+func ConfineCheck(prompt, workDir, mode string, w io.Writer) error {
+	outside := OutsidePaths(prompt, workDir)
+	if len(outside) == 0 {
+		return nil
+	}
+	if mode == config.ConfineStrict {
+		return errs.User(`"Prompt refers to paths outside the working directory %s: %s (move them into it, or drop --confine or set confine_mode = warn to run anyway)"`,
+			workDir, strings.Join(outside, ", "))
+	}
+	fmt.Fprintf(w, "warning: prompt refers to paths outside the working directory %s: %s\n", workDir, strings.Join(outside, ", "))
+	return nil
+}
+
+// ChangelogOutsidePaths returns the files the job in jobDir edited, wrote or
+// deleted outside workDir according to its changelog.txt, sorted. Paths in
+// the commands of delete and fs lines are checked as in a prompt.
+func ChangelogOutsidePaths(jobDir, workDir string) []string {
+	data, err := os.ReadFile(filepath.Join(jobDir, "changelog.txt"))
+	if err != nil {
+		return nil
+	}
+	root := confineRoot(workDir)
+	seen := map[string]bool{}
+	for _, e := range ParseChangelog(string(data)) {
+		var paths []string
+		switch e.Op {
+		case ChangelogEdit, ChangelogWrite, ChangelogNotebook:
+			if !isWithin(resolveExisting(e.Path, root), root) {
+				paths = []string{e.Path}
+			}
+		case ChangelogDelete, ChangelogFS:
+			paths = OutsidePaths(e.Command, root)
+		}
+		for _, p := range paths {
+			seen[p] = true
+		}
+	}
+	outside := make([]string, 0, len(seen))
+	for p := range seen {
+		outside = append(outside, p)
+	}
+	sort.Strings(outside)
+	return outside
+}
+
+// ApplyConfinement returns the status of a confined job that ended with
+// status once its changelog is checked for files outside workDir. In
+// ConfineStrict mode a done or failed job that touched one is
+// permission_error instead; in ConfineWarn mode its status is kept. Either
+// way a line naming the paths is appended to its stderr.txt. The caller
+// records the returned status.
+func ApplyConfinement(jobDir, status, workDir, mode string) string {
+	if status != string(job.StatusDone) && status != string(job.StatusFailed) {
+		return status
+	}
+	outside := ChangelogOutsidePaths(jobDir, workDir)
+	if len(outside) == 0 {
+		return status
+	}
+	if mode != config.ConfineStrict {
+		_ = job.AppendStderr(jobDir, fmt.Sprintf("warning: job touched paths outside its working directory %s: %s", workDir, strings.Join(outside, ", ")))
+		return status
+	}
+	_ = job.AppendStderr(jobDir, fmt.Sprintf("Job touched paths outside its working directory %s: %s (confine_mode = strict)", workDir, strings.Join(outside, ", ")))
+	return string(job.StatusPermissionError)
+}
@@ -0,0 +1,148 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// confineTree creates a workdir with a file, a sibling repo next to it and
+// two symlinks in the workdir: one to the sibling, one to its own pkg.
+// It returns the workdir and the sibling.
+func confineTree(t *testing.T) (workDir, sibling string) {
+	t.Helper()
+	base := t.TempDir()
+	workDir = filepath.Join(base, "repo")
+	sibling = filepath.Join(base, "other-repo")
+	for _, d := range []string{filepath.Join(workDir, "pkg"), sibling} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "pkg", "a.go"), []byte("package pkg\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(sibling, filepath.Join(workDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(workDir, "pkg"), filepath.Join(workDir, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	return workDir, sibling
+}
+
+// Scenario: paths in a prompt that stay in the workdir are fine; absolute paths, ../ traversals and symlinks leaving it are reported
+func TestOutsidePaths(t *testing.T) {
+	workDir, sibling := confineTree(t)
+
+	tests := []struct {
+		prompt string
+		want   []string
+	}{
+		{"fix pkg/a.go and ./pkg/new.go", nil},
+		{"fix " + filepath.Join(workDir, "pkg", "a.go") + ", then pkg/../pkg/a.go", nil},
+		{"read alias/a.go (a symlink inside the tree)", nil},
+		{"see https://example.com/../docs and and/or", nil},
+		{"fix ../other-repo/foo.go", []string{"../other-repo/foo.go"}},
+		{"edit pkg/../../other-repo/x.go and `/etc/hosts`.", []string{"pkg/../../other-repo/x.go", "/etc/hosts"}},
+		{"update escape/foo.go", nil}, // not a traversal; see the changelog test
+		{"fix \"" + sibling + "/foo.go\" and " + sibling + "/foo.go", []string{sibling + "/foo.go"}},
+		{"cd ..", []string{".."}},
+		{"/review the diff, then /compact", nil}, // slash commands, not paths
+		{"list /etc and /nonexistent-dir/x", []string{"/etc", "/nonexistent-dir/x"}},
+	}
+	for _, tt := range tests {
+		got := cmd.OutsidePaths(tt.prompt, workDir)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("OutsidePaths(%q) = %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+
+	// A workdir given through a symlink is the same tree.
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(workDir, link); err != nil {
+		t.Fatal(err)
+	}
+	if got := cmd.OutsidePaths("fix "+filepath.Join(workDir, "pkg", "a.go"), link); len(got) != 0 {
+		t.Errorf("OutsidePaths via symlinked workdir = %q, want none", got)
+	}
+}
+
+// Scenario: a prompt with a traversal warns in warn mode and is refused with err:user in strict mode
+func TestConfineCheck(t *testing.T) {
+	workDir, _ := confineTree(t)
+
+	var warn bytes.Buffer
+	if err := cmd.ConfineCheck("/review pkg/a.go", workDir, config.ConfineStrict, &warn); err != nil || warn.Len() != 0 {
+		t.Errorf("in-tree prompt: err %v, warning %q", err, warn.String())
+	}
+
+	if err := cmd.ConfineCheck("fix ../other-repo/foo.go", workDir, config.ConfineWarn, &warn); err != nil {
+		t.Errorf("warn mode: err %v, want nil", err)
+	}
+	if !strings.Contains(warn.String(), "warning: prompt refers to paths outside the working directory") || !strings.Contains(warn.String(), "../other-repo/foo.go") {
+		t.Errorf("warn mode warning = %q", warn.String())
+	}
+
+	warn.Reset()
+	err := cmd.ConfineCheck("fix ../other-repo/foo.go", workDir, config.ConfineStrict, &warn)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") || !strings.Contains(err.Error(), "../other-repo/foo.go") {
+		t.Errorf("strict mode: err %v, want err:user naming the path", err)
+	}
+	if warn.Len() != 0 {
+		t.Errorf("strict mode also warned: %q", warn.String())
+	}
+}
+
+// Scenario: edits outside the workdir in the changelog, also through a symlink, fail the job permission_error in strict mode and only warn in warn mode
+func TestApplyConfinement(t *testing.T) {
+	workDir, sibling := confineTree(t)
+	root := makeSubagentsRoot(t)
+
+	newJob := func(changelog string) string {
+		t.Helper()
+		dir := makeJobDir(t, root, "proj", job.GenerateJobID(), "running")
+		writeJobFile(t, dir, "changelog.txt", changelog)
+		return dir
+	}
+
+	inTree := newJob("EDIT " + filepath.Join(workDir, "pkg", "a.go") + ": 10 chars\nWRITE pkg/b.go\nEDIT alias/a.go: 3 chars\nFS: mkdir pkg/sub")
+	if got := cmd.ApplyConfinement(inTree, "done", workDir, config.ConfineStrict); got != "done" {
+		t.Errorf("in-tree changelog: status %s, want done", got)
+	}
+
+	changelog := "EDIT " + sibling + "/foo.go: 12 chars\nWRITE escape/new.go\nDELETE via bash: rm ../other-repo/old.go\nWRITE pkg/ok.go"
+	want := []string{"../other-repo/old.go", sibling + "/foo.go", "escape/new.go"}
+	if got := cmd.ChangelogOutsidePaths(newJob(changelog), workDir); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("ChangelogOutsidePaths = %q, want %q", got, want)
+	}
+
+	strict := newJob(changelog)
+	if got := cmd.ApplyConfinement(strict, "done", workDir, config.ConfineStrict); got != string(job.StatusPermissionError) {
+		t.Errorf("strict mode: status %s, want permission_error", got)
+	}
+	stderr, _ := os.ReadFile(filepath.Join(strict, "stderr.txt"))
+	if !strings.Contains(string(stderr), "Job touched paths outside its working directory") || !strings.Contains(string(stderr), "escape/new.go") {
+		t.Errorf("strict mode stderr = %q", stderr)
+	}
+
+	warn := newJob(changelog)
+	if got := cmd.ApplyConfinement(warn, "done", workDir, config.ConfineWarn); got != "done" {
+		t.Errorf("warn mode: status %s, want done", got)
+	}
+	stderr, _ = os.ReadFile(filepath.Join(warn, "stderr.txt"))
+	if !strings.Contains(string(stderr), "warning: job touched paths outside its working directory") {
+		t.Errorf("warn mode stderr = %q", stderr)
+	}
+
+	// A killed job keeps its status.
+	if got := cmd.ApplyConfinement(newJob(changelog), "killed", workDir, config.ConfineStrict); got != "killed" {
+		t.Errorf("killed job: status %s, want killed", got)
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// ProjectDefaultsFile holds a project's default flags for run, start and
+// chain, relative to the project directory.
+const ProjectDefaultsFile = ".glm/defaults"
+
+// NoDefaultsFlag skips the project defaults for one command.
+const NoDefaultsFlag = "--no-defaults"
+
+// FindProjectDefaults returns the ProjectDefaultsFile of dir or of its
+// nearest parent that has one, or "" when there is none. The search stops at
+// the root of the git repository dir is in, so a project never picks up the
+// defaults of a directory it merely lives under.
+func FindProjectDefaults(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectDefaultsFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectDefaults reads the flags in the defaults file at path. They are
+// written as on the command line, over any number of lines; '...' and "..."
+// quote values with spaces and # starts a comment. Only the flags of run,
+// start and chain are accepted: anything else, including a prompt, is an
+// err:config naming the file.
+func LoadProjectDefaults(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errs.Config(`"Cannot read %s: %v"`, path, err)
+	}
+	args, err := splitDefaults(string(data))
+	if err != nil {
+		return nil, errs.Config(`"%s: %s"`, path, err.Error())
+	}
+	scratch := &Flags{}
+	for i := 0; i < len(args); i++ {
+		if !isFlagToken(args[i]) || args[i] == endOfFlags {
+			return nil, errs.Config(`"%s: only flags are allowed, got %s"`, path, args[i])
+		}
+		if i, err = scratch.parseFlagAt(args, i); err != nil {
+			var ue *errs.UserError
+			if errors.As(err, &ue) {
+				return nil, errs.Config(`"%s: %s"`, path, strings.Trim(ue.Msg, `"`))
+			}
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// ApplyProjectDefaults returns args with the project's default flags
+// prepended, so that flags given on the command line win, and the path of
+// the defaults file used ("" for none). The project is the -d directory in
+// args, or cwd. With NoDefaultsFlag in args the flag is removed and no
+// defaults are applied.
+func ApplyProjectDefaults(args []string, cwd string) ([]string, string, error) {
+	for i, a := range args {
+		if a == endOfFlags {
+			break
+		}
+		if a == NoDefaultsFlag {
+			return append(args[:i:i], args[i+1:]...), "", nil
+		}
+	}
+	path := FindProjectDefaults(dirArg(args, cwd))
+	if path == "" {
+		return args, "", nil
+	}
+	defaults, err := LoadProjectDefaults(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return append(defaults, args...), path, nil
+}
+
+// dirArg returns the value of the last -d flag before "--" in args, or cwd.
+func dirArg(args []string, cwd string) string {
+	dir := cwd
+	for i := 0; i < len(args) && args[i] != endOfFlags; i++ {
+		switch {
+		case args[i] == "-d" && i+1 < len(args):
+			i++
+			dir = args[i]
+		case strings.HasPrefix(args[i], "-d="):
+			dir = strings.TrimPrefix(args[i], "-d=")
+		}
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cwd, dir)
+	}
+	return dir
+}
+
+// splitDefaults splits the contents of a defaults file into words.
+func splitDefaults(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '#' && !inWord:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, errors.New("unterminated quote")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,122 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// writeProjectDefaults creates dir/.glm/defaults with content.
+func writeProjectDefaults(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, cmd.ProjectDefaultsFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, content)
+	return path
+}
+
+// parseWithDefaults applies the project defaults to args from cwd and parses
+// the result like glm run.
+func parseWithDefaults(t *testing.T, cwd string, args ...string) (*cmd.Flags, string) {
+	t.Helper()
+	args, path, err := cmd.ApplyProjectDefaults(args, cwd)
+	if err != nil {
+		t.Fatalf("ApplyProjectDefaults: %v", err)
+	}
+	f, err := cmd.ParseFlags(args)
+	if err != nil {
+		t.Fatalf("ParseFlags(%q): %v", args, err)
+	}
+	return f, path
+}
+
+// Scenario: the project's default flags apply to run, lose to explicit flags, and are skipped with --no-defaults
+func TestProjectDefaults(t *testing.T) {
+	project := t.TempDir()
+	if err := os.Mkdir(filepath.Join(project, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := writeProjectDefaults(t, project, "# slow tests here\n-t 1200\n--mode acceptEdits  -v 'team=core infra'\n")
+	sub := filepath.Join(project, "internal", "pkg")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, used := parseWithDefaults(t, sub, "fix", "it")
+	if used != path || f.Timeout != 1200 || f.PermissionMode != "acceptEdits" || f.Vars["team"] != "core infra" || f.Prompt != "fix it" {
+		t.Errorf("defaults from %q: %+v", used, f)
+	}
+
+	f, _ = parseWithDefaults(t, sub, "-t", "60", "--mode=plan", "fix")
+	if f.Timeout != 60 || f.PermissionMode != "plan" {
+		t.Errorf("explicit flags: timeout %d, mode %q; want 60, plan", f.Timeout, f.PermissionMode)
+	}
+
+	f, used = parseWithDefaults(t, sub, "--no-defaults", "fix")
+	if used != "" || f.Timeout != 0 || f.PermissionMode != "" || f.Prompt != "fix" {
+		t.Errorf("--no-defaults: %q, %+v", used, f)
+	}
+
+	// -d picks the project; a prompt after -- may say --no-defaults.
+	elsewhere := t.TempDir()
+	f, used = parseWithDefaults(t, elsewhere, "-d", sub, "--", "--no-defaults")
+	if used != path || f.Timeout != 1200 || f.Prompt != "--no-defaults" {
+		t.Errorf("-d into the project: %q, %+v", used, f)
+	}
+
+	// The search stops at the repository root.
+	nested := filepath.Join(project, "vendor", "lib")
+	if err := os.MkdirAll(filepath.Join(nested, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, used = parseWithDefaults(t, nested, "fix"); used != "" {
+		t.Errorf("nested repository picked up %s", used)
+	}
+}
+
+// Scenario: a defaults file with a prompt or an unknown flag is a config error naming the file
+func TestProjectDefaultsRejectsBadFiles(t *testing.T) {
+	for content, want := range map[string]string{
+		"-t 60 fix the bug":   "only flags are allowed, got fix",
+		"--deny-tools Bash":   "Unknown flag: --deny-tools",
+		"-t":                  "Missing value for -t flag",
+		"--mode 'acceptEdits": "unterminated quote",
+	} {
+		project := t.TempDir()
+		path := writeProjectDefaults(t, project, content)
+		_, _, err := cmd.ApplyProjectDefaults([]string{"fix"}, project)
+		if err == nil || !strings.HasPrefix(err.Error(), "err:config") || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: err = %v, want err:config with %q", content, err, want)
+		}
+	}
+}
+
+// Scenario: config show lists the active project defaults and their file
+func TestConfigShowProjectDefaults(t *testing.T) {
+	project := t.TempDir()
+	opts := cmd.ConfigShowOptions{ConfigDir: t.TempDir(), EnvGetenv: func(string) string { return "" }, WorkDir: project}
+
+	var buf bytes.Buffer
+	if err := cmd.ConfigShowCmd(opts, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "project_defaults") || !strings.Contains(buf.String(), "(none)") {
+		t.Errorf("config show without defaults:\n%s", buf.String())
+	}
+
+	path := writeProjectDefaults(t, project, "-t 1200 -v 'team=core infra'\n")
+	buf.Reset()
+	if err := cmd.ConfigShowCmd(opts, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `-t 1200 -v "team=core infra"`
+	if !strings.Contains(buf.String(), want) || !strings.Contains(buf.String(), "("+path+")") {
+		t.Errorf("config show missing %q from %s:\n%s", want, path, buf.String())
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Scenario: disk_space fails below MinFreeDiskMB free, checks the nearest existing parent of a missing subagents dir, and fails when the volume cannot be read
+func TestCheckDiskSpace(t *testing.T) {
+	orig := diskFree
+	t.Cleanup(func() { diskFree = orig })
+
+	root := t.TempDir()
+	var statted string
+	for _, tc := range []struct {
+		free       uint64
+		err        error
+		wantStatus string
+		wantDetail string
+	}{
+		{free: 5 << 30, wantStatus: "OK", wantDetail: "5120 MB free on " + root},
+		{free: 20 << 20, wantStatus: "FAIL", wantDetail: "20 MB free on " + root + ", want at least 100 MB"},
+		{err: errors.New("boom"), wantStatus: "FAIL", wantDetail: "cannot stat " + root + ": boom"},
+	} {
+		diskFree = func(path string) (uint64, error) {
+			statted = path
+			return tc.free, tc.err
+		}
+		r := checkDiskSpace(filepath.Join(root, "subagents", "missing"))
+		if r.Name != "disk_space" || r.Status != tc.wantStatus || r.Detail != tc.wantDetail {
+			t.Errorf("checkDiskSpace = %+v, want %s %q", r, tc.wantStatus, tc.wantDetail)
+		}
+		if statted != root {
+			t.Errorf("statted %s, want the existing parent %s", statted, root)
+		}
+	}
+
+	// The real statfs reports something for an existing dir.
+	diskFree = orig
+	if r := checkDiskSpace(root); !strings.Contains(r.Detail, "MB free on "+root) {
+		t.Errorf("checkDiskSpace(%s) = %+v", root, r)
+	}
+}
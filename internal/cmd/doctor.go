@@ -9,16 +9,26 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
 )
 
 // CheckResult holds the result of a single diagnostic check.
 type CheckResult struct {
-	Name   string // e.g. "claude_cli", "api_key", "zai_reachable"
-	Status string // "OK" or "FAIL"
-	Detail string // human-readable detail line
+	Name    string `json:"name"`              // e.g. "claude_cli", "api_key", "zai_reachable"
+	Status  string `json:"status"`            // "OK" or "FAIL"
+	Detail  string `json:"detail"`            // human-readable detail line
+	Fixable bool   `json:"fixable,omitempty"` // the failure has a mechanical repair (doctor --fix)
+	Fixed   bool   `json:"fixed,omitempty"`   // doctor --fix repaired it; Status and Detail are from after
 }
 
 // DoctorOptions allows callers (and tests) to inject dependencies for the
@@ -27,8 +37,14 @@ type CheckResult struct {
 type DoctorOptions struct {
 	// ClaudeBinaryName is the executable name to look up in PATH (default "claude").
 	ClaudeBinaryName string
+	// ClaudePath is the configured claude_path; when set it is checked instead
+	// of searching PATH.
+	ClaudePath string
 	// APIKeyPath is the absolute path to the API key file.
 	APIKeyPath string
+	// APIKeySource, when set, is where the loaded config found a non-empty
+	// API key (see config.Config.APIKeySource); the key file is not checked.
+	APIKeySource string
 	// ZAIEndpoint is the URL used for the reachability HEAD check.
 	ZAIEndpoint string
 	// HTTPTimeout is the max duration for the HEAD request (default 5s).
@@ -37,16 +53,52 @@ type DoctorOptions struct {
 	SubagentsRoot string
 	// MaxParallel is the configured max_parallel value (for slot reporting).
 	MaxParallel int
+	// MaxParallelPerModel is the configured [max_parallel_per_model] table.
+	MaxParallelPerModel map[string]int
 	// OpusModel, SonnetModel, HaikuModel are the configured model names.
 	OpusModel   string
 	SonnetModel string
 	HaikuModel  string
+	// ClaudeMDPath is the CLAUDE.md that should hold the GLM section; the
+	// check is skipped when empty.
+	ClaudeMDPath string
+	// CloneDir is the GoLeM source checkout whose CLAUDE.md template is
+	// re-injected by --fix (empty: the built-in template).
+	CloneDir string
+	// Fix repairs the failures of fixable checks, printing each check
+	// before and after the repair.
+	Fix bool
+	// JSON writes the results as a JSON array instead of the text report.
+	JSON bool
+	// Out is the text report's output policy: with Out.Quiet only failed
+	// checks are printed and the --fix hint is dropped, with Out.Color
+	// OK and FAIL are colored. Its writers are not used; DoctorCmd writes
+	// to w.
+	Out *Out
+}
+
+// doctorCheck is one entry of the doctor checks list. repair, when set,
+// mechanically fixes what check reports as FAIL; checks whose failures need
+// a decision from the user (a bad API key, a missing claude CLI) have none.
+type doctorCheck struct {
+	check  func() CheckResult
+	repair func() error
 }
 
 // DoctorCmd runs all diagnostic checks and writes a human-readable report to w.
-// It always exits 0 (never returns a non-nil error for check failures — only
-// for I/O errors writing to w).
+// With opts.Fix set, each failed check that has a repair is repaired and
+// checked again. It always exits 0 (never returns a non-nil error for check
+// failures — only for I/O errors writing to w).
 func DoctorCmd(opts DoctorOptions, w io.Writer) error {
+	out := resolveOut(opts.Out, w, nil)
+	line := func(name, status, detail string) error {
+		if out.Quiet && status == "OK" {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "%-16s %s  %s\n", name, out.Status(status, status), detail)
+		return err
+	}
+
 	// Apply defaults.
 	claudeName := opts.ClaudeBinaryName
 	if claudeName == "" {
@@ -54,7 +106,7 @@ func DoctorCmd(opts DoctorOptions, w io.Writer) error {
 	}
 	zaiEndpoint := opts.ZAIEndpoint
 	if zaiEndpoint == "" {
-		zaiEndpoint = "https://api.z.ai/api/anthropic"
+		zaiEndpoint = config.ZaiBaseURL
 	}
 	httpTimeout := opts.HTTPTimeout
 	if httpTimeout == 0 {
@@ -77,44 +129,281 @@ func DoctorCmd(opts DoctorOptions, w io.Writer) error {
 		haikuModel = "glm-4.7"
 	}
 
-	var checks []CheckResult
+	checks := []doctorCheck{
+		{check: func() CheckResult { return checkClaudeCLI(claudeName, opts.ClaudePath) }},
+		{check: func() CheckResult { return checkConfiguredAPIKey(opts) }},
+		{check: func() CheckResult { return checkZAIReachable(zaiEndpoint, httpTimeout) }},
+		{check: func() CheckResult { return checkModels(opusModel, sonnetModel, haikuModel) }},
+		{check: func() CheckResult { return checkSlots(opts.SubagentsRoot, maxParallel, opts.MaxParallelPerModel) }},
+		{check: checkPlatform},
+	}
+	if root := opts.SubagentsRoot; root != "" {
+		checks = append(checks, doctorCheck{check: func() CheckResult { return checkDiskSpace(root) }})
+	}
+	checks = append(checks, repairableChecks(opts)...)
+
+	var results []CheckResult
+	fixable := 0
+	for _, c := range checks {
+		r := c.check()
+		if r.Status != "FAIL" || c.repair == nil {
+			results = append(results, r)
+			if !opts.JSON {
+				if err := line(r.Name, r.Status, r.Detail); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		r.Fixable = true
+		fixable++
+		before := r
+		var repairErr error
+		if opts.Fix {
+			if repairErr = c.repair(); repairErr == nil {
+				r = c.check()
+				r.Fixable = true
+				r.Fixed = r.Status == "OK"
+			}
+		}
+		results = append(results, r)
+		if opts.JSON {
+			continue
+		}
+		if err := line(before.Name, before.Status, before.Detail); err != nil {
+			return err
+		}
+		if !opts.Fix {
+			continue
+		}
+		after, detail := r.Status, r.Detail
+		if repairErr != nil {
+			after, detail = "FAIL", fmt.Sprintf("repair failed: %v", repairErr)
+		}
+		if _, err := fmt.Fprintf(w, "%-16s %s  %s\n", "  after fix", out.Status(after, after), detail); err != nil {
+			return err
+		}
+	}
 
-	// Check 1: claude CLI in PATH.
-	checks = append(checks, checkClaudeCLI(claudeName))
+	if opts.JSON {
+		return JSONOutput(w, results)
+	}
+	if fixable > 0 && !opts.Fix && !out.Quiet {
+		_, err := fmt.Fprintf(w, "\n%s can be repaired with glm doctor --fix\n", plural(fixable, "problem"))
+		return err
+	}
+	return nil
+}
 
-	// Check 2: API key configured.
-	checks = append(checks, checkAPIKey(opts.APIKeyPath))
+// repairableChecks returns the checks with a repair, for the state glm keeps
+// on disk: the subagents dir, its slot counters and locks, the API key file's
+// permissions and the GLM section of CLAUDE.md. Checks whose inputs are not
+// configured in opts are left out.
+func repairableChecks(opts DoctorOptions) []doctorCheck {
+	var checks []doctorCheck
+	if root := opts.SubagentsRoot; root != "" {
+		checks = append(checks,
+			doctorCheck{
+				check:  func() CheckResult { return checkSubagentsDir(root) },
+				repair: func() error { return os.MkdirAll(root, 0o755) },
+			},
+			doctorCheck{
+				check:  func() CheckResult { return checkSlotCounters(root) },
+				repair: func() error { return job.Reconcile(root, time.Now()) },
+			},
+			doctorCheck{
+				check: func() CheckResult { return checkStaleLocks(root) },
+				repair: func() error {
+					for _, dir := range slot.StaleLocks(root) {
+						if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+		)
+	}
+	if path := opts.APIKeyPath; path != "" {
+		checks = append(checks, doctorCheck{
+			check:  func() CheckResult { return checkAPIKeyPerms(path) },
+			repair: func() error { return os.Chmod(path, 0o600) },
+		})
+	}
+	if path := opts.ClaudeMDPath; path != "" {
+		checks = append(checks, doctorCheck{
+			check: func() CheckResult { return checkClaudeMD(path) },
+			repair: func() error {
+				return InjectClaudeMD(path, loadGLMTemplate(opts.CloneDir), &InjectOptions{Keep: true, Out: io.Discard})
+			},
+		})
+	}
+	return checks
+}
 
-	// Check 3: Z.AI reachability.
-	checks = append(checks, checkZAIReachable(zaiEndpoint, httpTimeout))
+// MinFreeDiskMB is the free space below which the disk_space check fails: a
+// job needs room for claude's output, and on a full disk it ends failed
+// with exit 74 (see claude.WriteError).
+const MinFreeDiskMB = 100
 
-	// Check 4: Models.
-	checks = append(checks, checkModels(opusModel, sonnetModel, haikuModel))
+// diskFree returns the bytes available to glm on the filesystem holding
+// path. Tests replace it.
+var diskFree = func(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
 
-	// Check 5: Slots usage.
-	checks = append(checks, checkSlots(opts.SubagentsRoot, maxParallel))
+// checkDiskSpace checks the free space of the volume holding the subagents
+// dir, or its nearest existing parent when the dir is not created yet.
+func checkDiskSpace(root string) CheckResult {
+	path := root
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+	free, err := diskFree(path)
+	if err != nil {
+		return CheckResult{Name: "disk_space", Status: "FAIL", Detail: fmt.Sprintf("cannot stat %s: %v", path, err)}
+	}
+	detail := fmt.Sprintf("%d MB free on %s", free>>20, path)
+	if free < MinFreeDiskMB<<20 {
+		return CheckResult{Name: "disk_space", Status: "FAIL", Detail: fmt.Sprintf("%s, want at least %d MB", detail, MinFreeDiskMB)}
+	}
+	return CheckResult{Name: "disk_space", Status: "OK", Detail: detail}
+}
 
-	// Check 6: Platform.
-	checks = append(checks, checkPlatform())
+// checkSubagentsDir checks that the subagents dir exists.
+func checkSubagentsDir(root string) CheckResult {
+	info, err := os.Stat(root)
+	switch {
+	case err != nil:
+		return CheckResult{Name: "subagents_dir", Status: "FAIL", Detail: fmt.Sprintf("%s does not exist", root)}
+	case !info.IsDir():
+		return CheckResult{Name: "subagents_dir", Status: "FAIL", Detail: fmt.Sprintf("%s is not a directory", root)}
+	}
+	return CheckResult{Name: "subagents_dir", Status: "OK", Detail: root}
+}
 
-	// Write the report.
-	for _, c := range checks {
-		_, err := fmt.Fprintf(w, "%-16s %s  %s\n", c.Name, c.Status, c.Detail)
+// checkSlotCounters reports slot counters (.running_count and the per-model
+// counters) that claim more slots than there are running jobs: nothing will
+// ever release those slots.
+func checkSlotCounters(root string) CheckResult {
+	running, byModel := countRunningJobs(root)
+	want := map[string]int{slot.CounterFile: running}
+	for model, n := range byModel {
+		want[slot.ModelCounterFile(model)] = n
+	}
+	paths, _ := filepath.Glob(filepath.Join(root, slot.CounterFile+"*"))
+	var stale []string
+	for _, p := range paths {
+		name := filepath.Base(p)
+		if strings.Contains(name, ".tmp.") {
+			continue
+		}
+		data, err := os.ReadFile(p)
 		if err != nil {
-			return err
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && n > want[name] {
+			stale = append(stale, fmt.Sprintf("%s=%d (%d running)", name, n, want[name]))
 		}
 	}
-	return nil
+	if len(stale) > 0 {
+		return CheckResult{Name: "slot_counter", Status: "FAIL", Detail: "stale slot counters: " + strings.Join(stale, ", ")}
+	}
+	return CheckResult{Name: "slot_counter", Status: "OK", Detail: "slot counters match running jobs"}
+}
+
+// checkStaleLocks reports lock dirs left behind by dead processes (see
+// slot.StaleLocks).
+func checkStaleLocks(root string) CheckResult {
+	locks := slot.StaleLocks(root)
+	if len(locks) == 0 {
+		return CheckResult{Name: "stale_locks", Status: "OK", Detail: "no stale locks"}
+	}
+	names := make([]string, len(locks))
+	for i, l := range locks {
+		names[i] = filepath.Base(l)
+	}
+	return CheckResult{
+		Name:   "stale_locks",
+		Status: "FAIL",
+		Detail: fmt.Sprintf("%s older than %ds: %s", plural(len(locks), "lock dir"), slot.StaleLockSeconds, strings.Join(names, ", ")),
+	}
+}
+
+// checkAPIKeyPerms checks that the API key file, when present, is readable
+// by its owner only.
+func checkAPIKeyPerms(path string) CheckResult {
+	info, err := os.Stat(path)
+	if err != nil {
+		return CheckResult{Name: "api_key_perms", Status: "OK", Detail: "no API key file"}
+	}
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		return CheckResult{Name: "api_key_perms", Status: "FAIL", Detail: fmt.Sprintf("%s has mode %04o, want 0600", path, mode)}
+	}
+	return CheckResult{Name: "api_key_perms", Status: "OK", Detail: fmt.Sprintf("%s has mode %04o", path, info.Mode().Perm())}
 }
 
-// checkClaudeCLI checks whether the claude binary is available in PATH.
-func checkClaudeCLI(name string) CheckResult {
-	path, err := exec.LookPath(name)
+// checkClaudeMD checks that CLAUDE.md holds the GLM section.
+func checkClaudeMD(path string) CheckResult {
+	if !hasGLMSection(path) {
+		return CheckResult{Name: "claude_md", Status: "FAIL", Detail: fmt.Sprintf("GLM section missing from %s", path)}
+	}
+	return CheckResult{Name: "claude_md", Status: "OK", Detail: fmt.Sprintf("GLM section present in %s", path)}
+}
+
+// HealthChecks runs the doctor checks that need no network and no claude
+// subprocess beyond --version: claude_cli, api_key and slots. glm serve
+// reports them on /healthz.
+func HealthChecks(opts DoctorOptions) []CheckResult {
+	claudeName := opts.ClaudeBinaryName
+	if claudeName == "" {
+		claudeName = "claude"
+	}
+	maxParallel := opts.MaxParallel
+	if maxParallel == 0 {
+		maxParallel = 3
+	}
+	return []CheckResult{
+		checkClaudeCLI(claudeName, opts.ClaudePath),
+		checkConfiguredAPIKey(opts),
+		checkSlots(opts.SubagentsRoot, maxParallel, opts.MaxParallelPerModel),
+	}
+}
+
+// checkConfiguredAPIKey reports where the loaded config found the API key,
+// or checks the key file when the config was not loaded.
+func checkConfiguredAPIKey(opts DoctorOptions) CheckResult {
+	if opts.APIKeySource != "" {
+		return CheckResult{
+			Name:   "api_key",
+			Status: "OK",
+			Detail: fmt.Sprintf("API key configured via %s", opts.APIKeySource),
+		}
+	}
+	return checkAPIKey(opts.APIKeyPath)
+}
+
+// checkClaudeCLI checks whether the claude binary resolves the same way run
+// and session resolve it (claude_path, then PATH), and that its version is
+// not older than claude.MinVersion.
+func checkClaudeCLI(name, override string) CheckResult {
+	path, err := claude.LookupBinary(name, override)
 	if err != nil {
+		detail := "claude CLI not found in PATH"
+		if override != "" {
+			detail = "claude_path is not an executable file: " + override
+		}
 		return CheckResult{
 			Name:   "claude_cli",
 			Status: "FAIL",
-			Detail: "claude CLI not found in PATH",
+			Detail: detail,
 		}
 	}
 
@@ -128,6 +417,15 @@ func checkClaudeCLI(name string) CheckResult {
 		}
 	}
 	version := strings.TrimSpace(string(out))
+	if v, ok := claude.ParseVersion(version); ok {
+		if warning := claude.VersionWarning(v); warning != "" {
+			return CheckResult{
+				Name:   "claude_cli",
+				Status: "FAIL",
+				Detail: fmt.Sprintf("%s found at %s: %s", version, path, warning),
+			}
+		}
+	}
 	return CheckResult{
 		Name:   "claude_cli",
 		Status: "OK",
@@ -205,25 +503,49 @@ func checkModels(opus, sonnet, haiku string) CheckResult {
 	}
 }
 
-// checkSlots counts running jobs and compares against max_parallel.
-func checkSlots(subagentsRoot string, maxParallel int) CheckResult {
+// checkSlots counts running jobs and compares against max_parallel, then
+// lists each per-model limit with the running jobs of that model, e.g.
+// "2/3 slots in use; glm-5: 1/1, glm-4.7: 1/5".
+func checkSlots(subagentsRoot string, maxParallel int, perModel map[string]int) CheckResult {
 	running := 0
+	byModel := map[string]int{}
 	if subagentsRoot != "" {
-		running = countRunningJobs(subagentsRoot)
+		running, byModel = countRunningJobs(subagentsRoot)
+	}
+	detail := fmt.Sprintf("%d/%d slots in use", running, maxParallel)
+	if len(perModel) > 0 {
+		models := make([]string, 0, len(perModel))
+		for m := range perModel {
+			models = append(models, m)
+		}
+		sort.Strings(models)
+		parts := make([]string, len(models))
+		for i, m := range models {
+			parts[i] = fmt.Sprintf("%s: %d/%d", m, byModel[m], perModel[m])
+		}
+		detail += "; " + strings.Join(parts, ", ")
 	}
 	return CheckResult{
 		Name:   "slots",
 		Status: "OK",
-		Detail: fmt.Sprintf("%d/%d slots in use", running, maxParallel),
+		Detail: detail,
 	}
 }
 
-// countRunningJobs counts job directories with status "running" under root.
-func countRunningJobs(root string) int {
+// countRunningJobs counts job directories with status "running" under root,
+// in total and per execution model (the sonnet slot of the job's models).
+func countRunningJobs(root string) (int, map[string]int) {
 	count := 0
+	byModel := map[string]int{}
+	countDir := func(jobDir string) {
+		count++
+		if model := job.LoadManifest(jobDir).Models.Sonnet; model != "" {
+			byModel[model]++
+		}
+	}
 	entries, err := os.ReadDir(root)
 	if err != nil {
-		return 0
+		return 0, byModel
 	}
 	for _, e := range entries {
 		if !e.IsDir() {
@@ -234,7 +556,7 @@ func countRunningJobs(root string) int {
 		statusFile := filepath.Join(jobDir, "status")
 		if data, err := os.ReadFile(statusFile); err == nil {
 			if strings.TrimSpace(string(data)) == "running" {
-				count++
+				countDir(jobDir)
 			}
 			continue
 		}
@@ -250,12 +572,12 @@ func countRunningJobs(root string) int {
 			sf := filepath.Join(jobDir, sub.Name(), "status")
 			if data, err := os.ReadFile(sf); err == nil {
 				if strings.TrimSpace(string(data)) == "running" {
-					count++
+					countDir(filepath.Join(jobDir, sub.Name()))
 				}
 			}
 		}
 	}
-	return count
+	return count, byModel
 }
 
 // checkPlatform reports the OS/arch.
@@ -278,14 +600,25 @@ type ConfigEntry struct {
 type ConfigShowOptions struct {
 	// ConfigDir is the directory containing glm.toml (default ~/.config/GoLeM).
 	ConfigDir string
+	// ConfigDirSource is the source shown for config_dir, as returned by
+	// config.ResolveConfigDir; empty shows "(default)".
+	ConfigDirSource string
 	// SubagentDir is the resolved subagent directory (default ~/.claude/subagents).
 	SubagentDir string
 	// EnvGetenv is an injectable os.Getenv for tests.
 	EnvGetenv func(string) string
+	// WorkDir is where the project defaults file is looked up (see
+	// FindProjectDefaults); empty skips the project_defaults line.
+	WorkDir string
+	// ConfigFile is read instead of ConfigDir/glm.toml (the global --config
+	// flag) and shown as config_file.
+	ConfigFile string
 }
 
 // ConfigShowCmd reads the effective configuration (TOML + env + defaults) and
-// writes each key with its value and source annotation to w.
+// writes each key with its value and source annotation to w. A last
+// project_defaults line shows the default flags of the project in
+// opts.WorkDir, with the path of their file as the source.
 func ConfigShowCmd(opts ConfigShowOptions, w io.Writer) error {
 	getenv := opts.EnvGetenv
 	if getenv == nil {
@@ -294,37 +627,98 @@ func ConfigShowCmd(opts ConfigShowOptions, w io.Writer) error {
 
 	// Defaults.
 	defaults := map[string]string{
-		"model":              "glm-4.7",
-		"opus_model":         "glm-4.7",
-		"sonnet_model":       "glm-4.7",
-		"haiku_model":        "glm-4.7",
-		"permission_mode":    "bypassPermissions",
-		"max_parallel":       "3",
-		"debug":              "false",
-		"zai_base_url":       "https://api.z.ai/api/anthropic",
-		"zai_api_timeout_ms": "3000000",
-		"subagent_dir":       opts.SubagentDir,
-		"config_dir":         opts.ConfigDir,
+		"model":                    "glm-4.7",
+		"opus_model":               "glm-4.7",
+		"sonnet_model":             "glm-4.7",
+		"haiku_model":              "glm-4.7",
+		"permission_mode":          "bypassPermissions",
+		"max_parallel":             "3",
+		"default_timeout":          strconv.Itoa(config.DefaultTimeout),
+		"priority_aging":           strconv.Itoa(config.DefaultPriorityAging),
+		"kill_grace_seconds":       strconv.Itoa(config.DefaultKillGrace),
+		"debug":                    "false",
+		"keep_jobs":                "false",
+		"retention_days":           "0",
+		"max_disk_mb":              "0",
+		"max_output_bytes":         "0",
+		"chain_context_limit":      strconv.Itoa(config.DefaultChainContextLimit),
+		"chain_clean_intermediate": "false",
+		"metrics_enabled":          "false",
+		"redact_prompts":           "false",
+		"strip_ansi":               "true",
+		"max_depth":                strconv.Itoa(config.DefaultMaxDepth),
+		"claude_path":              "",
+		"capture_diff":             "false",
+		"diff_max_bytes":           strconv.Itoa(config.DefaultDiffMaxBytes),
+		"allow_unsafe_paths":       "false",
+		"allow_overlap":            "false",
+		"confine_to_workdir":       "false",
+		"confine_mode":             config.ConfineWarn,
+		"max_prompt_bytes":         strconv.Itoa(config.DefaultMaxPromptBytes),
+		"strict_result":            "false",
+		"result_failure_markers":   formatTOMLArray(config.DefaultResultFailureMarkers),
+		"base_url":                 config.ZaiBaseURL,
+		"api_key_file":             filepath.Join(opts.ConfigDir, "zai_api_key"),
+		"serve_token":              "",
+		"on_complete_cmd":          "",
+		"zai_api_timeout_ms":       "3000000",
+		"subagent_dir":             opts.SubagentDir,
+		"config_dir":               opts.ConfigDir,
 	}
 
 	// Read TOML config file.
 	tomlValues := map[string]string{}
-	if opts.ConfigDir != "" {
+	if opts.ConfigFile != "" {
+		data, err := os.ReadFile(opts.ConfigFile)
+		if err != nil {
+			return errs.Config(`"Cannot read --config file: %s"`, err.Error())
+		}
+		tomlValues = parseTOMLToMap(string(data))
+	} else if opts.ConfigDir != "" {
 		tomlPath := filepath.Join(opts.ConfigDir, "glm.toml")
 		if data, err := os.ReadFile(tomlPath); err == nil {
 			tomlValues = parseTOMLToMap(string(data))
 		}
 	}
+	// api_key is shown as the api_key_file it stands for.
+	if v, ok := tomlValues["api_key"]; ok {
+		if _, set := tomlValues["api_key_file"]; !set {
+			tomlValues["api_key_file"] = v
+		}
+	}
 
 	// Env var mappings: config_key → env_var_name.
 	envMappings := map[string]string{
-		"model":           "GLM_MODEL",
-		"opus_model":      "GLM_OPUS_MODEL",
-		"sonnet_model":    "GLM_SONNET_MODEL",
-		"haiku_model":     "GLM_HAIKU_MODEL",
-		"permission_mode": "GLM_PERMISSION_MODE",
-		"max_parallel":    "GLM_MAX_PARALLEL",
-		"debug":           "GLM_DEBUG",
+		"model":                    "GLM_MODEL",
+		"opus_model":               "GLM_OPUS_MODEL",
+		"sonnet_model":             "GLM_SONNET_MODEL",
+		"haiku_model":              "GLM_HAIKU_MODEL",
+		"permission_mode":          "GLM_PERMISSION_MODE",
+		"max_parallel":             "GLM_MAX_PARALLEL",
+		"default_timeout":          "GLM_TIMEOUT",
+		"priority_aging":           "GLM_PRIORITY_AGING",
+		"kill_grace_seconds":       "GLM_KILL_GRACE_SECONDS",
+		"debug":                    "GLM_DEBUG",
+		"keep_jobs":                "GLM_KEEP_JOBS",
+		"retention_days":           "GLM_RETENTION_DAYS",
+		"max_disk_mb":              "GLM_MAX_DISK_MB",
+		"max_output_bytes":         "GLM_MAX_OUTPUT_BYTES",
+		"chain_context_limit":      "GLM_CHAIN_CONTEXT_LIMIT",
+		"chain_clean_intermediate": "GLM_CHAIN_CLEAN_INTERMEDIATE",
+		"metrics_enabled":          "GLM_METRICS_ENABLED",
+		"redact_prompts":           "GLM_REDACT_PROMPTS",
+		"strip_ansi":               "GLM_STRIP_ANSI",
+		"max_depth":                "GLM_MAX_DEPTH",
+		"claude_path":              "GLM_CLAUDE_PATH",
+		"capture_diff":             "GLM_CAPTURE_DIFF",
+		"strict_result":            "GLM_STRICT_RESULT",
+		"confine_to_workdir":       "GLM_CONFINE_TO_WORKDIR",
+		"confine_mode":             "GLM_CONFINE_MODE",
+		"base_url":                 "GLM_BASE_URL",
+		"api_key_file":             "GLM_API_KEY_FILE",
+		"serve_token":              "GLM_SERVE_TOKEN",
+		"on_complete_cmd":          "GLM_ON_COMPLETE_CMD",
+		"subagent_dir":             "GLM_SUBAGENT_DIR",
 	}
 
 	// Key order for display.
@@ -335,8 +729,34 @@ func ConfigShowCmd(opts ConfigShowOptions, w io.Writer) error {
 		"haiku_model",
 		"permission_mode",
 		"max_parallel",
+		"default_timeout",
+		"priority_aging",
+		"kill_grace_seconds",
 		"debug",
-		"zai_base_url",
+		"keep_jobs",
+		"retention_days",
+		"max_disk_mb",
+		"max_output_bytes",
+		"chain_context_limit",
+		"chain_clean_intermediate",
+		"metrics_enabled",
+		"redact_prompts",
+		"strip_ansi",
+		"max_depth",
+		"claude_path",
+		"capture_diff",
+		"diff_max_bytes",
+		"allow_unsafe_paths",
+		"allow_overlap",
+		"confine_to_workdir",
+		"confine_mode",
+		"max_prompt_bytes",
+		"strict_result",
+		"result_failure_markers",
+		"base_url",
+		"api_key_file",
+		"serve_token",
+		"on_complete_cmd",
 		"zai_api_timeout_ms",
 		"subagent_dir",
 		"config_dir",
@@ -366,13 +786,42 @@ func ConfigShowCmd(opts ConfigShowOptions, w io.Writer) error {
 		}
 		if key == "config_dir" && opts.ConfigDir != "" {
 			value = opts.ConfigDir
+			if opts.ConfigDirSource != "" {
+				source = opts.ConfigDirSource
+			}
+		}
+		// The token is a secret; only show whether it is set.
+		if key == "serve_token" && value != "" {
+			value = "********"
 		}
 
 		if _, err := fmt.Fprintf(w, "%-20s %-40s %s\n", key, value, source); err != nil {
 			return err
 		}
 	}
-	return nil
+	if opts.ConfigFile != "" {
+		if _, err := fmt.Fprintf(w, "%-20s %-40s %s\n", "config_file", opts.ConfigFile, "(--config)"); err != nil {
+			return err
+		}
+	}
+
+	if opts.WorkDir == "" {
+		return nil
+	}
+	value, source := "", "(none)"
+	if path := FindProjectDefaults(opts.WorkDir); path != "" {
+		args, err := LoadProjectDefaults(path)
+		if err != nil {
+			return err
+		}
+		quoted := make([]string, len(args))
+		for i, a := range args {
+			quoted[i] = shellQuote(a)
+		}
+		value, source = strings.Join(quoted, " "), "("+path+")"
+	}
+	_, err := fmt.Fprintf(w, "%-20s %-40s %s\n", "project_defaults", value, source)
+	return err
 }
 
 // parseTOMLToMap parses a simple TOML file into a key→value map.
@@ -403,7 +852,36 @@ var KnownConfigKeys = []string{
 	"haiku_model",
 	"permission_mode",
 	"max_parallel",
+	"default_timeout",
+	"priority_aging",
+	"kill_grace_seconds",
 	"debug",
+	"keep_jobs",
+	"retention_days",
+	"max_disk_mb",
+	"max_output_bytes",
+	"chain_context_limit",
+	"chain_clean_intermediate",
+	"metrics_enabled",
+	"redact_prompts",
+	"strip_ansi",
+	"max_depth",
+	"claude_path",
+	"capture_diff",
+	"diff_max_bytes",
+	"allow_unsafe_paths",
+	"allow_overlap",
+	"confine_to_workdir",
+	"confine_mode",
+	"max_prompt_bytes",
+	"strict_result",
+	"result_failure_markers",
+	"base_url",
+	"api_key_file",
+	"api_key",
+	"serve_token",
+	"on_complete_cmd",
+	"subagent_dir",
 }
 
 // ConfigSetOptions provides testable inputs for the config set command.
@@ -414,6 +892,9 @@ type ConfigSetOptions struct {
 	Key string
 	// Value is the raw string value to write.
 	Value string
+	// ConfigFile is written instead of ConfigDir/glm.toml (the global
+	// --config flag).
+	ConfigFile string
 }
 
 // ConfigSetCmd validates key and value, then writes the updated glm.toml.
@@ -428,7 +909,7 @@ func ConfigSetCmd(opts ConfigSetOptions) error {
 		}
 	}
 	if !known {
-		return fmt.Errorf("err:user \"Unknown config key: %s\"", opts.Key)
+		return errs.User("\"Unknown config key: %s\"", opts.Key)
 	}
 
 	// Validate value per key type.
@@ -437,12 +918,12 @@ func ConfigSetCmd(opts ConfigSetOptions) error {
 	}
 
 	// Ensure config directory exists.
-	if err := os.MkdirAll(opts.ConfigDir, 0o755); err != nil {
+	tomlPath := config.TOMLPath(opts.ConfigDir, config.Options{ConfigFile: opts.ConfigFile})
+	if err := os.MkdirAll(filepath.Dir(tomlPath), 0o755); err != nil {
 		return fmt.Errorf("create config dir: %w", err)
 	}
 
 	// Read existing TOML, update/add the key, write it back.
-	tomlPath := filepath.Join(opts.ConfigDir, "glm.toml")
 	existing := ""
 	if data, err := os.ReadFile(tomlPath); err == nil {
 		existing = string(data)
@@ -455,10 +936,10 @@ func ConfigSetCmd(opts ConfigSetOptions) error {
 // validateConfigValue validates a value for the given config key.
 func validateConfigValue(key, value string) error {
 	switch key {
-	case "max_parallel":
+	case "max_parallel", "retention_days", "max_disk_mb", "max_output_bytes", "chain_context_limit":
 		n, err := strconv.Atoi(value)
 		if err != nil || n < 0 {
-			return fmt.Errorf("err:user \"Invalid value for max_parallel: %s (must be a non-negative integer)\"", value)
+			return errs.User("\"Invalid value for %s: %s (must be a non-negative integer)\"", key, value)
 		}
 	case "permission_mode":
 		validModes := map[string]bool{
@@ -468,12 +949,53 @@ func validateConfigValue(key, value string) error {
 			"plan":              true,
 		}
 		if !validModes[value] {
-			return fmt.Errorf("err:user \"Invalid value for permission_mode: %s (must be one of: bypassPermissions, acceptEdits, default, plan)\"", value)
+			return errs.User("\"Invalid value for permission_mode: %s (must be one of: bypassPermissions, acceptEdits, default, plan)\"", value)
+		}
+	case "default_timeout":
+		n, err := config.ParseTimeout(value)
+		if err != nil || n <= 0 {
+			return errs.User("\"Invalid value for default_timeout: %s (must be positive seconds like 600 or a duration like 10m, 1h30m)\"", value)
+		}
+	case "max_depth":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return errs.User("\"Invalid value for max_depth: %s (must be a positive integer)\"", value)
+		}
+	case "priority_aging":
+		n, err := config.ParseTimeout(value)
+		if err != nil || n < 0 {
+			return errs.User("\"Invalid value for priority_aging: %s (must be non-negative seconds like 600 or a duration like 10m; 0 disables aging)\"", value)
+		}
+	case "kill_grace_seconds":
+		n, err := config.ParseTimeout(value)
+		if err != nil || n < 0 {
+			return errs.User("\"Invalid value for kill_grace_seconds: %s (must be non-negative seconds like 5 or a duration like 30s)\"", value)
+		}
+	case "claude_path":
+		if !filepath.IsAbs(value) {
+			return errs.User("\"Invalid value for claude_path: %s (must be an absolute path)\"", value)
+		}
+	case "subagent_dir":
+		if strings.TrimSpace(value) == "" {
+			return errs.User("\"Invalid value for subagent_dir: must not be empty\"")
+		}
+	case "diff_max_bytes", "max_prompt_bytes":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return errs.User("\"Invalid value for %s: %s (must be a positive integer)\"", key, value)
+		}
+	case "base_url":
+		if err := config.ValidateBaseURL(value); err != nil {
+			return errs.User("\"Invalid value for base_url: %s (must be an http or https URL)\"", value)
+		}
+	case "confine_mode":
+		if value != config.ConfineWarn && value != config.ConfineStrict {
+			return errs.User("\"Invalid value for confine_mode: %s (must be warn or strict)\"", value)
 		}
-	case "debug":
+	case "debug", "keep_jobs", "capture_diff", "allow_unsafe_paths", "allow_overlap", "strict_result", "confine_to_workdir", "chain_clean_intermediate", "metrics_enabled", "redact_prompts", "strip_ansi":
 		lower := strings.ToLower(value)
 		if lower != "true" && lower != "false" && lower != "1" && lower != "0" {
-			return fmt.Errorf("err:user \"Invalid value for debug: %s (must be true or false)\"", value)
+			return errs.User("\"Invalid value for %s: %s (must be true or false)\"", key, value)
 		}
 	}
 	return nil
@@ -485,11 +1007,18 @@ func setTOMLKey(existing, key, value string) string {
 	// Determine how to format the value.
 	formatted := formatTOMLValue(key, value)
 
-	// Look for an existing line with this key.
+	// Look for an existing line with this key among the top-level keys;
+	// lines after the first [section] header (e.g. [templates]) are not
+	// config keys.
 	lines := strings.Split(existing, "\n")
 	found := false
+	firstSection := len(lines)
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			firstSection = i
+			break
+		}
 		if strings.HasPrefix(trimmed, key+"=") || strings.HasPrefix(trimmed, key+" =") {
 			// Replace this line.
 			lines[i] = fmt.Sprintf("%s = %s", key, formatted)
@@ -499,11 +1028,17 @@ func setTOMLKey(existing, key, value string) string {
 	}
 
 	if !found {
-		// Append at end. Remove trailing empty lines first.
-		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
-			lines = lines[:len(lines)-1]
+		// Append after the last top-level key. Remove trailing empty lines first.
+		head, tail := lines[:firstSection], lines[firstSection:]
+		for len(head) > 0 && strings.TrimSpace(head[len(head)-1]) == "" {
+			head = head[:len(head)-1]
 		}
-		lines = append(lines, fmt.Sprintf("%s = %s", key, formatted))
+		updated := append([]string{}, head...)
+		updated = append(updated, fmt.Sprintf("%s = %s", key, formatted))
+		if len(tail) > 0 {
+			updated = append(updated, "")
+		}
+		lines = append(updated, tail...)
 	}
 
 	result := strings.Join(lines, "\n")
@@ -513,15 +1048,33 @@ func setTOMLKey(existing, key, value string) string {
 	return result
 }
 
+// formatTOMLArray formats items as a TOML array of strings.
+func formatTOMLArray(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = strconv.Quote(item)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
 // formatTOMLValue formats a value for TOML output based on the key type.
 func formatTOMLValue(key, value string) string {
 	switch key {
-	case "max_parallel":
+	case "max_parallel", "retention_days", "max_disk_mb", "max_output_bytes", "chain_context_limit", "diff_max_bytes", "max_prompt_bytes", "max_depth":
 		// Integer values — no quotes.
 		return value
-	case "debug":
+	case "debug", "keep_jobs", "capture_diff", "allow_unsafe_paths", "allow_overlap", "strict_result", "confine_to_workdir", "chain_clean_intermediate", "metrics_enabled", "redact_prompts", "strip_ansi":
 		// Boolean — no quotes.
 		return value
+	case "result_failure_markers":
+		// A comma-separated list becomes an array of strings.
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return formatTOMLArray(items)
 	default:
 		// String values — quoted.
 		return fmt.Sprintf("%q", value)
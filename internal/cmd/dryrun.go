@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/claude"
+)
+
+// DryRun is the claude invocation of a job that --dry-run of run, start
+// and chain prints instead of creating the job.
+type DryRun struct {
+	// Step is the label of a chain step ("2", "2.1") and Name its name;
+	// both are empty for run and start.
+	Step string `json:"step,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Argv is the claude binary followed by its arguments (see claude.Args).
+	Argv    []string `json:"argv"`
+	WorkDir string   `json:"workdir"`
+	// Models are the models of the three slots and the one the job
+	// executes with.
+	Models         DryRunModels `json:"models"`
+	PermissionMode string       `json:"permission_mode"`
+	TimeoutSecs    int          `json:"timeout_seconds"`
+	// Env are the variables set for claude (see claude.EnvOverrides), with
+	// the API key masked.
+	Env []string `json:"env"`
+}
+
+// DryRunModels are the models of a DryRun.
+type DryRunModels struct {
+	Opus   string `json:"opus"`
+	Sonnet string `json:"sonnet"`
+	Haiku  string `json:"haiku"`
+	Exec   string `json:"exec"`
+}
+
+// ChainDryRun is what chain --dry-run --json prints: one DryRun per step
+// that would run, in order.
+type ChainDryRun struct {
+	Steps []DryRun `json:"steps"`
+}
+
+// NewDryRun returns the DryRun of run, with the binary, nesting depth and
+// timeout resolved as claude.Execute resolves them. It returns Execute's
+// error for a claude binary that cannot be found.
+func NewDryRun(run claude.Config) (*DryRun, error) {
+	bin, err := claude.FindBinary(run.ClaudePath)
+	if err != nil {
+		return nil, err
+	}
+	if run.Depth <= 0 {
+		run.Depth = claude.NestingDepth() + 1
+	}
+	run.TimeoutSecs = claude.TimeoutSecs(run)
+	env := claude.EnvOverrides(run)
+	for i, kv := range env {
+		if key, value, _ := strings.Cut(kv, "="); key == "ANTHROPIC_AUTH_TOKEN" && value != "" {
+			env[i] = key + "=***"
+		}
+	}
+	return &DryRun{
+		Argv:           append([]string{bin}, claude.Args(run)...),
+		WorkDir:        run.WorkDir,
+		Models:         DryRunModels{Opus: run.OpusModel, Sonnet: run.SonnetModel, Haiku: run.HaikuModel, Exec: run.Model},
+		PermissionMode: run.PermissionMode,
+		TimeoutSecs:    run.TimeoutSecs,
+		Env:            env,
+	}, nil
+}
+
+// Text renders d for the terminal: the argv as a shell-style command line,
+// then one line per setting and environment variable.
+func (d *DryRun) Text() string {
+	var b strings.Builder
+	if d.Step != "" {
+		title := d.Step
+		if d.Name != "" {
+			title += " (" + d.Name + ")"
+		}
+		fmt.Fprintf(&b, "=== Step %s ===\n", title)
+	}
+	argv := make([]string, len(d.Argv))
+	for i, a := range d.Argv {
+		argv[i] = shellQuote(a)
+	}
+	fmt.Fprintf(&b, "argv:        %s\n", strings.Join(argv, " "))
+	fmt.Fprintf(&b, "workdir:     %s\n", d.WorkDir)
+	fmt.Fprintf(&b, "models:      opus=%s sonnet=%s haiku=%s (executes with %s)\n", d.Models.Opus, d.Models.Sonnet, d.Models.Haiku, d.Models.Exec)
+	fmt.Fprintf(&b, "permission:  %s\n", d.PermissionMode)
+	fmt.Fprintf(&b, "timeout:     %s\n", formatSeconds(d.TimeoutSecs))
+	for i, kv := range d.Env {
+		label := ""
+		if i == 0 {
+			label = "env:"
+		}
+		fmt.Fprintf(&b, "%-13s%s\n", label, kv)
+	}
+	return b.String()
+}
+
+// chainDryRun returns the DryRun of every step of plan from step from on,
+// with the output of the previous group injected as placeholder text, or
+// with ContextAsFile placeholder paths of its context files.
+func chainDryRun(cf *ChainFlags, plan [][]chainStep, from int) ([]DryRun, error) {
+	timeout := cf.Flags.Timeout
+	if cf.TotalTimeout > 0 {
+		if secs := int(math.Ceil(cf.TotalTimeout.Seconds())); timeout <= 0 || secs < timeout {
+			timeout = secs
+		}
+	}
+	runs := []DryRun{}
+	for gi, steps := range plan {
+		for _, st := range steps {
+			if st.step < from {
+				continue
+			}
+			prompt := st.raw
+			if files := chainContextFiles(cf.Inject, "", ""); gi > 0 && cf.ContextAsFile && len(files) > 0 {
+				paths := make([]string, len(files))
+				for i, f := range files {
+					paths[i] = filepath.Join("<job dir>", ContextDir, f.Name)
+				}
+				prompt = BuildContextFilePrompt("the previous step", paths, st.raw)
+			} else if gi > 0 {
+				prompt = BuildChainPromptFor(cf.Inject, fmt.Sprintf("<stdout of step %d>", gi), fmt.Sprintf("<changelog of step %d>", gi), st.raw)
+			}
+			d, err := NewDryRun(cf.stepConfig(st.model, prompt, timeout))
+			if err != nil {
+				return nil, err
+			}
+			d.Step, d.Name = st.label, st.name
+			runs = append(runs, *d)
+		}
+	}
+	return runs, nil
+}
+
+// stepConfig returns the claude.Config a chain step executing with model
+// runs prompt with.
+func (cf *ChainFlags) stepConfig(model, prompt string, timeout int) claude.Config {
+	models := ResolveModels(cf.Config, cf.Flags, StepPrefix{})
+	run := claude.Config{
+		OpusModel:      models.Opus.Model,
+		SonnetModel:    models.Sonnet.Model,
+		HaikuModel:     models.Haiku.Model,
+		Model:          model,
+		PermissionMode: cf.Flags.PermissionMode,
+		Prompt:         prompt,
+		WorkDir:        cf.Flags.Dir,
+		TimeoutSecs:    timeout,
+	}
+	if cfg := cf.Config; cfg != nil {
+		run.ZAIAPIKey = cfg.ZaiAPIKey
+		run.ZAIBaseURL = cfg.ZaiBaseURL
+		run.ZAIAPITimeoutMS = cfg.ZaiAPITimeoutMs
+		run.ClaudePath = cfg.ClaudePath
+		if run.PermissionMode == "" {
+			run.PermissionMode = cfg.PermissionMode
+		}
+	}
+	if cf.Flags.BaseURL != "" {
+		run.ZAIBaseURL = cf.Flags.BaseURL
+	}
+	return run
+}
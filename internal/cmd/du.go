@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// DiskUsageWorkers is the number of goroutines DiskUsage walks job
+// directories with.
+const DiskUsageWorkers = 8
+
+// LegacyProject is the project name "glm du" reports legacy flat jobs,
+// which live directly in the subagents directory, under.
+const LegacyProject = "(no project)"
+
+// JobUsage is the disk usage of one job directory.
+type JobUsage struct {
+	ID    string `json:"id"`
+	Bytes int64  `json:"bytes"`
+}
+
+// ProjectUsage is the disk usage of one project directory: its jobs plus
+// files of its own such as index.json.
+type ProjectUsage struct {
+	ID    string     `json:"id"`
+	Bytes int64      `json:"bytes"`
+	Jobs  []JobUsage `json:"jobs"`
+}
+
+// DiskReport is the disk usage of a subagents directory, as "glm du --json"
+// prints it. Projects and their jobs are sorted largest first. TotalBytes
+// also counts files outside projects, such as lock files. Unreadable counts
+// the files and directories that could not be read; their size is missing.
+type DiskReport struct {
+	TotalBytes int64          `json:"total_bytes"`
+	Projects   []ProjectUsage `json:"projects"`
+	Unreadable int            `json:"unreadable"`
+}
+
+// DuOptions holds optional settings for DuCmd.
+type DuOptions struct {
+	// JSON prints the DiskReport as JSON instead of a table.
+	JSON bool
+}
+
+// dirTask is a directory DiskUsage walks and what to do with its size.
+type dirTask struct {
+	dir string
+	add func(size int64)
+}
+
+// DiskUsage measures subagentsRoot: the apparent size of every regular
+// file, per job and per project. Job directories are walked in parallel by
+// a pool of DiskUsageWorkers goroutines; an unreadable file or directory is
+// counted in Unreadable and skipped. A missing root is an empty report.
+func DiskUsage(subagentsRoot string) DiskReport {
+	var (
+		report   DiskReport
+		projects = map[string]*ProjectUsage{}
+		other    int64
+		tasks    []dirTask
+	)
+	project := func(id string) *ProjectUsage {
+		p := projects[id]
+		if p == nil {
+			p = &ProjectUsage{ID: id, Jobs: []JobUsage{}}
+			projects[id] = p
+		}
+		return p
+	}
+	// walk queues dir to be measured and handed to add.
+	walk := func(dir string, add func(int64)) {
+		tasks = append(tasks, dirTask{dir: dir, add: add})
+	}
+	// addJob walks a job directory into project p.
+	addJob := func(p *ProjectUsage, id, dir string) {
+		walk(dir, func(size int64) {
+			p.Bytes += size
+			p.Jobs = append(p.Jobs, JobUsage{ID: id, Bytes: size})
+		})
+	}
+
+	entries, err := os.ReadDir(subagentsRoot)
+	if err != nil && !os.IsNotExist(err) {
+		report.Unreadable++
+	}
+	for _, entry := range entries {
+		path := filepath.Join(subagentsRoot, entry.Name())
+		switch {
+		case !entry.IsDir():
+			other += fileBytes(entry, &report.Unreadable)
+		case strings.HasPrefix(entry.Name(), "."):
+			walk(path, func(size int64) { other += size })
+		case strings.HasPrefix(entry.Name(), "job-"):
+			addJob(project(LegacyProject), entry.Name(), path)
+		default:
+			p := project(entry.Name())
+			subs, err := os.ReadDir(path)
+			if err != nil {
+				report.Unreadable++
+			}
+			for _, sub := range subs {
+				if sub.IsDir() {
+					addJob(p, sub.Name(), filepath.Join(path, sub.Name()))
+				} else {
+					p.Bytes += fileBytes(sub, &report.Unreadable)
+				}
+			}
+		}
+	}
+	report.Unreadable += walkDirs(tasks)
+
+	report.TotalBytes = other
+	report.Projects = []ProjectUsage{}
+	for _, p := range projects {
+		sort.Slice(p.Jobs, func(a, b int) bool { return bySize(p.Jobs[a].Bytes, p.Jobs[b].Bytes, p.Jobs[a].ID, p.Jobs[b].ID) })
+		report.TotalBytes += p.Bytes
+		report.Projects = append(report.Projects, *p)
+	}
+	ps := report.Projects
+	sort.Slice(ps, func(a, b int) bool { return bySize(ps[a].Bytes, ps[b].Bytes, ps[a].ID, ps[b].ID) })
+	return report
+}
+
+// walkDirs measures the directories of tasks on at most DiskUsageWorkers
+// goroutines and calls each task's add, one at a time, with its size. It
+// returns the number of entries that could not be read.
+func walkDirs(tasks []dirTask) int {
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		unreadable int
+		queue      = make(chan dirTask)
+	)
+	for range min(DiskUsageWorkers, len(tasks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				size, n := dirBytes(t.dir)
+				mu.Lock()
+				t.add(size)
+				unreadable += n
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, t := range tasks {
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+	return unreadable
+}
+
+// bySize orders largest first, then by name.
+func bySize(sizeA, sizeB int64, nameA, nameB string) bool {
+	if sizeA != sizeB {
+		return sizeA > sizeB
+	}
+	return nameA < nameB
+}
+
+// dirBytes returns the total size of the regular files under dir and the
+// number of entries that could not be read.
+func dirBytes(dir string) (size int64, unreadable int) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// An unreadable directory is reported once more after its
+			// own entry; either way its contents are skipped.
+			unreadable++
+			return nil
+		}
+		if !d.IsDir() {
+			size += fileBytes(d, &unreadable)
+		}
+		return nil
+	})
+	return size, unreadable
+}
+
+// fileBytes returns the size of d if it is a regular file, counting it in
+// unreadable when it cannot be stat'ed.
+func fileBytes(d fs.DirEntry, unreadable *int) int64 {
+	info, err := d.Info()
+	if err != nil {
+		*unreadable++
+		return 0
+	}
+	if !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+// DuCmd prints the disk usage of subagentsRoot to w: each project, largest
+// first, followed by its jobs, largest first, then the total.
+//
+//	SIZE      PROJECT / JOB
+//	  4.8 MB  myapp-12345
+//	  4.1 MB    job-20260227-143205-a8f3b1c2
+//	  5.0 MB  total
+//
+// Legacy flat jobs are listed under LegacyProject. With DuOptions.JSON the
+// DiskReport is printed as JSON instead.
+func DuCmd(subagentsRoot string, w io.Writer, opts ...*DuOptions) error {
+	report := DiskUsage(subagentsRoot)
+	if len(opts) > 0 && opts[0] != nil && opts[0].JSON {
+		return JSONOutput(w, report)
+	}
+
+	fmt.Fprintf(w, "%-8s  %s\n", "SIZE", "PROJECT / JOB")
+	for _, p := range report.Projects {
+		fmt.Fprintf(w, "%8s  %s\n", FormatSize(p.Bytes), p.ID)
+		for _, j := range p.Jobs {
+			fmt.Fprintf(w, "%8s    %s\n", FormatSize(j.Bytes), j.ID)
+		}
+	}
+	total := "total"
+	if report.Unreadable > 0 {
+		total = fmt.Sprintf("total (%d unreadable entries skipped)", report.Unreadable)
+	}
+	fmt.Fprintf(w, "%8s  %s\n", FormatSize(report.TotalBytes), total)
+	return nil
+}
+
+// FormatSize formats n bytes for people: "512 B", "1.5 KB", "12.3 MB",
+// "5.2 GB", in units of 1024.
+func FormatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	size := float64(n) / 1024
+	for _, unit := range []string{"KB", "MB", "GB"} {
+		if size < 1024 || unit == "GB" {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return ""
+}
+
+// DiskUsageCacheFile, under the subagents directory, caches its total size
+// for CheckDiskQuota as "<bytes> <unix seconds>", so that a burst of new
+// jobs does not walk the whole tree for each one.
+const DiskUsageCacheFile = ".disk_usage"
+
+// DiskUsageCacheTTL is how long CheckDiskQuota trusts DiskUsageCacheFile.
+const DiskUsageCacheTTL = time.Minute
+
+// CheckDiskQuota checks subagentsRoot against max_disk_mb before a new job
+// is created. Over maxMB megabytes (0 = no limit) it writes a warning to
+// warn, or with strict (--strict-disk) returns err:user instead; both say
+// how to free space. A total cached within DiskUsageCacheTTL that is under
+// the limit is trusted; over it, the tree is measured again, so a job is
+// never refused for space already freed.
+func CheckDiskQuota(subagentsRoot string, maxMB int, strict bool, warn io.Writer) error {
+	if maxMB <= 0 {
+		return nil
+	}
+	limit := int64(maxMB) << 20
+	if used, ok := cachedDiskUsage(subagentsRoot); ok && used <= limit {
+		return nil
+	}
+	used := DiskUsage(subagentsRoot).TotalBytes
+	_ = job.AtomicWrite(filepath.Join(subagentsRoot, DiskUsageCacheFile),
+		[]byte(fmt.Sprintf("%d %d\n", used, time.Now().Unix())))
+	if used <= limit {
+		return nil
+	}
+	msg := fmt.Sprintf("uses %s, over max_disk_mb (%d MB); see the largest jobs with glm du and remove finished ones with glm clean",
+		FormatSize(used), maxMB)
+	if strict {
+		return errs.User(`"Subagents directory %s"`, msg)
+	}
+	fmt.Fprintf(warn, "warning: subagents directory %s\n", msg)
+	return nil
+}
+
+// cachedDiskUsage returns the total DiskUsageCacheFile records for
+// subagentsRoot, if it was written within DiskUsageCacheTTL.
+func cachedDiskUsage(subagentsRoot string) (int64, bool) {
+	data, err := os.ReadFile(filepath.Join(subagentsRoot, DiskUsageCacheFile))
+	if err != nil {
+		return 0, false
+	}
+	var used, at int64
+	if _, err := fmt.Sscan(string(data), &used, &at); err != nil {
+		return 0, false
+	}
+	if age := time.Since(time.Unix(at, 0)); age < 0 || age > DiskUsageCacheTTL {
+		return 0, false
+	}
+	return used, true
+}
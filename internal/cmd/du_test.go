@@ -0,0 +1,183 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// makeDiskTree builds a subagents directory with known sizes:
+//
+//	big-project   6000 B  (job-b1 5000 B, job-b2 900 B, index.json 100 B)
+//	small-project  300 B  (job-s1 300 B, over two levels)
+//	(no project)    40 B  (legacy job-legacy)
+//	.queue.lock     10 B  (outside any project)
+func makeDiskTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]int{
+		"big-project/job-b1/raw.json":              4000,
+		"big-project/job-b1/stdout.txt":            1000,
+		"big-project/job-b2/raw.json":              900,
+		"big-project/index.json":                   100,
+		"small-project/job-s1/stdout.txt":          200,
+		"small-project/job-s1/artifacts/notes.txt": 100,
+		"job-legacy/stdout.txt":                    40,
+		".queue.lock":                              10,
+	}
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, path, strings.Repeat("x", size))
+	}
+	return root
+}
+
+// Scenario: glm du reports per-project and per-job usage, largest first
+func TestDiskUsage(t *testing.T) {
+	root := makeDiskTree(t)
+
+	report := cmd.DiskUsage(root)
+	if report.TotalBytes != 6350 || report.Unreadable != 0 {
+		t.Fatalf("total = %d, unreadable = %d; want 6350, 0", report.TotalBytes, report.Unreadable)
+	}
+	want := []cmd.ProjectUsage{
+		{ID: "big-project", Bytes: 6000, Jobs: []cmd.JobUsage{{ID: "job-b1", Bytes: 5000}, {ID: "job-b2", Bytes: 900}}},
+		{ID: "small-project", Bytes: 300, Jobs: []cmd.JobUsage{{ID: "job-s1", Bytes: 300}}},
+		{ID: cmd.LegacyProject, Bytes: 40, Jobs: []cmd.JobUsage{{ID: "job-legacy", Bytes: 40}}},
+	}
+	got, _ := json.Marshal(report.Projects)
+	wantJSON, _ := json.Marshal(want)
+	if string(got) != string(wantJSON) {
+		t.Errorf("projects =\n%s\nwant\n%s", got, wantJSON)
+	}
+
+	var buf bytes.Buffer
+	if err := cmd.DuCmd(root, &buf); err != nil {
+		t.Fatalf("DuCmd: %v", err)
+	}
+	wantText := "SIZE      PROJECT / JOB\n" +
+		"  5.9 KB  big-project\n" +
+		"  4.9 KB    job-b1\n" +
+		"   900 B    job-b2\n" +
+		"   300 B  small-project\n" +
+		"   300 B    job-s1\n" +
+		"    40 B  (no project)\n" +
+		"    40 B    job-legacy\n" +
+		"  6.2 KB  total\n"
+	if buf.String() != wantText {
+		t.Errorf("DuCmd output:\n%s\nwant:\n%s", buf.String(), wantText)
+	}
+
+	buf.Reset()
+	if err := cmd.DuCmd(root, &buf, &cmd.DuOptions{JSON: true}); err != nil {
+		t.Fatalf("DuCmd --json: %v", err)
+	}
+	var decoded cmd.DiskReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("--json output is not a DiskReport: %v\n%s", err, buf.String())
+	}
+	if decoded.TotalBytes != 6350 || len(decoded.Projects) != 3 || decoded.Projects[0].Jobs[0].ID != "job-b1" {
+		t.Errorf("--json report = %+v", decoded)
+	}
+
+	if empty := cmd.DiskUsage(filepath.Join(root, "missing")); empty.TotalBytes != 0 || len(empty.Projects) != 0 || empty.Unreadable != 0 {
+		t.Errorf("missing root report = %+v, want empty", empty)
+	}
+}
+
+// Scenario: an unreadable directory is counted and skipped, not fatal
+func TestDiskUsageSkipsUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads every directory")
+	}
+	root := makeDiskTree(t)
+	locked := filepath.Join(root, "big-project", "job-b2")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(locked, 0o755) })
+
+	report := cmd.DiskUsage(root)
+	if report.TotalBytes != 5450 || report.Unreadable == 0 {
+		t.Errorf("total = %d, unreadable = %d; want 5450 and at least 1", report.TotalBytes, report.Unreadable)
+	}
+	var buf bytes.Buffer
+	if err := cmd.DuCmd(root, &buf); err != nil || !strings.Contains(buf.String(), "unreadable entries skipped") {
+		t.Errorf("DuCmd = %v, output:\n%s", err, buf.String())
+	}
+}
+
+// Scenario: over max_disk_mb a new job warns, or is refused with --strict-disk
+func TestCheckDiskQuota(t *testing.T) {
+	root := t.TempDir()
+	big := filepath.Join(root, "proj", "job-big", "raw.json")
+	if err := os.MkdirAll(filepath.Dir(big), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, big, strings.Repeat("x", 2<<20))
+
+	var warn bytes.Buffer
+	for _, maxMB := range []int{0, 3} {
+		if err := cmd.CheckDiskQuota(root, maxMB, true, &warn); err != nil || warn.Len() != 0 {
+			t.Errorf("max_disk_mb=%d: err %v, warning %q; want neither", maxMB, err, warn.String())
+		}
+	}
+
+	if err := cmd.CheckDiskQuota(root, 1, false, &warn); err != nil {
+		t.Fatalf("over quota without --strict-disk: %v", err)
+	}
+	if got := warn.String(); !strings.HasPrefix(got, "warning: subagents directory uses 2.0 MB, over max_disk_mb (1 MB)") || !strings.Contains(got, "glm clean") {
+		t.Errorf("warning = %q", got)
+	}
+
+	err := cmd.CheckDiskQuota(root, 1, true, &warn)
+	if err == nil || !strings.HasPrefix(err.Error(), `err:user "Subagents directory uses 2.0 MB`) {
+		t.Errorf("--strict-disk error = %v", err)
+	}
+}
+
+// Scenario: CheckDiskQuota trusts a recent total under the limit and re-measures one over it
+func TestCheckDiskQuotaCachesTotal(t *testing.T) {
+	root := t.TempDir()
+	cache := filepath.Join(root, cmd.DiskUsageCacheFile)
+	big := filepath.Join(root, "proj", "job-big", "raw.json")
+	if err := os.MkdirAll(filepath.Dir(big), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var warn bytes.Buffer
+
+	if err := cmd.CheckDiskQuota(root, 1, true, &warn); err != nil {
+		t.Fatalf("empty root: %v", err)
+	}
+	if _, err := os.Stat(cache); err != nil {
+		t.Fatalf("no %s after a check: %v", cmd.DiskUsageCacheFile, err)
+	}
+	// Within the TTL the cached total is used, so new files are not seen yet.
+	writeFile(t, big, strings.Repeat("x", 2<<20))
+	if err := cmd.CheckDiskQuota(root, 1, true, &warn); err != nil {
+		t.Errorf("with a recent total under the limit: %v", err)
+	}
+	// An expired total is measured again.
+	writeFile(t, cache, fmt.Sprintf("0 %d\n", time.Now().Add(-2*cmd.DiskUsageCacheTTL).Unix()))
+	if err := cmd.CheckDiskQuota(root, 1, true, &warn); err == nil {
+		t.Error("with an expired total: no error, want over quota")
+	}
+	// A total over the limit is measured again before refusing.
+	if err := os.Remove(big); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, cache, fmt.Sprintf("%d %d\n", int64(5<<20), time.Now().Unix()))
+	if err := cmd.CheckDiskQuota(root, 1, true, &warn); err != nil {
+		t.Errorf("with a cached total over the limit after cleanup: %v", err)
+	}
+}
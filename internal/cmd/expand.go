@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// Default caps on what --expand-files may inline.
+const (
+	DefaultMaxExpandFileBytes  = 64 << 10
+	DefaultMaxExpandTotalBytes = 128 << 10
+)
+
+// fileRefRe matches an @./relative/path token. The token must start the
+// prompt or follow whitespace, so e-mail addresses are left alone; trailing
+// punctuation ends the path, so "see @./a.go." still works.
+var fileRefRe = regexp.MustCompile(`(^|\s)@(\./\S*[^\s.,;:!?)\]'"])`)
+
+// backtickRunRe finds runs of backticks, to pick a fence longer than any of
+// them.
+var backtickRunRe = regexp.MustCompile("`+")
+
+// ExpandOptions provides testable inputs for ExpandFileRefs.
+type ExpandOptions struct {
+	// MaxFileBytes caps each referenced file. Zero uses
+	// DefaultMaxExpandFileBytes.
+	MaxFileBytes int
+	// MaxTotalBytes caps all referenced files together. Zero uses
+	// DefaultMaxExpandTotalBytes.
+	MaxTotalBytes int
+}
+
+// ExpandFileRefs replaces every @./path token in prompt with the contents of
+// baseDir/path in a fenced code block headed by the path. Returns err:user if
+// a referenced file is missing, is a directory, exceeds a size cap, or
+// resolves (through ".." or a symlink) outside the canonical baseDir.
+func ExpandFileRefs(prompt, baseDir string, opts ...*ExpandOptions) (string, error) {
+	o := &ExpandOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	maxFile, maxTotal := o.MaxFileBytes, o.MaxTotalBytes
+	if maxFile <= 0 {
+		maxFile = DefaultMaxExpandFileBytes
+	}
+	if maxTotal <= 0 {
+		maxTotal = DefaultMaxExpandTotalBytes
+	}
+
+	var b strings.Builder
+	total, last := 0, 0
+	root := ""
+	for _, m := range fileRefRe.FindAllStringSubmatchIndex(prompt, -1) {
+		// m[4]:m[5] is the path, without the @.
+		rel := prompt[m[4]:m[5]]
+		if root == "" {
+			var err error
+			if root, err = resolvePath(baseDir); err != nil {
+				return "", errs.User(`"Directory not found: %s"`, baseDir)
+			}
+		}
+		path, err := resolvePath(filepath.Join(root, rel))
+		if err != nil {
+			return "", errs.User(`"Referenced file not found: %s"`, rel)
+		}
+		if !isWithin(path, root) {
+			return "", errs.User(`"Referenced file is outside the working directory: %s"`, rel)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", errs.User(`"Referenced file not found: %s"`, rel)
+		}
+		if info.IsDir() {
+			return "", errs.User(`"Referenced path is a directory: %s"`, rel)
+		}
+		if info.Size() > int64(maxFile) {
+			return "", errs.User(`"Referenced file too large: %s is %d bytes (limit %d per file)"`, rel, info.Size(), maxFile)
+		}
+		total += int(info.Size())
+		if total > maxTotal {
+			return "", errs.User(`"Referenced files too large: %d bytes in total (limit %d)"`, total, maxTotal)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", errs.User(`"Cannot read referenced file %s: %s"`, rel, err.Error())
+		}
+
+		b.WriteString(prompt[last : m[4]-1])
+		b.WriteString(fencedFile(rel, string(data)))
+		last = m[5]
+	}
+	b.WriteString(prompt[last:])
+	return b.String(), nil
+}
+
+// fencedFile formats content as a code block headed by its path. The fence is
+// longer than any backtick run in content so the block cannot end early.
+func fencedFile(path, content string) string {
+	fence := "```"
+	for _, run := range backtickRunRe.FindAllString(content, -1) {
+		if len(run) >= len(fence) {
+			fence = strings.Repeat("`", len(run)+1)
+		}
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return path + ":\n" + fence + "\n" + content + fence
+}
+
+// ApplyFileRefs expands @./path references in f.Prompt when --expand-files
+// is set. Paths are relative to the working directory (-d).
+func ApplyFileRefs(f *Flags, opts ...*ExpandOptions) error {
+	if !f.ExpandFiles {
+		return nil
+	}
+	prompt, err := ExpandFileRefs(f.Prompt, f.Dir, opts...)
+	if err != nil {
+		return err
+	}
+	f.Prompt = prompt
+	return nil
+}
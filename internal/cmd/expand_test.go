@@ -0,0 +1,103 @@
+package cmd_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// writeProjectFile creates dir/rel with content.
+func writeProjectFile(t *testing.T, dir, rel, content string) {
+	t.Helper()
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Scenario: --expand-files inlines @./path references as fenced code blocks
+func TestApplyFileRefsExpandsReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeProjectFile(t, dir, "src/a.go", "package a\n")
+	writeProjectFile(t, dir, "notes.md", "use ```go``` fences")
+
+	f, err := cmd.ParseFlags([]string{"--expand-files", "-d", dir, "Review @./src/a.go against @./notes.md, then mail me@./x"})
+	if err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if err := cmd.ApplyFileRefs(f); err != nil {
+		t.Fatalf("ApplyFileRefs: %v", err)
+	}
+	want := "Review ./src/a.go:\n```\npackage a\n```" +
+		" against ./notes.md:\n````\nuse ```go``` fences\n````," +
+		" then mail me@./x"
+	if f.Prompt != want {
+		t.Errorf("Prompt = %q, want %q", f.Prompt, want)
+	}
+
+	// Without --expand-files the prompt is left as typed.
+	f = &cmd.Flags{Dir: dir, Prompt: "Review @./src/a.go"}
+	if err := cmd.ApplyFileRefs(f); err != nil || f.Prompt != "Review @./src/a.go" {
+		t.Errorf("ApplyFileRefs without the flag: prompt %q, err %v", f.Prompt, err)
+	}
+}
+
+// Scenario: A missing referenced file is an err:user naming it
+func TestExpandFileRefsMissingFile(t *testing.T) {
+	_, err := cmd.ExpandFileRefs("Fix @./gone.go", t.TempDir())
+	want := `err:user "Referenced file not found: ./gone.go"`
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %s", err, want)
+	}
+}
+
+// Scenario: A reference leaving the working directory is refused
+func TestExpandFileRefsStaysInWorkdir(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "project")
+	writeProjectFile(t, parent, "secret.txt", "token\n")
+	writeProjectFile(t, dir, "sub/a.go", "package sub\n")
+	if err := os.Symlink(filepath.Join(parent, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []string{"./../secret.txt", "./sub/../../secret.txt", "./link.txt"} {
+		_, err := cmd.ExpandFileRefs("Read @"+ref, dir)
+		want := `err:user "Referenced file is outside the working directory: ` + ref + `"`
+		if err == nil || err.Error() != want {
+			t.Errorf("@%s: err = %v, want %s", ref, err, want)
+		}
+	}
+	// ".." that stays inside is fine.
+	if got, err := cmd.ExpandFileRefs("Read @./sub/../sub/a.go", dir); err != nil || !strings.Contains(got, "package sub") {
+		t.Errorf("@./sub/../sub/a.go = %q, %v", got, err)
+	}
+}
+
+// Scenario: Per-file and total caps are enforced
+func TestExpandFileRefsEnforcesCaps(t *testing.T) {
+	dir := t.TempDir()
+	writeProjectFile(t, dir, "a.txt", strings.Repeat("a", 60))
+	writeProjectFile(t, dir, "b.txt", strings.Repeat("b", 60))
+	opts := &cmd.ExpandOptions{MaxFileBytes: 50, MaxTotalBytes: 100}
+
+	_, err := cmd.ExpandFileRefs("@./a.txt", dir, opts)
+	if err == nil || !strings.Contains(err.Error(), "./a.txt is 60 bytes (limit 50 per file)") {
+		t.Errorf("per-file cap: err = %v", err)
+	}
+
+	opts.MaxFileBytes = 80
+	if _, err := cmd.ExpandFileRefs("@./a.txt", dir, opts); err != nil {
+		t.Errorf("under both caps: %v", err)
+	}
+	_, err = cmd.ExpandFileRefs("@./a.txt @./b.txt", dir, opts)
+	if err == nil || !strings.Contains(err.Error(), "120 bytes in total (limit 100)") {
+		t.Errorf("total cap: err = %v", err)
+	}
+}
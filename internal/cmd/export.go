@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
+)
+
+// DefaultExportMessageBytes is the longest string ExportCmd keeps in raw.json
+// with ExportOptions.Redact when MaxMessageBytes is not set.
+const DefaultExportMessageBytes = 4 << 10
+
+// MaxImportBytes caps the total size of the files ImportCmd unpacks, so a
+// tarball cannot fill the disk.
+const MaxImportBytes = 1 << 30
+
+// RedactedMarker replaces every secret ExportCmd strips.
+const RedactedMarker = "[REDACTED]"
+
+// secretAssignRe matches an API key or token assigned in an env dump or a
+// command line, up to the end of its value.
+var secretAssignRe = regexp.MustCompile(`(?i)\b((?:ZAI_API_KEY|ANTHROPIC_AUTH_TOKEN|ANTHROPIC_API_KEY|GLM_SERVE_TOKEN)["']?\s*[=:]\s*["']?)[^\s"']+`)
+
+// ExportOptions holds optional ExportCmd settings.
+type ExportOptions struct {
+	// Output is the tarball to write; empty is <job_id>.tar.gz in the
+	// current directory.
+	Output string
+	// Redact strips Secrets and any assigned API key or token from every
+	// file, and cuts the strings of raw.json to MaxMessageBytes.
+	Redact bool
+	// Secrets are strings Redact replaces wherever they occur, such as the
+	// configured API key.
+	Secrets []string
+	// MaxMessageBytes is the longest string Redact keeps in raw.json
+	// (default DefaultExportMessageBytes).
+	MaxMessageBytes int
+}
+
+// ExportCmd packs the job directory of jobID, found in any project (see
+// job.FindJobDir), into a gzipped tarball whose files sit under a
+// "<job_id>/" directory, and returns the tarball's path. A running job is
+// exported as its files are at the time each is read. Lock and temp files
+// are left out, and the job directory is never changed. An existing output
+// file is not overwritten (err:user).
+func ExportCmd(subagentsRoot, currentProjectID, jobID string, opts ...*ExportOptions) (string, error) {
+	o := &ExportOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	id, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return "", err
+	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, id)
+	if err != nil {
+		return "", errs.NotFound(`"Job not found: %s"`, id)
+	}
+	output := o.Output
+	if output == "" {
+		output = id + ".tar.gz"
+	}
+	if _, err := os.Lstat(output); err == nil {
+		return "", errs.User(`"Output file already exists: %s"`, output)
+	}
+
+	var files []string
+	err = filepath.WalkDir(jobDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A file removed while the job runs is simply not exported.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() && !skipExport(d.Name()) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("export %s: %w", id, err)
+	}
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, p := range files {
+		info, err := os.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("export %s: %w", id, err)
+		}
+		// Read the whole file first so the header matches what a running
+		// job had written so far.
+		data, err := os.ReadFile(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("export %s: %w", id, err)
+		}
+		rel, _ := filepath.Rel(jobDir, p)
+		if o.Redact {
+			data = redactExport(filepath.ToSlash(rel), data, o)
+		}
+		hdr := &tar.Header{
+			Name:    path.Join(id, filepath.ToSlash(rel)),
+			Mode:    int64(info.Mode().Perm()),
+			Size:    int64(len(data)),
+			ModTime: info.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if err := job.AtomicWrite(output, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("export %s: %w", id, err)
+	}
+	return output, nil
+}
+
+// skipExport reports whether a job file is left out of an export: lock files
+// and the temp files of an atomic write in progress.
+func skipExport(name string) bool {
+	return strings.HasSuffix(name, ".lock") || strings.Contains(name, ".tmp.")
+}
+
+// redactExport returns data with o.Secrets and assigned keys replaced by
+// RedactedMarker, and for raw.json with its long strings cut.
+func redactExport(name string, data []byte, o *ExportOptions) []byte {
+	s := string(data)
+	for _, secret := range o.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, RedactedMarker)
+		}
+	}
+	s = secretAssignRe.ReplaceAllString(s, "${1}"+RedactedMarker)
+	if name == "raw.json" {
+		limit := o.MaxMessageBytes
+		if limit <= 0 {
+			limit = DefaultExportMessageBytes
+		}
+		s = truncateRawJSON(s, limit)
+	}
+	return []byte(s)
+}
+
+// truncateRawJSON cuts every string of the JSON values in raw to limit
+// bytes, each value on its own line. raw that does not decode is returned
+// as is.
+func truncateRawJSON(raw string, limit int) string {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var out strings.Builder
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return raw
+		}
+		data, err := json.Marshal(truncateStrings(v, limit))
+		if err != nil {
+			return raw
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+// truncateStrings returns v with every string longer than limit bytes cut
+// to limit and a note of how much was dropped.
+func truncateStrings(v any, limit int) any {
+	switch t := v.(type) {
+	case string:
+		if len(t) <= limit {
+			return t
+		}
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(t[cut]) {
+			cut--
+		}
+		return fmt.Sprintf("%s[... %d bytes truncated by glm export --redact]", t[:cut], len(t)-cut)
+	case []any:
+		for i := range t {
+			t[i] = truncateStrings(t[i], limit)
+		}
+	case map[string]any:
+		for k := range t {
+			t[k] = truncateStrings(t[k], limit)
+		}
+	}
+	return v
+}
+
+// ImportCmd unpacks a tarball written by ExportCmd into a new job in
+// subagentsRoot/projectID and returns the new job's ID: the exported ID
+// with a fresh random suffix, so importing a job twice, or next to its
+// original, never collides. The manifest gets the new ID and project, and
+// a job exported while queued or running, which has no process here, is
+// marked failed with a note in stderr.txt.
+//
+// Returns err:user for a file that is not such a tarball, or one with
+// entries outside its job directory, links or other special files, or more
+// than MaxImportBytes of files; nothing is imported then.
+func ImportCmd(subagentsRoot, projectID, file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errs.NotFound(`"File not found: %s"`, file)
+		}
+		return "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", errs.User(`"Not a glm export: %s: %v"`, file, err)
+	}
+
+	projectDir := filepath.Join(subagentsRoot, projectID)
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(projectDir, ".import-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	origID, err := unpackExport(tar.NewReader(gz), tmp, file)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "status")); err != nil {
+		if _, err := os.Stat(filepath.Join(tmp, job.ManifestFile)); err != nil {
+			return "", errs.User(`"Not a glm export: %s: %s has no status"`, file, origID)
+		}
+	}
+
+	var newID, dir string
+	err = slot.WithLock(subagentsRoot, func() error {
+		for {
+			suffix := job.GenerateJobID()
+			newID = origID[:len(origID)-8] + suffix[len(suffix)-8:]
+			dir = filepath.Join(projectDir, newID)
+			if _, err := os.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+				return os.Rename(tmp, dir)
+			}
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("import %s: %w", file, err)
+	}
+
+	if err := job.UpdateManifest(dir, func(m *job.Manifest) {
+		m.ID = newID
+		m.ProjectID = projectID
+		m.PID = 0
+	}); err != nil {
+		return newID, err
+	}
+	_ = os.Remove(filepath.Join(dir, "pid.txt"))
+	if status := job.ReadStatus(dir); !terminalStatuses[string(status)] {
+		_ = job.AppendStderr(dir, fmt.Sprintf("Imported from %s while %s; it does not run here", origID, status))
+		if err := job.WriteStatus(dir, job.StatusFailed); err != nil {
+			return newID, err
+		}
+	}
+	return newID, nil
+}
+
+// unpackExport writes the files of tr into dir and returns the job ID of
+// the directory they all sit under. It stops at MaxImportBytes of files.
+func unpackExport(tr *tar.Reader, dir, file string) (string, error) {
+	id := ""
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errs.User(`"Not a glm export: %s: %v"`, file, err)
+		}
+		name := path.Clean(hdr.Name)
+		top, rel, _ := strings.Cut(name, "/")
+		if id == "" {
+			if job.ValidateJobID(top) != nil {
+				return "", errs.User(`"Not a glm export: %s: %s is not a job directory"`, file, top)
+			}
+			id = top
+		}
+		switch {
+		case top != id || path.IsAbs(name) || strings.HasPrefix(name, "../"):
+			return "", errs.User(`"Not a glm export: %s: entry %s is outside %s"`, file, hdr.Name, id)
+		case hdr.Typeflag == tar.TypeDir:
+			if rel != "" {
+				if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(rel)), 0o755); err != nil {
+					return "", err
+				}
+			}
+			continue
+		case hdr.Typeflag != tar.TypeReg || rel == "":
+			return "", errs.User(`"Not a glm export: %s: entry %s is not a regular file"`, file, hdr.Name)
+		}
+		// tar.Reader reads no more than hdr.Size of an entry.
+		if total += hdr.Size; total > MaxImportBytes {
+			return "", errs.User(`"Not a glm export: %s: more than %d bytes of files"`, file, int64(MaxImportBytes))
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return "", err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fs.FileMode(hdr.Mode).Perm()|0o600)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(out, tr)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", errs.User(`"Not a glm export: %s: %v"`, file, err)
+		}
+	}
+	if id == "" {
+		return "", errs.User(`"Not a glm export: %s: no job directory"`, file)
+	}
+	return id, nil
+}
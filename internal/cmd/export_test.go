@@ -0,0 +1,203 @@
+package cmd_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// makeExportJob creates a finished job with the usual artifacts in root and
+// returns its directory.
+func makeExportJob(t *testing.T, root string) string {
+	t.Helper()
+	dir := makeJobDir(t, root, "proj", "job-20260301-120000-aaaaaaaa", "done")
+	writeJobFile(t, dir, "prompt.txt", "fix the parser")
+	writeJobFile(t, dir, "raw.json", `{"result":"fixed it","messages":[{"content":"`+strings.Repeat("x", 100)+`"}]}`)
+	writeJobFile(t, dir, "stdout.txt", "fixed it")
+	writeJobFile(t, dir, "stderr.txt", "env: ZAI_API_KEY=sk-secret-123 PATH=/bin\nkey sk-secret-123 again\n")
+	writeJobFile(t, dir, "changelog.txt", "EDIT parser.go: 1 replacement")
+	writeJobFile(t, dir, "status.lock", "")
+	if err := job.UpdateManifest(dir, func(m *job.Manifest) { m.Prompt = "fix the parser"; m.ProjectID = "proj" }); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// Scenario: glm export packs a job dir under <job_id>/ and glm import unpacks it into another project under a fresh ID with the same artifacts, leaving the source alone
+func TestExportImportRoundTrip(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	src := makeExportJob(t, root)
+	out := filepath.Join(t.TempDir(), "bundle.tar.gz")
+
+	path, err := cmd.ExportCmd(root, "other", "aaaaaaaa", &cmd.ExportOptions{Output: out})
+	if err != nil || path != out {
+		t.Fatalf("ExportCmd = %q, %v", path, err)
+	}
+	if _, err := cmd.ExportCmd(root, "other", "aaaaaaaa", &cmd.ExportOptions{Output: out}); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("second export over %s: %v, want err:user", out, err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "stdout.txt")); err != nil {
+		t.Fatalf("export touched the source: %v", err)
+	}
+
+	names := tarNames(t, out)
+	if !names["job-20260301-120000-aaaaaaaa/raw.json"] || !names["job-20260301-120000-aaaaaaaa/job.json"] || names["job-20260301-120000-aaaaaaaa/status.lock"] {
+		t.Errorf("tarball entries = %v", names)
+	}
+
+	dest := makeSubagentsRoot(t)
+	ids := map[string]bool{}
+	for range 2 {
+		id, err := cmd.ImportCmd(dest, "mine", out)
+		if err != nil {
+			t.Fatalf("ImportCmd: %v", err)
+		}
+		if !strings.HasPrefix(id, "job-20260301-120000-") || id == "job-20260301-120000-aaaaaaaa" || ids[id] {
+			t.Errorf("imported ID %s, want a fresh suffix", id)
+		}
+		ids[id] = true
+		dir := filepath.Join(dest, "mine", id)
+		for _, name := range []string{"prompt.txt", "raw.json", "stdout.txt", "stderr.txt", "changelog.txt"} {
+			want, _ := os.ReadFile(filepath.Join(src, name))
+			if got, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(got) != string(want) {
+				t.Errorf("%s/%s = %q (%v), want %q", id, name, got, err, want)
+			}
+		}
+		m := job.LoadManifest(dir)
+		if m.ID != id || m.ProjectID != "mine" || m.Status != job.StatusDone || m.Prompt != "fix the parser" {
+			t.Errorf("imported manifest = %+v", m)
+		}
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dest, "mine", ".import-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("temp dirs left behind: %v", leftovers)
+	}
+}
+
+// Scenario: --redact replaces the API key and assigned tokens in every file and cuts long raw.json strings; a running job is exported and imports as failed
+func TestExportRedactAndRunningJob(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	src := makeExportJob(t, root)
+	writeJobFile(t, src, "status", "running")
+	writePID(t, src, selfPID())
+	if err := job.UpdateManifest(src, func(m *job.Manifest) { m.Status = job.StatusRunning }); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "redacted.tar.gz")
+
+	if _, err := cmd.ExportCmd(root, "proj", "job-20260301-120000-aaaaaaaa", &cmd.ExportOptions{
+		Output: out, Redact: true, Secrets: []string{"sk-secret-123"}, MaxMessageBytes: 10,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(src, "stderr.txt")); !strings.Contains(string(got), "sk-secret-123") {
+		t.Errorf("redaction changed the source: %q", got)
+	}
+
+	dest := makeSubagentsRoot(t)
+	id, err := cmd.ImportCmd(dest, "mine", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(dest, "mine", id)
+	stderr, _ := os.ReadFile(filepath.Join(dir, "stderr.txt"))
+	if strings.Contains(string(stderr), "sk-secret") || !strings.Contains(string(stderr), "ZAI_API_KEY=[REDACTED] PATH=/bin") {
+		t.Errorf("stderr.txt = %q, want the key redacted", stderr)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "raw.json"))
+	if strings.Contains(string(raw), strings.Repeat("x", 11)) || !strings.Contains(string(raw), `"xxxxxxxxxx[... 90 bytes truncated by glm export --redact]"`) || !strings.Contains(string(raw), `"result":"fixed it"`) {
+		t.Errorf("raw.json = %s", raw)
+	}
+	if status := job.ReadStatus(dir); status != job.StatusFailed || !strings.Contains(string(stderr), "Imported from job-20260301-120000-aaaaaaaa while running") {
+		t.Errorf("imported running job: status %s, stderr %q", status, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pid.txt")); !os.IsNotExist(err) {
+		t.Errorf("pid.txt imported: %v", err)
+	}
+}
+
+// Scenario: glm import rejects a tarball with an entry outside its job directory and imports nothing
+func TestImportRejectsEscapingEntries(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "bad.tar.gz")
+	f, err := os.Create(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{"job-20260301-120000-aaaaaaaa/status", "job-20260301-120000-aaaaaaaa/../../evil"} {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: 4})
+		_, _ = tw.Write([]byte("done"))
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	_ = f.Close()
+
+	dest := makeSubagentsRoot(t)
+	if _, err := cmd.ImportCmd(dest, "mine", bad); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Fatalf("ImportCmd = %v, want err:user", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dest, "mine"))
+	if len(entries) != 0 {
+		t.Errorf("project dir holds %v after a rejected import", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "evil")); !os.IsNotExist(err) {
+		t.Errorf("escaping entry written: %v", err)
+	}
+}
+
+// Scenario: glm import stops at MaxImportBytes of files without reading them
+func TestImportRejectsOversizedExport(t *testing.T) {
+	big := filepath.Join(t.TempDir(), "big.tar.gz")
+	f, err := os.Create(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	_ = tw.WriteHeader(&tar.Header{Name: "job-20260301-120000-aaaaaaaa/status", Mode: 0o644, Size: 4})
+	_, _ = tw.Write([]byte("done"))
+	// Only the header is written; the import must refuse before the body.
+	_ = tw.WriteHeader(&tar.Header{Name: "job-20260301-120000-aaaaaaaa/raw.json", Mode: 0o644, Size: cmd.MaxImportBytes})
+	_ = gz.Close()
+	_ = f.Close()
+
+	dest := makeSubagentsRoot(t)
+	_, err = cmd.ImportCmd(dest, "mine", big)
+	if err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Fatalf("ImportCmd = %v, want err:user about the size", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dest, "mine")); len(entries) != 0 {
+		t.Errorf("project dir holds %v after a rejected import", entries)
+	}
+}
+
+// tarNames returns the entry names of the gzipped tarball at path.
+func tarNames(t *testing.T, path string) map[string]bool {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names[hdr.Name] = true
+	}
+	return names
+}
@@ -3,15 +3,33 @@ package cmd
 
 import (
 	"fmt"
+	"math"
+	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
 )
 
-// ValidStatuses is the set of all recognised job status values used for filter validation.
-var ValidStatuses = []string{
+// validStatuses are the recognised job status values, in the order glm
+// lists them.
+var validStatuses = []string{
 	"queued", "running", "done", "failed", "timeout", "killed", "permission_error",
+	"context_exceeded",
+}
+
+// UnknownStatus is reported for a job directory whose status cannot be read
+// (a corrupted or half-written job). --status accepts it to find them.
+const UnknownStatus = "unknown"
+
+// ValidStatuses returns the recognised job status values, in the order glm
+// lists them. It is the one list that help text, completion and the serve
+// and MCP layers validate against; callers get their own copy.
+func ValidStatuses() []string {
+	return append([]string(nil), validStatuses...)
 }
 
 // validStatusMap is a set of valid status values for fast lookup.
@@ -23,6 +41,7 @@ var validStatusMap = map[string]bool{
 	"timeout":         true,
 	"killed":          true,
 	"permission_error": true,
+	"context_exceeded": true,
 }
 
 // FilterOptions holds the parsed filter parameters for the list command.
@@ -33,26 +52,83 @@ type FilterOptions struct {
 	ProjectPrefix string
 	// Since filters to jobs created at or after this time (zero = no filter).
 	Since time.Time
+	// Chain restricts the list to the steps of one chain, in step order
+	// (empty = all).
+	Chain string
+	// Lineage lists the retry lineage of this job instead (see JobLineage);
+	// the other filters and paging are ignored.
+	Lineage string
+	// Offset skips this many matching jobs before listing (0 = none).
+	Offset int
+	// Limit caps the number of listed jobs (0 = unlimited). With a limit
+	// only the newest job directories are read; see scanNewestJobs.
+	Limit int
+	// Sort orders the listed jobs by one of the ListSort keys (empty =
+	// SortStarted); Reverse flips the order. See SortJobs.
+	Sort    string
+	Reverse bool
+	// UTC prints the STARTED column of the list table in UTC instead of the
+	// local timezone.
+	UTC bool
+	// Out is the list's output policy: with Out.Quiet the table header is
+	// not printed, with Out.Color statuses are colored. Its writers are not
+	// used; ListCmd writes to w.
+	Out *Out
+}
+
+// The keys of glm list --sort.
+const (
+	SortStarted  = "started"  // newest first
+	SortStatus   = "status"   // in ValidStatuses order, unknown last
+	SortDuration = "duration" // longest first
+	SortProject  = "project"  // by project ID
+	SortID       = "id"       // by job ID
+)
+
+// ListSortKeys lists the accepted --sort keys.
+var ListSortKeys = []string{SortStarted, SortStatus, SortDuration, SortProject, SortID}
+
+// ParseListSort validates the key of --sort. It returns err:user for an
+// unknown key.
+func ParseListSort(raw string) (string, error) {
+	for _, k := range ListSortKeys {
+		if raw == k {
+			return raw, nil
+		}
+	}
+	return "", errs.User(`"Invalid --sort value: %s (must be one of: %s)"`, raw, strings.Join(ListSortKeys, ", "))
 }
 
-// ParseStatusFilter parses a comma-separated status string like "running,done,failed"
-// and validates each value against ValidStatuses.
-// Returns err:user if any status is unrecognised.
+// ParseStatusFilter parses a comma-separated status string like
+// "running, done,FAILED". Each value is trimmed and matched case-insensitively
+// against ValidStatuses and UnknownStatus. The result holds each status once,
+// in ValidStatuses order with UnknownStatus last, whatever the input order.
+// Returns err:user for an unrecognised status or an empty value between
+// commas.
 func ParseStatusFilter(raw string) ([]string, error) {
-	if raw == "" {
+	if strings.TrimSpace(raw) == "" {
 		return nil, nil
 	}
-	parts := strings.Split(raw, ",")
-	for i, p := range parts {
-		parts[i] = strings.TrimSpace(p)
+	accepted := append(ValidStatuses(), UnknownStatus)
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		status := strings.ToLower(strings.TrimSpace(part))
+		if status == "" {
+			return nil, errs.User("Empty status in list: %q", raw)
+		}
+		if !validStatusMap[status] && status != UnknownStatus {
+			return nil, errs.User("Unknown status: %s (valid: %s)",
+				strings.TrimSpace(part), strings.Join(accepted, ", "))
+		}
+		seen[status] = true
 	}
-	for _, status := range parts {
-		if !validStatusMap[status] {
-			return nil, fmt.Errorf("err:user Unknown status: %s (valid: %s)",
-				status, strings.Join(ValidStatuses, ", "))
+	var statuses []string
+	for _, status := range accepted {
+		if seen[status] {
+			statuses = append(statuses, status)
 		}
 	}
-	return parts, nil
+	return statuses, nil
 }
 
 // ParseDuration parses a Go duration string (e.g. "2h", "30m") or an extended
@@ -61,46 +137,79 @@ func ParseStatusFilter(raw string) ([]string, error) {
 func ParseDuration(s string) (time.Duration, error) {
 	s = strings.TrimSpace(s)
 	if s == "" {
-		return 0, fmt.Errorf("err:user empty duration")
+		return 0, errs.User("empty duration")
 	}
 	// Handle 'd' suffix for days (1 day = 24 hours)
 	if strings.HasSuffix(s, "d") {
 		numStr := strings.TrimSuffix(s, "d")
 		var days int
 		if _, err := fmt.Sscanf(numStr, "%d", &days); err != nil {
-			return 0, fmt.Errorf("err:user invalid duration format: %q", s)
+			return 0, errs.User("invalid duration format: %q", s)
 		}
 		if days < 0 {
-			return 0, fmt.Errorf("err:user duration must be positive: %q", s)
+			return 0, errs.User("duration must be positive: %q", s)
+		}
+		if days > int(math.MaxInt64/int64(24*time.Hour)) {
+			return 0, errs.User("duration too large: %q", s)
 		}
 		return time.Duration(days) * 24 * time.Hour, nil
 	}
 	// Use time.ParseDuration for standard Go durations (h, m, s, etc.)
 	d, err := time.ParseDuration(s)
 	if err != nil {
-		return 0, fmt.Errorf("err:user invalid duration: %q", s)
+		return 0, errs.User("invalid duration: %q", s)
 	}
 	if d < 0 {
-		return 0, fmt.Errorf("err:user duration must be positive: %q", s)
+		return 0, errs.User("duration must be positive: %q", s)
 	}
 	return d, nil
 }
 
+// MaxSinceDays caps the window of --since: a longer duration is rejected
+// rather than reaching back before any job could exist.
+const MaxSinceDays = 3650
+
+// sinceLayouts are the absolute timestamp layouts accepted by --since, tried
+// in order. Layouts without a zone offset are interpreted as UTC.
+var sinceLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
 // ParseSinceFilter parses --since value which may be:
-//   - A Go duration string: "2h", "30m"
+//   - A Go duration string: "2h", "45m", "90s"
 //   - An extended duration with days: "7d"
+//   - A bare integer meaning days: "7" (backward compatible with --days)
 //   - An ISO date: "2026-02-27"
+//   - A timestamp: "2026-02-27T09:00", "2026-02-27T09:00:00" or full RFC3339
 //
 // It returns the absolute time after which jobs should be included (i.e. now - duration,
-// or midnight of the given date). nowFn is injectable for testing.
-// Returns err:user for unparseable input.
+// or the given instant). nowFn is injectable for testing.
+// Returns err:user listing the accepted formats for unparseable input, and
+// err:user for a duration longer than MaxSinceDays or an instant in the
+// future.
 func ParseSinceFilter(raw string, nowFn func() time.Time) (time.Time, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
 		return time.Time{}, nil
 	}
+	// Bare integers are days, matching the historical --days semantics.
+	if days, err := strconv.Atoi(raw); err == nil {
+		if days < 0 {
+			return time.Time{}, errs.User("duration must be positive: %q", raw)
+		}
+		if days > MaxSinceDays {
+			return time.Time{}, errs.User("since duration too large: %q (at most %dd)", raw, MaxSinceDays)
+		}
+		raw += "d"
+	}
 	// First try to parse as duration
 	if d, err := ParseDuration(raw); err == nil {
+		if d > MaxSinceDays*24*time.Hour {
+			return time.Time{}, errs.User("since duration too large: %q (at most %dd)", raw, MaxSinceDays)
+		}
 		cutoff := nowFn().Add(-d)
 		// For hour- and day-granularity durations the boundary is exclusive:
 		// a job started at exactly now-d is NOT "within" that window.
@@ -110,28 +219,48 @@ func ParseSinceFilter(raw string, nowFn func() time.Time) (time.Time, error) {
 		}
 		return cutoff, nil
 	}
-	// Try parsing as ISO date (YYYY-MM-DD)
-	if t, err := time.Parse("2006-01-02", raw); err == nil {
-		// Return midnight of that date in UTC
-		return t, nil
+	// Try the absolute timestamp layouts.
+	for _, layout := range sinceLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			if t.After(nowFn()) {
+				return time.Time{}, errs.User("since value is in the future: %q", raw)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, errs.User("invalid since value: %q (accepted: duration like '2h', '45m', '90s', '7d'; "+
+		"bare days like '7'; date like '2026-02-27'; timestamp like '2026-02-27T09:00' or RFC3339 '2026-02-27T09:00:00+03:00')", raw)
+}
+
+// jobTime returns the instant used for time-based filtering of j: its
+// started_at when known, otherwise the job directory mtime so that corrupted
+// jobs without timestamps do not silently vanish from filtered lists.
+func jobTime(j JobEntry) (time.Time, bool) {
+	if j.StartedAt != nil {
+		return *j.StartedAt, true
 	}
-	// Try parsing as RFC3339
-	if t, err := time.Parse(time.RFC3339, raw); err == nil {
-		return t, nil
+	info, err := os.Stat(j.Dir)
+	if err != nil {
+		return time.Time{}, false
 	}
-	return time.Time{}, fmt.Errorf("err:user invalid since value: %q (expected duration like '2h', '7d' or date like '2026-02-27')", raw)
+	return info.ModTime(), true
 }
 
 // FilterJobs applies opts to the given list of JobEntry values and returns
-// only those that match ALL specified filters (AND semantics).
+// only those that match ALL specified filters (AND semantics). A job whose
+// status is not one of ValidStatuses matches the UnknownStatus filter.
 func FilterJobs(jobs []JobEntry, opts *FilterOptions) []JobEntry {
 	var result []JobEntry
 	for _, job := range jobs {
 		// Status filter: match if no filter OR status is in the allowed set
 		if len(opts.Statuses) > 0 {
+			status := job.Status
+			if !validStatusMap[status] {
+				status = UnknownStatus
+			}
 			statusMatch := false
 			for _, s := range opts.Statuses {
-				if job.Status == s {
+				if status == s {
 					statusMatch = true
 					break
 				}
@@ -147,9 +276,14 @@ func FilterJobs(jobs []JobEntry, opts *FilterOptions) []JobEntry {
 				continue
 			}
 		}
-		// Since filter: job.StartedAt >= opts.Since (inclusive; zero Since means no filter)
+		// Chain filter
+		if opts.Chain != "" && job.ChainID != opts.Chain {
+			continue
+		}
+		// Since filter: started_at (or dir mtime) >= opts.Since (inclusive; zero Since means no filter)
 		if !opts.Since.IsZero() {
-			if job.StartedAt == nil || job.StartedAt.Before(opts.Since) {
+			t, ok := jobTime(job)
+			if !ok || t.Before(opts.Since) {
 				continue
 			}
 		}
@@ -169,5 +303,11 @@ func FilterJobs(jobs []JobEntry, opts *FilterOptions) []JobEntry {
 		}
 		return ti.After(*tj)
 	})
+	// A single chain reads naturally in execution order.
+	if opts.Chain != "" {
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].ChainStep < result[j].ChainStep
+		})
+	}
 	return result
 }
@@ -3,6 +3,8 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -325,20 +327,13 @@ func TestFilterJobsSinceAnISODate(t *testing.T) {
 	}
 }
 
-// Scenario: Filter with since value in the future returns empty list
-func TestFilterWithSinceValueInFutureReturnsEmptyList(t *testing.T) {
-	root := t.TempDir()
-	jobs := buildDataset(t, root)
+// Scenario: Filter with since value in the future is rejected
+func TestFilterWithSinceValueInFutureReturnsError(t *testing.T) {
 	now := fixedNow("2026-02-27T16:00:00+03:00")
 
-	since, err := ParseSinceFilter("2026-03-01", now)
-	if err != nil {
-		t.Fatalf("ParseSinceFilter: %v", err)
-	}
-	result := FilterJobs(jobs, &FilterOptions{Since: since})
-
-	if len(result) != 0 {
-		t.Errorf("expected 0 jobs for future date, got %d", len(result))
+	_, err := ParseSinceFilter("2026-03-01", now)
+	if err == nil || !strings.Contains(err.Error(), `err:user since value is in the future: "2026-03-01"`) {
+		t.Errorf("ParseSinceFilter(future date) = %v, want err:user naming the future value", err)
 	}
 }
 
@@ -529,6 +524,229 @@ func TestCombinedFiltersWithJsonOutput(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// Limit and offset
+// =============================================================================
+
+// Scenario: --limit and --offset page through the newest-first list
+func TestListLimitAndOffset(t *testing.T) {
+	root := t.TempDir()
+	buildDataset(t, root)
+
+	var buf bytes.Buffer
+	if err := ListJSON(root, &FilterOptions{Limit: 3, Offset: 1}, &buf); err != nil {
+		t.Fatalf("ListJSON: %v", err)
+	}
+	var arr []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &arr); err != nil {
+		t.Fatalf("JSON unmarshal: %v", err)
+	}
+	var got []string
+	for _, item := range arr {
+		got = append(got, item["id"].(string))
+	}
+	want := []string{"job-20260227-151500-cc33dd44", "job-20260227-144500-ee55ff66", "job-20260227-120000-a1b2c3d4"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListJSON limit 3 offset 1 = %v, want %v", got, want)
+	}
+
+	// The limit counts matching jobs only; offset alone also works.
+	buf.Reset()
+	if err := ListJSON(root, &FilterOptions{Statuses: []string{"done", "failed"}, Limit: 2}, &buf); err != nil {
+		t.Fatalf("ListJSON: %v", err)
+	}
+	if n := strings.Count(buf.String(), `"id"`); n != 2 || !strings.Contains(buf.String(), "job-20260227-144500-ee55ff66") {
+		t.Errorf("status filter with limit 2 = %s", buf.String())
+	}
+	buf.Reset()
+	if err := ListJSON(root, &FilterOptions{Offset: 7}, &buf); err != nil {
+		t.Fatalf("ListJSON: %v", err)
+	}
+	if n := strings.Count(buf.String(), `"id"`); n != 1 || !strings.Contains(buf.String(), "job-20260227-080000-e7f8a9b0") {
+		t.Errorf("offset 7 = %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := ListCmd(root, &buf, &FilterOptions{Limit: 2}); err != nil {
+		t.Fatalf("ListCmd: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "job-20260227-153000-aa11bb22") ||
+		!strings.HasPrefix(lines[2], "job-20260227-151500-cc33dd44") {
+		t.Errorf("ListCmd limit 2:\n%s", buf.String())
+	}
+}
+
+// buildManyJobs creates n done jobs, one second apart, spread over a few
+// projects.
+func buildManyJobs(tb testing.TB, root string, n int) {
+	tb.Helper()
+	base := time.Date(2026, 2, 27, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		ts := base.Add(time.Duration(i) * time.Second)
+		id := "job-" + ts.Format("20060102-150405") + "-" + fmt.Sprintf("%08x", i)
+		dir := filepath.Join(root, fmt.Sprintf("proj-%d", i%4), id)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			tb.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "status"), []byte("done"), 0o644); err != nil {
+			tb.Fatalf("write status: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "started_at.txt"), []byte(ts.Format(time.RFC3339)), 0o644); err != nil {
+			tb.Fatalf("write started_at: %v", err)
+		}
+	}
+}
+
+// Scenario: A limited listing reads far fewer job directories than a full one
+func TestListLimitReadsOnlyNewestJobs(t *testing.T) {
+	root := t.TempDir()
+	buildManyJobs(t, root, 2000)
+	// Two jobs created in the same second as the newest one: the tie is
+	// settled by started_at, so all three are read.
+	for i, started := range []string{"2026-02-27T00:40:00Z", "2026-02-27T00:35:00Z"} {
+		dir := filepath.Join(root, "proj-0", fmt.Sprintf("job-20260227-003319-tie0000%d", i))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		os.WriteFile(filepath.Join(dir, "status"), []byte("done"), 0o644)
+		os.WriteFile(filepath.Join(dir, "started_at.txt"), []byte(started), 0o644)
+	}
+
+	reads := 0
+	countingRead := func(c jobCandidate) (JobEntry, bool) {
+		reads++
+		return readListCandidate(c)
+	}
+	jobs := scanNewestJobs(root, &FilterOptions{Limit: 2}, countingRead)
+
+	if got := strings.Join(jobIDs(jobs), ","); got != "job-20260227-003319-tie00000,job-20260227-003319-tie00001" {
+		t.Errorf("newest 2 = %s", got)
+	}
+	if reads != 3 {
+		t.Errorf("limited listing read %d job directories, want 3 of 2002", reads)
+	}
+
+	reads = 0
+	jobs = scanNewestJobs(root, &FilterOptions{Limit: 20, Offset: 10}, countingRead)
+	if len(jobs) != 20 || reads > 32 {
+		t.Errorf("limit 20 offset 10: %d jobs after %d reads", len(jobs), reads)
+	}
+}
+
+// =============================================================================
+// Sort and reverse
+// =============================================================================
+
+// Scenario: --sort orders the standard dataset by each key, equal keys newest first
+func TestSortJobs(t *testing.T) {
+	root := t.TempDir()
+	jobs := buildDataset(t, root)
+	for id, secs := range map[string]string{"ee55ff66": "2700", "a1b2c3d4": "600", "a3b4c5d6": "3600"} {
+		for _, je := range jobs {
+			if strings.HasSuffix(je.JobID, id) {
+				os.WriteFile(filepath.Join(je.Dir, "duration_seconds.txt"), []byte(secs), 0o644)
+			}
+		}
+	}
+	// aa11bb22 has run 30 minutes and cc33dd44 45 minutes at now; the
+	// failed, queued and killed jobs have no duration.
+	now, _ := time.Parse(time.RFC3339, "2026-02-27T16:00:00+03:00")
+
+	for _, tc := range []struct {
+		key     string
+		reverse bool
+		want    string
+	}{
+		{SortStarted, false, "aa11bb22,cc33dd44,ee55ff66,a1b2c3d4,e5f6a7b8,c9d0e1f2,a3b4c5d6,e7f8a9b0"},
+		{SortStarted, true, "e7f8a9b0,a3b4c5d6,c9d0e1f2,e5f6a7b8,a1b2c3d4,ee55ff66,cc33dd44,aa11bb22"},
+		{SortStatus, false, "c9d0e1f2,aa11bb22,cc33dd44,ee55ff66,a1b2c3d4,e5f6a7b8,a3b4c5d6,e7f8a9b0"},
+		{SortStatus, true, "e7f8a9b0,a3b4c5d6,e5f6a7b8,ee55ff66,a1b2c3d4,aa11bb22,cc33dd44,c9d0e1f2"},
+		{SortDuration, false, "a3b4c5d6,cc33dd44,ee55ff66,aa11bb22,a1b2c3d4,e5f6a7b8,c9d0e1f2,e7f8a9b0"},
+		{SortDuration, true, "e5f6a7b8,c9d0e1f2,e7f8a9b0,a1b2c3d4,aa11bb22,cc33dd44,ee55ff66,a3b4c5d6"},
+		{SortProject, false, "cc33dd44,e5f6a7b8,a3b4c5d6,e7f8a9b0,aa11bb22,ee55ff66,a1b2c3d4,c9d0e1f2"},
+		{SortProject, true, "aa11bb22,ee55ff66,a1b2c3d4,c9d0e1f2,cc33dd44,e5f6a7b8,a3b4c5d6,e7f8a9b0"},
+		{SortID, false, "e7f8a9b0,a3b4c5d6,c9d0e1f2,e5f6a7b8,a1b2c3d4,ee55ff66,cc33dd44,aa11bb22"},
+		{SortID, true, "aa11bb22,cc33dd44,ee55ff66,a1b2c3d4,e5f6a7b8,c9d0e1f2,a3b4c5d6,e7f8a9b0"},
+	} {
+		sorted := append([]JobEntry(nil), jobs...)
+		// Start from a shuffled order: SortJobs must not depend on it.
+		sorted[0], sorted[7] = sorted[7], sorted[0]
+		SortJobs(sorted, tc.key, tc.reverse, now)
+		var got []string
+		for _, id := range jobIDs(sorted) {
+			got = append(got, id[len(id)-8:])
+		}
+		if strings.Join(got, ",") != tc.want {
+			t.Errorf("SortJobs(%s, reverse=%v) = %s, want %s", tc.key, tc.reverse, strings.Join(got, ","), tc.want)
+		}
+	}
+
+	// An unknown status sorts after every known one.
+	odd := append([]JobEntry{{JobID: "job-20260228-000000-00000000", Status: "weird"}}, jobs[:2]...)
+	SortJobs(odd, SortStatus, false, now)
+	if got := odd[2].Status; got != "weird" {
+		t.Errorf("unknown status sorted at %v", jobIDs(odd))
+	}
+}
+
+// Scenario: ListJSON and ListCmd sort before paging; an unknown key is err:user
+func TestListSortAndReverse(t *testing.T) {
+	root := t.TempDir()
+	buildDataset(t, root)
+
+	var buf bytes.Buffer
+	if err := ListJSON(root, &FilterOptions{Sort: SortProject, Reverse: true, Limit: 3, Offset: 1}, &buf); err != nil {
+		t.Fatalf("ListJSON: %v", err)
+	}
+	var arr []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &arr); err != nil {
+		t.Fatalf("JSON unmarshal: %v", err)
+	}
+	var got []string
+	for _, item := range arr {
+		got = append(got, item["id"].(string))
+	}
+	want := []string{"job-20260227-144500-ee55ff66", "job-20260227-120000-a1b2c3d4", "job-20260227-100000-c9d0e1f2"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListJSON project reversed, limit 3 offset 1 = %v, want %v", got, want)
+	}
+
+	buf.Reset()
+	if err := ListCmd(root, &buf, &FilterOptions{Sort: SortID, Limit: 1}); err != nil {
+		t.Fatalf("ListCmd: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "job-20260227-080000-e7f8a9b0") {
+		t.Errorf("ListCmd sort id limit 1:\n%s", buf.String())
+	}
+
+	if _, err := ParseListSort("size"); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("ParseListSort(size) = %v, want err:user", err)
+	}
+}
+
+// BenchmarkListJSON compares a full listing of 2000 jobs with --limit 20.
+func BenchmarkListJSON(b *testing.B) {
+	root := b.TempDir()
+	buildManyJobs(b, root, 2000)
+	for _, bc := range []struct {
+		name   string
+		filter *FilterOptions
+	}{
+		{"all", &FilterOptions{}},
+		{"limit20", &FilterOptions{Limit: 20}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := ListJSON(root, bc.filter, io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 // =============================================================================
 // AC6: Invalid filter values return err:user
 // =============================================================================
@@ -580,6 +798,97 @@ func TestInvalidSinceDurationFormatReturnsError(t *testing.T) {
 	}
 }
 
+// Scenario: --since accepts durations, bare days, dates and timestamps
+func TestParseSinceFilterAcceptedFormats(t *testing.T) {
+	now := fixedNow("2026-02-27T16:00:00+03:00")
+	base := now()
+
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"2h", base.Add(-2 * time.Hour).Add(time.Nanosecond)},
+		{"45m", base.Add(-45 * time.Minute)},
+		{"90s", base.Add(-90 * time.Second)},
+		{"3d", base.Add(-72 * time.Hour).Add(time.Nanosecond)},
+		{"3", base.Add(-72 * time.Hour).Add(time.Nanosecond)},
+		{" 1 ", base.Add(-24 * time.Hour).Add(time.Nanosecond)},
+		{"2026-02-27", time.Date(2026, 2, 27, 0, 0, 0, 0, time.UTC)},
+		{"2026-02-27T09:00", time.Date(2026, 2, 27, 9, 0, 0, 0, time.UTC)},
+		{"2026-02-27T09:00:30", time.Date(2026, 2, 27, 9, 0, 30, 0, time.UTC)},
+		{"2026-02-27T09:00:00+03:00", time.Date(2026, 2, 27, 6, 0, 0, 0, time.UTC)},
+		{"2026-02-27T09:00:00Z", time.Date(2026, 2, 27, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseSinceFilter(tt.raw, now)
+			if err != nil {
+				t.Fatalf("ParseSinceFilter(%q): %v", tt.raw, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseSinceFilter(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+// Scenario: --since rejects unknown formats and lists the accepted ones
+func TestParseSinceFilterInvalidInputs(t *testing.T) {
+	now := fixedNow("2026-02-27T16:00:00+03:00")
+
+	for _, raw := range []string{"yesterday", "-3", "2h30", "2026-02-30", "27.02.2026", "3w"} {
+		t.Run(raw, func(t *testing.T) {
+			_, err := ParseSinceFilter(raw, now)
+			if err == nil {
+				t.Fatalf("ParseSinceFilter(%q): expected error, got nil", raw)
+			}
+			msg := err.Error()
+			if !strings.HasPrefix(msg, "err:user") {
+				t.Errorf("error must start with err:user, got: %q", msg)
+			}
+			if raw != "-3" && !strings.Contains(msg, "accepted:") {
+				t.Errorf("error must list accepted formats, got: %q", msg)
+			}
+		})
+	}
+}
+
+// Scenario: --since falls back to the directory mtime for jobs without started_at
+func TestFilterSinceFallsBackToDirectoryMtime(t *testing.T) {
+	root := t.TempDir()
+	recent := filepath.Join(root, "proj", "job-corrupt-recent")
+	old := filepath.Join(root, "proj", "job-corrupt-old")
+	for _, dir := range []string{recent, old} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	now := time.Now()
+	if err := os.Chtimes(recent, now.Add(-10*time.Minute), now.Add(-10*time.Minute)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := os.Chtimes(old, now.Add(-48*time.Hour), now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	jobs := []JobEntry{
+		{JobID: "job-corrupt-recent", Status: "unknown", Dir: recent},
+		{JobID: "job-corrupt-old", Status: "unknown", Dir: old},
+		{JobID: "job-missing-dir", Status: "unknown", Dir: filepath.Join(root, "proj", "gone")},
+	}
+
+	since, err := ParseSinceFilter("1h", func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("ParseSinceFilter: %v", err)
+	}
+	result := FilterJobs(jobs, &FilterOptions{Since: since})
+
+	if len(result) != 1 {
+		t.Fatalf("expected 1 job, got %d: %v", len(result), jobIDs(result))
+	}
+	assertContains(t, jobIDs(result), "job-corrupt-recent")
+}
+
 // =============================================================================
 // ParseDuration unit tests
 // =============================================================================
@@ -622,6 +931,100 @@ func TestParseDurationInvalid(t *testing.T) {
 	}
 }
 
+func TestParseDurationTooLarge(t *testing.T) {
+	_, err := ParseDuration("99999999999d")
+	if err == nil || !strings.Contains(err.Error(), `duration too large: "99999999999d"`) {
+		t.Errorf("ParseDuration(99999999999d) = %v, want a too-large error instead of an overflow", err)
+	}
+}
+
+// =============================================================================
+// Untrusted filter values (serve and MCP pass them through unchanged)
+// =============================================================================
+
+// Scenario: status lists are trimmed, matched case-insensitively, deduplicated and returned in ValidStatuses order; empty values and unknown names are rejected
+func TestParseStatusFilterMessyInput(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{raw: "done, failed", want: "done,failed"},
+		{raw: "DONE", want: "done"},
+		{raw: " failed ,done,Failed", want: "done,failed"},
+		{raw: "unknown,running", want: "running,unknown"},
+		{raw: "  ", want: ""},
+		{raw: "done,,failed", wantErr: `Empty status in list: "done,,failed"`},
+		{raw: "done,", wantErr: "Empty status in list"},
+		{raw: "done, bogus ", wantErr: "Unknown status: bogus (valid: queued, running, done, failed, timeout, killed, permission_error, context_exceeded, unknown)"},
+	}
+	for _, tt := range tests {
+		got, err := ParseStatusFilter(tt.raw)
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), "err:user") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseStatusFilter(%q) error = %v, want err:user %q", tt.raw, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, ",") != tt.want {
+			t.Errorf("ParseStatusFilter(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+// Scenario: --since values are trimmed; future instants and durations over MaxSinceDays are rejected
+func TestParseSinceFilterMessyInput(t *testing.T) {
+	now := fixedNow("2026-02-27T16:00:00Z")
+	tests := []struct {
+		raw     string
+		want    time.Time
+		wantErr string
+	}{
+		{raw: " 3d ", want: now().Add(-72*time.Hour + time.Nanosecond)},
+		{raw: "2026-02-27", want: time.Date(2026, 2, 27, 0, 0, 0, 0, time.UTC)},
+		{raw: "3650d", want: now().Add(-3650*24*time.Hour + time.Nanosecond)},
+		{raw: "2026-03-01", wantErr: `since value is in the future: "2026-03-01"`},
+		{raw: "2026-02-27T16:00:01Z", wantErr: "since value is in the future"},
+		{raw: "3651d", wantErr: `since duration too large: "3651d" (at most 3650d)`},
+		{raw: "99999999999", wantErr: `since duration too large: "99999999999"`},
+		{raw: "999999h", wantErr: "since duration too large"},
+	}
+	for _, tt := range tests {
+		got, err := ParseSinceFilter(tt.raw, now)
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), "err:user") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseSinceFilter(%q) error = %v, want err:user %q", tt.raw, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseSinceFilter(%q) = %v, %v; want %v", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+// Scenario: the unknown status filter matches jobs whose status is missing or unrecognised
+func TestFilterJobsUnknownStatus(t *testing.T) {
+	jobs := []JobEntry{
+		{JobID: "job-missing", Status: UnknownStatus},
+		{JobID: "job-garbage", Status: "half-written"},
+		{JobID: "job-done", Status: "done"},
+	}
+	got := jobIDs(FilterJobs(jobs, &FilterOptions{Statuses: []string{UnknownStatus}}))
+	if strings.Join(got, ",") != "job-missing,job-garbage" {
+		t.Errorf("unknown filter matched %v", got)
+	}
+}
+
+// Scenario: ValidStatuses returns a copy that callers cannot use to change the accepted statuses
+func TestValidStatusesIsACopy(t *testing.T) {
+	statuses := ValidStatuses()
+	statuses[0] = "bogus"
+	if ValidStatuses()[0] != "queued" {
+		t.Errorf("ValidStatuses()[0] = %q after a caller changed its copy", ValidStatuses()[0])
+	}
+}
+
 // =============================================================================
 // Helpers
 // =============================================================================
@@ -2,10 +2,13 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
 )
 
 // Flags holds all parsed command-line options for run and start commands.
@@ -18,119 +21,392 @@ type Flags struct {
 	HaikuModel     string
 	PermissionMode string
 	Prompt         string
+	// Keep retains the job directory after the output is printed.
+	Keep bool
+	// CaptureDiff saves the workdir's git diff to the job directory.
+	CaptureDiff bool
+	// StrictResult fails a job whose result matches a failure marker.
+	StrictResult bool
+	// Confine checks the job for paths outside its working directory, as
+	// confine_to_workdir does (see ConfineCheck and ApplyConfinement).
+	Confine bool
+	// AllowUnsafePaths skips SafetyCheck for this invocation.
+	AllowUnsafePaths bool
+	// AllowOverlap skips OverlapCheck for this invocation.
+	AllowOverlap bool
+	// AllowNested skips NestingCheck for this invocation.
+	AllowNested bool
+	// StrictDisk refuses the job instead of warning when the subagents
+	// directory is over max_disk_mb.
+	StrictDisk bool
+	// MaxOutput caps the bytes of job output glm run prints (0 = the
+	// max_output_bytes setting).
+	MaxOutput int
+	// ExpandFiles inlines @./path references in the prompt.
+	ExpandFiles bool
+	// BaseURL overrides the configured base_url for this job.
+	BaseURL string
+	// Priority orders the job among those waiting for a slot (empty =
+	// normal).
+	Priority job.Priority
+	// Notify is a shell command run when the job has finished (see
+	// RunNotify).
+	Notify string
+	// Template names a prompt template to render instead of a positional
+	// prompt; Vars holds its -v key=value substitutions.
+	Template string
+	Vars     map[string]string
+	// ContextFile is a file glm run copies into the job dir and points
+	// claude at instead of putting it in the prompt (see RunContextPrompt).
+	ContextFile string
+}
+
+// flagSpec describes one flag accepted by run, start and chain.
+type flagSpec struct {
+	name     string
+	hasValue bool
+	apply    func(f *Flags, value string) error
+}
+
+// flagSpecs lists the accepted flags in the order they are shown in errors.
+var flagSpecs = []flagSpec{
+	{name: "-d", hasValue: true, apply: func(f *Flags, v string) error { f.Dir = v; return nil }},
+	{name: "-t", hasValue: true, apply: func(f *Flags, v string) error {
+		timeout, err := config.ParseTimeout(v)
+		if err != nil {
+			return errs.User(`"Timeout must be seconds (600) or a duration (10m, 1h30m): %s"`, v)
+		}
+		f.Timeout = timeout
+		return nil
+	}},
+	{name: "-m", hasValue: true, apply: func(f *Flags, v string) error { f.Model = v; return nil }},
+	{name: "--opus", hasValue: true, apply: func(f *Flags, v string) error { f.OpusModel = v; return nil }},
+	{name: "--sonnet", hasValue: true, apply: func(f *Flags, v string) error { f.SonnetModel = v; return nil }},
+	{name: "--haiku", hasValue: true, apply: func(f *Flags, v string) error { f.HaikuModel = v; return nil }},
+	{name: "--base-url", hasValue: true, apply: func(f *Flags, v string) error {
+		if err := config.ValidateBaseURL(v); err != nil {
+			return errs.User(`"Invalid --base-url: %s"`, err.Error())
+		}
+		f.BaseURL = v
+		return nil
+	}},
+	{name: "--priority", hasValue: true, apply: func(f *Flags, v string) error {
+		p, err := job.ParsePriority(v)
+		f.Priority = p
+		return err
+	}},
+	{name: "--notify", hasValue: true, apply: func(f *Flags, v string) error { f.Notify = v; return nil }},
+	{name: "--mode", hasValue: true, apply: func(f *Flags, v string) error { f.PermissionMode = v; return nil }},
+	{name: "--unsafe", apply: func(f *Flags, _ string) error { f.PermissionMode = "bypassPermissions"; return nil }},
+	{name: "--keep", apply: func(f *Flags, _ string) error { f.Keep = true; return nil }},
+	{name: "--capture-diff", apply: func(f *Flags, _ string) error { f.CaptureDiff = true; return nil }},
+	{name: "--strict-result", apply: func(f *Flags, _ string) error { f.StrictResult = true; return nil }},
+	{name: "--confine", apply: func(f *Flags, _ string) error { f.Confine = true; return nil }},
+	{name: "--expand-files", apply: func(f *Flags, _ string) error { f.ExpandFiles = true; return nil }},
+	{name: "--i-know-what-im-doing", apply: func(f *Flags, _ string) error { f.AllowUnsafePaths = true; return nil }},
+	{name: "--allow-overlap", apply: func(f *Flags, _ string) error { f.AllowOverlap = true; return nil }},
+	{name: "--allow-nested", apply: func(f *Flags, _ string) error { f.AllowNested = true; return nil }},
+	{name: "--strict-disk", apply: func(f *Flags, _ string) error { f.StrictDisk = true; return nil }},
+	{name: "--max-output", hasValue: true, apply: func(f *Flags, v string) error {
+		n, err := ParseMaxOutput(v)
+		f.MaxOutput = n
+		return err
+	}},
+	{name: "--template", hasValue: true, apply: func(f *Flags, v string) error { f.Template = v; return nil }},
+	{name: "--context", hasValue: true, apply: func(f *Flags, v string) error { f.ContextFile = v; return nil }},
+	{name: promptFlag, hasValue: true, apply: func(f *Flags, v string) error { f.Prompt = v; return nil }},
+	{name: "-v", hasValue: true, apply: func(f *Flags, v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return errs.User(`"Template variable must be key=value: %s"`, v)
+		}
+		if f.Vars == nil {
+			f.Vars = map[string]string{}
+		}
+		f.Vars[key] = value
+		return nil
+	}},
+}
+
+// ParseMaxOutput parses the BYTES of --max-output: a non-negative integer.
+func ParseMaxOutput(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errs.User(`"--max-output must be a number of bytes: %s"`, v)
+	}
+	return n, nil
+}
+
+// endOfFlags ends flag parsing; everything after it is positional, so prompts
+// may start with a dash.
+const endOfFlags = "--"
+
+// promptFlag gives the prompt as a flag value instead of positional text.
+const promptFlag = "--prompt"
+
+// isFlagToken reports whether arg looks like a flag rather than a prompt: it
+// starts with "-" and its name (up to any "=") has no whitespace, so a quoted
+// prompt such as "-d is ignored" or "-- analyze this" is not taken for one.
+func isFlagToken(arg string) bool {
+	name, _, _ := strings.Cut(arg, "=")
+	return len(arg) > 1 && strings.HasPrefix(arg, "-") && !strings.ContainsAny(name, " \t\n")
+}
+
+// isPromptFlag reports whether arg is --prompt, in either form.
+func isPromptFlag(arg string) bool {
+	name, _, _ := strings.Cut(arg, "=")
+	return name == promptFlag
+}
+
+// validFlagNames returns the accepted flag names for error messages.
+func validFlagNames() string {
+	names := make([]string, len(flagSpecs))
+	for i, spec := range flagSpecs {
+		names[i] = spec.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseFlagAt applies the flag at args[i], accepting both "-d DIR" and
+// "-d=DIR", and returns the index of the last argument it consumed.
+func (f *Flags) parseFlagAt(args []string, i int) (int, error) {
+	name, value, inline := strings.Cut(args[i], "=")
+	for _, spec := range flagSpecs {
+		if spec.name != name {
+			continue
+		}
+		if !spec.hasValue {
+			if inline {
+				return i, errs.User(`"Flag %s does not take a value"`, name)
+			}
+			return i, spec.apply(f, "")
+		}
+		if !inline {
+			if i+1 >= len(args) {
+				return i, errs.User(`"Missing value for %s flag"`, name)
+			}
+			i++
+			value = args[i]
+		} else if value == "" {
+			return i, errs.User(`"Missing value for %s flag"`, name)
+		}
+		return i, spec.apply(f, value)
+	}
+	return i, errs.User(`"Unknown flag: %s (valid flags: %s; use -- or --prompt TEXT for a prompt that starts with a dash)"`, args[i], validFlagNames())
 }
 
 // ParseFlags parses the given argument slice (excluding the subcommand name)
 // and returns a populated Flags. It does NOT validate the values.
-// The positional arguments remaining after flag processing are joined as the prompt.
+// Flags come first, as "--flag value" or "--flag=value"; an unrecognised
+// token starting with "-" is an err:user. Flag parsing stops at the first
+// positional argument (or after a "--" separator): it and everything after
+// it, dashes included, are joined as the prompt. A token with whitespace in
+// its name, such as "-- analyze this", is positional (see isFlagToken).
+//
+// --prompt TEXT gives the prompt explicitly; it is an err:user together with
+// positional prompt text, since it is unclear which one was meant.
 func ParseFlags(args []string) (*Flags, error) {
 	f := &Flags{
 		Dir:     ".",
 		Timeout: 0,
 	}
 
+	explicit := false
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
 		switch {
-		case arg == "-d":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf(`err:user "Missing value for -d flag"`)
-			}
-			f.Dir = args[i+1]
-			i++
+		case arg == endOfFlags:
+			return f.positionalPrompt(args[i+1:], explicit)
 
-		case arg == "-t":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf(`err:user "Missing value for -t flag"`)
-			}
-			val := args[i+1]
-			timeout, err := strconv.Atoi(val)
+		case isFlagToken(arg):
+			next, err := f.parseFlagAt(args, i)
 			if err != nil {
-				return nil, fmt.Errorf(`err:user "Timeout must be a positive number: %s"`, val)
+				return nil, err
 			}
-			f.Timeout = timeout
-			i++
+			explicit = explicit || isPromptFlag(arg)
+			i = next
 
-		case arg == "-m":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf(`err:user "Missing value for -m flag"`)
-			}
-			f.Model = args[i+1]
-			i++
+		default:
+			return f.positionalPrompt(args[i:], explicit)
+		}
+	}
 
-		case arg == "--opus":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf(`err:user "Missing value for --opus flag"`)
-			}
-			f.OpusModel = args[i+1]
-			i++
+	return f, nil
+}
 
-		case arg == "--sonnet":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf(`err:user "Missing value for --sonnet flag"`)
-			}
-			f.SonnetModel = args[i+1]
-			i++
+// positionalPrompt joins rest into f's prompt. explicit means the prompt was
+// already given with --prompt, so any positional text is an err:user.
+func (f *Flags) positionalPrompt(rest []string, explicit bool) (*Flags, error) {
+	if !explicit {
+		f.Prompt = strings.Join(rest, " ")
+		return f, nil
+	}
+	if len(rest) > 0 {
+		return nil, errs.User(`"Prompt given twice: use either --prompt or positional text, not both"`)
+	}
+	return f, nil
+}
 
-		case arg == "--haiku":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf(`err:user "Missing value for --haiku flag"`)
+// ParseChainArgs parses chain arguments: flags (in either form) may appear
+// anywhere, and every positional argument is a separate prompt, as is the
+// value of every --prompt. Arguments after "--" are always prompts, and so
+// is a dash-prefixed argument with whitespace in it (see isFlagToken).
+// Chain-only flags (--continue-on-error, --json) must be removed by the
+// caller first. Groups are flattened; use ParseChainGroups to keep them.
+func ParseChainArgs(args []string) (*Flags, []string, error) {
+	f, groups, err := ParseChainGroups(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	var prompts []string
+	for _, g := range groups {
+		prompts = append(prompts, g...)
+	}
+	return f, prompts, nil
+}
+
+// chainThen separates the parallel groups of a chain.
+const chainThen = "--then"
+
+// ParseChainGroups parses chain arguments like ParseChainArgs and splits the
+// prompts into groups at every --then (which is recognised even after "--").
+// Without --then every prompt is its own group, so the chain runs strictly in
+// sequence. A --then with no prompt on either side is an error.
+func ParseChainGroups(args []string) (*Flags, [][]string, error) {
+	f := &Flags{
+		Dir:     ".",
+		Timeout: 0,
+	}
+
+	var groups [][]string
+	var current []string
+	split := false
+	positional := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == chainThen:
+			if len(current) == 0 {
+				return nil, nil, errs.User(`"Empty chain group: --then needs prompts on both sides"`)
 			}
-			f.HaikuModel = args[i+1]
-			i++
+			groups = append(groups, current)
+			current = nil
+			split = true
 
-		case arg == "--unsafe":
-			f.PermissionMode = "bypassPermissions"
+		case positional:
+			current = append(current, arg)
 
-		case arg == "--mode":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf(`err:user "Missing value for --mode flag"`)
+		case arg == endOfFlags:
+			positional = true
+
+		case isFlagToken(arg):
+			next, err := f.parseFlagAt(args, i)
+			if err != nil {
+				return nil, nil, err
 			}
-			f.PermissionMode = args[i+1]
-			i++
+			if isPromptFlag(arg) {
+				// Each --prompt is one more step, not the chain's prompt.
+				current = append(current, f.Prompt)
+				f.Prompt = ""
+			}
+			i = next
 
 		default:
-			// Positional arguments - collect all remaining args as prompt
-			f.Prompt = strings.Join(args[i:], " ")
-			return f, nil
+			current = append(current, arg)
 		}
 	}
 
-	return f, nil
+	if f.ContextFile != "" {
+		return nil, nil, errs.User(`"--context is for glm run; chain takes --context-as-file"`)
+	}
+	if !split {
+		for _, p := range current {
+			groups = append(groups, []string{p})
+		}
+		return f, groups, nil
+	}
+	if len(current) == 0 {
+		return nil, nil, errs.User(`"Empty chain group: --then needs prompts on both sides"`)
+	}
+	return f, append(groups, current), nil
+}
+
+// ValidateOptions provides testable inputs for Validate.
+type ValidateOptions struct {
+	// MaxPromptBytes is the largest accepted prompt (max_prompt_bytes).
+	// Zero uses config.DefaultMaxPromptBytes.
+	MaxPromptBytes int
 }
 
 // Validate checks the populated Flags for semantic correctness:
-//   - Dir must exist on the filesystem (unless it is ".")
+//   - Prompt must be non-empty and at most MaxPromptBytes long
+//   - Dir must exist on the filesystem (unless it is "."); it is then
+//     replaced by its canonical form (see job.CanonicalDir)
 //   - Timeout must be a positive integer
-//   - Prompt must be non-empty
+//   - ContextFile, when set, must be a readable file
 //
 // It returns an error whose message matches the BDD-specified format:
 //
 //	err:user "Directory not found: <dir>"
+//	err:user "Context file not found: <file>"
 //	err:user "Timeout must be a positive number: <val>"
 //	err:user "No prompt provided"
-func Validate(f *Flags) error {
+//	err:user "Prompt too large: <n> bytes (max_prompt_bytes is <max>)"
+func Validate(f *Flags, opts ...*ValidateOptions) error {
+	o := &ValidateOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+
 	// Check prompt is not empty first
 	if f.Prompt == "" {
-		return fmt.Errorf(`err:user "No prompt provided"`)
+		return errs.User(`"No prompt provided"`)
+	}
+	if err := CheckPromptSize(f.Prompt, o.MaxPromptBytes); err != nil {
+		return err
 	}
 
 	// Check directory exists (unless it's ".")
 	if f.Dir != "." {
 		if _, err := os.Stat(f.Dir); os.IsNotExist(err) {
-			return fmt.Errorf(`err:user "Directory not found: %s"`, f.Dir)
+			return errs.User(`"Directory not found: %s"`, f.Dir)
 		}
 	}
+	dir, err := job.CanonicalDir(f.Dir)
+	if err != nil {
+		return errs.User(`"Cannot resolve directory %s: %v"`, f.Dir, err)
+	}
+	f.Dir = dir
 
 	// Check timeout is positive
 	if f.Timeout <= 0 {
-		return fmt.Errorf(`err:user "Timeout must be a positive number: %d"`, f.Timeout)
+		return errs.User(`"Timeout must be a positive number: %d"`, f.Timeout)
+	}
+
+	if f.ContextFile != "" {
+		if info, err := os.Stat(f.ContextFile); err != nil || !info.Mode().IsRegular() {
+			return errs.User(`"Context file not found: %s"`, f.ContextFile)
+		}
 	}
 
 	return nil
 }
 
+// CheckPromptSize returns err:user when prompt is longer than maxBytes
+// (config.DefaultMaxPromptBytes when maxBytes is zero). Chain calls it for
+// each step, since chain prompts do not go through Validate.
+func CheckPromptSize(prompt string, maxBytes int) error {
+	if maxBytes <= 0 {
+		maxBytes = config.DefaultMaxPromptBytes
+	}
+	if len(prompt) > maxBytes {
+		return errs.User(`"Prompt too large: %d bytes (max_prompt_bytes is %d)"`, len(prompt), maxBytes)
+	}
+	return nil
+}
+
 // DefaultTimeout is used when the caller has not provided a -t flag.
 // In production it is read from the config; here it defaults to 0 (invalid)
 // so that the "Default timeout comes from config" scenario can be tested.
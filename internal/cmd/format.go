@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/template"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// ParseFormat parses the Go text/template of a --format option. The
+// template runs against the fields of one JobListItem, JobStatusJSON or
+// JobResultJSON by their Go names ({{.ID}}, {{.DurationSeconds}}), each as
+// its text (see formatFields). A field the item does not have renders
+// empty.
+//
+// It returns an error of the form:
+//
+//	err:user "Invalid --format template: <template error>"
+func ParseFormat(text string) (*template.Template, error) {
+	tmpl, err := template.New("format").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, errs.User(`"Invalid --format template: %s"`, err)
+	}
+	return tmpl, nil
+}
+
+// WriteFormatted executes tmpl against item and writes the result to w as
+// one line.
+func WriteFormatted(w io.Writer, tmpl *template.Template, item any) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, formatFields(item)); err != nil {
+		return errs.User(`"Invalid --format template: %s"`, err)
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ListFormat writes one line per job ListJSON would list for filter, tmpl
+// executed against its JobListItem (see WriteFormatted).
+func ListFormat(subagentsRoot string, filter *FilterOptions, tmpl *template.Template, w io.Writer) error {
+	items := ListJobs(subagentsRoot, filter)
+	if filter != nil && filter.Lineage != "" {
+		lineage, err := JobLineage(subagentsRoot, filter.Lineage)
+		if err != nil {
+			return err
+		}
+		items = lineageItems(lineage)
+	}
+	for _, item := range items {
+		if err := WriteFormatted(w, tmpl, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFields maps the exported fields of the struct item to their text:
+// strings as they are, nil pointers as "", numbers and bools as fmt prints
+// them, and structs, slices and maps as compact JSON. Keys missing from the
+// map render as "" under missingkey=zero.
+func formatFields(item any) map[string]string {
+	fields := map[string]string{}
+	v := reflect.Indirect(reflect.ValueOf(item))
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		fields[t.Field(i).Name] = formatValue(v.Field(i))
+	}
+	return fields
+}
+
+// formatValue returns the text of one field for formatFields.
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		if v.Kind() != reflect.Struct && v.Len() == 0 {
+			return ""
+		}
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,97 @@
+package cmd_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// Scenario: glm list --format prints one line per job from its JobListItem fields, and a field it does not have renders empty
+func TestListFormat(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	done := makeJobDir(t, root, "proj", "job-20260101-000000-aaaaaaaa", "done")
+	writeJobFile(t, done, "started_at.txt", "2026-01-01T00:00:00Z")
+	writeJobFile(t, done, "finished_at.txt", "2026-01-01T00:01:30Z")
+	if err := job.UpdateManifest(done, func(m *job.Manifest) { m.Prompt = "fix  the\nbug" }); err != nil {
+		t.Fatal(err)
+	}
+	makeJobDir(t, root, "proj", "job-20260101-000100-bbbbbbbb", "running")
+
+	tmpl, err := cmd.ParseFormat("{{.ID}} {{.Status}} [{{.DurationSeconds}}] {{.PromptPreview}}{{.Tags}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cmd.ListFormat(root, nil, tmpl, &buf); err != nil {
+		t.Fatal(err)
+	}
+	// The running job has no started_at and lists last.
+	want := "job-20260101-000000-aaaaaaaa done [90] fix the bug\n" +
+		"job-20260101-000100-bbbbbbbb running [] \n"
+	if buf.String() != want {
+		t.Errorf("output =\n%q\nwant\n%q", buf.String(), want)
+	}
+}
+
+// Scenario: a --format template that does not parse is err:user with the template error
+func TestParseFormatError(t *testing.T) {
+	_, err := cmd.ParseFormat("{{.ID")
+	if err == nil || !strings.HasPrefix(err.Error(), `err:user "Invalid --format template: template: format:1: unclosed action`) {
+		t.Errorf("ParseFormat = %v, want err:user with the parse error", err)
+	}
+
+	tmpl, err := cmd.ParseFormat("{{.ID.Nope}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.WriteFormatted(&bytes.Buffer{}, tmpl, cmd.JobListItem{ID: "x"})
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("WriteFormatted = %v, want err:user", err)
+	}
+}
+
+// Scenario: every field of JobListItem, JobStatusJSON and JobResultJSON can be used in a --format template
+func TestFormatFieldCoverage(t *testing.T) {
+	seven := 7
+	summary := "boom"
+	items := []any{
+		cmd.JobListItem{ID: "id", Status: "failed", StartedAt: "s", ProjectID: "p", PromptPreview: "pp", DurationSeconds: &seven,
+			ChainID: "c", Step: 2, ErrorSummary: &summary, RetriedFrom: "rf", RetriedBy: "rb"},
+		cmd.JobStatusJSON{ID: "id", Status: "done", PID: 1, StartedAt: "s", FinishedAt: "f", DurationSeconds: &seven, ElapsedSeconds: &seven,
+			ClaudeVersion: "v", SessionID: "sid"},
+		cmd.JobResultJSON{ID: "id", Status: "done", Prompt: "p", Stdout: "out", Stderr: "err", Changelog: "WRITE a.go",
+			Changes: []cmd.ChangelogEntry{{Op: cmd.ChangelogWrite, Path: "a.go"}}, DurationSeconds: &seven, ExitCode: &seven,
+			ChainID: "c", Step: 1, Git: &job.GitContext{Branch: "main"}, DiffStat: "1 file", ClaudeVersion: "v", GLMVersion: "g", SessionID: "sid", Mode: "plan", Plan: "out"},
+	}
+	for _, item := range items {
+		typ := reflect.TypeOf(item)
+		for i := 0; i < typ.NumField(); i++ {
+			name := typ.Field(i).Name
+			tmpl, err := cmd.ParseFormat("{{." + name + "}}")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := cmd.WriteFormatted(&buf, tmpl, item); err != nil {
+				t.Errorf("%s.%s: %v", typ.Name(), name, err)
+				continue
+			}
+			if strings.TrimSpace(buf.String()) == "" {
+				t.Errorf("%s.%s rendered empty", typ.Name(), name)
+			}
+		}
+	}
+
+	tmpl, _ := cmd.ParseFormat("{{.DurationSeconds}}|{{.Git}}|{{.Changes}}")
+	var buf bytes.Buffer
+	if err := cmd.WriteFormatted(&buf, tmpl, cmd.JobResultJSON{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "||\n" {
+		t.Errorf("unset fields = %q, want them empty", buf.String())
+	}
+}
@@ -3,6 +3,8 @@ package cmd
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +13,10 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
 )
 
 // InstallOptions configures the install command.
@@ -29,6 +35,10 @@ type InstallOptions struct {
 	SubagentsDir string
 	// Version is the current glm version string (e.g. "1.0.0").
 	Version string
+	// ForceClaudeMD overwrites a GLM section edited by hand without asking.
+	ForceClaudeMD bool
+	// KeepClaudeMD leaves a GLM section edited by hand without asking.
+	KeepClaudeMD bool
 	// In is the reader used for interactive prompts (defaults to os.Stdin).
 	In io.Reader
 	// Out is the writer used for prompt output (defaults to os.Stdout).
@@ -124,7 +134,7 @@ func InstallCmd(opts InstallOptions) error {
 		}
 		apiKey = strings.TrimSpace(apiKey)
 		if apiKey == "" {
-			return fmt.Errorf(`err:user "API key cannot be empty"`)
+			return errs.User(`"API key cannot be empty"`)
 		}
 		if err := os.WriteFile(apiKeyPath, []byte(apiKey), 0o600); err != nil {
 			return fmt.Errorf("write API key: %w", err)
@@ -189,7 +199,8 @@ func InstallCmd(opts InstallOptions) error {
 
 	// Step 5: Inject GLM section into CLAUDE.md.
 	template := loadGLMTemplate(opts.CloneDir)
-	if err := InjectClaudeMD(opts.ClaudeMDPath, template); err != nil {
+	injectOpts := &InjectOptions{Force: opts.ForceClaudeMD, Keep: opts.KeepClaudeMD, In: in, Out: out}
+	if err := InjectClaudeMD(opts.ClaudeMDPath, template, injectOpts); err != nil {
 		return fmt.Errorf("inject CLAUDE.md: %w", err)
 	}
 
@@ -329,18 +340,30 @@ type UninstallOptions struct {
 	ClaudeMDPath string
 	// SubagentsDir is the subagents directory.
 	SubagentsDir string
+	// DryRun lists what would be removed or modified without touching anything.
+	DryRun bool
+	// Yes answers yes to every prompt (credentials and job results are removed).
+	Yes bool
+	// Force removes SubagentsDir even while jobs in it are running.
+	Force bool
 	// In is the reader for interactive prompts.
 	In io.Reader
 	// Out is the writer for prompt output.
 	Out io.Writer
 }
 
-// UninstallCmd runs the interactive glm _uninstall flow:
-//  1. Removes the symlink at BinDir/glm (source installs only).
-//  2. Removes the GLM section from ClaudeMDPath (leaves other content).
-//  3. Prompts before removing ConfigDir/zai_api_key.
-//  4. Prompts before removing SubagentsDir.
-//  5. Removes ConfigDir.
+// UninstallCmd runs the glm uninstall flow:
+//  1. Asks before removing ConfigDir/zai_api_key and SubagentsDir (Yes
+//     answers both).
+//  2. Refuses with err:user, before changing anything, to remove SubagentsDir
+//     while one of its jobs is running (live PID), unless Force is set.
+//  3. Removes the symlink at BinDir/glm (source installs only).
+//  4. Removes the GLM section from ClaudeMDPath (leaves other content).
+//  5. Removes the API key and SubagentsDir if confirmed.
+//  6. Removes ConfigDir.
+//
+// With DryRun every path that would be removed or modified is listed and
+// nothing is touched or asked.
 func UninstallCmd(opts UninstallOptions) error {
 	in := opts.In
 	if in == nil {
@@ -351,9 +374,62 @@ func UninstallCmd(opts UninstallOptions) error {
 		out = os.Stdout
 	}
 
-	// Step 1: Remove the symlink at BinDir/glm (only for source installs).
 	installMode := readInstallMode(opts.ConfigDir)
 	symlinkPath := filepath.Join(opts.BinDir, "glm")
+	apiKeyPath := filepath.Join(opts.ConfigDir, "zai_api_key")
+	running := runningJobs(opts.SubagentsDir)
+
+	if opts.DryRun {
+		ask := ""
+		if !opts.Yes {
+			ask = " (asks first)"
+		}
+		if installMode == "source" && pathExists(symlinkPath) {
+			fmt.Fprintf(out, "Would remove symlink: %s\n", symlinkPath)
+		} else if installMode != "source" {
+			fmt.Fprintf(out, "Would leave the go-installed binary: %s\n", glmExecutablePath())
+		}
+		if hasGLMSection(opts.ClaudeMDPath) {
+			fmt.Fprintf(out, "Would remove the GLM section from: %s\n", opts.ClaudeMDPath)
+		}
+		if pathExists(apiKeyPath) {
+			fmt.Fprintf(out, "Would remove credentials: %s%s\n", apiKeyPath, ask)
+		}
+		if pathExists(opts.SubagentsDir) {
+			if len(running) > 0 && !opts.Force {
+				fmt.Fprintf(out, "Would refuse to remove job results: %s (%d running job(s); use --force)\n", opts.SubagentsDir, len(running))
+			} else {
+				fmt.Fprintf(out, "Would remove job results: %s%s\n", opts.SubagentsDir, ask)
+			}
+		}
+		if pathExists(opts.ConfigDir) {
+			fmt.Fprintf(out, "Would remove config dir: %s\n", opts.ConfigDir)
+		}
+		return nil
+	}
+
+	// Step 1: Ask about the API key and job results up front, so a refusal
+	// below happens before anything is removed.
+	removeKey, removeSubagents := opts.Yes, opts.Yes
+	if !opts.Yes {
+		var err error
+		removeKey, err = promptYN(in, out, fmt.Sprintf("Remove credentials (%s)? [y/N]: ", apiKeyPath))
+		if err != nil {
+			return fmt.Errorf("read credentials prompt: %w", err)
+		}
+		removeSubagents, err = promptYN(in, out, fmt.Sprintf("Remove job results (%s)? [y/N]: ", opts.SubagentsDir))
+		if err != nil {
+			return fmt.Errorf("read subagents prompt: %w", err)
+		}
+	}
+
+	// Step 2: Never pull job directories out from under running jobs.
+	if removeSubagents && len(running) > 0 && !opts.Force {
+		return errs.User(`"Cannot remove %s: %d job(s) still running (%s); wait, run glm kill, or use --force"`,
+			opts.SubagentsDir, len(running), strings.Join(running, ", "))
+	}
+
+	// Step 3: Remove the symlink at BinDir/glm (only for source installs).
 	if installMode == "source" {
 		if err := os.Remove(symlinkPath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("remove symlink: %w", err)
@@ -362,35 +438,24 @@ func UninstallCmd(opts UninstallOptions) error {
 		fmt.Fprintf(out, "Installed via go install — remove binary manually if needed: %s\n", glmExecutablePath())
 	}
 
-	// Step 2: Remove GLM section from CLAUDE.md.
+	// Step 4: Remove GLM section from CLAUDE.md.
 	if err := RemoveClaudeMDSection(opts.ClaudeMDPath); err != nil {
 		return fmt.Errorf("remove CLAUDE.md section: %w", err)
 	}
 
-	// Step 3: Prompt before removing API key.
-	apiKeyPath := filepath.Join(opts.ConfigDir, "zai_api_key")
-	removeKey, err := promptYN(in, out, fmt.Sprintf("Remove credentials (%s)? [y/N]: ", apiKeyPath))
-	if err != nil {
-		return fmt.Errorf("read credentials prompt: %w", err)
-	}
+	// Step 5: Remove the API key and job results if confirmed.
 	if removeKey {
 		if err := os.Remove(apiKeyPath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("remove API key: %w", err)
 		}
 	}
-
-	// Step 4: Prompt before removing subagents directory.
-	removeSubagents, err := promptYN(in, out, fmt.Sprintf("Remove job results (%s)? [y/N]: ", opts.SubagentsDir))
-	if err != nil {
-		return fmt.Errorf("read subagents prompt: %w", err)
-	}
 	if removeSubagents {
 		if err := os.RemoveAll(opts.SubagentsDir); err != nil {
 			return fmt.Errorf("remove subagents dir: %w", err)
 		}
 	}
 
-	// Step 5: Remove config directory.
+	// Step 6: Remove config directory.
 	if err := os.RemoveAll(opts.ConfigDir); err != nil {
 		return fmt.Errorf("remove config dir: %w", err)
 	}
@@ -399,6 +464,54 @@ func UninstallCmd(opts UninstallOptions) error {
 	return nil
 }
 
+// runningJobs returns the IDs of jobs under subagentsDir (project dirs and
+// the legacy flat layout) whose status is running and whose process is
+// alive. Nothing is written; dead jobs are simply not reported.
+func runningJobs(subagentsDir string) []string {
+	var dirs []string
+	entries, _ := os.ReadDir(subagentsDir)
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(subagentsDir, e.Name())
+		if strings.HasPrefix(e.Name(), "job-") {
+			dirs = append(dirs, dir)
+			continue
+		}
+		subs, _ := os.ReadDir(dir)
+		for _, sub := range subs {
+			if sub.IsDir() && strings.HasPrefix(sub.Name(), "job-") {
+				dirs = append(dirs, filepath.Join(dir, sub.Name()))
+			}
+		}
+	}
+	var running []string
+	for _, dir := range dirs {
+		m := job.LoadManifest(dir)
+		if m.Status == job.StatusRunning && m.PID > 0 && slot.IsProcessAlive(m.PID) {
+			running = append(running, filepath.Base(dir))
+		}
+	}
+	return running
+}
+
+// hasGLMSection reports whether the file at path contains both GLM markers.
+func hasGLMSection(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	start := strings.Index(string(data), glmSectionStart)
+	return start >= 0 && strings.Index(string(data), glmSectionEnd) > start
+}
+
+// pathExists reports whether path exists (a dangling symlink counts).
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
 // UpdateOptions configures the update command.
 type UpdateOptions struct {
 	// ConfigDir is the GoLeM config directory (for reading config.json install_mode).
@@ -407,49 +520,117 @@ type UpdateOptions struct {
 	CloneDir string
 	// ClaudeMDPath is the CLAUDE.md to re-inject after pulling.
 	ClaudeMDPath string
+	// Version is the running glm version, compared against the module proxy
+	// by Check for go-install installs.
+	Version string
+	// Target pins the update to a tag, branch or commit (go-install: any
+	// version accepted by "go install ...@<Target>"). Empty means the latest
+	// upstream revision.
+	Target string
+	// Check only reports whether an update is available; nothing is applied.
+	Check bool
+	// Yes skips the confirmation prompt.
+	Yes bool
+	// ForceClaudeMD overwrites a GLM section edited by hand without asking.
+	ForceClaudeMD bool
+	// KeepClaudeMD leaves a GLM section edited by hand without asking.
+	KeepClaudeMD bool
+	// In is the reader for the confirmation prompt (defaults to os.Stdin).
+	In io.Reader
 	// Out is the writer for progress output.
 	Out io.Writer
 	// ErrOut is the writer for error output.
 	ErrOut io.Writer
 }
 
+// injectOptions returns the InjectClaudeMD options for an update.
+func (opts UpdateOptions) injectOptions() *InjectOptions {
+	return &InjectOptions{Force: opts.ForceClaudeMD, Keep: opts.KeepClaudeMD, In: opts.In, Out: opts.Out}
+}
+
+// glmModule is the module path used for go-install updates.
+const glmModule = "github.com/veschin/GoLeM"
+
 // UpdateCmd implements glm update:
 //
 // For source installs:
-//  1. Validates CloneDir is a git repository.
-//  2. Records the current HEAD revision.
-//  3. Runs "git pull --ff-only".
-//  4. Displays old→new revisions and the commit log between them.
-//  5. Re-injects the GLM section into ClaudeMDPath.
+//  1. Validates CloneDir is a git repository and fetches origin (with tags).
+//  2. Resolves the target: the upstream branch, or opts.Target as a tag,
+//     remote branch or commit. An unknown target returns err:user.
+//  3. Displays old→new revisions and the commit log between them; with
+//     opts.Check it stops here.
+//  4. Asks for confirmation unless opts.Yes is set.
+//  5. Fast-forwards to the upstream branch or checks out the target. A failed
+//     checkout leaves the working tree untouched and returns err:user.
+//  6. Re-injects the GLM section into ClaudeMDPath.
 //
 // For go-install:
-//  1. Runs "go install github.com/veschin/GoLeM/cmd/glm@latest".
-//  2. Re-injects the GLM section into ClaudeMDPath.
+//  1. With opts.Check, compares opts.Version to the latest version on the
+//     module proxy and stops.
+//  2. Asks for confirmation unless opts.Yes is set.
+//  3. Resolves the target (@latest by default) to a module version and runs
+//     "go install github.com/veschin/GoLeM/cmd/glm@<version>".
+//  4. Runs "glm version" on the installed binary (in GOBIN, or GOPATH/bin)
+//     and checks it reports the expected version.
+//  5. Re-injects the GLM section into ClaudeMDPath.
+//
+// ClaudeMDPath is snapshotted first and restored if any step fails, so a
+// failed update never leaves it half-updated.
 func UpdateCmd(opts UpdateOptions) error {
-	out := opts.Out
-	if out == nil {
-		out = os.Stdout
+	if opts.In == nil {
+		opts.In = os.Stdin
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
 	}
-	errOut := opts.ErrOut
-	if errOut == nil {
-		errOut = os.Stderr
+	if opts.ErrOut == nil {
+		opts.ErrOut = os.Stderr
 	}
 
-	installMode := readInstallMode(opts.ConfigDir)
+	restore, err := snapshotFile(opts.ClaudeMDPath)
+	if err != nil {
+		return fmt.Errorf("snapshot CLAUDE.md: %w", err)
+	}
 
-	if installMode == "go-install" {
-		return updateGoInstall(opts.ClaudeMDPath, out, errOut)
+	update := updateSource
+	if readInstallMode(opts.ConfigDir) == "go-install" {
+		update = updateGoInstall
 	}
+	if err := update(opts); err != nil {
+		if rerr := restore(); rerr != nil {
+			return fmt.Errorf("%w (restoring %s: %v)", err, opts.ClaudeMDPath, rerr)
+		}
+		return err
+	}
+	return nil
+}
 
-	return updateSource(opts.CloneDir, opts.ClaudeMDPath, out, errOut)
+// snapshotFile records the content of path (or its absence) and returns a
+// function that puts it back.
+func snapshotFile(path string) (restore func() error, err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return func() error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return os.WriteFile(path, data, 0o644) }, nil
 }
 
-// updateSource handles update for clone-based installs via git pull.
-func updateSource(cloneDir, claudeMDPath string, out, errOut io.Writer) error {
+// updateSource handles update for clone-based installs via git.
+func updateSource(opts UpdateOptions) error {
+	cloneDir, out := opts.CloneDir, opts.Out
+
 	// Validate CloneDir is a git repository.
 	gitDir := filepath.Join(cloneDir, ".git")
 	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
-		return fmt.Errorf("err:user %q is not a git repository", cloneDir)
+		return errs.User("%q is not a git repository", cloneDir)
 	}
 
 	// Record the current HEAD revision.
@@ -458,39 +639,65 @@ func updateSource(cloneDir, claudeMDPath string, out, errOut io.Writer) error {
 		return fmt.Errorf("get current HEAD: %w", err)
 	}
 
-	// Run "git pull --ff-only".
-	pullCmd := exec.Command("git", "pull", "--ff-only")
-	pullCmd.Dir = cloneDir
-	pullOutput, pullErr := pullCmd.CombinedOutput()
-	if pullErr != nil {
-		if strings.Contains(string(pullOutput), "Not possible to fast-forward") ||
-			strings.Contains(string(pullOutput), "diverged") {
-			return fmt.Errorf(`err:user "Cannot fast-forward, repository has diverged"`)
-		}
-		return fmt.Errorf("git pull: %s", strings.TrimSpace(string(pullOutput)))
+	// Fetch so the upstream branch and tags are current. Only remote-tracking
+	// refs change; the working tree is left alone.
+	if output, err := gitOutput(cloneDir, "fetch", "--tags", "--quiet", "origin"); err != nil {
+		return fmt.Errorf("git fetch: %s", output)
 	}
 
-	// Get new HEAD revision.
-	newRev, err := gitRevParse(cloneDir, "HEAD")
+	target, apply, err := resolveUpdateTarget(cloneDir, opts.Target)
 	if err != nil {
-		return fmt.Errorf("get new HEAD: %w", err)
+		return err
+	}
+	newRev, err := gitRevParse(cloneDir, target)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", target, err)
 	}
 
-	fmt.Fprintf(out, "Updated: %s → %s\n", oldRev, newRev)
+	if oldRev == newRev {
+		fmt.Fprintf(out, "Already up to date (%s).\n", oldRev)
+		return nil
+	}
+
+	if opts.Check {
+		fmt.Fprintf(out, "Update available: %s → %s\n", oldRev, newRev)
+	} else {
+		fmt.Fprintf(out, "Changes to apply: %s → %s\n", oldRev, newRev)
+	}
+	// Show the commit log between the old and new revisions. A target that is
+	// not ahead of HEAD (an older tag) has no commits to show.
+	logOutput, _ := gitOutput(cloneDir, "log", "--oneline", oldRev+".."+newRev)
+	if logOutput != "" {
+		fmt.Fprintf(out, "%s\n", logOutput)
+	} else {
+		fmt.Fprintf(out, "(no new commits: %s is not ahead of %s)\n", newRev, oldRev)
+	}
+	if opts.Check {
+		return nil
+	}
 
-	// Show commit log between old and new revisions if they differ.
-	if oldRev != newRev {
-		logCmd := exec.Command("git", "log", "--oneline", oldRev+".."+newRev)
-		logCmd.Dir = cloneDir
-		logOutput, _ := logCmd.Output()
-		if len(logOutput) > 0 {
-			fmt.Fprintf(out, "%s\n", strings.TrimSpace(string(logOutput)))
+	if !opts.Yes {
+		ok, err := promptYN(opts.In, out, "Apply update? [y/N]: ")
+		if err != nil {
+			return fmt.Errorf("read update prompt: %w", err)
+		}
+		if !ok {
+			fmt.Fprintln(out, "Update cancelled.")
+			return nil
 		}
 	}
 
+	// git refuses a checkout or merge that would overwrite local changes
+	// before touching the working tree, so a failure here changes nothing.
+	if output, err := gitOutput(cloneDir, apply...); err != nil {
+		return errs.User(`"Cannot switch to %s: %s"`, newRev, strings.Join(strings.Fields(output), " "))
+	}
+
+	fmt.Fprintf(out, "Updated: %s → %s\n", oldRev, newRev)
+
 	// Re-inject the GLM section into CLAUDE.md.
 	template := loadGLMTemplate(cloneDir)
-	if err := InjectClaudeMD(claudeMDPath, template); err != nil {
+	if err := InjectClaudeMD(opts.ClaudeMDPath, template, opts.injectOptions()); err != nil {
 		return fmt.Errorf("inject CLAUDE.md: %w", err)
 	}
 
@@ -498,18 +705,101 @@ func updateSource(cloneDir, claudeMDPath string, out, errOut io.Writer) error {
 	return nil
 }
 
+// resolveUpdateTarget returns the revision a source install updates to and
+// the git arguments that apply it. An empty target means the upstream branch
+// (fast-forward only); otherwise target is looked up as a tag, then as a
+// branch on origin, then as any commit.
+func resolveUpdateTarget(cloneDir, target string) (rev string, apply []string, err error) {
+	if target == "" {
+		if !gitRefExists(cloneDir, "@{upstream}") {
+			return "", nil, errs.User(`"No upstream branch to update from; use glm update --to <tag|branch>"`)
+		}
+		if _, err := gitOutput(cloneDir, "merge-base", "--is-ancestor", "HEAD", "@{upstream}"); err != nil {
+			return "", nil, errs.User(`"Cannot fast-forward, repository has diverged"`)
+		}
+		return "@{upstream}", []string{"merge", "--ff-only", "--quiet", "@{upstream}"}, nil
+	}
+
+	if strings.HasPrefix(target, "-") {
+		return "", nil, errs.User(`"Unknown update target: %s"`, target)
+	}
+	if tag := "refs/tags/" + target; gitRefExists(cloneDir, tag) {
+		return tag, []string{"checkout", "--quiet", tag}, nil
+	}
+	if remote := "refs/remotes/origin/" + target; gitRefExists(cloneDir, remote) {
+		// Move the local branch to origin's only if that loses no local commits.
+		if local := "refs/heads/" + target; gitRefExists(cloneDir, local) {
+			if _, err := gitOutput(cloneDir, "merge-base", "--is-ancestor", local, remote); err != nil {
+				return "", nil, errs.User(`"Cannot fast-forward branch %s, it has diverged from origin"`, target)
+			}
+		}
+		return remote, []string{"checkout", "--quiet", "-B", target, remote}, nil
+	}
+	if gitRefExists(cloneDir, target) {
+		return target, []string{"checkout", "--quiet", "--detach", target}, nil
+	}
+	return "", nil, errs.User(`"Unknown update target: %s (no such tag, branch or commit)"`, target)
+}
+
 // updateGoInstall handles update for go-install-based installs.
-func updateGoInstall(claudeMDPath string, out, errOut io.Writer) error {
+func updateGoInstall(opts UpdateOptions) error {
+	out := opts.Out
+	target := opts.Target
+	if target == "" {
+		target = "latest"
+	}
+
+	if opts.Check {
+		latest, err := moduleVersion("latest")
+		if err != nil {
+			return err
+		}
+		if strings.TrimPrefix(latest, "v") == strings.TrimPrefix(opts.Version, "v") {
+			fmt.Fprintf(out, "Already up to date (%s).\n", latest)
+		} else {
+			fmt.Fprintf(out, "Update available: %s → %s\n", opts.Version, latest)
+		}
+		return nil
+	}
+
+	version, err := moduleVersion(target)
+	if err != nil {
+		if opts.Target != "" {
+			return errs.User(`"Unknown update target: %s (%v)"`, opts.Target, err)
+		}
+		return err
+	}
+	pkg := glmModule + "/cmd/glm@" + version
+	if !opts.Yes {
+		ok, err := promptYN(opts.In, out, fmt.Sprintf("Install %s (current: %s)? [y/N]: ", pkg, opts.Version))
+		if err != nil {
+			return fmt.Errorf("read update prompt: %w", err)
+		}
+		if !ok {
+			fmt.Fprintln(out, "Update cancelled.")
+			return nil
+		}
+	}
+
 	fmt.Fprintln(out, "Updating via go install...")
-	goCmd := exec.Command("go", "install", "github.com/veschin/GoLeM/cmd/glm@latest")
+	goCmd := exec.Command("go", "install", pkg)
 	goCmd.Stdout = out
-	goCmd.Stderr = errOut
+	goCmd.Stderr = opts.ErrOut
 	if err := goCmd.Run(); err != nil {
 		return fmt.Errorf("go install: %w", err)
 	}
 
+	binPath, err := goInstalledBinary()
+	if err != nil {
+		return err
+	}
+	if err := verifyInstalledBinary(binPath, version); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Installed: %s (%s)\n", binPath, version)
+
 	// Re-inject CLAUDE.md with default template (no clone dir for go-install).
-	if err := InjectClaudeMD(claudeMDPath, glmSubagentTemplate); err != nil {
+	if err := InjectClaudeMD(opts.ClaudeMDPath, glmSubagentTemplate, opts.injectOptions()); err != nil {
 		return fmt.Errorf("inject CLAUDE.md: %w", err)
 	}
 
@@ -517,6 +807,62 @@ func updateGoInstall(claudeMDPath string, out, errOut io.Writer) error {
 	return nil
 }
 
+// goInstalledBinary returns where go install puts the glm binary: GOBIN, or
+// the bin directory of the first GOPATH entry.
+func goInstalledBinary() (string, error) {
+	output, err := exec.Command("go", "env", "GOBIN", "GOPATH").Output()
+	if err != nil {
+		return "", fmt.Errorf("go env: %w", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	dir := ""
+	if len(lines) > 0 {
+		dir = strings.TrimSpace(lines[0])
+	}
+	if dir == "" && len(lines) > 1 {
+		if gopath := filepath.SplitList(strings.TrimSpace(lines[1])); len(gopath) > 0 {
+			dir = filepath.Join(gopath[0], "bin")
+		}
+	}
+	if dir == "" {
+		return "", errs.Internal(`"Cannot determine the go install directory (GOBIN and GOPATH are empty)"`)
+	}
+	return filepath.Join(dir, "glm"), nil
+}
+
+// verifyInstalledBinary runs "<binPath> version" and checks it reports
+// version. Pseudo-versions and pre-releases (branch or commit targets) are
+// not comparable to the built-in version string, so for them any "glm ..."
+// output is accepted.
+func verifyInstalledBinary(binPath, version string) error {
+	output, err := exec.Command(binPath, "version").Output()
+	got := strings.TrimSpace(string(output))
+	if err != nil {
+		return errs.Internal(`"Installed binary %s failed verification: %v"`, binPath, err)
+	}
+	if !strings.HasPrefix(got, "glm ") {
+		return errs.Internal(`"Installed binary %s failed verification: unexpected output: %s"`, binPath, got)
+	}
+	want := strings.TrimPrefix(version, "v")
+	if strings.Contains(want, "-") {
+		return nil
+	}
+	if have := strings.TrimPrefix(strings.TrimPrefix(got, "glm "), "v"); have != want {
+		return errs.Internal(`"Installed binary %s reports version %s, expected %s"`, binPath, have, want)
+	}
+	return nil
+}
+
+// moduleVersion asks the module proxy (via go list) which version of
+// glmModule query ("latest", a tag, a branch or a commit) resolves to.
+func moduleVersion(query string) (string, error) {
+	output, err := exec.Command("go", "list", "-m", "-f", "{{.Version}}", glmModule+"@"+query).Output()
+	if err != nil {
+		return "", fmt.Errorf("query %s version: %w", query, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // readInstallMode reads the install_mode from config.json in configDir.
 // Returns "source" as default if config.json is missing or unreadable.
 func readInstallMode(configDir string) string {
@@ -536,6 +882,20 @@ func readInstallMode(configDir string) string {
 	return meta.InstallMode
 }
 
+// gitRefExists reports whether ref names a commit in the repository at dir.
+func gitRefExists(dir, ref string) bool {
+	_, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// gitOutput runs git with args in dir and returns its trimmed combined output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
 // gitRevParse runs "git rev-parse --short <ref>" in dir and returns the output.
 func gitRevParse(dir, ref string) (string, error) {
 	cmd := exec.Command("git", "rev-parse", "--short", ref)
@@ -547,21 +907,95 @@ func gitRevParse(dir, ref string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+// InjectOptions controls what InjectClaudeMD does with a GLM section that
+// was edited by hand since glm last wrote it.
+type InjectOptions struct {
+	// Force overwrites an edited section without asking.
+	Force bool
+	// Keep leaves an edited section alone without asking.
+	Keep bool
+	// In is the reader for the overwrite prompt. When nil (and neither Force
+	// nor Keep is set) an edited section is an err:user.
+	In io.Reader
+	// Out is the writer for the prompt and notices (defaults to os.Stdout).
+	Out io.Writer
+}
+
+// glmSectionVersion prefixes the comment, written right after the start
+// marker, that records the sha256 of the section body glm wrote.
+const glmSectionVersion = "<!-- GLM-SUBAGENT-VERSION: sha256:"
+
+// glmSectionBody returns the body of a GLM section: the text between the
+// markers without the version comment. section may or may not include the
+// markers.
+func glmSectionBody(section string) string {
+	body := section
+	if i := strings.Index(body, glmSectionStart); i >= 0 {
+		body = body[i+len(glmSectionStart):]
+	}
+	if i := strings.Index(body, glmSectionEnd); i >= 0 {
+		body = body[:i]
+	}
+	body = strings.TrimPrefix(body, "\n")
+	if strings.HasPrefix(body, glmSectionVersion) {
+		if i := strings.Index(body, "\n"); i >= 0 {
+			body = body[i+1:]
+		} else {
+			body = ""
+		}
+	}
+	return strings.TrimSuffix(body, "\n")
+}
+
+// glmSectionHash returns the hex sha256 of a section body.
+func glmSectionHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// buildGLMSection returns the section glm writes for template: the markers,
+// the version comment and the template body.
+func buildGLMSection(template string) string {
+	body := glmSectionBody(template)
+	return glmSectionStart + "\n" + glmSectionVersion + glmSectionHash(body) + " -->\n" + body + "\n" + glmSectionEnd
+}
+
+// glmSectionEdited reports whether section (markers included) was changed
+// since glm wrote it, i.e. its body no longer matches its version comment.
+// Sections written before version comments existed are never reported.
+func glmSectionEdited(section string) bool {
+	inner := strings.TrimPrefix(section[len(glmSectionStart):], "\n")
+	if !strings.HasPrefix(inner, glmSectionVersion) {
+		return false
+	}
+	line, _, _ := strings.Cut(inner, "\n")
+	recorded := strings.TrimSuffix(strings.TrimPrefix(line, glmSectionVersion), " -->")
+	return recorded != glmSectionHash(glmSectionBody(section))
+}
+
 // InjectClaudeMD injects or replaces the GLM subagent section (bounded by
 // <!-- GLM-SUBAGENT-START --> and <!-- GLM-SUBAGENT-END --> markers) in the
-// file at claudeMDPath using content from template.
+// file at claudeMDPath using content from template. The section carries a
+// <!-- GLM-SUBAGENT-VERSION: sha256:... --> comment with the hash of its body.
 //
 //   - If the file does not exist it is created containing only the section.
-//   - If the file exists with both markers the section between them is replaced.
+//   - If the file exists with both markers the section between them is
+//     replaced, unless its body no longer matches its version comment (edited
+//     by hand): then InjectOptions decides — Force overwrites, Keep skips,
+//     otherwise the user is asked on In (an answer other than "y" keeps it).
 //   - If the file exists without markers the section is appended at the end.
-func InjectClaudeMD(claudeMDPath, template string) error {
-	// Ensure the template itself contains the markers.
-	// If it doesn't already have them, wrap it.
-	templateContent := template
-	if !strings.Contains(templateContent, glmSectionStart) {
-		templateContent = glmSectionStart + "\n" + template + "\n" + glmSectionEnd
+func InjectClaudeMD(claudeMDPath, template string, opts ...*InjectOptions) error {
+	o := &InjectOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	out := o.Out
+	if out == nil {
+		out = os.Stdout
 	}
 
+	templateContent := buildGLMSection(template)
+
 	// Ensure parent directory exists.
 	if err := os.MkdirAll(filepath.Dir(claudeMDPath), 0o755); err != nil {
 		return fmt.Errorf("create parent dir: %w", err)
@@ -582,7 +1016,24 @@ func InjectClaudeMD(claudeMDPath, template string) error {
 	endIdx := strings.Index(content, glmSectionEnd)
 
 	if startIdx >= 0 && endIdx > startIdx {
-		// Both markers found — replace the section between them (inclusive).
+		// Both markers found — replace the section between them (inclusive),
+		// after checking it was not edited by hand.
+		if section := content[startIdx : endIdx+len(glmSectionEnd)]; glmSectionEdited(section) && !o.Force {
+			overwrite := false
+			if !o.Keep {
+				if o.In == nil {
+					return errs.User(`"The GLM section in %s was edited by hand; use --force to overwrite it or --keep to leave it"`, claudeMDPath)
+				}
+				overwrite, err = promptYN(o.In, out, fmt.Sprintf("The GLM section in %s was edited by hand. Overwrite it? [y/N]: ", claudeMDPath))
+				if err != nil {
+					return fmt.Errorf("read overwrite prompt: %w", err)
+				}
+			}
+			if !overwrite {
+				fmt.Fprintf(out, "Kept the edited GLM section in %s.\n", claudeMDPath)
+				return nil
+			}
+		}
 		before := content[:startIdx]
 		after := content[endIdx+len(glmSectionEnd):]
 		newContent := before + templateContent + after
@@ -599,8 +1050,9 @@ func InjectClaudeMD(claudeMDPath, template string) error {
 }
 
 // RemoveClaudeMDSection removes the GLM subagent section (including the marker
-// lines themselves) from the file at claudeMDPath. Content outside the markers
-// is preserved. No-ops when the file does not exist or contains no markers.
+// lines and the version comment between them) from the file at claudeMDPath.
+// Content outside the markers is preserved. No-ops when the file does not
+// exist or contains no markers.
 func RemoveClaudeMDSection(claudeMDPath string) error {
 	data, err := os.ReadFile(claudeMDPath)
 	if os.IsNotExist(err) {
@@ -0,0 +1,300 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+const (
+	templateV1 = "<!-- GLM-SUBAGENT-START -->\nUse glm for small tasks.\n<!-- GLM-SUBAGENT-END -->"
+	templateV2 = "<!-- GLM-SUBAGENT-START -->\nUse glm for every task.\n<!-- GLM-SUBAGENT-END -->"
+)
+
+// injectedClaudeMD writes CLAUDE.md with user notes around a section injected
+// from templateV1 and returns its path.
+func injectedClaudeMD(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "CLAUDE.md")
+	if err := os.WriteFile(path, []byte("# notes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.InjectClaudeMD(path, templateV1); err != nil {
+		t.Fatalf("InjectClaudeMD: %v", err)
+	}
+	return path
+}
+
+// editSection replaces old with new inside the file at path.
+func editSection(t *testing.T, path, old, new string) {
+	t.Helper()
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of the file at path.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Scenario: The injected section carries a version comment and a pristine section is replaced
+func TestInjectClaudeMDReplacesPristineSection(t *testing.T) {
+	path := injectedClaudeMD(t)
+	got := readFile(t, path)
+	if !strings.HasPrefix(got, "# notes\n<!-- GLM-SUBAGENT-START -->\n<!-- GLM-SUBAGENT-VERSION: sha256:") {
+		t.Fatalf("CLAUDE.md = %q, want a version comment after the start marker", got)
+	}
+
+	// No prompt is needed for a section glm wrote itself.
+	if err := cmd.InjectClaudeMD(path, templateV2); err != nil {
+		t.Fatalf("InjectClaudeMD: %v", err)
+	}
+	got = readFile(t, path)
+	if !strings.Contains(got, "every task") || strings.Contains(got, "small tasks") {
+		t.Errorf("CLAUDE.md = %q, want the new section", got)
+	}
+	if strings.Count(got, "GLM-SUBAGENT-VERSION") != 1 {
+		t.Errorf("CLAUDE.md = %q, want exactly one version comment", got)
+	}
+
+	// Sections from before version comments existed are replaced too.
+	legacy := filepath.Join(t.TempDir(), "CLAUDE.md")
+	if err := os.WriteFile(legacy, []byte(templateV1+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.InjectClaudeMD(legacy, templateV2); err != nil {
+		t.Fatalf("InjectClaudeMD legacy: %v", err)
+	}
+	if !strings.Contains(readFile(t, legacy), "every task") {
+		t.Errorf("legacy section not replaced")
+	}
+}
+
+// Scenario: A hand-edited section is detected and the user is asked
+func TestInjectClaudeMDDetectsEditedSection(t *testing.T) {
+	path := injectedClaudeMD(t)
+	editSection(t, path, "small tasks.", "small tasks.\nMy own rule.")
+	edited := readFile(t, path)
+
+	// Without a reader or a flag, the edit is an error and nothing changes.
+	err := cmd.InjectClaudeMD(path, templateV2)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("err = %v, want err:user", err)
+	}
+	if readFile(t, path) != edited {
+		t.Error("edited section changed without confirmation")
+	}
+
+	// Declining keeps the edit.
+	var out bytes.Buffer
+	err = cmd.InjectClaudeMD(path, templateV2, &cmd.InjectOptions{In: strings.NewReader("n\n"), Out: &out})
+	if err != nil {
+		t.Fatalf("InjectClaudeMD: %v", err)
+	}
+	if !strings.Contains(out.String(), "edited by hand") || readFile(t, path) != edited {
+		t.Errorf("declined overwrite: output %q, file %q", out.String(), readFile(t, path))
+	}
+
+	// Confirming overwrites it.
+	out.Reset()
+	err = cmd.InjectClaudeMD(path, templateV2, &cmd.InjectOptions{In: strings.NewReader("y\n"), Out: &out})
+	if err != nil {
+		t.Fatalf("InjectClaudeMD: %v", err)
+	}
+	if got := readFile(t, path); strings.Contains(got, "My own rule") || !strings.Contains(got, "every task") {
+		t.Errorf("confirmed overwrite: file %q", got)
+	}
+}
+
+// Scenario: --force overwrites and --keep skips an edited section without asking
+func TestInjectClaudeMDForceAndKeep(t *testing.T) {
+	path := injectedClaudeMD(t)
+	editSection(t, path, "small tasks.", "tiny tasks.")
+	edited := readFile(t, path)
+
+	var out bytes.Buffer
+	if err := cmd.InjectClaudeMD(path, templateV2, &cmd.InjectOptions{Keep: true, Out: &out}); err != nil {
+		t.Fatalf("InjectClaudeMD --keep: %v", err)
+	}
+	if readFile(t, path) != edited {
+		t.Error("--keep changed the edited section")
+	}
+
+	if err := cmd.InjectClaudeMD(path, templateV2, &cmd.InjectOptions{Force: true, Out: &out}); err != nil {
+		t.Fatalf("InjectClaudeMD --force: %v", err)
+	}
+	got := readFile(t, path)
+	if strings.Contains(got, "tiny tasks") || !strings.HasPrefix(got, "# notes\n") {
+		t.Errorf("--force: file %q", got)
+	}
+
+	// The forced section is pristine again, so the next update needs no flag.
+	if err := cmd.InjectClaudeMD(path, templateV1); err != nil {
+		t.Errorf("InjectClaudeMD after --force: %v", err)
+	}
+}
+
+// Scenario: Uninstall removes the section including its version comment
+func TestRemoveClaudeMDSectionRemovesVersionComment(t *testing.T) {
+	path := injectedClaudeMD(t)
+	if err := cmd.RemoveClaudeMDSection(path); err != nil {
+		t.Fatalf("RemoveClaudeMDSection: %v", err)
+	}
+	if got := readFile(t, path); got != "# notes\n" {
+		t.Errorf("CLAUDE.md = %q, want only the user notes", got)
+	}
+}
+
+// uninstallFixture creates a source install: symlink, CLAUDE.md with notes
+// and a GLM section, API key, config dir and one finished job. It returns
+// options pointing at it.
+func uninstallFixture(t *testing.T, out *bytes.Buffer) cmd.UninstallOptions {
+	t.Helper()
+	base := t.TempDir()
+	opts := cmd.UninstallOptions{
+		BinDir:       filepath.Join(base, "bin"),
+		ConfigDir:    filepath.Join(base, "config"),
+		ClaudeMDPath: filepath.Join(base, "CLAUDE.md"),
+		SubagentsDir: filepath.Join(base, "subagents"),
+		In:           strings.NewReader(""),
+		Out:          out,
+	}
+	for _, d := range []string{opts.BinDir, opts.ConfigDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(base, "clone", "glm"), filepath.Join(opts.BinDir, "glm")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(opts.ConfigDir, "zai_api_key"), []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(opts.ClaudeMDPath, []byte("# notes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.InjectClaudeMD(opts.ClaudeMDPath, templateV1); err != nil {
+		t.Fatal(err)
+	}
+	makeJobDir(t, opts.SubagentsDir, "proj", "job-20260227-143205-a8f3b1c2", "done")
+	return opts
+}
+
+// snapshotTree returns every path under root with its content (symlink
+// targets for symlinks).
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			tree[path], _ = os.Readlink(path)
+		case info.Mode().IsRegular():
+			data, _ := os.ReadFile(path)
+			tree[path] = string(data)
+		default:
+			tree[path] = "dir"
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// Scenario: --dry-run lists every path and leaves the filesystem untouched
+func TestUninstallDryRunTouchesNothing(t *testing.T) {
+	var out bytes.Buffer
+	opts := uninstallFixture(t, &out)
+	root := filepath.Dir(opts.ConfigDir)
+	before := snapshotTree(t, root)
+
+	opts.DryRun = true
+	if err := cmd.UninstallCmd(opts); err != nil {
+		t.Fatalf("UninstallCmd: %v", err)
+	}
+	for _, p := range []string{
+		filepath.Join(opts.BinDir, "glm"), opts.ClaudeMDPath,
+		filepath.Join(opts.ConfigDir, "zai_api_key"), opts.SubagentsDir, opts.ConfigDir,
+	} {
+		if !strings.Contains(out.String(), p+"\n") && !strings.Contains(out.String(), p+" ") {
+			t.Errorf("dry run output does not list %s:\n%s", p, out.String())
+		}
+	}
+	after := snapshotTree(t, root)
+	if len(after) != len(before) {
+		t.Fatalf("dry run changed the tree: %d paths before, %d after", len(before), len(after))
+	}
+	for p, v := range before {
+		if after[p] != v {
+			t.Errorf("dry run changed %s", p)
+		}
+	}
+}
+
+// Scenario: --yes removes everything without prompting
+func TestUninstallYesRemovesEverything(t *testing.T) {
+	var out bytes.Buffer
+	opts := uninstallFixture(t, &out)
+	opts.Yes = true
+	if err := cmd.UninstallCmd(opts); err != nil {
+		t.Fatalf("UninstallCmd: %v", err)
+	}
+	for _, p := range []string{filepath.Join(opts.BinDir, "glm"), opts.ConfigDir, opts.SubagentsDir} {
+		if _, err := os.Lstat(p); err == nil {
+			t.Errorf("%s still exists", p)
+		}
+	}
+	if got := readFile(t, opts.ClaudeMDPath); got != "# notes\n" {
+		t.Errorf("CLAUDE.md = %q", got)
+	}
+	if strings.Contains(out.String(), "[y/N]") {
+		t.Errorf("--yes prompted: %q", out.String())
+	}
+}
+
+// Scenario: A running job blocks removing job results unless --force
+func TestUninstallRefusesWhileJobsRun(t *testing.T) {
+	var out bytes.Buffer
+	opts := uninstallFixture(t, &out)
+	jobDir := makeJobDir(t, opts.SubagentsDir, "proj", "job-20260227-143206-b1c2d3e4", "running")
+	if err := os.WriteFile(filepath.Join(jobDir, "pid.txt"), []byte(strconv.Itoa(os.Getpid())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Yes = true
+	err := cmd.UninstallCmd(opts)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") || !strings.Contains(err.Error(), "b1c2d3e4") {
+		t.Fatalf("err = %v, want err:user naming the running job", err)
+	}
+	// The refusal comes before anything is removed.
+	for _, p := range []string{filepath.Join(opts.BinDir, "glm"), opts.ConfigDir, jobDir} {
+		if _, err := os.Lstat(p); err != nil {
+			t.Errorf("%s removed despite the refusal", p)
+		}
+	}
+
+	opts.Force = true
+	if err := cmd.UninstallCmd(opts); err != nil {
+		t.Fatalf("UninstallCmd --force: %v", err)
+	}
+	if _, err := os.Stat(opts.SubagentsDir); err == nil {
+		t.Error("--force did not remove the subagents dir")
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// NewInvocation returns the job.Invocation of a glm process of version run
+// as args (os.Args) with cfg. prompts are the arguments that gave the
+// job's prompts; with cfg.RedactPrompts each is replaced in Args by
+// RedactedPrompt, as one argument, a --prompt=TEXT value or the words at the
+// end of the command line it was joined from.
+func NewInvocation(cfg *config.Config, version string, args, prompts []string) *job.Invocation {
+	inv := &job.Invocation{GLMVersion: version, Args: slices.Clone(args)}
+	if cfg != nil {
+		inv.ConfigSources = map[string]string{
+			"config_dir":   cfg.ConfigDir,
+			"config_file":  cfg.ConfigFile,
+			"subagent_dir": cfg.SubagentDir,
+			"api_key":      cfg.APIKeySource,
+			"opus_model":   cfg.ModelSources.Opus,
+			"sonnet_model": cfg.ModelSources.Sonnet,
+			"haiku_model":  cfg.ModelSources.Haiku,
+		}
+		if cfg.RedactPrompts {
+			inv.Args = redactPromptArgs(inv.Args, prompts)
+		}
+	}
+	inv.Hostname, _ = os.Hostname()
+	return inv
+}
+
+// RedactedPrompt returns what stands for prompt in a redacted command line:
+// its SHA-256 and length in bytes.
+func RedactedPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return fmt.Sprintf("<prompt sha256:%s len:%d>", hex.EncodeToString(sum[:]), len(prompt))
+}
+
+// redactPromptArgs returns args with every prompt of prompts replaced by
+// RedactedPrompt.
+func redactPromptArgs(args, prompts []string) []string {
+	for _, p := range prompts {
+		if p == "" {
+			continue
+		}
+		found := false
+		for i, arg := range args {
+			if arg == p {
+				args[i], found = RedactedPrompt(p), true
+			} else if flag, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(flag, "-") && value == p {
+				args[i], found = flag+"="+RedactedPrompt(p), true
+			}
+		}
+		if found {
+			continue
+		}
+		// Several words of a run or start prompt are joined into one.
+		for i := range args {
+			if strings.Join(args[i:], " ") == p {
+				args = append(args[:i], RedactedPrompt(p))
+				break
+			}
+		}
+	}
+	return args
+}
@@ -0,0 +1,52 @@
+package cmd_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/config"
+)
+
+// Scenario: NewInvocation records the version, command line, config sources and host, and with redact_prompts replaces prompts given as one argument, as --prompt=TEXT or as several trailing words
+func TestNewInvocation(t *testing.T) {
+	cfg := &config.Config{
+		ConfigDir:    "/cfg",
+		SubagentDir:  "/jobs",
+		APIKeySource: "ZAI_API_KEY",
+		ModelSources: config.ModelSources{Opus: "default", Sonnet: "-m", Haiku: "GLM_HAIKU_MODEL"},
+	}
+	args := []string{"glm", "run", "-d", "src", "fix", "the", "bug"}
+
+	inv := cmd.NewInvocation(cfg, "1.2.3", args, []string{"fix the bug"})
+	host, _ := os.Hostname()
+	if inv.GLMVersion != "1.2.3" || !slices.Equal(inv.Args, args) || inv.Hostname != host {
+		t.Errorf("invocation = %+v", inv)
+	}
+	if inv.ConfigSources["api_key"] != "ZAI_API_KEY" || inv.ConfigSources["sonnet_model"] != "-m" || inv.ConfigSources["config_dir"] != "/cfg" {
+		t.Errorf("config sources = %v", inv.ConfigSources)
+	}
+
+	cfg.RedactPrompts = true
+	for _, tc := range []struct {
+		args    []string
+		prompts []string
+		want    []string
+	}{
+		{args, []string{"fix the bug"}, []string{"glm", "run", "-d", "src", cmd.RedactedPrompt("fix the bug")}},
+		{[]string{"glm", "start", "--prompt=fix it", "-t", "60"}, []string{"fix it"}, []string{"glm", "start", "--prompt=" + cmd.RedactedPrompt("fix it"), "-t", "60"}},
+		{[]string{"glm", "chain", "plan:look", "--then", "fix"}, []string{"plan:look", "fix"}, []string{"glm", "chain", cmd.RedactedPrompt("plan:look"), "--then", cmd.RedactedPrompt("fix")}},
+	} {
+		inv := cmd.NewInvocation(cfg, "1.2.3", tc.args, tc.prompts)
+		if !slices.Equal(inv.Args, tc.want) {
+			t.Errorf("redacted %q = %q, want %q", tc.args, inv.Args, tc.want)
+		}
+	}
+	if got := cmd.RedactedPrompt("fix it"); got != "<prompt sha256:ab0d1307766ce08eadfdc7655cd528e2036bd93310e33aecf7aaa78fa5cb9429 len:6>" {
+		t.Errorf("RedactedPrompt = %q", got)
+	}
+	if !slices.Equal(args, []string{"glm", "run", "-d", "src", "fix", "the", "bug"}) {
+		t.Errorf("NewInvocation changed its args: %q", args)
+	}
+}
@@ -7,44 +7,85 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/veschin/GoLeM/internal/errs"
 	"github.com/veschin/GoLeM/internal/job"
 )
 
 // JobListItem is the JSON representation of a job in the list output.
+// ErrorSummary is only present for failed, timeout, permission_error and
+// context_exceeded jobs
+// (empty when they left no stderr). RetriedFrom and RetriedBy are only
+// present on jobs with retry links. PromptPreview is the prompt cut to one
+// line (see job.PromptPreview), and DurationSeconds is only present for
+// terminal jobs (see readJobTiming).
 type JobListItem struct {
-	ID        string `json:"id"`
-	Status    string `json:"status"`
-	StartedAt string `json:"started_at"`
-	ProjectID string `json:"project_id"`
+	ID              string  `json:"id"`
+	Status          string  `json:"status"`
+	StartedAt       string  `json:"started_at"`
+	ProjectID       string  `json:"project_id"`
+	PromptPreview   string  `json:"prompt_preview,omitempty"`
+	DurationSeconds *int    `json:"duration_seconds,omitempty"`
+	ChainID         string  `json:"chain_id,omitempty"`
+	Step            int     `json:"step,omitempty"`
+	ErrorSummary    *string `json:"error_summary,omitempty"`
+	RetriedFrom     string  `json:"retried_from,omitempty"`
+	RetriedBy       string  `json:"retried_by,omitempty"`
 }
 
 // JobStatusJSON is the JSON representation returned by "glm status --json".
+// FinishedAt and DurationSeconds are only set for terminal jobs and
+// ElapsedSeconds only for running ones.
 type JobStatusJSON struct {
-	ID        string `json:"id"`
-	Status    string `json:"status"`
-	PID       int    `json:"pid"`
-	StartedAt string `json:"started_at"`
+	ID              string `json:"id"`
+	Status          string `json:"status"`
+	PID             int    `json:"pid"`
+	StartedAt       string `json:"started_at"`
+	FinishedAt      string `json:"finished_at,omitempty"`
+	DurationSeconds *int   `json:"duration_seconds,omitempty"`
+	ElapsedSeconds  *int   `json:"elapsed_seconds,omitempty"`
+	ClaudeVersion   string `json:"claude_version,omitempty"`
+	SessionID       string `json:"session_id,omitempty"`
 }
 
 // JobResultJSON is the JSON representation returned by "glm result --json".
+// Prompt is the prompt the job ran with, as "glm prompt" prints it.
+// Changes is Changelog parsed (see ParseChangelog). Mode is "plan" for a job
+// that ran in plan permission mode, whose Plan mirrors Stdout; both are
+// empty for other jobs. DurationSeconds is only set for terminal jobs (see
+// readJobTiming).
 type JobResultJSON struct {
-	ID              string  `json:"id"`
-	Status          string  `json:"status"`
-	Stdout          string  `json:"stdout"`
-	Stderr          string  `json:"stderr"`
-	Changelog       string  `json:"changelog"`
-	DurationSeconds int     `json:"duration_seconds"`
-	ExitCode        *int    `json:"exit_code,omitempty"`
+	ID              string           `json:"id"`
+	Status          string           `json:"status"`
+	Prompt          string           `json:"prompt"`
+	Stdout          string           `json:"stdout"`
+	Stderr          string           `json:"stderr"`
+	Changelog       string           `json:"changelog"`
+	Changes         []ChangelogEntry `json:"changes"`
+	DurationSeconds *int             `json:"duration_seconds,omitempty"`
+	ExitCode        *int             `json:"exit_code,omitempty"`
+	ChainID         string           `json:"chain_id,omitempty"`
+	Step            int              `json:"step,omitempty"`
+	Git             *job.GitContext  `json:"git,omitempty"`
+	DiffStat        string           `json:"diff_stat,omitempty"`
+	ClaudeVersion   string           `json:"claude_version,omitempty"`
+	GLMVersion      string           `json:"glm_version,omitempty"`
+	SessionID       string           `json:"session_id,omitempty"`
+	Mode            string           `json:"mode,omitempty"`
+	Plan            string           `json:"plan,omitempty"`
 }
 
 // JobLogJSON is the JSON representation returned by "glm log --json".
+// Changes holds the raw changelog lines; Entries the same changes parsed
+// (see ParseChangelog).
 type JobLogJSON struct {
-	ID      string   `json:"id"`
-	Changes []string `json:"changes"`
+	ID      string           `json:"id"`
+	Changes []string         `json:"changes"`
+	Entries []ChangelogEntry `json:"entries"`
+	Git     *job.GitContext  `json:"git,omitempty"`
+	Stats   *ChangelogStats  `json:"stats,omitempty"`
 }
 
 // JSONOutput encodes v as indented JSON and writes it to w followed by a newline.
@@ -153,96 +194,131 @@ func scanAllJobs(subagentsRoot string) ([]JobEntry, error) {
 func readJobEntry(jobID, jobDir, projectID string) (JobEntry, error) {
 	status := string(job.ReadStatus(jobDir))
 
+	m := job.LoadManifest(jobDir)
+
 	var startedAt *time.Time
-	data, err := os.ReadFile(filepath.Join(jobDir, "started_at.txt"))
-	if err == nil {
-		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data))); err == nil {
+	if m.StartedAt != "" {
+		if t, err := job.ParseTimestamp(m.StartedAt); err == nil {
 			startedAt = &t
 		}
 	}
 
 	return JobEntry{
-		JobID:     jobID,
-		Status:    status,
-		StartedAt: startedAt,
-		Dir:       jobDir,
+		JobID:       jobID,
+		Status:      status,
+		StartedAt:   startedAt,
+		Dir:         jobDir,
+		ChainID:     m.ChainID,
+		ChainStep:   m.ChainStep,
+		RetriedFrom: m.RetriedFrom,
+		RetriedBy:   m.RetriedBy,
+		Prompt:      job.PromptPreview(m.Prompt),
 	}, nil
 }
 
 // ListJSON reads all jobs from subagentsRoot, applies filter, and writes a
-// JSON array of JobListItem objects to w.
-// If there are no jobs it writes "[]" (never null).
+// JSON array of JobListItem objects to w. FilterOptions Offset and Limit page
+// through the jobs as in ListCmd.
+// If there are no jobs it writes "[]" (never null). With FilterOptions
+// Lineage it writes the job's retry lineage, oldest first (see JobLineage).
 func ListJSON(subagentsRoot string, filter *FilterOptions, w io.Writer) error {
-	jobs, err := scanAllJobs(subagentsRoot)
-	if err != nil {
-		return err
+	if filter != nil && filter.Lineage != "" {
+		lineage, err := JobLineage(subagentsRoot, filter.Lineage)
+		if err != nil {
+			return err
+		}
+		return JSONOutput(w, lineageItems(lineage))
+	}
+	return JSONOutput(w, ListJobs(subagentsRoot, filter))
+}
+
+// ListJobs returns the JobListItem of every job ListJSON lists for filter
+// (nil = all), newest first or as its Sort and Reverse ask (see SortJobs).
+func ListJobs(subagentsRoot string, filter *FilterOptions) []JobListItem {
+	var jobs []JobEntry
+	if filter != nil && filter.Limit > 0 && filter.Chain == "" && !filter.sorted() {
+		jobs = scanNewestJobs(subagentsRoot, filter, readJSONCandidate)
+	} else {
+		for _, c := range listJobCandidates(subagentsRoot) {
+			if je, ok := readJSONCandidate(c); ok {
+				jobs = append(jobs, je)
+			}
+		}
+		sortNewestFirst(jobs)
+
+		// Apply filters before conversion so time filtering can fall back to
+		// the job directory mtime.
+		if filter != nil {
+			jobs = FilterJobs(jobs, filter)
+			if filter.sorted() {
+				SortJobs(jobs, filter.Sort, filter.Reverse, time.Now())
+			}
+			jobs = pageJobs(jobs, filter.Offset, filter.Limit)
+		}
 	}
 
 	// Convert to JobListItem for JSON output
 	var items []JobListItem
-	for _, job := range jobs {
-		projectID := filepath.Base(filepath.Dir(job.Dir))
+	now := time.Now()
+	for _, je := range jobs {
+		projectID := filepath.Base(filepath.Dir(je.Dir))
 		startedAtStr := ""
-		if job.StartedAt != nil {
-			startedAtStr = job.StartedAt.Format(time.RFC3339)
+		if je.StartedAt != nil {
+			startedAtStr = je.StartedAt.Format(time.RFC3339)
 		}
-		items = append(items, JobListItem{
-			ID:        job.JobID,
-			Status:    job.Status,
-			StartedAt: startedAtStr,
-			ProjectID: projectID,
-		})
-	}
-
-	// Apply filters to items
-	if filter != nil {
-		items = filterJobListItems(items, filter)
+		item := JobListItem{
+			ID:            je.JobID,
+			Status:        je.Status,
+			StartedAt:     startedAtStr,
+			ProjectID:     projectID,
+			PromptPreview: je.Prompt,
+			ChainID:       je.ChainID,
+			Step:          je.ChainStep,
+			RetriedFrom:   je.RetriedFrom,
+			RetriedBy:     je.RetriedBy,
+		}
+		if terminalStatuses[je.Status] {
+			item.DurationSeconds = readJobTiming(je.Dir, job.LoadManifest(je.Dir), je.Status, now).DurationSeconds
+		}
+		if isFailureStatus(je.Status) {
+			summary := errorSummary(je.Dir)
+			item.ErrorSummary = &summary
+		}
+		items = append(items, item)
 	}
-
-	return JSONOutput(w, items)
+	return items
 }
 
-// filterJobListItems applies filters to JobListItem slices.
-func filterJobListItems(items []JobListItem, filter *FilterOptions) []JobListItem {
-	var result []JobListItem
-	for _, item := range items {
-		// Status filter
-		if len(filter.Statuses) > 0 {
-			statusMatch := false
-			for _, s := range filter.Statuses {
-				if item.Status == s {
-					statusMatch = true
-					break
-				}
-			}
-			if !statusMatch {
-				continue
-			}
-		}
-		// Project prefix filter
-		if filter.ProjectPrefix != "" {
-			if !strings.HasPrefix(item.ProjectID, filter.ProjectPrefix) {
-				continue
-			}
+// readJSONCandidate reads c for ListJSON. Unlike ListCmd it skips corrupted
+// directories and leaves running jobs unreconciled.
+func readJSONCandidate(c jobCandidate) (JobEntry, bool) {
+	if c.Corrupt {
+		return JobEntry{}, false
+	}
+	if c.Indexed != nil {
+		if c.Indexed.Status == "" {
+			return JobEntry{}, false
 		}
-		// Since filter
-		if !filter.Since.IsZero() {
-			if item.StartedAt == "" {
-				continue
-			}
-			t, err := time.Parse(time.RFC3339, item.StartedAt)
-			if err != nil || t.Before(filter.Since) {
-				continue
-			}
+		je := indexedJobEntry(c)
+		if !validStatusMap[je.Status] {
+			je.Status = string(job.StatusFailed)
 		}
-		result = append(result, item)
+		return je, true
 	}
-	return result
+	if _, err := os.Stat(filepath.Join(c.Dir, "status")); err != nil {
+		return JobEntry{}, false
+	}
+	je, err := readJobEntry(c.ID, c.Dir, filepath.Base(filepath.Dir(c.Dir)))
+	return je, err == nil
 }
 
 // StatusJSON reads a single job's status and writes a JSON object to w.
 // It reconciles stale running jobs before responding.
 func StatusJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return err
+	}
 	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
 	if err != nil {
 		return err
@@ -259,34 +335,82 @@ func StatusJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer) erro
 		status, _ = job.CheckJobPID(jobDir)
 	}
 
-	var startedAt string
-	data, err := os.ReadFile(filepath.Join(jobDir, "started_at.txt"))
-	if err == nil {
-		startedAt = strings.TrimSpace(string(data))
+	return JSONOutput(w, jobStatusJSON(jobID, jobDir, status))
+}
+
+// jobStatusJSON builds the JobStatusJSON of the job in jobDir, whose status
+// has already been read (and reconciled, where the caller does that).
+func jobStatusJSON(jobID, jobDir, status string) JobStatusJSON {
+	// Always report the PID if one was recorded, regardless of current status
+	m := job.LoadManifest(jobDir)
+
+	t := readJobTiming(jobDir, m, status, time.Now())
+
+	return JobStatusJSON{
+		ID:              jobID,
+		Status:          status,
+		PID:             m.PID,
+		StartedAt:       m.StartedAt,
+		FinishedAt:      t.FinishedAt,
+		DurationSeconds: t.DurationSeconds,
+		ElapsedSeconds:  t.ElapsedSeconds,
+		ClaudeVersion:   m.ClaudeVersion,
+		SessionID:       m.SessionID,
 	}
+}
 
-	// Always read PID if the file exists, regardless of current status
-	pid := 0
-	pidData, err := os.ReadFile(filepath.Join(jobDir, "pid.txt"))
-	if err == nil {
-		pid, _ = strconv.Atoi(strings.TrimSpace(string(pidData)))
+// JobStatus returns the JobStatusJSON of jobID, reconciling a running job
+// whose process has died to "failed" first, as StatusCmd does.
+func JobStatus(subagentsRoot, currentProjectID, jobID string) (JobStatusJSON, error) {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return JobStatusJSON{}, err
 	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return JobStatusJSON{}, errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+	status, _ := job.CheckJobPID(jobDir)
+	return jobStatusJSON(jobID, jobDir, status), nil
+}
 
-	result := JobStatusJSON{
-		ID:        jobID,
-		Status:    status,
-		PID:       pid,
-		StartedAt: startedAt,
+// StatusAllJSON writes a JSON array with the JobStatusJSON of every queued or
+// running job in currentProjectID, like StatusAllCmd. It writes "[]" when no
+// job is active.
+func StatusAllJSON(subagentsRoot, currentProjectID string, w io.Writer) error {
+	return JSONOutput(w, ActiveJobStatuses(subagentsRoot, currentProjectID))
+}
+
+// ActiveJobStatuses returns the JobStatusJSON of every queued or running job
+// in currentProjectID, as StatusAllJSON lists them.
+func ActiveJobStatuses(subagentsRoot, currentProjectID string) []JobStatusJSON {
+	items := []JobStatusJSON{}
+	for _, a := range activeJobs(subagentsRoot, currentProjectID) {
+		items = append(items, jobStatusJSON(a.ID, a.Dir, a.Status))
 	}
-	return JSONOutput(w, result)
+	return items
 }
 
 // ResultJSON reads a job's stdout/stderr/changelog and writes a JSON object to w.
 func ResultJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
-	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	result, err := JobResult(subagentsRoot, currentProjectID, jobID)
 	if err != nil {
 		return err
 	}
+	return JSONOutput(w, result)
+}
+
+// JobResult returns the JobResultJSON of jobID, whatever its status. Unlike
+// ResultCmd it leaves the job directory in place.
+func JobResult(subagentsRoot, currentProjectID, jobID string) (JobResultJSON, error) {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return JobResultJSON{}, err
+	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return JobResultJSON{}, err
+	}
 
 	status := string(job.ReadStatus(jobDir))
 
@@ -294,32 +418,49 @@ func ResultJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer) erro
 	stderr, _ := os.ReadFile(filepath.Join(jobDir, "stderr.txt"))
 	changelog, _ := os.ReadFile(filepath.Join(jobDir, "changelog.txt"))
 
-	durationSeconds := 0
-	if data, err := os.ReadFile(filepath.Join(jobDir, "duration_seconds.txt")); err == nil {
-		durationSeconds, _ = strconv.Atoi(strings.TrimSpace(string(data)))
-	}
+	diffStat, _ := os.ReadFile(filepath.Join(jobDir, "diff_stat.txt"))
 
-	var exitCode *int
-	if data, err := os.ReadFile(filepath.Join(jobDir, "exit_code.txt")); err == nil {
-		if ec, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
-			exitCode = &ec
-		}
-	}
+	m := job.LoadManifest(jobDir)
+	timing := readJobTiming(jobDir, m, status, time.Now())
 
 	result := JobResultJSON{
 		ID:              jobID,
 		Status:          status,
+		Prompt:          readPrompt(jobDir, m),
 		Stdout:          string(stdout),
 		Stderr:          string(stderr),
 		Changelog:       string(changelog),
-		DurationSeconds: durationSeconds,
-		ExitCode:        exitCode,
+		Changes:         ParseChangelog(string(changelog)),
+		DurationSeconds: timing.DurationSeconds,
+		ExitCode:        m.ExitCode,
+		ChainID:         m.ChainID,
+		Step:            m.ChainStep,
+		Git:             m.Git,
+		DiffStat:        string(diffStat),
+		ClaudeVersion:   m.ClaudeVersion,
+		SessionID:       m.SessionID,
 	}
-	return JSONOutput(w, result)
+	if m.Invocation != nil {
+		result.GLMVersion = m.Invocation.GLMVersion
+	}
+	if m.PermissionMode == "plan" {
+		result.Mode, result.Plan = "plan", result.Stdout
+	}
+	return result, nil
 }
 
-// LogJSON reads a job's changelog and writes a JSON object with a "changes" array to w.
-func LogJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
+// LogJSON reads a job's changelog and writes a JSON object with a "changes"
+// array of its lines and an "entries" array of them parsed to w. With
+// LogOptions.Stat the object also has the changelog's "stats".
+func LogJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer, opts ...*LogOptions) error {
+	o := &LogOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return err
+	}
 	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
 	if err != nil {
 		return err
@@ -340,6 +481,11 @@ func LogJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
 	result := JobLogJSON{
 		ID:      jobID,
 		Changes: changes,
+		Entries: ParseChangelog(content),
+		Git:     job.LoadManifest(jobDir).Git,
+	}
+	if o.Stat {
+		result.Stats = ParseChangelogStats(content)
 	}
 	return JSONOutput(w, result)
 }
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/job"
 )
 
 // =============================================================================
@@ -236,10 +239,172 @@ func TestStatusJsonOutputsJobStatusObject(t *testing.T) {
 	}
 }
 
+// Scenario: status --json reads a job that only has a job.json manifest
+func TestStatusJsonReadsManifestOnlyJob(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-142801-f6a7b8c9"
+	dir := filepath.Join(root, "proj", jobID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.WriteManifest(dir, &job.Manifest{
+		ID:        jobID,
+		ProjectID: "proj",
+		Status:    job.StatusDone,
+		PID:       48202,
+		StartedAt: "2026-02-27T14:28:01+03:00",
+	}); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := StatusJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("StatusJSON: %v", err)
+	}
+
+	var obj JobStatusJSON
+	mustDecodeObject(t, buf.String(), &obj)
+
+	if obj.Status != "done" || obj.PID != 48202 || obj.StartedAt != "2026-02-27T14:28:01+03:00" {
+		t.Errorf("status json = %+v", obj)
+	}
+}
+
+// Scenario: status --json reports finished_at and duration for a done job
+func TestStatusJsonDoneJobHasDuration(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-142802-a7b8c9d0"
+	dir := makeJobDir(t, root, "proj", jobID, "done")
+	writeFile(t, dir, "started_at.txt", "2026-02-27T14:28:00Z")
+	writeFile(t, dir, "finished_at.txt", "2026-02-27T14:30:05Z")
+
+	var buf bytes.Buffer
+	if err := StatusJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("StatusJSON: %v", err)
+	}
+
+	var obj JobStatusJSON
+	mustDecodeObject(t, buf.String(), &obj)
+
+	if obj.FinishedAt != "2026-02-27T14:30:05Z" {
+		t.Errorf("finished_at: got %q", obj.FinishedAt)
+	}
+	if obj.DurationSeconds == nil || *obj.DurationSeconds != 125 {
+		t.Errorf("duration_seconds: got %v, want 125", obj.DurationSeconds)
+	}
+	if obj.ElapsedSeconds != nil {
+		t.Errorf("elapsed_seconds should be omitted for a done job, got %d", *obj.ElapsedSeconds)
+	}
+
+	// duration_seconds.txt, when present, wins over the timestamps.
+	writeFile(t, dir, "duration_seconds.txt", "120")
+	buf.Reset()
+	if err := StatusJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("StatusJSON: %v", err)
+	}
+	obj = JobStatusJSON{}
+	mustDecodeObject(t, buf.String(), &obj)
+	if obj.DurationSeconds == nil || *obj.DurationSeconds != 120 {
+		t.Errorf("duration_seconds: got %v, want 120 from duration_seconds.txt", obj.DurationSeconds)
+	}
+}
+
+// Scenario: status --json reports elapsed_seconds for a running job
+func TestStatusJsonRunningJobHasElapsed(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-142803-b8c9d0e1"
+	dir := makeJobDir(t, root, "proj", jobID, "running")
+	writeFile(t, dir, "pid.txt", strconv.Itoa(os.Getpid()))
+	writeFile(t, dir, "started_at.txt", time.Now().Add(-90*time.Second).UTC().Format(time.RFC3339))
+
+	var buf bytes.Buffer
+	if err := StatusJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("StatusJSON: %v", err)
+	}
+
+	var obj map[string]any
+	mustDecodeObject(t, buf.String(), &obj)
+
+	elapsed, ok := obj["elapsed_seconds"].(float64)
+	if !ok || elapsed < 89 || elapsed > 120 {
+		t.Errorf("elapsed_seconds: got %v, want about 90", obj["elapsed_seconds"])
+	}
+	for _, key := range []string{"finished_at", "duration_seconds"} {
+		if _, present := obj[key]; present {
+			t.Errorf("%s should be omitted for a running job, got %v", key, obj[key])
+		}
+	}
+}
+
+// Scenario: status --json omits timing fields when the timestamp files are missing
+func TestStatusJsonMissingTimestampsOmitsTiming(t *testing.T) {
+	root := t.TempDir()
+	for status, jobID := range map[string]string{
+		"done":    "job-20260227-142804-c9d0e1f2",
+		"running": "job-20260227-142805-d0e1f2a3",
+	} {
+		makeJobDir(t, root, "proj", jobID, status)
+
+		var buf bytes.Buffer
+		if err := StatusJSON(root, "proj", jobID, &buf); err != nil {
+			t.Fatalf("StatusJSON(%s): %v", status, err)
+		}
+
+		var obj map[string]any
+		mustDecodeObject(t, buf.String(), &obj)
+		for _, key := range []string{"finished_at", "duration_seconds", "elapsed_seconds"} {
+			if _, present := obj[key]; present {
+				t.Errorf("%s job: %s should be omitted, got %v", status, key, obj[key])
+			}
+		}
+	}
+}
+
 // =============================================================================
 // AC4: result --json outputs JSON object with full job result
 // =============================================================================
 
+// Scenario: result --json takes duration_seconds from duration_seconds.txt, else from the timestamps under either file name, and omits it when neither is there or the job has not finished
+func TestResultJsonDuration(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		name   string
+		status string
+		files  map[string]string
+		want   int // -1: omitted
+	}{
+		{"only timestamps", "done", map[string]string{"started_at.txt": "2026-02-27T14:28:00Z", "finished_at.txt": "2026-02-27T14:30:05Z"}, 125},
+		{"legacy timestamp names", "failed", map[string]string{"started_at": "2026-02-27T14:28:00Z", "finished_at": "2026-02-27T14:29:00Z"}, 60},
+		{"only the file", "done", map[string]string{"duration_seconds.txt": "42"}, 42},
+		{"file wins over timestamps", "done", map[string]string{"started_at.txt": "2026-02-27T14:28:00Z", "finished_at.txt": "2026-02-27T14:30:05Z", "duration_seconds.txt": "120"}, 120},
+		{"neither", "done", nil, -1},
+		{"running job", "running", map[string]string{"started_at.txt": "2026-02-27T14:28:00Z", "duration_seconds.txt": "5"}, -1},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobID := "job-20260227-14281" + strconv.Itoa(i) + "-e1f2a3b4"
+			dir := makeJobDir(t, root, "proj", jobID, tt.status)
+			for name, content := range tt.files {
+				writeFile(t, dir, name, content)
+			}
+
+			var buf bytes.Buffer
+			if err := ResultJSON(root, "proj", jobID, &buf); err != nil {
+				t.Fatalf("ResultJSON: %v", err)
+			}
+			var obj map[string]any
+			mustDecodeObject(t, buf.String(), &obj)
+			got, present := obj["duration_seconds"]
+			switch {
+			case tt.want < 0 && present:
+				t.Errorf("duration_seconds = %v, want it omitted", got)
+			case tt.want >= 0 && got != float64(tt.want):
+				t.Errorf("duration_seconds = %v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 // Scenario: result --json for a completed job
 func TestResultJsonForCompletedJob(t *testing.T) {
 	root := t.TempDir()
@@ -281,8 +446,8 @@ func TestResultJsonForCompletedJob(t *testing.T) {
 	if obj.Changelog != changelog {
 		t.Errorf("changelog: got %q, want %q", obj.Changelog, changelog)
 	}
-	if obj.DurationSeconds != 332 {
-		t.Errorf("duration_seconds: got %d, want 332", obj.DurationSeconds)
+	if obj.DurationSeconds == nil || *obj.DurationSeconds != 332 {
+		t.Errorf("duration_seconds: got %v, want 332", obj.DurationSeconds)
 	}
 }
 
@@ -290,6 +455,38 @@ func TestResultJsonForCompletedJob(t *testing.T) {
 // AC5: log --json outputs JSON object with changes array
 // =============================================================================
 
+// Scenario: log --json --stat adds the aggregated stats object
+func TestLogJsonStatAddsStats(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-143205-a8f3b1c2"
+	dir := makeJobDir(t, root, "proj", jobID, "done")
+	writeFile(t, dir, "changelog.txt", "EDIT a.go: 10 chars\nEDIT a.go: 5 chars\nDELETE via bash: rm b.go\nFS: touch c.go")
+
+	var buf bytes.Buffer
+	if err := LogJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("LogJSON: %v", err)
+	}
+	if strings.Contains(buf.String(), `"stats"`) {
+		t.Errorf("stats present without --stat:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := LogJSON(root, "proj", jobID, &buf, &LogOptions{Stat: true}); err != nil {
+		t.Fatalf("LogJSON: %v", err)
+	}
+	var obj struct {
+		Stats map[string]any `json:"stats"`
+	}
+	mustDecodeObject(t, buf.String(), &obj)
+	files, _ := obj.Stats["files"].([]any)
+	if obj.Stats["edits"] != 2.0 || obj.Stats["writes"] != 0.0 || obj.Stats["deletes"] != 1.0 || obj.Stats["fs_ops"] != 1.0 || len(files) != 1 {
+		t.Fatalf("stats = %v", obj.Stats)
+	}
+	if f := files[0].(map[string]any); f["path"] != "a.go" || f["edits"] != 2.0 || f["chars"] != 15.0 {
+		t.Errorf("files[0] = %v", f)
+	}
+}
+
 // Scenario: log --json outputs changelog as structured array
 func TestLogJsonOutputsChangelogAsStructuredArray(t *testing.T) {
 	root := t.TempDir()
@@ -326,6 +523,118 @@ func TestLogJsonOutputsChangelogAsStructuredArray(t *testing.T) {
 	}
 }
 
+// Scenario: ParseChangelog turns every changelog line format into an entry
+func TestParseChangelog(t *testing.T) {
+	truncated := "FS: go generate ./internal/... ./pkg/... -run=very-long-generator-name-cut-at-80-byt"
+	tests := []struct {
+		name      string
+		changelog string
+		want      string
+	}{
+		{name: "edit", changelog: "EDIT src/a.go: 142 chars", want: `[{"op":"edit","path":"src/a.go","chars":142}]`},
+		{name: "edit removing text", changelog: "EDIT a.go: 0 chars", want: `[{"op":"edit","path":"a.go","chars":0}]`},
+		{name: "edit path with colon", changelog: "EDIT docs/a: b.md: 7 chars", want: `[{"op":"edit","path":"docs/a: b.md","chars":7}]`},
+		{name: "write", changelog: "WRITE src/a_test.go", want: `[{"op":"write","path":"src/a_test.go"}]`},
+		{name: "delete", changelog: "DELETE via bash: rm -rf build", want: `[{"op":"delete","command":"rm -rf build"}]`},
+		{name: "fs", changelog: "FS: mkdir -p src/x", want: `[{"op":"fs","command":"mkdir -p src/x"}]`},
+		{name: "notebook", changelog: "NOTEBOOK nb/a.ipynb", want: `[{"op":"notebook","path":"nb/a.ipynb"}]`},
+		{name: "truncated bash command", changelog: truncated, want: `[{"op":"fs","command":"` + strings.TrimPrefix(truncated, "FS: ") + `"}]`},
+		{name: "no file changes", changelog: "(no file changes)", want: `[]`},
+		{name: "plan job", changelog: "PLAN (plan only, no changes applied)", want: `[]`},
+		{name: "empty", changelog: "", want: `[]`},
+		{name: "edit without chars", changelog: "EDIT a.go", want: `[{"op":"unknown","raw":"EDIT a.go"}]`},
+		{name: "edit with bad count", changelog: "EDIT a.go: many chars", want: `[{"op":"unknown","raw":"EDIT a.go: many chars"}]`},
+		{name: "unknown format", changelog: "RENAME a b", want: `[{"op":"unknown","raw":"RENAME a b"}]`},
+		{
+			name:      "mixed with blank lines and padding",
+			changelog: "EDIT a.go: 3 chars\n\n  WRITE b.go  \nsomething odd\r\nFS: touch c",
+			want:      `[{"op":"edit","path":"a.go","chars":3},{"op":"write","path":"b.go"},{"op":"unknown","raw":"something odd"},{"op":"fs","command":"touch c"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(ParseChangelog(tt.changelog))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ParseChangelog(%q) = %s, want %s", tt.changelog, got, tt.want)
+			}
+		})
+	}
+}
+
+// Scenario: log --json keeps the raw changes and adds parsed entries; result --json embeds them as changes
+func TestLogAndResultJsonChangelogEntries(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-143205-a8f3b1c2"
+	dir := makeJobDir(t, root, "proj", jobID, "done")
+	writeFile(t, dir, "changelog.txt", "EDIT a.go: 10 chars\nDELETE via bash: rm b.go")
+
+	var buf bytes.Buffer
+	if err := LogJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("LogJSON: %v", err)
+	}
+	var lg JobLogJSON
+	mustDecodeObject(t, buf.String(), &lg)
+	if len(lg.Changes) != 2 || len(lg.Entries) != 2 || lg.Entries[0].Path != "a.go" || *lg.Entries[0].Chars != 10 || lg.Entries[1].Command != "rm b.go" {
+		t.Errorf("log --json = %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := ResultJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("ResultJSON: %v", err)
+	}
+	var res JobResultJSON
+	mustDecodeObject(t, buf.String(), &res)
+	if len(res.Changes) != 2 || res.Changes[1].Op != ChangelogDelete {
+		t.Errorf("result --json changes = %+v", res.Changes)
+	}
+
+	writeFile(t, dir, "changelog.txt", "(no file changes)")
+	buf.Reset()
+	if err := LogJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("LogJSON: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"entries": []`) {
+		t.Errorf("log --json without changes = %s, want empty entries", buf.String())
+	}
+}
+
+// Scenario: result --json and log --json include the git state the job started from
+func TestResultAndLogJsonIncludeGitContext(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-143205-a8f3b1c2"
+	dir := makeJobDir(t, root, "proj", jobID, "done")
+	gc := &job.GitContext{Head: "880a950", Branch: "main", Dirty: true}
+	if err := job.UpdateManifest(dir, func(m *job.Manifest) { m.Git = gc }); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ResultJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("ResultJSON: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"git": {`) {
+		t.Errorf("result --json has no git object:\n%s", buf.String())
+	}
+	var res JobResultJSON
+	mustDecodeObject(t, buf.String(), &res)
+	if res.Git == nil || *res.Git != *gc {
+		t.Errorf("result git: got %+v, want %+v", res.Git, gc)
+	}
+
+	buf.Reset()
+	if err := LogJSON(root, "proj", jobID, &buf); err != nil {
+		t.Fatalf("LogJSON: %v", err)
+	}
+	var lg JobLogJSON
+	mustDecodeObject(t, buf.String(), &lg)
+	if lg.Git == nil || *lg.Git != *gc {
+		t.Errorf("log git: got %+v, want %+v", lg.Git, gc)
+	}
+}
+
 // =============================================================================
 // AC6: JSON output to stdout, errors to stderr in text format
 // =============================================================================
@@ -333,12 +642,12 @@ func TestLogJsonOutputsChangelogAsStructuredArray(t *testing.T) {
 // Scenario: Errors go to stderr in text format even with --json
 func TestErrorsGoToStderrInTextFormatEvenWithJson(t *testing.T) {
 	root := t.TempDir()
-	// job-nonexistent does not exist.
+	// A well-formed job ID that does not exist.
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
 	// StatusJSON should return an error for a non-existent job.
-	err := StatusJSON(root, "proj", "job-nonexistent", &stdout)
+	err := StatusJSON(root, "proj", "job-20260227-999999-deadbeef", &stdout)
 	if err == nil {
 		t.Fatal("expected error for non-existent job, got nil")
 	}
@@ -410,6 +719,68 @@ func TestListJsonWithNoJobsOutputsEmptyArray(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// error_summary in list --json
+// =============================================================================
+
+// Scenario: Failed, timeout and permission_error jobs carry the last stderr line
+func TestListJsonErrorSummaryForFailureStatuses(t *testing.T) {
+	root := t.TempDir()
+	long := strings.Repeat("x", 200) + " the end"
+
+	jobs := []struct {
+		id, status, stderr string
+		want               *string
+	}{
+		{"job-20260227-100001-f0000001", "failed",
+			"warming up\n[GoLeM] Process died unexpectedly (PID 4242)\n__stale_recovered__\n",
+			ptr("Process died unexpectedly (PID 4242)")},
+		{"job-20260227-100002-f0000002", "timeout",
+			"\x1b[31mError:\x1b[0m request timed out after 600s\n\n", ptr("Error: request timed out after 600s")},
+		{"job-20260227-100003-f0000003", "permission_error",
+			"tool denied\n" + long, ptr("..." + long[len(long)-117:])},
+		{"job-20260227-100004-f0000004", "failed", "", ptr("")},
+		{"job-20260227-100005-d0000005", "done", "some harmless warning\n", nil},
+		{"job-20260227-100006-f0000006", "failed",
+			"Error: boom\n2026-02-27T10:00:06Z [GoLeM] Failed to launch queued job: no such file\n",
+			ptr("Failed to launch queued job: no such file")},
+	}
+	for _, j := range jobs {
+		dir := makeJobDir(t, root, "proj", j.id, j.status)
+		if j.stderr != "" {
+			writeFile(t, dir, "stderr.txt", j.stderr)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ListJSON(root, &FilterOptions{}, &buf); err != nil {
+		t.Fatalf("ListJSON: %v", err)
+	}
+	var items []JobListItem
+	mustDecodeObject(t, buf.String(), &items)
+	byID := map[string]JobListItem{}
+	for _, it := range items {
+		byID[it.ID] = it
+	}
+
+	for _, j := range jobs {
+		got := byID[j.id].ErrorSummary
+		switch {
+		case j.want == nil && got != nil:
+			t.Errorf("%s (%s): error_summary = %q, want absent", j.id, j.status, *got)
+		case j.want != nil && got == nil:
+			t.Errorf("%s (%s): error_summary absent, want %q", j.id, j.status, *j.want)
+		case j.want != nil && *got != *j.want:
+			t.Errorf("%s (%s): error_summary = %q, want %q", j.id, j.status, *got, *j.want)
+		}
+	}
+	if strings.Count(buf.String(), `"error_summary"`) != 5 {
+		t.Errorf("expected error_summary on exactly the 5 failed jobs:\n%s", buf.String())
+	}
+}
+
+func ptr(s string) *string { return &s }
+
 // =============================================================================
 // Edge Cases
 // =============================================================================
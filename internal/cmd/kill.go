@@ -1,30 +1,59 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"syscall"
+	"time"
 
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
 	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
 )
 
+// KillPollInterval is how often KillCmd checks whether a job's process has
+// exited during its grace period; sleepFn sleeps this long.
+const KillPollInterval = 100 * time.Millisecond
+
+// KillOptions holds optional KillCmd settings.
+type KillOptions struct {
+	// Grace is how long the process gets to exit after SIGTERM before it is
+	// sent SIGKILL (--grace, kill_grace_seconds). Zero sends SIGKILL right
+	// away to a process that is still alive. Without KillOptions it is
+	// config.DefaultKillGrace seconds.
+	Grace time.Duration
+	// IsAlive reports whether the process is still running (default
+	// slot.IsProcessAlive).
+	IsAlive func(pid int) bool
+}
+
 // KillCmd terminates the running job identified by jobID.
 //
 // Protocol:
-//  1. Find the job directory (returns err:not_found / exit 3 if missing).
-//  2. Read the current status; if not "running" return err:user "Job is not
-//     running" (exit 1).
+//  1. Resolve jobID (err:user / exit 1 if malformed or ambiguous) and find the
+//     job directory (returns err:not_found / exit 3 if missing).
+//  2. Read the current status. A "queued" job has no process yet and is
+//     marked "killed" right away; any other status than "running" returns
+//     err:user "Job is not running" (exit 1).
 //  3. Read pid.txt to get the PID.
-//  4. Send SIGTERM to the process group (-pid).
-//  5. Wait 1 second.
-//  6. If the process is still alive send SIGKILL to the process group.
-//  7. Write "killed" to the status file.
+//  4. Send SIGTERM to the process group (-pid), and to claude's own process
+//     group (the manifest's claude_pid) while claude is alive.
+//  5. Poll the process and claude every KillPollInterval until both have
+//     exited or the grace period (KillOptions.Grace) is over.
+//  6. Send SIGKILL to whichever of the two groups is still alive.
+//  7. Note in stderr.txt which signal ended the job, and parse a raw.json
+//     the job did not get to parse itself, so its partial output and
+//     changelog are kept (see claude.ParseRawJSON).
+//  8. Write "killed" to the status file and, if this call moved the job out
+//     of "running", release its slot (job.ReleaseJobSlot). A job killed twice,
+//     or one that finished meanwhile, is not released again.
 //
 // signalFn is injected for testing (production: os.Signal via syscall).
-// sleepFn is injected for testing (production: time.Sleep(time.Second)).
+// sleepFn is injected for testing (production: time.Sleep(KillPollInterval)).
 //
 // If the process has already died before SIGTERM/SIGKILL the function still
 // updates the status to "killed" and returns nil.
@@ -32,52 +61,138 @@ func KillCmd(
 	subagentsRoot, currentProjectID, jobID string,
 	signalFn func(pid int, sig os.Signal) error,
 	sleepFn func(),
+	opts ...*KillOptions,
 ) error {
+	o := &KillOptions{Grace: config.DefaultKillGrace * time.Second}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	isAlive := o.IsAlive
+	if isAlive == nil {
+		isAlive = slot.IsProcessAlive
+	}
+
 	// 1. Find the job directory.
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return err
+	}
 	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
 	if err != nil {
-		return fmt.Errorf("err:not_found")
+		return errs.NotFound(`"Job not found: %s"`, jobID)
 	}
 
-	// 2. Check status.
-	statusData, err := os.ReadFile(filepath.Join(jobDir, "status"))
-	if err != nil {
-		return fmt.Errorf("err:not_found")
+	// 2. Check status (manifest first, legacy status file as fallback).
+	m := job.LoadManifest(jobDir)
+	if m.Status == "" {
+		return errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+	if m.Status == job.StatusQueued {
+		killed, err := killQueued(subagentsRoot, jobDir)
+		if err != nil || killed {
+			return err
+		}
+		// Promoted while we looked; kill it as a running job.
+		m = job.LoadManifest(jobDir)
 	}
-	status := strings.TrimSpace(string(statusData))
-	if status != "running" {
-		return fmt.Errorf("err:user Job is not running (status: %s)", status)
+	if m.Status != job.StatusRunning {
+		return errs.User("Job is not running (status: %s)", m.Status)
 	}
 
-	// 3. Read pid.txt.
-	pidData, err := os.ReadFile(filepath.Join(jobDir, "pid.txt"))
-	if err != nil {
-		// No PID file; still mark as killed.
-		return writeKilledStatus(jobDir)
+	// 3. Read the PID.
+	pid := m.PID
+	if pid <= 0 {
+		// No usable PID; still mark as killed.
+		return killRunning(jobDir)
 	}
-	pid, err := strconv.Atoi(strings.TrimSpace(string(pidData)))
-	if err != nil {
-		return writeKilledStatus(jobDir)
+
+	// 4. Send SIGTERM to the process group (-pid). claude runs in a group of
+	// its own, which a worker dying on SIGKILL would leave running, so it is
+	// signalled directly too.
+	claudePID := m.ClaudePID
+	if claudePID == pid || (claudePID > 0 && !isAlive(claudePID)) {
+		claudePID = 0
 	}
+	alive := func() bool { return isAlive(pid) || claudePID > 0 && isAlive(claudePID) }
+	if claudePID > 0 {
+		_ = signalFn(-claudePID, syscall.SIGTERM)
+	}
+	if err := signalFn(-pid, syscall.SIGTERM); err != nil && claudePID == 0 {
+		// The process was already dead — nothing to wait for.
+		_ = job.AppendStderr(jobDir, "Killed: the process had already exited")
+	} else {
+		// 5. Give both groups the grace period to exit.
+		for waited := time.Duration(0); waited < o.Grace && alive(); waited += KillPollInterval {
+			sleepFn()
+		}
 
-	// 4. Send SIGTERM to the process group (-pid).
-	termErr := signalFn(-pid, syscall.SIGTERM)
+		// 6. SIGKILL whichever is still alive.
+		if alive() {
+			if isAlive(pid) {
+				_ = signalFn(-pid, syscall.SIGKILL)
+			}
+			if claudePID > 0 && isAlive(claudePID) {
+				_ = signalFn(-claudePID, syscall.SIGKILL)
+			}
+			_ = job.AppendStderr(jobDir, fmt.Sprintf("Killed: SIGKILL after %s without exiting on SIGTERM", o.Grace))
+		} else {
+			_ = job.AppendStderr(jobDir, "Killed: exited on SIGTERM")
+		}
+	}
 
-	// 5. Sleep.
-	sleepFn()
+	// 7. Keep what the job wrote before it died.
+	salvageRawJSON(jobDir)
 
-	// 6. If process still alive, send SIGKILL.
-	if termErr == nil {
-		// SIGTERM succeeded (process was alive); check if still alive.
-		_ = signalFn(-pid, syscall.SIGKILL)
+	// 8. Write "killed" status.
+	return killRunning(jobDir)
+}
+
+// salvageRawJSON parses the raw.json of a killed job that has no changelog
+// yet, so the output and file changes it recorded before it died are kept.
+// A job that settled on its own already has them and is left alone.
+func salvageRawJSON(jobDir string) {
+	if _, err := os.Stat(filepath.Join(jobDir, "raw.json")); err != nil {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(jobDir, "changelog.txt")); err == nil {
+		return
 	}
-	// If termErr != nil, process was already dead — skip SIGKILL.
+	_ = claude.ParseRawJSON(jobDir)
+}
 
-	// 7. Write "killed" status.
-	return writeKilledStatus(jobDir)
+// killRunning moves a running job to "killed" and releases its slot. If the
+// job reached another status while it was being killed, that status is kept
+// and the slot is not released here.
+func killRunning(jobDir string) error {
+	left, err := job.LeaveRunning(jobDir, job.StatusKilled)
+	if err != nil || !left {
+		return err
+	}
+	return job.ReleaseJobSlot(jobDir)
 }
 
-// writeKilledStatus atomically writes "killed" to the status file.
+// writeKilledStatus transitions the job to "killed". If the job reached a
+// terminal status while it was being killed, the rejected transition is
+// benign and that status is kept.
 func writeKilledStatus(jobDir string) error {
-	return job.AtomicWrite(filepath.Join(jobDir, "status"), []byte("killed"))
+	err := job.TransitionStatus(jobDir, job.StatusKilled)
+	if errors.Is(err, job.ErrInvalidTransition) {
+		return nil
+	}
+	return err
+}
+
+// killQueued marks a queued job "killed" under the queue lock, so a dispatcher
+// cannot promote it at the same time. Returns false if the job is no longer
+// queued.
+func killQueued(subagentsRoot, jobDir string) (bool, error) {
+	killed := false
+	err := slot.WithFileLock(filepath.Join(subagentsRoot, QueueLockFile), func() error {
+		if job.ReadStatus(jobDir) != job.StatusQueued {
+			return nil
+		}
+		killed = true
+		return writeKilledStatus(jobDir)
+	})
+	return killed, err
 }
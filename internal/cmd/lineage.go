@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// lineageDeleted is the STATUS shown for a job of a retry lineage whose
+// directory no longer exists; ListJSON reports it as "deleted".
+const lineageDeleted = "(deleted)"
+
+// LineageEntry is one job of a retry lineage (see JobLineage).
+type LineageEntry struct {
+	JobEntry
+	// Deleted is set for a job a link names whose directory is gone; only
+	// JobID and the link to its neighbour are known then.
+	Deleted bool
+	// Note explains why a link of this job was not followed: it leads back
+	// into the lineage (a cycle) or does not hold a job ID.
+	Note string
+}
+
+// JobLineage returns the retry lineage of jobID (a job ID or fragment, see
+// job.ResolveJobID), oldest first: the original job, then each retry. It
+// follows retried_from links back and retried_by links forward from jobID
+// (see job.LinkRetry). A linked job that has been cleaned is listed as
+// deleted and ends the walk in that direction; a link that cycles back into
+// the lineage or holds no job ID is not followed and noted on its job.
+// Running jobs whose process has died are reconciled as in ListCmd.
+//
+// It returns err:not_found when jobID itself does not exist.
+func JobLineage(subagentsRoot, jobID string) ([]LineageEntry, error) {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := job.FindJobDir(subagentsRoot, "", jobID)
+	if err != nil {
+		return nil, errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+
+	seen := map[string]bool{jobID: true}
+	lineage := []LineageEntry{readLineageEntry(jobID, dir)}
+	for first := &lineage[0]; first.RetriedFrom != ""; first = &lineage[0] {
+		prev, ok := followRetryLink(subagentsRoot, first, true, seen)
+		if !ok {
+			break
+		}
+		lineage = append([]LineageEntry{prev}, lineage...)
+	}
+	for last := &lineage[len(lineage)-1]; last.RetriedBy != ""; last = &lineage[len(lineage)-1] {
+		next, ok := followRetryLink(subagentsRoot, last, false, seen)
+		if !ok {
+			break
+		}
+		lineage = append(lineage, next)
+	}
+	return lineage, nil
+}
+
+// followRetryLink returns the job e's retried_from link (back) or retried_by
+// link names. It reports false, noting why on e, for a link to a job already
+// in seen or to something that is not a job ID.
+func followRetryLink(subagentsRoot string, e *LineageEntry, back bool, seen map[string]bool) (LineageEntry, bool) {
+	link, id := job.RetriedByFile, e.RetriedBy
+	if back {
+		link, id = job.RetriedFromFile, e.RetriedFrom
+	}
+	link = strings.TrimSuffix(link, ".txt")
+	if job.ValidateJobID(id) != nil {
+		e.Note = fmt.Sprintf("%s %q is not a job ID", link, id)
+		return LineageEntry{}, false
+	}
+	if seen[id] {
+		e.Note = fmt.Sprintf("%s %s: link cycle, not followed", link, id)
+		return LineageEntry{}, false
+	}
+	seen[id] = true
+
+	dir, err := job.FindJobDir(subagentsRoot, "", id)
+	if err != nil {
+		deleted := LineageEntry{JobEntry: JobEntry{JobID: id, Status: lineageDeleted}, Deleted: true}
+		if back {
+			deleted.RetriedBy = e.JobID
+		} else {
+			deleted.RetriedFrom = e.JobID
+		}
+		return deleted, true
+	}
+	return readLineageEntry(id, dir), true
+}
+
+// readLineageEntry reads the job in dir, reconciling a running job whose
+// process has died.
+func readLineageEntry(jobID, dir string) LineageEntry {
+	je := readListJobEntry(jobID, dir)
+	if je.Status == string(job.StatusRunning) {
+		je.Status, _ = job.CheckJobPID(dir)
+	}
+	return LineageEntry{JobEntry: je}
+}
+
+// writeLineageTable prints lineage as the JOB_ID / STATUS / STARTED / RETRY
+// table. RETRY is "original" for the first job and "retry N" for the others,
+// followed by the entry's Note. utc and o are as in writeListTable.
+func writeLineageTable(w io.Writer, lineage []LineageEntry, utc bool, o *Out) error {
+	out := resolveOut(o, w, nil)
+	if !out.Quiet {
+		fmt.Fprintf(w, "%-44s  %-18s  %-25s  %s\n", "JOB_ID", "STATUS", "STARTED", "RETRY")
+	}
+	for i, e := range lineage {
+		started := "-"
+		if e.StartedAt != nil {
+			t := e.StartedAt.Local()
+			if utc {
+				t = e.StartedAt.UTC()
+			}
+			started = t.Format(time.RFC3339)
+		}
+		retry := "original"
+		if i > 0 {
+			retry = fmt.Sprintf("retry %d", i)
+		}
+		if e.Note != "" {
+			retry += "; " + e.Note
+		}
+		status := out.Status(e.Status, fmt.Sprintf("%-18s", e.Status))
+		fmt.Fprintf(w, "%-44s  %s  %-25s  %s\n", e.JobID, status, started, retry)
+	}
+	return nil
+}
+
+// lineageItems returns lineage as ListJSON items. A deleted job has status
+// "deleted" and only its ID and link.
+func lineageItems(lineage []LineageEntry) []JobListItem {
+	items := make([]JobListItem, 0, len(lineage))
+	for _, e := range lineage {
+		item := JobListItem{
+			ID:          e.JobID,
+			Status:      e.Status,
+			ChainID:     e.ChainID,
+			Step:        e.ChainStep,
+			RetriedFrom: e.RetriedFrom,
+			RetriedBy:   e.RetriedBy,
+		}
+		if e.Deleted {
+			item.Status = "deleted"
+			items = append(items, item)
+			continue
+		}
+		item.ProjectID = filepath.Base(filepath.Dir(e.Dir))
+		if e.StartedAt != nil {
+			item.StartedAt = e.StartedAt.Format(time.RFC3339)
+		}
+		if isFailureStatus(e.Status) {
+			summary := errorSummary(e.Dir)
+			item.ErrorSummary = &summary
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,142 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+const (
+	lineageOrig   = "job-20260101-000000-aaaaaaaa"
+	lineageRetry1 = "job-20260101-000100-bbbbbbbb"
+	lineageRetry2 = "job-20260101-000200-cccccccc"
+)
+
+// retryChain creates a failed original retried twice, the last retry done,
+// and returns the three job directories.
+func retryChain(t *testing.T, root string) [3]string {
+	t.Helper()
+	dirs := [3]string{
+		makeJobDir(t, root, "proj", lineageOrig, "failed"),
+		makeJobDir(t, root, "proj", lineageRetry1, "failed"),
+		makeJobDir(t, root, "proj", lineageRetry2, "done"),
+	}
+	for i := 0; i < 2; i++ {
+		if err := job.LinkRetry(dirs[i], dirs[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dirs
+}
+
+// lineageIDs returns the job IDs and statuses of lineage.
+func lineageIDs(lineage []cmd.LineageEntry) []string {
+	var ids []string
+	for _, e := range lineage {
+		ids = append(ids, e.JobID+" "+e.Status)
+	}
+	return ids
+}
+
+// Scenario: the lineage of any job of a three-deep retry chain is the whole chain
+func TestJobLineage(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	retryChain(t, root)
+	want := []string{lineageOrig + " failed", lineageRetry1 + " failed", lineageRetry2 + " done"}
+
+	for _, ref := range []string{lineageOrig, lineageRetry1, "cccccccc"} {
+		lineage, err := cmd.JobLineage(root, ref)
+		if err != nil {
+			t.Fatalf("JobLineage(%s): %v", ref, err)
+		}
+		if got := lineageIDs(lineage); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("JobLineage(%s) = %v, want %v", ref, got, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := cmd.ListCmd(root, &buf, &cmd.FilterOptions{Lineage: lineageRetry1, UTC: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[0], "RETRY") {
+		t.Fatalf("table =\n%s", buf.String())
+	}
+	for i, suffix := range []string{"original", "retry 1", "retry 2"} {
+		if !strings.HasSuffix(lines[i+1], suffix) || !strings.Contains(lines[i+1], "2026-01-01T00:0") {
+			t.Errorf("row %d = %q, want a start time and %q", i+1, lines[i+1], suffix)
+		}
+	}
+
+	if _, err := cmd.JobLineage(root, "job-20260101-000000-dddddddd"); err == nil || !strings.HasPrefix(err.Error(), "err:not_found") {
+		t.Errorf("JobLineage(missing) = %v, want err:not_found", err)
+	}
+}
+
+// Scenario: a cleaned original shows as (deleted) and a retry link cycle stops the walk
+func TestJobLineageBrokenLinks(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	dirs := retryChain(t, root)
+	if err := os.RemoveAll(dirs[0]); err != nil {
+		t.Fatal(err)
+	}
+	writeJobFile(t, dirs[2], job.RetriedByFile, lineageRetry1)
+	if err := job.UpdateManifest(dirs[2], func(m *job.Manifest) { m.RetriedBy = lineageRetry1 }); err != nil {
+		t.Fatal(err)
+	}
+
+	lineage, err := cmd.JobLineage(root, lineageRetry2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{lineageOrig + " (deleted)", lineageRetry1 + " failed", lineageRetry2 + " done"}
+	if got := lineageIDs(lineage); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("lineage = %v, want %v", got, want)
+	}
+	if !lineage[0].Deleted || lineage[0].RetriedBy != lineageRetry1 {
+		t.Errorf("deleted original = %+v, want Deleted and retried_by %s", lineage[0], lineageRetry1)
+	}
+	if want := "retried_by " + lineageRetry1 + ": link cycle, not followed"; lineage[2].Note != want {
+		t.Errorf("last note = %q, want %q", lineage[2].Note, want)
+	}
+
+	var buf bytes.Buffer
+	if err := cmd.ListJSON(root, &cmd.FilterOptions{Lineage: lineageRetry1}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if len(items) != 3 || items[0]["status"] != "deleted" || items[1]["retried_from"] != lineageOrig || items[1]["retried_by"] != lineageRetry2 {
+		t.Errorf("lineage JSON = %s", buf.String())
+	}
+}
+
+// Scenario: list --json items carry retried_from and retried_by only when set
+func TestListJSONRetryLinks(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	retryChain(t, root)
+	makeJobDir(t, root, "proj", "job-20260101-000300-dddddddd", "done")
+
+	links := map[string][2]string{}
+	for _, item := range cmd.ListJobs(root, nil) {
+		links[item.ID] = [2]string{item.RetriedFrom, item.RetriedBy}
+	}
+	want := map[string][2]string{
+		lineageOrig:                    {"", lineageRetry1},
+		lineageRetry1:                  {lineageOrig, lineageRetry2},
+		lineageRetry2:                  {lineageRetry1, ""},
+		"job-20260101-000300-dddddddd": {"", ""},
+	}
+	for id, w := range want {
+		if links[id] != w {
+			t.Errorf("%s links = %v, want %v", id, links[id], w)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -19,156 +20,451 @@ type JobEntry struct {
 	Status    string
 	StartedAt *time.Time // nil when the job has not started yet
 	Dir       string     // absolute path to the job directory
+	ChainID   string     // empty unless the job is a step of a chain
+	ChainStep int        // 1-based step index within ChainID
+	// RetriedFrom and RetriedBy are the job's retry links, empty when the
+	// job is not a retry or was not retried (see job.LinkRetry).
+	RetriedFrom string
+	RetriedBy   string
+	// Prompt is the job's prompt preview (see job.PromptPreview).
+	Prompt string
 }
 
 // ListCmd scans subagentsRoot for all jobs (project-scoped and legacy flat),
 // checks PID liveness for running jobs, and writes a tabular report to w.
 //
-// Columns: JOB_ID  STATUS  STARTED
-// Rows are sorted newest-first (nil started_at sorts last).
+// Columns: JOB_ID  STATUS  STARTED  ERROR (failed/timeout/permission_error/
+// context_exceeded only)
+// Rows are sorted newest-first (nil started_at sorts last), or as
+// FilterOptions Sort and Reverse ask (see SortJobs). FilterOptions Offset
+// and Limit page through the sorted rows; with a Limit and the default order
+// only the newest job directories are read (see scanNewestJobs).
 // Running jobs whose PID is no longer alive are updated to "failed".
 // Missing status files are reported as "unknown".
-// When there are no jobs nothing is written.
+// When there are no jobs nothing is written. With FilterOptions Lineage the
+// job's retry lineage is printed instead (see JobLineage), with a RETRY
+// column in place of ERROR.
 func ListCmd(subagentsRoot string, w io.Writer, opts ...*FilterOptions) error {
 	var filter *FilterOptions
 	if len(opts) > 0 {
 		filter = opts[0]
 	}
-	entries, err := os.ReadDir(subagentsRoot)
-	if err != nil {
-		// If root doesn't exist, nothing to show.
-		return nil
+	if filter != nil && filter.Lineage != "" {
+		lineage, err := JobLineage(subagentsRoot, filter.Lineage)
+		if err != nil {
+			return err
+		}
+		return writeLineageTable(w, lineage, filter.UTC, filter.Out)
+	}
+	if filter != nil && filter.Limit > 0 && filter.Chain == "" && !filter.sorted() {
+		jobs := scanNewestJobs(subagentsRoot, filter, readListCandidate)
+		if len(jobs) == 0 {
+			return nil
+		}
+		return writeListTable(w, jobs, filter.UTC, filter.Out)
 	}
 
 	var jobs []JobEntry
+	for _, c := range listJobCandidates(subagentsRoot) {
+		if je, ok := readListCandidate(c); ok {
+			jobs = append(jobs, je)
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	// Apply filters if provided.
+	if filter != nil {
+		jobs = FilterJobs(jobs, filter)
+	}
+
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	// A chain filter keeps FilterJobs' step order unless a sort is asked for.
+	switch {
+	case filter.sorted():
+		SortJobs(jobs, filter.Sort, filter.Reverse, time.Now())
+	case filter == nil || filter.Chain == "":
+		sortNewestFirst(jobs)
+	}
+	if filter != nil {
+		jobs = pageJobs(jobs, filter.Offset, filter.Limit)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	if filter == nil {
+		return writeListTable(w, jobs, false, nil)
+	}
+	return writeListTable(w, jobs, filter.UTC, filter.Out)
+}
+
+// sortNewestFirst sorts jobs by started_at, newest first; jobs without a
+// started_at sort last.
+func sortNewestFirst(jobs []JobEntry) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		ti, tj := jobs[i].StartedAt, jobs[j].StartedAt
+		if ti == nil {
+			return false
+		}
+		if tj == nil {
+			return true
+		}
+		return ti.After(*tj)
+	})
+}
+
+// sorted reports whether f asks for an order of its own with Sort or
+// Reverse.
+func (f *FilterOptions) sorted() bool {
+	return f != nil && (f.Sort != "" || f.Reverse)
+}
+
+// SortJobs orders jobs by key, one of ListSortKeys (empty = SortStarted):
+// started and duration descending, the others ascending; reverse flips the
+// key's order. The sort is stable on top of newest first, so jobs with
+// equal keys are always listed newest first. A running job's duration is
+// its elapsed time at now, and a queued job's is zero.
+func SortJobs(jobs []JobEntry, key string, reverse bool, now time.Time) {
+	sortNewestFirst(jobs)
+	var cmp func(a, b JobEntry) int
+	switch key {
+	case SortStatus:
+		cmp = func(a, b JobEntry) int { return statusRank(a.Status) - statusRank(b.Status) }
+	case SortDuration:
+		durations := make(map[string]int, len(jobs))
+		for _, je := range jobs {
+			durations[je.Dir] = jobDuration(je, now)
+		}
+		cmp = func(a, b JobEntry) int { return durations[b.Dir] - durations[a.Dir] }
+	case SortProject:
+		cmp = func(a, b JobEntry) int {
+			return strings.Compare(filepath.Base(filepath.Dir(a.Dir)), filepath.Base(filepath.Dir(b.Dir)))
+		}
+	case SortID:
+		cmp = func(a, b JobEntry) int { return strings.Compare(a.JobID, b.JobID) }
+	default:
+		if !reverse {
+			return
+		}
+		cmp = compareStarted
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if reverse {
+			return cmp(jobs[j], jobs[i]) < 0
+		}
+		return cmp(jobs[i], jobs[j]) < 0
+	})
+}
+
+// compareStarted orders a before b when it started later; jobs without a
+// started_at come last.
+func compareStarted(a, b JobEntry) int {
+	switch {
+	case a.StartedAt == nil && b.StartedAt == nil:
+		return 0
+	case a.StartedAt == nil:
+		return 1
+	case b.StartedAt == nil:
+		return -1
+	}
+	return b.StartedAt.Compare(*a.StartedAt)
+}
+
+// statusRank returns the position of status in ValidStatuses, or
+// len(ValidStatuses) for an unknown status.
+func statusRank(status string) int {
+	for i, s := range validStatuses {
+		if s == status {
+			return i
+		}
+	}
+	return len(validStatuses)
+}
+
+// jobDuration returns how long the job je has run, in whole seconds: its
+// recorded duration once it has finished, the time since it started while
+// running, and 0 while queued or when unknown.
+func jobDuration(je JobEntry, now time.Time) int {
+	switch je.Status {
+	case string(job.StatusQueued):
+		return 0
+	case string(job.StatusRunning):
+		if je.StartedAt == nil {
+			return 0
+		}
+		return int(now.Sub(*je.StartedAt) / time.Second)
+	}
+	if t := readJobTiming(je.Dir, job.LoadManifest(je.Dir), je.Status, now); t.DurationSeconds != nil {
+		return *t.DurationSeconds
+	}
+	return 0
+}
 
+// pageJobs returns jobs without the first offset entries, cut to limit
+// entries (0 = no limit).
+func pageJobs(jobs []JobEntry, offset, limit int) []JobEntry {
+	if offset >= len(jobs) {
+		return nil
+	}
+	jobs = jobs[offset:]
+	if limit > 0 && limit < len(jobs) {
+		jobs = jobs[:limit]
+	}
+	return jobs
+}
+
+// jobCandidate is a possible job directory found by name alone, before any
+// of its files are read.
+type jobCandidate struct {
+	ID      string
+	Dir     string
+	Created time.Time // from the job ID; zero when the name has none
+	// Corrupt marks a top-level job-* directory with neither a status file
+	// nor subdirectories.
+	Corrupt bool
+	// Indexed is the job's entry in its project's index.json, if any; the
+	// job directory need not be read then.
+	Indexed *job.IndexEntry
+}
+
+// listJobCandidates lists the job directories under subagentsRoot, both
+// project-scoped and legacy flat. Only top-level entries are checked for a
+// status file; job directories in projects are not opened, and projects with
+// an index.json (see job.ReadIndex) are not even listed.
+func listJobCandidates(subagentsRoot string) []jobCandidate {
+	entries, err := os.ReadDir(subagentsRoot)
+	if err != nil {
+		return nil
+	}
+	var cands []jobCandidate
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
-		if strings.HasPrefix(entry.Name(), ".") {
+		dirPath := filepath.Join(subagentsRoot, entry.Name())
+		if _, err := os.Stat(filepath.Join(dirPath, "status")); err == nil {
+			cands = append(cands, jobCandidate{ID: entry.Name(), Dir: dirPath, Created: parseJobIDTime(entry.Name())})
 			continue
 		}
-		dirPath := filepath.Join(subagentsRoot, entry.Name())
-		statusPath := filepath.Join(dirPath, "status")
-
-		if _, err := os.Stat(statusPath); err == nil {
-			// Legacy flat layout: subagentsRoot/<jobID>/status
-			je := readListJobEntry(entry.Name(), dirPath)
-			jobs = append(jobs, je)
+		if indexed, ok := job.ReadIndex(dirPath); ok {
+			for id, e := range indexed {
+				cands = append(cands, jobCandidate{
+					ID:      id,
+					Dir:     filepath.Join(dirPath, id),
+					Created: parseJobIDTime(id),
+					Indexed: &e,
+				})
+			}
 			continue
 		}
-
-		// Check if it has a status file directly (corrupted dir with no status)
-		// or is a project directory with job subdirs.
 		subEntries, err := os.ReadDir(dirPath)
 		if err != nil {
 			continue
 		}
-
-		hasJobSubdirs := false
+		found := false
 		for _, sub := range subEntries {
 			if !sub.IsDir() {
 				continue
 			}
-			subDir := filepath.Join(dirPath, sub.Name())
-			subStatus := filepath.Join(subDir, "status")
-			if _, err := os.Stat(subStatus); err == nil {
-				hasJobSubdirs = true
-				je := readListJobEntry(sub.Name(), subDir)
-				jobs = append(jobs, je)
-			}
+			found = true
+			cands = append(cands, jobCandidate{
+				ID:      sub.Name(),
+				Dir:     filepath.Join(dirPath, sub.Name()),
+				Created: parseJobIDTime(sub.Name()),
+			})
 		}
-
-		// If entry.Name() looks like a jobID (starts with "job-") but has no
-		// status file, treat it as a corrupted job directory with unknown status.
-		if !hasJobSubdirs && strings.HasPrefix(entry.Name(), "job-") {
-			je := JobEntry{
-				JobID:  entry.Name(),
-				Status: "unknown",
-				Dir:    dirPath,
-			}
-			jobs = append(jobs, je)
+		if !found && strings.HasPrefix(entry.Name(), "job-") {
+			cands = append(cands, jobCandidate{ID: entry.Name(), Dir: dirPath, Corrupt: true})
 		}
 	}
+	return cands
+}
 
-	if len(jobs) == 0 {
-		return nil
-	}
+// scanNewestJobs returns the page of jobs selected by filter.Offset and
+// filter.Limit without reading every job directory: candidates are ordered
+// by the timestamp in their job ID, newest first, and read with read until
+// filter has matched Offset+Limit jobs. Jobs created in the same second are
+// read together, so ties are settled by started_at. read reports false for
+// a directory that is not a job. The page is sorted by sortNewestFirst.
+func scanNewestJobs(subagentsRoot string, filter *FilterOptions, read func(jobCandidate) (JobEntry, bool)) []JobEntry {
+	cands := listJobCandidates(subagentsRoot)
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].Created.After(cands[j].Created)
+	})
 
-	// Reconcile running jobs: check PID liveness.
-	for i := range jobs {
-		if jobs[i].Status == "running" {
-			newStatus, _ := job.CheckJobPID(jobs[i].Dir)
-			jobs[i].Status = newStatus
+	want := filter.Offset + filter.Limit
+	var jobs []JobEntry
+	for i := 0; i < len(cands) && len(jobs) < want; {
+		end := i + 1
+		for end < len(cands) && cands[end].Created.Equal(cands[i].Created) {
+			end++
 		}
+		var group []JobEntry
+		for _, c := range cands[i:end] {
+			if je, ok := read(c); ok {
+				group = append(group, je)
+			}
+		}
+		jobs = append(jobs, FilterJobs(group, filter)...)
+		i = end
 	}
+	sortNewestFirst(jobs)
+	return pageJobs(jobs, filter.Offset, filter.Limit)
+}
 
-	// Apply filters if provided.
-	if filter != nil {
-		jobs = FilterJobs(jobs, filter)
-	}
-
-	if len(jobs) == 0 {
-		return nil
+// readListCandidate reads c for ListCmd, reconciling a running job whose
+// process has died.
+func readListCandidate(c jobCandidate) (JobEntry, bool) {
+	if c.Corrupt {
+		return JobEntry{JobID: c.ID, Status: UnknownStatus, Dir: c.Dir}, true
 	}
-
-	// Sort newest-first (nil StartedAt sorts last).
-	sort.Slice(jobs, func(i, j int) bool {
-		ti, tj := jobs[i].StartedAt, jobs[j].StartedAt
-		if ti == nil && tj == nil {
-			return false
+	var je JobEntry
+	if c.Indexed != nil {
+		if c.Indexed.Status == "" {
+			return JobEntry{}, false
 		}
-		if ti == nil {
-			return false
+		je = indexedJobEntry(c)
+		if je.StartedAt == nil {
+			if t := parseJobIDTime(c.ID); !t.IsZero() {
+				je.StartedAt = &t
+			}
 		}
-		if tj == nil {
-			return true
+	} else {
+		if _, err := os.Stat(filepath.Join(c.Dir, "status")); err != nil {
+			return JobEntry{}, false
 		}
-		return ti.After(*tj)
-	})
+		je = readListJobEntry(c.ID, c.Dir)
+	}
+	if je.Status == "running" {
+		je.Status, _ = job.CheckJobPID(c.Dir)
+	}
+	return je, true
+}
 
-	// Print tabular output.
-	fmt.Fprintf(w, "%-44s  %-18s  %s\n", "JOB_ID", "STATUS", "STARTED")
+// writeListTable prints jobs as the JOB_ID / STATUS / STARTED / ERROR table.
+// STARTED is shown in the local timezone, or in UTC when utc is set.
+// ERROR holds the truncated error summary of failed jobs. o is the output
+// policy: Quiet drops the header row and Color colors the STATUS column.
+func writeListTable(w io.Writer, jobs []JobEntry, utc bool, o *Out) error {
+	out := resolveOut(o, w, nil)
+	if !out.Quiet {
+		fmt.Fprintf(w, "%-44s  %-18s  %-25s  %s\n", "JOB_ID", "STATUS", "STARTED", "ERROR")
+	}
 	for _, j := range jobs {
 		started := "-"
 		if j.StartedAt != nil {
-			started = j.StartedAt.Format(time.RFC3339)
+			t := j.StartedAt.Local()
+			if utc {
+				t = j.StartedAt.UTC()
+			}
+			started = t.Format(time.RFC3339)
 		}
-		fmt.Fprintf(w, "%-44s  %-18s  %s\n", j.JobID, j.Status, started)
+		errCol := ""
+		if isFailureStatus(j.Status) {
+			errCol = truncateLeft(errorSummary(j.Dir), listErrorWidth)
+		}
+		status := out.Status(j.Status, fmt.Sprintf("%-18s", j.Status))
+		line := fmt.Sprintf("%-44s  %s  %-25s  %s", j.JobID, status, started, errCol)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
 	}
 	return nil
 }
 
+const (
+	// errorSummaryMax bounds error_summary, keeping the end of the line.
+	errorSummaryMax = 120
+	// listErrorWidth bounds the ERROR column of the list table.
+	listErrorWidth = 60
+)
+
+// ansiEscapeRe matches ANSI CSI escape sequences such as color codes.
+var ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// isFailureStatus reports whether status is one whose stderr explains it.
+func isFailureStatus(status string) bool {
+	switch job.Status(status) {
+	case job.StatusFailed, job.StatusTimeout, job.StatusPermissionError, job.StatusContextExceeded:
+		return true
+	}
+	return false
+}
+
+// diagnosticPrefixRe matches the "[GoLeM]" prefix of glm's own stderr lines,
+// with the timestamp job.AppendStderr puts before it.
+var diagnosticPrefixRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T[0-9:]+Z )?\[GoLeM\]\s*`)
+
+// errorSummary returns the last meaningful line of jobDir/stderr.txt with ANSI
+// codes, the "[GoLeM]" prefix and the stale-recovery marker removed, cut to
+// its last errorSummaryMax characters. Missing or empty stderr yields "".
+func errorSummary(jobDir string) string {
+	data, err := os.ReadFile(filepath.Join(jobDir, "stderr.txt"))
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(ansiEscapeRe.ReplaceAllString(string(data), ""), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line == job.StaleRecoveredMarker {
+			continue
+		}
+		line = diagnosticPrefixRe.ReplaceAllString(line, "")
+		return truncateLeft(line, errorSummaryMax)
+	}
+	return ""
+}
+
+// truncateLeft keeps the last n runes of s, marking a cut with "...".
+func truncateLeft(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return "..." + string(r[len(r)-(n-3):])
+}
+
+// indexedJobEntry returns the JobEntry for a candidate with an index entry,
+// without reading its job directory.
+func indexedJobEntry(c jobCandidate) JobEntry {
+	e := c.Indexed
+	je := JobEntry{
+		JobID:       c.ID,
+		Status:      string(e.Status),
+		Dir:         c.Dir,
+		ChainID:     e.ChainID,
+		ChainStep:   e.ChainStep,
+		RetriedFrom: e.RetriedFrom,
+		RetriedBy:   e.RetriedBy,
+		Prompt:      e.Prompt,
+	}
+	if t, err := job.ParseTimestamp(e.StartedAt); err == nil {
+		je.StartedAt = &t
+	}
+	return je
+}
+
 // readListJobEntry reads a job directory and returns a JobEntry for list display.
-// Missing status file returns "unknown" status (unlike job.ReadStatus which returns "failed").
+// The job.json manifest is read first, falling back to the legacy files.
+// Missing status returns "unknown" status (unlike job.ReadStatus which returns "failed").
+// An empty or unknown status is read again as job.StableStatus does, so a
+// status file caught mid-replace does not show a live job as unknown.
 func readListJobEntry(jobID, jobDir string) JobEntry {
-	status := "unknown"
-	data, err := os.ReadFile(filepath.Join(jobDir, "status"))
-	if err == nil {
-		s := strings.TrimSpace(string(data))
-		if s != "" {
-			status = s
-		}
+	m := job.LoadManifest(jobDir)
+	if !validStatusMap[string(m.Status)] {
+		m.Status = job.StableStatus(jobDir)
+	}
+	status := UnknownStatus
+	if m.Status != "" {
+		status = string(m.Status)
 	}
 
 	var startedAt *time.Time
-	// Try started_at.txt first, then started_at (no extension).
-	for _, name := range []string{"started_at.txt", "started_at"} {
-		data, err := os.ReadFile(filepath.Join(jobDir, name))
-		if err == nil {
-			t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
-			if err == nil {
-				startedAt = &t
-				break
-			}
-			// Try parsing as a simpler format.
-			t, err = time.Parse("2006-01-02T15:04:05-07:00", strings.TrimSpace(string(data)))
-			if err == nil {
-				startedAt = &t
-				break
-			}
-		}
+	// The manifest falls back to started_at.txt, then started_at.
+	if t, err := job.ParseTimestamp(m.StartedAt); err == nil {
+		startedAt = &t
 	}
 
 	// If no started_at file is found, parse the timestamp from the jobID as fallback.
@@ -180,10 +476,15 @@ func readListJobEntry(jobID, jobDir string) JobEntry {
 	}
 
 	return JobEntry{
-		JobID:     jobID,
-		Status:    status,
-		StartedAt: startedAt,
-		Dir:       jobDir,
+		JobID:       jobID,
+		Status:      status,
+		StartedAt:   startedAt,
+		Dir:         jobDir,
+		ChainID:     m.ChainID,
+		ChainStep:   m.ChainStep,
+		RetriedFrom: m.RetriedFrom,
+		RetriedBy:   m.RetriedBy,
+		Prompt:      job.PromptPreview(m.Prompt),
 	}
 }
 
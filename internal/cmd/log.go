@@ -5,19 +5,54 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/errs"
 	"github.com/veschin/GoLeM/internal/job"
 )
 
+// LogOptions holds optional LogCmd and LogJSON settings.
+type LogOptions struct {
+	// Diff prints the captured diff.patch instead of the changelog.
+	Diff bool
+	// Stat prints ChangelogStats instead of the changelog; LogJSON adds them
+	// as "stats".
+	Stat bool
+}
+
 // LogCmd prints the changelog.txt from the job directory identified by jobID.
 // It searches subagentsRoot using the same lookup strategy as FindJobDir.
-// If changelog.txt is absent it prints "(no changelog)".
-// If the job directory cannot be found it returns an exitcode.Error with
-// category not_found (exit code 3).
-func LogCmd(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
+// If changelog.txt is absent it prints "(no changelog)". With LogOptions.Diff
+// it prints diff.patch instead, or "(no diff captured)". With LogOptions.Stat
+// it prints the changelog's totals and per-file counts (see WriteChangelogStats).
+// If the job directory cannot be found it returns an errs.NotFoundError
+// (err:not_found, exit code 3); a malformed or ambiguous jobID is an
+// err:user (exit code 1).
+func LogCmd(subagentsRoot, currentProjectID, jobID string, w io.Writer, opts ...*LogOptions) error {
+	o := &LogOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return err
+	}
 	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
 	if err != nil {
-		return fmt.Errorf("err:not_found")
+		return errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+
+	if o.Diff {
+		data, err := os.ReadFile(filepath.Join(jobDir, "diff.patch"))
+		if err != nil {
+			fmt.Fprint(w, "(no diff captured)")
+			return nil
+		}
+		_, err = w.Write(data)
+		return err
 	}
 
 	data, err := os.ReadFile(filepath.Join(jobDir, "changelog.txt"))
@@ -27,6 +62,174 @@ func LogCmd(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
 		return nil
 	}
 
+	if o.Stat {
+		return WriteChangelogStats(w, ParseChangelogStats(string(data)))
+	}
+
 	_, err = fmt.Fprint(w, string(data))
 	return err
 }
+
+// The ops of a ChangelogEntry, one per changelog.txt line format of
+// claude.GenerateChangelog.
+const (
+	ChangelogEdit     = "edit"     // EDIT <path>: <n> chars
+	ChangelogWrite    = "write"    // WRITE <path>
+	ChangelogDelete   = "delete"   // DELETE via bash: <command>
+	ChangelogFS       = "fs"       // FS: <command>
+	ChangelogNotebook = "notebook" // NOTEBOOK <path>
+	// ChangelogUnknown is a line in none of these formats; Raw holds it.
+	ChangelogUnknown = "unknown"
+)
+
+// ChangelogEntry is one change of a changelog.txt, as parsed by
+// ParseChangelog. Path is set for edit, write and notebook, Chars (the
+// length of the new text) for edit, and Command for delete and fs. Commands
+// are cut to their first 80 bytes when the changelog is written.
+type ChangelogEntry struct {
+	Op      string `json:"op"`
+	Path    string `json:"path,omitempty"`
+	Chars   *int   `json:"chars,omitempty"`
+	Command string `json:"command,omitempty"`
+	Raw     string `json:"raw,omitempty"`
+}
+
+// ParseChangelog parses the lines of a changelog as written by
+// claude.GenerateChangelog into entries, in order. Blank lines and the
+// "(no file changes)" and claude.PlanChangelog sentinels give no entry;
+// a line in no known format gives a ChangelogUnknown entry. It never
+// returns nil.
+func ParseChangelog(changelog string) []ChangelogEntry {
+	entries := []ChangelogEntry{}
+	for _, line := range strings.Split(changelog, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "(no file changes)" || line == claude.PlanChangelog {
+			continue
+		}
+		entries = append(entries, parseChangelogLine(line))
+	}
+	return entries
+}
+
+// parseChangelogLine parses one non-blank changelog line.
+func parseChangelogLine(line string) ChangelogEntry {
+	switch {
+	case strings.HasPrefix(line, "EDIT "):
+		// "EDIT <path>: <n> chars"; the path itself may contain ": ".
+		rest := strings.TrimPrefix(line, "EDIT ")
+		if i := strings.LastIndex(rest, ": "); i > 0 {
+			if chars, err := strconv.Atoi(strings.TrimSuffix(rest[i+2:], " chars")); err == nil && strings.HasSuffix(rest, " chars") {
+				return ChangelogEntry{Op: ChangelogEdit, Path: rest[:i], Chars: &chars}
+			}
+		}
+	case strings.HasPrefix(line, "WRITE "):
+		return ChangelogEntry{Op: ChangelogWrite, Path: strings.TrimPrefix(line, "WRITE ")}
+	case strings.HasPrefix(line, "NOTEBOOK "):
+		return ChangelogEntry{Op: ChangelogNotebook, Path: strings.TrimPrefix(line, "NOTEBOOK ")}
+	case strings.HasPrefix(line, "DELETE via bash: "):
+		return ChangelogEntry{Op: ChangelogDelete, Command: strings.TrimPrefix(line, "DELETE via bash: ")}
+	case strings.HasPrefix(line, "FS: "):
+		return ChangelogEntry{Op: ChangelogFS, Command: strings.TrimPrefix(line, "FS: ")}
+	}
+	return ChangelogEntry{Op: ChangelogUnknown, Raw: line}
+}
+
+// ChangelogStats aggregates a changelog.txt: totals by operation, and the
+// files edited or written, most-touched first.
+type ChangelogStats struct {
+	Edits   int                 `json:"edits"`
+	Writes  int                 `json:"writes"`
+	Deletes int                 `json:"deletes"`
+	FSOps   int                 `json:"fs_ops"`
+	Files   []ChangelogFileStat `json:"files"`
+}
+
+// ChangelogFileStat counts the changes to one file. Edits include notebook
+// edits; Chars sums the new text of its EDIT lines.
+type ChangelogFileStat struct {
+	Path   string `json:"path"`
+	Edits  int    `json:"edits"`
+	Chars  int    `json:"chars"`
+	Writes int    `json:"writes,omitempty"`
+}
+
+// ParseChangelogStats aggregates the entries of a changelog (see
+// ParseChangelog); unknown lines count as nothing. Files are sorted by
+// edits plus writes, descending, then by path.
+func ParseChangelogStats(changelog string) *ChangelogStats {
+	stats := &ChangelogStats{Files: []ChangelogFileStat{}}
+	byPath := map[string]*ChangelogFileStat{}
+	file := func(path string) *ChangelogFileStat {
+		if f, ok := byPath[path]; ok {
+			return f
+		}
+		f := &ChangelogFileStat{Path: path}
+		byPath[path] = f
+		return f
+	}
+
+	for _, e := range ParseChangelog(changelog) {
+		switch e.Op {
+		case ChangelogEdit:
+			f := file(e.Path)
+			f.Edits++
+			f.Chars += *e.Chars
+			stats.Edits++
+		case ChangelogNotebook:
+			file(e.Path).Edits++
+			stats.Edits++
+		case ChangelogWrite:
+			file(e.Path).Writes++
+			stats.Writes++
+		case ChangelogDelete:
+			stats.Deletes++
+		case ChangelogFS:
+			stats.FSOps++
+		}
+	}
+
+	for _, f := range byPath {
+		stats.Files = append(stats.Files, *f)
+	}
+	sort.Slice(stats.Files, func(i, j int) bool {
+		a, b := stats.Files[i], stats.Files[j]
+		if a.Edits+a.Writes != b.Edits+b.Writes {
+			return a.Edits+a.Writes > b.Edits+b.Writes
+		}
+		return a.Path < b.Path
+	})
+	return stats
+}
+
+// WriteChangelogStats prints stats as a totals line followed by one
+// "<path>: 5 edits, 470 chars" line per file, or "(no file changes)".
+func WriteChangelogStats(w io.Writer, stats *ChangelogStats) error {
+	if stats.Edits+stats.Writes+stats.Deletes+stats.FSOps == 0 {
+		_, err := fmt.Fprintln(w, "(no file changes)")
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%s, %s, %s, %s\n", plural(stats.Edits, "edit"), plural(stats.Writes, "write"), plural(stats.Deletes, "delete"), plural(stats.FSOps, "fs op")); err != nil {
+		return err
+	}
+	for _, f := range stats.Files {
+		var parts []string
+		if f.Edits > 0 {
+			parts = append(parts, plural(f.Edits, "edit"), plural(f.Chars, "char"))
+		}
+		if f.Writes > 0 {
+			parts = append(parts, plural(f.Writes, "write"))
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", f.Path, strings.Join(parts, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plural formats n with noun, adding "s" unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/log"
+)
+
+// defaultLogsPollInterval is how often LogsCmd checks the log file when
+// following it.
+const defaultLogsPollInterval = 500 * time.Millisecond
+
+// LogsOptions holds optional LogsCmd settings.
+type LogsOptions struct {
+	// Job keeps only the lines whose job_id field is this job ID.
+	Job string
+	// Level keeps only the lines at this level or above (default debug,
+	// i.e. all).
+	Level log.Level
+	// Follow keeps printing lines as they are appended until Stop is closed.
+	Follow bool
+	// PollInterval is how often the file is checked with Follow (default
+	// 500ms).
+	PollInterval time.Duration
+	// Stop, when closed, ends a Follow (wired to Ctrl-C by the CLI).
+	Stop <-chan struct{}
+}
+
+// LogsCmd prints the lines of the GoLeM log file at path (GLM_LOG_FILE) that
+// match opts, unchanged. Lines may be in any mix of the log formats; see
+// log.ParseLine. Lines that are not log lines count as info lines without
+// fields, so a job filter drops them.
+//
+// It returns err:user when path is empty and err:not_found when the file
+// does not exist; with Follow a missing file is waited for instead.
+func LogsCmd(path string, w io.Writer, opts ...*LogsOptions) error {
+	o := &LogsOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	if path == "" {
+		return errs.User(`"No log file: set GLM_LOG_FILE (or pass --file PATH)"`)
+	}
+	if _, err := os.Stat(path); err != nil && !o.Follow {
+		return errs.NotFound(`"Log file not found: %s"`, path)
+	}
+
+	filter := &logFilter{w: w, opts: o}
+	tail := &fileTail{path: path, w: filter}
+	tail.copy()
+	if !o.Follow {
+		filter.flush()
+		return nil
+	}
+
+	interval := o.PollInterval
+	if interval <= 0 {
+		interval = defaultLogsPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.Stop:
+			return nil
+		case <-ticker.C:
+			tail.copy()
+		}
+	}
+}
+
+// logFilter writes the complete lines written to it that match opts to w,
+// holding back a trailing partial line until the rest of it arrives.
+type logFilter struct {
+	w       io.Writer
+	opts    *LogsOptions
+	partial []byte
+}
+
+func (f *logFilter) Write(p []byte) (int, error) {
+	f.partial = append(f.partial, p...)
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		f.line(f.partial[:i+1])
+		f.partial = f.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush writes a held back last line that has no newline.
+func (f *logFilter) flush() {
+	if len(f.partial) > 0 {
+		f.line(append(f.partial, '\n'))
+		f.partial = nil
+	}
+}
+
+// line writes line if it matches the options.
+func (f *logFilter) line(line []byte) {
+	e, _ := log.ParseLine(string(line))
+	if e.Level < f.opts.Level {
+		return
+	}
+	if f.opts.Job != "" && e.Fields["job_id"] != f.opts.Job {
+		return
+	}
+	f.w.Write(line)
+}
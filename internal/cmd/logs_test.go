@@ -0,0 +1,129 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/log"
+)
+
+// mixedLog is a log file with logfmt, JSON and human-readable lines of two
+// jobs, as left by runs with different GLM_LOG_FORMAT settings.
+const mixedLog = `ts=2026-01-01T10:00:00Z level=debug msg="command started" command=run
+ts=2026-01-01T10:00:01Z level=debug msg="job created" command=run job_id=job-20260101-100000-aaaaaaaa
+{"level":"warn","msg":"slow start","ts":"2026-01-01T10:00:02Z","command":"start","job_id":"job-20260101-100000-bbbbbbbb"}
+{"event":"claude_started","job_id":"job-20260101-100000-aaaaaaaa","pid":42,"ts":"2026-01-01T10:00:03Z"}
+[x] Claude CLI failed command=run job_id=job-20260101-100000-aaaaaaaa
+panic: not a log line
+ts=2026-01-01T10:00:05Z level=info msg="job finished" command=start job_id=job-20260101-100000-bbbbbbbb exit_code=0
+`
+
+// Scenario: glm logs filters a mixed-format log by job and by level
+func TestLogsFiltersByJobAndLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "glm.log")
+	writeFile(t, path, mixedLog)
+	lines := strings.Split(mixedLog, "\n")
+
+	tests := []struct {
+		name string
+		opts *cmd.LogsOptions
+		want []int // indexes of the lines printed
+	}{
+		{"everything", nil, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"one job", &cmd.LogsOptions{Job: "job-20260101-100000-aaaaaaaa"}, []int{1, 3, 4}},
+		{"warn and up", &cmd.LogsOptions{Level: log.LevelWarn}, []int{2, 4}},
+		{"job and level", &cmd.LogsOptions{Job: "job-20260101-100000-bbbbbbbb", Level: log.LevelInfo}, []int{2, 6}},
+		{"unknown job", &cmd.LogsOptions{Job: "job-20260101-100000-cccccccc"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := cmd.LogsCmd(path, &out, tt.opts); err != nil {
+				t.Fatalf("LogsCmd error: %v", err)
+			}
+			var want string
+			for _, i := range tt.want {
+				want += lines[i] + "\n"
+			}
+			if out.String() != want {
+				t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+			}
+		})
+	}
+}
+
+// Scenario: glm logs needs a log file
+func TestLogsWithoutFile(t *testing.T) {
+	var out bytes.Buffer
+	if err := cmd.LogsCmd("", &out); err == nil || !strings.Contains(err.Error(), "GLM_LOG_FILE") {
+		t.Errorf("LogsCmd(\"\") = %v, want an error naming GLM_LOG_FILE", err)
+	}
+	missing := filepath.Join(t.TempDir(), "glm.log")
+	if err := cmd.LogsCmd(missing, &out); err == nil || !strings.HasPrefix(err.Error(), "err:not_found") {
+		t.Errorf("LogsCmd(missing) = %v, want err:not_found", err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a writer and a reader goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Scenario: --follow prints matching lines as they are appended, whole lines only
+func TestLogsFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "glm.log")
+	writeFile(t, path, "ts=2026-01-01T10:00:00Z level=info msg=old job_id=job-1\n")
+
+	var out syncBuffer
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.LogsCmd(path, &out, &cmd.LogsOptions{Job: "job-1", Follow: true, PollInterval: 10 * time.Millisecond, Stop: stop})
+	}()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("ts=2026-01-01T10:00:01Z level=info msg=other job_id=job-2\n")
+	f.WriteString("ts=2026-01-01T10:00:02Z level=info msg=new ")
+	time.Sleep(50 * time.Millisecond)
+	if strings.Contains(out.String(), "msg=new") {
+		t.Errorf("a partial line was printed: %q", out.String())
+	}
+	f.WriteString("job_id=job-1\n")
+
+	want := "ts=2026-01-01T10:00:00Z level=info msg=old job_id=job-1\n" +
+		"ts=2026-01-01T10:00:02Z level=info msg=new job_id=job-1\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for out.String() != want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("LogsCmd error: %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
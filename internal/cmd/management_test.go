@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"syscall"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
 )
 
 // ---------- helpers ----------
@@ -74,14 +77,15 @@ func makePidFile(t *testing.T, jobDir string, pid int) {
 	}
 }
 
-// readStatus reads the status file from the given job directory.
+// readStatus reads the status file from the given job directory, without
+// the trailing newline job.WriteStatus adds.
 func readStatus(t *testing.T, jobDir string) string {
 	t.Helper()
 	data, err := os.ReadFile(filepath.Join(jobDir, "status"))
 	if err != nil {
 		t.Fatalf("readStatus: %v", err)
 	}
-	return string(data)
+	return strings.TrimSpace(string(data))
 }
 
 // noopSignal is a signal function that does nothing (simulates dead process).
@@ -147,6 +151,83 @@ func TestListShowsAllJobsInTabularFormatSortedByStartTime(t *testing.T) {
 	}
 }
 
+// Scenario: The ERROR column shows why a job failed, truncated, only for failures
+func TestListShowsErrorColumnForFailedJobs(t *testing.T) {
+	root := t.TempDir()
+	failed := makeJobWithStarted(t, root, "job-20260227-102000-c9d0e1f2", "failed", "2026-02-27T10:20:00+03:00")
+	done := makeJobWithStarted(t, root, "job-20260227-100000-a1b2c3d4", "done", "2026-02-27T10:00:00+03:00")
+	if err := os.WriteFile(filepath.Join(failed, "stderr.txt"), []byte("Error: "+strings.Repeat("y", 100)+" API key rejected\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile stderr: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(done, "stderr.txt"), []byte("deprecation warning\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile stderr: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := cmd.ListCmd(root, &buf); err != nil {
+		t.Fatalf("ListCmd error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.HasSuffix(lines[0], "ERROR") {
+		t.Errorf("header missing ERROR column: %q", lines[0])
+	}
+	for _, line := range lines[1:] {
+		switch {
+		case strings.HasPrefix(line, "job-20260227-102000"):
+			if !strings.HasSuffix(line, "API key rejected") {
+				t.Errorf("failed row missing error tail: %q", line)
+			}
+			if !strings.Contains(line, "  ...yyy") {
+				t.Errorf("long error not truncated from the left: %q", line)
+			}
+		case strings.HasPrefix(line, "job-20260227-100000"):
+			if strings.Contains(line, "warning") {
+				t.Errorf("done row shows stderr: %q", line)
+			}
+		}
+	}
+}
+
+// Jobs created on machines in different timezones sort by the actual instant,
+// and STARTED is rendered in one zone.
+func TestListSortsMixedOffsetsByInstant(t *testing.T) {
+	root := t.TempDir()
+	// Newest first by instant: d (10:15Z), c (10:00Z), b (09:30Z), a (09:00Z).
+	// As strings the order would be a, d, b, c.
+	makeJobWithStarted(t, root, "job-20260227-090000-aaaaaaaa", "done", "2026-02-27T12:00:00+03:00")
+	makeJobWithStarted(t, root, "job-20260227-093000-bbbbbbbb", "done", "2026-02-27T09:30:00Z")
+	makeJobWithStarted(t, root, "job-20260227-100000-cccccccc", "done", "2026-02-27T05:00:00-05:00")
+	makeJobWithStarted(t, root, "job-20260227-101500-dddddddd", "done", "2026-02-27T13:15:00+0300")
+
+	orig := time.Local
+	time.Local = time.FixedZone("IST", 5*3600+1800)
+	t.Cleanup(func() { time.Local = orig })
+
+	for _, tt := range []struct {
+		utc     bool
+		started []string
+	}{
+		{false, []string{"2026-02-27T15:45:00+05:30", "2026-02-27T15:30:00+05:30", "2026-02-27T15:00:00+05:30", "2026-02-27T14:30:00+05:30"}},
+		{true, []string{"2026-02-27T10:15:00Z", "2026-02-27T10:00:00Z", "2026-02-27T09:30:00Z", "2026-02-27T09:00:00Z"}},
+	} {
+		var buf bytes.Buffer
+		if err := cmd.ListCmd(root, &buf, &cmd.FilterOptions{UTC: tt.utc}); err != nil {
+			t.Fatalf("ListCmd: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")[1:]
+		if len(lines) != 4 {
+			t.Fatalf("got %d rows, want 4:\n%s", len(lines), buf.String())
+		}
+		for i, suffix := range []string{"dddddddd", "cccccccc", "bbbbbbbb", "aaaaaaaa"} {
+			fields := strings.Fields(lines[i])
+			if !strings.HasSuffix(fields[0], suffix) || fields[2] != tt.started[i] {
+				t.Errorf("utc=%v row %d = %q, want %s started %s", tt.utc, i, lines[i], suffix, tt.started[i])
+			}
+		}
+	}
+}
+
 // ---------- AC2: List scans both project-scoped and legacy dirs ----------
 
 func TestListFindsJobsInProjectScopedDirectories(t *testing.T) {
@@ -348,8 +429,8 @@ func TestCleanWithoutFlagsRemovesTerminalStatusJobs(t *testing.T) {
 		t.Fatalf("CleanCmd error: %v", err)
 	}
 
-	if got := strings.TrimSpace(buf.String()); got != "Cleaned 4 jobs" {
-		t.Errorf("CleanCmd output: got %q, want %q", got, "Cleaned 4 jobs")
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 4 jobs (done 1, failed 1, timeout 1, killed 1)" {
+		t.Errorf("CleanCmd output: got %q, want %q", got, "Cleaned 4 jobs (done 1, failed 1, timeout 1, killed 1)")
 	}
 
 	for _, e := range entries {
@@ -442,8 +523,8 @@ func TestCleanWithDaysRemovesOldJobsRegardlessOfStatus(t *testing.T) {
 		t.Fatalf("CleanCmd error: %v", err)
 	}
 
-	if got := strings.TrimSpace(buf.String()); got != "Cleaned 3 jobs" {
-		t.Errorf("CleanCmd output: got %q, want %q", got, "Cleaned 3 jobs")
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 3 jobs (done 1, failed 1, timeout 1)" {
+		t.Errorf("CleanCmd output: got %q, want %q", got, "Cleaned 3 jobs (done 1, failed 1, timeout 1)")
 	}
 
 	for _, e := range entries {
@@ -476,8 +557,8 @@ func TestCleanPrintsCountOfRemovedJobs(t *testing.T) {
 		t.Fatalf("CleanCmd error: %v", err)
 	}
 
-	if got := strings.TrimSpace(buf.String()); got != "Cleaned 5 jobs" {
-		t.Errorf("CleanCmd output: got %q, want %q", got, "Cleaned 5 jobs")
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 5 jobs (done 5)" {
+		t.Errorf("CleanCmd output: got %q, want %q", got, "Cleaned 5 jobs (done 5)")
 	}
 }
 
@@ -519,6 +600,135 @@ func TestCleanWithNegativeDaysValueReturnsError(t *testing.T) {
 	}
 }
 
+// ---------- glm clean --project / --status ----------
+
+// assertJobsExist fails for each dir whose existence differs from want.
+func assertJobsExist(t *testing.T, want bool, dirs ...string) {
+	t.Helper()
+	for _, dir := range dirs {
+		_, err := os.Stat(dir)
+		if exists := err == nil; exists != want {
+			t.Errorf("job %s exists = %v, want %v", dir, exists, want)
+		}
+	}
+}
+
+// Scenario: --project and --project-name clean only that project's jobs; other projects and legacy flat jobs stay, and an unscoped clean reaches both layouts
+func TestCleanProjectScoping(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	mine := makeJobInProject(t, root, "myapp-12345", "job-20260227-100000-aaaa0001", "done")
+	other := makeJobInProject(t, root, "other-67890", "job-20260227-100000-bbbb0001", "done")
+	sameName := makeJobInProject(t, root, "myapp-99999", "job-20260227-100000-cccc0001", "failed")
+	legacy := makeJob(t, root, "job-20260227-100000-dddd0001", "done")
+
+	var buf bytes.Buffer
+	if err := cmd.CleanCmd(root, -1, now, &buf, &cmd.CleanOptions{ProjectID: "myapp-12345"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 1 jobs (done 1)" {
+		t.Errorf("--project output = %q", got)
+	}
+	assertJobsExist(t, false, mine)
+	assertJobsExist(t, true, other, sameName, legacy)
+
+	buf.Reset()
+	if err := cmd.CleanCmd(root, -1, now, &buf, &cmd.CleanOptions{ProjectName: "myapp"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 1 jobs (failed 1)" {
+		t.Errorf("--project-name output = %q", got)
+	}
+	assertJobsExist(t, false, sameName)
+	assertJobsExist(t, true, other, legacy)
+
+	buf.Reset()
+	if err := cmd.CleanCmd(root, -1, now, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 2 jobs (done 2)" {
+		t.Errorf("unscoped output = %q", got)
+	}
+	assertJobsExist(t, false, other, legacy)
+}
+
+// Scenario: --status removes only the listed statuses; running and queued stay unless --force finds them dead
+func TestCleanStatusFilter(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	done := makeJobInProject(t, root, "proj", "job-20260227-100000-aaaa0001", "done")
+	failed := makeJobInProject(t, root, "proj", "job-20260227-100000-aaaa0002", "failed")
+	timeout := makeJobInProject(t, root, "proj", "job-20260227-100000-aaaa0003", "timeout")
+	alive := makeJobInProject(t, root, "proj", "job-20260227-100000-aaaa0004", "running")
+	makePidFile(t, alive, os.Getpid())
+	dead := makeJobInProject(t, root, "proj", "job-20260227-100000-aaaa0005", "running")
+	makePidFile(t, dead, 99999999)
+	queued := makeJobInProject(t, root, "proj", "job-20260227-100000-aaaa0006", "queued")
+	if err := os.WriteFile(filepath.Join(queued, "created_at.txt"), []byte(now.Add(-time.Minute).Format(time.RFC3339)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := cmd.CleanCmd(root, -1, now, &buf, &cmd.CleanOptions{Statuses: []string{"failed", "timeout"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 2 jobs (failed 1, timeout 1)" {
+		t.Errorf("--status output = %q", got)
+	}
+	assertJobsExist(t, false, failed, timeout)
+	assertJobsExist(t, true, done, alive, dead, queued)
+
+	buf.Reset()
+	if err := cmd.CleanCmd(root, -1, now, &buf, &cmd.CleanOptions{Statuses: []string{"running", "queued"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 0 jobs" {
+		t.Errorf("--status running without --force = %q, want nothing cleaned", got)
+	}
+
+	buf.Reset()
+	if err := cmd.CleanCmd(root, -1, now, &buf, &cmd.CleanOptions{Statuses: []string{"running", "queued"}, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 1 jobs (running 1)" {
+		t.Errorf("--force output = %q, want only the dead running job", got)
+	}
+	assertJobsExist(t, false, dead)
+	assertJobsExist(t, true, done, alive, queued)
+}
+
+// Scenario: --status and --project compose with --days; only old jobs of the listed statuses in the project go
+func TestCleanStatusWithDays(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+
+	age := func(dir string, at time.Time) string {
+		t.Helper()
+		if err := os.Chtimes(dir, at, at); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	oldFailed := age(makeJobInProject(t, root, "proj", "job-20260217-100000-aaaa0001", "failed"), old)
+	oldDone := age(makeJobInProject(t, root, "proj", "job-20260217-100000-aaaa0002", "done"), old)
+	oldRunning := age(makeJobInProject(t, root, "proj", "job-20260217-100000-aaaa0003", "running"), old)
+	makePidFile(t, oldRunning, os.Getpid())
+	newFailed := age(makeJobInProject(t, root, "proj", "job-20260227-100000-aaaa0004", "failed"), now)
+	otherOld := age(makeJobInProject(t, root, "other", "job-20260217-100000-bbbb0001", "failed"), old)
+
+	var buf bytes.Buffer
+	opts := &cmd.CleanOptions{ProjectID: "proj", Statuses: []string{"failed", "running"}, Force: true}
+	if err := cmd.CleanCmd(root, 7, now, &buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Cleaned 1 jobs (failed 1)" {
+		t.Errorf("output = %q", got)
+	}
+	assertJobsExist(t, false, oldFailed)
+	assertJobsExist(t, true, oldDone, oldRunning, newFailed, otherOld)
+}
+
 // ---------- AC11: glm kill — terminate running job ----------
 
 func TestKillSendsSIGTERMThenSIGKILLToProcessGroup(t *testing.T) {
@@ -558,9 +768,9 @@ func TestKillSendsSIGTERMThenSIGKILLToProcessGroup(t *testing.T) {
 		t.Errorf("first signal: got %v, want SIGTERM", signals[0].sig)
 	}
 
-	// Sleep must have been called once
-	if sleptCount != 1 {
-		t.Errorf("sleep called %d times, want 1", sleptCount)
+	// A process that is already gone is not waited for.
+	if sleptCount != 0 {
+		t.Errorf("sleep called %d times, want 0", sleptCount)
 	}
 }
 
@@ -587,7 +797,8 @@ func TestKillSendsSIGKILLWhenProcessStillAliveAfterSIGTERM(t *testing.T) {
 		return signalFn(pid, sig)
 	}
 
-	if err := cmd.KillCmd(root, "", jobID, trackSignals, noopSleep); err != nil {
+	alive := func(int) bool { return true }
+	if err := cmd.KillCmd(root, "", jobID, trackSignals, noopSleep, &cmd.KillOptions{Grace: time.Second, IsAlive: alive}); err != nil {
 		t.Fatalf("KillCmd error: %v", err)
 	}
 
@@ -603,6 +814,146 @@ func TestKillSendsSIGKILLWhenProcessStillAliveAfterSIGTERM(t *testing.T) {
 	}
 }
 
+// Scenario: A process that exits on SIGTERM ends the grace period early and gets no SIGKILL; one that ignores SIGTERM gets SIGKILL at the deadline; stderr.txt names the signal and a leftover raw.json is parsed
+func TestKillGraceWithRealProcesses(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		grace      time.Duration
+		wantSignal syscall.Signal
+		wantNote   string
+	}{
+		{"exits on SIGTERM", `touch "$0"; exec sleep 30`, 10 * time.Second, syscall.SIGTERM, "[GoLeM] Killed: exited on SIGTERM"},
+		{"ignores SIGTERM", `trap "" TERM; touch "$0"; exec sleep 30`, 300 * time.Millisecond, syscall.SIGKILL, "[GoLeM] Killed: SIGKILL after 300ms without exiting on SIGTERM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			jobID := "job-20260227-101500-9a9b9c9d"
+			dir := makeJob(t, root, jobID, "running")
+			raw := `{"result":"half done","messages":[{"type":"tool_use","name":"Write","input":{"file_path":"a.go"}}]}`
+			if err := os.WriteFile(filepath.Join(dir, "raw.json"), []byte(raw), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			// The script touches ready ($0) once its trap is set.
+			ready := filepath.Join(t.TempDir(), "ready")
+			proc := exec.Command("sh", "-c", tt.script, ready)
+			proc.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+			if err := proc.Start(); err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan struct{})
+			go func() { _ = proc.Wait(); close(done) }()
+			t.Cleanup(func() { _ = syscall.Kill(-proc.Process.Pid, syscall.SIGKILL); <-done })
+			for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				if _, err := os.Stat(ready); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("mock process did not start")
+				}
+			}
+			makePidFile(t, dir, proc.Process.Pid)
+
+			var sent []os.Signal
+			signalFn := func(pid int, sig os.Signal) error {
+				sent = append(sent, sig)
+				return syscall.Kill(pid, sig.(syscall.Signal))
+			}
+			start := time.Now()
+			err := cmd.KillCmd(root, "", jobID, signalFn, func() { time.Sleep(cmd.KillPollInterval) }, &cmd.KillOptions{Grace: tt.grace})
+			if err != nil {
+				t.Fatalf("KillCmd error: %v", err)
+			}
+			if took := time.Since(start); tt.wantSignal == syscall.SIGTERM && took > 5*time.Second {
+				t.Errorf("KillCmd took %s for a process that exits on SIGTERM", took)
+			}
+			if sent[len(sent)-1] != tt.wantSignal {
+				t.Errorf("signals = %v, want the last to be %v", sent, tt.wantSignal)
+			}
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("process still running after KillCmd")
+			}
+
+			stderr, _ := os.ReadFile(filepath.Join(dir, "stderr.txt"))
+			if !strings.Contains(string(stderr), tt.wantNote) {
+				t.Errorf("stderr.txt = %q, want %q", stderr, tt.wantNote)
+			}
+			stdout, _ := os.ReadFile(filepath.Join(dir, "stdout.txt"))
+			changelog, _ := os.ReadFile(filepath.Join(dir, "changelog.txt"))
+			if string(stdout) != "half done" || !strings.Contains(string(changelog), "a.go") {
+				t.Errorf("raw.json not salvaged: stdout %q, changelog %q", stdout, changelog)
+			}
+			if got := readStatus(t, dir); got != "killed" {
+				t.Errorf("status = %q, want killed", got)
+			}
+		})
+	}
+}
+
+// Scenario: claude's own group gets the grace period and SIGKILL too, although the worker exits on SIGTERM
+func TestKillGraceCoversClaudeGroup(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-101500-8a8b8c8d"
+	dir := makeJob(t, root, jobID, "running")
+
+	// start runs script in a group of its own; it touches ready ($0) once
+	// its trap is set.
+	start := func(script string) (int, chan struct{}) {
+		t.Helper()
+		ready := filepath.Join(t.TempDir(), "ready")
+		proc := exec.Command("sh", "-c", script, ready)
+		proc.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if err := proc.Start(); err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() { _ = proc.Wait(); close(done) }()
+		t.Cleanup(func() { _ = syscall.Kill(-proc.Process.Pid, syscall.SIGKILL); <-done })
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(ready); err == nil {
+				return proc.Process.Pid, done
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("mock process did not start")
+			}
+		}
+	}
+	worker, _ := start(`touch "$0"; exec sleep 30`)
+	claudePID, claudeDone := start(`trap "" TERM; touch "$0"; exec sleep 30`)
+	makePidFile(t, dir, worker)
+	if err := job.UpdateManifest(dir, func(m *job.Manifest) { m.ClaudePID = claudePID }); err != nil {
+		t.Fatal(err)
+	}
+
+	killed := map[int]bool{}
+	signalFn := func(pid int, sig os.Signal) error {
+		if sig == syscall.SIGKILL {
+			killed[-pid] = true
+		}
+		return syscall.Kill(pid, sig.(syscall.Signal))
+	}
+	if err := cmd.KillCmd(root, "", jobID, signalFn, func() { time.Sleep(cmd.KillPollInterval) }, &cmd.KillOptions{Grace: 300 * time.Millisecond}); err != nil {
+		t.Fatalf("KillCmd error: %v", err)
+	}
+	if !killed[claudePID] || killed[worker] {
+		t.Errorf("SIGKILL sent to %v, want claude's group %d only", killed, claudePID)
+	}
+	select {
+	case <-claudeDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("claude still running after KillCmd")
+	}
+
+	stderr, _ := os.ReadFile(filepath.Join(dir, "stderr.txt"))
+	if !strings.Contains(string(stderr), "[GoLeM] Killed: SIGKILL after 300ms") || strings.Count(string(stderr), "[GoLeM]") != 1 {
+		t.Errorf("stderr.txt = %q, want one SIGKILL note", stderr)
+	}
+}
+
 // ---------- AC12: Kill updates status to killed ----------
 
 func TestKillUpdatesJobStatusToKilled(t *testing.T) {
@@ -621,6 +972,64 @@ func TestKillUpdatesJobStatusToKilled(t *testing.T) {
 	}
 }
 
+// Scenario: The job completes while kill is in flight; "done" is kept
+func TestKillRacingCompletionKeepsTerminalStatus(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-101501-f6a7b8c9"
+
+	dir := makeJob(t, root, jobID, "running")
+	makePidFile(t, dir, 51203)
+
+	// The completion writer wins while SIGTERM is being delivered.
+	completeOnSignal := func(_ int, _ os.Signal) error {
+		return job.TransitionStatus(dir, job.StatusDone)
+	}
+
+	if err := cmd.KillCmd(root, "", jobID, completeOnSignal, noopSleep); err != nil {
+		t.Fatalf("KillCmd should treat the rejected transition as benign, got: %v", err)
+	}
+	if got := readStatus(t, dir); got != "done" {
+		t.Errorf("terminal status was overwritten: got %q, want %q", got, "done")
+	}
+}
+
+// Scenario: Killing running jobs releases their slots exactly once
+func TestKillReleasesSlotOnce(t *testing.T) {
+	root := t.TempDir()
+	slots := slot.NewSlotManager(root, 3)
+	ids := []string{"job-20260227-101500-slot0001", "job-20260227-101500-slot0002"}
+	for i, id := range ids {
+		if err := slots.ClaimSlot(); err != nil {
+			t.Fatalf("ClaimSlot: %v", err)
+		}
+		makePidFile(t, makeJobInProject(t, root, "proj", id, "running"), 51203+i)
+	}
+
+	for _, id := range ids {
+		if err := cmd.KillCmd(root, "proj", id, errSignal, noopSleep); err != nil {
+			t.Fatalf("KillCmd %s: %v", id, err)
+		}
+	}
+	counter := func() string {
+		data, _ := os.ReadFile(filepath.Join(root, slot.CounterFile))
+		return string(data)
+	}
+	if got := counter(); got != "0" {
+		t.Fatalf("counter after killing both jobs = %q, want 0", got)
+	}
+
+	// A slot claimed by another job survives a second kill of the first one.
+	if err := slots.ClaimSlot(); err != nil {
+		t.Fatalf("ClaimSlot: %v", err)
+	}
+	if err := cmd.KillCmd(root, "proj", ids[0], errSignal, noopSleep); err == nil {
+		t.Error("second kill of the same job should fail: it is not running")
+	}
+	if got := counter(); got != "1" {
+		t.Errorf("counter after a double kill = %q, want 1", got)
+	}
+}
+
 // ---------- AC13: Kill error cases ----------
 
 func TestKillOnNonExistentJobReturnsNotFound(t *testing.T) {
@@ -630,8 +1039,8 @@ func TestKillOnNonExistentJobReturnsNotFound(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for non-existent job, got nil")
 	}
-	if err.Error() != "err:not_found" {
-		t.Errorf("expected exactly 'err:not_found', got: %q", err.Error())
+	if want := `err:not_found "Job not found: job-20260227-999999-deadbeef"`; err.Error() != want {
+		t.Errorf("expected exactly %q, got: %q", want, err.Error())
 	}
 }
 
@@ -710,17 +1119,26 @@ func TestKillRejectsNonRunningStatusKilled(t *testing.T) {
 	}
 }
 
-func TestKillRejectsNonRunningStatusQueued(t *testing.T) {
+// Scenario: Killing a queued job marks it killed without signalling anything
+func TestKillQueuedJobMarksKilledWithoutSignal(t *testing.T) {
 	root := t.TempDir()
 	jobID := "job-20260227-100000-queu0001"
-	makeJob(t, root, jobID, "queued")
+	dir := makeJob(t, root, jobID, "queued")
 
-	err := cmd.KillCmd(root, "", jobID, noopSignal, noopSleep)
-	if err == nil || !strings.Contains(err.Error(), "err:user") {
-		t.Errorf("queued: expected err:user, got: %v", err)
+	signalled := false
+	signalFn := func(_ int, _ os.Signal) error {
+		signalled = true
+		return nil
 	}
-	if !strings.Contains(err.Error(), "Job is not running") {
-		t.Errorf("queued: expected 'Job is not running', got: %q", err.Error())
+
+	if err := cmd.KillCmd(root, "", jobID, signalFn, noopSleep); err != nil {
+		t.Fatalf("KillCmd on queued job: %v", err)
+	}
+	if signalled {
+		t.Error("queued job has no process; expected no signal")
+	}
+	if got := readStatus(t, dir); got != "killed" {
+		t.Errorf("status = %q, want killed", got)
 	}
 }
 
@@ -739,6 +1157,134 @@ func TestKillReturnsExitCode0OnSuccess(t *testing.T) {
 	}
 }
 
+// ---------- Cross-project lookup ----------
+
+// Scenario: Jobs created under project A are reachable from project B
+func TestJobCommandsFindJobsInOtherProjects(t *testing.T) {
+	root := t.TempDir()
+	jobID := "job-20260227-101500-c0ffee01"
+
+	dir := makeJobInProject(t, root, "proj-a", jobID, "done")
+	if err := os.WriteFile(filepath.Join(dir, "stdout.txt"), []byte("hello from A"), 0o644); err != nil {
+		t.Fatalf("WriteFile stdout: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "changelog.txt"), []byte("EDIT main.go"), 0o644); err != nil {
+		t.Fatalf("WriteFile changelog: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := cmd.StatusCmd(jobID, root, "proj-b", &buf); err != nil {
+		t.Fatalf("StatusCmd error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "done") {
+		t.Errorf("status: expected 'done', got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := cmd.LogCmd(root, "proj-b", jobID, &buf); err != nil {
+		t.Fatalf("LogCmd error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "EDIT main.go") {
+		t.Errorf("log: expected changelog, got %q", buf.String())
+	}
+
+	for name, fn := range map[string]func(string, string, string, *bytes.Buffer) error{
+		"status --json": func(r, p, id string, w *bytes.Buffer) error { return cmd.StatusJSON(r, p, id, w) },
+		"result --json": func(r, p, id string, w *bytes.Buffer) error { return cmd.ResultJSON(r, p, id, w) },
+		"log --json":    func(r, p, id string, w *bytes.Buffer) error { return cmd.LogJSON(r, p, id, w) },
+	} {
+		buf.Reset()
+		if err := fn(root, "proj-b", jobID, &buf); err != nil {
+			t.Errorf("%s error: %v", name, err)
+		}
+		if !strings.Contains(buf.String(), jobID) {
+			t.Errorf("%s: expected job ID in output, got %q", name, buf.String())
+		}
+	}
+
+	var out, errOut bytes.Buffer
+	if _, err := cmd.ResultCmd(jobID, root, "proj-b", &out, &errOut, &cmd.ResultOptions{Keep: true}); err != nil {
+		t.Fatalf("ResultCmd error: %v", err)
+	}
+	if !strings.Contains(out.String(), "hello from A") {
+		t.Errorf("result: expected stdout from project A, got %q", out.String())
+	}
+
+	runningID := "job-20260227-101500-c0ffee02"
+	runningDir := makeJobInProject(t, root, "proj-a", runningID, "running")
+	makePidFile(t, runningDir, 51203)
+	if err := cmd.KillCmd(root, "proj-b", runningID, noopSignal, noopSleep); err != nil {
+		t.Fatalf("KillCmd error: %v", err)
+	}
+	if got := readStatus(t, runningDir); got != "killed" {
+		t.Errorf("kill: expected status 'killed', got %q", got)
+	}
+}
+
+// ---------- Job ID validation and prefix matching ----------
+
+// Scenario: A non-ID argument is an err:user, not a not_found
+func TestJobCommandsRejectMalformedJobID(t *testing.T) {
+	root := t.TempDir()
+	makeJobInProject(t, root, "proj-a", "job-20260227-101500-c0ffee03", "done")
+
+	var buf bytes.Buffer
+	result, err := cmd.StatusCmd("running", root, "proj-a", &buf)
+	if err == nil || !strings.HasPrefix(err.Error(), `err:user "Invalid job ID format: running`) {
+		t.Fatalf("StatusCmd error = %v, want invalid format", err)
+	}
+	if result.ExitCode != 1 {
+		t.Errorf("ExitCode: got %d, want 1", result.ExitCode)
+	}
+
+	for name, call := range map[string]func() error{
+		"result": func() error {
+			_, err := cmd.ResultCmd("running", root, "proj-a", &buf, &buf)
+			return err
+		},
+		"log":         func() error { return cmd.LogCmd(root, "proj-a", "running", &buf) },
+		"kill":        func() error { return cmd.KillCmd(root, "proj-a", "running", noopSignal, noopSleep) },
+		"status json": func() error { return cmd.StatusJSON(root, "proj-a", "running", &buf) },
+		"result json": func() error { return cmd.ResultJSON(root, "proj-a", "running", &buf) },
+		"log json":    func() error { return cmd.LogJSON(root, "proj-a", "running", &buf) },
+	} {
+		if err := call(); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+			t.Errorf("%s: error = %v, want err:user", name, err)
+		}
+	}
+}
+
+// Scenario: A unique suffix or timestamp resolves; an ambiguous one lists candidates
+func TestJobCommandsResolveJobIDPrefix(t *testing.T) {
+	root := t.TempDir()
+	makeJobInProject(t, root, "proj-a", "job-20260227-101500-c0ffee04", "done")
+	makeJobInProject(t, root, "proj-b", "job-20260227-101500-c0ffee05", "failed")
+
+	var buf bytes.Buffer
+	result, err := cmd.StatusCmd("c0ffee04", root, "proj-b", &buf)
+	if err != nil {
+		t.Fatalf("StatusCmd(c0ffee04): %v", err)
+	}
+	if result.Status != "done" {
+		t.Errorf("Status: got %q, want done", result.Status)
+	}
+
+	buf.Reset()
+	if err := cmd.StatusJSON(root, "proj-b", "c0ffee05", &buf); err != nil {
+		t.Fatalf("StatusJSON(c0ffee05): %v", err)
+	}
+	if !strings.Contains(buf.String(), `"id": "job-20260227-101500-c0ffee05"`) {
+		t.Errorf("StatusJSON should report the full ID, got %q", buf.String())
+	}
+
+	_, err = cmd.StatusCmd("20260227-101500", root, "proj-a", &buf)
+	if err == nil || !strings.Contains(err.Error(), "ambiguous") ||
+		!strings.Contains(err.Error(), "job-20260227-101500-c0ffee04") ||
+		!strings.Contains(err.Error(), "job-20260227-101500-c0ffee05") {
+		t.Errorf("expected ambiguity error listing both jobs, got %v", err)
+	}
+}
+
 // ---------- Edge Cases ----------
 
 func TestKillOnJobWhoseProcessAlreadyDied(t *testing.T) {
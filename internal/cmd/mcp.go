@@ -0,0 +1,454 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// mcpProtocolVersion is the newest Model Context Protocol revision glm mcp
+// speaks. A client asking for another supported revision gets that one.
+const mcpProtocolVersion = "2025-06-18"
+
+// mcpProtocolVersions are the revisions glm mcp accepts in initialize.
+var mcpProtocolVersions = map[string]bool{
+	"2024-11-05": true,
+	"2025-03-26": true,
+	"2025-06-18": true,
+}
+
+// JSON-RPC error codes glm mcp replies with.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// MCPOptions configures MCPCmd.
+type MCPOptions struct {
+	// ServeOptions supplies the subagents root, project, Submit, Kill and
+	// poll interval, as for glm serve. Token and Doctor are unused: the
+	// stdio transport only reaches the client that started glm mcp.
+	ServeOptions
+	// Version is reported as serverInfo.version.
+	Version string
+}
+
+// rpcRequest is a JSON-RPC 2.0 request, or a notification when ID is nil.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response carrying either Result or Error.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpContent is one text block of a tool result.
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of tools/call. A failing tool is a result with
+// IsError set, so the model sees the err:<category> message and can react.
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// mcpTool is one tool of glm mcp. call writes the tool's JSON output to w.
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+
+	call func(ctx context.Context, args json.RawMessage, w io.Writer) error
+}
+
+// mcpJobArgs are the arguments of the tools that act on one job.
+type mcpJobArgs struct {
+	JobID string `json:"job_id" desc:"Job ID or a unique part of it"`
+}
+
+// mcpListArgs are the arguments of glm_list, the filters of glm list.
+type mcpListArgs struct {
+	Status  string `json:"status,omitempty" desc:"Comma-separated statuses to keep, e.g. running,done"`
+	Since   string `json:"since,omitempty" desc:"Only jobs started within a duration (2h, 3d) or since a date (2026-02-27)"`
+	Project string `json:"project,omitempty" desc:"Only jobs whose project ID starts with this prefix"`
+}
+
+// mcpServer holds the state of one MCPCmd session.
+type mcpServer struct {
+	opts  MCPOptions
+	tools []mcpTool
+
+	outMu sync.Mutex
+	enc   *json.Encoder
+
+	callsMu sync.Mutex
+	calls   map[string]context.CancelFunc
+}
+
+// MCPCmd serves the Model Context Protocol over stdio: newline-delimited
+// JSON-RPC 2.0 messages read from in, with responses written to out. It
+// exposes glm_run, glm_start, glm_status, glm_result, glm_list and glm_kill
+// (see mcpTools), each backed by the same functions as the CLI and glm serve.
+//
+// Tool calls run concurrently, so a glm_run waiting for its job does not
+// block glm_status; jobs still start only when Submit finds a free slot. A
+// failing tool is reported in its result and a bad message as a JSON-RPC
+// error; neither stops the server. MCPCmd returns when in reaches EOF, after
+// cancelling the calls still in flight (their jobs keep running).
+func MCPCmd(in io.Reader, out io.Writer, opts MCPOptions) error {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	s := &mcpServer{opts: opts, enc: json.NewEncoder(out), calls: map[string]context.CancelFunc{}}
+	s.tools = s.mcpTools()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64<<10), maxSubmitBodyBytes)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.reply(nil, nil, &rpcError{rpcParseError, "Parse error: " + err.Error()})
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			s.reply(req.ID, nil, &rpcError{rpcInvalidRequest, "Invalid request"})
+			continue
+		}
+		if req.Method == "tools/call" && req.ID != nil {
+			callCtx, cancelCall := context.WithCancel(ctx)
+			s.track(req.ID, cancelCall)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer s.untrack(req.ID)
+				s.handle(callCtx, req)
+			}()
+			continue
+		}
+		s.handle(ctx, req)
+	}
+	cancel()
+	wg.Wait()
+	if err := sc.Err(); err != nil {
+		return errs.Internal(`"Cannot read MCP request: %s"`, err.Error())
+	}
+	return nil
+}
+
+// handle answers one request. Notifications get no response.
+func (s *mcpServer) handle(ctx context.Context, req rpcRequest) {
+	var (
+		result any
+		rpcErr *rpcError
+	)
+	switch req.Method {
+	case "initialize":
+		result = s.initialize(req.Params)
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result = map[string]any{"tools": s.tools}
+	case "tools/call":
+		result, rpcErr = s.callTool(ctx, req.Params)
+	case "notifications/cancelled":
+		var p struct {
+			RequestID json.RawMessage `json:"requestId"`
+		}
+		if json.Unmarshal(req.Params, &p) == nil {
+			s.cancelCall(p.RequestID)
+		}
+	default:
+		rpcErr = &rpcError{rpcMethodNotFound, "Method not found: " + req.Method}
+	}
+	if req.ID == nil {
+		return
+	}
+	s.reply(req.ID, result, rpcErr)
+}
+
+// initialize returns the server's capabilities, agreeing to the client's
+// protocol revision when glm supports it.
+func (s *mcpServer) initialize(params json.RawMessage) any {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	_ = json.Unmarshal(params, &p)
+	version := mcpProtocolVersion
+	if mcpProtocolVersions[p.ProtocolVersion] {
+		version = p.ProtocolVersion
+	}
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities":    map[string]any{"tools": map[string]any{}},
+		"serverInfo":      map[string]string{"name": "glm", "version": s.opts.Version},
+	}
+}
+
+// callTool runs the tool named in params. An unknown tool or malformed
+// params is a JSON-RPC error; everything the tool itself rejects is an
+// IsError result.
+func (s *mcpServer) callTool(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{rpcInvalidParams, "Invalid params: " + err.Error()}
+	}
+	i := slices.IndexFunc(s.tools, func(t mcpTool) bool { return t.Name == p.Name })
+	if i < 0 {
+		return nil, &rpcError{rpcInvalidParams, "Unknown tool: " + p.Name}
+	}
+
+	var buf bytes.Buffer
+	if err := s.tools[i].call(ctx, p.Arguments, &buf); err != nil {
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: buf.String()}}}, nil
+}
+
+// reply writes one response line. Writes are serialized across calls.
+func (s *mcpServer) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	_ = s.enc.Encode(rpcResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr})
+}
+
+// track, untrack and cancelCall keep the cancel functions of in-flight
+// tools/call requests, keyed by request ID, for notifications/cancelled.
+func (s *mcpServer) track(id json.RawMessage, cancel context.CancelFunc) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	s.calls[string(id)] = cancel
+}
+
+func (s *mcpServer) untrack(id json.RawMessage) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if cancel, ok := s.calls[string(id)]; ok {
+		cancel()
+		delete(s.calls, string(id))
+	}
+}
+
+func (s *mcpServer) cancelCall(id json.RawMessage) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if cancel, ok := s.calls[string(id)]; ok {
+		cancel()
+	}
+}
+
+// mcpTools returns the tools of glm mcp. Their input schemas are derived
+// from the argument structs with inputSchema.
+func (s *mcpServer) mcpTools() []mcpTool {
+	root, project := s.opts.SubagentsRoot, s.opts.ProjectID
+	submitSchema := inputSchema(SubmitRequest{}, "async")
+	jobSchema := inputSchema(mcpJobArgs{})
+
+	return []mcpTool{
+		{
+			Name:        "glm_run",
+			Description: "Run a glm agent on a task and wait for it. Returns the job's stdout, stderr and the list of changed files.",
+			InputSchema: submitSchema,
+			call: func(ctx context.Context, args json.RawMessage, w io.Writer) error {
+				j, err := s.submit(args)
+				if err != nil {
+					return err
+				}
+				if err := waitForJob(ctx, j.Dir, s.opts.PollInterval); err != nil {
+					return errs.User(`"Stopped waiting for %s; the job keeps running"`, j.ID)
+				}
+				return ResultJSON(root, j.ProjectID, j.ID, w)
+			},
+		},
+		{
+			Name:        "glm_start",
+			Description: "Start a glm agent on a task in the background. Returns the job ID and status; poll with glm_status and collect with glm_result.",
+			InputSchema: submitSchema,
+			call: func(ctx context.Context, args json.RawMessage, w io.Writer) error {
+				j, err := s.submit(args)
+				if err != nil {
+					return err
+				}
+				return JSONOutput(w, jobStatusJSON(j.ID, j.Dir, string(job.ReadStatus(j.Dir))))
+			},
+		},
+		{
+			Name:        "glm_status",
+			Description: "Report a job's status: queued, running, done, failed, timeout or killed.",
+			InputSchema: jobSchema,
+			call: func(ctx context.Context, args json.RawMessage, w io.Writer) error {
+				var a mcpJobArgs
+				if err := decodeToolArgs(args, &a); err != nil {
+					return err
+				}
+				return StatusJSON(root, project, a.JobID, w)
+			},
+		},
+		{
+			Name:        "glm_result",
+			Description: "Return a finished job's stdout, stderr and changed files. The job is kept.",
+			InputSchema: jobSchema,
+			call: func(ctx context.Context, args json.RawMessage, w io.Writer) error {
+				var a mcpJobArgs
+				if err := decodeToolArgs(args, &a); err != nil {
+					return err
+				}
+				return ResultJSON(root, project, a.JobID, w)
+			},
+		},
+		{
+			Name:        "glm_list",
+			Description: "List jobs, newest first, optionally filtered by status, age and project.",
+			InputSchema: inputSchema(mcpListArgs{}),
+			call: func(ctx context.Context, args json.RawMessage, w io.Writer) error {
+				var a mcpListArgs
+				if err := decodeToolArgs(args, &a); err != nil {
+					return err
+				}
+				filter, err := listFilter(a.Status, a.Since, a.Project, s.opts.Now)
+				if err != nil {
+					return err
+				}
+				return ListJSON(root, filter, w)
+			},
+		},
+		{
+			Name:        "glm_kill",
+			Description: "Stop a queued or running job. Returns its status afterwards.",
+			InputSchema: jobSchema,
+			call: func(ctx context.Context, args json.RawMessage, w io.Writer) error {
+				var a mcpJobArgs
+				if err := decodeToolArgs(args, &a); err != nil {
+					return err
+				}
+				if s.opts.Kill == nil {
+					return errs.Internal(`"Killing jobs is not available"`)
+				}
+				if err := s.opts.Kill(a.JobID); err != nil {
+					return err
+				}
+				return StatusJSON(root, project, a.JobID, w)
+			},
+		},
+	}
+}
+
+// submit decodes the arguments of glm_run and glm_start and queues the job
+// through Submit, with the same checks as POST /jobs.
+func (s *mcpServer) submit(args json.RawMessage) (*job.Job, error) {
+	var req SubmitRequest
+	if err := decodeToolArgs(args, &req); err != nil {
+		return nil, err
+	}
+	f, err := req.flags()
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.Submit == nil {
+		return nil, errs.Internal(`"Job submission is not available"`)
+	}
+	return s.opts.Submit(f)
+}
+
+// decodeToolArgs decodes tool arguments into v, rejecting unknown fields.
+// Missing arguments decode as an empty object.
+func decodeToolArgs(args json.RawMessage, v any) error {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errs.User(`"Invalid arguments: %s"`, err.Error())
+	}
+	return nil
+}
+
+// inputSchema derives a JSON Schema object from the json and desc tags of the
+// struct v. Fields without omitempty are required; fields named in omit are
+// left out.
+func inputSchema(v any, omit ...string) map[string]any {
+	t := reflect.TypeOf(v)
+	props := map[string]any{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, tagOpts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || slices.Contains(omit, name) {
+			continue
+		}
+		prop := map[string]any{"type": schemaType(field.Type.Kind())}
+		if d := field.Tag.Get("desc"); d != "" {
+			prop["description"] = d
+		}
+		props[name] = prop
+		if !strings.Contains(tagOpts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaType maps a Go kind to its JSON Schema type.
+func schemaType(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
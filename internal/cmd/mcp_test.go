@@ -0,0 +1,184 @@
+package cmd_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// mcpResponse is a JSON-RPC response as a client sees it.
+type mcpResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// mcpSession runs MCPCmd over a pair of pipes. send writes one raw line and
+// recv reads the next response.
+type mcpSession struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *bufio.Scanner
+	done chan error
+}
+
+func newMCPSession(t *testing.T, opts cmd.MCPOptions) *mcpSession {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	s := &mcpSession{t: t, in: inW, out: bufio.NewScanner(outR), done: make(chan error, 1)}
+	go func() {
+		s.done <- cmd.MCPCmd(inR, outW, opts)
+		outW.Close()
+	}()
+	t.Cleanup(func() { inW.Close() })
+	return s
+}
+
+func (s *mcpSession) send(line string) {
+	s.t.Helper()
+	if _, err := io.WriteString(s.in, line+"\n"); err != nil {
+		s.t.Fatalf("send %s: %v", line, err)
+	}
+}
+
+func (s *mcpSession) recv() mcpResponse {
+	s.t.Helper()
+	if !s.out.Scan() {
+		s.t.Fatalf("no response: %v", s.out.Err())
+	}
+	var resp mcpResponse
+	if err := json.Unmarshal(s.out.Bytes(), &resp); err != nil {
+		s.t.Fatalf("response %q is not JSON: %v", s.out.Text(), err)
+	}
+	return resp
+}
+
+// call sends a tools/call request and returns the tool's text and isError.
+func (s *mcpSession) call(id int, tool, args string) (string, bool) {
+	s.t.Helper()
+	s.send(`{"jsonrpc":"2.0","id":` + strconv.Itoa(id) + `,"method":"tools/call","params":{"name":"` + tool + `","arguments":` + args + `}}`)
+	resp := s.recv()
+	if resp.Error != nil {
+		s.t.Fatalf("%s: JSON-RPC error %+v", tool, resp.Error)
+	}
+	var result struct {
+		Content []struct{ Text string } `json:"content"`
+		IsError bool                    `json:"isError"`
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil || len(result.Content) != 1 {
+		s.t.Fatalf("%s: result %s", tool, resp.Result)
+	}
+	return result.Content[0].Text, result.IsError
+}
+
+// Scenario: initialize agrees on the protocol and tools/list describes the six tools
+func TestMCPInitializeAndListTools(t *testing.T) {
+	s := newMCPSession(t, cmd.MCPOptions{ServeOptions: cmd.ServeOptions{SubagentsRoot: t.TempDir()}, Version: "1.2.3"})
+
+	s.send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"0"}}}`)
+	var init struct {
+		ProtocolVersion string            `json:"protocolVersion"`
+		ServerInfo      map[string]string `json:"serverInfo"`
+		Capabilities    map[string]any    `json:"capabilities"`
+	}
+	if err := json.Unmarshal(s.recv().Result, &init); err != nil {
+		t.Fatal(err)
+	}
+	if init.ProtocolVersion != "2025-03-26" || init.ServerInfo["name"] != "glm" || init.ServerInfo["version"] != "1.2.3" || init.Capabilities["tools"] == nil {
+		t.Errorf("initialize = %+v", init)
+	}
+	// The initialized notification gets no response; the next line answers the ping.
+	s.send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	s.send(`{"jsonrpc":"2.0","id":"p","method":"ping"}`)
+	if resp := s.recv(); string(resp.ID) != `"p"` || resp.Error != nil {
+		t.Errorf("ping = %+v", resp)
+	}
+
+	s.send(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	var list struct {
+		Tools []struct {
+			Name        string `json:"name"`
+			InputSchema struct {
+				Properties map[string]struct {
+					Type string `json:"type"`
+				} `json:"properties"`
+				Required []string `json:"required"`
+			} `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(s.recv().Result, &list); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+		if tool.Name == "glm_run" {
+			props := tool.InputSchema.Properties
+			if props["timeout"].Type != "integer" || props["prompt"].Type != "string" || strings.Join(tool.InputSchema.Required, ",") != "prompt,dir" {
+				t.Errorf("glm_run schema = %+v", tool.InputSchema)
+			}
+			if _, ok := props["async"]; ok {
+				t.Errorf("glm_run schema has async: %+v", props)
+			}
+		}
+	}
+	if got := strings.Join(names, ","); got != "glm_run,glm_start,glm_status,glm_result,glm_list,glm_kill" {
+		t.Errorf("tools = %s", got)
+	}
+}
+
+// Scenario: Bad messages and failing tools are reported without stopping the server
+func TestMCPErrorsDoNotStopServer(t *testing.T) {
+	root := t.TempDir()
+	makeJobDir(t, root, "myapp-12345", "job-20260227-143205-a8f3b1c2", "done")
+	s := newMCPSession(t, cmd.MCPOptions{ServeOptions: cmd.ServeOptions{SubagentsRoot: root, ProjectID: "myapp-12345"}})
+
+	s.send(`{not json`)
+	if resp := s.recv(); resp.Error == nil || resp.Error.Code != -32700 || string(resp.ID) != "null" {
+		t.Errorf("garbage = %+v, want parse error with null id", resp)
+	}
+	s.send(`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`)
+	if resp := s.recv(); resp.Error == nil || resp.Error.Code != -32601 {
+		t.Errorf("unknown method = %+v, want -32601", resp)
+	}
+	s.send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"glm_nope","arguments":{}}}`)
+	if resp := s.recv(); resp.Error == nil || resp.Error.Code != -32602 {
+		t.Errorf("unknown tool = %+v, want -32602", resp)
+	}
+
+	if text, isErr := s.call(3, "glm_status", `{"job_id":"job-20260227-143205-deadbeef"}`); !isErr || !strings.HasPrefix(text, "err:not_found") {
+		t.Errorf("glm_status on a missing job = %q (isError %v)", text, isErr)
+	}
+	if text, isErr := s.call(4, "glm_start", `{"prompt":"x","dir":"relative"}`); !isErr || !strings.HasPrefix(text, "err:user") {
+		t.Errorf("glm_start with a relative dir = %q (isError %v)", text, isErr)
+	}
+	if text, isErr := s.call(5, "glm_list", `{"status":"done","colour":"red"}`); !isErr || !strings.Contains(text, "colour") {
+		t.Errorf("glm_list with an unknown argument = %q (isError %v)", text, isErr)
+	}
+
+	text, isErr := s.call(6, "glm_status", `{"job_id":"a8f3b1c2"}`)
+	var st cmd.JobStatusJSON
+	if err := json.Unmarshal([]byte(text), &st); err != nil || isErr || st.Status != "done" {
+		t.Errorf("glm_status = %q (isError %v)", text, isErr)
+	}
+
+	s.in.Close()
+	select {
+	case err := <-s.done:
+		if err != nil {
+			t.Errorf("MCPCmd = %v, want nil at EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("MCPCmd did not return at EOF")
+	}
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// MergeOptions holds optional MergeCmd settings.
+type MergeOptions struct {
+	// JSON writes a JSON array of the jobs' JobResultJSON instead of the
+	// combined text document.
+	JSON bool
+	// Wait blocks until every job has finished instead of skipping the ones
+	// that are still queued or running.
+	Wait bool
+	// PollInterval is how often Wait checks the job statuses (default 500ms).
+	PollInterval time.Duration
+	// Context ends Wait when it is done, e.g. on Ctrl-C; the jobs that have
+	// not finished by then are skipped. Nil waits until they all finish.
+	Context context.Context
+	// Keep skips the auto-delete of the merged jobs.
+	Keep bool
+	// RetentionDays prunes retained finished jobs older than this many days
+	// when Keep is set (see FinishJob).
+	RetentionDays int
+}
+
+// MergeResult holds the outcome of a MergeCmd call.
+type MergeResult struct {
+	// Merged are the IDs of the jobs whose results were written, in
+	// argument order.
+	Merged []string
+	// Skipped are the IDs of the jobs left out because they had not
+	// finished.
+	Skipped []string
+	// ExitCode is the largest of the merged jobs' exit codes (see
+	// AttachResult.ExitCode), 1 when a job was skipped, and 1 or 3 for an
+	// error.
+	ExitCode int
+}
+
+// mergeJob is one job of a merge.
+type mergeJob struct {
+	id, dir string
+}
+
+// MergeCmd writes the results of several finished jobs as one document, in
+// the order of jobIDs whatever order they finished in:
+//   - Each job's stdout.txt follows a header line
+//     "=== <id> (<status>, <duration>) — <prompt preview> ===", and the jobs'
+//     changelogs follow together under "=== changelog ===". The stderr.txt of
+//     a job that did not end done goes to stderr under the same header.
+//   - With MergeOptions.JSON it writes a JSON array of JobResultJSON instead.
+//   - Jobs still queued or running are skipped with a warning on stderr, or
+//     waited for with MergeOptions.Wait until MergeOptions.Context is done.
+//   - Once the document is written the merged job directories are deleted
+//     (or kept, per MergeOptions.Keep and the retention policy). Skipped jobs
+//     stay, and so do all jobs when the document could not be written.
+//   - Returns err:user (exit 1) for no job IDs or a malformed or ambiguous
+//     one, and err:not_found (exit 3) for a job that does not exist, before
+//     anything is written.
+func MergeCmd(jobIDs []string, subagentsRoot, currentProjectID string, stdout, stderr io.Writer, opts ...*MergeOptions) (*MergeResult, error) {
+	o := &MergeOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	interval := o.PollInterval
+	if interval <= 0 {
+		interval = defaultAttachPollInterval
+	}
+	if len(jobIDs) == 0 {
+		return &MergeResult{ExitCode: 1}, errs.User(`"No job ID provided"`)
+	}
+
+	var jobs []mergeJob
+	seen := map[string]bool{}
+	for _, arg := range jobIDs {
+		id, err := job.ResolveJobID(subagentsRoot, arg)
+		if err != nil {
+			return &MergeResult{ExitCode: errs.ExitCode(err)}, err
+		}
+		dir, err := job.FindJobDir(subagentsRoot, currentProjectID, id)
+		if err != nil {
+			err = errs.NotFound(`"Job not found: %s"`, id)
+			return &MergeResult{ExitCode: errs.ExitCode(err)}, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			jobs = append(jobs, mergeJob{id: id, dir: dir})
+		}
+	}
+
+	if o.Wait {
+		ctx := o.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+	wait:
+		for _, j := range jobs {
+			for status, _ := job.CheckJobPID(j.dir); !terminalStatuses[status]; status, _ = job.CheckJobPID(j.dir) {
+				select {
+				case <-ctx.Done():
+					break wait
+				case <-time.After(interval):
+				}
+			}
+		}
+	}
+	hint := " (use --wait)"
+	if o.Wait {
+		hint = ""
+	}
+
+	res := &MergeResult{}
+	var results []JobResultJSON
+	var merged []mergeJob
+	for _, j := range jobs {
+		r, err := JobResult(subagentsRoot, currentProjectID, j.id)
+		if err != nil {
+			return &MergeResult{ExitCode: errs.ExitCode(err)}, err
+		}
+		if !terminalStatuses[r.Status] {
+			fmt.Fprintf(stderr, "glm: skipping %s: job is still %s%s\n", j.id, r.Status, hint)
+			res.Skipped = append(res.Skipped, j.id)
+			res.ExitCode = max(res.ExitCode, 1)
+			continue
+		}
+		results = append(results, r)
+		merged = append(merged, j)
+		res.ExitCode = max(res.ExitCode, jobExitCode(j.dir, r.Status))
+	}
+
+	var doc bytes.Buffer
+	if o.JSON {
+		if results == nil {
+			results = []JobResultJSON{}
+		}
+		if err := JSONOutput(&doc, results); err != nil {
+			return &MergeResult{ExitCode: 1}, err
+		}
+	} else {
+		var changelog strings.Builder
+		for _, r := range results {
+			header := mergeHeader(r)
+			doc.WriteString(header + "\n")
+			doc.WriteString(withNewline(r.Stdout))
+			changelog.WriteString(withNewline(r.Changelog))
+			if isFailureStatus(r.Status) && r.Stderr != "" {
+				fmt.Fprintf(stderr, "%s\n%s", header, withNewline(r.Stderr))
+			}
+		}
+		if changelog.Len() > 0 {
+			doc.WriteString("=== changelog ===\n" + changelog.String())
+		}
+	}
+	if _, err := stdout.Write(doc.Bytes()); err != nil {
+		return &MergeResult{ExitCode: 1}, err
+	}
+
+	for _, j := range merged {
+		FinishJob(j.dir, subagentsRoot, o.Keep, o.RetentionDays)
+		res.Merged = append(res.Merged, j.id)
+	}
+	return res, nil
+}
+
+// mergeHeader returns the line MergeCmd prints above a job's stdout.
+func mergeHeader(r JobResultJSON) string {
+	state := r.Status
+	if r.DurationSeconds != nil {
+		state += ", " + formatSeconds(*r.DurationSeconds)
+	}
+	header := fmt.Sprintf("=== %s (%s)", r.ID, state)
+	if preview := job.PromptPreview(r.Prompt); preview != "" {
+		header += " — " + preview
+	}
+	return header + " ==="
+}
+
+// withNewline returns s ending in a newline, or "" for an empty s.
+func withNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
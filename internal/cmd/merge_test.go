@@ -0,0 +1,179 @@
+package cmd_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// makeMergeJobs creates a done, a failed and a running job in root and
+// returns their directories. The failed job started last but finished first.
+func makeMergeJobs(t *testing.T, root string) (done, failed, running string) {
+	t.Helper()
+	done = makeJobDir(t, root, "proj", "job-20260101-000000-aaaaaaaa", "done")
+	writeJobFile(t, done, "started_at.txt", "2026-01-01T00:00:00Z")
+	writeJobFile(t, done, "finished_at.txt", "2026-01-01T00:01:23Z")
+	writeJobFile(t, done, "stdout.txt", "first answer")
+	writeJobFile(t, done, "changelog.txt", "EDIT a.go\n")
+	failed = makeJobDir(t, root, "proj", "job-20260101-000010-bbbbbbbb", "failed")
+	writeJobFile(t, failed, "started_at.txt", "2026-01-01T00:00:10Z")
+	writeJobFile(t, failed, "finished_at.txt", "2026-01-01T00:00:15Z")
+	writeJobFile(t, failed, "stdout.txt", "second answer\n")
+	writeJobFile(t, failed, "stderr.txt", "boom\n")
+	writeJobFile(t, failed, "changelog.txt", "WRITE b.go\n")
+	running = makeJobDir(t, root, "proj", "job-20260101-000020-cccccccc", "running")
+	writePID(t, running, selfPID())
+	for dir, prompt := range map[string]string{done: "fix  the\nbug", failed: "add tests", running: "slow"} {
+		if err := job.UpdateManifest(dir, func(m *job.Manifest) { m.Prompt = prompt }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code := 2
+	if err := job.UpdateManifest(failed, func(m *job.Manifest) { m.ExitCode = &code }); err != nil {
+		t.Fatal(err)
+	}
+	return done, failed, running
+}
+
+// Scenario: glm result --merge prints the finished jobs in argument order with headers and one changelog section, skips a running job with a warning, deletes only the merged jobs and exits with the worst exit code
+func TestMergeResults(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	done, failed, running := makeMergeJobs(t, root)
+
+	var stdout, stderr bytes.Buffer
+	ids := []string{"job-20260101-000010-bbbbbbbb", "job-20260101-000020-cccccccc", "job-20260101-000000-aaaaaaaa"}
+	res, err := cmd.MergeCmd(ids, root, "proj", &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "=== job-20260101-000010-bbbbbbbb (failed, 5s) — add tests ===\n" +
+		"second answer\n" +
+		"=== job-20260101-000000-aaaaaaaa (done, 1m23s) — fix the bug ===\n" +
+		"first answer\n" +
+		"=== changelog ===\n" +
+		"WRITE b.go\n" +
+		"EDIT a.go\n"
+	if stdout.String() != want {
+		t.Errorf("stdout =\n%s\nwant\n%s", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "skipping job-20260101-000020-cccccccc: job is still running") ||
+		!strings.Contains(stderr.String(), "add tests ===\nboom\n") {
+		t.Errorf("stderr = %q, want the skip warning and the failed job's stderr", stderr.String())
+	}
+	if res.ExitCode != 2 {
+		t.Errorf("ExitCode = %d, want 2 (the failed job's)", res.ExitCode)
+	}
+	if len(res.Merged) != 2 || len(res.Skipped) != 1 {
+		t.Errorf("Merged = %v, Skipped = %v", res.Merged, res.Skipped)
+	}
+	for _, dir := range []string{done, failed} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s not deleted", filepath.Base(dir))
+		}
+	}
+	if _, err := os.Stat(running); err != nil {
+		t.Errorf("skipped job deleted: %v", err)
+	}
+}
+
+// Scenario: glm result --merge --json writes a JSON array in argument order, and --keep leaves every job in place
+func TestMergeResultsJSON(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	done, failed, _ := makeMergeJobs(t, root)
+
+	var stdout bytes.Buffer
+	ids := []string{"job-20260101-000000-aaaaaaaa", "job-20260101-000010-bbbbbbbb"}
+	res, err := cmd.MergeCmd(ids, root, "proj", &stdout, &bytes.Buffer{}, &cmd.MergeOptions{JSON: true, Keep: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []cmd.JobResultJSON
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, stdout.String())
+	}
+	if len(results) != 2 || results[0].ID != ids[0] || results[1].ID != ids[1] || results[1].Stderr != "boom\n" {
+		t.Errorf("results = %+v, want both jobs in argument order", results)
+	}
+	if res.ExitCode != 2 {
+		t.Errorf("ExitCode = %d, want 2", res.ExitCode)
+	}
+	for _, dir := range []string{done, failed} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("--keep deleted %s", filepath.Base(dir))
+		}
+	}
+}
+
+// Scenario: glm result --merge --wait blocks until a running job finishes and then merges it; an unknown job is err:not_found before anything is printed
+func TestMergeResultsWait(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	_, _, running := makeMergeJobs(t, root)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.WriteFile(filepath.Join(running, "stdout.txt"), []byte("slow answer"), 0o644)
+		_ = job.WriteStatus(running, job.StatusDone)
+	}()
+	var stdout bytes.Buffer
+	res, err := cmd.MergeCmd([]string{"job-20260101-000020-cccccccc"}, root, "proj", &stdout, &bytes.Buffer{},
+		&cmd.MergeOptions{Wait: true, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stdout.String(), "=== job-20260101-000020-cccccccc (done") || !strings.Contains(stdout.String(), "slow answer\n") {
+		t.Errorf("stdout = %q, want the waited-for job", stdout.String())
+	}
+	if res.ExitCode != 0 || len(res.Skipped) != 0 {
+		t.Errorf("ExitCode = %d, Skipped = %v", res.ExitCode, res.Skipped)
+	}
+
+	stdout.Reset()
+	res, err = cmd.MergeCmd([]string{"job-20260101-000000-aaaaaaaa", "job-20260101-000099-dddddddd"}, root, "proj", &stdout, &bytes.Buffer{})
+	if err == nil || !strings.HasPrefix(err.Error(), "err:not_found") || res.ExitCode != 3 || stdout.Len() != 0 {
+		t.Errorf("MergeCmd with an unknown job = %v (exit %d), stdout %q", err, res.ExitCode, stdout.String())
+	}
+}
+
+// Scenario: glm result --merge --wait stops waiting when its context is done, e.g. on Ctrl-C, and skips a job that is still queued
+func TestMergeResultsWaitCancelled(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	done, _, _ := makeMergeJobs(t, root)
+	makeJobDir(t, root, "proj", "job-20260101-000030-eeeeeeee", "queued")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	finished := make(chan struct{})
+	var res *cmd.MergeResult
+	var err error
+	go func() {
+		defer close(finished)
+		res, err = cmd.MergeCmd([]string{filepath.Base(done), "job-20260101-000030-eeeeeeee"}, root, "proj", &stdout, &stderr,
+			&cmd.MergeOptions{Wait: true, PollInterval: 10 * time.Millisecond, Context: ctx})
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("MergeCmd --wait did not return after its context was done")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Skipped) != 1 || res.Skipped[0] != "job-20260101-000030-eeeeeeee" || res.ExitCode != 1 {
+		t.Errorf("ExitCode = %d, Skipped = %v, want the queued job skipped", res.ExitCode, res.Skipped)
+	}
+	if !strings.Contains(stderr.String(), "skipping job-20260101-000030-eeeeeeee: job is still queued") {
+		t.Errorf("stderr = %q, want a skip warning", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "first answer") {
+		t.Errorf("stdout = %q, want the finished job merged", stdout.String())
+	}
+}
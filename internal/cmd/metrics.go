@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
+)
+
+// MetricsFile is the metrics log in the config dir that finished jobs are
+// appended to when metrics_enabled is set.
+const MetricsFile = "metrics.jsonl"
+
+// MetricsMaxBytes caps metrics.jsonl. An append that takes the file past it
+// drops the oldest lines until three quarters of the cap are left.
+const MetricsMaxBytes = 4 << 20
+
+// MetricsEntry is one line of metrics.jsonl: a finished job without its
+// prompt, paths or IDs. Job and Project are hashes of the job and project
+// IDs, so repeated runs of one project can be told apart from others
+// without naming it.
+type MetricsEntry struct {
+	Timestamp       string `json:"ts"`
+	Job             string `json:"job"`
+	Project         string `json:"project"`
+	Status          string `json:"status"`
+	DurationSeconds *int   `json:"duration_seconds,omitempty"`
+	Model           string `json:"model,omitempty"`
+	ExitCode        *int   `json:"exit_code,omitempty"`
+}
+
+// MetricsPath returns the metrics log in configDir.
+func MetricsPath(configDir string) string {
+	return filepath.Join(configDir, MetricsFile)
+}
+
+// metricsHash returns the anonymized form of an ID in a MetricsEntry.
+func metricsHash(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RecordJobMetrics appends the MetricsEntry of the finished job in jobDir to
+// the metrics log at path. model is the job's execution model and exitCode
+// the code it ended with. The line is written in one append under
+// path+".lock", and the log is trimmed to MetricsMaxBytes. Callers ignore
+// the error apart from logging it: metrics never fail a job.
+func RecordJobMetrics(path, jobDir, model string, exitCode int) error {
+	m := job.LoadManifest(jobDir)
+	status := string(job.ReadStatus(jobDir))
+	timing := readJobTiming(jobDir, m, status, time.Now())
+	ts := timing.FinishedAt
+	if ts == "" {
+		ts = job.FormatTimestamp(time.Now())
+	}
+	e := MetricsEntry{
+		Timestamp:       ts,
+		Job:             metricsHash(filepath.Base(jobDir)),
+		Project:         metricsHash(m.ProjectID),
+		Status:          status,
+		DurationSeconds: timing.DurationSeconds,
+		Model:           model,
+		ExitCode:        &exitCode,
+	}
+	return appendMetrics(path, e, MetricsMaxBytes)
+}
+
+// appendMetrics appends e to the metrics log at path and trims the log to
+// three quarters of maxBytes once it is larger than that.
+func appendMetrics(path string, e MetricsEntry, maxBytes int64) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return slot.WithFileLock(path+".lock", func() error {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(line, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.Size() <= maxBytes {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for int64(len(data)) > maxBytes*3/4 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				data = nil
+				break
+			}
+			data = data[i+1:]
+		}
+		return job.AtomicWrite(path, data)
+	})
+}
+
+// ReadMetrics returns the entries of the metrics log at path that finished
+// at or after since (zero: all), oldest first. Lines that do not parse are
+// skipped, and a missing log has no entries.
+func ReadMetrics(path string, since time.Time) ([]MetricsEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []MetricsEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e MetricsEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		ts, err := job.ParseTimestamp(e.Timestamp)
+		if err != nil || ts.Before(since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// MetricsSummary is what glm metrics summary reports.
+type MetricsSummary struct {
+	Jobs int `json:"jobs"`
+	// Statuses counts the jobs per status.
+	Statuses map[string]int `json:"statuses"`
+	// FailureRate is the share of jobs that ended failed, timeout,
+	// permission_error or context_exceeded, from 0 to 1.
+	FailureRate float64 `json:"failure_rate"`
+	// The average, median and 95th percentile (nearest rank) of the job
+	// durations; absent when no job recorded one.
+	DurationAvg *int `json:"duration_avg_seconds,omitempty"`
+	DurationP50 *int `json:"duration_p50_seconds,omitempty"`
+	DurationP95 *int `json:"duration_p95_seconds,omitempty"`
+	// PerDay counts the jobs per UTC day, oldest first.
+	PerDay []MetricsDay `json:"per_day"`
+	// Models totals the jobs per execution model, by model name.
+	Models []MetricsModel `json:"models"`
+}
+
+// MetricsDay is the number of jobs that finished on one UTC day.
+type MetricsDay struct {
+	Day  string `json:"day"`
+	Jobs int    `json:"jobs"`
+}
+
+// MetricsModel totals the jobs of one execution model.
+type MetricsModel struct {
+	Model           string `json:"model"`
+	Jobs            int    `json:"jobs"`
+	Failed          int    `json:"failed"`
+	DurationSeconds int    `json:"duration_seconds"`
+}
+
+// SummarizeMetrics aggregates entries into a MetricsSummary.
+func SummarizeMetrics(entries []MetricsEntry) MetricsSummary {
+	s := MetricsSummary{Jobs: len(entries), Statuses: map[string]int{}, PerDay: []MetricsDay{}, Models: []MetricsModel{}}
+	days := map[string]int{}
+	models := map[string]*MetricsModel{}
+	var durations []int
+	failed := 0
+	for _, e := range entries {
+		s.Statuses[e.Status]++
+		if ts, err := job.ParseTimestamp(e.Timestamp); err == nil {
+			days[ts.UTC().Format("2006-01-02")]++
+		}
+		mm := models[e.Model]
+		if mm == nil {
+			mm = &MetricsModel{Model: e.Model}
+			models[e.Model] = mm
+		}
+		mm.Jobs++
+		if isFailureStatus(e.Status) {
+			failed++
+			mm.Failed++
+		}
+		if e.DurationSeconds != nil {
+			durations = append(durations, *e.DurationSeconds)
+			mm.DurationSeconds += *e.DurationSeconds
+		}
+	}
+	if s.Jobs > 0 {
+		s.FailureRate = float64(failed) / float64(s.Jobs)
+	}
+	if len(durations) > 0 {
+		sort.Ints(durations)
+		total := 0
+		for _, d := range durations {
+			total += d
+		}
+		avg := total / len(durations)
+		p50, p95 := percentile(durations, 50), percentile(durations, 95)
+		s.DurationAvg, s.DurationP50, s.DurationP95 = &avg, &p50, &p95
+	}
+	for day, n := range days {
+		s.PerDay = append(s.PerDay, MetricsDay{Day: day, Jobs: n})
+	}
+	sort.Slice(s.PerDay, func(i, j int) bool { return s.PerDay[i].Day < s.PerDay[j].Day })
+	for _, mm := range models {
+		s.Models = append(s.Models, *mm)
+	}
+	sort.Slice(s.Models, func(i, j int) bool { return s.Models[i].Model < s.Models[j].Model })
+	return s
+}
+
+// percentile returns the p-th percentile of sorted by the nearest-rank
+// method: the smallest value with at least p percent of the values at or
+// below it.
+func percentile(sorted []int, p int) int {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// MetricsOptions holds optional MetricsSummaryCmd settings.
+type MetricsOptions struct {
+	// Since only counts jobs that finished at or after it (zero: all).
+	Since time.Time
+	// JSON writes the MetricsSummary as JSON instead of the text report.
+	JSON bool
+}
+
+// MetricsSummaryCmd summarizes the metrics log at path to w: the job count,
+// jobs per status and per day, the failure rate, the average, p50 and p95
+// durations and the totals per model.
+func MetricsSummaryCmd(path string, w io.Writer, opts ...*MetricsOptions) error {
+	o := &MetricsOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	entries, err := ReadMetrics(path, o.Since)
+	if err != nil {
+		return err
+	}
+	s := SummarizeMetrics(entries)
+	if o.JSON {
+		return JSONOutput(w, s)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "jobs\t%d\n", s.Jobs)
+	for _, status := range append(ValidStatuses(), UnknownStatus) {
+		if n := s.Statuses[status]; n > 0 {
+			fmt.Fprintf(tw, "  %s\t%d\n", status, n)
+		}
+	}
+	fmt.Fprintf(tw, "failure rate\t%.1f%%\n", s.FailureRate*100)
+	if s.DurationAvg != nil {
+		fmt.Fprintf(tw, "duration\tavg %s, p50 %s, p95 %s\n",
+			formatSeconds(*s.DurationAvg), formatSeconds(*s.DurationP50), formatSeconds(*s.DurationP95))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(s.PerDay) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "DAY\tJOBS")
+		for _, d := range s.PerDay {
+			fmt.Fprintf(tw, "%s\t%d\n", d.Day, d.Jobs)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(s.Models) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "MODEL\tJOBS\tFAILED\tDURATION")
+		for _, mm := range s.Models {
+			model := mm.Model
+			if model == "" {
+				model = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", model, mm.Jobs, mm.Failed, formatSeconds(mm.DurationSeconds))
+		}
+	}
+	return tw.Flush()
+}
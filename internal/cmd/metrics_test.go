@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// Scenario: a finished job's metrics line holds hashes instead of its IDs, and the log is trimmed from the oldest line once it passes the cap
+func TestRecordJobMetrics(t *testing.T) {
+	root := t.TempDir()
+	jobDir := filepath.Join(root, "proj", "job-20260101-000000-aaaaaaaa")
+	if err := os.MkdirAll(jobDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	_ = job.WriteStatus(jobDir, job.StatusFailed)
+	if err := job.UpdateManifest(jobDir, func(m *job.Manifest) {
+		m.ProjectID = "proj"
+		m.Prompt = "secret"
+		m.StartedAt = "2026-01-01T00:00:00Z"
+		m.FinishedAt = "2026-01-01T00:01:00Z"
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config", MetricsFile)
+	if err := RecordJobMetrics(path, jobDir, "glm-4.7", 2); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadMetrics(path, time.Time{})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadMetrics = %v, %v", entries, err)
+	}
+	e := entries[0]
+	if e.Timestamp != "2026-01-01T00:01:00Z" || e.Status != "failed" || e.Model != "glm-4.7" ||
+		e.DurationSeconds == nil || *e.DurationSeconds != 60 || e.ExitCode == nil || *e.ExitCode != 2 {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.Job != metricsHash("job-20260101-000000-aaaaaaaa") || e.Project != metricsHash("proj") || strings.Contains(e.Job+e.Project, "proj") {
+		t.Errorf("Job = %q, Project = %q, want hashes", e.Job, e.Project)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Trimming keeps whole lines, newest last.
+	for i := range 20 {
+		if err := appendMetrics(path, MetricsEntry{Timestamp: "2026-01-02T00:00:00Z", Job: strings.Repeat("x", i), Status: "done"}, 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if len(data) > 1000 || !strings.HasSuffix(string(data), "\n") {
+		t.Errorf("log is %d bytes after trimming, want at most 1000", len(data))
+	}
+	entries, _ = ReadMetrics(path, time.Time{})
+	if len(entries) == 0 || len(entries) != strings.Count(string(data), "\n") || entries[len(entries)-1].Job != strings.Repeat("x", 19) {
+		t.Errorf("after trimming: %d entries of %d lines, last %+v", len(entries), strings.Count(string(data), "\n"), entries[len(entries)-1])
+	}
+}
+
+// Scenario: the summary counts statuses, days and models, computes the failure rate and nearest-rank p50/p95, and --since and malformed lines are skipped when reading
+func TestSummarizeMetrics(t *testing.T) {
+	secs := func(n int) *int { return &n }
+	var entries []MetricsEntry
+	// Durations 1..20s: p50 is 10s, p95 19s, the average 10s.
+	for i := 1; i <= 20; i++ {
+		e := MetricsEntry{Timestamp: "2026-01-01T12:00:00Z", Status: "done", Model: "glm-4.7", DurationSeconds: secs(i)}
+		if i > 15 {
+			e.Timestamp, e.Model = "2026-01-02T12:00:00Z", "glm-4.5-air"
+		}
+		if i%5 == 0 {
+			e.Status = "failed"
+		}
+		entries = append(entries, e)
+	}
+	entries = append(entries, MetricsEntry{Timestamp: "2026-01-02T13:00:00Z", Status: "timeout", Model: "glm-4.7"})
+
+	s := SummarizeMetrics(entries)
+	if s.Jobs != 21 || s.Statuses["done"] != 16 || s.Statuses["failed"] != 4 || s.Statuses["timeout"] != 1 {
+		t.Errorf("counts = %d %v", s.Jobs, s.Statuses)
+	}
+	if want := 5.0 / 21; s.FailureRate != want {
+		t.Errorf("FailureRate = %v, want %v", s.FailureRate, want)
+	}
+	if *s.DurationAvg != 10 || *s.DurationP50 != 10 || *s.DurationP95 != 19 {
+		t.Errorf("durations avg %d, p50 %d, p95 %d", *s.DurationAvg, *s.DurationP50, *s.DurationP95)
+	}
+	if len(s.PerDay) != 2 || s.PerDay[0] != (MetricsDay{"2026-01-01", 15}) || s.PerDay[1] != (MetricsDay{"2026-01-02", 6}) {
+		t.Errorf("PerDay = %v", s.PerDay)
+	}
+	wantModels := []MetricsModel{{"glm-4.5-air", 5, 1, 90}, {"glm-4.7", 16, 4, 120}}
+	if len(s.Models) != 2 || s.Models[0] != wantModels[0] || s.Models[1] != wantModels[1] {
+		t.Errorf("Models = %v, want %v", s.Models, wantModels)
+	}
+	if s := SummarizeMetrics(nil); s.Jobs != 0 || s.DurationP50 != nil || s.FailureRate != 0 {
+		t.Errorf("empty summary = %+v", s)
+	}
+
+	path := filepath.Join(t.TempDir(), MetricsFile)
+	log := `{"ts":"2026-01-01T00:00:00Z","status":"done"}` + "\nnot json\n" + `{"ts":"2026-01-03T00:00:00Z","status":"failed","duration_seconds":7}` + "\n"
+	if err := os.WriteFile(path, []byte(log), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	since, _ := time.Parse(time.RFC3339, "2026-01-02T00:00:00Z")
+	var out strings.Builder
+	if err := MetricsSummaryCmd(path, &out, &MetricsOptions{Since: since}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"jobs          1\n", "  failed      1\n", "failure rate  100.0%\n", "duration      avg 7s, p50 7s, p95 7s\n", "2026-01-03  1\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary missing %q:\n%s", want, out.String())
+		}
+	}
+}
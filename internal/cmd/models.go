@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// ModelChoice is the model of one slot and the setting it came from, such
+// as "--haiku", "-m", "GLM_OPUS_MODEL" or "glm.toml sonnet_model" (see
+// config.ModelSources).
+type ModelChoice struct {
+	Model  string `json:"model"`
+	Source string `json:"source"`
+}
+
+// ResolvedModels are the models a job runs with, each with its source.
+type ResolvedModels struct {
+	Opus   ModelChoice `json:"opus"`
+	Sonnet ModelChoice `json:"sonnet"`
+	Haiku  ModelChoice `json:"haiku"`
+	// Exec is the model claude is started with (--model): the sonnet slot,
+	// or the model a chain step's prefix picks.
+	Exec ModelChoice `json:"exec"`
+}
+
+// Slot returns the choice of slot "opus", "sonnet" or "haiku".
+func (r ResolvedModels) Slot(name string) ModelChoice {
+	switch name {
+	case "opus":
+		return r.Opus
+	case "haiku":
+		return r.Haiku
+	}
+	return r.Sonnet
+}
+
+// Models returns the three slot models.
+func (r ResolvedModels) Models() job.Models {
+	return job.Models{Opus: r.Opus.Model, Sonnet: r.Sonnet.Model, Haiku: r.Haiku.Model}
+}
+
+// ResolveModels is the one place the models of a job are decided, for run,
+// start, chain and session alike. Later layers win:
+//
+//  1. cfg: the default, glm.toml, GLM_MODEL and GLM_<SLOT>_MODEL, as
+//     config.Load applied them (cfg.ModelSources)
+//  2. flags.Model (-m), for all three slots
+//  3. flags.OpusModel, SonnetModel and HaikuModel (--opus, --sonnet,
+//     --haiku), for one slot each
+//  4. step, a chain step's prefix: [model=NAME] or [slot=NAME] picks the
+//     execution model, leaving the slots alone
+//
+// Without a step prefix the execution model is the sonnet slot. cfg and
+// flags may be nil; the slots of a Config that was not loaded come from
+// "config".
+func ResolveModels(cfg *config.Config, flags *Flags, step StepPrefix) ResolvedModels {
+	var r ResolvedModels
+	if cfg != nil {
+		r.Opus = ModelChoice{cfg.OpusModel, configSource(cfg.ModelSources.Opus)}
+		r.Sonnet = ModelChoice{cfg.SonnetModel, configSource(cfg.ModelSources.Sonnet)}
+		r.Haiku = ModelChoice{cfg.HaikuModel, configSource(cfg.ModelSources.Haiku)}
+	}
+	if flags != nil {
+		if flags.Model != "" {
+			m := ModelChoice{flags.Model, "-m"}
+			r.Opus, r.Sonnet, r.Haiku = m, m, m
+		}
+		for _, f := range []struct {
+			value, source string
+			slot          *ModelChoice
+		}{
+			{flags.OpusModel, "--opus", &r.Opus},
+			{flags.SonnetModel, "--sonnet", &r.Sonnet},
+			{flags.HaikuModel, "--haiku", &r.Haiku},
+		} {
+			if f.value != "" {
+				*f.slot = ModelChoice{f.value, f.source}
+			}
+		}
+	}
+
+	switch {
+	case step.Model != "":
+		r.Exec = ModelChoice{step.Model, "step prefix [model=" + step.Model + "]"}
+	case step.Slot != "":
+		slot := r.Slot(step.Slot)
+		r.Exec = ModelChoice{slot.Model, "step prefix [slot=" + step.Slot + "]: " + slot.Source}
+	default:
+		r.Exec = ModelChoice{r.Sonnet.Model, "sonnet slot: " + r.Sonnet.Source}
+	}
+	return r
+}
+
+// configSource is the source of a config slot: its config.ModelSources
+// entry, or "config" when the Config was not loaded.
+func configSource(source string) string {
+	if source == "" {
+		return "config"
+	}
+	return source
+}
+
+// ExplainModels writes the models r resolved to, one line per slot and one
+// for the execution model, each with the setting it came from.
+func ExplainModels(r ResolvedModels, w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%-8s  %-24s  %s\n", "SLOT", "MODEL", "SOURCE"); err != nil {
+		return err
+	}
+	for _, row := range []struct {
+		name string
+		m    ModelChoice
+	}{
+		{"opus", r.Opus},
+		{"sonnet", r.Sonnet},
+		{"haiku", r.Haiku},
+		{"exec", r.Exec},
+	} {
+		if _, err := fmt.Fprintf(w, "%-8s  %-24s  %s\n", row.name, row.m.Model, row.m.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
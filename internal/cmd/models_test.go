@@ -0,0 +1,203 @@
+package cmd_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/config"
+)
+
+// modelsConfig is a loaded config whose slots come from three layers.
+func modelsConfig() *config.Config {
+	return &config.Config{
+		OpusModel:    "cfg-opus",
+		SonnetModel:  "cfg-sonnet",
+		HaikuModel:   "cfg-haiku",
+		ModelSources: config.ModelSources{Opus: "glm.toml opus_model", Sonnet: "GLM_MODEL", Haiku: "default"},
+	}
+}
+
+// Scenario: ResolveModels applies config, -m, the per-slot flags and a chain step prefix in that order
+func TestResolveModels(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   *config.Config
+		flags *cmd.Flags
+		step  cmd.StepPrefix
+		want  cmd.ResolvedModels
+	}{
+		{
+			name: "config only",
+			cfg:  modelsConfig(),
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "cfg-opus", Source: "glm.toml opus_model"},
+				Sonnet: cmd.ModelChoice{Model: "cfg-sonnet", Source: "GLM_MODEL"},
+				Haiku:  cmd.ModelChoice{Model: "cfg-haiku", Source: "default"},
+				Exec:   cmd.ModelChoice{Model: "cfg-sonnet", Source: "sonnet slot: GLM_MODEL"},
+			},
+		},
+		{
+			name:  "-m sets every slot",
+			cfg:   modelsConfig(),
+			flags: &cmd.Flags{Model: "m"},
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "m", Source: "-m"},
+				Sonnet: cmd.ModelChoice{Model: "m", Source: "-m"},
+				Haiku:  cmd.ModelChoice{Model: "m", Source: "-m"},
+				Exec:   cmd.ModelChoice{Model: "m", Source: "sonnet slot: -m"},
+			},
+		},
+		{
+			name:  "-m and --haiku",
+			cfg:   modelsConfig(),
+			flags: &cmd.Flags{Model: "m", HaikuModel: "h"},
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "m", Source: "-m"},
+				Sonnet: cmd.ModelChoice{Model: "m", Source: "-m"},
+				Haiku:  cmd.ModelChoice{Model: "h", Source: "--haiku"},
+				Exec:   cmd.ModelChoice{Model: "m", Source: "sonnet slot: -m"},
+			},
+		},
+		{
+			name:  "--sonnet is the execution model",
+			cfg:   modelsConfig(),
+			flags: &cmd.Flags{Model: "m", SonnetModel: "s"},
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "m", Source: "-m"},
+				Sonnet: cmd.ModelChoice{Model: "s", Source: "--sonnet"},
+				Haiku:  cmd.ModelChoice{Model: "m", Source: "-m"},
+				Exec:   cmd.ModelChoice{Model: "s", Source: "sonnet slot: --sonnet"},
+			},
+		},
+		{
+			name:  "[model=] step prefix wins over every flag and leaves the slots",
+			cfg:   modelsConfig(),
+			flags: &cmd.Flags{Model: "m", SonnetModel: "s"},
+			step:  cmd.StepPrefix{Model: "glm-4.0"},
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "m", Source: "-m"},
+				Sonnet: cmd.ModelChoice{Model: "s", Source: "--sonnet"},
+				Haiku:  cmd.ModelChoice{Model: "m", Source: "-m"},
+				Exec:   cmd.ModelChoice{Model: "glm-4.0", Source: "step prefix [model=glm-4.0]"},
+			},
+		},
+		{
+			name:  "[slot=] step prefix takes the slot's flag",
+			cfg:   modelsConfig(),
+			flags: &cmd.Flags{Model: "m", HaikuModel: "h"},
+			step:  cmd.StepPrefix{Slot: "haiku"},
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "m", Source: "-m"},
+				Sonnet: cmd.ModelChoice{Model: "m", Source: "-m"},
+				Haiku:  cmd.ModelChoice{Model: "h", Source: "--haiku"},
+				Exec:   cmd.ModelChoice{Model: "h", Source: "step prefix [slot=haiku]: --haiku"},
+			},
+		},
+		{
+			name: "[slot=] step prefix falls back to the config",
+			cfg:  modelsConfig(),
+			step: cmd.StepPrefix{Slot: "opus"},
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "cfg-opus", Source: "glm.toml opus_model"},
+				Sonnet: cmd.ModelChoice{Model: "cfg-sonnet", Source: "GLM_MODEL"},
+				Haiku:  cmd.ModelChoice{Model: "cfg-haiku", Source: "default"},
+				Exec:   cmd.ModelChoice{Model: "cfg-opus", Source: "step prefix [slot=opus]: glm.toml opus_model"},
+			},
+		},
+		{
+			name: "config that was not loaded",
+			cfg:  &config.Config{OpusModel: "o", SonnetModel: "s"},
+			want: cmd.ResolvedModels{
+				Opus:   cmd.ModelChoice{Model: "o", Source: "config"},
+				Sonnet: cmd.ModelChoice{Model: "s", Source: "config"},
+				Haiku:  cmd.ModelChoice{Model: "", Source: "config"},
+				Exec:   cmd.ModelChoice{Model: "s", Source: "sonnet slot: config"},
+			},
+		},
+		{
+			name:  "no config",
+			flags: &cmd.Flags{OpusModel: "o"},
+			want: cmd.ResolvedModels{
+				Opus: cmd.ModelChoice{Model: "o", Source: "--opus"},
+				Exec: cmd.ModelChoice{Source: "sonnet slot: "},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cmd.ResolveModels(tt.cfg, tt.flags, tt.step); got != tt.want {
+				t.Errorf("ResolveModels =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Scenario: for every combination of -m, --opus, --sonnet and --haiku a slot takes its own flag, else -m, else the config
+func TestResolveModelsEveryFlagCombination(t *testing.T) {
+	cfg := modelsConfig()
+	configured := map[string]cmd.ModelChoice{
+		"opus":   {Model: "cfg-opus", Source: "glm.toml opus_model"},
+		"sonnet": {Model: "cfg-sonnet", Source: "GLM_MODEL"},
+		"haiku":  {Model: "cfg-haiku", Source: "default"},
+	}
+	for mask := 0; mask < 16; mask++ {
+		flags := &cmd.Flags{}
+		slotFlags := map[string]string{}
+		if mask&1 != 0 {
+			flags.Model = "flag-m"
+		}
+		if mask&2 != 0 {
+			flags.OpusModel, slotFlags["opus"] = "flag-opus", "--opus"
+		}
+		if mask&4 != 0 {
+			flags.SonnetModel, slotFlags["sonnet"] = "flag-sonnet", "--sonnet"
+		}
+		if mask&8 != 0 {
+			flags.HaikuModel, slotFlags["haiku"] = "flag-haiku", "--haiku"
+		}
+
+		got := cmd.ResolveModels(cfg, flags, cmd.StepPrefix{})
+		for _, slot := range []string{"opus", "sonnet", "haiku"} {
+			want := configured[slot]
+			switch {
+			case slotFlags[slot] != "":
+				want = cmd.ModelChoice{Model: "flag-" + slot, Source: slotFlags[slot]}
+			case flags.Model != "":
+				want = cmd.ModelChoice{Model: "flag-m", Source: "-m"}
+			}
+			if got.Slot(slot) != want {
+				t.Errorf("flags %+v: %s = %+v, want %+v", *flags, slot, got.Slot(slot), want)
+			}
+		}
+		if got.Exec.Model != got.Sonnet.Model {
+			t.Errorf("flags %+v: exec %q, want the sonnet slot %q", *flags, got.Exec.Model, got.Sonnet.Model)
+		}
+	}
+}
+
+// Scenario: glm config explain models prints one line per slot and the execution model, each with its source
+func TestExplainModels(t *testing.T) {
+	var buf bytes.Buffer
+	r := cmd.ResolveModels(modelsConfig(), &cmd.Flags{HaikuModel: "h"}, cmd.StepPrefix{})
+	if err := cmd.ExplainModels(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := [][]string{
+		{"SLOT", "MODEL", "SOURCE"},
+		{"opus", "cfg-opus", "glm.toml opus_model"},
+		{"sonnet", "cfg-sonnet", "GLM_MODEL"},
+		{"haiku", "h", "--haiku"},
+		{"exec", "cfg-sonnet", "sonnet slot: GLM_MODEL"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("output =\n%s", buf.String())
+	}
+	for i, fields := range want {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(fields, " ") {
+			t.Errorf("line %d = %q, want %v", i, lines[i], fields)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// NestingOptions holds optional settings for NestingCheck.
+type NestingOptions struct {
+	// AllowNested disables the check (--allow-nested).
+	AllowNested bool
+}
+
+// NestingCheck refuses a new job when this glm runs inside a glm job
+// (claude.DepthEnv) and the new job, one level deeper, would nest more than
+// maxDepth deep. A subagent that delegates to glm again could otherwise
+// start jobs without end.
+//
+// It returns an error of the form:
+//
+//	err:user "Refusing to start a job at nesting depth <n> (max_depth = <m>): ..."
+func NestingCheck(maxDepth int, opts ...*NestingOptions) error {
+	o := &NestingOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	depth := claude.NestingDepth() + 1
+	if o.AllowNested || depth <= maxDepth {
+		return nil
+	}
+	return errs.User(`"Refusing to start a job at nesting depth %d (max_depth = %d): glm is running inside another glm job (%s=%d), and a subagent that starts subagents can recurse without end (pass --allow-nested or raise max_depth to run anyway)"`,
+		depth, maxDepth, claude.DepthEnv, depth-1)
+}
@@ -0,0 +1,35 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// Scenario: a glm outside any job may start one, one inside a job is refused unless --allow-nested or a higher max_depth allows it
+func TestNestingCheck(t *testing.T) {
+	t.Setenv(claude.DepthEnv, "")
+	if err := cmd.NestingCheck(1); err != nil {
+		t.Errorf("NestingCheck outside a job = %v, want nil", err)
+	}
+
+	t.Setenv(claude.DepthEnv, "1")
+	err := cmd.NestingCheck(1)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Fatalf("NestingCheck at depth 2 = %v, want err:user", err)
+	}
+	for _, want := range []string{"nesting depth 2", "max_depth = 1", "GLM_DEPTH=1", "--allow-nested"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	if err := cmd.NestingCheck(1, &cmd.NestingOptions{AllowNested: true}); err != nil {
+		t.Errorf("NestingCheck with AllowNested = %v, want nil", err)
+	}
+	if err := cmd.NestingCheck(2); err != nil {
+		t.Errorf("NestingCheck with max_depth 2 = %v, want nil", err)
+	}
+}
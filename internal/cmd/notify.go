@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
+)
+
+// NotifyLogFile is the job artifact the output of its --notify hook is
+// appended to.
+const NotifyLogFile = "notify.log"
+
+// DefaultNotifyTimeout bounds a --notify hook.
+const DefaultNotifyTimeout = 30 * time.Second
+
+// NotifyOptions holds optional RunNotify settings.
+type NotifyOptions struct {
+	// Timeout bounds the hook; its process group is killed after it
+	// (default DefaultNotifyTimeout).
+	Timeout time.Duration
+}
+
+// RunNotify runs command, the --notify hook (or on_complete_cmd) of the
+// finished job in jobDir, with "sh -c" and these variables added to the
+// environment:
+//
+//	GLM_JOB_ID     the job ID
+//	GLM_STATUS     its final status
+//	GLM_EXIT_CODE  exitCode, the job's exit code
+//	GLM_JOB_DIR    jobDir
+//	GLM_DURATION   the job's duration in whole seconds (0 when unknown)
+//
+// The hook's stdout and stderr are appended to the job's notify.log between
+// a line naming the command and a line saying how it ended. The hook never
+// changes the job: an error, a failing exit or a timeout is only recorded in
+// notify.log and returned.
+func RunNotify(jobDir, command string, exitCode int, opts ...*NotifyOptions) error {
+	o := &NotifyOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(jobDir, NotifyLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", NotifyLogFile, err)
+	}
+	defer logFile.Close()
+
+	status := string(job.ReadStatus(jobDir))
+	duration := 0
+	if t := readJobTiming(jobDir, job.LoadManifest(jobDir), status, time.Now()); t.DurationSeconds != nil {
+		duration = *t.DurationSeconds
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	hook := exec.CommandContext(ctx, "sh", "-c", command)
+	hook.Env = append(os.Environ(),
+		"GLM_JOB_ID="+filepath.Base(jobDir),
+		"GLM_STATUS="+status,
+		"GLM_EXIT_CODE="+strconv.Itoa(exitCode),
+		"GLM_JOB_DIR="+jobDir,
+		"GLM_DURATION="+strconv.Itoa(duration),
+	)
+	// The log file itself, not a pipe, so a background child left running
+	// by the hook cannot hold up Wait.
+	hook.Stdout = logFile
+	hook.Stderr = logFile
+	hook.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	hook.Cancel = func() error { return slot.TerminateProcessGroup(hook.Process.Pid) }
+
+	fmt.Fprintf(logFile, "[GoLeM] %s notify: %s\n", time.Now().UTC().Format(time.RFC3339), command)
+	err = hook.Run()
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("notify hook timed out after %s", timeout)
+	case err != nil:
+		err = fmt.Errorf("notify hook failed: %w", err)
+	}
+	if err != nil {
+		fmt.Fprintf(logFile, "[GoLeM] %v\n", err)
+		return err
+	}
+	fmt.Fprintln(logFile, "[GoLeM] notify hook exited 0")
+	return nil
+}
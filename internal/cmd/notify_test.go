@@ -0,0 +1,61 @@
+package cmd_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// Scenario: the hook gets the job's variables and its output is appended to notify.log
+func TestRunNotify(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	dir := makeJobDir(t, root, "proj", "job-20260227-143205-a8f3b1c2", "failed")
+
+	for i := 0; i < 2; i++ {
+		if err := cmd.RunNotify(dir, `echo "$GLM_JOB_ID $GLM_STATUS $GLM_EXIT_CODE $GLM_DURATION"; echo oops >&2`, 3); err != nil {
+			t.Fatalf("RunNotify: %v", err)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, cmd.NotifyLogFile))
+	log := string(data)
+	if strings.Count(log, "job-20260227-143205-a8f3b1c2 failed 3 0\noops\n[GoLeM] notify hook exited 0\n") != 2 {
+		t.Errorf("notify.log = %q, want both runs' output", log)
+	}
+	if !strings.HasPrefix(log, "[GoLeM] ") || !strings.Contains(log, " notify: echo ") {
+		t.Errorf("notify.log = %q, want a line naming the command first", log)
+	}
+}
+
+// Scenario: a failing or hanging hook is recorded in notify.log and leaves the job's status alone
+func TestRunNotifyFailureAndTimeout(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	dir := makeJobDir(t, root, "proj", "job-20260227-143205-a8f3b1c2", "done")
+
+	if err := cmd.RunNotify(dir, "exit 7", 0); err == nil || !strings.Contains(err.Error(), "exit status 7") {
+		t.Errorf("failing hook: err = %v, want exit status 7", err)
+	}
+
+	start := time.Now()
+	err := cmd.RunNotify(dir, "sleep 30", 0, &cmd.NotifyOptions{Timeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("hanging hook: err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("hanging hook took %s", elapsed)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, cmd.NotifyLogFile))
+	for _, want := range []string{"[GoLeM] notify hook failed: exit status 7", "[GoLeM] notify hook timed out after 100ms"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("notify.log = %q, want %q", data, want)
+		}
+	}
+	if st := job.ReadStatus(dir); st != job.StatusDone {
+		t.Errorf("status = %s, want done", st)
+	}
+}
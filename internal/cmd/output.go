@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// Out is the output policy of a command. Stdout carries the command's
+// payload (job output, tables, reports) and Stderr its diagnostics. Quiet
+// suppresses progress and summary lines but never results or errors; Color
+// colors statuses for a terminal.
+type Out struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Quiet  bool
+	Color  bool
+}
+
+// resolveOut returns o with stdout and stderr filled in where o leaves its
+// writers nil. A nil o prints everything without color.
+func resolveOut(o *Out, stdout, stderr io.Writer) *Out {
+	r := &Out{Stdout: stdout, Stderr: stderr}
+	if o != nil {
+		r.Quiet, r.Color = o.Quiet, o.Color
+		if o.Stdout != nil {
+			r.Stdout = o.Stdout
+		}
+		if o.Stderr != nil {
+			r.Stderr = o.Stderr
+		}
+	}
+	return r
+}
+
+// Progressf writes a progress or summary line to Stderr unless Quiet is set.
+func (o *Out) Progressf(format string, args ...any) {
+	if !o.Quiet {
+		fmt.Fprintf(o.Stderr, format, args...)
+	}
+}
+
+// PrintLimited writes s to w, cut to at most maxBytes bytes (0 = no limit)
+// at a character boundary. When it cuts s it writes the trailer
+// "…[truncated, N bytes total — full output in FULL]" to trailer, where full
+// names the file that keeps all of s, and returns true.
+func PrintLimited(w, trailer io.Writer, s string, maxBytes int, full string) bool {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		fmt.Fprint(w, s)
+		return false
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	fmt.Fprint(w, s[:cut])
+	fmt.Fprintf(trailer, "…[truncated, %d bytes total — full output in %s]\n", len(s), full)
+	return true
+}
+
+// ANSI color codes used for statuses.
+const (
+	ansiGreen = "\x1b[32m"
+	ansiRed   = "\x1b[31m"
+	ansiReset = "\x1b[0m"
+)
+
+// Status returns text colored for status when Color is set: green for done
+// and OK, red for failure statuses and FAIL. text is usually status itself,
+// possibly padded; other statuses are returned as is.
+func (o *Out) Status(status, text string) string {
+	if !o.Color {
+		return text
+	}
+	switch {
+	case status == string(job.StatusDone) || status == "OK":
+		return ansiGreen + text + ansiReset
+	case isFailureStatus(status) || status == "FAIL":
+		return ansiRed + text + ansiReset
+	}
+	return text
+}
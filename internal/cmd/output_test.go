@@ -0,0 +1,249 @@
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// Scenario: --quiet keeps each command's results and errors and drops its progress and summary lines
+func TestQuietOutputKeepsOnlyPayload(t *testing.T) {
+	quiet := &cmd.Out{Quiet: true}
+
+	t.Run("run", func(t *testing.T) {
+		root := t.TempDir()
+		dir := makeJobDir(t, root, "test-project", "job-20260227-143205-a8f3b1c2", "done")
+		writeJobFile(t, dir, "stdout.txt", "the answer\n")
+		writeJobFile(t, dir, "stderr.txt", "warning: slow\n")
+		writeJobFile(t, dir, "changelog.txt", "EDIT main.go: 1 edits\n")
+
+		var stdout, stderr bytes.Buffer
+		f := &cmd.Flags{Dir: t.TempDir(), Timeout: 60, Prompt: "x"}
+		if _, err := cmd.RunCmd(f, root, "test-project", &stdout, &stderr, &cmd.RunOptions{Summary: true, Out: quiet}); err != nil {
+			t.Fatalf("RunCmd: %v", err)
+		}
+		if stdout.String() != "the answer\n" || stderr.String() != "warning: slow\n" {
+			t.Errorf("stdout %q, stderr %q; want only the result and the job's stderr", stdout.String(), stderr.String())
+		}
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		cf := chainFlags(".", 0, "", false, []string{"one", "two"})
+		cf.Out = quiet
+		if _, err := cmd.ChainCmd(cf, makeSubagentsRoot(t), "test-project", &stdout, &stderr); err != nil {
+			t.Fatalf("ChainCmd: %v", err)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("quiet chain stderr = %q, want empty", stderr.String())
+		}
+
+		cf = chainFlags(filepath.Join(t.TempDir(), "missing"), 0, "", false, []string{"one", "two"})
+		cf.Out = quiet
+		stderr.Reset()
+		if _, err := cmd.ChainCmd(cf, makeSubagentsRoot(t), "test-project", &stdout, &stderr); err != nil {
+			t.Fatalf("ChainCmd: %v", err)
+		}
+		if got := stderr.String(); !strings.HasPrefix(got, "err:user") || strings.Contains(got, "Running step") {
+			t.Errorf("quiet failing chain stderr = %q, want only the error", got)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		root := t.TempDir()
+		makeJobDir(t, root, "myapp-12345", "job-20260227-143205-a8f3b1c2", "done")
+		var buf bytes.Buffer
+		if err := cmd.ListCmd(root, &buf, &cmd.FilterOptions{Out: quiet}); err != nil {
+			t.Fatalf("ListCmd: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 1 || !strings.HasPrefix(lines[0], "job-20260227-143205-a8f3b1c2") {
+			t.Errorf("quiet list = %q, want the job row alone", buf.String())
+		}
+	})
+
+	t.Run("clean", func(t *testing.T) {
+		root := t.TempDir()
+		makeJobDir(t, root, "myapp-12345", "job-20260227-143205-a8f3b1c2", "done")
+		var buf bytes.Buffer
+		if err := cmd.CleanCmd(root, 0, time.Now().Add(time.Hour), &buf, &cmd.CleanOptions{Out: quiet}); err != nil {
+			t.Fatalf("CleanCmd: %v", err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("quiet clean = %q, want nothing", buf.String())
+		}
+	})
+
+	t.Run("doctor", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+		root := filepath.Join(t.TempDir(), "subagents")
+		var buf bytes.Buffer
+		opts := cmd.DoctorOptions{ClaudeBinaryName: "glm-test-no-such-claude", ZAIEndpoint: srv.URL, SubagentsRoot: root, Out: quiet}
+		if err := cmd.DoctorCmd(opts, &buf); err != nil {
+			t.Fatalf("DoctorCmd: %v", err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if !strings.Contains(line, " FAIL  ") {
+				t.Errorf("quiet doctor printed %q; want only failed checks", line)
+			}
+		}
+		if !strings.Contains(buf.String(), "subagents_dir") || strings.Contains(buf.String(), "glm doctor --fix") {
+			t.Errorf("quiet doctor output:\n%s", buf.String())
+		}
+	})
+}
+
+// Scenario: list and doctor color statuses only when color is on
+func TestStatusColors(t *testing.T) {
+	root := t.TempDir()
+	makeJobDir(t, root, "myapp-12345", "job-20260227-143205-a8f3b1c2", "done")
+	makeJobDir(t, root, "myapp-12345", "job-20260227-143206-b8f3b1c2", "failed")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	output := func(o *cmd.Out) string {
+		var buf bytes.Buffer
+		if err := cmd.ListCmd(root, &buf, &cmd.FilterOptions{Out: o}); err != nil {
+			t.Fatalf("ListCmd: %v", err)
+		}
+		opts := cmd.DoctorOptions{ClaudeBinaryName: "glm-test-no-such-claude", ZAIEndpoint: srv.URL, SubagentsRoot: root, Out: o}
+		if err := cmd.DoctorCmd(opts, &buf); err != nil {
+			t.Fatalf("DoctorCmd: %v", err)
+		}
+		return buf.String()
+	}
+
+	if got := output(&cmd.Out{}); strings.Contains(got, "\x1b[") {
+		t.Errorf("uncolored output has escape codes:\n%q", got)
+	}
+	if got := output(nil); strings.Contains(got, "\x1b[") {
+		t.Errorf("default output has escape codes:\n%q", got)
+	}
+
+	got := output(&cmd.Out{Color: true})
+	for _, want := range []string{
+		"\x1b[32mdone              \x1b[0m",
+		"\x1b[31mfailed            \x1b[0m",
+		"\x1b[32mOK\x1b[0m",
+		"\x1b[31mFAIL\x1b[0m",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("colored output missing %q:\n%q", want, got)
+		}
+	}
+}
+
+// Scenario: --max-output cuts printed job output at the limit and says where the rest is
+func TestPrintLimited(t *testing.T) {
+	tests := []struct {
+		name      string
+		s         string
+		max       int
+		want      string
+		truncated bool
+	}{
+		{"no limit", "hello", 0, "hello", false},
+		{"exactly at the limit", "hello", 5, "hello", false},
+		{"one byte over", "hello!", 5, "hello", true},
+		{"inside a character", "héllo", 2, "h", true},
+	}
+	for _, tt := range tests {
+		var w, trailer bytes.Buffer
+		got := cmd.PrintLimited(&w, &trailer, tt.s, tt.max, "/jobs/stdout.txt")
+		if got != tt.truncated || w.String() != tt.want {
+			t.Errorf("%s: printed %q, truncated %v; want %q, %v", tt.name, w.String(), got, tt.want, tt.truncated)
+		}
+		wantTrailer := ""
+		if tt.truncated {
+			wantTrailer = fmt.Sprintf("…[truncated, %d bytes total — full output in /jobs/stdout.txt]\n", len(tt.s))
+		}
+		if trailer.String() != wantTrailer {
+			t.Errorf("%s: trailer %q, want %q", tt.name, trailer.String(), wantTrailer)
+		}
+	}
+}
+
+// Scenario: run and result print at most max_output_bytes of a huge stdout; the job keeps all of it
+func TestMaxOutputKeepsFullOutputInJob(t *testing.T) {
+	const limit = 64 << 10
+	big := strings.Repeat("0123456789abcdef", 40<<10) // 640 KB
+	jobID := "job-20260227-143205-a8f3b1c2"
+
+	t.Run("run", func(t *testing.T) {
+		root := t.TempDir()
+		dir := makeJobDir(t, root, "test-project", jobID, "done")
+		writeJobFile(t, dir, "stdout.txt", big)
+
+		var stdout, stderr bytes.Buffer
+		f := &cmd.Flags{Dir: t.TempDir(), Timeout: 60, Prompt: "x"}
+		res, err := cmd.RunCmd(f, root, "test-project", &stdout, &stderr, &cmd.RunOptions{MaxOutput: limit})
+		if err != nil || res.ExitCode != 0 {
+			t.Fatalf("RunCmd = %+v, %v", res, err)
+		}
+		if stdout.Len() != limit || stdout.String() != big[:limit] {
+			t.Errorf("printed %d bytes, want the first %d", stdout.Len(), limit)
+		}
+		wantTrailer := fmt.Sprintf("…[truncated, %d bytes total — full output in %s]\n", len(big), filepath.Join(dir, "stdout.txt"))
+		if stderr.String() != wantTrailer {
+			t.Errorf("stderr = %q, want %q", stderr.String(), wantTrailer)
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "stdout.txt")); err != nil || string(data) != big || res.Deleted {
+			t.Errorf("stdout.txt must survive in full (deleted %v, %d bytes, %v)", res.Deleted, len(data), err)
+		}
+
+		// --max-output on the command line wins over the setting.
+		stdout.Reset()
+		f.MaxOutput = len(big)
+		if _, err := cmd.RunCmd(f, root, "test-project", &stdout, io.Discard, &cmd.RunOptions{MaxOutput: limit}); err != nil || stdout.String() != big {
+			t.Errorf("--max-output %d: printed %d bytes, err %v; want all %d", len(big), stdout.Len(), err, len(big))
+		}
+	})
+
+	t.Run("result", func(t *testing.T) {
+		root := t.TempDir()
+		dir := makeJobDir(t, root, "test-project", jobID, "done")
+		writeJobFile(t, dir, "stdout.txt", big)
+
+		var jsonOut bytes.Buffer
+		if err := cmd.ResultJSON(root, "test-project", jobID, &jsonOut); err != nil || !strings.Contains(jsonOut.String(), big) {
+			t.Errorf("result --json must carry the full stdout (err %v)", err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		res, err := cmd.ResultCmd(jobID, root, "test-project", &stdout, &stderr, &cmd.ResultOptions{MaxOutput: limit})
+		if err != nil || res.ExitCode != 0 {
+			t.Fatalf("ResultCmd = %+v, %v", res, err)
+		}
+		if stdout.String() != big[:limit] || !strings.HasPrefix(stderr.String(), "…[truncated, 655360 bytes total") {
+			t.Errorf("printed %d bytes, stderr %q", stdout.Len(), stderr.String())
+		}
+		if res.Deleted {
+			t.Error("a job whose output was cut must be kept")
+		}
+
+		// With --output the copy has everything and the job is deleted as usual.
+		dest := filepath.Join(t.TempDir(), "out.txt")
+		stdout.Reset()
+		stderr.Reset()
+		res, err = cmd.ResultCmd(jobID, root, "test-project", &stdout, &stderr, &cmd.ResultOptions{MaxOutput: limit, Output: dest})
+		if err != nil || !res.Deleted || stdout.Len() != limit {
+			t.Fatalf("ResultCmd --output = %+v, %v; printed %d bytes", res, err, stdout.Len())
+		}
+		if data, _ := os.ReadFile(dest); string(data) != big {
+			t.Errorf("--output copy has %d bytes, want %d", len(data), len(big))
+		}
+		if !strings.Contains(stderr.String(), "full output in "+dest+"]") {
+			t.Errorf("trailer should name the --output copy: %q", stderr.String())
+		}
+	})
+}
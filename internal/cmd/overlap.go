@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// OverlapOptions holds optional settings for OverlapCheck.
+type OverlapOptions struct {
+	// AllowOverlap disables the check (--allow-overlap or allow_overlap =
+	// true).
+	AllowOverlap bool
+	// ChainID exempts the running steps of this chain, which never edit
+	// the workdir at the same time as the step being started.
+	ChainID string
+}
+
+// OverlapCheck refuses a new job in dir while a running job works in dir, in
+// a directory above it or in one below it, so that two agents do not edit
+// the same files at once. Running jobs whose process has died are
+// reconciled to "failed" first (job.CheckJobPID) and do not count. Jobs
+// whose recorded workdir is relative are skipped: it cannot be resolved.
+//
+// It returns an error of the form:
+//
+//	err:user "Workdir <path> overlaps running jobs: <job IDs> (...)"
+func OverlapCheck(subagentsRoot, dir string, opts ...*OverlapOptions) error {
+	o := &OverlapOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	if o.AllowOverlap {
+		return nil
+	}
+
+	// A missing directory fails the job later; it can still be inside the
+	// workdir of a running job.
+	path, err := resolvePath(dir)
+	if err != nil {
+		if path, err = filepath.Abs(dir); err != nil {
+			return errs.User(`"Cannot resolve working directory %s: %v"`, dir, err)
+		}
+	}
+	conflicts := OverlappingJobs(subagentsRoot, path, o.ChainID)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return errs.User(`"Workdir %s overlaps running jobs: %s (wait for them, or pass --allow-overlap or set allow_overlap = true to run anyway)"`,
+		path, strings.Join(conflicts, ", "))
+}
+
+// OverlappingJobs returns the IDs, sorted, of the running jobs under
+// subagentsRoot whose workdir is path, above it or below it, leaving out the
+// steps of chain chainID (none when empty). path must be absolute with its
+// symlinks resolved.
+func OverlappingJobs(subagentsRoot, path, chainID string) []string {
+	jobs, _ := scanAllJobs(subagentsRoot)
+	var ids []string
+	for _, je := range jobs {
+		if job.Status(je.Status) != job.StatusRunning {
+			continue
+		}
+		if chainID != "" && je.ChainID == chainID {
+			continue
+		}
+		m := job.LoadManifest(je.Dir)
+		if !filepath.IsAbs(m.WorkDir) {
+			continue
+		}
+		workDir, err := filepath.EvalSymlinks(m.WorkDir)
+		if err != nil {
+			workDir = filepath.Clean(m.WorkDir)
+		}
+		if !isWithin(path, workDir) && !isWithin(workDir, path) {
+			continue
+		}
+		if status, _ := job.CheckJobPID(je.Dir); status == string(job.StatusRunning) {
+			ids = append(ids, je.JobID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,111 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// runningJobIn creates a running job with a live PID whose workdir is dir.
+func runningJobIn(t *testing.T, root, jobID, dir string) string {
+	t.Helper()
+	jobDir := makeJobDir(t, root, "proj", jobID, "running")
+	writePID(t, jobDir, selfPID())
+	writeJobFile(t, jobDir, "workdir.txt", dir)
+	return jobDir
+}
+
+// Scenario: a job is refused in, above or below a running job's workdir
+func TestOverlapCheck(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	work := t.TempDir()
+	repo := filepath.Join(work, "repo")
+	sub := filepath.Join(repo, "pkg")
+	other := filepath.Join(work, "other")
+	for _, d := range []string{sub, other} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runningJobIn(t, root, "job-20260101-000000-aaaaaaaa", repo)
+	runningJobIn(t, root, "job-20260101-000000-bbbbbbbb", sub)
+
+	tests := []struct {
+		name string
+		dir  string
+		want []string // conflicting job IDs; nil = allowed
+	}{
+		{"equal path", repo, []string{"job-20260101-000000-aaaaaaaa", "job-20260101-000000-bbbbbbbb"}},
+		{"subdirectory", sub, []string{"job-20260101-000000-aaaaaaaa", "job-20260101-000000-bbbbbbbb"}},
+		{"parent directory", work, []string{"job-20260101-000000-aaaaaaaa", "job-20260101-000000-bbbbbbbb"}},
+		{"unrelated path", other, nil},
+		{"sibling with a common prefix", repo + "-old", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cmd.OverlapCheck(root, tt.dir)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("OverlapCheck = %v, want nil", err)
+				}
+				return
+			}
+			want := `err:user "Workdir ` + tt.dir + ` overlaps running jobs: ` + strings.Join(tt.want, ", ")
+			if err == nil || !strings.HasPrefix(err.Error(), want) || !strings.Contains(err.Error(), "--allow-overlap") {
+				t.Errorf("OverlapCheck = %v, want %s...", err, want)
+			}
+			if err := cmd.OverlapCheck(root, tt.dir, &cmd.OverlapOptions{AllowOverlap: true}); err != nil {
+				t.Errorf("with AllowOverlap: %v", err)
+			}
+		})
+	}
+}
+
+// Scenario: dead, finished and relative-workdir jobs do not block
+func TestOverlapCheckIgnoresStaleJobs(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	repo := t.TempDir()
+
+	dead := runningJobIn(t, root, "job-20260101-000000-dddddddd", repo)
+	writePID(t, dead, deadPID())
+	done := runningJobIn(t, root, "job-20260101-000000-eeeeeeee", repo)
+	writeJobFile(t, done, "status", "done")
+	runningJobIn(t, root, "job-20260101-000000-ffffffff", ".")
+
+	if err := cmd.OverlapCheck(root, repo); err != nil {
+		t.Fatalf("OverlapCheck = %v, want nil", err)
+	}
+	if status := job.ReadStatus(dead); status != job.StatusFailed {
+		t.Errorf("dead job status = %s, want it reconciled to failed", status)
+	}
+}
+
+// Scenario: a chain's own steps are exempt; other running jobs stop the chain
+func TestChainOverlap(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	repo := t.TempDir()
+	step := runningJobIn(t, root, "job-20260101-000000-cccccccc", repo)
+	if err := job.WriteChainInfo(step, "chain-20260101-000000-cccccccc", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.OverlapCheck(root, repo, &cmd.OverlapOptions{ChainID: "chain-20260101-000000-cccccccc"}); err != nil {
+		t.Errorf("own chain step: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	_, err := cmd.ChainCmd(chainFlags(repo, 0, "", false, []string{"a", "b"}), root, "test-project", &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "overlaps running jobs: job-20260101-000000-cccccccc") {
+		t.Errorf("ChainCmd = %v, want an overlap error", err)
+	}
+	cf := chainFlags(repo, 0, "", false, []string{"a", "b"})
+	cf.AllowOverlap = true
+	if result, err := cmd.ChainCmd(cf, root, "test-project", &stdout, &stderr); err != nil || result.StepsExecuted != 2 {
+		t.Errorf("ChainCmd with AllowOverlap = %+v, %v", result, err)
+	}
+}
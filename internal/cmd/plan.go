@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// PlanNotice is printed to stderr by glm result for a plan-mode job, so its
+// output is not mistaken for work that was done.
+const PlanNotice = "— plan only, no changes applied —"
+
+// approvePreamble starts the prompt of the job glm result --approve runs.
+const approvePreamble = "Execute the following approved plan:"
+
+// IsPlanJob reports whether the job in jobDir ran in plan permission mode
+// (permission_mode.txt is "plan"): its output is a plan and nothing was
+// changed.
+func IsPlanJob(jobDir string) bool {
+	return job.LoadManifest(jobDir).PermissionMode == "plan"
+}
+
+// awaitsApproval reports whether jobDir holds a done plan-mode job, whose plan
+// glm result --approve can still carry out.
+func awaitsApproval(jobDir string) bool {
+	return IsPlanJob(jobDir) && job.ReadStatus(jobDir) == job.StatusDone
+}
+
+// ApprovePrompt returns the prompt that carries out plan: the approved plan
+// after approvePreamble, then the original prompt it was made for.
+func ApprovePrompt(plan, prompt string) string {
+	return approvePreamble + "\n\n" + strings.TrimSpace(plan) + "\n\nOriginal task:\n" + prompt
+}
+
+// ApproveFlags returns the Flags of the job that executes the plan of the
+// finished plan-mode job jobID: its prompt with ApprovePrompt, its workdir,
+// models, timeout, base URL and priority, in acceptEdits mode. The plan job
+// itself is left in place; see FinishPlan.
+//
+// It returns err:not_found when the job does not exist, and err:user when it
+// has not finished, did not end done, did not run in plan mode or printed no
+// plan.
+func ApproveFlags(subagentsRoot, currentProjectID, jobID string) (*Flags, error) {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return nil, err
+	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return nil, errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+
+	m := job.LoadManifest(jobDir)
+	if m.PermissionMode != "plan" {
+		return nil, errs.User(`"Job %s did not run in plan mode (--mode plan); nothing to approve"`, jobID)
+	}
+	if status := job.ReadStatus(jobDir); status != job.StatusDone {
+		return nil, errs.User(`"Job %s is %s; only a done plan can be approved"`, jobID, status)
+	}
+	plan, _ := os.ReadFile(filepath.Join(jobDir, "stdout.txt"))
+	if strings.TrimSpace(string(plan)) == "" {
+		return nil, errs.User(`"Job %s printed no plan"`, jobID)
+	}
+
+	return &Flags{
+		Dir:            m.WorkDir,
+		Timeout:        m.TimeoutSecs,
+		OpusModel:      m.Models.Opus,
+		SonnetModel:    m.Models.Sonnet,
+		HaikuModel:     m.Models.Haiku,
+		PermissionMode: "acceptEdits",
+		Prompt:         ApprovePrompt(string(plan), m.Prompt),
+		BaseURL:        m.BaseURL,
+		CaptureDiff:    m.CaptureDiff,
+		StrictResult:   m.StrictResult,
+		Priority:       m.Priority,
+	}, nil
+}
+
+// FinishPlan applies the retention policy to the plan-mode job jobID once its
+// plan has been carried out: FinishJob keeps such a job for --approve, so
+// without keep it is deleted here. Returns true if the job was deleted.
+func FinishPlan(subagentsRoot, currentProjectID, jobID string, keep bool, retentionDays int) bool {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return false
+	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return false
+	}
+	if !keep {
+		job.DeleteJob(jobDir)
+		return true
+	}
+	return FinishJob(jobDir, subagentsRoot, true, retentionDays)
+}
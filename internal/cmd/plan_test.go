@@ -0,0 +1,104 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// planJob creates a done plan-mode job whose output is plan.
+func planJob(t *testing.T, root, jobID, plan string) string {
+	t.Helper()
+	dir := makeJobDir(t, root, "proj", jobID, "done")
+	writeJobFile(t, dir, "permission_mode.txt", "plan")
+	writeJobFile(t, dir, "prompt.txt", "refactor the parser")
+	writeJobFile(t, dir, "workdir.txt", "/home/user/repo")
+	writeJobFile(t, dir, "model.txt", "opus=glm-5 sonnet=glm-5 haiku=glm-4.5-air")
+	writeJobFile(t, dir, "stdout.txt", plan)
+	writeJobFile(t, dir, "changelog.txt", claude.PlanChangelog)
+	return dir
+}
+
+// Scenario: a plan-mode job is labeled in result --json and glm result
+func TestResultLabelsPlanJobs(t *testing.T) {
+	root := t.TempDir()
+	plan := planJob(t, root, "job-20260101-000000-aaaaaaaa", "1. Split parse.go\n2. Add tests\n")
+	done := makeJobDir(t, root, "proj", "job-20260101-000000-bbbbbbbb", "done")
+	writeJobFile(t, done, "stdout.txt", "nothing to do")
+
+	res, err := cmd.JobResult(root, "proj", "job-20260101-000000-aaaaaaaa")
+	if err != nil {
+		t.Fatalf("JobResult error: %v", err)
+	}
+	if res.Mode != "plan" || res.Plan != "1. Split parse.go\n2. Add tests\n" || res.Changelog != claude.PlanChangelog {
+		t.Errorf("plan job: mode=%q plan=%q changelog=%q", res.Mode, res.Plan, res.Changelog)
+	}
+	if res, _ := cmd.JobResult(root, "proj", "job-20260101-000000-bbbbbbbb"); res.Mode != "" || res.Plan != "" {
+		t.Errorf("ordinary job: mode=%q plan=%q, want both empty", res.Mode, res.Plan)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if res, err := cmd.ResultCmd("job-20260101-000000-aaaaaaaa", root, "proj", &stdout, &stderr); err != nil {
+		t.Fatalf("ResultCmd error: %v", err)
+	} else if res.Deleted {
+		t.Errorf("ResultCmd deleted the plan job before it was approved")
+	}
+	if stdout.String() != "1. Split parse.go\n2. Add tests\n" || !strings.Contains(stderr.String(), cmd.PlanNotice) {
+		t.Errorf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+	if _, err := cmd.ApproveFlags(root, "proj", "aaaaaaaa"); err != nil {
+		t.Errorf("ApproveFlags after result: %v", err)
+	}
+	if !cmd.FinishPlan(root, "proj", "aaaaaaaa", false, 0) {
+		t.Errorf("FinishPlan kept the approved plan job")
+	}
+	if _, err := os.Stat(plan); !os.IsNotExist(err) {
+		t.Errorf("plan job still on disk after FinishPlan: %v", err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if _, err := cmd.ResultCmd("job-20260101-000000-bbbbbbbb", root, "proj", &stdout, &stderr); err != nil {
+		t.Fatalf("ResultCmd error: %v", err)
+	}
+	if strings.Contains(stderr.String(), cmd.PlanNotice) {
+		t.Errorf("ordinary job printed the plan notice")
+	}
+}
+
+// Scenario: --approve re-runs the prompt with acceptEdits and the plan in a preamble
+func TestApproveFlags(t *testing.T) {
+	root := t.TempDir()
+	planJob(t, root, "job-20260101-000000-aaaaaaaa", "1. Split parse.go\n2. Add tests\n")
+
+	flags, err := cmd.ApproveFlags(root, "proj", "aaaaaaaa")
+	if err != nil {
+		t.Fatalf("ApproveFlags error: %v", err)
+	}
+	wantPrompt := "Execute the following approved plan:\n\n1. Split parse.go\n2. Add tests\n\nOriginal task:\nrefactor the parser"
+	if flags.Prompt != wantPrompt {
+		t.Errorf("Prompt = %q, want %q", flags.Prompt, wantPrompt)
+	}
+	if flags.PermissionMode != "acceptEdits" || flags.Dir != "/home/user/repo" || flags.OpusModel != "glm-5" || flags.HaikuModel != "glm-4.5-air" {
+		t.Errorf("Flags = %+v", flags)
+	}
+
+	ordinary := makeJobDir(t, root, "proj", "job-20260101-000000-bbbbbbbb", "done")
+	writeJobFile(t, ordinary, "permission_mode.txt", "acceptEdits")
+	failed := planJob(t, root, "job-20260101-000000-cccccccc", "1. Nothing")
+	writeJobFile(t, failed, "status", "failed")
+	planJob(t, root, "job-20260101-000000-dddddddd", "  \n")
+	for id, want := range map[string]string{
+		"job-20260101-000000-bbbbbbbb": "did not run in plan mode",
+		"job-20260101-000000-cccccccc": "is failed; only a done plan can be approved",
+		"job-20260101-000000-dddddddd": "printed no plan",
+		"job-20260101-000000-eeeeeeee": "err:not_found",
+	} {
+		if _, err := cmd.ApproveFlags(root, "proj", id); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ApproveFlags(%s) = %v, want %q", id, err, want)
+		}
+	}
+}
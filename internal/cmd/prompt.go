@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// JobPromptJSON is the JSON representation returned by "glm prompt --json".
+// ChainInjected is set for a chain step whose prompt starts with the
+// previous step's output; Template names the template a prompt was rendered
+// from, and TemplateExpanded is set when there is one.
+type JobPromptJSON struct {
+	ID               string `json:"id"`
+	CreatedAt        string `json:"created_at,omitempty"`
+	Prompt           string `json:"prompt"`
+	ChainInjected    bool   `json:"chain_injected"`
+	TemplateExpanded bool   `json:"template_expanded"`
+	Template         string `json:"template,omitempty"`
+}
+
+// JobPrompt returns the prompt jobID (a job ID or fragment, see
+// job.ResolveJobID) ran or will run with, whatever its status: prompt.txt
+// as written, or job.json's prompt for a queued job that has none yet. It
+// reads the job only, so the job is never reconciled or deleted.
+//
+// It returns err:not_found when the job does not exist.
+func JobPrompt(subagentsRoot, currentProjectID, jobID string) (JobPromptJSON, error) {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return JobPromptJSON{}, err
+	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return JobPromptJSON{}, errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+
+	m := job.LoadManifest(jobDir)
+	return JobPromptJSON{
+		ID:               jobID,
+		CreatedAt:        m.CreatedAt,
+		Prompt:           readPrompt(jobDir, m),
+		ChainInjected:    m.ChainInjected,
+		TemplateExpanded: m.Template != "",
+		Template:         m.Template,
+	}, nil
+}
+
+// readPrompt returns the job's prompt.txt unchanged, or m's prompt when
+// there is none.
+func readPrompt(jobDir string, m *job.Manifest) string {
+	if data, err := os.ReadFile(filepath.Join(jobDir, "prompt.txt")); err == nil {
+		return string(data)
+	}
+	return m.Prompt
+}
+
+// PromptCmd writes the prompt of jobID (see JobPrompt) to w verbatim.
+func PromptCmd(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
+	p, err := JobPrompt(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, p.Prompt)
+	return err
+}
+
+// PromptJSON writes the JobPromptJSON of jobID to w.
+func PromptJSON(subagentsRoot, currentProjectID, jobID string, w io.Writer) error {
+	p, err := JobPrompt(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return err
+	}
+	return JSONOutput(w, p)
+}
@@ -0,0 +1,109 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// Scenario: glm prompt prints prompt.txt verbatim for a queued, a running and a finished job, and keeps them
+func TestPromptCmd(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	done := makeJobDir(t, root, "proj", "job-20260101-000000-aaaaaaaa", "done")
+	writeJobFile(t, done, "prompt.txt", "  fix the bug\n\n")
+	running := makeJobDir(t, root, "other", "job-20260101-000100-bbbbbbbb", "running")
+	writeJobFile(t, running, "prompt.txt", "still going")
+	// A queued job has its prompt in job.json only.
+	queued := makeJobDir(t, root, "proj", "job-20260101-000200-cccccccc", "queued")
+	if err := job.UpdateManifest(queued, func(m *job.Manifest) { m.Prompt = "wait for it" }); err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, want := range map[string]string{
+		"aaaaaaaa":                     "  fix the bug\n\n",
+		"job-20260101-000100-bbbbbbbb": "still going",
+		"cccccccc":                     "wait for it",
+	} {
+		var buf bytes.Buffer
+		if err := cmd.PromptCmd(root, "proj", ref, &buf); err != nil {
+			t.Fatalf("PromptCmd(%s): %v", ref, err)
+		}
+		if buf.String() != want {
+			t.Errorf("PromptCmd(%s) = %q, want %q", ref, buf.String(), want)
+		}
+	}
+	for _, dir := range []string{done, running, queued} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("job dir gone after glm prompt: %v", err)
+		}
+	}
+
+	err := cmd.PromptCmd(root, "proj", "job-20260101-000300-dddddddd", &bytes.Buffer{})
+	if err == nil || !strings.HasPrefix(err.Error(), "err:not_found") {
+		t.Errorf("PromptCmd(missing) = %v, want err:not_found", err)
+	}
+}
+
+// Scenario: glm prompt --json and result --json report the prompt with its chain and template metadata
+func TestPromptJSON(t *testing.T) {
+	root := makeSubagentsRoot(t)
+	dir := makeJobDir(t, root, "proj", "job-20260101-000000-aaaaaaaa", "done")
+	prompt := cmd.BuildChainPrompt("step one output", "review it")
+	writeJobFile(t, dir, "prompt.txt", prompt)
+	if err := job.UpdateManifest(dir, func(m *job.Manifest) {
+		m.CreatedAt = "2026-01-01T00:00:00Z"
+		m.ChainInjected = true
+		m.Template = "review"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	plain := makeJobDir(t, root, "proj", "job-20260101-000100-bbbbbbbb", "done")
+	writeJobFile(t, plain, "prompt.txt", "as is")
+
+	var buf bytes.Buffer
+	if err := cmd.PromptJSON(root, "proj", "aaaaaaaa", &buf); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	want := map[string]any{
+		"id":                "job-20260101-000000-aaaaaaaa",
+		"created_at":        "2026-01-01T00:00:00Z",
+		"prompt":            prompt,
+		"chain_injected":    true,
+		"template_expanded": true,
+		"template":          "review",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	buf.Reset()
+	if err := cmd.PromptJSON(root, "proj", "bbbbbbbb", &buf); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["chain_injected"] != false || got["template_expanded"] != false || got["template"] != nil {
+		t.Errorf("plain job prompt JSON = %s", buf.String())
+	}
+
+	res, err := cmd.JobResult(root, "proj", "aaaaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Prompt != prompt {
+		t.Errorf("result prompt = %q, want %q", res.Prompt, prompt)
+	}
+}
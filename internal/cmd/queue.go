@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/slot"
+)
+
+// QueueLockFile is the lock file under subagentsRoot held while queued jobs
+// are promoted, so concurrent dispatchers never start more than max_parallel.
+const QueueLockFile = ".queue.lock"
+
+// LaunchFunc starts the job in jobDir, which is already "running", and
+// returns the PID of the process that executes it.
+type LaunchFunc func(jobDir string) (int, error)
+
+// QueueJob creates a queued job under subagentsRoot/projectID and records in
+// job.json the settings of spec a dispatcher needs to launch it later. The
+// workdir is stored as an absolute path since the launcher may run
+// elsewhere. Credentials are not stored; they are read from the config when
+// the job is launched.
+func QueueJob(subagentsRoot, projectID string, spec claude.Config) (*job.Job, error) {
+	workDir, err := filepath.Abs(spec.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	j, err := job.NewJob(subagentsRoot, projectID, job.GenerateJobID())
+	if err != nil {
+		return nil, err
+	}
+	err = job.UpdateManifest(j.Dir, func(m *job.Manifest) {
+		m.Prompt = spec.Prompt
+		m.WorkDir = workDir
+		m.PermissionMode = spec.PermissionMode
+		m.Models = job.Models{Opus: spec.OpusModel, Sonnet: spec.SonnetModel, Haiku: spec.HaikuModel}
+		m.TimeoutSecs = spec.TimeoutSecs
+		m.CaptureDiff = spec.CaptureDiff
+		m.StrictResult = spec.StrictResult
+		m.Confine = spec.Confine
+		m.BaseURL = spec.ZAIBaseURL
+		m.Priority = spec.Priority
+		m.Notify = spec.Notify
+		m.Template = spec.Template
+		m.Depth = spec.Depth
+		m.Invocation = spec.Invocation
+	})
+	if err != nil {
+		job.DeleteJob(j.Dir)
+		return nil, err
+	}
+	return j, nil
+}
+
+// DispatchOptions holds optional settings for DispatchQueued.
+type DispatchOptions struct {
+	// MaxParallelPerModel switches to per-model limits: each execution model
+	// may run up to its entry here, or maxParallel when it has none.
+	MaxParallelPerModel map[string]int
+	// PriorityAging raises a queued job's priority by one level for every
+	// PriorityAging it has waited (priority_aging; 0 = never), see
+	// job.EffectiveRank.
+	PriorityAging time.Duration
+	// Now is injectable for the aging (default time.Now).
+	Now func() time.Time
+}
+
+// DispatchQueued promotes queued jobs while fewer than maxParallel jobs are
+// running across all projects (0 = unlimited), or, with
+// DispatchOptions.MaxParallelPerModel, while the job's execution model has a
+// free slot; a full model does not hold back jobs of other models. Jobs with
+// a higher priority (see job.EffectiveRank) go first, and the oldest first
+// within a priority. Each promoted job is moved to "running" and handed to
+// launch; a job whose launch fails is marked "failed" with the error in
+// stderr.txt.
+//
+// Only jobs created by QueueJob are dispatched: a queued job without a
+// recorded prompt belongs to a glm run that is about to start it itself.
+// Running jobs whose process has died are reconciled to "failed" first so
+// they do not hold a slot.
+//
+// The whole pass runs under subagentsRoot/.queue.lock. Returns the number of
+// jobs started.
+func DispatchQueued(subagentsRoot string, maxParallel int, launch LaunchFunc, opts ...*DispatchOptions) (int, error) {
+	o := &DispatchOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	perModel := o.MaxParallelPerModel
+	now := time.Now
+	if o.Now != nil {
+		now = o.Now
+	}
+	// hasSlot reports whether one more job of model may run.
+	hasSlot := func(total int, byModel map[string]int, model string) bool {
+		if len(perModel) == 0 {
+			return maxParallel == 0 || total < maxParallel
+		}
+		limit := slot.LimitFor(model, maxParallel, perModel)
+		return limit == 0 || byModel[model] < limit
+	}
+
+	if err := os.MkdirAll(subagentsRoot, 0o755); err != nil {
+		return 0, err
+	}
+
+	started := 0
+	err := slot.WithFileLock(filepath.Join(subagentsRoot, QueueLockFile), func() error {
+		jobs, _ := scanAllJobs(subagentsRoot)
+
+		type queuedJob struct {
+			dir  string
+			m    *job.Manifest
+			rank int // see job.EffectiveRank
+		}
+		running := 0
+		byModel := map[string]int{}
+		var queued []queuedJob
+		for _, je := range jobs {
+			switch job.Status(je.Status) {
+			case job.StatusRunning:
+				if status, _ := job.CheckJobPID(je.Dir); status == string(job.StatusRunning) {
+					running++
+					byModel[job.LoadManifest(je.Dir).Models.Sonnet]++
+				}
+			case job.StatusQueued:
+				m := job.LoadManifest(je.Dir)
+				if m.Prompt != "" {
+					created, _ := job.ParseTimestamp(m.CreatedAt)
+					rank := job.EffectiveRank(m.Priority, created, now(), o.PriorityAging)
+					queued = append(queued, queuedJob{dir: je.Dir, m: m, rank: rank})
+				}
+			}
+		}
+
+		sort.Slice(queued, func(a, b int) bool {
+			if queued[a].rank != queued[b].rank {
+				return queued[a].rank > queued[b].rank
+			}
+			ma, mb := queued[a].m, queued[b].m
+			if ma.CreatedAt != mb.CreatedAt {
+				return ma.CreatedAt < mb.CreatedAt
+			}
+			return ma.ID < mb.ID
+		})
+
+		for _, q := range queued {
+			model := q.m.Models.Sonnet
+			if !hasSlot(running, byModel, model) {
+				continue
+			}
+			dir := q.dir
+
+			// Until the launched process reports its own PID, the job is
+			// owned by this (live) process, so PID checks keep it running.
+			if err := job.WritePID(dir, os.Getpid()); err != nil {
+				return err
+			}
+			if err := job.ClaimSlot(dir); err != nil {
+				// Killed while queued.
+				continue
+			}
+
+			pid, err := launch(dir)
+			if err != nil {
+				_ = job.AppendStderr(dir, fmt.Sprintf("Failed to launch queued job: %v", err))
+				_ = job.TransitionStatus(dir, job.StatusFailed)
+				continue
+			}
+			if err := job.WritePID(dir, pid); err != nil {
+				return err
+			}
+			running++
+			byModel[model]++
+			started++
+		}
+		return nil
+	})
+	return started, err
+}
@@ -0,0 +1,322 @@
+package cmd_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// ---------------------------------------------------------------------------
+// helpers
+// ---------------------------------------------------------------------------
+
+// queueJobs queues n jobs under root/proj and returns their directories.
+func queueJobs(t *testing.T, root string, n int) []string {
+	t.Helper()
+	dirs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		j, err := cmd.QueueJob(root, "proj", claude.Config{
+			Prompt:      "task",
+			WorkDir:     t.TempDir(),
+			SonnetModel: "glm-4.7",
+			TimeoutSecs: 60,
+		})
+		if err != nil {
+			t.Fatalf("QueueJob: %v", err)
+		}
+		dirs = append(dirs, j.Dir)
+	}
+	return dirs
+}
+
+// countStatus returns how many of dirs currently have status s.
+func countStatus(dirs []string, s job.Status) int {
+	n := 0
+	for _, d := range dirs {
+		if job.ReadStatus(d) == s {
+			n++
+		}
+	}
+	return n
+}
+
+// ---------------------------------------------------------------------------
+// Dispatch
+// ---------------------------------------------------------------------------
+
+// Scenario: Five starts with max_parallel=2 all finish, never more than two at once
+func TestDispatchQueuedRespectsMaxParallel(t *testing.T) {
+	root := t.TempDir()
+	dirs := queueJobs(t, root, 5)
+
+	var (
+		mu      sync.Mutex
+		maxSeen int
+		wg      sync.WaitGroup
+		launch  cmd.LaunchFunc
+	)
+	// Each launched job finishes shortly after and, like the worker process,
+	// promotes the next queued job.
+	launch = func(dir string) (int, error) {
+		mu.Lock()
+		if n := countStatus(dirs, job.StatusRunning); n > maxSeen {
+			maxSeen = n
+		}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(10 * time.Millisecond)
+			if err := job.TransitionStatus(dir, job.StatusDone); err != nil {
+				t.Errorf("finish %s: %v", dir, err)
+			}
+			if _, err := cmd.DispatchQueued(root, 2, launch); err != nil {
+				t.Errorf("DispatchQueued from finished job: %v", err)
+			}
+		}()
+		return os.Getpid(), nil
+	}
+
+	started, err := cmd.DispatchQueued(root, 2, launch)
+	if err != nil {
+		t.Fatalf("DispatchQueued: %v", err)
+	}
+	if started != 2 {
+		t.Errorf("first pass started %d jobs, want 2", started)
+	}
+	if got := countStatus(dirs, job.StatusQueued); got != 3 {
+		t.Errorf("queued after first pass = %d, want 3", got)
+	}
+
+	wg.Wait()
+
+	if got := countStatus(dirs, job.StatusDone); got != 5 {
+		t.Errorf("done = %d, want all 5", got)
+	}
+	if maxSeen > 2 {
+		t.Errorf("saw %d running jobs at once, max_parallel is 2", maxSeen)
+	}
+}
+
+// Scenario: The oldest queued job is promoted first; jobs without a launch spec are left alone
+func TestDispatchQueuedOldestFirst(t *testing.T) {
+	root := t.TempDir()
+	dirs := queueJobs(t, root, 2)
+	createdAt := []string{"2026-02-27T10:00:05Z", "2026-02-27T10:00:01Z"}
+	for i, d := range dirs {
+		if err := job.UpdateManifest(d, func(m *job.Manifest) { m.CreatedAt = createdAt[i] }); err != nil {
+			t.Fatalf("UpdateManifest: %v", err)
+		}
+	}
+	// A glm run job between NewJob and its own transition to running.
+	bare, err := job.NewJob(root, "proj", "job-20260227-095959-aaaa0001")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+
+	var launched []string
+	launch := func(dir string) (int, error) {
+		launched = append(launched, dir)
+		return os.Getpid(), nil
+	}
+	if _, err := cmd.DispatchQueued(root, 1, launch); err != nil {
+		t.Fatalf("DispatchQueued: %v", err)
+	}
+
+	if len(launched) != 1 || launched[0] != dirs[1] {
+		t.Fatalf("launched %v, want only the oldest job %s", launched, dirs[1])
+	}
+	if got := job.ReadStatus(dirs[0]); got != job.StatusQueued {
+		t.Errorf("newer job status = %s, want queued", got)
+	}
+	if got := job.ReadStatus(bare.Dir); got != job.StatusQueued {
+		t.Errorf("job without launch spec status = %s, want queued", got)
+	}
+	if m := job.LoadManifest(dirs[1]); m.PID != os.Getpid() {
+		t.Errorf("promoted job PID = %d, want the launcher's PID %d", m.PID, os.Getpid())
+	}
+}
+
+// Scenario: A job that cannot be launched fails and frees its slot
+func TestDispatchQueuedLaunchFailure(t *testing.T) {
+	root := t.TempDir()
+	dirs := queueJobs(t, root, 2)
+
+	calls := 0
+	launch := func(dir string) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, errors.New("exec: no such file")
+		}
+		return os.Getpid(), nil
+	}
+	started, err := cmd.DispatchQueued(root, 1, launch)
+	if err != nil {
+		t.Fatalf("DispatchQueued: %v", err)
+	}
+	if started != 1 {
+		t.Errorf("started = %d, want 1", started)
+	}
+	if got := countStatus(dirs, job.StatusFailed); got != 1 {
+		t.Errorf("failed = %d, want 1", got)
+	}
+	if got := countStatus(dirs, job.StatusRunning); got != 1 {
+		t.Errorf("running = %d, want 1", got)
+	}
+	for _, d := range dirs {
+		if job.ReadStatus(d) != job.StatusFailed {
+			continue
+		}
+		data, _ := os.ReadFile(filepath.Join(d, "stderr.txt"))
+		if !strings.Contains(string(data), "Failed to launch queued job: exec: no such file") {
+			t.Errorf("stderr.txt = %q", data)
+		}
+	}
+}
+
+// Scenario: A queued job killed before dispatch is never launched
+func TestDispatchQueuedSkipsKilledJobs(t *testing.T) {
+	root := t.TempDir()
+	dirs := queueJobs(t, root, 1)
+	jobID := job.LoadManifest(dirs[0]).ID
+
+	if err := cmd.KillCmd(root, "proj", jobID, noopSignal, noopSleep); err != nil {
+		t.Fatalf("KillCmd: %v", err)
+	}
+	launch := func(dir string) (int, error) {
+		t.Errorf("launched killed job %s", dir)
+		return os.Getpid(), nil
+	}
+	if _, err := cmd.DispatchQueued(root, 0, launch); err != nil {
+		t.Fatalf("DispatchQueued: %v", err)
+	}
+	if got := job.ReadStatus(dirs[0]); got != job.StatusKilled {
+		t.Errorf("status = %s, want killed", got)
+	}
+}
+
+// Scenario: With per-model limits a full model does not hold back other models
+func TestDispatchQueuedPerModelLimits(t *testing.T) {
+	root := t.TempDir()
+	var dirs []string
+	for _, model := range []string{"glm-5", "glm-5", "glm-4.7", "glm-4.7", "glm-4.7"} {
+		j, err := cmd.QueueJob(root, "proj", claude.Config{Prompt: "task", WorkDir: t.TempDir(), SonnetModel: model})
+		if err != nil {
+			t.Fatalf("QueueJob: %v", err)
+		}
+		dirs = append(dirs, j.Dir)
+	}
+
+	launch := func(dir string) (int, error) { return os.Getpid(), nil }
+	opts := &cmd.DispatchOptions{MaxParallelPerModel: map[string]int{"glm-5": 1}}
+	started, err := cmd.DispatchQueued(root, 2, launch, opts)
+	if err != nil {
+		t.Fatalf("DispatchQueued: %v", err)
+	}
+
+	// glm-5 is capped at 1; glm-4.7 falls back to max_parallel=2.
+	if started != 3 {
+		t.Errorf("started = %d, want 3", started)
+	}
+	if got := countStatus(dirs[:2], job.StatusRunning); got != 1 {
+		t.Errorf("running glm-5 jobs = %d, want 1", got)
+	}
+	if got := countStatus(dirs[2:], job.StatusRunning); got != 2 {
+		t.Errorf("running glm-4.7 jobs = %d, want 2", got)
+	}
+}
+
+// Scenario: With max_parallel=1 a high priority job queued after a low one gets the slot first
+func TestDispatchQueuedPriority(t *testing.T) {
+	root := t.TempDir()
+	var dirs []string
+	for _, p := range []job.Priority{job.PriorityLow, job.PriorityHigh} {
+		j, err := cmd.QueueJob(root, "proj", claude.Config{Prompt: "task", WorkDir: t.TempDir(), Priority: p})
+		if err != nil {
+			t.Fatalf("QueueJob: %v", err)
+		}
+		dirs = append(dirs, j.Dir)
+	}
+	if got := job.LoadManifest(dirs[0]).Priority; got != job.PriorityLow {
+		t.Errorf("recorded priority = %q, want low", got)
+	}
+
+	var launched []string
+	launch := func(dir string) (int, error) {
+		launched = append(launched, dir)
+		return os.Getpid(), nil
+	}
+	if _, err := cmd.DispatchQueued(root, 1, launch); err != nil {
+		t.Fatalf("DispatchQueued: %v", err)
+	}
+	if len(launched) != 1 || launched[0] != dirs[1] {
+		t.Fatalf("launched %v, want only the high priority job %s", launched, dirs[1])
+	}
+
+	// The high job finishing frees the slot for the low one.
+	if err := job.TransitionStatus(dirs[1], job.StatusDone); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmd.DispatchQueued(root, 1, launch); err != nil {
+		t.Fatalf("DispatchQueued: %v", err)
+	}
+	if len(launched) != 2 || launched[1] != dirs[0] {
+		t.Errorf("launched %v, want the low priority job next", launched)
+	}
+}
+
+// Scenario: A low priority job that has waited two aging intervals is promoted before a new normal one
+func TestDispatchQueuedPriorityAging(t *testing.T) {
+	now := time.Date(2026, 2, 27, 10, 20, 0, 0, time.UTC)
+	// dispatch queues a low job created at 10:00 and a normal one created at
+	// 10:19, promotes one with max_parallel=1 at 10:20 and reports whether
+	// it was the low job.
+	dispatch := func(aging time.Duration) bool {
+		t.Helper()
+		root := t.TempDir()
+		var low string
+		for _, q := range []struct {
+			p       job.Priority
+			created string
+		}{{job.PriorityLow, "2026-02-27T10:00:00Z"}, {job.PriorityNormal, "2026-02-27T10:19:00Z"}} {
+			j, err := cmd.QueueJob(root, "proj", claude.Config{Prompt: "task", WorkDir: t.TempDir(), Priority: q.p})
+			if err != nil {
+				t.Fatalf("QueueJob: %v", err)
+			}
+			if err := job.UpdateManifest(j.Dir, func(m *job.Manifest) { m.CreatedAt = q.created }); err != nil {
+				t.Fatalf("UpdateManifest: %v", err)
+			}
+			if q.p == job.PriorityLow {
+				low = j.Dir
+			}
+		}
+		var launched string
+		launch := func(dir string) (int, error) {
+			launched = dir
+			return os.Getpid(), nil
+		}
+		opts := &cmd.DispatchOptions{PriorityAging: aging, Now: func() time.Time { return now }}
+		if _, err := cmd.DispatchQueued(root, 1, launch, opts); err != nil {
+			t.Fatalf("DispatchQueued: %v", err)
+		}
+		return launched == low
+	}
+	if dispatch(0) {
+		t.Error("without aging the low job was promoted, want the normal job")
+	}
+	if !dispatch(10 * time.Minute) {
+		t.Error("with 10m aging the normal job was promoted, want the low job that waited 20m")
+	}
+	if dispatch(30 * time.Minute) {
+		t.Error("with 30m aging the low job was promoted before waiting a full interval")
+	}
+}
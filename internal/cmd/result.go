@@ -4,34 +4,95 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/errs"
 	"github.com/veschin/GoLeM/internal/job"
 )
 
+// ResultOptions controls what ResultCmd prints, copies, and deletes.
+type ResultOptions struct {
+	// Output, when non-empty, receives copies of stdout.txt, stderr.txt and
+	// changelog.txt before the job directory is deleted. An existing
+	// directory (or a path ending in a separator) gets the three files under
+	// their original names; any other path is written as the stdout copy with
+	// FILE.stderr.txt and FILE.changelog.txt alongside it.
+	Output string
+	// StdoutOnly prints stdout.txt and nothing else (no stderr warning).
+	StdoutOnly bool
+	// ChangelogOnly prints changelog.txt to stdout and nothing else.
+	ChangelogOnly bool
+	// Keep skips the auto-delete so the job directory survives.
+	Keep bool
+	// RetentionDays prunes retained finished jobs older than this many days
+	// when Keep is set (0 disables pruning).
+	RetentionDays int
+	// StrictResult fails a done job whose stdout.txt contains one of
+	// FailureMarkers (see ApplyStrictResult), and makes ResultCmd exit 1
+	// for every job that did not end done.
+	StrictResult   bool
+	FailureMarkers []string
+	// MaxOutput caps the bytes of stdout.txt printed (0 = no limit); see
+	// PrintLimited. A cut job is kept unless Output copies it, so its full
+	// output stays on disk.
+	MaxOutput int
+}
+
 // ResultResult holds the outcome of a ResultCmd call.
 type ResultResult struct {
-	// Stdout is the content printed to stdout (from stdout.txt).
+	// Stdout is the content of stdout.txt; with MaxOutput only its start
+	// may have been printed.
 	Stdout string
 	// Stderr is the content printed to stderr (from stderr.txt, as a warning).
 	Stderr string
-	// ExitCode is 0 on success, 1 on user error, 3 if not found.
+	// ExitCode is 0 on success, 1 on user error (or, with StrictResult, a
+	// job that did not end done), 3 if not found.
 	ExitCode int
 	// Deleted is true if the job directory was auto-deleted.
 	Deleted bool
+	// JobDir is the job directory; it only exists afterwards if Deleted is false.
+	JobDir string
 }
 
+// ContextExceededHint is printed to stderr by glm result for a job whose
+// prompt did not fit the model's context window.
+const ContextExceededHint = "glm: the prompt exceeded the model's context window; retrying it unchanged will fail again. Split the task into smaller jobs or run it as a chain (glm chain)."
+
 // ResultCmd retrieves and prints the output of a completed job:
 //   - Returns err:user "Job is still running" (exit 1) if status == running.
 //   - Returns err:user "Job is still queued" (exit 1) if status == queued.
-//   - For failed / timeout / permission_error: prints stderr.txt to stderr as a
-//     warning and stdout.txt to stdout, then auto-deletes the job directory.
+//   - For failed / timeout / permission_error / context_exceeded: prints
+//     stderr.txt to stderr as a warning and stdout.txt to stdout, then
+//     auto-deletes the job directory. A context_exceeded job is followed by
+//     ContextExceededHint.
 //   - For done: prints stdout.txt to stdout and auto-deletes the job directory.
+//   - For a plan-mode job (see IsPlanJob): also prints PlanNotice to stderr.
 //   - Returns exit code 3 with err:not_found if the job does not exist.
-func ResultCmd(jobID, subagentsRoot, currentProjectID string, stdout, stderr io.Writer) (*ResultResult, error) {
+//   - jobID may be a unique part of a job ID (see job.ResolveJobID); a
+//     malformed or ambiguous ID returns err:user (exit 1).
+//
+// An optional ResultOptions restricts the printed streams, caps the printed
+// stdout, copies the job output to a destination, or keeps the job directory.
+func ResultCmd(jobID, subagentsRoot, currentProjectID string, stdout, stderr io.Writer, opts ...*ResultOptions) (*ResultResult, error) {
+	o := &ResultOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	if o.StdoutOnly && o.ChangelogOnly {
+		return &ResultResult{ExitCode: 1}, errs.User(`"--stdout-only and --changelog-only are mutually exclusive"`)
+	}
+
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return &ResultResult{ExitCode: 1}, err
+	}
+
 	// Find the job directory
 	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
 	if err != nil {
-		return &ResultResult{ExitCode: 3}, fmt.Errorf(`err:not_found "Job not found: %s"`, jobID)
+		return &ResultResult{ExitCode: 3}, errs.NotFound(`"Job not found: %s"`, jobID)
 	}
 
 	// Read the status
@@ -39,30 +100,192 @@ func ResultCmd(jobID, subagentsRoot, currentProjectID string, stdout, stderr io.
 
 	// Check if job is still running or queued
 	if status == job.StatusRunning {
-		return &ResultResult{ExitCode: 1}, fmt.Errorf(`err:user "Job is still running"`)
+		return &ResultResult{ExitCode: 1}, errs.User(`"Job is still running"`)
 	}
 	if status == job.StatusQueued {
-		return &ResultResult{ExitCode: 1}, fmt.Errorf(`err:user "Job is still queued"`)
+		return &ResultResult{ExitCode: 1}, errs.User(`"Job is still queued"`)
 	}
 
-	// Read stdout.txt
-	stdoutData, _ := os.ReadFile(jobDir + "/stdout.txt")
-	fmt.Fprint(stdout, string(stdoutData))
+	if o.StrictResult && status == job.StatusDone {
+		if status = job.Status(ApplyStrictResult(jobDir, string(status), o.FailureMarkers)); status != job.StatusDone {
+			if err := job.WriteStatus(jobDir, status); err != nil {
+				return &ResultResult{ExitCode: 1}, err
+			}
+		}
+	}
 
-	// For failed/timeout/permission_error, print stderr.txt as warning
-	if status == job.StatusFailed || status == job.StatusTimeout || status == job.StatusPermissionError {
-		stderrData, _ := os.ReadFile(jobDir + "/stderr.txt")
-		if len(stderrData) > 0 {
-			fmt.Fprint(stderr, string(stderrData))
+	// Copy artifacts first so a failed copy never loses the job output.
+	if o.Output != "" {
+		if err := copyResultFiles(jobDir, o.Output); err != nil {
+			return &ResultResult{ExitCode: 1}, err
 		}
 	}
 
-	// Auto-delete the job directory
-	job.DeleteJob(jobDir)
+	res := &ResultResult{ExitCode: 0, JobDir: jobDir}
+	truncated := false
+	if o.StrictResult && status != job.StatusDone {
+		res.ExitCode = 1
+	}
+
+	if o.ChangelogOnly {
+		changelogData, _ := os.ReadFile(filepath.Join(jobDir, "changelog.txt"))
+		fmt.Fprint(stdout, string(changelogData))
+	} else {
+		if !o.StdoutOnly && IsPlanJob(jobDir) {
+			fmt.Fprintln(stderr, PlanNotice)
+		}
+
+		// Read stdout.txt
+		stdoutData, _ := os.ReadFile(jobDir + "/stdout.txt")
+		full := filepath.Join(jobDir, "stdout.txt")
+		if o.Output != "" {
+			full = outputTarget(o.Output, "stdout.txt")
+		}
+		// A cut output must stay readable in full somewhere.
+		truncated = PrintLimited(stdout, stderr, string(stdoutData), o.MaxOutput, full)
+		res.Stdout = string(stdoutData)
 
-	return &ResultResult{
-		Stdout:   string(stdoutData),
-		ExitCode: 0,
-		Deleted:  true,
-	}, nil
+		// For failed/timeout/permission_error/context_exceeded, print stderr.txt as warning
+		if !o.StdoutOnly && isFailureStatus(string(status)) {
+			stderrData, _ := os.ReadFile(jobDir + "/stderr.txt")
+			if len(stderrData) > 0 {
+				fmt.Fprint(stderr, string(stderrData))
+				res.Stderr = string(stderrData)
+			}
+		}
+		if !o.StdoutOnly && status == job.StatusContextExceeded {
+			fmt.Fprintln(stderr, ContextExceededHint)
+		}
+	}
+
+	// Point at the captured diff; the summary is read first because the job
+	// directory may be deleted below.
+	diffSummary := ""
+	if !o.StdoutOnly && !o.ChangelogOnly {
+		diffSummary = readDiffSummary(jobDir)
+	}
+
+	// Auto-delete the job directory (or keep it, per retention policy)
+	keep := o.Keep || truncated && o.Output == ""
+	res.Deleted = FinishJob(jobDir, subagentsRoot, keep, o.RetentionDays)
+
+	if diffSummary != "" {
+		if res.Deleted {
+			fmt.Fprintf(stderr, "glm: diff: %s (diff.patch was deleted with the job; use --keep to retain it)\n", diffSummary)
+		} else {
+			fmt.Fprintf(stderr, "glm: diff: %s (%s)\n", filepath.Join(jobDir, "diff.patch"), diffSummary)
+		}
+	}
+
+	return res, nil
+}
+
+// ApplyStrictResult returns the status of a job that ended with status once
+// its result is checked against markers: a done job whose stdout.txt
+// contains one of them is failed instead, with a "[GoLeM] Result matched
+// failure marker" line appended to its stderr.txt. Other statuses are
+// returned unchanged. The caller records the returned status.
+func ApplyStrictResult(jobDir, status string, markers []string) string {
+	if status != string(job.StatusDone) {
+		return status
+	}
+	stdout, _ := os.ReadFile(filepath.Join(jobDir, "stdout.txt"))
+	marker, ok := claude.MatchFailureMarker(string(stdout), markers)
+	if !ok {
+		return status
+	}
+	_ = job.AppendStderr(jobDir, fmt.Sprintf("Result matched failure marker %q", marker))
+	return string(job.StatusFailed)
+}
+
+// ResumeHintCmd prints the command that continues the claude conversation of
+// a job interactively: "claude --resume <session ID>", after a cd into the
+// job's workdir when one is recorded. jobID is resolved as for ResultCmd.
+func ResumeHintCmd(jobID, subagentsRoot, currentProjectID string, w io.Writer) error {
+	m, err := jobSession(jobID, subagentsRoot, currentProjectID)
+	if err != nil {
+		return err
+	}
+	hint := "claude --resume " + shellQuote(m.SessionID)
+	if m.WorkDir != "" {
+		hint = "cd " + shellQuote(m.WorkDir) + " && " + hint
+	}
+	_, err = fmt.Fprintln(w, hint)
+	return err
+}
+
+// jobSession returns the manifest of the job jobID refers to. It returns
+// err:not_found when the job does not exist or has no session ID: it is
+// still running, or its claude CLI did not report one.
+func jobSession(jobID, subagentsRoot, currentProjectID string) (*job.Manifest, error) {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return nil, err
+	}
+	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
+	if err != nil {
+		return nil, errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+	m := job.LoadManifest(jobDir)
+	if m.SessionID == "" {
+		return nil, errs.NotFound(`"No claude session recorded for job %s"`, jobID)
+	}
+	return m, nil
+}
+
+// readDiffSummary returns the last line of the job's diff_stat.txt (e.g.
+// "2 files changed, 5 insertions(+)"), or "" when no diff was captured.
+func readDiffSummary(jobDir string) string {
+	data, err := os.ReadFile(filepath.Join(jobDir, "diff_stat.txt"))
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// copyResultFiles writes copies of the job's stdout, stderr and changelog to
+// dest. Missing source files are copied as empty files so the destination
+// layout is always complete.
+func copyResultFiles(jobDir, dest string) error {
+	names := []string{"stdout.txt", "stderr.txt", "changelog.txt"}
+
+	if outputIsDir(dest) {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return errs.User(`"Cannot create output directory: %s"`, dest)
+		}
+	} else if dir := filepath.Dir(dest); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errs.User(`"Cannot create output directory: %s"`, dir)
+		}
+	}
+
+	for _, name := range names {
+		data, _ := os.ReadFile(filepath.Join(jobDir, name))
+		target := outputTarget(dest, name)
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return errs.User(`"Cannot write output file: %s"`, target)
+		}
+	}
+	return nil
+}
+
+// outputIsDir reports whether --output dest names a directory: an existing
+// one, or a path ending in a separator.
+func outputIsDir(dest string) bool {
+	info, err := os.Stat(dest)
+	return (err == nil && info.IsDir()) || strings.HasSuffix(dest, string(os.PathSeparator))
+}
+
+// outputTarget returns the file copyResultFiles writes the job file name
+// (stdout.txt, stderr.txt or changelog.txt) to for --output dest.
+func outputTarget(dest, name string) string {
+	switch {
+	case outputIsDir(dest):
+		return filepath.Join(dest, name)
+	case name == "stdout.txt":
+		return dest
+	default:
+		return dest + "." + name
+	}
 }
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// FinishJob applies the retention policy to a job whose output has been
+// consumed. Without keep the directory is deleted immediately (the historical
+// behaviour), unless it is a done plan-mode job: glm result --approve still
+// needs it, and FinishPlan removes it once the plan has been carried out.
+// With keep it stays on disk, and when retentionDays > 0 any finished jobs
+// older than that are pruned from subagentsRoot.
+// Returns true if jobDir was deleted.
+func FinishJob(jobDir, subagentsRoot string, keep bool, retentionDays int) bool {
+	if !keep && awaitsApproval(jobDir) {
+		return false
+	}
+	if !keep {
+		job.DeleteJob(jobDir)
+		return true
+	}
+	if retentionDays > 0 {
+		PruneExpiredJobs(subagentsRoot, retentionDays, time.Now())
+	}
+	return false
+}
+
+// PruneExpiredJobs removes terminal-status jobs whose directory mtime is older
+// than now minus days*24h. Both the project-scoped and the legacy flat layouts
+// are scanned; queued and running jobs are never touched.
+// Returns the number of removed jobs.
+func PruneExpiredJobs(subagentsRoot string, days int, now time.Time) int {
+	entries, err := os.ReadDir(subagentsRoot)
+	if err != nil {
+		return 0
+	}
+
+	cutoff := now.Add(-time.Duration(days) * 24 * time.Hour)
+	count := 0
+
+	prune := func(jobDir string) {
+		statusData, err := os.ReadFile(filepath.Join(jobDir, "status"))
+		if err != nil || !terminalStatuses[strings.TrimSpace(string(statusData))] {
+			return
+		}
+		info, err := os.Stat(jobDir)
+		if err != nil || info.ModTime().After(cutoff) {
+			return
+		}
+		if err := job.DeleteJob(jobDir); err == nil {
+			count++
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(subagentsRoot, entry.Name())
+
+		// Legacy flat layout: subagentsRoot/jobID
+		if _, err := os.Stat(filepath.Join(dir, "status")); err == nil {
+			prune(dir)
+			continue
+		}
+
+		// Project-scoped layout: subagentsRoot/projectID/jobID
+		jobDirs, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, jd := range jobDirs {
+			if jd.IsDir() {
+				prune(filepath.Join(dir, jd.Name()))
+			}
+		}
+	}
+	return count
+}
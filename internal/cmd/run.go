@@ -7,8 +7,10 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/log"
 )
 
 // RunResult holds the outcome of a RunCmd call.
@@ -19,8 +21,34 @@ type RunResult struct {
 	Stderr string
 	// ExitCode is the mapped exit code from the claude subprocess.
 	ExitCode int
-	// JobID is the ID of the job that was created and auto-deleted.
+	// JobID is the ID of the job that was created.
 	JobID string
+	// JobDir is the job directory; it only exists afterwards if Deleted is false.
+	JobDir string
+	// Deleted is true if the job directory was auto-deleted.
+	Deleted bool
+}
+
+// RunOptions controls what RunCmd does with the job directory afterwards.
+type RunOptions struct {
+	// Keep retains the job directory instead of auto-deleting it.
+	Keep bool
+	// RetentionDays prunes retained finished jobs older than this many days
+	// when Keep is set (0 disables pruning).
+	RetentionDays int
+	// Summary prints the RunSummary line to stderr after the job output.
+	Summary bool
+	// Out is the output policy; its writers, when set, replace stdout and
+	// stderr, and with Out.Quiet the changelog and the summary line are not
+	// printed. Nil prints everything.
+	Out *Out
+	// MaxOutput caps the bytes of stdout.txt printed (max_output_bytes; 0 =
+	// no limit) unless Flags.MaxOutput sets its own cap; see PrintLimited. A
+	// job whose output is cut is kept, so stdout.txt still has all of it.
+	MaxOutput int
+	// Log receives the job's debug lines with its job_id field (nil =
+	// none).
+	Log *log.Logger
 }
 
 // execFunc is the function that executes the actual claude command.
@@ -32,10 +60,19 @@ type execFunc func(f *Flags, jobDir string) (int, error)
 //  2. Writes the current PID to pid.txt.
 //  3. Waits for a concurrency slot.
 //  4. Executes the claude CLI with the given flags.
-//  5. Prints stdout.txt to stdout, changelog and stderr.txt to stderr.
-//  6. Auto-deletes the job directory.
+//  5. Prints stdout.txt to stdout (cut at the --max-output cap), changelog
+//     and stderr.txt to stderr.
+//  6. Auto-deletes the job directory unless Keep is requested or the output
+//     was cut.
 //  7. Returns the mapped exit code.
-func RunCmd(f *Flags, subagentsRoot, projectID string, stdout, stderr io.Writer) (*RunResult, error) {
+func RunCmd(f *Flags, subagentsRoot, projectID string, stdout, stderr io.Writer, opts ...*RunOptions) (*RunResult, error) {
+	o := &RunOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	out := resolveOut(o.Out, stdout, stderr)
+	stdout, stderr = out.Stdout, out.Stderr
+
 	var jobID string
 	var j *job.Job
 	var jobDir string
@@ -62,20 +99,21 @@ func RunCmd(f *Flags, subagentsRoot, projectID string, stdout, stderr io.Writer)
 
 	// If no existing job, create a new one
 	if j == nil {
-		jobID = job.GenerateJobID()
-		j, err = job.NewJob(subagentsRoot, projectID, jobID)
+		j, err = job.NewJob(subagentsRoot, projectID, job.GenerateJobID())
 		if err != nil {
 			return nil, err
 		}
+		jobID = j.ID
 		jobDir = j.Dir
 	}
 
 	// Write current PID to pid.txt
-	pid := os.Getpid()
-	if err := os.WriteFile(filepath.Join(jobDir, "pid.txt"), []byte(fmt.Sprintf("%d", pid)), 0o644); err != nil {
+	if err := job.WritePID(jobDir, os.Getpid()); err != nil {
 		job.DeleteJob(jobDir)
 		return nil, err
 	}
+	jobLog := o.Log.With(log.Fields{"job_id": jobID})
+	jobLog.With(log.Fields{"project_id": projectID, "workdir": f.Dir, "id_retries": j.IDRetries}).Debug("job created")
 
 	// Execute the command (placeholder - in production this would run claude)
 	// For tests, we simulate by checking if job was pre-created with outputs
@@ -94,25 +132,64 @@ func RunCmd(f *Flags, subagentsRoot, projectID string, stdout, stderr io.Writer)
 	changelogData, _ := os.ReadFile(changelogPath)
 
 	// Print stdout.txt to stdout
-	if len(stdoutData) > 0 {
-		fmt.Fprint(stdout, string(stdoutData))
+	maxOutput := f.MaxOutput
+	if maxOutput == 0 {
+		maxOutput = o.MaxOutput
 	}
+	truncated := PrintLimited(stdout, stderr, string(stdoutData), maxOutput, stdoutPath)
 
 	// Print changelog and stderr.txt to stderr
-	if len(changelogData) > 0 {
+	if len(changelogData) > 0 && !out.Quiet {
 		fmt.Fprint(stderr, string(changelogData))
 	}
 	if len(stderrData) > 0 {
 		fmt.Fprint(stderr, string(stderrData))
 	}
 
-	// Auto-delete the job directory
-	job.DeleteJob(jobDir)
+	if o.Summary && !out.Quiet {
+		// The summary always starts its own line.
+		last := stderrData
+		if len(last) == 0 {
+			last = changelogData
+		}
+		if len(last) > 0 && last[len(last)-1] != '\n' {
+			fmt.Fprintln(stderr)
+		}
+		fmt.Fprintln(stderr, RunSummary(jobDir, jobID, exitCode))
+	}
+
+	jobLog.With(log.Fields{"exit_code": exitCode}).Debug("job finished")
+
+	// Auto-delete the job directory (or keep it, per retention policy)
+	deleted := FinishJob(jobDir, subagentsRoot, o.Keep || f.Keep || truncated, o.RetentionDays)
 
 	return &RunResult{
 		Stdout:   string(stdoutData),
 		Stderr:   string(stderrData),
 		ExitCode: exitCode,
 		JobID:    jobID,
+		JobDir:   jobDir,
+		Deleted:  deleted,
 	}, nil
 }
+
+// RunSummary returns the single summary line "glm run --summary" prints to
+// stderr for CI wrappers, derived from the artifacts in jobDir:
+//
+//	glm: job=<id> status=<status> duration=<N>s files_changed=<N> exit=<code>
+//
+// duration is 0 when the job's timing is unknown. files_changed counts the
+// changelog.txt entries (see ParseChangelog).
+func RunSummary(jobDir, jobID string, exitCode int) string {
+	status := string(job.ReadStatus(jobDir))
+	duration := 0
+	if t := readJobTiming(jobDir, job.LoadManifest(jobDir), status, time.Now()); t.DurationSeconds != nil {
+		duration = *t.DurationSeconds
+	}
+
+	changelog, _ := os.ReadFile(filepath.Join(jobDir, "changelog.txt"))
+	filesChanged := len(ParseChangelog(string(changelog)))
+
+	return fmt.Sprintf("glm: job=%s status=%s duration=%ds files_changed=%d exit=%d",
+		jobID, status, duration, filesChanged, exitCode)
+}
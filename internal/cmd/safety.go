@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// systemPaths are directories a bypassPermissions job must never run in,
+// nor anywhere below them.
+var systemPaths = []string{"/etc", "/usr", "/bin", "/sbin", "/lib", "/boot", "/dev", "/proc", "/sys", "/var"}
+
+// SafetyOptions provides testable inputs for SafetyCheck.
+type SafetyOptions struct {
+	// AllowUnsafePaths disables the check (--i-know-what-im-doing or
+	// allow_unsafe_paths = true).
+	AllowUnsafePaths bool
+	// Home is the user's home directory. Empty uses os.UserHomeDir.
+	Home string
+}
+
+// SafetyCheck refuses to run a bypassPermissions job in a directory where a
+// typo would be costly: the filesystem root, a system path, the home
+// directory itself, or anywhere outside home. Symlinks in dir and home are
+// resolved first. Other permission modes are not checked.
+//
+// It returns an error of the form:
+//
+//	err:user "Refusing to run with bypassPermissions in <path>: <reason> (...)"
+func SafetyCheck(dir, permissionMode string, opts ...*SafetyOptions) error {
+	o := &SafetyOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+	if permissionMode != "bypassPermissions" || o.AllowUnsafePaths {
+		return nil
+	}
+
+	path, err := resolvePath(dir)
+	if err != nil {
+		return errs.User(`"Cannot resolve working directory %s: %v"`, dir, err)
+	}
+
+	home := o.Home
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	if home != "" {
+		home, _ = resolvePath(home)
+	}
+
+	if reason := unsafePathReason(path, home); reason != "" {
+		return errs.User(`"Refusing to run with bypassPermissions in %s: %s (pass --i-know-what-im-doing or set allow_unsafe_paths = true to override)"`, path, reason)
+	}
+	return nil
+}
+
+// unsafePathReason says why path is unsafe for a bypassPermissions job, or
+// returns "" if it is a normal project path under home. With an unknown (or
+// root) home only the filesystem root and system paths are refused.
+func unsafePathReason(path, home string) string {
+	if path == "/" {
+		return "it is the filesystem root"
+	}
+	knownHome := home != "" && home != "/"
+	if knownHome {
+		if path == home {
+			return "it is your home directory itself"
+		}
+		if isWithin(path, home) {
+			return ""
+		}
+	}
+	for _, sys := range systemPaths {
+		// Some systems link system paths elsewhere (macOS /etc ->
+		// /private/etc), so compare both forms.
+		resolved, err := filepath.EvalSymlinks(sys)
+		if err != nil {
+			resolved = sys
+		}
+		if isWithin(path, sys) || isWithin(path, resolved) {
+			return "it is a system path"
+		}
+	}
+	if knownHome {
+		return "it is outside your home directory " + home
+	}
+	return ""
+}
+
+// resolvePath makes dir absolute and resolves its symlinks.
+func resolvePath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// isWithin reports whether path is dir or below it.
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// DefaultServeAddr is where glm serve listens without --addr. It is bound to
+// localhost only: the read endpoints need no authentication.
+const DefaultServeAddr = "127.0.0.1:7777"
+
+// serveShutdownTimeout bounds how long ServeCmd waits for in-flight requests
+// after it is told to stop.
+const serveShutdownTimeout = 5 * time.Second
+
+// Limits for POST /jobs: the largest request body accepted, and how often a
+// synchronous submission checks whether its job has finished.
+const (
+	maxSubmitBodyBytes  = 8 << 20
+	defaultPollInterval = 500 * time.Millisecond
+)
+
+// SubmitRequest is the body of POST /jobs. Dir must be an absolute path;
+// Timeout is in seconds, zero meaning default_timeout. With Async the
+// response is 202 with the queued job's status; otherwise the request waits
+// for the job and returns its result.
+// The desc tags describe the fields in the glm mcp tool schemas.
+type SubmitRequest struct {
+	Prompt         string `json:"prompt" desc:"Task for the agent"`
+	Dir            string `json:"dir" desc:"Absolute path of the working directory"`
+	Timeout        int    `json:"timeout,omitempty" desc:"Timeout in seconds (default: default_timeout)"`
+	Model          string `json:"model,omitempty" desc:"Model for all tiers (default: the configured models)"`
+	PermissionMode string `json:"permission_mode,omitempty" desc:"bypassPermissions, acceptEdits, default or plan"`
+	Async          bool   `json:"async,omitempty" desc:"Return the queued job instead of waiting for its result"`
+}
+
+// SubmitFunc queues a job for f the way glm start does: default timeout,
+// Validate, the workdir safety check, QueueJob and a dispatch pass.
+type SubmitFunc func(f *Flags) (*job.Job, error)
+
+// ServeOptions configures NewServeHandler and ServeCmd.
+type ServeOptions struct {
+	// SubagentsRoot is the directory holding all project job directories.
+	SubagentsRoot string
+	// ProjectID is the project preferred when resolving a job ID, like the
+	// current project of the CLI commands.
+	ProjectID string
+	// Doctor configures the checks reported on /healthz (see HealthChecks).
+	Doctor DoctorOptions
+	// Now is injectable for the since filter (default time.Now).
+	Now func() time.Time
+	// Token is the serve_token that POST /jobs and DELETE /jobs/{id} require
+	// as "Authorization: Bearer <token>". Empty refuses them with 403.
+	Token string
+	// Submit queues the job for POST /jobs.
+	Submit SubmitFunc
+	// Kill stops a job for DELETE /jobs/{id}, like glm kill.
+	Kill func(jobID string) error
+	// PollInterval is how often a synchronous POST /jobs checks its job
+	// (default 500ms).
+	PollInterval time.Duration
+}
+
+// healthJSON is the body of GET /healthz.
+type healthJSON struct {
+	Status string        `json:"status"` // "ok" or "fail"
+	Checks []CheckResult `json:"checks"`
+}
+
+// NewServeHandler returns the HTTP API of glm serve:
+//
+//	GET    /jobs               ListJSON; ?status=running,done ?since=2h ?project=myapp
+//	POST   /jobs               submit a SubmitRequest; 202 + StatusJSON or 200 + ResultJSON
+//	GET    /jobs/{id}          StatusJSON
+//	DELETE /jobs/{id}          Kill, then StatusJSON
+//	GET    /jobs/{id}/result   ResultJSON (the job is never deleted)
+//	GET    /jobs/{id}/log      LogJSON
+//	GET    /healthz            HealthChecks; 503 when one fails
+//
+// POST and DELETE require the Token. Errors are JSON objects
+// {"error": "err:<category> ..."}: 404 for err:not_found, 400 for err:user,
+// 401 for a missing or wrong token, 403 when no token is configured and 500
+// otherwise.
+func NewServeHandler(opts ServeOptions) http.Handler {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	poll := opts.PollInterval
+	if poll <= 0 {
+		poll = defaultPollInterval
+	}
+	root, project := opts.SubagentsRoot, opts.ProjectID
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, func(buf io.Writer) error {
+			q := r.URL.Query()
+			filter, err := listFilter(q.Get("status"), q.Get("since"), q.Get("project"), now)
+			if err != nil {
+				return err
+			}
+			return ListJSON(root, filter, buf)
+		})
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, func(buf io.Writer) error { return StatusJSON(root, project, r.PathValue("id"), buf) })
+	})
+	mux.HandleFunc("POST /jobs", requireToken(opts.Token, func(w http.ResponseWriter, r *http.Request) {
+		if opts.Submit == nil {
+			writeError(w, errs.Internal(`"Job submission is not available"`))
+			return
+		}
+		var req SubmitRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubmitBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, errs.User(`"Invalid request body: %s"`, err.Error()))
+			return
+		}
+		f, err := req.flags()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		j, err := opts.Submit(f)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if req.Async {
+			writeJSONResponse(w, http.StatusAccepted, jobStatusJSON(j.ID, j.Dir, string(job.ReadStatus(j.Dir))))
+			return
+		}
+		if err := waitForJob(r.Context(), j.Dir, poll); err != nil {
+			// The client went away; the job keeps running.
+			return
+		}
+		serveJSON(w, func(buf io.Writer) error { return ResultJSON(root, j.ProjectID, j.ID, buf) })
+	}))
+	mux.HandleFunc("DELETE /jobs/{id}", requireToken(opts.Token, func(w http.ResponseWriter, r *http.Request) {
+		if opts.Kill == nil {
+			writeError(w, errs.Internal(`"Killing jobs is not available"`))
+			return
+		}
+		if err := opts.Kill(r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		serveJSON(w, func(buf io.Writer) error { return StatusJSON(root, project, r.PathValue("id"), buf) })
+	}))
+	mux.HandleFunc("GET /jobs/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, func(buf io.Writer) error { return ResultJSON(root, project, r.PathValue("id"), buf) })
+	})
+	mux.HandleFunc("GET /jobs/{id}/log", func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, func(buf io.Writer) error { return LogJSON(root, project, r.PathValue("id"), buf) })
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		health := healthJSON{Status: "ok", Checks: HealthChecks(opts.Doctor)}
+		code := http.StatusOK
+		for _, c := range health.Checks {
+			if c.Status != "OK" {
+				health.Status, code = "fail", http.StatusServiceUnavailable
+			}
+		}
+		writeJSONResponse(w, code, health)
+	})
+	return mux
+}
+
+// listFilter builds the FilterOptions of GET /jobs and glm_list from the raw
+// status, since and project values. Empty values do not filter.
+func listFilter(status, since, project string, now func() time.Time) (*FilterOptions, error) {
+	filter := &FilterOptions{ProjectPrefix: project}
+	statuses, err := ParseStatusFilter(status)
+	if err != nil {
+		return nil, err
+	}
+	filter.Statuses = statuses
+	if since != "" {
+		if filter.Since, err = ParseSinceFilter(since, now); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// requireToken wraps a mutating handler so it runs only for requests that
+// carry "Authorization: Bearer <token>". The comparison is constant time.
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeJSONResponse(w, http.StatusForbidden, map[string]string{
+				"error": errs.Auth(`"Set serve_token to enable this endpoint"`).Error(),
+			})
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="glm"`)
+			writeError(w, errs.Auth(`"Missing or invalid serve token"`))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// flags converts a SubmitRequest into Flags. The rest of the validation is
+// left to Submit, so remote jobs follow the same rules as glm start.
+func (req SubmitRequest) flags() (*Flags, error) {
+	if req.Dir == "" || !filepath.IsAbs(req.Dir) {
+		return nil, errs.User(`"dir must be an absolute path"`)
+	}
+	if req.Timeout < 0 {
+		// Zero means default_timeout; a negative value is never replaced.
+		return nil, errs.User(`"Timeout must be a positive number: %d"`, req.Timeout)
+	}
+	if req.PermissionMode != "" && !validPermissionModes[req.PermissionMode] {
+		return nil, errs.User(`"Invalid permission_mode: %s (must be one of: bypassPermissions, acceptEdits, default, plan)"`, req.PermissionMode)
+	}
+	return &Flags{
+		Prompt:         req.Prompt,
+		Dir:            filepath.Clean(req.Dir),
+		Timeout:        req.Timeout,
+		Model:          req.Model,
+		PermissionMode: req.PermissionMode,
+	}, nil
+}
+
+// validPermissionModes are the permission modes a submission may request.
+var validPermissionModes = map[string]bool{
+	"bypassPermissions": true,
+	"acceptEdits":       true,
+	"default":           true,
+	"plan":              true,
+}
+
+// waitForJob polls the job in jobDir every interval until it reaches a
+// terminal status or ctx is done. A running job whose process died is
+// reconciled to failed by CheckJobPID, so the wait always ends.
+func waitForJob(ctx context.Context, jobDir string, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		status := string(job.ReadStatus(jobDir))
+		if status == string(job.StatusRunning) {
+			if s, err := job.CheckJobPID(jobDir); err == nil {
+				status = s
+			}
+		}
+		if terminalStatuses[status] {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// serveJSON runs write into a buffer and sends the buffer, so a failing
+// command never leaves a half-written 200 response.
+func serveJSON(w http.ResponseWriter, write func(io.Writer) error) {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// writeError sends err as {"error": ...} with the status for its class.
+func writeError(w http.ResponseWriter, err error) {
+	writeJSONResponse(w, httpStatus(err), map[string]string{"error": err.Error()})
+}
+
+// writeJSONResponse sends v as JSON with the given status code.
+func writeJSONResponse(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = JSONOutput(w, v)
+}
+
+// httpStatus maps an error class to its HTTP status code.
+func httpStatus(err error) int {
+	var (
+		notFound *errs.NotFoundError
+		user     *errs.UserError
+		auth     *errs.AuthError
+	)
+	switch {
+	case errors.As(err, &notFound):
+		return http.StatusNotFound
+	case errors.As(err, &user):
+		return http.StatusBadRequest
+	case errors.As(err, &auth):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ServeCmd serves NewServeHandler on addr until ctx is done, then shuts the
+// server down, waiting up to serveShutdownTimeout for in-flight requests. It
+// prints the address it listens on to w. Returns err:user if addr cannot be
+// bound.
+func ServeCmd(ctx context.Context, addr string, opts ServeOptions, w io.Writer) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errs.User(`"Cannot listen on %s: %s"`, addr, err.Error())
+	}
+	fmt.Fprintf(w, "Serving job status on http://%s (Ctrl-C to stop)\n", ln.Addr())
+
+	srv := &http.Server{Handler: NewServeHandler(opts), ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		return errs.Internal(`"HTTP server stopped: %s"`, err.Error())
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
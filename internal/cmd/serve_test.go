@@ -0,0 +1,263 @@
+package cmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// newServeServer starts NewServeHandler over a subagents root with a done job
+// and a failed job in two projects, and returns the server and the root.
+func newServeServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	root := t.TempDir()
+	done := makeJobDir(t, root, "myapp-12345", "job-20260227-143205-a8f3b1c2", "done")
+	writeJobFile(t, done, "stdout.txt", "all tests pass\n")
+	writeJobFile(t, done, "changelog.txt", "EDIT src/main.go: 42 chars\n")
+	makeJobDir(t, root, "other-67890", "job-20260227-150000-b1c2d3e4", "failed")
+
+	keyPath := filepath.Join(t.TempDir(), "zai_api_key")
+	if err := os.WriteFile(keyPath, []byte("sk-secret-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(cmd.NewServeHandler(cmd.ServeOptions{
+		SubagentsRoot: root,
+		ProjectID:     "myapp-12345",
+		Doctor: cmd.DoctorOptions{
+			ClaudeBinaryName: "glm-test-no-such-claude",
+			APIKeyPath:       keyPath,
+			SubagentsRoot:    root,
+		},
+	}))
+	t.Cleanup(srv.Close)
+	return srv, root
+}
+
+// getJSON fetches path from srv and decodes the body into v, returning the
+// status code.
+func getJSON(t *testing.T, srv *httptest.Server, path string, v any) int {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("GET %s: Content-Type = %q", path, ct)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("GET %s: body %q is not JSON: %v", path, body, err)
+	}
+	return resp.StatusCode
+}
+
+// Scenario: GET /jobs lists jobs and applies the status and project filters
+func TestServeListsJobs(t *testing.T) {
+	srv, _ := newServeServer(t)
+
+	var jobs []cmd.JobListItem
+	if code := getJSON(t, srv, "/jobs", &jobs); code != http.StatusOK || len(jobs) != 2 {
+		t.Fatalf("GET /jobs = %d with %d jobs, want 200 with 2", code, len(jobs))
+	}
+	if code := getJSON(t, srv, "/jobs?status=failed", &jobs); code != http.StatusOK || len(jobs) != 1 || jobs[0].ID != "job-20260227-150000-b1c2d3e4" {
+		t.Errorf("GET /jobs?status=failed = %d %+v", code, jobs)
+	}
+	if code := getJSON(t, srv, "/jobs?project=myapp", &jobs); code != http.StatusOK || len(jobs) != 1 || jobs[0].ID != "job-20260227-143205-a8f3b1c2" {
+		t.Errorf("GET /jobs?project=myapp = %d %+v", code, jobs)
+	}
+
+	var e map[string]string
+	if code := getJSON(t, srv, "/jobs?status=bogus", &e); code != http.StatusBadRequest || !strings.HasPrefix(e["error"], "err:user") {
+		t.Errorf("GET /jobs?status=bogus = %d %v, want 400 err:user", code, e)
+	}
+	if code := getJSON(t, srv, "/jobs?since=yesterday-ish", &e); code != http.StatusBadRequest {
+		t.Errorf("GET /jobs?since=yesterday-ish = %d, want 400", code)
+	}
+}
+
+// Scenario: The per-job routes return status, result and log, and keep the job
+func TestServeJobRoutes(t *testing.T) {
+	srv, root := newServeServer(t)
+
+	var status cmd.JobStatusJSON
+	if code := getJSON(t, srv, "/jobs/a8f3b1c2", &status); code != http.StatusOK || status.Status != "done" {
+		t.Errorf("GET /jobs/a8f3b1c2 = %d %+v", code, status)
+	}
+
+	var result cmd.JobResultJSON
+	if code := getJSON(t, srv, "/jobs/job-20260227-143205-a8f3b1c2/result", &result); code != http.StatusOK || result.Stdout != "all tests pass\n" {
+		t.Errorf("GET result = %d %+v", code, result)
+	}
+	if _, err := os.Stat(filepath.Join(root, "myapp-12345", "job-20260227-143205-a8f3b1c2")); err != nil {
+		t.Errorf("GET result removed the job: %v", err)
+	}
+
+	var log cmd.JobLogJSON
+	if code := getJSON(t, srv, "/jobs/a8f3b1c2/log", &log); code != http.StatusOK || len(log.Changes) != 1 {
+		t.Errorf("GET log = %d %+v", code, log)
+	}
+}
+
+// Scenario: A missing job is a 404, a malformed ID a 400, and submitting without serve_token a 403
+func TestServeNotFoundMapsTo404(t *testing.T) {
+	srv, _ := newServeServer(t)
+
+	for _, path := range []string{"/jobs/job-20260227-143205-deadbeef", "/jobs/deadbeef/result", "/jobs/deadbeef/log"} {
+		var e map[string]string
+		if code := getJSON(t, srv, path, &e); code != http.StatusNotFound || !strings.HasPrefix(e["error"], "err:not_found") {
+			t.Errorf("GET %s = %d %v, want 404 err:not_found", path, code, e)
+		}
+	}
+	var e map[string]string
+	if code := getJSON(t, srv, "/jobs/not-a-job!/log", &e); code != http.StatusBadRequest {
+		t.Errorf("GET malformed ID = %d %v, want 400", code, e)
+	}
+
+	resp, err := http.Post(srv.URL+"/jobs", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST /jobs without serve_token = %d, want 403", resp.StatusCode)
+	}
+}
+
+// Scenario: POST /jobs checks the token and body before calling Submit
+func TestServeSubmitChecksRequest(t *testing.T) {
+	root := t.TempDir()
+	var submitted []*cmd.Flags
+	srv := httptest.NewServer(cmd.NewServeHandler(cmd.ServeOptions{
+		SubagentsRoot: root,
+		Token:         "s3cret",
+		Submit: func(f *cmd.Flags) (*job.Job, error) {
+			submitted = append(submitted, f)
+			if f.Prompt == "reject me" {
+				return nil, errs.User(`"No prompt provided"`)
+			}
+			return cmd.QueueJob(root, "myapp-12345", claude.Config{Prompt: f.Prompt, WorkDir: f.Dir})
+		},
+	}))
+	defer srv.Close()
+
+	post := func(token, body string) (int, string) {
+		req, _ := http.NewRequest("POST", srv.URL+"/jobs", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if code, _ := post("wrong", `{"prompt":"x","dir":"/srv/app"}`); code != http.StatusUnauthorized {
+		t.Errorf("wrong token = %d, want 401", code)
+	}
+	if code, body := post("s3cret", `{"prompt":"x","dir":"/srv/app","colour":"red"}`); code != http.StatusBadRequest || !strings.Contains(body, "err:user") {
+		t.Errorf("unknown field = %d %s, want 400 err:user", code, body)
+	}
+	if code, _ := post("s3cret", `{"prompt":"x","dir":"/srv/app","permission_mode":"yolo"}`); code != http.StatusBadRequest {
+		t.Errorf("bad permission_mode = %d, want 400", code)
+	}
+	if len(submitted) != 0 {
+		t.Fatalf("Submit called for rejected requests: %+v", submitted)
+	}
+
+	if code, body := post("s3cret", `{"prompt":"reject me","dir":"/srv/app"}`); code != http.StatusBadRequest || !strings.Contains(body, "No prompt provided") {
+		t.Errorf("Submit error = %d %s, want 400 with its message", code, body)
+	}
+	code, body := post("s3cret", `{"prompt":"fix it","dir":"/srv/app","timeout":90,"model":"glm-5","async":true}`)
+	var st cmd.JobStatusJSON
+	if err := json.Unmarshal([]byte(body), &st); err != nil || code != http.StatusAccepted || st.Status != "queued" {
+		t.Errorf("async submit = %d %s, want 202 queued", code, body)
+	}
+	if f := submitted[len(submitted)-1]; f.Timeout != 90 || f.Model != "glm-5" || f.Dir != "/srv/app" {
+		t.Errorf("Submit got %+v", f)
+	}
+}
+
+// Scenario: /healthz reports the local doctor checks without the API key
+func TestServeHealthz(t *testing.T) {
+	srv, _ := newServeServer(t)
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "sk-secret-key") {
+		t.Fatalf("/healthz leaks the API key: %s", body)
+	}
+
+	var health struct {
+		Status string            `json:"status"`
+		Checks []cmd.CheckResult `json:"checks"`
+	}
+	if err := json.Unmarshal(body, &health); err != nil {
+		t.Fatalf("body %q: %v", body, err)
+	}
+	// claude is missing in the test, so the check fails.
+	if resp.StatusCode != http.StatusServiceUnavailable || health.Status != "fail" || len(health.Checks) != 3 {
+		t.Errorf("/healthz = %d %+v", resp.StatusCode, health)
+	}
+	for _, c := range health.Checks {
+		if c.Name == "api_key" && c.Status != "OK" {
+			t.Errorf("api_key check = %+v, want OK", c)
+		}
+	}
+}
+
+// Scenario: glm serve stops cleanly when its context is cancelled
+func TestServeCmdShutsDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	pr, pw := io.Pipe()
+	go func() {
+		done <- cmd.ServeCmd(ctx, "127.0.0.1:0", cmd.ServeOptions{SubagentsRoot: t.TempDir()}, pw)
+		pw.Close()
+	}()
+
+	// The first line names the bound address.
+	line := make([]byte, 256)
+	n, _ := pr.Read(line)
+	addr := strings.Fields(strings.TrimPrefix(string(line[:n]), "Serving job status on "))[0]
+	go io.Copy(io.Discard, pr)
+
+	resp, err := http.Get(addr + "/jobs")
+	if err != nil {
+		t.Fatalf("GET %s/jobs: %v", addr, err)
+	}
+	resp.Body.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeCmd = %v, want nil after shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeCmd did not return after cancel")
+	}
+
+	if err := cmd.ServeCmd(context.Background(), "127.0.0.1:-1", cmd.ServeOptions{}, io.Discard); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("ServeCmd on a bad address = %v, want err:user", err)
+	}
+}
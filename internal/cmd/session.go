@@ -4,9 +4,12 @@ package cmd
 import (
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
 )
 
 // SessionArgs holds the parsed arguments for the session command.
@@ -26,12 +29,30 @@ type SessionArgs struct {
 	// WorkDir is the -d flag. When non-empty the process working directory is
 	// changed to this path before exec.
 	WorkDir string
+	// BaseURL is the --base-url flag; it overrides the configured base_url.
+	BaseURL string
 	// Passthrough contains all flags and positional arguments not consumed by
 	// GoLeM. They are forwarded verbatim to the claude binary.
 	Passthrough []string
 	// TimeoutIgnored is set to true when the -t flag was present; the value is
 	// discarded and a debug message is emitted.
 	TimeoutIgnored bool
+	// DryRun is the --dry-run flag: print the command line instead of exec.
+	DryRun bool
+	// ResumeJob is the job given as --resume JOB_ID; its claude session is
+	// resumed in its workdir. A --resume value that does not start with
+	// "job-" is a claude session ID and is passed through.
+	ResumeJob string
+}
+
+// SessionOptions holds optional settings for SessionCmd.
+type SessionOptions struct {
+	// SubagentsRoot and ProjectID locate the job of --resume JOB_ID.
+	SubagentsRoot string
+	ProjectID     string
+	// ConfigFile is read instead of configDir/glm.toml (the global --config
+	// flag).
+	ConfigFile string
 }
 
 // SessionResult captures the parameters that SessionCmd would pass to
@@ -45,33 +66,89 @@ type SessionResult struct {
 	WorkDir string
 	// DebugMessages contains any debug-level messages that were emitted.
 	DebugMessages []string
+	// DryRun reports that --dry-run was given; the caller prints CommandLine
+	// instead of exec'ing.
+	DryRun bool
+	// ClaudePath is the configured claude_path, resolved by the caller with
+	// claude.FindBinary.
+	ClaudePath string
 }
 
-// zaiBaseURL is the Z.AI API endpoint.
-const zaiBaseURL = "https://api.z.ai/api/anthropic"
+// CommandLine renders the working directory change, the overridden
+// environment and argv as a shell-style command line, quoting values that need
+// it. The API key is masked.
+func (r *SessionResult) CommandLine() string {
+	var parts []string
+	if r.WorkDir != "" {
+		parts = append(parts, "cd", shellQuote(r.WorkDir), "&&")
+	}
+	for _, kv := range r.Env {
+		key, value, _ := strings.Cut(kv, "=")
+		if !sessionEnvKeys[key] {
+			continue
+		}
+		if key == "ANTHROPIC_AUTH_TOKEN" && value != "" {
+			value = "***"
+		}
+		parts = append(parts, key+"="+shellQuote(value))
+	}
+	for _, a := range r.Argv {
+		parts = append(parts, shellQuote(a))
+	}
+	return strings.Join(parts, " ")
+}
 
-// defaultGLMModel is the default model for all slots.
-const defaultGLMModel = "glm-4.7"
+// sessionEnvKeys are the variables injected by claude.BuildEnv; only these are
+// shown by CommandLine.
+var sessionEnvKeys = map[string]bool{
+	"ANTHROPIC_AUTH_TOKEN":           true,
+	"ANTHROPIC_BASE_URL":             true,
+	"API_TIMEOUT_MS":                 true,
+	"ANTHROPIC_DEFAULT_OPUS_MODEL":   true,
+	"ANTHROPIC_DEFAULT_SONNET_MODEL": true,
+	"ANTHROPIC_DEFAULT_HAIKU_MODEL":  true,
+}
 
-// SessionCmd parses args, builds the environment, and populates a
-// SessionResult describing what would be exec'd. The actual exec is
-// performed by the caller (main). Using a returned value rather than
+// shellQuote quotes s for display when it contains shell metacharacters.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'$`\\|&;<>()*?[]{}~#!") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// SessionCmd parses args, loads the GoLeM config, builds the environment, and
+// populates a SessionResult describing what would be exec'd. The actual exec
+// is performed by the caller (main). Using a returned value rather than
 // calling syscall.Exec directly keeps the function testable.
 //
+// Models and permission mode are resolved exactly as for run: glm.toml and
+// GLM_* env vars first, then -m, then --opus/--sonnet/--haiku, and --mode or
+// --unsafe. The environment is built by claude.BuildEnv.
+//
 // configDir is the GoLeM config directory (contains zai_api_key, glm.toml).
 // args are the raw CLI arguments after the "session" sub-command token.
 // debugLog receives debug messages; may be nil.
-func SessionCmd(configDir string, args []string, debugLog io.Writer) (*SessionResult, error) {
-	// Read API key from configDir/zai_api_key.
-	apiKey := ""
-	keyPath := filepath.Join(configDir, "zai_api_key")
-	if data, err := os.ReadFile(keyPath); err == nil {
-		apiKey = strings.TrimSpace(string(data))
+//
+// "--resume JOB_ID" resumes the claude session a job ran in: it becomes
+// "--resume <session ID>" for claude, and the job's workdir is used unless
+// -d is given. It returns err:not_found when the job has no session ID.
+func SessionCmd(configDir string, args []string, debugLog io.Writer, opts ...*SessionOptions) (*SessionResult, error) {
+	o := &SessionOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+
+	// Sessions do not create jobs, so no subagent directory is needed.
+	cfg, err := config.LoadWithOptions(configDir, "", config.Options{ConfigFile: o.ConfigFile})
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse GoLeM-specific flags from args.
 	sa := &SessionArgs{}
 	var passthroughArgs []string
+	var debugMessages []string
 
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
@@ -87,6 +164,7 @@ func SessionCmd(configDir string, args []string, debugLog io.Writer) (*SessionRe
 				i++ // consume the value
 			}
 			sa.TimeoutIgnored = true
+			debugMessages = append(debugMessages, "Timeout flag ignored for session mode")
 			if debugLog != nil {
 				fmt.Fprintln(debugLog, "Timeout flag ignored for session mode")
 			}
@@ -117,6 +195,19 @@ func SessionCmd(configDir string, args []string, debugLog io.Writer) (*SessionRe
 				sa.PermissionMode = args[i+1]
 				i++
 			}
+		case arg == "--base-url":
+			if i+1 < len(args) {
+				if err := config.ValidateBaseURL(args[i+1]); err != nil {
+					return nil, errs.User(`"Invalid --base-url: %s"`, err.Error())
+				}
+				sa.BaseURL = args[i+1]
+				i++
+			}
+		case arg == "--dry-run":
+			sa.DryRun = true
+		case arg == "--resume" && i+1 < len(args) && strings.HasPrefix(args[i+1], "job-"):
+			sa.ResumeJob = args[i+1]
+			i++
 		default:
 			// Unknown flag/arg — pass through to claude.
 			passthroughArgs = append(passthroughArgs, arg)
@@ -124,71 +215,63 @@ func SessionCmd(configDir string, args []string, debugLog io.Writer) (*SessionRe
 	}
 	sa.Passthrough = passthroughArgs
 
-	// Determine model slots.
-	opusModel := sa.OpusModel
-	sonnetModel := sa.SonnetModel
-	haikuModel := sa.HaikuModel
-	if sa.Model != "" {
-		// -m overrides all three slots.
-		if opusModel == "" {
-			opusModel = sa.Model
-		}
-		if sonnetModel == "" {
-			sonnetModel = sa.Model
+	if sa.ResumeJob != "" {
+		m, err := jobSession(sa.ResumeJob, o.SubagentsRoot, o.ProjectID)
+		if err != nil {
+			return nil, err
 		}
-		if haikuModel == "" {
-			haikuModel = sa.Model
+		sa.Passthrough = append([]string{"--resume", m.SessionID}, sa.Passthrough...)
+		if sa.WorkDir == "" {
+			sa.WorkDir = m.WorkDir
 		}
 	}
-	// Apply defaults.
-	if opusModel == "" {
-		opusModel = defaultGLMModel
-	}
-	if sonnetModel == "" {
-		sonnetModel = defaultGLMModel
-	}
-	if haikuModel == "" {
-		haikuModel = defaultGLMModel
-	}
 
-	// Build environment (filtered copy of os.Environ with blocked vars removed).
-	blocked := map[string]bool{
-		"CLAUDECODE":              true,
-		"CLAUDE_CODE_ENTRYPOINT": true,
+	// Determine model slots: config, then -m, then per-slot flags.
+	models := ResolveModels(cfg, &Flags{
+		Model:       sa.Model,
+		OpusModel:   sa.OpusModel,
+		SonnetModel: sa.SonnetModel,
+		HaikuModel:  sa.HaikuModel,
+	}, StepPrefix{}).Models()
+
+	permMode := cfg.PermissionMode
+	if sa.PermissionMode != "" {
+		permMode = sa.PermissionMode
 	}
-	var env []string
-	for _, kv := range os.Environ() {
-		parts := strings.SplitN(kv, "=", 2)
-		if len(parts) == 2 && blocked[parts[0]] {
-			continue
-		}
-		env = append(env, kv)
+	baseURL := cfg.ZaiBaseURL
+	if sa.BaseURL != "" {
+		baseURL = sa.BaseURL
 	}
-	// Inject ZAI-specific env vars.
-	env = append(env,
-		"ANTHROPIC_AUTH_TOKEN="+apiKey,
-		"ANTHROPIC_BASE_URL="+zaiBaseURL,
-		"ANTHROPIC_DEFAULT_OPUS_MODEL="+opusModel,
-		"ANTHROPIC_DEFAULT_SONNET_MODEL="+sonnetModel,
-		"ANTHROPIC_DEFAULT_HAIKU_MODEL="+haikuModel,
-	)
+
+	env := claude.BuildEnv(claude.Config{
+		ZAIAPIKey:       cfg.ZaiAPIKey,
+		ZAIBaseURL:      baseURL,
+		ZAIAPITimeoutMS: cfg.ZaiAPITimeoutMs,
+		OpusModel:       models.Opus,
+		SonnetModel:     models.Sonnet,
+		HaikuModel:      models.Haiku,
+		Interactive:     true,
+	})
 
 	// Build argv for claude (interactive session — no -p, --output-format, etc.).
 	argv := []string{"claude"}
 
 	// Append permission flags if needed.
-	if sa.PermissionMode == "bypassPermissions" {
+	if permMode == "bypassPermissions" {
 		argv = append(argv, "--dangerously-skip-permissions")
-	} else if sa.PermissionMode != "" {
-		argv = append(argv, "--permission-mode", sa.PermissionMode)
+	} else if permMode != "" {
+		argv = append(argv, "--permission-mode", permMode)
 	}
 
 	// Append passthrough args.
 	argv = append(argv, sa.Passthrough...)
 
 	return &SessionResult{
-		Argv:    argv,
-		Env:     env,
-		WorkDir: sa.WorkDir,
+		Argv:          argv,
+		Env:           env,
+		WorkDir:       sa.WorkDir,
+		DebugMessages: debugMessages,
+		DryRun:        sa.DryRun,
+		ClaudePath:    cfg.ClaudePath,
 	}, nil
 }
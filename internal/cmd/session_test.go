@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/job"
 )
 
 // ---------------------------------------------------------------------------
@@ -293,3 +294,126 @@ func TestWorkingDirectoryFlagChangesDirectoryBeforeExec(t *testing.T) {
 		t.Errorf("WorkDir = %q; want %q", res.WorkDir, dir)
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Config parity with run
+// ---------------------------------------------------------------------------
+
+// writeSessionTOML writes glm.toml into the session config dir.
+func writeSessionTOML(t *testing.T, cfgDir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(cfgDir, "glm.toml"), []byte(content), 0o644); err != nil {
+		t.Fatalf("write glm.toml: %v", err)
+	}
+}
+
+func TestSessionUsesModelsAndPermissionModeFromConfig(t *testing.T) {
+	cfgDir := newSessionConfig(t)
+	writeSessionTOML(t, cfgDir, "opus_model = \"glm-5\"\nsonnet_model = \"glm-4.5\"\npermission_mode = \"plan\"\n")
+	res := runSession(t, cfgDir, nil)
+
+	assertEnvPresent(t, res.Env, "ANTHROPIC_DEFAULT_OPUS_MODEL", "glm-5")
+	assertEnvPresent(t, res.Env, "ANTHROPIC_DEFAULT_SONNET_MODEL", "glm-4.5")
+	assertEnvPresent(t, res.Env, "ANTHROPIC_DEFAULT_HAIKU_MODEL", "glm-4.7")
+	assertEnvPresent(t, res.Env, "API_TIMEOUT_MS", "3000000")
+	if !slices.Equal(res.Argv[1:3], []string{"--permission-mode", "plan"}) {
+		t.Errorf("argv = %v; want --permission-mode plan from glm.toml", res.Argv)
+	}
+}
+
+func TestSessionFlagsOverrideConfig(t *testing.T) {
+	cfgDir := newSessionConfig(t)
+	writeSessionTOML(t, cfgDir, "model = \"glm-5\"\npermission_mode = \"plan\"\n")
+	res := runSession(t, cfgDir, []string{"-m", "glm-4.5", "--haiku", "glm-4", "--unsafe"})
+
+	assertEnvPresent(t, res.Env, "ANTHROPIC_DEFAULT_OPUS_MODEL", "glm-4.5")
+	assertEnvPresent(t, res.Env, "ANTHROPIC_DEFAULT_SONNET_MODEL", "glm-4.5")
+	assertEnvPresent(t, res.Env, "ANTHROPIC_DEFAULT_HAIKU_MODEL", "glm-4")
+	assertArgPresent(t, res.Argv, "--dangerously-skip-permissions")
+	assertArgAbsent(t, res.Argv, "plan")
+}
+
+func TestSessionDryRunPrintsCommandLine(t *testing.T) {
+	cfgDir := newSessionConfig(t)
+	res := runSession(t, cfgDir, []string{"--dry-run", "--opus", "glm-5", "--resume", "abc"})
+
+	if !res.DryRun {
+		t.Fatal("DryRun = false; want true")
+	}
+	assertArgAbsent(t, res.Argv, "--dry-run")
+
+	line := res.CommandLine()
+	for _, want := range []string{"ANTHROPIC_DEFAULT_OPUS_MODEL=glm-5", "claude", "--resume abc"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("CommandLine() = %q; missing %q", line, want)
+		}
+	}
+	if strings.Contains(line, "sk-zai-key") {
+		t.Errorf("CommandLine() leaks the API key: %q", line)
+	}
+}
+
+func TestSessionBaseURLFromConfigAndFlag(t *testing.T) {
+	cfgDir := newSessionConfig(t)
+	writeSessionTOML(t, cfgDir, "base_url = \"https://gateway.corp.example/anthropic\"\n")
+	res := runSession(t, cfgDir, nil)
+	assertEnvPresent(t, res.Env, "ANTHROPIC_BASE_URL", "https://gateway.corp.example/anthropic")
+
+	res = runSession(t, cfgDir, []string{"--base-url", "http://localhost:4000"})
+	assertEnvPresent(t, res.Env, "ANTHROPIC_BASE_URL", "http://localhost:4000")
+}
+
+// Scenario: a job's claude session is shown in JSON, as a resume hint, and resumed by session --resume JOB_ID
+func TestSessionResumeJob(t *testing.T) {
+	root := t.TempDir()
+	workdir := t.TempDir()
+	dir := makeJobDir(t, root, "myapp-12345", "job-20260227-143205-a8f3b1c2", "done")
+	writeJobFile(t, dir, "session_id.txt", "9f1c2d3e-aaaa-bbbb-cccc-1234567890ab")
+	if err := job.UpdateManifest(dir, func(m *job.Manifest) { m.WorkDir = workdir }); err != nil {
+		t.Fatal(err)
+	}
+	makeJobDir(t, root, "myapp-12345", "job-20260227-143206-b8f3b1c2", "done")
+
+	var buf bytes.Buffer
+	if err := cmd.ResultJSON(root, "myapp-12345", "a8f3b1c2", &buf); err != nil || !strings.Contains(buf.String(), `"session_id": "9f1c2d3e-aaaa-bbbb-cccc-1234567890ab"`) {
+		t.Errorf("ResultJSON = %s, %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := cmd.StatusJSON(root, "myapp-12345", "job-20260227-143205-a8f3b1c2", &buf); err != nil || !strings.Contains(buf.String(), `"session_id"`) {
+		t.Errorf("StatusJSON = %s, %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := cmd.StatusJSON(root, "myapp-12345", "job-20260227-143206-b8f3b1c2", &buf); err != nil || strings.Contains(buf.String(), `"session_id"`) {
+		t.Errorf("StatusJSON without a session = %s, %v", buf.String(), err)
+	}
+
+	buf.Reset()
+	if err := cmd.ResumeHintCmd("a8f3b1c2", root, "myapp-12345", &buf); err != nil {
+		t.Fatalf("ResumeHintCmd: %v", err)
+	}
+	if want := "cd " + workdir + " && claude --resume 9f1c2d3e-aaaa-bbbb-cccc-1234567890ab\n"; buf.String() != want {
+		t.Errorf("resume hint = %q, want %q", buf.String(), want)
+	}
+	err := cmd.ResumeHintCmd("b8f3b1c2", root, "myapp-12345", &buf)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:not_found") || !strings.Contains(err.Error(), "No claude session recorded") {
+		t.Errorf("resume hint without a session: %v", err)
+	}
+
+	cfgDir := newSessionConfig(t)
+	opts := &cmd.SessionOptions{SubagentsRoot: root, ProjectID: "myapp-12345"}
+	res, err := cmd.SessionCmd(cfgDir, []string{"--resume", "job-20260227-143205-a8f3b1c2"}, nil, opts)
+	if err != nil {
+		t.Fatalf("SessionCmd: %v", err)
+	}
+	if !slices.Contains(res.Argv, "9f1c2d3e-aaaa-bbbb-cccc-1234567890ab") || slices.Contains(res.Argv, "job-20260227-143205-a8f3b1c2") || res.WorkDir != workdir {
+		t.Errorf("session --resume JOB_ID: argv %q, workdir %q", res.Argv, res.WorkDir)
+	}
+	if _, err := cmd.SessionCmd(cfgDir, []string{"--resume", "job-20260227-143206-b8f3b1c2"}, nil, opts); err == nil || !strings.HasPrefix(err.Error(), "err:not_found") {
+		t.Errorf("session --resume of a job without a session: %v", err)
+	}
+	// A claude session ID is passed through unchanged.
+	res, err = cmd.SessionCmd(cfgDir, []string{"--resume", "9f1c2d3e-aaaa-bbbb-cccc-1234567890ab"}, nil, opts)
+	if err != nil || !slices.Contains(res.Argv, "9f1c2d3e-aaaa-bbbb-cccc-1234567890ab") || res.WorkDir != "" {
+		t.Errorf("session --resume SESSION_ID: %+v, %v", res, err)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 
+	"github.com/veschin/GoLeM/internal/claude"
 	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/log"
 )
 
 // StartResult holds the outcome of a StartCmd call.
@@ -17,29 +20,56 @@ type StartResult struct {
 	PIDWritten bool
 }
 
+// StartOptions holds optional settings for StartCmd.
+type StartOptions struct {
+	// Log receives the job's debug lines with its job_id field (nil =
+	// none).
+	Log *log.Logger
+}
+
+// startWork is the work of a started job's goroutine: it returns the job's
+// final status. Tests replace it.
+var startWork = func(f *Flags, jobDir string) job.Status {
+	// In production, this would run the claude command.
+	// For tests, we simulate completion by checking if the work directory exists.
+	if _, err := os.Stat(f.Dir); err != nil {
+		// Work directory doesn't exist — report failure.
+		return job.StatusFailed
+	}
+	return job.StatusDone
+}
+
 // StartCmd executes a subagent job asynchronously:
 //  1. Creates a new job directory (queued status).
 //  2. Writes the current PID to pid.txt BEFORE printing the job ID.
 //  3. Prints the job ID to stdout as a single line (no decoration).
 //  4. Returns immediately with exit code 0.
 //  5. Launches a background goroutine that waits for a slot, runs claude,
-//     and sets the final status on completion (or "failed" on panic).
-func StartCmd(f *Flags, subagentsRoot, projectID string, stdout io.Writer) (*StartResult, error) {
+//     and sets the final status on completion. A panic is recorded with
+//     claude.RecordPanic: stderr.txt is kept, panic.txt gets the stack and
+//     the job fails unless it already ended.
+func StartCmd(f *Flags, subagentsRoot, projectID string, stdout io.Writer, opts ...*StartOptions) (*StartResult, error) {
+	o := &StartOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = opts[0]
+	}
+
 	// Generate job ID and create job directory
-	jobID := job.GenerateJobID()
-	j, err := job.NewJob(subagentsRoot, projectID, jobID)
+	j, err := job.NewJob(subagentsRoot, projectID, job.GenerateJobID())
 	if err != nil {
 		return nil, err
 	}
+	jobID := j.ID
 
 	// Write current PID to pid.txt BEFORE printing job ID
-	pid := os.Getpid()
-	pidPath := filepath.Join(j.Dir, "pid.txt")
-	if err := os.WriteFile(pidPath, []byte(fmt.Sprintf("%d", pid)), 0o644); err != nil {
+	if err := job.WritePID(j.Dir, os.Getpid()); err != nil {
 		job.DeleteJob(j.Dir)
 		return nil, err
 	}
 
+	jobLog := o.Log.With(log.Fields{"job_id": jobID})
+	jobLog.With(log.Fields{"project_id": projectID, "workdir": f.Dir, "id_retries": j.IDRetries}).Debug("job queued")
+
 	// Print job ID to stdout
 	fmt.Fprintln(stdout, jobID)
 
@@ -56,13 +86,14 @@ func StartCmd(f *Flags, subagentsRoot, projectID string, stdout io.Writer) (*Sta
 			if _, err := os.Stat(jobDir); err != nil {
 				return
 			}
-			_ = os.WriteFile(statusPath, []byte(s), 0o644)
+			_ = os.WriteFile(statusPath, []byte(s+"\n"), 0o644)
 		}
 
 		defer func() {
 			if r := recover(); r != nil {
-				// On panic, try to set status to failed.
-				writeStatus(job.StatusFailed)
+				if _, err := os.Stat(jobDir); err == nil {
+					claude.RecordPanic(jobDir, r, debug.Stack())
+				}
 			}
 		}()
 
@@ -70,14 +101,9 @@ func StartCmd(f *Flags, subagentsRoot, projectID string, stdout io.Writer) (*Sta
 		writeStatus(job.StatusRunning)
 
 		// Execute the actual work.
-		// In production, this would run the claude command.
-		// For tests, we simulate completion by checking if the work directory exists.
-		status := job.StatusDone
-		if _, statErr := os.Stat(f.Dir); statErr != nil {
-			// Work directory doesn't exist — report failure.
-			status = job.StatusFailed
-		}
+		status := startWork(f, jobDir)
 		writeStatus(status)
+		jobLog.With(log.Fields{"status": string(status)}).Debug("job finished")
 	}()
 
 	return &StartResult{
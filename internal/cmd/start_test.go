@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// Scenario: a panic in a started job keeps claude's stderr, writes panic.txt and finished_at, fails a running job and leaves a killed one killed
+func TestStartPanicKeepsArtifacts(t *testing.T) {
+	orig := startWork
+	t.Cleanup(func() { startWork = orig })
+
+	for _, killed := range []bool{false, true} {
+		startWork = func(f *Flags, jobDir string) job.Status {
+			_ = os.WriteFile(filepath.Join(jobDir, "stderr.txt"), []byte("partial claude output\n"), 0o644)
+			if killed {
+				_ = job.WriteStatus(jobDir, job.StatusKilled)
+			}
+			panic("boom")
+		}
+
+		root := t.TempDir()
+		result, err := StartCmd(&Flags{Dir: t.TempDir(), Prompt: "crash"}, root, "proj", &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobDir := filepath.Join(root, "proj", result.JobID)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for job.LoadManifest(jobDir).FinishedAt == "" && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		want := job.StatusFailed
+		if killed {
+			want = job.StatusKilled
+		}
+		if got := job.ReadStatus(jobDir); got != want {
+			t.Errorf("killed=%v: status %s, want %s", killed, got, want)
+		}
+		stderr, _ := os.ReadFile(filepath.Join(jobDir, "stderr.txt"))
+		if !strings.HasPrefix(string(stderr), "partial claude output\n") || !strings.Contains(string(stderr), "panic: boom") {
+			t.Errorf("killed=%v: stderr.txt = %q, want claude's output then the panic", killed, stderr)
+		}
+		panicTxt, err := os.ReadFile(filepath.Join(jobDir, claude.PanicFile))
+		if err != nil || !strings.HasPrefix(string(panicTxt), "panic: boom") || !strings.Contains(string(panicTxt), "goroutine ") {
+			t.Errorf("killed=%v: panic.txt = %q (%v), want the panic and its stack", killed, panicTxt, err)
+		}
+		if job.LoadManifest(jobDir).FinishedAt == "" {
+			t.Errorf("killed=%v: finished_at not written", killed)
+		}
+	}
+}
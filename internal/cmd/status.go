@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/veschin/GoLeM/internal/errs"
 	"github.com/veschin/GoLeM/internal/job"
 )
 
@@ -18,17 +23,32 @@ type StatusResult struct {
 	ExitCode int
 }
 
+// StatusOptions holds optional StatusCmd settings.
+type StatusOptions struct {
+	// Verbose prints a key: value block (status, pid, timestamps, durations)
+	// instead of the single status word.
+	Verbose bool
+}
+
 // StatusCmd prints the current status of the job identified by jobID:
 //   - Looks up the job directory under subagentsRoot.
 //   - If the status file reads "running", checks whether the PID in pid.txt
 //     is still alive. If the PID is dead it updates the status to "failed".
-//   - Prints the final status word followed by a newline to stdout.
-//   - Returns exit code 3 with an err:not_found error if the job does not exist.
-func StatusCmd(jobID, subagentsRoot, currentProjectID string, stdout io.Writer) (*StatusResult, error) {
+//   - Prints the final status word followed by a newline to stdout, or a
+//     key: value block when opts.Verbose is set.
+//   - Returns exit code 3 with an err:not_found error if the job does not exist,
+//     and exit code 1 with err:user for a malformed or ambiguous job ID
+//     (unique parts of an ID are resolved by job.ResolveJobID).
+func StatusCmd(jobID, subagentsRoot, currentProjectID string, stdout io.Writer, opts ...*StatusOptions) (*StatusResult, error) {
+	jobID, err := job.ResolveJobID(subagentsRoot, jobID)
+	if err != nil {
+		return &StatusResult{ExitCode: 1}, err
+	}
+
 	// Find the job directory
 	jobDir, err := job.FindJobDir(subagentsRoot, currentProjectID, jobID)
 	if err != nil {
-		return &StatusResult{ExitCode: 3}, fmt.Errorf(`err:not_found "Job not found: %s"`, jobID)
+		return &StatusResult{ExitCode: 3}, errs.NotFound(`"Job not found: %s"`, jobID)
 	}
 
 	// Read the status
@@ -36,30 +56,153 @@ func StatusCmd(jobID, subagentsRoot, currentProjectID string, stdout io.Writer)
 
 	// If status is "running", check if PID is still alive
 	if status == job.StatusRunning {
-		pidPath := jobDir + "/pid.txt"
-		pidData, err := os.ReadFile(pidPath)
-		if err == nil {
-			pid, _ := strconv.Atoi(string(pidData))
-			if pid > 0 {
-				// Check if process is alive
-				process, err := os.FindProcess(pid)
-				if err == nil {
-					err := process.Signal(syscall.Signal(0))
-					if err != nil {
-						// PID is dead, update status to failed
-						job.AtomicWrite(jobDir+"/status", []byte(job.StatusFailed))
-						status = job.StatusFailed
-					}
+		pid := job.LoadManifest(jobDir).PID
+		if pid > 0 {
+			// Check if process is alive
+			process, err := os.FindProcess(pid)
+			if err == nil {
+				err := process.Signal(syscall.Signal(0))
+				if err != nil {
+					// PID is dead, update status to failed
+					job.WriteStatus(jobDir, job.StatusFailed)
+					status = job.StatusFailed
 				}
 			}
 		}
 	}
 
 	// Print status to stdout
-	fmt.Fprintln(stdout, status)
+	if len(opts) > 0 && opts[0] != nil && opts[0].Verbose {
+		printStatusVerbose(stdout, jobDir, string(status))
+	} else {
+		fmt.Fprintln(stdout, status)
+	}
 
 	return &StatusResult{
 		Status:   string(status),
 		ExitCode: 0,
 	}, nil
 }
+
+// printStatusVerbose writes the key: value block for "glm status --verbose".
+// Keys without a value are left out.
+func printStatusVerbose(w io.Writer, jobDir, status string) {
+	m := job.LoadManifest(jobDir)
+	t := readJobTiming(jobDir, m, status, time.Now())
+
+	fmt.Fprintf(w, "status: %s\n", status)
+	if m.PID > 0 {
+		fmt.Fprintf(w, "pid: %d\n", m.PID)
+	}
+	if m.StartedAt != "" {
+		fmt.Fprintf(w, "started_at: %s\n", m.StartedAt)
+	}
+	if t.FinishedAt != "" {
+		fmt.Fprintf(w, "finished_at: %s\n", t.FinishedAt)
+	}
+	if t.DurationSeconds != nil {
+		fmt.Fprintf(w, "duration_seconds: %d\n", *t.DurationSeconds)
+	}
+	if t.ElapsedSeconds != nil {
+		fmt.Fprintf(w, "elapsed_seconds: %d\n", *t.ElapsedSeconds)
+	}
+	if m.Invocation != nil && m.Invocation.GLMVersion != "" {
+		fmt.Fprintf(w, "glm_version: %s\n", m.Invocation.GLMVersion)
+	}
+}
+
+// jobTiming holds the timing fields reported by status --json and --verbose.
+// Nil durations are unknown or do not apply to the job's status.
+type jobTiming struct {
+	FinishedAt      string
+	DurationSeconds *int
+	ElapsedSeconds  *int
+}
+
+// readJobTiming derives the timing of the job in jobDir from its manifest m.
+// Terminal jobs report
+// finished_at and duration_seconds (duration_seconds.txt, or the span between
+// started_at and finished_at when that file is absent); running jobs report
+// elapsed_seconds since started_at. Missing or unparsable timestamps leave the
+// corresponding fields empty.
+func readJobTiming(jobDir string, m *job.Manifest, status string, now time.Time) jobTiming {
+	var t jobTiming
+	started, startedErr := job.ParseTimestamp(m.StartedAt)
+
+	switch {
+	case terminalStatuses[status]:
+		t.FinishedAt = m.FinishedAt
+		if data, err := os.ReadFile(filepath.Join(jobDir, "duration_seconds.txt")); err == nil {
+			if d, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+				t.DurationSeconds = &d
+				return t
+			}
+		}
+		finished, err := job.ParseTimestamp(m.FinishedAt)
+		if err == nil && startedErr == nil && !finished.Before(started) {
+			d := int(finished.Sub(started).Seconds())
+			t.DurationSeconds = &d
+		}
+	case status == string(job.StatusRunning):
+		if startedErr == nil && !now.Before(started) {
+			e := int(now.Sub(started).Seconds())
+			t.ElapsedSeconds = &e
+		}
+	}
+	return t
+}
+
+// activeJob is a queued or running job found by StatusAllCmd.
+type activeJob struct {
+	ID     string
+	Dir    string
+	Status string
+}
+
+// activeJobs returns every queued or running job of projectID, oldest
+// first. Running jobs whose process has died are reconciled to failed (as in
+// StatusCmd) and left out.
+func activeJobs(subagentsRoot, projectID string) []activeJob {
+	projectDir := filepath.Join(subagentsRoot, projectID)
+	entries, err := os.ReadDir(projectDir)
+	if err != nil {
+		return nil
+	}
+	var jobs []activeJob
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), "job-") {
+			continue
+		}
+		dir := filepath.Join(projectDir, e.Name())
+		status, _ := job.CheckJobPID(dir)
+		if terminalStatuses[status] {
+			continue
+		}
+		jobs = append(jobs, activeJob{ID: e.Name(), Dir: dir, Status: status})
+	}
+	// Job IDs start with their creation time, so name order is age order.
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// StatusAllCmd prints "<job_id> <status> <elapsed>" for every queued or
+// running job in currentProjectID, for "glm status" without a job ID.
+// Elapsed is the time since the job started, or since it was queued while it
+// waits for a slot ("-" when unknown). Nothing is printed when no job is
+// active.
+func StatusAllCmd(subagentsRoot, currentProjectID string, w io.Writer) error {
+	now := time.Now()
+	for _, a := range activeJobs(subagentsRoot, currentProjectID) {
+		m := job.LoadManifest(a.Dir)
+		since := m.StartedAt
+		if a.Status == string(job.StatusQueued) || since == "" {
+			since = m.CreatedAt
+		}
+		elapsed := "-"
+		if t, err := job.ParseTimestamp(since); err == nil && !now.Before(t) {
+			elapsed = now.Sub(t).Truncate(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s %s %s\n", a.ID, a.Status, elapsed)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// TemplatesDirName is the directory under the config dir that holds prompt
+// templates, one NAME.txt file per template.
+const TemplatesDirName = "templates"
+
+// templateExt is the file extension of template files.
+const templateExt = ".txt"
+
+// Template is a named prompt with {{var}} placeholders.
+type Template struct {
+	Name string
+	Body string
+	// Source is the file the template was read from, or "glm.toml [templates]".
+	Source string
+}
+
+// placeholderRe matches {{var}} and {{ var }}.
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// templateNameRe restricts template names so they cannot escape the
+// templates directory.
+var templateNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// LoadTemplates returns every available template: the [templates] table of
+// glm.toml (fromConfig) plus configDir/templates/*.txt. A file wins over a
+// glm.toml entry of the same name. A missing templates directory is not an
+// error.
+func LoadTemplates(configDir string, fromConfig map[string]string) (map[string]Template, error) {
+	templates := make(map[string]Template, len(fromConfig))
+	for name, body := range fromConfig {
+		templates[name] = Template{Name: name, Body: body, Source: "glm.toml [" + config.TemplatesSection + "]"}
+	}
+
+	dir := filepath.Join(configDir, TemplatesDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return templates, nil
+		}
+		return nil, errs.Config(`"Cannot read templates directory: %s"`, err.Error())
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != templateExt {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errs.Config(`"Cannot read template %s: %s"`, e.Name(), err.Error())
+		}
+		name := strings.TrimSuffix(e.Name(), templateExt)
+		// Editors usually end files with a newline that is not part of the prompt.
+		templates[name] = Template{Name: name, Body: strings.TrimRight(string(data), "\n"), Source: path}
+	}
+	return templates, nil
+}
+
+// FindTemplate returns the template called name.
+// Returns err:user if the name is invalid and err:not_found if no such
+// template exists.
+func FindTemplate(configDir string, fromConfig map[string]string, name string) (Template, error) {
+	if !templateNameRe.MatchString(name) {
+		return Template{}, errs.User(`"Invalid template name: %s"`, name)
+	}
+	templates, err := LoadTemplates(configDir, fromConfig)
+	if err != nil {
+		return Template{}, err
+	}
+	t, ok := templates[name]
+	if !ok {
+		return Template{}, errs.NotFound(`"Template not found: %s (see glm template list)"`, name)
+	}
+	return t, nil
+}
+
+// Placeholders returns the distinct placeholder names in t.Body in order of
+// first appearance.
+func (t Template) Placeholders() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range placeholderRe.FindAllStringSubmatch(t.Body, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Render substitutes every {{var}} in the template with vars[var].
+// Returns err:user listing the placeholders that have no value.
+func (t Template) Render(vars map[string]string) (string, error) {
+	var missing []string
+	for _, name := range t.Placeholders() {
+		if _, ok := vars[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", errs.User(`"Template %s has unresolved variables: %s (pass -v key=value)"`,
+			t.Name, strings.Join(missing, ", "))
+	}
+	return placeholderRe.ReplaceAllStringFunc(t.Body, func(m string) string {
+		return vars[placeholderRe.FindStringSubmatch(m)[1]]
+	}), nil
+}
+
+// RenderFlagsTemplate renders the template named by f.Template with f.Vars.
+// It returns "" when no --template was given, and err:user when -v is used
+// without --template.
+func RenderFlagsTemplate(f *Flags, configDir string, fromConfig map[string]string) (string, error) {
+	if f.Template == "" {
+		if len(f.Vars) > 0 {
+			return "", errs.User(`"-v requires --template"`)
+		}
+		return "", nil
+	}
+	t, err := FindTemplate(configDir, fromConfig, f.Template)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(f.Vars)
+}
+
+// ApplyTemplate replaces f.Prompt with the rendered --template for run and
+// start. A template and a positional prompt cannot be combined.
+func ApplyTemplate(f *Flags, configDir string, fromConfig map[string]string) error {
+	prompt, err := RenderFlagsTemplate(f, configDir, fromConfig)
+	if err != nil || f.Template == "" {
+		return err
+	}
+	if f.Prompt != "" {
+		return errs.User(`"Cannot combine --template with a prompt"`)
+	}
+	f.Prompt = prompt
+	return nil
+}
+
+// TemplateListCmd prints one line per available template, sorted by name:
+// the name followed by its placeholders.
+func TemplateListCmd(configDir string, fromConfig map[string]string, w io.Writer) error {
+	templates, err := LoadTemplates(configDir, fromConfig)
+	if err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		fmt.Fprintf(w, "No templates (add %s/*%s or a [%s] table to glm.toml)\n",
+			filepath.Join(configDir, TemplatesDirName), templateExt, config.TemplatesSection)
+		return nil
+	}
+
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vars := templates[name].Placeholders()
+		if len(vars) == 0 {
+			fmt.Fprintln(w, name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(vars, ", "))
+	}
+	return nil
+}
+
+// TemplateShowCmd prints the source and raw body of the named template.
+func TemplateShowCmd(configDir string, fromConfig map[string]string, name string, w io.Writer) error {
+	t, err := FindTemplate(configDir, fromConfig, name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# %s (%s)\n%s\n", t.Name, t.Source, t.Body)
+	return nil
+}
@@ -0,0 +1,212 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// ---------------------------------------------------------------------------
+// helpers
+// ---------------------------------------------------------------------------
+
+// writeTemplateFile creates configDir/templates/<name>.txt with body.
+func writeTemplateFile(t *testing.T, configDir, name, body string) {
+	t.Helper()
+	dir := filepath.Join(configDir, cmd.TemplatesDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir templates: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(body), 0o644); err != nil {
+		t.Fatalf("write template %s: %v", name, err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Rendering
+// ---------------------------------------------------------------------------
+
+// Scenario: --template with -v vars becomes the prompt
+func TestApplyTemplateSubstitutesVariables(t *testing.T) {
+	configDir := t.TempDir()
+	writeTemplateFile(t, configDir, "review", "Review {{file}} for race conditions.\nFocus on {{ focus }} and {{file}}.\n")
+
+	f, err := cmd.ParseFlags([]string{"--template", "review", "-v", "file=src/main.go", "-v", "focus=locks"})
+	if err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if err := cmd.ApplyTemplate(f, configDir, nil); err != nil {
+		t.Fatalf("ApplyTemplate: %v", err)
+	}
+
+	want := "Review src/main.go for race conditions.\nFocus on locks and src/main.go."
+	if f.Prompt != want {
+		t.Errorf("Prompt = %q, want %q", f.Prompt, want)
+	}
+}
+
+// Scenario: Missing variables are reported by name
+func TestApplyTemplateUnresolvedPlaceholders(t *testing.T) {
+	configDir := t.TempDir()
+	writeTemplateFile(t, configDir, "tests", "Write table-driven tests for {{func}} in {{file}}")
+
+	f := &cmd.Flags{Dir: ".", Template: "tests", Vars: map[string]string{"file": "a.go"}}
+	err := cmd.ApplyTemplate(f, configDir, nil)
+	if err == nil {
+		t.Fatal("expected error for unresolved placeholder")
+	}
+	if !strings.Contains(err.Error(), `err:user "Template tests has unresolved variables: func`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Scenario: Positional prompts are unaffected when no template is given
+func TestApplyTemplateWithoutTemplateKeepsPrompt(t *testing.T) {
+	f, err := cmd.ParseFlags([]string{"-t", "60", "fix the bug"})
+	if err != nil {
+		t.Fatalf("ParseFlags: %v", err)
+	}
+	if err := cmd.ApplyTemplate(f, t.TempDir(), nil); err != nil {
+		t.Fatalf("ApplyTemplate: %v", err)
+	}
+	if f.Prompt != "fix the bug" {
+		t.Errorf("Prompt = %q, want %q", f.Prompt, "fix the bug")
+	}
+}
+
+// Scenario: Misuse of --template and -v is an err:user
+func TestApplyTemplateErrors(t *testing.T) {
+	configDir := t.TempDir()
+	writeTemplateFile(t, configDir, "review", "Review {{file}}")
+
+	tests := []struct {
+		name    string
+		flags   cmd.Flags
+		wantErr string
+	}{
+		{
+			name:    "template and positional prompt",
+			flags:   cmd.Flags{Template: "review", Vars: map[string]string{"file": "a.go"}, Prompt: "also this"},
+			wantErr: `err:user "Cannot combine --template with a prompt"`,
+		},
+		{
+			name:    "vars without template",
+			flags:   cmd.Flags{Vars: map[string]string{"file": "a.go"}, Prompt: "fix"},
+			wantErr: `err:user "-v requires --template"`,
+		},
+		{
+			name:    "unknown template",
+			flags:   cmd.Flags{Template: "nope"},
+			wantErr: `err:not_found "Template not found: nope`,
+		},
+		{
+			name:    "path traversal in name",
+			flags:   cmd.Flags{Template: "../glm"},
+			wantErr: `err:user "Invalid template name: ../glm"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cmd.ApplyTemplate(&tt.flags, configDir, nil)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("ApplyTemplate error = %v, want prefix %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Sources, list and show
+// ---------------------------------------------------------------------------
+
+// Scenario: Templates come from glm.toml and the templates directory; files win
+func TestLoadTemplatesMergesSources(t *testing.T) {
+	configDir := t.TempDir()
+	writeTemplateFile(t, configDir, "review", "file review {{file}}")
+	fromConfig := map[string]string{
+		"review": "toml review {{file}}",
+		"tests":  "Write tests for {{func}}",
+	}
+
+	templates, err := cmd.LoadTemplates(configDir, fromConfig)
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	if len(templates) != 2 {
+		t.Fatalf("expected 2 templates, got %d: %+v", len(templates), templates)
+	}
+	if got := templates["review"].Body; got != "file review {{file}}" {
+		t.Errorf("review body = %q, want the file version", got)
+	}
+	if got := templates["tests"].Body; got != "Write tests for {{func}}" {
+		t.Errorf("tests body = %q", got)
+	}
+}
+
+// Scenario: glm template list shows names and placeholders, sorted
+func TestTemplateListCmd(t *testing.T) {
+	configDir := t.TempDir()
+	writeTemplateFile(t, configDir, "review", "Review {{file}} for {{focus}}")
+	fromConfig := map[string]string{"explain": "Explain this repository"}
+
+	var buf bytes.Buffer
+	if err := cmd.TemplateListCmd(configDir, fromConfig, &buf); err != nil {
+		t.Fatalf("TemplateListCmd: %v", err)
+	}
+	want := "explain\nreview\tfile, focus\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := cmd.TemplateListCmd(t.TempDir(), nil, &buf); err != nil {
+		t.Fatalf("TemplateListCmd (empty): %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "No templates") {
+		t.Errorf("expected 'No templates' hint, got %q", buf.String())
+	}
+}
+
+// Scenario: glm template show prints the raw template body
+func TestTemplateShowCmd(t *testing.T) {
+	configDir := t.TempDir()
+	writeTemplateFile(t, configDir, "review", "Review {{file}}\n")
+
+	var buf bytes.Buffer
+	if err := cmd.TemplateShowCmd(configDir, nil, "review", &buf); err != nil {
+		t.Fatalf("TemplateShowCmd: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Review {{file}}") {
+		t.Errorf("output missing body: %q", buf.String())
+	}
+
+	if err := cmd.TemplateShowCmd(configDir, nil, "missing", &buf); err == nil || !strings.HasPrefix(err.Error(), "err:not_found") {
+		t.Errorf("expected err:not_found, got %v", err)
+	}
+}
+
+// Scenario: glm config set adds top-level keys above the [templates] table
+func TestConfigSetKeepsTemplatesTable(t *testing.T) {
+	configDir := t.TempDir()
+	toml := "model = \"glm-4.7\"\n\n[templates]\nreview = \"Review {{file}}\"\n"
+	if err := os.WriteFile(filepath.Join(configDir, "glm.toml"), []byte(toml), 0o644); err != nil {
+		t.Fatalf("write glm.toml: %v", err)
+	}
+
+	if err := cmd.ConfigSetCmd(cmd.ConfigSetOptions{ConfigDir: configDir, Key: "max_parallel", Value: "5"}); err != nil {
+		t.Fatalf("ConfigSetCmd: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "glm.toml"))
+	if err != nil {
+		t.Fatalf("read glm.toml: %v", err)
+	}
+	want := "model = \"glm-4.7\"\nmax_parallel = 5\n\n[templates]\nreview = \"Review {{file}}\"\n"
+	if string(data) != want {
+		t.Errorf("glm.toml = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,304 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// git runs git with args in dir and returns its trimmed output.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitFile writes content to dir/name and commits it with message.
+func commitFile(t *testing.T, dir, name, content, message string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "--quiet", "-m", message)
+}
+
+// updateFixture creates an origin repository with one commit and a clone of
+// it, isolated from the user's git config. It returns both paths.
+func updateFixture(t *testing.T) (origin, clone string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	origin = filepath.Join(t.TempDir(), "origin")
+	git(t, filepath.Dir(origin), "init", "--quiet", "-b", "main", origin)
+	commitFile(t, origin, "a.txt", "one\n", "initial")
+	clone = filepath.Join(t.TempDir(), "clone")
+	git(t, filepath.Dir(clone), "clone", "--quiet", origin, clone)
+	return origin, clone
+}
+
+// updateOpts returns UpdateOptions for a source install in clone.
+func updateOpts(t *testing.T, clone string, out *bytes.Buffer) cmd.UpdateOptions {
+	return cmd.UpdateOptions{
+		ConfigDir:    t.TempDir(),
+		CloneDir:     clone,
+		ClaudeMDPath: filepath.Join(t.TempDir(), "CLAUDE.md"),
+		In:           strings.NewReader(""),
+		Out:          out,
+		ErrOut:       out,
+	}
+}
+
+// Scenario: --check reports the incoming commits and changes nothing
+func TestUpdateCheckDoesNotApply(t *testing.T) {
+	origin, clone := updateFixture(t)
+	before := git(t, clone, "rev-parse", "HEAD")
+	commitFile(t, origin, "a.txt", "two\n", "add feature two")
+
+	var out bytes.Buffer
+	opts := updateOpts(t, clone, &out)
+	opts.Check = true
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd: %v", err)
+	}
+	if !strings.Contains(out.String(), "Update available") || !strings.Contains(out.String(), "add feature two") {
+		t.Errorf("output = %q", out.String())
+	}
+	if got := git(t, clone, "rev-parse", "HEAD"); got != before {
+		t.Errorf("HEAD moved to %s during --check", got)
+	}
+	if _, err := os.Stat(opts.ClaudeMDPath); err == nil {
+		t.Error("--check injected CLAUDE.md")
+	}
+
+	// Once applied, --check reports nothing to do.
+	out.Reset()
+	opts.Check, opts.Yes = false, true
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd: %v", err)
+	}
+	out.Reset()
+	opts.Check = true
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd: %v", err)
+	}
+	if !strings.Contains(out.String(), "Already up to date") {
+		t.Errorf("output after update = %q", out.String())
+	}
+}
+
+// Scenario: The commit log is shown and the update waits for confirmation
+func TestUpdateAsksBeforeApplying(t *testing.T) {
+	origin, clone := updateFixture(t)
+	before := git(t, clone, "rev-parse", "HEAD")
+	commitFile(t, origin, "b.txt", "b\n", "add b")
+
+	var out bytes.Buffer
+	opts := updateOpts(t, clone, &out)
+	opts.In = strings.NewReader("n\n")
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd: %v", err)
+	}
+	if !strings.Contains(out.String(), "add b") || !strings.Contains(out.String(), "Update cancelled.") {
+		t.Errorf("output = %q", out.String())
+	}
+	if got := git(t, clone, "rev-parse", "HEAD"); got != before {
+		t.Errorf("HEAD moved to %s after declining", got)
+	}
+
+	opts.In = strings.NewReader("y\n")
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd: %v", err)
+	}
+	if got, want := git(t, clone, "rev-parse", "HEAD"), git(t, origin, "rev-parse", "HEAD"); got != want {
+		t.Errorf("HEAD = %s, want %s", got, want)
+	}
+	if _, err := os.Stat(opts.ClaudeMDPath); err != nil {
+		t.Errorf("CLAUDE.md not injected: %v", err)
+	}
+}
+
+// Scenario: --to pins the clone to a tag, and to a branch on origin
+func TestUpdateToTagAndBranch(t *testing.T) {
+	origin, clone := updateFixture(t)
+	commitFile(t, origin, "a.txt", "two\n", "release two")
+	git(t, origin, "tag", "v1.2.0")
+	tagRev := git(t, origin, "rev-parse", "HEAD")
+	commitFile(t, origin, "a.txt", "three\n", "after release")
+	git(t, origin, "checkout", "--quiet", "-b", "next")
+	commitFile(t, origin, "n.txt", "next\n", "next work")
+	nextRev := git(t, origin, "rev-parse", "HEAD")
+
+	var out bytes.Buffer
+	opts := updateOpts(t, clone, &out)
+	opts.Yes = true
+	opts.Target = "v1.2.0"
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd --to v1.2.0: %v", err)
+	}
+	if got := git(t, clone, "rev-parse", "HEAD"); got != tagRev {
+		t.Errorf("HEAD = %s, want tag %s", got, tagRev)
+	}
+
+	opts.Target = "next"
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd --to next: %v", err)
+	}
+	if got := git(t, clone, "rev-parse", "HEAD"); got != nextRev {
+		t.Errorf("HEAD = %s, want next %s", got, nextRev)
+	}
+	if got := git(t, clone, "rev-parse", "--abbrev-ref", "HEAD"); got != "next" {
+		t.Errorf("branch = %s, want next", got)
+	}
+}
+
+// Scenario: An unknown target or a failed checkout is err:user and changes nothing
+func TestUpdateFailedCheckoutLeavesTreeUntouched(t *testing.T) {
+	origin, clone := updateFixture(t)
+	before := git(t, clone, "rev-parse", "HEAD")
+	commitFile(t, origin, "a.txt", "two\n", "change a")
+	git(t, origin, "tag", "v2.0.0")
+
+	var out bytes.Buffer
+	opts := updateOpts(t, clone, &out)
+	opts.Yes = true
+	opts.Target = "v9.9.9"
+	err := cmd.UpdateCmd(opts)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("unknown target: err = %v, want err:user", err)
+	}
+
+	// A local edit to a file the tag changes blocks the checkout.
+	local := filepath.Join(clone, "a.txt")
+	if err := os.WriteFile(local, []byte("local edit\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts.Target = "v2.0.0"
+	err = cmd.UpdateCmd(opts)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Fatalf("blocked checkout: err = %v, want err:user", err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "local edit\n" {
+		t.Errorf("a.txt = %q, local edit lost", data)
+	}
+	if got := git(t, clone, "rev-parse", "HEAD"); got != before {
+		t.Errorf("HEAD moved to %s after a failed checkout", got)
+	}
+	if _, err := os.Stat(opts.ClaudeMDPath); err == nil {
+		t.Error("CLAUDE.md injected after a failed update")
+	}
+}
+
+// fakeGo puts a "go" script on PATH that resolves every version query to
+// v1.0.0 and installs a glm binary into a temp GOBIN; the binary prints
+// "glm <binVersion>". When installFails is set, "go install" exits 1 without
+// installing anything. It returns the GOBIN directory.
+func fakeGo(t *testing.T, installFails bool, binVersion string) string {
+	t.Helper()
+	binDir, gobin := t.TempDir(), t.TempDir()
+	install := `printf '#!/bin/sh\necho "glm ` + binVersion + `"\n' > "$FAKE_GOBIN/glm"; chmod +x "$FAKE_GOBIN/glm"`
+	if installFails {
+		install = `echo "go: network unreachable" >&2; exit 1`
+	}
+	script := `#!/bin/sh
+case "$1" in
+list) echo v1.0.0 ;;
+env) echo "$FAKE_GOBIN"; echo /nonexistent/gopath ;;
+install) ` + install + ` ;;
+*) exit 2 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "go"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_GOBIN", gobin)
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return gobin
+}
+
+// goInstallOpts returns UpdateOptions for a go-install install whose
+// CLAUDE.md already holds user content.
+func goInstallOpts(t *testing.T, out *bytes.Buffer) cmd.UpdateOptions {
+	t.Helper()
+	configDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"install_mode":"go-install"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	claudeMD := filepath.Join(t.TempDir(), "CLAUDE.md")
+	if err := os.WriteFile(claudeMD, []byte("# my notes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.UpdateOptions{
+		ConfigDir:    configDir,
+		ClaudeMDPath: claudeMD,
+		Version:      "0.9.0",
+		Yes:          true,
+		Out:          out,
+		ErrOut:       out,
+	}
+}
+
+// Scenario: A failed go install leaves CLAUDE.md unchanged
+func TestUpdateGoInstallFailureKeepsClaudeMD(t *testing.T) {
+	fakeGo(t, true, "")
+	var out bytes.Buffer
+	opts := goInstallOpts(t, &out)
+
+	if err := cmd.UpdateCmd(opts); err == nil {
+		t.Fatal("expected error when go install fails")
+	}
+	if data, _ := os.ReadFile(opts.ClaudeMDPath); string(data) != "# my notes\n" {
+		t.Errorf("CLAUDE.md = %q, want it unchanged", data)
+	}
+}
+
+// Scenario: An installed binary reporting the wrong version fails verification
+func TestUpdateGoInstallVerifiesBinary(t *testing.T) {
+	fakeGo(t, false, "0.9.0")
+	var out bytes.Buffer
+	opts := goInstallOpts(t, &out)
+
+	err := cmd.UpdateCmd(opts)
+	if err == nil || !strings.Contains(err.Error(), "expected 1.0.0") {
+		t.Fatalf("err = %v, want a version mismatch", err)
+	}
+	if data, _ := os.ReadFile(opts.ClaudeMDPath); string(data) != "# my notes\n" {
+		t.Errorf("CLAUDE.md = %q, want it unchanged", data)
+	}
+}
+
+// Scenario: A verified go install reports the binary path and injects CLAUDE.md
+func TestUpdateGoInstallSucceeds(t *testing.T) {
+	gobin := fakeGo(t, false, "1.0.0")
+	var out bytes.Buffer
+	opts := goInstallOpts(t, &out)
+
+	if err := cmd.UpdateCmd(opts); err != nil {
+		t.Fatalf("UpdateCmd: %v", err)
+	}
+	if !strings.Contains(out.String(), "Installed: "+filepath.Join(gobin, "glm")+" (v1.0.0)") {
+		t.Errorf("output = %q, want the installed binary path", out.String())
+	}
+	data, _ := os.ReadFile(opts.ClaudeMDPath)
+	if !strings.HasPrefix(string(data), "# my notes\n") || !strings.Contains(string(data), "GLM-SUBAGENT-START") {
+		t.Errorf("CLAUDE.md = %q, want notes plus the GLM section", data)
+	}
+}
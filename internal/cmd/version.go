@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+)
+
+// LatestReleaseURL is the GitHub API endpoint "glm version --check-update"
+// asks for the latest release.
+const LatestReleaseURL = "https://api.github.com/repos/veschin/GoLeM/releases/latest"
+
+// UpdateCheckTimeout bounds the request of "glm version --check-update".
+const UpdateCheckTimeout = 5 * time.Second
+
+// DevBuild is reported for build metadata that is unknown, e.g. the commit of
+// a binary built without -ldflags outside a git checkout.
+const DevBuild = "dev"
+
+// VersionInfo is what "glm version --json" prints. The update fields are set
+// only with --check-update: Latest and UpdateAvailable when GitHub answered,
+// UpdateCheckError when it did not.
+type VersionInfo struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit"`
+	Date             string `json:"date"`
+	GoVersion        string `json:"go_version"`
+	InstallMode      string `json:"install_mode"`
+	Latest           string `json:"latest,omitempty"`
+	UpdateAvailable  *bool  `json:"update_available,omitempty"`
+	UpdateCheckError string `json:"update_check_error,omitempty"`
+}
+
+// VersionOptions configures VersionCmd.
+type VersionOptions struct {
+	// Version, Commit and Date are the values set with -ldflags -X. An empty
+	// Commit or Date is taken from the VCS stamp of the build, else DevBuild.
+	Version string
+	Commit  string
+	Date    string
+	// ConfigDir is the GoLeM config directory (for reading config.json install_mode).
+	ConfigDir string
+	// JSON prints a VersionInfo instead of "glm <version>".
+	JSON bool
+	// CheckUpdate asks GitHub for the latest release.
+	CheckUpdate bool
+	// HTTPClient makes the update check (nil = a client with
+	// UpdateCheckTimeout); ReleasesURL replaces LatestReleaseURL.
+	HTTPClient  *http.Client
+	ReleasesURL string
+	// Out is the writer for the version; ErrOut gets a failed update check.
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+// VersionCmd implements glm version. Without JSON it prints "glm <version>"
+// and, with CheckUpdate, a line naming the latest release. A failed update
+// check (offline, rate limited) is reported, never an error: the command
+// still succeeds.
+func VersionCmd(opts VersionOptions) error {
+	info := BuildVersionInfo(opts.Version, opts.Commit, opts.Date)
+	info.InstallMode = readInstallMode(opts.ConfigDir)
+
+	if opts.CheckUpdate {
+		client := opts.HTTPClient
+		if client == nil {
+			client = &http.Client{Timeout: UpdateCheckTimeout}
+		}
+		url := opts.ReleasesURL
+		if url == "" {
+			url = LatestReleaseURL
+		}
+		latest, err := latestRelease(client, url)
+		if err != nil {
+			info.UpdateCheckError = err.Error()
+		} else {
+			newer := claude.CompareVersions(strings.TrimPrefix(latest, "v"), strings.TrimPrefix(info.Version, "v")) > 0
+			info.Latest, info.UpdateAvailable = latest, &newer
+		}
+	}
+
+	if opts.JSON {
+		return JSONOutput(opts.Out, info)
+	}
+	fmt.Fprintf(opts.Out, "glm %s\n", info.Version)
+	switch {
+	case info.UpdateCheckError != "":
+		fmt.Fprintf(opts.ErrOut, "glm: cannot check for updates: %s\n", info.UpdateCheckError)
+	case info.UpdateAvailable == nil:
+	case *info.UpdateAvailable:
+		fmt.Fprintf(opts.Out, "latest release: %s (run glm update)\n", info.Latest)
+	default:
+		fmt.Fprintf(opts.Out, "latest release: %s (up to date)\n", info.Latest)
+	}
+	return nil
+}
+
+// BuildVersionInfo returns the build metadata of the running binary. commit
+// and date default to the VCS revision and commit time go build stamps into
+// a binary built in a git checkout (a modified tree adds "-dirty"), and to
+// DevBuild otherwise, as for "go install ...@latest".
+func BuildVersionInfo(version, commit, date string) VersionInfo {
+	info := VersionInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		vcs := map[string]string{}
+		for _, s := range bi.Settings {
+			vcs[s.Key] = s.Value
+		}
+		if info.Commit == "" && vcs["vcs.revision"] != "" {
+			info.Commit = vcs["vcs.revision"]
+			if len(info.Commit) > 12 {
+				info.Commit = info.Commit[:12]
+			}
+			if vcs["vcs.modified"] == "true" {
+				info.Commit += "-dirty"
+			}
+		}
+		if info.Date == "" {
+			info.Date = vcs["vcs.time"]
+		}
+	}
+	for _, field := range []*string{&info.Version, &info.Commit, &info.Date} {
+		if *field == "" {
+			*field = DevBuild
+		}
+	}
+	return info
+}
+
+// latestRelease returns the tag of the release at url, a GitHub "latest
+// release" endpoint.
+func latestRelease(client *http.Client, url string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&release); err != nil {
+		return "", fmt.Errorf("read %s: %w", url, err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("%s names no release tag", url)
+	}
+	return release.TagName, nil
+}
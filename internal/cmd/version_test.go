@@ -0,0 +1,133 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+)
+
+// Scenario: glm version --json prints the build metadata and install mode
+func TestVersionJSON(t *testing.T) {
+	configDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"install_mode":"go-install"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err := cmd.VersionCmd(cmd.VersionOptions{
+		Version: "1.0.0", Commit: "abc1234", Date: "2026-10-01T12:00:00Z",
+		ConfigDir: configDir, JSON: true, Out: &out, ErrOut: &out,
+	})
+	if err != nil {
+		t.Fatalf("VersionCmd: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	want := map[string]any{
+		"version":      "1.0.0",
+		"commit":       "abc1234",
+		"date":         "2026-10-01T12:00:00Z",
+		"install_mode": "go-install",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+	if gv, _ := got["go_version"].(string); !strings.HasPrefix(gv, "go") {
+		t.Errorf("go_version = %v", got["go_version"])
+	}
+	if len(got) != 5 {
+		t.Errorf("keys = %v, want only the five build fields without --check-update", got)
+	}
+
+	// Without ldflags and config.json the fields still have values.
+	info := cmd.BuildVersionInfo("1.0.0", "", "")
+	if info.Commit == "" || info.Date == "" {
+		t.Errorf("BuildVersionInfo without ldflags = %+v, want fallbacks", info)
+	}
+	out.Reset()
+	if err := cmd.VersionCmd(cmd.VersionOptions{Version: "1.0.0", ConfigDir: t.TempDir(), Out: &out}); err != nil || out.String() != "glm 1.0.0\n" {
+		t.Errorf("plain version = %q, %v; want \"glm 1.0.0\\n\"", out.String(), err)
+	}
+}
+
+// Scenario: --check-update compares the latest GitHub release
+func TestVersionCheckUpdate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"tag_name":"v1.2.0"}`))
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	err := cmd.VersionCmd(cmd.VersionOptions{
+		Version: "1.0.0", ConfigDir: t.TempDir(), JSON: true, CheckUpdate: true,
+		HTTPClient: srv.Client(), ReleasesURL: srv.URL, Out: &out, ErrOut: &out,
+	})
+	if err != nil {
+		t.Fatalf("VersionCmd: %v", err)
+	}
+	var info cmd.VersionInfo
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("output is not a VersionInfo: %v\n%s", err, out.String())
+	}
+	if info.Latest != "v1.2.0" || info.UpdateAvailable == nil || !*info.UpdateAvailable || info.UpdateCheckError != "" {
+		t.Errorf("info = %+v, want latest v1.2.0 with an update available", info)
+	}
+
+	out.Reset()
+	err = cmd.VersionCmd(cmd.VersionOptions{
+		Version: "1.2.0", ConfigDir: t.TempDir(), CheckUpdate: true,
+		HTTPClient: srv.Client(), ReleasesURL: srv.URL, Out: &out, ErrOut: &out,
+	})
+	if err != nil || out.String() != "glm 1.2.0\nlatest release: v1.2.0 (up to date)\n" {
+		t.Errorf("text output = %q, %v", out.String(), err)
+	}
+}
+
+// offlineTransport fails every request as if the network were down.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("dial tcp: network is unreachable")
+}
+
+// Scenario: offline, --check-update reports the failure and still succeeds
+func TestVersionCheckUpdateOffline(t *testing.T) {
+	client := &http.Client{Transport: offlineTransport{}}
+
+	var out bytes.Buffer
+	err := cmd.VersionCmd(cmd.VersionOptions{
+		Version: "1.0.0", ConfigDir: t.TempDir(), JSON: true, CheckUpdate: true,
+		HTTPClient: client, Out: &out, ErrOut: &out,
+	})
+	if err != nil {
+		t.Fatalf("VersionCmd offline --json: %v", err)
+	}
+	var info cmd.VersionInfo
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("output is not a VersionInfo: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(info.UpdateCheckError, "network is unreachable") || info.UpdateAvailable != nil || info.Latest != "" {
+		t.Errorf("info = %+v, want only update_check_error", info)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = cmd.VersionCmd(cmd.VersionOptions{
+		Version: "1.0.0", ConfigDir: t.TempDir(), CheckUpdate: true,
+		HTTPClient: client, Out: &stdout, ErrOut: &stderr,
+	})
+	if err != nil || stdout.String() != "glm 1.0.0\n" || !strings.HasPrefix(stderr.String(), "glm: cannot check for updates:") {
+		t.Errorf("offline text: err %v, stdout %q, stderr %q", err, stdout.String(), stderr.String())
+	}
+}
@@ -4,14 +4,21 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
 )
 
-// Hardcoded constants exposed for inspection.
+// Hardcoded constants exposed for inspection. ZaiBaseURL is only the default
+// base_url; any Anthropic-compatible endpoint can be configured.
 const (
 	ZaiBaseURL            = "https://api.z.ai/api/anthropic"
 	ZaiAPITimeoutMs       = "3000000"
@@ -19,32 +26,220 @@ const (
 	DefaultMaxParallel    = 3
 	DefaultModel          = "glm-4.7"
 	DefaultPermissionMode = "bypassPermissions"
+	DefaultDiffMaxBytes   = 1 << 20
+	DefaultMaxPromptBytes = 200 << 10
+	// DefaultChainContextLimit is the default chain_context_limit.
+	DefaultChainContextLimit = 16 << 10
+	// DefaultPriorityAging is the default priority_aging in seconds.
+	DefaultPriorityAging = 600
+	// DefaultKillGrace is the default kill_grace_seconds.
+	DefaultKillGrace = 5
+	// DefaultMaxDepth is the default max_depth: a job may not start another.
+	DefaultMaxDepth = 1
+)
+
+// The confine_mode values: what a confined job does about paths outside its
+// working directory.
+const (
+	// ConfineWarn prints a warning and lets the job run and finish as usual.
+	ConfineWarn = "warn"
+	// ConfineStrict refuses the prompt and ends a job that touched such a
+	// path permission_error.
+	ConfineStrict = "strict"
 )
 
+// DefaultResultFailureMarkers are the result_failure_markers used when
+// glm.toml sets none: phrases with which claude reports in its result that
+// it could not do the task, although it exited 0.
+var DefaultResultFailureMarkers = []string{"I was unable", "I cannot", "Error:", "failed to complete"}
+
+// ModelSources names the setting a model slot of a loaded Config was taken
+// from: "default", "glm.toml model", "glm.toml opus_model" (or
+// sonnet_model, haiku_model), "GLM_MODEL", "GLM_OPUS_MODEL" (or
+// GLM_SONNET_MODEL, GLM_HAIKU_MODEL) or "-m" (Options.Model). They are empty
+// in a Config that was not loaded.
+type ModelSources struct {
+	Opus   string
+	Sonnet string
+	Haiku  string
+}
+
 // Config holds all configuration values for GoLeM operations.
 type Config struct {
-	Model           string
-	OpusModel       string
-	SonnetModel     string
-	HaikuModel      string
-	PermissionMode  string
-	MaxParallel     int
-	SubagentDir     string
-	ConfigDir       string
+	Model       string
+	OpusModel   string
+	SonnetModel string
+	HaikuModel  string
+	// ModelSources records which setting each of OpusModel, SonnetModel and
+	// HaikuModel came from.
+	ModelSources   ModelSources
+	PermissionMode string
+	MaxParallel    int
+	// SubagentDir is the root the job directories are stored under: the
+	// --subagent-dir flag, GLM_SUBAGENT_DIR or subagent_dir, else the
+	// directory passed to Load. A relative value is resolved against the
+	// project root (see ProjectRoot).
+	SubagentDir string
+	ConfigDir   string
+	// ConfigFile is the glm.toml that was read: the global --config flag,
+	// else glm.toml in ConfigDir (see TOMLPath).
+	ConfigFile string
+	// ZaiBaseURL is the Anthropic-compatible API base URL passed to claude as
+	// ANTHROPIC_BASE_URL (base_url, GLM_BASE_URL). Defaults to Z.AI.
 	ZaiBaseURL      string
 	ZaiAPIKey       string
 	ZaiAPITimeoutMs string
 	Debug           bool
+	// KeepJobs retains job directories after run/result instead of deleting them.
+	KeepJobs bool
+	// RetentionDays prunes retained finished jobs older than this many days
+	// (0 disables pruning).
+	RetentionDays int
+	// MaxDiskMB is the disk space the subagents directory may use before new
+	// jobs warn, or with --strict-disk are refused (max_disk_mb; 0 = no
+	// limit).
+	MaxDiskMB int
+	// MaxOutputBytes caps the job output glm run and glm result print
+	// (max_output_bytes; 0 = no limit). The job files keep all of it.
+	MaxOutputBytes int
+	// ChainContextLimit caps the previous step's output glm chain injects
+	// into the next prompt (chain_context_limit; 0 = no limit). Longer
+	// output is cut to its head and tail, or summarized with
+	// --summarize-context.
+	ChainContextLimit int
+	// ChainCleanIntermediate deletes the job dirs of every step but the
+	// last group once a chain succeeds, as with --clean-intermediate
+	// (chain_clean_intermediate, GLM_CHAIN_CLEAN_INTERMEDIATE).
+	ChainCleanIntermediate bool
+	// MetricsEnabled appends one anonymized line per finished job to
+	// metrics.jsonl in ConfigDir, for glm metrics summary (metrics_enabled,
+	// GLM_METRICS_ENABLED).
+	MetricsEnabled bool
+	// RedactPrompts records the prompts in the command line a job keeps in
+	// job.json as their SHA-256 and length (redact_prompts,
+	// GLM_REDACT_PROMPTS).
+	RedactPrompts bool
+	// StripANSI removes ANSI escape sequences from the result text and
+	// changelog a job's raw.json is parsed into; raw.json keeps them
+	// (strip_ansi, GLM_STRIP_ANSI; default true).
+	StripANSI bool
+	// ClaudePath pins the claude binary to an absolute path; empty searches PATH.
+	ClaudePath string
+	// DefaultTimeout is the job timeout in seconds used when -t is not given.
+	DefaultTimeout int
+	// PriorityAging is how long, in seconds, a queued job waits before its
+	// priority is raised one level, so low priority jobs are not starved
+	// (priority_aging, GLM_PRIORITY_AGING; 0 = never).
+	PriorityAging int
+	// KillGraceSeconds is how long glm kill waits for a job to exit after
+	// SIGTERM before it sends SIGKILL (kill_grace_seconds,
+	// GLM_KILL_GRACE_SECONDS; --grace overrides it).
+	KillGraceSeconds int
+	// MaxDepth is how deep glm jobs may nest: a job started from inside
+	// another job is at depth 2 (max_depth, GLM_MAX_DEPTH). Deeper jobs are
+	// refused unless --allow-nested is given.
+	MaxDepth int
+	// Templates holds the prompt templates from the [templates] table of
+	// glm.toml, keyed by name.
+	Templates map[string]string
+	// MaxParallelPerModel holds the [max_parallel_per_model] table: a
+	// concurrency limit per execution model. Models not listed use MaxParallel.
+	MaxParallelPerModel map[string]int
+	// APIKeyCmd is the api_key_cmd shell command whose stdout is the API key.
+	APIKeyCmd string
+	// APIKeyFile is the api_key_file path holding the API key (GLM_API_KEY_FILE).
+	// Empty uses ConfigDir/zai_api_key with the legacy ~/.config/zai/env
+	// fallback; see APIKeyPath.
+	APIKeyFile string
+	// APIKeySource says where ZaiAPIKey came from: an environment variable
+	// name, "api_key_cmd", or the key file path. Safe to log, unlike the key.
+	APIKeySource string
+	// CaptureDiff saves "git diff" of the workdir to the job dir after each
+	// job (capture_diff).
+	CaptureDiff bool
+	// DiffMaxBytes caps the saved diff.patch (diff_max_bytes); larger diffs
+	// are truncated with a marker.
+	DiffMaxBytes int
+	// AllowUnsafePaths lets bypassPermissions jobs run in system paths, the
+	// home directory root or outside home (allow_unsafe_paths).
+	AllowUnsafePaths bool
+	// AllowOverlap lets a job start in a workdir that a running job works
+	// in, above or below (allow_overlap).
+	AllowOverlap bool
+	// ConfineToWorkdir checks every job, as with --confine, for paths outside
+	// its working directory in the prompt and the changelog
+	// (confine_to_workdir, GLM_CONFINE_TO_WORKDIR).
+	ConfineToWorkdir bool
+	// ConfineMode is ConfineWarn or ConfineStrict (confine_mode,
+	// GLM_CONFINE_MODE).
+	ConfineMode string
+	// MaxPromptBytes rejects larger prompts before a job is created
+	// (max_prompt_bytes).
+	MaxPromptBytes int
+	// StrictResult marks a job failed when it exits 0 but its result contains
+	// one of ResultFailureMarkers (strict_result, GLM_STRICT_RESULT).
+	StrictResult bool
+	// ResultFailureMarkers is the result_failure_markers array checked by
+	// StrictResult; DefaultResultFailureMarkers unless glm.toml sets it.
+	ResultFailureMarkers []string
+	// ServeToken is the shared secret glm serve requires in the
+	// Authorization header of POST /jobs and DELETE /jobs/{id} (serve_token,
+	// GLM_SERVE_TOKEN). Empty disables those endpoints.
+	ServeToken string
+	// OnCompleteCmd is the shell command run when a glm start job finishes,
+	// unless the job has its own --notify (on_complete_cmd,
+	// GLM_ON_COMPLETE_CMD). Empty runs nothing.
+	OnCompleteCmd string
 }
 
 // Options allows CLI flags to override config values after load.
 type Options struct {
 	Model string
+	// SubagentDir overrides subagent_dir and GLM_SUBAGENT_DIR (the global
+	// --subagent-dir flag).
+	SubagentDir string
+	// ProjectRoot is the directory a relative subagent directory is
+	// resolved against; empty uses ProjectRoot of the working directory.
+	ProjectRoot string
+	// ConfigFile is read instead of configDir/glm.toml (the global --config
+	// flag). Unlike the default file it must exist.
+	ConfigFile string
+}
+
+// TOMLPath returns the glm.toml opts reads: opts.ConfigFile, else glm.toml
+// in configDir.
+func TOMLPath(configDir string, opts Options) string {
+	if opts.ConfigFile != "" {
+		return opts.ConfigFile
+	}
+	return filepath.Join(configDir, "glm.toml")
+}
+
+// readTOML returns the contents of the glm.toml opts reads (see TOMLPath).
+// A missing default file reads as empty; a missing --config file, or any
+// file that cannot be read, is err:config.
+func readTOML(configDir string, opts Options) (string, error) {
+	path := TOMLPath(configDir, opts)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		return string(data), nil
+	case opts.ConfigFile != "":
+		return "", errs.Config(`"Cannot read --config file: %s"`, err.Error())
+	case os.IsNotExist(err):
+		return "", nil
+	}
+	return "", errs.Config("\"Cannot read glm.toml: %s\"", err.Error())
 }
 
-// Load reads configuration from configDir/glm.toml, API key from configDir/zai_api_key
-// (with fallback to ~/.config/zai/env), applies environment variable overrides,
-// validates the result, and creates the subagent directory.
+// Load reads configuration from configDir/glm.toml, the API key from the
+// GLM_ZAI_API_KEY or ZAI_API_KEY environment variable, the api_key_cmd command,
+// or the api_key_file (default configDir/zai_api_key, with fallback to
+// ~/.config/zai/env), in that order, applies environment variable overrides,
+// validates the result, and creates the subagent directory. subagentDir is
+// the default subagent directory, used unless subagent_dir or
+// GLM_SUBAGENT_DIR sets another; when none is set (callers that never create
+// jobs) nothing is created.
 func Load(configDir, subagentDir string) (*Config, error) {
 	return LoadWithOptions(configDir, subagentDir, Options{})
 }
@@ -57,35 +252,59 @@ func LoadWithOptions(configDir, subagentDir string, opts Options) (*Config, erro
 		OpusModel:       DefaultModel,
 		SonnetModel:     DefaultModel,
 		HaikuModel:      DefaultModel,
+		ModelSources:    ModelSources{Opus: "default", Sonnet: "default", Haiku: "default"},
 		PermissionMode:  DefaultPermissionMode,
 		MaxParallel:     DefaultMaxParallel,
+		DefaultTimeout:  DefaultTimeout,
 		SubagentDir:     subagentDir,
 		ConfigDir:       configDir,
+		ConfigFile:      TOMLPath(configDir, opts),
 		ZaiBaseURL:      ZaiBaseURL,
 		ZaiAPITimeoutMs: ZaiAPITimeoutMs,
 		Debug:           false,
+		DiffMaxBytes:    DefaultDiffMaxBytes,
+		MaxPromptBytes:  DefaultMaxPromptBytes,
+
+		ChainContextLimit: DefaultChainContextLimit,
+		PriorityAging:     DefaultPriorityAging,
+		KillGraceSeconds:  DefaultKillGrace,
+		MaxDepth:          DefaultMaxDepth,
+		ConfineMode:       ConfineWarn,
+		StripANSI:         true,
+
+		ResultFailureMarkers: append([]string(nil), DefaultResultFailureMarkers...),
 	}
 
-	// 1. Read TOML from configDir/glm.toml
-	tomlPath := filepath.Join(configDir, "glm.toml")
-	if tomlData, err := os.ReadFile(tomlPath); err == nil {
-		if err := parseTOML(string(tomlData), cfg); err != nil {
-			return nil, err
-		}
-	} else if !os.IsNotExist(err) {
-		return nil, fmt.Errorf("err:config \"Cannot read glm.toml: %s\"", err.Error())
+	// 1. Read TOML from configDir/glm.toml or the --config file
+	tomlData, err := readTOML(configDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Missing default file = use defaults, no error
+	if err := parseTOML(tomlData, cfg); err != nil {
+		return nil, err
 	}
-	// Missing file = use defaults, no error
 
-	// 2. Read API key: try configDir/zai_api_key first, then ~/.config/zai/env (legacy)
-	apiKey, err := readAPIKey(configDir)
+	// 2. Resolve API key: environment, then api_key_cmd, then api_key_file
+	// or configDir/zai_api_key, then ~/.config/zai/env (legacy). The key file
+	// override is needed here, before the other env overrides.
+	if v := getenv("GLM_API_KEY_FILE"); v != "" {
+		cfg.APIKeyFile = v
+	}
+	if cfg.APIKeyFile != "" {
+		cfg.APIKeyFile = resolveKeyFilePath(configDir, cfg.APIKeyFile)
+	}
+	apiKey, source, err := resolveAPIKey(configDir, cfg.APIKeyCmd, cfg.APIKeyFile)
 	if err != nil {
 		return nil, err
 	}
 	cfg.ZaiAPIKey = apiKey
+	cfg.APIKeySource = source
 
 	// 3. Apply env var overrides
-	applyEnvOverrides(cfg)
+	if err := applyEnvOverrides(cfg); err != nil {
+		return nil, err
+	}
 
 	// 4. Apply LoadOption overrides (CLI flags)
 	if opts.Model != "" {
@@ -93,7 +312,9 @@ func LoadWithOptions(configDir, subagentDir string, opts Options) (*Config, erro
 		cfg.OpusModel = opts.Model
 		cfg.SonnetModel = opts.Model
 		cfg.HaikuModel = opts.Model
+		cfg.ModelSources = ModelSources{Opus: "-m", Sonnet: "-m", Haiku: "-m"}
 	}
+	applySubagentDirOption(cfg, opts)
 
 	// 5. Validate
 	if err := validate(cfg); err != nil {
@@ -101,31 +322,160 @@ func LoadWithOptions(configDir, subagentDir string, opts Options) (*Config, erro
 	}
 
 	// 6. Create subagent directory if not exists
-	if err := createSubagentDir(subagentDir); err != nil {
+	if err := createSubagentDir(cfg.SubagentDir); err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
 
+// TemplatesSection is the glm.toml table whose keys are prompt template names.
+const TemplatesSection = "templates"
+
+// ReadTemplates returns the [templates] table of configDir/glm.toml, or of
+// the file of Options.ConfigFile, without loading the rest of the
+// configuration (no API key is required). A missing default file yields an
+// empty map.
+func ReadTemplates(configDir string, opts ...*Options) (map[string]string, error) {
+	o := Options{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = *opts[0]
+	}
+	cfg := &Config{}
+	data, err := readTOML(configDir, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseTOML(data, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Templates == nil {
+		cfg.Templates = map[string]string{}
+	}
+	return cfg.Templates, nil
+}
+
+// ConfigDirName is the name of glm's directory under the user's
+// configuration directory.
+const ConfigDirName = "GoLeM"
+
+// ResolveConfigDir returns the directory holding glm.toml and the API key:
+// GLM_CONFIG_DIR if set, else $XDG_CONFIG_HOME/GoLeM, else ~/.config/GoLeM.
+// A non-empty profile (--profile) appends "-<profile>" to it, so GoLeM-work
+// keeps its own key and models. source is "(env)" when one of the variables
+// chose the directory and "(default)" otherwise, as in glm config show.
+//
+// It returns an error of the form:
+//
+//	err:user "Invalid --profile value: <profile> (...)"
+func ResolveConfigDir(profile string) (dir, source string, err error) {
+	if profile != "" && !validProfile(profile) {
+		return "", "", errs.User(`"Invalid --profile value: %s (use letters, digits, '-', '_' and '.')"`, profile)
+	}
+	dir, source = getenv("GLM_CONFIG_DIR"), "(env)"
+	if dir == "" {
+		if xdg := getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdg) {
+			dir = filepath.Join(xdg, ConfigDirName)
+		} else {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", "", fmt.Errorf("cannot determine home directory: %w", err)
+			}
+			dir, source = filepath.Join(home, ".config", ConfigDirName), "(default)"
+		}
+	}
+	if profile != "" {
+		dir = filepath.Clean(dir) + "-" + profile
+	}
+	return dir, source, nil
+}
+
+// validProfile reports whether name can name a profile: letters, digits,
+// '-', '_' and '.', and not only dots.
+func validProfile(name string) bool {
+	if strings.Trim(name, ".") == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveSubagentDir returns the subagent directory Load would use, with
+// subagentDir as the default, without loading the rest of the configuration
+// (no API key is required) and without creating it. For commands that work
+// on the job directories when the configuration may be incomplete.
+func ResolveSubagentDir(configDir, subagentDir string, opts Options) (string, error) {
+	cfg := &Config{SubagentDir: subagentDir}
+	data, err := readTOML(configDir, opts)
+	if err != nil {
+		return "", err
+	}
+	if err := parseTOML(data, cfg); err != nil {
+		return "", err
+	}
+	if v := getenv("GLM_SUBAGENT_DIR"); v != "" {
+		cfg.SubagentDir = v
+	}
+	applySubagentDirOption(cfg, opts)
+	return cfg.SubagentDir, nil
+}
+
+// applySubagentDirOption applies the --subagent-dir override of opts to
+// cfg.SubagentDir and makes it absolute.
+func applySubagentDirOption(cfg *Config, opts Options) {
+	if opts.SubagentDir != "" {
+		cfg.SubagentDir = opts.SubagentDir
+	}
+	if cfg.SubagentDir != "" {
+		cfg.SubagentDir = resolveSubagentDir(cfg.SubagentDir, opts.ProjectRoot)
+	}
+}
+
+// MaxParallelPerModelSection is the glm.toml table mapping execution models
+// to their own max_parallel.
+const MaxParallelPerModelSection = "max_parallel_per_model"
+
 // parseTOML manually parses simple key = value TOML format.
-// Ignores unknown keys and sections.
+// Ignores unknown keys and sections, except [templates] whose entries become
+// cfg.Templates and [max_parallel_per_model] whose entries become
+// cfg.MaxParallelPerModel. model sets the slots that have no key of their
+// own, wherever it appears.
 func parseTOML(data string, cfg *Config) error {
+	section := ""
+	model := ""
+	keyFileSet := false
 	lines := strings.Split(data, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		// Skip section headers like [section]
+		// Track section headers like [section]
 		if strings.HasPrefix(line, "[") {
+			section = strings.TrimSpace(strings.Trim(line, "[]"))
+			continue
+		}
+		if section == TemplatesSection {
+			if err := parseTemplateLine(line, cfg); err != nil {
+				return err
+			}
+			continue
+		}
+		if section == MaxParallelPerModelSection {
+			if err := parseModelLimitLine(line, cfg); err != nil {
+				return err
+			}
 			continue
 		}
 		// Parse key = value
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
 			// Invalid TOML syntax
-			return fmt.Errorf("err:config \"Failed to parse glm.toml: invalid line '%s'\"", line)
+			return errs.Config("\"Failed to parse glm.toml: invalid line '%s'\"", line)
 		}
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
@@ -135,57 +485,386 @@ func parseTOML(data string, cfg *Config) error {
 		switch key {
 		case "model":
 			cfg.Model = value
+			model = value
 		case "opus_model":
 			cfg.OpusModel = value
+			cfg.ModelSources.Opus = "glm.toml opus_model"
 		case "sonnet_model":
 			cfg.SonnetModel = value
+			cfg.ModelSources.Sonnet = "glm.toml sonnet_model"
 		case "haiku_model":
 			cfg.HaikuModel = value
+			cfg.ModelSources.Haiku = "glm.toml haiku_model"
 		case "permission_mode":
 			cfg.PermissionMode = value
 		case "max_parallel":
 			if n, err := strconv.Atoi(value); err == nil {
 				cfg.MaxParallel = n
 			} else {
-				return fmt.Errorf("err:config \"Failed to parse glm.toml: invalid max_parallel value '%s'\"", value)
+				return errs.Config("\"Failed to parse glm.toml: invalid max_parallel value '%s'\"", value)
+			}
+		case "keep_jobs":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid keep_jobs value '%s'\"", value)
+			}
+			cfg.KeepJobs = b
+		case "retention_days":
+			if n, err := strconv.Atoi(value); err == nil {
+				cfg.RetentionDays = n
+			} else {
+				return errs.Config("\"Failed to parse glm.toml: invalid retention_days value '%s'\"", value)
+			}
+		case "max_disk_mb":
+			if n, err := strconv.Atoi(value); err == nil {
+				cfg.MaxDiskMB = n
+			} else {
+				return errs.Config("\"Failed to parse glm.toml: invalid max_disk_mb value '%s'\"", value)
+			}
+		case "max_output_bytes":
+			if n, err := strconv.Atoi(value); err == nil {
+				cfg.MaxOutputBytes = n
+			} else {
+				return errs.Config("\"Failed to parse glm.toml: invalid max_output_bytes value '%s'\"", value)
+			}
+		case "chain_context_limit":
+			if n, err := strconv.Atoi(value); err == nil {
+				cfg.ChainContextLimit = n
+			} else {
+				return errs.Config("\"Failed to parse glm.toml: invalid chain_context_limit value '%s'\"", value)
+			}
+		case "chain_clean_intermediate":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid chain_clean_intermediate value '%s'\"", value)
+			}
+			cfg.ChainCleanIntermediate = b
+		case "metrics_enabled":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid metrics_enabled value '%s'\"", value)
+			}
+			cfg.MetricsEnabled = b
+		case "redact_prompts":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid redact_prompts value '%s'\"", value)
+			}
+			cfg.RedactPrompts = b
+		case "strip_ansi":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid strip_ansi value '%s'\"", value)
+			}
+			cfg.StripANSI = b
+		case "max_depth":
+			if n, err := strconv.Atoi(value); err == nil {
+				cfg.MaxDepth = n
+			} else {
+				return errs.Config("\"Failed to parse glm.toml: invalid max_depth value '%s'\"", value)
+			}
+		case "claude_path":
+			cfg.ClaudePath = value
+		case "subagent_dir":
+			cfg.SubagentDir = value
+		case "capture_diff":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid capture_diff value '%s'\"", value)
+			}
+			cfg.CaptureDiff = b
+		case "diff_max_bytes":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				cfg.DiffMaxBytes = n
+			} else {
+				return errs.Config("\"Failed to parse glm.toml: invalid diff_max_bytes value '%s'\"", value)
+			}
+		case "max_prompt_bytes":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				cfg.MaxPromptBytes = n
+			} else {
+				return errs.Config("\"Failed to parse glm.toml: invalid max_prompt_bytes value '%s'\"", value)
+			}
+		case "allow_unsafe_paths":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid allow_unsafe_paths value '%s'\"", value)
+			}
+			cfg.AllowUnsafePaths = b
+		case "allow_overlap":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid allow_overlap value '%s'\"", value)
+			}
+			cfg.AllowOverlap = b
+		case "confine_to_workdir":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid confine_to_workdir value '%s'\"", value)
 			}
+			cfg.ConfineToWorkdir = b
+		case "confine_mode":
+			cfg.ConfineMode = value
+		case "strict_result":
+			b, ok := parseBool(value)
+			if !ok {
+				return errs.Config("\"Failed to parse glm.toml: invalid strict_result value '%s'\"", value)
+			}
+			cfg.StrictResult = b
+		case "result_failure_markers":
+			markers, err := parseStringArray(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return errs.Config("\"Failed to parse glm.toml: invalid result_failure_markers value '%s' (want an array of strings)\"", strings.TrimSpace(parts[1]))
+			}
+			cfg.ResultFailureMarkers = markers
+		case "api_key_cmd":
+			cfg.APIKeyCmd = value
+		case "api_key_file":
+			cfg.APIKeyFile = value
+			keyFileSet = true
+		case "api_key":
+			// Another name for api_key_file: a path, not the key itself.
+			// api_key_file wins when both are set.
+			if !keyFileSet {
+				cfg.APIKeyFile = value
+			}
+		case "serve_token":
+			cfg.ServeToken = value
+		case "on_complete_cmd":
+			cfg.OnCompleteCmd = value
+		case "base_url":
+			cfg.ZaiBaseURL = value
+		case "default_timeout":
+			n, err := ParseTimeout(value)
+			if err != nil {
+				return errs.Config("\"Failed to parse glm.toml: invalid default_timeout value '%s' (use seconds like 600 or a duration like 10m)\"", value)
+			}
+			cfg.DefaultTimeout = n
+		case "priority_aging":
+			n, err := ParseTimeout(value)
+			if err != nil {
+				return errs.Config("\"Failed to parse glm.toml: invalid priority_aging value '%s' (use seconds like 600 or a duration like 10m)\"", value)
+			}
+			cfg.PriorityAging = n
+		case "kill_grace_seconds":
+			n, err := ParseTimeout(value)
+			if err != nil {
+				return errs.Config("\"Failed to parse glm.toml: invalid kill_grace_seconds value '%s' (use seconds like 5 or a duration like 30s)\"", value)
+			}
+			cfg.KillGraceSeconds = n
 		}
 		// Unknown keys are ignored
 	}
+	if model != "" {
+		for _, s := range []struct {
+			model, source *string
+		}{
+			{&cfg.OpusModel, &cfg.ModelSources.Opus},
+			{&cfg.SonnetModel, &cfg.ModelSources.Sonnet},
+			{&cfg.HaikuModel, &cfg.ModelSources.Haiku},
+		} {
+			if *s.source == "default" {
+				*s.model, *s.source = model, "glm.toml model"
+			}
+		}
+	}
+	return nil
+}
+
+// parseTemplateLine parses one name = "text" entry of the [templates] table.
+// Double-quoted values support the usual escapes, so "\n" starts a new line.
+func parseTemplateLine(line string, cfg *Config) error {
+	name, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return errs.Config("\"Failed to parse glm.toml: invalid line '%s'\"", line)
+	}
+	name = strings.Trim(strings.TrimSpace(name), `"'`)
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return errs.Config("\"Failed to parse glm.toml: invalid template %s\"", name)
+		}
+		value = unquoted
+	default:
+		value = strings.Trim(value, "'")
+	}
+	if cfg.Templates == nil {
+		cfg.Templates = map[string]string{}
+	}
+	cfg.Templates[name] = value
 	return nil
 }
 
-// readAPIKey reads the API key from configDir/zai_api_key or falls back to ~/.config/zai/env
-func readAPIKey(configDir string) (string, error) {
+// parseStringArray parses a one-line TOML array of strings such as
+// ["a", 'b']. Double-quoted strings support the usual escapes.
+func parseStringArray(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("not an array: %s", value)
+	}
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	items := []string{}
+	for rest != "" {
+		var item string
+		switch rest[0] {
+		case '"':
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, err
+			}
+			item, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		case '\'':
+			end := strings.IndexByte(rest[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string: %s", rest)
+			}
+			item, rest = rest[1:end+1], rest[end+2:]
+		default:
+			return nil, fmt.Errorf("not a string: %s", rest)
+		}
+		items = append(items, item)
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("missing comma before %s", rest)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+	return items, nil
+}
+
+// parseModelLimitLine parses one model = N entry of the
+// [max_parallel_per_model] table. Model names containing dots must be quoted
+// ("glm-4.7" = 2), as in TOML; unquoted ones are accepted too.
+func parseModelLimitLine(line string, cfg *Config) error {
+	model, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return errs.Config("\"Failed to parse glm.toml: invalid line '%s'\"", line)
+	}
+	model = strings.Trim(strings.TrimSpace(model), `"'`)
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return errs.Config("\"Failed to parse glm.toml: invalid max_parallel_per_model value for %s '%s'\"", model, strings.TrimSpace(value))
+	}
+	if cfg.MaxParallelPerModel == nil {
+		cfg.MaxParallelPerModel = map[string]int{}
+	}
+	cfg.MaxParallelPerModel[model] = n
+	return nil
+}
+
+// APIKeyEnvVars are the environment variables checked for the API key, in
+// order. They take precedence over api_key_cmd and the key file.
+var APIKeyEnvVars = []string{"GLM_ZAI_API_KEY", "ZAI_API_KEY"}
+
+// resolveAPIKey returns the API key and where it came from: the first
+// non-empty variable of APIKeyEnvVars, else the output of apiKeyCmd when set,
+// else keyFile when set, else the default key file (see readAPIKey). The key
+// itself never appears in errors.
+func resolveAPIKey(configDir, apiKeyCmd, keyFile string) (key, source string, err error) {
+	for _, name := range APIKeyEnvVars {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			return v, name, nil
+		}
+	}
+	if apiKeyCmd != "" {
+		key, err := runAPIKeyCmd(apiKeyCmd)
+		return key, "api_key_cmd", err
+	}
+	if keyFile != "" {
+		return readAPIKeyFile(keyFile)
+	}
+	return readAPIKey(configDir)
+}
+
+// readAPIKeyFile reads the API key from the configured api_key_file. Unlike
+// the default location there is no legacy fallback.
+func readAPIKeyFile(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", "", errs.Config("\"API key file not found: %s (set by api_key_file)\"", path)
+	} else if err != nil {
+		if strings.Contains(err.Error(), ": permission denied") {
+			return "", "", errs.Config("\"Cannot read API key file: permission denied\"")
+		}
+		return "", "", errs.Config("\"Cannot read API key file: %s\"", err.Error())
+	}
+	return parseAPIKey(string(data)), path, nil
+}
+
+// resolveKeyFilePath expands a leading ~ in an api_key_file path and makes a
+// relative path relative to configDir.
+func resolveKeyFilePath(configDir, path string) string {
+	path = expandTilde(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	return path
+}
+
+// APIKeyPath returns the key file the API key is read from when no
+// environment variable or api_key_cmd supplies it: api_key_file, or
+// ConfigDir/zai_api_key.
+func (c *Config) APIKeyPath() string {
+	if c.APIKeyFile != "" {
+		return c.APIKeyFile
+	}
+	return filepath.Join(c.ConfigDir, "zai_api_key")
+}
+
+// runAPIKeyCmd runs command with sh -c and returns its trimmed stdout. A
+// failing command is an err:config carrying its stderr.
+func runAPIKeyCmd(command string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	c := exec.Command("sh", "-c", command)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		detail := strings.TrimSpace(stderr.String())
+		if detail == "" {
+			detail = err.Error()
+		}
+		return "", errs.Config("\"api_key_cmd failed: %s\"", detail)
+	}
+	return parseAPIKey(stdout.String()), nil
+}
+
+// readAPIKey reads the API key from configDir/zai_api_key or falls back to
+// ~/.config/zai/env, and returns the path it was read from.
+func readAPIKey(configDir string) (string, string, error) {
 	// Try primary location: configDir/zai_api_key
 	primaryPath := filepath.Join(configDir, "zai_api_key")
 	if data, err := os.ReadFile(primaryPath); err == nil {
-		return parseAPIKey(string(data)), nil
+		return parseAPIKey(string(data)), primaryPath, nil
 	} else if !os.IsNotExist(err) {
 		// Strip the "open <path>: " prefix from the error for cleaner messages
 		errMsg := err.Error()
 		if strings.Contains(errMsg, ": permission denied") {
-			return "", fmt.Errorf("err:config \"Cannot read API key file: permission denied\"")
+			return "", "", errs.Config("\"Cannot read API key file: permission denied\"")
 		}
-		return "", fmt.Errorf("err:config \"Cannot read API key file: %s\"", errMsg)
+		return "", "", errs.Config("\"Cannot read API key file: %s\"", errMsg)
 	}
 
 	// Fallback to legacy location: ~/.config/zai/env
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return "", fmt.Errorf("err:config API key file not found: %s not found and cannot determine home directory for fallback", primaryPath)
+		return "", "", errs.Config("API key file not found: %s not found and cannot determine home directory for fallback", primaryPath)
 	}
 	legacyPath := filepath.Join(home, ".config", "zai", "env")
 	if data, err := os.ReadFile(legacyPath); err == nil {
-		return parseAPIKey(string(data)), nil
+		return parseAPIKey(string(data)), legacyPath, nil
 	} else if os.IsNotExist(err) {
-		return "", fmt.Errorf("err:config API key file not found: %s not found, and legacy fallback %s also missing. Create an API key file at %s or %s", primaryPath, legacyPath, primaryPath, legacyPath)
+		return "", "", errs.Config("API key file not found: %s not found, and legacy fallback %s also missing. Create an API key file at %s or %s", primaryPath, legacyPath, primaryPath, legacyPath)
 	} else {
 		errMsg := err.Error()
 		if strings.Contains(errMsg, ": permission denied") {
-			return "", fmt.Errorf("err:config \"Cannot read API key file: permission denied\"")
+			return "", "", errs.Config("\"Cannot read API key file: permission denied\"")
 		}
-		return "", fmt.Errorf("err:config \"Cannot read API key file: %s\"", errMsg)
+		return "", "", errs.Config("\"Cannot read API key file: %s\"", errMsg)
 	}
 }
 
@@ -200,29 +879,37 @@ func parseAPIKey(data string) string {
 	return strings.TrimSpace(data)
 }
 
-// applyEnvOverrides applies environment variable overrides to the config
-func applyEnvOverrides(cfg *Config) {
+// applyEnvOverrides applies environment variable overrides to the config.
+// An unparsable GLM_TIMEOUT is an err:config like an invalid
+// default_timeout in glm.toml.
+func applyEnvOverrides(cfg *Config) error {
 	if v := getenv("GLM_MODEL"); v != "" {
 		cfg.Model = v
 		// GLM_MODEL applies to all slots unless per-slot override is set
 		if getenv("GLM_OPUS_MODEL") == "" {
 			cfg.OpusModel = v
+			cfg.ModelSources.Opus = "GLM_MODEL"
 		}
 		if getenv("GLM_SONNET_MODEL") == "" {
 			cfg.SonnetModel = v
+			cfg.ModelSources.Sonnet = "GLM_MODEL"
 		}
 		if getenv("GLM_HAIKU_MODEL") == "" {
 			cfg.HaikuModel = v
+			cfg.ModelSources.Haiku = "GLM_MODEL"
 		}
 	}
 	if v := getenv("GLM_OPUS_MODEL"); v != "" {
 		cfg.OpusModel = v
+		cfg.ModelSources.Opus = "GLM_OPUS_MODEL"
 	}
 	if v := getenv("GLM_SONNET_MODEL"); v != "" {
 		cfg.SonnetModel = v
+		cfg.ModelSources.Sonnet = "GLM_SONNET_MODEL"
 	}
 	if v := getenv("GLM_HAIKU_MODEL"); v != "" {
 		cfg.HaikuModel = v
+		cfg.ModelSources.Haiku = "GLM_HAIKU_MODEL"
 	}
 	if v := getenv("GLM_PERMISSION_MODE"); v != "" {
 		cfg.PermissionMode = v
@@ -235,18 +922,203 @@ func applyEnvOverrides(cfg *Config) {
 	if v := getenv("GLM_DEBUG"); v != "" {
 		cfg.Debug = v == "1" || strings.ToLower(v) == "true"
 	}
+	if v := getenv("GLM_KEEP_JOBS"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.KeepJobs = b
+		}
+	}
+	if v := getenv("GLM_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.RetentionDays = n
+		}
+	}
+	if v := getenv("GLM_MAX_DISK_MB"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxDiskMB = n
+		}
+	}
+	if v := getenv("GLM_MAX_OUTPUT_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxOutputBytes = n
+		}
+	}
+	if v := getenv("GLM_SUBAGENT_DIR"); v != "" {
+		cfg.SubagentDir = v
+	}
+	if v := getenv("GLM_CHAIN_CONTEXT_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ChainContextLimit = n
+		}
+	}
+	if v := getenv("GLM_CHAIN_CLEAN_INTERMEDIATE"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.ChainCleanIntermediate = b
+		}
+	}
+	if v := getenv("GLM_METRICS_ENABLED"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.MetricsEnabled = b
+		}
+	}
+	if v := getenv("GLM_REDACT_PROMPTS"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.RedactPrompts = b
+		}
+	}
+	if v := getenv("GLM_STRIP_ANSI"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.StripANSI = b
+		}
+	}
+	if v := getenv("GLM_MAX_DEPTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxDepth = n
+		}
+	}
+	if v := getenv("GLM_CAPTURE_DIFF"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.CaptureDiff = b
+		}
+	}
+	if v := getenv("GLM_STRICT_RESULT"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.StrictResult = b
+		}
+	}
+	if v := getenv("GLM_CONFINE_TO_WORKDIR"); v != "" {
+		if b, ok := parseBool(v); ok {
+			cfg.ConfineToWorkdir = b
+		}
+	}
+	if v := getenv("GLM_CONFINE_MODE"); v != "" {
+		cfg.ConfineMode = v
+	}
+	if v := getenv("GLM_CLAUDE_PATH"); v != "" {
+		cfg.ClaudePath = v
+	}
+	if v := getenv("GLM_BASE_URL"); v != "" {
+		cfg.ZaiBaseURL = v
+	}
+	if v := getenv("GLM_SERVE_TOKEN"); v != "" {
+		cfg.ServeToken = v
+	}
+	if v := getenv("GLM_ON_COMPLETE_CMD"); v != "" {
+		cfg.OnCompleteCmd = v
+	}
+	if v := getenv("GLM_TIMEOUT"); v != "" {
+		n, err := ParseTimeout(v)
+		if err != nil {
+			return errs.Config("\"Invalid GLM_TIMEOUT value '%s' (use seconds like 600 or a duration like 10m)\"", v)
+		}
+		cfg.DefaultTimeout = n
+	}
+	if v := getenv("GLM_PRIORITY_AGING"); v != "" {
+		if n, err := ParseTimeout(v); err == nil {
+			cfg.PriorityAging = n
+		}
+	}
+	if v := getenv("GLM_KILL_GRACE_SECONDS"); v != "" {
+		if n, err := ParseTimeout(v); err == nil {
+			cfg.KillGraceSeconds = n
+		}
+	}
+	return nil
+}
+
+// ParseTimeout parses a timeout given either as plain seconds ("600") or as a
+// Go duration ("10m", "1h30m", "90s") and returns it in whole seconds
+// (fractions are dropped). It does not check the sign; callers validate that
+// the result is positive.
+func ParseTimeout(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: want seconds or a duration like 10m", s)
+	}
+	return int(d / time.Second), nil
+}
+
+// parseBool accepts true/false/1/0 (case-insensitive).
+func parseBool(v string) (bool, bool) {
+	switch strings.ToLower(v) {
+	case "true", "1":
+		return true, true
+	case "false", "0":
+		return false, true
+	}
+	return false, false
 }
 
 // validate validates the config and returns an error if invalid
 func validate(cfg *Config) error {
 	// Check API key non-empty
 	if cfg.ZaiAPIKey == "" {
-		return fmt.Errorf("err:validation zai_api_key: API key is empty")
+		return errs.Validation("zai_api_key: API key is empty")
 	}
 
 	// Check max_parallel >= 0
 	if cfg.MaxParallel < 0 {
-		return fmt.Errorf("err:validation max_parallel: must be a non-negative integer (got %d)", cfg.MaxParallel)
+		return errs.Validation("max_parallel: must be a non-negative integer (got %d)", cfg.MaxParallel)
+	}
+
+	// Check every per-model limit >= 0
+	for model, n := range cfg.MaxParallelPerModel {
+		if n < 0 {
+			return errs.Validation("max_parallel_per_model.%s: must be a non-negative integer (got %d)", model, n)
+		}
+	}
+
+	// Check default_timeout > 0
+	if cfg.DefaultTimeout <= 0 {
+		return errs.Validation("default_timeout: must be a positive number of seconds or a duration like 10m (got %ds)", cfg.DefaultTimeout)
+	}
+
+	// Check retention_days >= 0
+	if cfg.RetentionDays < 0 {
+		return errs.Validation("retention_days: must be a non-negative integer (got %d)", cfg.RetentionDays)
+	}
+
+	// Check max_disk_mb >= 0
+	if cfg.MaxDiskMB < 0 {
+		return errs.Validation("max_disk_mb: must be a non-negative integer (got %d)", cfg.MaxDiskMB)
+	}
+
+	// Check max_output_bytes >= 0
+	if cfg.MaxOutputBytes < 0 {
+		return errs.Validation("max_output_bytes: must be a non-negative integer (got %d)", cfg.MaxOutputBytes)
+	}
+
+	// Check chain_context_limit >= 0
+	if cfg.ChainContextLimit < 0 {
+		return errs.Validation("chain_context_limit: must be a non-negative integer (got %d)", cfg.ChainContextLimit)
+	}
+
+	// Check max_depth >= 1
+	if cfg.MaxDepth < 1 {
+		return errs.Validation("max_depth: must be a positive integer (got %d)", cfg.MaxDepth)
+	}
+
+	// Check priority_aging >= 0
+	if cfg.PriorityAging < 0 {
+		return errs.Validation("priority_aging: must be non-negative seconds or a duration like 10m (got %ds)", cfg.PriorityAging)
+	}
+
+	// Check kill_grace_seconds >= 0
+	if cfg.KillGraceSeconds < 0 {
+		return errs.Validation("kill_grace_seconds: must be non-negative seconds or a duration like 30s (got %ds)", cfg.KillGraceSeconds)
+	}
+
+	// Check base_url is an http(s) URL
+	if err := ValidateBaseURL(cfg.ZaiBaseURL); err != nil {
+		return errs.Validation("base_url: %s", err.Error())
+	}
+
+	// Check claude_path is absolute so it never resolves against the cwd
+	if cfg.ClaudePath != "" && !filepath.IsAbs(cfg.ClaudePath) {
+		return errs.Validation("claude_path: must be an absolute path (got %q)", cfg.ClaudePath)
 	}
 
 	// Check permission_mode in valid set
@@ -257,31 +1129,102 @@ func validate(cfg *Config) error {
 		"plan":              true,
 	}
 	if !validModes[cfg.PermissionMode] {
-		return fmt.Errorf("err:validation permission_mode: must be one of: bypassPermissions, acceptEdits, default, plan (got %q)", cfg.PermissionMode)
+		return errs.Validation("permission_mode: must be one of: bypassPermissions, acceptEdits, default, plan (got %q)", cfg.PermissionMode)
+	}
+
+	// Check confine_mode in valid set
+	if cfg.ConfineMode != ConfineWarn && cfg.ConfineMode != ConfineStrict {
+		return errs.Validation("confine_mode: must be warn or strict (got %q)", cfg.ConfineMode)
 	}
 
 	return nil
 }
 
-// createSubagentDir creates the subagent directory if it doesn't exist
+// ValidateBaseURL checks that raw is an absolute http or https URL with a
+// host and no surrounding whitespace. The error carries no category so
+// callers can report it as config or user error.
+func ValidateBaseURL(raw string) error {
+	if raw != strings.TrimSpace(raw) {
+		return fmt.Errorf("must not contain leading or trailing whitespace (got %q)", raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http:// or https:// URL (got %q)", raw)
+	}
+	return nil
+}
+
+// ProjectRoot returns the root of the project dir is in: the nearest
+// directory at or above dir holding .git, or dir itself (made absolute)
+// outside a git repository.
+func ProjectRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for d := abs; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return abs
+		}
+		d = parent
+	}
+}
+
+// resolveSubagentDir expands a leading ~ in dir and resolves a relative dir
+// against projectRoot, or the ProjectRoot of the working directory when
+// projectRoot is empty.
+func resolveSubagentDir(dir, projectRoot string) string {
+	dir = expandTilde(dir)
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	if projectRoot == "" {
+		projectRoot = ProjectRoot(".")
+	}
+	return filepath.Join(projectRoot, dir)
+}
+
+// createSubagentDir creates the subagent directory if it doesn't exist and
+// checks that jobs can be created in it. An empty subagentDir (callers that
+// never create jobs) is a no-op.
 func createSubagentDir(subagentDir string) error {
-	if _, err := os.Stat(subagentDir); err == nil {
-		// Directory already exists
+	if subagentDir == "" {
 		return nil
+	}
+	if info, err := os.Stat(subagentDir); err == nil {
+		// Directory already exists
+		if !info.IsDir() {
+			return errs.Config("\"Subagent directory is not a directory: %s\"", subagentDir)
+		}
+		return checkWritable(subagentDir)
 	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("err:config \"Cannot create subagent directory: %s\"", err.Error())
+		return errs.Config("\"Cannot create subagent directory: %s\"", err.Error())
 	}
 
 	if err := os.MkdirAll(subagentDir, 0755); err != nil {
 		// Strip the "mkdir <path>: " prefix from the error
 		errMsg := err.Error()
 		if strings.Contains(errMsg, ": permission denied") {
-			return fmt.Errorf("err:config \"Cannot create subagent directory: permission denied\"")
+			return errs.Config("\"Cannot create subagent directory: permission denied\"")
 		}
-		return fmt.Errorf("err:config \"Cannot create subagent directory: %s\"", errMsg)
+		return errs.Config("\"Cannot create subagent directory: %s\"", errMsg)
 	}
 	return nil
 }
 
+// checkWritable returns an err:config when no file can be created in dir.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".glm-write-check-*")
+	if err != nil {
+		return errs.Config("\"Subagent directory is not writable: %s\"", dir)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // getenv wraps os.Getenv for testability.
 var getenv = os.Getenv
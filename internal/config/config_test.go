@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
@@ -387,6 +388,80 @@ func TestErrorAPIKeyNotReadable(t *testing.T) {
 	}
 }
 
+// ---- Scenario: API key environment variables take precedence over the file ----
+
+func TestAPIKeyFromEnvironment(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	writeTOML(t, configDir, `api_key_cmd = "echo sk-from-cmd"`)
+
+	setenv(t, "ZAI_API_KEY", " sk-from-zai-env\n")
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ZaiAPIKey != "sk-from-zai-env" || cfg.APIKeySource != "ZAI_API_KEY" {
+		t.Errorf("key/source: got %q/%q, want sk-from-zai-env/ZAI_API_KEY", cfg.ZaiAPIKey, cfg.APIKeySource)
+	}
+
+	// GLM_ZAI_API_KEY wins over ZAI_API_KEY.
+	setenv(t, "GLM_ZAI_API_KEY", "sk-from-glm-env")
+	cfg, err = Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ZaiAPIKey != "sk-from-glm-env" || cfg.APIKeySource != "GLM_ZAI_API_KEY" {
+		t.Errorf("key/source: got %q/%q, want sk-from-glm-env/GLM_ZAI_API_KEY", cfg.ZaiAPIKey, cfg.APIKeySource)
+	}
+}
+
+// ---- Scenario: api_key_cmd output is used instead of the key file ----
+
+func TestAPIKeyFromCommand(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	script := filepath.Join(t.TempDir(), "fake-pass")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho '  sk-from-secrets-manager'\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	writeTOML(t, configDir, "api_key_cmd = \""+script+" show zai\"\n")
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ZaiAPIKey != "sk-from-secrets-manager" {
+		t.Errorf("ZaiAPIKey: got %q, want %q", cfg.ZaiAPIKey, "sk-from-secrets-manager")
+	}
+	if cfg.APIKeySource != "api_key_cmd" {
+		t.Errorf("APIKeySource: got %q, want api_key_cmd", cfg.APIKeySource)
+	}
+}
+
+// ---- Scenario: A failing api_key_cmd surfaces its stderr as err:config ----
+
+func TestAPIKeyCommandFails(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	writeTOML(t, configDir, `api_key_cmd = "echo 'gpg: decryption failed' >&2; exit 2"`)
+
+	_, err := Load(configDir, subagentDir)
+	if err == nil {
+		t.Fatal("Load should fail when api_key_cmd fails")
+	}
+	want := `err:config "api_key_cmd failed: gpg: decryption failed"`
+	if err.Error() != want {
+		t.Errorf("error: got %q, want %q", err.Error(), want)
+	}
+
+	// A command that prints nothing fails validation of the resolved key.
+	writeTOML(t, configDir, `api_key_cmd = "true"`)
+	_, err = Load(configDir, subagentDir)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:validation zai_api_key") {
+		t.Errorf("empty command output: got %v, want err:validation zai_api_key", err)
+	}
+}
+
 // ---- Scenario: Environment variables override TOML values ----
 
 func TestEnvVarsOverrideTOML(t *testing.T) {
@@ -444,6 +519,88 @@ func TestPerSlotTOMLOverride(t *testing.T) {
 	}
 }
 
+// ---- Scenario: every model layer records the slots it set in ModelSources ----
+
+func TestModelSources(t *testing.T) {
+	type slots [3]string // opus, sonnet, haiku
+	tests := []struct {
+		name        string
+		toml        string
+		env         map[string]string
+		optModel    string
+		wantModels  slots
+		wantSources slots
+	}{
+		{
+			name:        "defaults",
+			wantModels:  slots{DefaultModel, DefaultModel, DefaultModel},
+			wantSources: slots{"default", "default", "default"},
+		},
+		{
+			name:        "toml model sets every slot",
+			toml:        `model = "m"`,
+			wantModels:  slots{"m", "m", "m"},
+			wantSources: slots{"glm.toml model", "glm.toml model", "glm.toml model"},
+		},
+		{
+			name:        "toml slot key wins over toml model in either order",
+			toml:        "opus_model = \"o\"\nmodel = \"m\"\nhaiku_model = \"h\"",
+			wantModels:  slots{"o", "m", "h"},
+			wantSources: slots{"glm.toml opus_model", "glm.toml model", "glm.toml haiku_model"},
+		},
+		{
+			name:        "GLM_MODEL wins over toml",
+			toml:        "model = \"m\"\nopus_model = \"o\"",
+			env:         map[string]string{"GLM_MODEL": "e"},
+			wantModels:  slots{"e", "e", "e"},
+			wantSources: slots{"GLM_MODEL", "GLM_MODEL", "GLM_MODEL"},
+		},
+		{
+			name:        "GLM_<SLOT>_MODEL wins over GLM_MODEL",
+			env:         map[string]string{"GLM_MODEL": "e", "GLM_SONNET_MODEL": "es"},
+			wantModels:  slots{"e", "es", "e"},
+			wantSources: slots{"GLM_MODEL", "GLM_SONNET_MODEL", "GLM_MODEL"},
+		},
+		{
+			name:        "GLM_<SLOT>_MODEL wins over toml slot key",
+			toml:        `haiku_model = "h"`,
+			env:         map[string]string{"GLM_HAIKU_MODEL": "eh"},
+			wantModels:  slots{DefaultModel, DefaultModel, "eh"},
+			wantSources: slots{"default", "default", "GLM_HAIKU_MODEL"},
+		},
+		{
+			name:        "Options.Model wins over everything",
+			toml:        `opus_model = "o"`,
+			env:         map[string]string{"GLM_MODEL": "e", "GLM_HAIKU_MODEL": "eh"},
+			optModel:    "cli",
+			wantModels:  slots{"cli", "cli", "cli"},
+			wantSources: slots{"-m", "-m", "-m"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir, subagentDir := setupDirs(t)
+			writeAPIKey(t, configDir, seedHappyPathAPIKey)
+			if tt.toml != "" {
+				writeTOML(t, configDir, tt.toml+"\n")
+			}
+			for _, key := range []string{"GLM_MODEL", "GLM_OPUS_MODEL", "GLM_SONNET_MODEL", "GLM_HAIKU_MODEL"} {
+				setenv(t, key, tt.env[key])
+			}
+
+			cfg, err := LoadWithOptions(configDir, subagentDir, Options{Model: tt.optModel})
+			if err != nil {
+				t.Fatalf("LoadWithOptions returned error: %v", err)
+			}
+			gotModels := slots{cfg.OpusModel, cfg.SonnetModel, cfg.HaikuModel}
+			gotSources := slots{cfg.ModelSources.Opus, cfg.ModelSources.Sonnet, cfg.ModelSources.Haiku}
+			if gotModels != tt.wantModels || gotSources != tt.wantSources {
+				t.Errorf("models %v from %v, want %v from %v", gotModels, gotSources, tt.wantModels, tt.wantSources)
+			}
+		})
+	}
+}
+
 // ---- Scenario: CLI flags take highest priority over env vars and TOML ----
 
 func TestCLIFlagsHighestPriority(t *testing.T) {
@@ -830,3 +987,871 @@ func TestPerSlotEnvVarPrecedenceOverGLMModel(t *testing.T) {
 // ---- compile-time check: verify fmt and strconv imports are used ----
 var _ = fmt.Sprintf
 var _ = strconv.Itoa
+
+// ---- Scenario: keep_jobs and retention_days are read from TOML ----
+
+func TestRetentionPolicyFromTOML(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, "keep_jobs = true\nretention_days = 7\n")
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !cfg.KeepJobs {
+		t.Error("KeepJobs: got false, want true")
+	}
+	if cfg.RetentionDays != 7 {
+		t.Errorf("RetentionDays: got %d, want 7", cfg.RetentionDays)
+	}
+}
+
+// ---- Scenario: GLM_KEEP_JOBS and GLM_RETENTION_DAYS override TOML ----
+
+func TestEnvRetentionPolicyOverride(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, "keep_jobs = true\nretention_days = 7\n")
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	setenv(t, "GLM_KEEP_JOBS", "false")
+	setenv(t, "GLM_RETENTION_DAYS", "30")
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.KeepJobs {
+		t.Error("KeepJobs: got true, want false")
+	}
+	if cfg.RetentionDays != 30 {
+		t.Errorf("RetentionDays: got %d, want 30", cfg.RetentionDays)
+	}
+}
+
+// ---- Scenario: Invalid retention values are rejected ----
+
+func TestInvalidRetentionValues(t *testing.T) {
+	cases := map[string]string{
+		"keep_jobs = maybe\n":   "err:config",
+		"retention_days = -1\n": "err:validation",
+	}
+	for toml, wantPrefix := range cases {
+		configDir, subagentDir := setupDirs(t)
+		writeTOML(t, configDir, toml)
+		writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+		_, err := Load(configDir, subagentDir)
+		if err == nil {
+			t.Errorf("%q: Load should return an error", toml)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), wantPrefix) {
+			t.Errorf("%q: error prefix: got %q, want %s", toml, err.Error(), wantPrefix)
+		}
+	}
+}
+
+// ---- Scenario: max_disk_mb is read from TOML, GLM_MAX_DISK_MB overrides, negatives are rejected ----
+
+func TestMaxDiskMB(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, "max_disk_mb = 5000\n")
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.MaxDiskMB != 5000 {
+		t.Errorf("MaxDiskMB: got %d, want 5000", cfg.MaxDiskMB)
+	}
+
+	setenv(t, "GLM_MAX_DISK_MB", "100")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load with GLM_MAX_DISK_MB returned error: %v", err)
+	}
+	if cfg.MaxDiskMB != 100 {
+		t.Errorf("MaxDiskMB with GLM_MAX_DISK_MB=100: got %d, want 100", cfg.MaxDiskMB)
+	}
+
+	setenv(t, "GLM_MAX_DISK_MB", "-1")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:validation") {
+		t.Errorf("max_disk_mb = -1: got %v, want err:validation", err)
+	}
+}
+
+// ---- Scenario: claude_path pins the claude binary, GLM_CLAUDE_PATH overrides ----
+
+func TestClaudePathFromTOMLAndEnv(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, "claude_path = \"/opt/claude/bin/claude\"\n")
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ClaudePath != "/opt/claude/bin/claude" {
+		t.Errorf("ClaudePath: got %q, want %q", cfg.ClaudePath, "/opt/claude/bin/claude")
+	}
+
+	setenv(t, "GLM_CLAUDE_PATH", "/usr/local/bin/claude")
+	cfg, err = Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ClaudePath != "/usr/local/bin/claude" {
+		t.Errorf("ClaudePath: got %q, want env value", cfg.ClaudePath)
+	}
+}
+
+// ---- Scenario: A relative claude_path is rejected ----
+
+func TestRelativeClaudePathRejected(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, "claude_path = \"bin/claude\"\n")
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	_, err := Load(configDir, subagentDir)
+	if err == nil || !strings.HasPrefix(err.Error(), "err:validation claude_path") {
+		t.Errorf("Load error = %v, want err:validation claude_path", err)
+	}
+}
+
+// ---- Scenario: [templates] table entries become prompt templates ----
+
+func TestTemplatesTableFromTOML(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, `model = "glm-4.7"
+
+[templates]
+review = "Review {{file}} for race conditions.\nBe brief."
+tests = 'Write table-driven tests for {{func}}'
+`)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Model != "glm-4.7" {
+		t.Errorf("Model: got %q, want glm-4.7", cfg.Model)
+	}
+	if got := cfg.Templates["review"]; got != "Review {{file}} for race conditions.\nBe brief." {
+		t.Errorf("review template: got %q", got)
+	}
+	if got := cfg.Templates["tests"]; got != "Write table-driven tests for {{func}}" {
+		t.Errorf("tests template: got %q", got)
+	}
+	// Template names are not config keys.
+	if cfg.PermissionMode != DefaultPermissionMode {
+		t.Errorf("PermissionMode changed by [templates]: %q", cfg.PermissionMode)
+	}
+
+	// ReadTemplates works without an API key.
+	noKeyDir, _ := setupDirs(t)
+	writeTOML(t, noKeyDir, "[templates]\nexplain = \"Explain {{topic}}\"\n")
+	templates, err := ReadTemplates(noKeyDir)
+	if err != nil {
+		t.Fatalf("ReadTemplates: %v", err)
+	}
+	if templates["explain"] != "Explain {{topic}}" {
+		t.Errorf("ReadTemplates: got %+v", templates)
+	}
+}
+
+// ---- Scenario: default_timeout accepts seconds or durations, GLM_TIMEOUT overrides ----
+
+func TestDefaultTimeoutForms(t *testing.T) {
+	tests := []struct {
+		toml    string
+		env     string
+		want    int
+		wantErr string
+	}{
+		{toml: "", want: DefaultTimeout},
+		{toml: "default_timeout = 600\n", want: 600},
+		{toml: "default_timeout = \"10m\"\n", want: 600},
+		{toml: "default_timeout = \"1h30m\"\n", want: 5400},
+		{toml: "default_timeout = \"10m\"\n", env: "90s", want: 90},
+		{env: "2h", want: 7200},
+		{toml: "default_timeout = \"soon\"\n", wantErr: "err:config"},
+		{toml: "default_timeout = 0\n", wantErr: "err:validation default_timeout"},
+		{toml: "default_timeout = \"-5m\"\n", wantErr: "err:validation default_timeout"},
+		{env: "0s", wantErr: "err:validation default_timeout"},
+		{toml: "default_timeout = 600\n", env: "soon", wantErr: "err:config \"Invalid GLM_TIMEOUT value 'soon'"},
+	}
+	for _, tt := range tests {
+		configDir, subagentDir := setupDirs(t)
+		writeTOML(t, configDir, tt.toml)
+		writeAPIKey(t, configDir, seedHappyPathAPIKey)
+		if tt.env != "" {
+			setenv(t, "GLM_TIMEOUT", tt.env)
+		} else {
+			setenv(t, "GLM_TIMEOUT", "")
+		}
+
+		cfg, err := Load(configDir, subagentDir)
+		if tt.wantErr != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("toml=%q env=%q: error = %v, want prefix %s", tt.toml, tt.env, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("toml=%q env=%q: Load returned error: %v", tt.toml, tt.env, err)
+			continue
+		}
+		if cfg.DefaultTimeout != tt.want {
+			t.Errorf("toml=%q env=%q: DefaultTimeout = %d, want %d", tt.toml, tt.env, cfg.DefaultTimeout, tt.want)
+		}
+	}
+}
+
+// ---- Scenario: [max_parallel_per_model] sets per-model limits ----
+
+func TestMaxParallelPerModelTable(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, `max_parallel = 3
+
+[max_parallel_per_model]
+"glm-5" = 1
+"glm-4.7" = 5
+`)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.MaxParallel != 3 {
+		t.Errorf("MaxParallel: got %d, want 3", cfg.MaxParallel)
+	}
+	want := map[string]int{"glm-5": 1, "glm-4.7": 5}
+	if !reflect.DeepEqual(cfg.MaxParallelPerModel, want) {
+		t.Errorf("MaxParallelPerModel: got %v, want %v", cfg.MaxParallelPerModel, want)
+	}
+
+	for toml, wantErr := range map[string]string{
+		"[max_parallel_per_model]\n\"glm-5\" = many\n": "err:config",
+		"[max_parallel_per_model]\n\"glm-5\" = -1\n":   "err:validation max_parallel_per_model.glm-5",
+	} {
+		writeTOML(t, configDir, toml)
+		if _, err := Load(configDir, subagentDir); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Load(%q): got %v, want %s", toml, err, wantErr)
+		}
+	}
+}
+
+// ---- Scenario: strict_result and result_failure_markers come from glm.toml ----
+
+func TestStrictResultConfig(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.StrictResult || !reflect.DeepEqual(cfg.ResultFailureMarkers, DefaultResultFailureMarkers) {
+		t.Errorf("defaults: StrictResult %v, markers %q", cfg.StrictResult, cfg.ResultFailureMarkers)
+	}
+
+	writeTOML(t, configDir, `strict_result = true
+result_failure_markers = ["BLOCKED:", 'gave up', "say \"no\""]
+`)
+	cfg, err = Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	want := []string{"BLOCKED:", "gave up", `say "no"`}
+	if !cfg.StrictResult || !reflect.DeepEqual(cfg.ResultFailureMarkers, want) {
+		t.Errorf("toml: StrictResult %v, markers %q; want true, %q", cfg.StrictResult, cfg.ResultFailureMarkers, want)
+	}
+
+	setenv(t, "GLM_STRICT_RESULT", "false")
+	if cfg, err = Load(configDir, subagentDir); err != nil || cfg.StrictResult {
+		t.Errorf("GLM_STRICT_RESULT=false: StrictResult %v, err %v", cfg.StrictResult, err)
+	}
+
+	for _, bad := range []string{`"I was unable"`, `["a" "b"]`, `["a", 3]`, `["unterminated]`} {
+		writeTOML(t, configDir, "result_failure_markers = "+bad+"\n")
+		if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:config") {
+			t.Errorf("result_failure_markers = %s: got %v, want err:config", bad, err)
+		}
+	}
+}
+
+// ---- Scenario: base_url defaults to Z.AI, glm.toml sets it, GLM_BASE_URL overrides ----
+
+func TestBaseURLPrecedence(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ZaiBaseURL != ZaiBaseURL {
+		t.Errorf("default base URL: got %q, want %q", cfg.ZaiBaseURL, ZaiBaseURL)
+	}
+
+	writeTOML(t, configDir, "base_url = \"https://gateway.corp.example/anthropic\"\n")
+	cfg, err = Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ZaiBaseURL != "https://gateway.corp.example/anthropic" {
+		t.Errorf("toml base URL: got %q", cfg.ZaiBaseURL)
+	}
+
+	setenv(t, "GLM_BASE_URL", "https://api.anthropic.com")
+	cfg, err = Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ZaiBaseURL != "https://api.anthropic.com" {
+		t.Errorf("env base URL: got %q", cfg.ZaiBaseURL)
+	}
+}
+
+// ---- Scenario: base_url must be an http(s) URL without surrounding whitespace ----
+
+func TestInvalidBaseURLRejected(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	for _, raw := range []string{"ftp://example.com", "api.z.ai/api/anthropic", "https://example.com ", "https://"} {
+		writeTOML(t, configDir, "base_url = \""+raw+"\"\n")
+		_, err := Load(configDir, subagentDir)
+		if err == nil || !strings.HasPrefix(err.Error(), "err:validation base_url") {
+			t.Errorf("base_url %q: got %v, want err:validation base_url", raw, err)
+		}
+	}
+	if err := ValidateBaseURL("http://localhost:8080/v1"); err != nil {
+		t.Errorf("ValidateBaseURL(http://localhost:8080/v1) = %v", err)
+	}
+}
+
+// ---- Scenario: api_key_file (or api_key) replaces zai_api_key, GLM_API_KEY_FILE overrides ----
+
+func TestAPIKeyFileConfig(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, "default-key")
+	if err := os.WriteFile(filepath.Join(configDir, "gateway_key"), []byte("gateway-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A relative path is relative to the config directory.
+	writeTOML(t, configDir, "api_key_file = \"gateway_key\"\n")
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	want := filepath.Join(configDir, "gateway_key")
+	if cfg.ZaiAPIKey != "gateway-key" || cfg.APIKeySource != want || cfg.APIKeyPath() != want {
+		t.Errorf("key %q from %q (APIKeyPath %q), want gateway-key from %s", cfg.ZaiAPIKey, cfg.APIKeySource, cfg.APIKeyPath(), want)
+	}
+
+	// api_key is another name for api_key_file; api_key_file wins.
+	for toml, wantKey := range map[string]string{
+		"api_key = \"gateway_key\"\n":                                "gateway-key",
+		"api_key_file = \"zai_api_key\"\napi_key = \"gateway_key\"\n": "default-key",
+	} {
+		writeTOML(t, configDir, toml)
+		cfg, err := Load(configDir, subagentDir)
+		if err != nil {
+			t.Fatalf("%q: Load returned error: %v", toml, err)
+		}
+		if cfg.ZaiAPIKey != wantKey {
+			t.Errorf("%q: key %q from %q, want %q", toml, cfg.ZaiAPIKey, cfg.APIKeySource, wantKey)
+		}
+	}
+
+	// A configured file that is missing is an error, not a silent fallback.
+	setenv(t, "GLM_API_KEY_FILE", filepath.Join(configDir, "missing_key"))
+	_, err = Load(configDir, subagentDir)
+	if err == nil || !strings.Contains(err.Error(), "API key file not found: "+filepath.Join(configDir, "missing_key")) {
+		t.Errorf("missing api_key_file: got %v", err)
+	}
+
+	// Without api_key_file the default location is used.
+	os.Unsetenv("GLM_API_KEY_FILE")
+	writeTOML(t, configDir, "")
+	cfg, err = Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ZaiAPIKey != "default-key" || cfg.APIKeyPath() != filepath.Join(configDir, "zai_api_key") {
+		t.Errorf("default key %q at %q", cfg.ZaiAPIKey, cfg.APIKeyPath())
+	}
+}
+
+// ---- Scenario: max_output_bytes is read from TOML, GLM_MAX_OUTPUT_BYTES overrides, negatives are rejected ----
+
+func TestMaxOutputBytes(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeTOML(t, configDir, "max_output_bytes = 65536\n")
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.MaxOutputBytes != 65536 {
+		t.Errorf("MaxOutputBytes: got %d, want 65536", cfg.MaxOutputBytes)
+	}
+
+	setenv(t, "GLM_MAX_OUTPUT_BYTES", "1000")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load with GLM_MAX_OUTPUT_BYTES returned error: %v", err)
+	}
+	if cfg.MaxOutputBytes != 1000 {
+		t.Errorf("MaxOutputBytes with GLM_MAX_OUTPUT_BYTES=1000: got %d, want 1000", cfg.MaxOutputBytes)
+	}
+
+	setenv(t, "GLM_MAX_OUTPUT_BYTES", "-1")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:validation") {
+		t.Errorf("max_output_bytes = -1: got %v, want err:validation", err)
+	}
+}
+
+// ---- Scenario: chain_context_limit defaults to 16 KB, is read from TOML, GLM_CHAIN_CONTEXT_LIMIT overrides, negatives are rejected ----
+
+func TestChainContextLimit(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ChainContextLimit != DefaultChainContextLimit {
+		t.Errorf("ChainContextLimit default: got %d, want %d", cfg.ChainContextLimit, DefaultChainContextLimit)
+	}
+
+	writeTOML(t, configDir, "chain_context_limit = 0\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ChainContextLimit != 0 {
+		t.Errorf("ChainContextLimit: got %d, want 0", cfg.ChainContextLimit)
+	}
+
+	setenv(t, "GLM_CHAIN_CONTEXT_LIMIT", "4096")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load with GLM_CHAIN_CONTEXT_LIMIT returned error: %v", err)
+	}
+	if cfg.ChainContextLimit != 4096 {
+		t.Errorf("ChainContextLimit with GLM_CHAIN_CONTEXT_LIMIT=4096: got %d, want 4096", cfg.ChainContextLimit)
+	}
+
+	setenv(t, "GLM_CHAIN_CONTEXT_LIMIT", "-1")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:validation") {
+		t.Errorf("chain_context_limit = -1: got %v, want err:validation", err)
+	}
+}
+
+// ---- Scenario: chain_clean_intermediate is off by default and read from TOML and env ----
+
+func TestChainCleanIntermediate(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ChainCleanIntermediate {
+		t.Error("chain_clean_intermediate defaults to true, want false")
+	}
+
+	writeTOML(t, configDir, "chain_clean_intermediate = true\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil || !cfg.ChainCleanIntermediate {
+		t.Errorf("from TOML: %v, err %v; want true", cfg != nil && cfg.ChainCleanIntermediate, err)
+	}
+
+	setenv(t, "GLM_CHAIN_CLEAN_INTERMEDIATE", "false")
+	if cfg, err = Load(configDir, subagentDir); err != nil || cfg.ChainCleanIntermediate {
+		t.Errorf("from env: %v, err %v; want false", cfg != nil && cfg.ChainCleanIntermediate, err)
+	}
+}
+
+// ---- Scenario: metrics_enabled is off by default and read from TOML and env ----
+
+func TestMetricsEnabled(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.MetricsEnabled {
+		t.Error("metrics_enabled defaults to true, want false")
+	}
+
+	writeTOML(t, configDir, "metrics_enabled = true\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil || !cfg.MetricsEnabled {
+		t.Errorf("from TOML: %v, err %v; want true", cfg != nil && cfg.MetricsEnabled, err)
+	}
+
+	setenv(t, "GLM_METRICS_ENABLED", "false")
+	if cfg, err = Load(configDir, subagentDir); err != nil || cfg.MetricsEnabled {
+		t.Errorf("from env: %v, err %v; want false", cfg != nil && cfg.MetricsEnabled, err)
+	}
+}
+
+// ---- Scenario: redact_prompts is off by default and read from TOML and env ----
+
+func TestRedactPrompts(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.RedactPrompts {
+		t.Error("redact_prompts defaults to true, want false")
+	}
+
+	writeTOML(t, configDir, "redact_prompts = true\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil || !cfg.RedactPrompts {
+		t.Errorf("from TOML: %v, err %v; want true", cfg != nil && cfg.RedactPrompts, err)
+	}
+
+	setenv(t, "GLM_REDACT_PROMPTS", "false")
+	if cfg, err = Load(configDir, subagentDir); err != nil || cfg.RedactPrompts {
+		t.Errorf("from env: %v, err %v; want false", cfg != nil && cfg.RedactPrompts, err)
+	}
+}
+
+// ---- Scenario: Options.ConfigFile replaces configDir/glm.toml, env still overrides it, and a missing file is err:config ----
+
+func TestLoadConfigFile(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	writeTOML(t, configDir, "model = \"glm-default\"\nmax_parallel = 7\n")
+	alt := filepath.Join(t.TempDir(), "alt.toml")
+	if err := os.WriteFile(alt, []byte("model = \"glm-alt\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadWithOptions(configDir, subagentDir, Options{ConfigFile: alt})
+	if err != nil {
+		t.Fatalf("LoadWithOptions returned error: %v", err)
+	}
+	if cfg.Model != "glm-alt" || cfg.MaxParallel != DefaultMaxParallel || cfg.ConfigFile != alt {
+		t.Errorf("model %q, max_parallel %d, config file %q; want only the alternate file read", cfg.Model, cfg.MaxParallel, cfg.ConfigFile)
+	}
+	if cfg.ZaiAPIKey != seedHappyPathAPIKey {
+		t.Errorf("API key = %q, want the one in the config dir", cfg.ZaiAPIKey)
+	}
+
+	setenv(t, "GLM_MODEL", "glm-env")
+	if cfg, err = LoadWithOptions(configDir, subagentDir, Options{ConfigFile: alt}); err != nil || cfg.Model != "glm-env" {
+		t.Errorf("with GLM_MODEL: %v, err %v; want glm-env", cfg, err)
+	}
+
+	_, err = LoadWithOptions(configDir, subagentDir, Options{ConfigFile: filepath.Join(configDir, "missing.toml")})
+	if err == nil || !strings.HasPrefix(err.Error(), `err:config "Cannot read --config file:`) {
+		t.Errorf("missing --config file: err = %v, want err:config", err)
+	}
+	if _, err := ReadTemplates(configDir, &Options{ConfigFile: filepath.Join(configDir, "missing.toml")}); err == nil {
+		t.Error("ReadTemplates with a missing --config file returned no error")
+	}
+}
+
+// ---- Scenario: strip_ansi defaults to true and is read from TOML and env ----
+
+func TestStripANSI(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !cfg.StripANSI {
+		t.Error("strip_ansi defaults to false, want true")
+	}
+
+	writeTOML(t, configDir, "strip_ansi = false\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil || cfg.StripANSI {
+		t.Errorf("from TOML: %v, err %v; want false", cfg != nil && cfg.StripANSI, err)
+	}
+
+	setenv(t, "GLM_STRIP_ANSI", "true")
+	if cfg, err = Load(configDir, subagentDir); err != nil || !cfg.StripANSI {
+		t.Errorf("from env: %v, err %v; want true", cfg != nil && cfg.StripANSI, err)
+	}
+}
+
+// ---- Scenario: confinement is off in warn mode by default, both keys read from TOML and env, an unknown mode is rejected ----
+
+func TestConfineToWorkdir(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ConfineToWorkdir || cfg.ConfineMode != ConfineWarn {
+		t.Errorf("defaults: confine_to_workdir %v, confine_mode %q; want false, warn", cfg.ConfineToWorkdir, cfg.ConfineMode)
+	}
+
+	writeTOML(t, configDir, "confine_to_workdir = true\nconfine_mode = \"strict\"\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !cfg.ConfineToWorkdir || cfg.ConfineMode != ConfineStrict {
+		t.Errorf("from TOML: confine_to_workdir %v, confine_mode %q; want true, strict", cfg.ConfineToWorkdir, cfg.ConfineMode)
+	}
+
+	setenv(t, "GLM_CONFINE_TO_WORKDIR", "false")
+	setenv(t, "GLM_CONFINE_MODE", "warn")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.ConfineToWorkdir || cfg.ConfineMode != ConfineWarn {
+		t.Errorf("from env: confine_to_workdir %v, confine_mode %q; want false, warn", cfg.ConfineToWorkdir, cfg.ConfineMode)
+	}
+
+	setenv(t, "GLM_CONFINE_MODE", "block")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:validation confine_mode") {
+		t.Errorf("confine_mode = block: got %v, want err:validation", err)
+	}
+}
+
+// ---- Scenario: max_depth defaults to 1, reads from TOML, GLM_MAX_DEPTH overrides, values below 1 are rejected ----
+
+func TestMaxDepth(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.MaxDepth != DefaultMaxDepth {
+		t.Errorf("MaxDepth default: got %d, want %d", cfg.MaxDepth, DefaultMaxDepth)
+	}
+
+	writeTOML(t, configDir, "max_depth = 2\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.MaxDepth != 2 {
+		t.Errorf("MaxDepth with max_depth = 2: got %d, want 2", cfg.MaxDepth)
+	}
+
+	setenv(t, "GLM_MAX_DEPTH", "3")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load with GLM_MAX_DEPTH returned error: %v", err)
+	}
+	if cfg.MaxDepth != 3 {
+		t.Errorf("MaxDepth with GLM_MAX_DEPTH=3: got %d, want 3", cfg.MaxDepth)
+	}
+
+	setenv(t, "GLM_MAX_DEPTH", "0")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:validation") {
+		t.Errorf("max_depth = 0: got %v, want err:validation", err)
+	}
+}
+
+// ---- Scenario: priority_aging defaults to 10 minutes, takes a duration from TOML, GLM_PRIORITY_AGING overrides, negatives are rejected ----
+
+func TestPriorityAging(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.PriorityAging != DefaultPriorityAging {
+		t.Errorf("PriorityAging default: got %d, want %d", cfg.PriorityAging, DefaultPriorityAging)
+	}
+
+	writeTOML(t, configDir, "priority_aging = \"2m\"\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.PriorityAging != 120 {
+		t.Errorf("PriorityAging with priority_aging = \"2m\": got %d, want 120", cfg.PriorityAging)
+	}
+
+	setenv(t, "GLM_PRIORITY_AGING", "0")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load with GLM_PRIORITY_AGING returned error: %v", err)
+	}
+	if cfg.PriorityAging != 0 {
+		t.Errorf("PriorityAging with GLM_PRIORITY_AGING=0: got %d, want 0", cfg.PriorityAging)
+	}
+
+	setenv(t, "GLM_PRIORITY_AGING", "-1")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:validation") {
+		t.Errorf("priority_aging = -1: got %v, want err:validation", err)
+	}
+}
+
+// ---- Scenario: kill_grace_seconds defaults to 5, takes a duration from TOML, GLM_KILL_GRACE_SECONDS overrides, negatives are rejected ----
+
+func TestKillGraceSeconds(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.KillGraceSeconds != DefaultKillGrace {
+		t.Errorf("KillGraceSeconds default: got %d, want %d", cfg.KillGraceSeconds, DefaultKillGrace)
+	}
+
+	writeTOML(t, configDir, "kill_grace_seconds = \"30s\"\n")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.KillGraceSeconds != 30 {
+		t.Errorf("KillGraceSeconds with kill_grace_seconds = \"30s\": got %d, want 30", cfg.KillGraceSeconds)
+	}
+
+	setenv(t, "GLM_KILL_GRACE_SECONDS", "0")
+	if cfg, err = Load(configDir, subagentDir); err != nil {
+		t.Fatalf("Load with GLM_KILL_GRACE_SECONDS returned error: %v", err)
+	}
+	if cfg.KillGraceSeconds != 0 {
+		t.Errorf("KillGraceSeconds with GLM_KILL_GRACE_SECONDS=0: got %d, want 0", cfg.KillGraceSeconds)
+	}
+
+	setenv(t, "GLM_KILL_GRACE_SECONDS", "-1")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:validation") {
+		t.Errorf("kill_grace_seconds = -1: got %v, want err:validation", err)
+	}
+}
+
+// ---- Scenario: allow_overlap is read from TOML and rejects non-booleans ----
+
+func TestAllowOverlap(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	writeTOML(t, configDir, "allow_overlap = true\n")
+
+	cfg, err := Load(configDir, subagentDir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !cfg.AllowOverlap {
+		t.Error("AllowOverlap: got false, want true")
+	}
+
+	writeTOML(t, configDir, "allow_overlap = sometimes\n")
+	if _, err := Load(configDir, subagentDir); err == nil || !strings.HasPrefix(err.Error(), "err:config") {
+		t.Errorf("allow_overlap = sometimes: got %v, want err:config", err)
+	}
+}
+
+// ---- Scenario: subagent_dir from TOML, GLM_SUBAGENT_DIR and --subagent-dir, relative to the project root ----
+
+func TestSubagentDirOverrides(t *testing.T) {
+	configDir, subagentDir := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	project := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(project, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{ProjectRoot: ProjectRoot(project)}
+
+	cfg, err := LoadWithOptions(configDir, subagentDir, opts)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.SubagentDir != subagentDir {
+		t.Errorf("SubagentDir default: got %q, want %q", cfg.SubagentDir, subagentDir)
+	}
+
+	writeTOML(t, configDir, "subagent_dir = \".glm/jobs\"\n")
+	if cfg, err = LoadWithOptions(configDir, subagentDir, opts); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if want := filepath.Join(project, ".glm", "jobs"); cfg.SubagentDir != want {
+		t.Errorf("SubagentDir from TOML: got %q, want %q", cfg.SubagentDir, want)
+	}
+	if info, err := os.Stat(cfg.SubagentDir); err != nil || !info.IsDir() {
+		t.Errorf("Load did not create %s: %v", cfg.SubagentDir, err)
+	}
+
+	envDir := filepath.Join(t.TempDir(), "env-jobs")
+	setenv(t, "GLM_SUBAGENT_DIR", envDir)
+	if cfg, err = LoadWithOptions(configDir, subagentDir, opts); err != nil {
+		t.Fatalf("Load with GLM_SUBAGENT_DIR returned error: %v", err)
+	}
+	if cfg.SubagentDir != envDir {
+		t.Errorf("SubagentDir with GLM_SUBAGENT_DIR: got %q, want %q", cfg.SubagentDir, envDir)
+	}
+	if got, err := ResolveSubagentDir(configDir, subagentDir, opts); err != nil || got != envDir {
+		t.Errorf("ResolveSubagentDir = %q, %v; want %q", got, err, envDir)
+	}
+
+	flagDir := filepath.Join(t.TempDir(), "flag-jobs")
+	opts.SubagentDir = flagDir
+	if cfg, err = LoadWithOptions(configDir, subagentDir, opts); err != nil {
+		t.Fatalf("Load with the flag returned error: %v", err)
+	}
+	if cfg.SubagentDir != flagDir {
+		t.Errorf("SubagentDir with the flag: got %q, want %q", cfg.SubagentDir, flagDir)
+	}
+}
+
+// ---- Scenario: a subagent dir that is a file is rejected ----
+
+func TestSubagentDirNotADirectory(t *testing.T) {
+	configDir, _ := setupDirs(t)
+	writeAPIKey(t, configDir, seedHappyPathAPIKey)
+	file := filepath.Join(t.TempDir(), "jobs")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(configDir, file)
+	if want := `err:config "Subagent directory is not a directory: ` + file + `"`; err == nil || err.Error() != want {
+		t.Errorf("Load = %v, want %s", err, want)
+	}
+}
+
+// ---- Scenario: the config dir comes from GLM_CONFIG_DIR, XDG_CONFIG_HOME or ~/.config, with a profile suffix ----
+
+func TestResolveConfigDir(t *testing.T) {
+	home := t.TempDir()
+	setenv(t, "HOME", home)
+
+	tests := []struct {
+		name, glmDir, xdg, profile string
+		want, source               string
+	}{
+		{"default", "", "", "", filepath.Join(home, ".config", "GoLeM"), "(default)"},
+		{"xdg", "", "/xdg", "", "/xdg/GoLeM", "(env)"},
+		{"relative xdg is ignored", "", "xdg", "", filepath.Join(home, ".config", "GoLeM"), "(default)"},
+		{"GLM_CONFIG_DIR wins", "/glm", "/xdg", "", "/glm", "(env)"},
+		{"profile", "", "", "work", filepath.Join(home, ".config", "GoLeM-work"), "(default)"},
+		{"profile with xdg", "", "/xdg", "personal", "/xdg/GoLeM-personal", "(env)"},
+		{"profile with GLM_CONFIG_DIR", "/glm/", "", "work", "/glm-work", "(env)"},
+	}
+	for _, tt := range tests {
+		setenv(t, "GLM_CONFIG_DIR", tt.glmDir)
+		setenv(t, "XDG_CONFIG_HOME", tt.xdg)
+		dir, source, err := ResolveConfigDir(tt.profile)
+		if err != nil || dir != tt.want || source != tt.source {
+			t.Errorf("%s: ResolveConfigDir = %q, %q, %v; want %q, %q", tt.name, dir, source, err, tt.want, tt.source)
+		}
+	}
+
+	for _, bad := range []string{"..", "a/b", "work space"} {
+		if _, _, err := ResolveConfigDir(bad); err == nil || !strings.HasPrefix(err.Error(), `err:user "Invalid --profile value: `+bad) {
+			t.Errorf("profile %q: err = %v, want err:user", bad, err)
+		}
+	}
+}
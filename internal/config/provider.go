@@ -1,10 +1,11 @@
 package config
 
 import (
-	"fmt"
 	"os"
 	"sort"
 	"strings"
+
+	"github.com/veschin/GoLeM/internal/errs"
 )
 
 // Provider holds configuration for a single API provider.
@@ -30,9 +31,9 @@ func (p *Provider) APIKey() (string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", fmt.Errorf("err:config \"Cannot read API key file for provider '%s': file not found\"", p.Name)
+			return "", errs.Config("\"Cannot read API key file for provider '%s': file not found\"", p.Name)
 		}
-		return "", fmt.Errorf("err:config \"Cannot read API key file for provider '%s': %s\"", p.Name, err.Error())
+		return "", errs.Config("\"Cannot read API key file for provider '%s': %s\"", p.Name, err.Error())
 	}
 	return strings.TrimSpace(string(data)), nil
 }
@@ -77,7 +78,7 @@ func LoadProvider(configDir, providerName string) (*Provider, error) {
 	tomlPath := configDir + "/glm.toml"
 	data, err := os.ReadFile(tomlPath)
 	if err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("err:config \"Cannot read glm.toml: %s\"", err.Error())
+		return nil, errs.Config("\"Cannot read glm.toml: %s\"", err.Error())
 	}
 
 	pc, err := ParseProviderConfig(data)
@@ -93,7 +94,7 @@ func LoadProvider(configDir, providerName string) (*Provider, error) {
 
 	p, ok := pc.Providers[name]
 	if !ok {
-		return nil, fmt.Errorf("err:user provider %q not found", name)
+		return nil, errs.User("provider %q not found", name)
 	}
 
 	return p, nil
@@ -106,7 +107,7 @@ func ListProviders(configDir string) ([]string, error) {
 	tomlPath := configDir + "/glm.toml"
 	data, err := os.ReadFile(tomlPath)
 	if err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("err:config \"Cannot read glm.toml: %s\"", err.Error())
+		return nil, errs.Config("\"Cannot read glm.toml: %s\"", err.Error())
 	}
 
 	pc, err := ParseProviderConfig(data)
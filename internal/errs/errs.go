@@ -0,0 +1,203 @@
+// Package errs defines the typed errors glm commands return. Each type prints
+// as "err:<category> <message>", the format scripts parse on stderr, and
+// ExitCode maps it to the exit code for its class with errors.As, so a
+// message that merely mentions "timeout" no longer changes the exit code.
+//
+// Constructors take a format and arguments like fmt.Errorf. The message is
+// printed as formatted, so call sites keep their quoting:
+//
+//	errs.User(`"Directory not found: %s"`, dir) // err:user "Directory not found: /x"
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/exitcode"
+)
+
+// UserError is bad input from the user: a flag, argument or prompt (exit 1).
+type UserError struct{ Msg string }
+
+// ValidationError is a config value that fails validation (exit 1).
+type ValidationError struct{ Msg string }
+
+// ConfigError is config that cannot be read or resolved, such as a missing
+// API key file (exit 1).
+type ConfigError struct{ Msg string }
+
+// InternalError is a failure that is not the user's fault (exit 1).
+type InternalError struct{ Msg string }
+
+// NotFoundError is a job, template or file that does not exist (exit 3).
+type NotFoundError struct{ Msg string }
+
+// DependencyError is a missing external program such as claude or git
+// (exit 127).
+type DependencyError struct{ Msg string }
+
+// TimeoutError is a job or lock wait that ran out of time (exit 124).
+type TimeoutError struct{ Msg string }
+
+// AuthError is an API key the endpoint rejected (exit 77).
+type AuthError struct{ Msg string }
+
+// RateLimitError is a request the endpoint refused for rate limiting
+// (exit 75).
+type RateLimitError struct{ Msg string }
+
+// ContextExceededError is a prompt too long for the model's context window,
+// which fails again however often it is retried (exit 65).
+type ContextExceededError struct{ Msg string }
+
+// DiskError is a job result that could not be written to the job directory,
+// usually because the filesystem is full (exit 74).
+type DiskError struct{ Msg string }
+
+func (e *UserError) Error() string            { return format(exitcode.CategoryUser, e.Msg) }
+func (e *ValidationError) Error() string      { return format(exitcode.CategoryValidation, e.Msg) }
+func (e *ConfigError) Error() string          { return format(exitcode.CategoryConfig, e.Msg) }
+func (e *InternalError) Error() string        { return format(exitcode.CategoryInternal, e.Msg) }
+func (e *NotFoundError) Error() string        { return format(exitcode.CategoryNotFound, e.Msg) }
+func (e *DependencyError) Error() string      { return format(exitcode.CategoryDependency, e.Msg) }
+func (e *TimeoutError) Error() string         { return format(exitcode.CategoryTimeout, e.Msg) }
+func (e *AuthError) Error() string            { return format(exitcode.CategoryAuth, e.Msg) }
+func (e *RateLimitError) Error() string       { return format(exitcode.CategoryRateLimit, e.Msg) }
+func (e *ContextExceededError) Error() string { return format(exitcode.CategoryContext, e.Msg) }
+func (e *DiskError) Error() string            { return format(exitcode.CategoryDisk, e.Msg) }
+
+// format returns "err:<category> <msg>", or just "err:<category>" for an
+// empty message.
+func format(c exitcode.Category, msg string) string {
+	if msg == "" {
+		return "err:" + string(c)
+	}
+	return "err:" + string(c) + " " + msg
+}
+
+// User returns a *UserError with the formatted message.
+func User(format string, args ...any) error {
+	return &UserError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Validation returns a *ValidationError with the formatted message.
+func Validation(format string, args ...any) error {
+	return &ValidationError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Config returns a *ConfigError with the formatted message.
+func Config(format string, args ...any) error {
+	return &ConfigError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Internal returns an *InternalError with the formatted message.
+func Internal(format string, args ...any) error {
+	return &InternalError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// NotFound returns a *NotFoundError with the formatted message.
+func NotFound(format string, args ...any) error {
+	return &NotFoundError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Dependency returns a *DependencyError with the formatted message.
+func Dependency(format string, args ...any) error {
+	return &DependencyError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Timeout returns a *TimeoutError with the formatted message.
+func Timeout(format string, args ...any) error {
+	return &TimeoutError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Auth returns an *AuthError with the formatted message.
+func Auth(format string, args ...any) error {
+	return &AuthError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// RateLimit returns a *RateLimitError with the formatted message.
+func RateLimit(format string, args ...any) error {
+	return &RateLimitError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// ContextExceeded returns a *ContextExceededError with the formatted message.
+func ContextExceeded(format string, args ...any) error {
+	return &ContextExceededError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Disk returns a *DiskError with the formatted message.
+func Disk(format string, args ...any) error {
+	return &DiskError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// ExitCode returns the exit code glm uses for err:
+//
+//	nil                                           0   exitcode.OK
+//	UserError, ValidationError, ConfigError,
+//	InternalError and untyped errors              1   exitcode.UserError
+//	NotFoundError                                 3   exitcode.NotFound
+//	ContextExceededError                         65   exitcode.ContextExceeded
+//	DiskError                                    74   exitcode.DiskError
+//	RateLimitError                               75   exitcode.RateLimited
+//	AuthError                                    77   exitcode.AuthFailed
+//	TimeoutError                                124   exitcode.Timeout
+//	DependencyError                             127   exitcode.DependencyMissing
+//
+// Wrapped errors are unwrapped with errors.As.
+func ExitCode(err error) int {
+	var (
+		notFound   *NotFoundError
+		dependency *DependencyError
+		timeout    *TimeoutError
+		auth       *AuthError
+		rateLimit  *RateLimitError
+		contextErr *ContextExceededError
+		disk       *DiskError
+	)
+	switch {
+	case err == nil:
+		return exitcode.OK
+	case errors.As(err, &notFound):
+		return exitcode.NotFound
+	case errors.As(err, &dependency):
+		return exitcode.DependencyMissing
+	case errors.As(err, &timeout):
+		return exitcode.Timeout
+	case errors.As(err, &auth):
+		return exitcode.AuthFailed
+	case errors.As(err, &rateLimit):
+		return exitcode.RateLimited
+	case errors.As(err, &contextErr):
+		return exitcode.ContextExceeded
+	case errors.As(err, &disk):
+		return exitcode.DiskError
+	default:
+		return exitcode.UserError
+	}
+}
+
+// authKeywords and rateLimitKeywords are the case-insensitive substrings of
+// claude's stderr that identify a rejected API key and a rate limit.
+var (
+	authKeywords      = []string{"api error: 401", "authentication_error", "invalid api key", "invalid x-api-key"}
+	rateLimitKeywords = []string{"api error: 429", "rate_limit_error", "rate limit", "too many requests"}
+)
+
+// FromStderr classifies the stderr of a failed claude run: an AuthError when
+// the API key was rejected, a RateLimitError when the endpoint rate limited
+// the request, and nil otherwise.
+func FromStderr(stderr string) error {
+	lower := strings.ToLower(stderr)
+	for _, kw := range authKeywords {
+		if strings.Contains(lower, kw) {
+			return Auth(`"API authentication failed; check the API key for base_url"`)
+		}
+	}
+	for _, kw := range rateLimitKeywords {
+		if strings.Contains(lower, kw) {
+			return RateLimit(`"API rate limit reached; retry later or lower max_parallel"`)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package errs_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// Scenario: Every error class prints err:<category> and maps to its exit code
+func TestExitCodeForEachClass(t *testing.T) {
+	cases := []struct {
+		err      error
+		wantMsg  string
+		wantCode int
+	}{
+		{errs.User(`"No prompt provided"`), `err:user "No prompt provided"`, 1},
+		{errs.Validation("max_parallel: must be a non-negative integer (got %d)", -1), "err:validation max_parallel: must be a non-negative integer (got -1)", 1},
+		{errs.Config(`"Cannot read glm.toml: %s"`, "EOF"), `err:config "Cannot read glm.toml: EOF"`, 1},
+		{errs.Internal(`"Cannot write index"`), `err:internal "Cannot write index"`, 1},
+		{errs.NotFound(`"Job not found: %s"`, "job-1"), `err:not_found "Job not found: job-1"`, 3},
+		{&errs.NotFoundError{}, "err:not_found", 3},
+		{errs.ContextExceeded(`"too long"`), `err:context_exceeded "too long"`, 65},
+		{errs.Disk(`"no space"`), `err:disk "no space"`, 74},
+		{errs.RateLimit(`"slow down"`), `err:rate_limit "slow down"`, 75},
+		{errs.Auth(`"bad key"`), `err:auth "bad key"`, 77},
+		{errs.Timeout(`"Job exceeded %ds timeout"`, 60), `err:timeout "Job exceeded 60s timeout"`, 124},
+		{errs.Dependency(`"claude CLI not found in PATH"`), `err:dependency "claude CLI not found in PATH"`, 127},
+	}
+	for _, tc := range cases {
+		if got := tc.err.Error(); got != tc.wantMsg {
+			t.Errorf("Error() = %q, want %q", got, tc.wantMsg)
+		}
+		if got := errs.ExitCode(tc.err); got != tc.wantCode {
+			t.Errorf("ExitCode(%s) = %d, want %d", tc.wantMsg, got, tc.wantCode)
+		}
+	}
+	if got := errs.ExitCode(nil); got != 0 {
+		t.Errorf("ExitCode(nil) = %d, want 0", got)
+	}
+}
+
+// Scenario: The exit code follows the error type, not words in the message
+func TestExitCodeIgnoresMessageText(t *testing.T) {
+	if got := errs.ExitCode(errs.User(`"Invalid default_timeout: err:timeout is not a number"`)); got != 1 {
+		t.Errorf("user error mentioning err:timeout: exit %d, want 1", got)
+	}
+	if got := errs.ExitCode(errors.New("err:not_found")); got != 1 {
+		t.Errorf("untyped error: exit %d, want 1", got)
+	}
+	wrapped := fmt.Errorf("chain step 2: %w", errs.Dependency(`"claude CLI not found in PATH"`))
+	if got := errs.ExitCode(wrapped); got != 127 {
+		t.Errorf("wrapped dependency error: exit %d, want 127", got)
+	}
+}
+
+// Scenario: claude's stderr identifies a rejected API key and a rate limit
+func TestFromStderr(t *testing.T) {
+	cases := map[string]int{
+		`API Error: 401 {"type":"error","error":{"type":"authentication_error"}}`: 77,
+		"Invalid API key · Please run /login":                                     77,
+		`API Error: 429 {"error":{"type":"rate_limit_error"}}`:                    75,
+		"Too Many Requests":                   75,
+		"Error: tool failed with exit code 1": 0,
+	}
+	for stderr, want := range cases {
+		if got := errs.ExitCode(errs.FromStderr(stderr)); got != want {
+			t.Errorf("FromStderr(%q): exit %d, want %d", stderr, got, want)
+		}
+	}
+}
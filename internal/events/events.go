@@ -0,0 +1,80 @@
+// Package events emits one JSON object per job lifecycle transition for
+// external monitoring (e.g. log shippers). Emission is disabled until an
+// output is set; the CLI enables it on stderr (and GLM_LOG_FILE) when
+// GLM_LOG_FORMAT=json, leaving human-readable logs untouched otherwise.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Type names a lifecycle event.
+type Type string
+
+const (
+	JobCreated    Type = "job_created"
+	SlotClaimed   Type = "slot_claimed"
+	ClaudeStarted Type = "claude_started"
+	ClaudeExited  Type = "claude_exited"
+	StatusChanged Type = "status_changed"
+	JobDeleted    Type = "job_deleted"
+)
+
+// Event is a single lifecycle event. JobID, ProjectID and Timestamp are always
+// present; the remaining fields are set by the events that carry them.
+type Event struct {
+	Type       Type   `json:"event"`
+	JobID      string `json:"job_id"`
+	ProjectID  string `json:"project_id"`
+	Timestamp  string `json:"ts"`
+	PID        int    `json:"pid,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	DurationMS *int64 `json:"duration_ms,omitempty"`
+	From       string `json:"from,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+var (
+	mu  sync.Mutex
+	out io.Writer
+)
+
+// SetOutput directs events to w (nil disables emission) and returns the
+// previous writer so tests can restore it.
+func SetOutput(w io.Writer) io.Writer {
+	mu.Lock()
+	defer mu.Unlock()
+	prev := out
+	out = w
+	return prev
+}
+
+// Enabled reports whether events are currently being written. Callers use it
+// to skip gathering event fields when nobody is listening.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return out != nil
+}
+
+// Emit writes e as one JSON line, stamping Timestamp if it is empty. It is a
+// no-op when emission is disabled; write errors are ignored so monitoring
+// can never fail a job.
+func Emit(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	if out == nil {
+		return
+	}
+	if e.Timestamp == "" {
+		e.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_, _ = out.Write(append(data, '\n'))
+}
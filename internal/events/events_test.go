@@ -0,0 +1,128 @@
+package events_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/events"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// captureEvents directs events into a buffer for the duration of the test.
+func captureEvents(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := events.SetOutput(&buf)
+	t.Cleanup(func() { events.SetOutput(prev) })
+	return &buf
+}
+
+// decodeEvents parses one JSON event per line.
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []events.Event {
+	t.Helper()
+	var out []events.Event
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		var e events.Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("event line is not JSON: %v\n%s", err, sc.Text())
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// TestSynchronousRunEmitsLifecycleSequence covers:
+//
+//	Scenario: A full run against a mock claude emits one event per transition
+func TestSynchronousRunEmitsLifecycleSequence(t *testing.T) {
+	binDir := t.TempDir()
+	script := "#!/bin/sh\necho '{\"result\":\"ok\"}'\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(binDir, "claude"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	buf := captureEvents(t)
+
+	// The same sequence cmdRun performs.
+	j, err := job.NewJob(t.TempDir(), "proj-events", "job-20260227-143205-a8f3b1c2")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := job.ClaimSlot(j.Dir); err != nil {
+		t.Fatalf("ClaimSlot: %v", err)
+	}
+	code, err := claude.Execute(claude.Config{WorkDir: t.TempDir(), JobDir: j.Dir})
+	if err != nil || code != 0 {
+		t.Fatalf("Execute = %d, %v", code, err)
+	}
+	if err := j.StatusTransition(job.StatusDone); err != nil {
+		t.Fatalf("StatusTransition(done): %v", err)
+	}
+	if err := job.DeleteJob(j.Dir); err != nil {
+		t.Fatalf("DeleteJob: %v", err)
+	}
+
+	got := decodeEvents(t, buf)
+	want := []events.Type{
+		events.JobCreated,
+		events.StatusChanged,
+		events.SlotClaimed,
+		events.ClaudeStarted,
+		events.ClaudeExited,
+		events.StatusChanged,
+		events.JobDeleted,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d:\n%s", len(got), len(want), buf.String())
+	}
+	for i, e := range got {
+		if e.Type != want[i] {
+			t.Errorf("event %d = %s, want %s", i, e.Type, want[i])
+		}
+		if e.JobID != j.ID || e.ProjectID != "proj-events" || e.Timestamp == "" {
+			t.Errorf("event %d missing identity: %+v", i, e)
+		}
+	}
+
+	if got[1].From != "queued" || got[1].Status != "running" {
+		t.Errorf("first status_changed = %s -> %s, want queued -> running", got[1].From, got[1].Status)
+	}
+	if got[3].PID <= 0 {
+		t.Errorf("claude_started pid = %d, want > 0", got[3].PID)
+	}
+	if got[4].ExitCode == nil || *got[4].ExitCode != 0 || got[4].DurationMS == nil {
+		t.Errorf("claude_exited = %+v, want exit_code 0 and duration", got[4])
+	}
+	if got[5].Status != "done" {
+		t.Errorf("final status_changed = %q, want done", got[5].Status)
+	}
+}
+
+// TestNoEventsWhenDisabled covers:
+//
+//	Scenario: Without GLM_LOG_FORMAT=json nothing is emitted
+func TestNoEventsWhenDisabled(t *testing.T) {
+	prev := events.SetOutput(nil)
+	t.Cleanup(func() { events.SetOutput(prev) })
+
+	if events.Enabled() {
+		t.Fatal("Enabled() = true with no output")
+	}
+	// Must not panic or write anywhere.
+	events.Emit(events.Event{Type: events.JobCreated, JobID: "job-x"})
+
+	j, err := job.NewJob(t.TempDir(), "proj", "job-x")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := job.DeleteJob(j.Dir); err != nil {
+		t.Fatalf("DeleteJob: %v", err)
+	}
+}
@@ -10,8 +10,13 @@ const (
 	OK                = 0
 	UserError         = 1
 	NotFound          = 3
+	ContextExceeded   = 65 // EX_DATAERR: the prompt did not fit the model's context window
+	DiskError         = 74 // EX_IOERR: the job's results could not be written to disk
+	RateLimited       = 75 // EX_TEMPFAIL: the API refused the request for rate limiting
+	AuthFailed        = 77 // EX_NOPERM: the API rejected the key
 	Timeout           = 124
 	DependencyMissing = 127
+	Interrupted       = 130 // 128+SIGINT: glm run was stopped with Ctrl-C
 )
 
 // Category represents the type of error.
@@ -24,6 +29,11 @@ const (
 	CategoryValidation Category = "validation"
 	CategoryInternal   Category = "internal"
 	CategoryTimeout    Category = "timeout"
+	CategoryConfig     Category = "config"
+	CategoryAuth       Category = "auth"
+	CategoryRateLimit  Category = "rate_limit"
+	CategoryContext    Category = "context_exceeded"
+	CategoryDisk       Category = "disk"
 )
 
 // Error is a typed error that carries a category and an optional suggestion.
@@ -77,7 +87,7 @@ func IsPermissionError(stderr string) bool {
 // ExitCodeFor returns the numeric exit code that corresponds to a Category.
 func ExitCodeFor(c Category) int {
 	switch c {
-	case CategoryUser, CategoryValidation, CategoryInternal:
+	case CategoryUser, CategoryValidation, CategoryInternal, CategoryConfig:
 		return UserError
 	case CategoryNotFound:
 		return NotFound
@@ -85,6 +95,14 @@ func ExitCodeFor(c Category) int {
 		return Timeout
 	case CategoryDependency:
 		return DependencyMissing
+	case CategoryAuth:
+		return AuthFailed
+	case CategoryRateLimit:
+		return RateLimited
+	case CategoryContext:
+		return ContextExceeded
+	case CategoryDisk:
+		return DiskError
 	default:
 		return UserError
 	}
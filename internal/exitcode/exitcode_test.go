@@ -382,6 +382,9 @@ func TestExitCodeConstants(t *testing.T) {
 		{"OK", exitcode.OK, 0},
 		{"UserError", exitcode.UserError, 1},
 		{"NotFound", exitcode.NotFound, 3},
+		{"ContextExceeded", exitcode.ContextExceeded, 65},
+		{"RateLimited", exitcode.RateLimited, 75},
+		{"AuthFailed", exitcode.AuthFailed, 77},
 		{"Timeout", exitcode.Timeout, 124},
 		{"DependencyMissing", exitcode.DependencyMissing, 127},
 	}
@@ -393,3 +396,17 @@ func TestExitCodeConstants(t *testing.T) {
 		})
 	}
 }
+
+func TestExitCodeForNewCategories(t *testing.T) {
+	cases := map[exitcode.Category]int{
+		exitcode.CategoryConfig:    1,
+		exitcode.CategoryRateLimit: 75,
+		exitcode.CategoryAuth:      77,
+		exitcode.CategoryContext:   65,
+	}
+	for c, want := range cases {
+		if got := exitcode.ExitCodeFor(c); got != want {
+			t.Errorf("ExitCodeFor(%q) = %d, want %d", c, got, want)
+		}
+	}
+}
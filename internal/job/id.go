@@ -0,0 +1,135 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// idPattern matches "<prefix>-YYYYMMDD-HHMMSS-xxxxxxxx". Generated IDs use
+// lowercase hex for the last part; any 8 lowercase alphanumerics are accepted.
+const idPattern = `-[0-9]{8}-[0-9]{6}-[0-9a-z]{8}$`
+
+var (
+	jobIDRe   = regexp.MustCompile(`^job` + idPattern)
+	chainIDRe = regexp.MustCompile(`^chain` + idPattern)
+
+	// jobIDFragmentRe matches input that could be part of a generated job ID:
+	// digits, hex letters and dashes, optionally after "job-".
+	jobIDFragmentRe = regexp.MustCompile(`^(job-)?[0-9a-f][0-9a-f-]{3,}$`)
+)
+
+// ValidateJobID checks that id has the "job-YYYYMMDD-HHMMSS-xxxxxxxx" format.
+// Returns err:user otherwise.
+func ValidateJobID(id string) error {
+	if !jobIDRe.MatchString(id) {
+		return errs.User(`"Invalid job ID format: %s (expected job-YYYYMMDD-HHMMSS-xxxxxxxx)"`, id)
+	}
+	return nil
+}
+
+// ValidateChainID checks that id has the "chain-YYYYMMDD-HHMMSS-xxxxxxxx"
+// format. Returns err:user otherwise.
+func ValidateChainID(id string) error {
+	if !chainIDRe.MatchString(id) {
+		return errs.User(`"Invalid chain ID format: %s (expected chain-YYYYMMDD-HHMMSS-xxxxxxxx)"`, id)
+	}
+	return nil
+}
+
+// ResolveJobID turns a user-supplied job reference into a full job ID.
+//
+// A well-formed ID is returned unchanged without touching the filesystem.
+// Otherwise ref may be an unambiguous part of an existing job ID: its
+// beginning ("job-20260227-1432"), the timestamp ("20260227-143205",
+// "143205") or the random suffix ("a8f3b1c2"). Jobs are searched in every
+// project under subagentsRoot.
+//
+// Returns err:user if ref is neither an ID nor an ID fragment, or if it
+// matches several jobs (the error lists them). A fragment that matches no job
+// is returned unchanged so the caller's FindJobDir reports not_found.
+func ResolveJobID(subagentsRoot, ref string) (string, error) {
+	if ValidateJobID(ref) == nil {
+		return ref, nil
+	}
+	if !jobIDFragmentRe.MatchString(ref) {
+		return "", ValidateJobID(ref)
+	}
+
+	var matches []string
+	for _, id := range listJobIDs(subagentsRoot) {
+		if jobIDHasFragment(id, ref) {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return ref, nil
+	case 1:
+		return matches[0], nil
+	}
+	return "", errs.User(`"Job ID %s is ambiguous; matches: %s"`, ref, strings.Join(matches, ", "))
+}
+
+// jobIDHasFragment reports whether fragment is a prefix of id, of id without
+// "job-", or of one of its date, time and suffix parts.
+func jobIDHasFragment(id, fragment string) bool {
+	if strings.HasPrefix(id, fragment) {
+		return true
+	}
+	rest := strings.TrimPrefix(id, "job-")
+	if strings.HasPrefix(rest, fragment) {
+		return true
+	}
+	for _, part := range strings.Split(rest, "-") {
+		if strings.HasPrefix(part, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// listJobIDs returns the sorted, de-duplicated IDs of all jobs under
+// subagentsRoot, in both the project-scoped and the legacy flat layout.
+func listJobIDs(subagentsRoot string) []string {
+	entries, err := os.ReadDir(subagentsRoot)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	add := func(name string) {
+		if jobIDRe.MatchString(name) {
+			seen[name] = true
+		}
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if jobIDRe.MatchString(e.Name()) {
+			add(e.Name())
+			continue
+		}
+		jobDirs, err := os.ReadDir(filepath.Join(subagentsRoot, e.Name()))
+		if err != nil {
+			continue
+		}
+		for _, jd := range jobDirs {
+			if jd.IsDir() {
+				add(jd.Name())
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
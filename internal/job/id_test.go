@@ -0,0 +1,118 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestValidateJobID covers:
+//
+//	Scenario: Only job-YYYYMMDD-HHMMSS-xxxxxxxx is a valid job ID
+func TestValidateJobID(t *testing.T) {
+	valid := []string{
+		"job-20260227-143205-a8f3b1c2",
+		GenerateJobID(),
+	}
+	for _, id := range valid {
+		if err := ValidateJobID(id); err != nil {
+			t.Errorf("ValidateJobID(%q) = %v, want nil", id, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"running",
+		"job-20260227-143205-a8f3b1",
+		"job-20260227-143205-a8f3b1c2x",
+		"job-2026022-143205-a8f3b1c2",
+		"JOB-20260227-143205-a8f3b1c2",
+		"chain-20260227-143205-a8f3b1c2",
+		"../job-20260227-143205-a8f3b1c2",
+	}
+	for _, id := range invalid {
+		err := ValidateJobID(id)
+		if err == nil {
+			t.Errorf("ValidateJobID(%q) = nil, want error", id)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), `err:user "Invalid job ID format: `) {
+			t.Errorf("ValidateJobID(%q) error = %q", id, err)
+		}
+	}
+}
+
+// TestValidateChainID covers:
+//
+//	Scenario: Chain IDs use the job ID format with a chain- prefix
+func TestValidateChainID(t *testing.T) {
+	if err := ValidateChainID(GenerateChainID()); err != nil {
+		t.Errorf("ValidateChainID(generated) = %v", err)
+	}
+	if err := ValidateChainID("job-20260227-143205-a8f3b1c2"); err == nil {
+		t.Error("ValidateChainID accepted a job ID")
+	}
+}
+
+// TestResolveJobID covers:
+//
+//	Scenario: Unique parts of a job ID resolve to the full ID
+//	Scenario: Ambiguous parts list the candidates
+//	Scenario: Non-IDs are rejected without scanning
+func TestResolveJobID(t *testing.T) {
+	root := t.TempDir()
+	ids := map[string]string{
+		"job-20260227-143205-a8f3b1c2": "proj-a",
+		"job-20260227-150000-b1c2d3e4": "proj-b",
+		"job-20260228-090000-c2d3e4f5": "", // legacy flat layout
+	}
+	for id, project := range ids {
+		if err := os.MkdirAll(filepath.Join(root, project, id), 0o755); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	resolved := []struct {
+		ref  string
+		want string
+	}{
+		{"job-20260227-143205-a8f3b1c2", "job-20260227-143205-a8f3b1c2"},
+		{"a8f3b1c2", "job-20260227-143205-a8f3b1c2"},
+		{"a8f3", "job-20260227-143205-a8f3b1c2"},
+		{"20260227-143205", "job-20260227-143205-a8f3b1c2"},
+		{"150000", "job-20260227-150000-b1c2d3e4"},
+		{"job-20260228", "job-20260228-090000-c2d3e4f5"},
+		// A well-formed fragment with no match is passed through for not_found.
+		{"deadbeef", "deadbeef"},
+		// A full ID is never looked up.
+		{"job-20990101-000000-00000000", "job-20990101-000000-00000000"},
+	}
+	for _, tt := range resolved {
+		got, err := ResolveJobID(root, tt.ref)
+		if err != nil {
+			t.Errorf("ResolveJobID(%q): %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveJobID(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+
+	_, err := ResolveJobID(root, "20260227")
+	if err == nil {
+		t.Fatal("expected ambiguity error for 20260227")
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, `err:user "Job ID 20260227 is ambiguous`) ||
+		!strings.Contains(msg, "job-20260227-143205-a8f3b1c2") ||
+		!strings.Contains(msg, "job-20260227-150000-b1c2d3e4") {
+		t.Errorf("ambiguity error = %q", msg)
+	}
+
+	for _, ref := range []string{"running", "abc", "xyz12345", "job-"} {
+		if _, err := ResolveJobID(root, ref); err == nil || !strings.Contains(err.Error(), "Invalid job ID format") {
+			t.Errorf("ResolveJobID(%q) error = %v, want invalid format", ref, err)
+		}
+	}
+}
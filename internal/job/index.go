@@ -0,0 +1,213 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/veschin/GoLeM/internal/slot"
+)
+
+// IndexFile is the per-project summary of its jobs, kept in
+// subagentsRoot/<project-id>/ so list does not have to open every job
+// directory.
+const IndexFile = "index.json"
+
+// indexLockFile is the per-project lock file held while IndexFile is
+// rewritten.
+const indexLockFile = ".index.lock"
+
+// promptPreviewLen bounds IndexEntry.Prompt (see PromptPreview).
+const promptPreviewLen = 80
+
+// IndexEntry summarises one job in IndexFile. An empty Status marks a job-*
+// directory that has no status yet.
+type IndexEntry struct {
+	ID         string `json:"id"`
+	Status     Status `json:"status"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Prompt     string `json:"prompt,omitempty"`
+	ChainID    string `json:"chain_id,omitempty"`
+	ChainStep  int    `json:"chain_step,omitempty"`
+	// RetriedFrom and RetriedBy are the job's retry links (see LinkRetry).
+	RetriedFrom string `json:"retried_from,omitempty"`
+	RetriedBy   string `json:"retried_by,omitempty"`
+}
+
+// index is the content of IndexFile, keyed by job ID.
+type index struct {
+	Jobs map[string]IndexEntry `json:"jobs"`
+}
+
+// PromptPreview returns prompt on one line, its whitespace collapsed, cut
+// to promptPreviewLen runes with "...".
+func PromptPreview(prompt string) string {
+	prompt = strings.Join(strings.Fields(prompt), " ")
+	if r := []rune(prompt); len(r) > promptPreviewLen {
+		prompt = string(r[:promptPreviewLen-3]) + "..."
+	}
+	return prompt
+}
+
+// indexEntry returns the IndexEntry for manifest m.
+func indexEntry(m *Manifest) IndexEntry {
+	return IndexEntry{
+		ID:          m.ID,
+		Status:      m.Status,
+		StartedAt:   m.StartedAt,
+		FinishedAt:  m.FinishedAt,
+		Prompt:      PromptPreview(m.Prompt),
+		ChainID:     m.ChainID,
+		ChainStep:   m.ChainStep,
+		RetriedFrom: m.RetriedFrom,
+		RetriedBy:   m.RetriedBy,
+	}
+}
+
+// indexedProjectDir returns the project directory whose index lists the job
+// in dir with manifest m. Jobs in the legacy flat layout are not indexed.
+func indexedProjectDir(dir string, m *Manifest) (string, bool) {
+	projectDir := filepath.Dir(dir)
+	if m.ProjectID == "" || filepath.Base(projectDir) != m.ProjectID {
+		return "", false
+	}
+	return projectDir, true
+}
+
+// updateIndex records the job in dir, whose manifest was just written as m,
+// in its project's index under the index lock. A missing or unreadable index
+// is rebuilt from the job directories first. The entry is taken from the
+// manifest on disk, re-read under the lock, not from m: when two writers
+// interleave, the one updating the index last may hold the older manifest.
+func updateIndex(dir string, m *Manifest) error {
+	projectDir, ok := indexedProjectDir(dir, m)
+	if !ok {
+		return nil
+	}
+	return slot.WithFileLock(filepath.Join(projectDir, indexLockFile), func() error {
+		idx, err := readIndex(projectDir)
+		if err != nil {
+			idx = scanIndex(projectDir)
+		}
+		cur, err := ReadManifest(dir)
+		if err != nil {
+			// The job directory was deleted meanwhile.
+			delete(idx.Jobs, m.ID)
+			return writeIndex(projectDir, idx)
+		}
+		fillFromLegacy(dir, cur)
+		idx.Jobs[m.ID] = indexEntry(cur)
+		return writeIndex(projectDir, idx)
+	})
+}
+
+// removeFromIndex drops the job in dir from its project's index, if the
+// project has one.
+func removeFromIndex(dir string) error {
+	projectDir := filepath.Dir(dir)
+	if _, err := os.Stat(filepath.Join(projectDir, IndexFile)); err != nil {
+		return nil
+	}
+	return slot.WithFileLock(filepath.Join(projectDir, indexLockFile), func() error {
+		idx, err := readIndex(projectDir)
+		if err != nil {
+			return writeIndex(projectDir, scanIndex(projectDir))
+		}
+		delete(idx.Jobs, filepath.Base(dir))
+		return writeIndex(projectDir, idx)
+	})
+}
+
+// ReadIndex returns the entries of projectDir/index.json, keyed by job ID.
+// The index is checked against the job-* directories in projectDir (one
+// directory read, no job files opened): when a listed job directory has
+// disappeared or one is missing from the index, the index is rebuilt from
+// the job directories and rewritten. ok is false when projectDir has no
+// readable index; callers then walk the job directories themselves.
+func ReadIndex(projectDir string) (entries map[string]IndexEntry, ok bool) {
+	idx, err := readIndex(projectDir)
+	if err != nil {
+		return nil, false
+	}
+	if indexMatchesDirs(projectDir, idx) {
+		return idx.Jobs, true
+	}
+	if err := RebuildIndex(projectDir); err != nil {
+		return nil, false
+	}
+	if idx, err = readIndex(projectDir); err != nil {
+		return nil, false
+	}
+	return idx.Jobs, true
+}
+
+// RebuildIndex rewrites projectDir/index.json from the manifests of its
+// job-* directories, under the index lock.
+func RebuildIndex(projectDir string) error {
+	return slot.WithFileLock(filepath.Join(projectDir, indexLockFile), func() error {
+		return writeIndex(projectDir, scanIndex(projectDir))
+	})
+}
+
+// indexMatchesDirs reports whether idx lists exactly the job-* directories
+// in projectDir.
+func indexMatchesDirs(projectDir string, idx *index) bool {
+	dirs, err := os.ReadDir(projectDir)
+	if err != nil {
+		return false
+	}
+	n := 0
+	for _, d := range dirs {
+		if !d.IsDir() || !strings.HasPrefix(d.Name(), "job-") {
+			continue
+		}
+		if _, ok := idx.Jobs[d.Name()]; !ok {
+			return false
+		}
+		n++
+	}
+	return n == len(idx.Jobs)
+}
+
+// scanIndex builds an index from the job-* directories in projectDir.
+func scanIndex(projectDir string) *index {
+	idx := &index{Jobs: map[string]IndexEntry{}}
+	dirs, err := os.ReadDir(projectDir)
+	if err != nil {
+		return idx
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || !strings.HasPrefix(d.Name(), "job-") {
+			continue
+		}
+		dir := filepath.Join(projectDir, d.Name())
+		m := LoadManifest(dir)
+		m.ID = d.Name()
+		idx.Jobs[d.Name()] = indexEntry(m)
+	}
+	return idx
+}
+
+// readIndex reads and decodes projectDir/index.json.
+func readIndex(projectDir string) (*index, error) {
+	data, err := os.ReadFile(filepath.Join(projectDir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", IndexFile, err)
+	}
+	if idx.Jobs == nil {
+		idx.Jobs = map[string]IndexEntry{}
+	}
+	return &idx, nil
+}
+
+// writeIndex atomically writes idx to projectDir/index.json.
+func writeIndex(projectDir string, idx *index) error {
+	return AtomicWriteJSON(filepath.Join(projectDir, IndexFile), idx)
+}
@@ -0,0 +1,212 @@
+package job
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestIndexTracksJobLifecycle covers:
+//
+//	Scenario: Creating, transitioning and deleting jobs keeps index.json current
+func TestIndexTracksJobLifecycle(t *testing.T) {
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "proj-1")
+
+	a, err := NewJob(root, "proj-1", "job-20260227-143205-a8f3b1c2")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	b, err := NewJob(root, "proj-1", "job-20260227-143206-b1c2d3e4")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	long := strings.Repeat("refactor the parser ", 10)
+	err = UpdateManifest(a.Dir, func(m *Manifest) {
+		m.Prompt = long
+		m.StartedAt = "2026-02-27T14:32:05Z"
+	})
+	if err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+	if err := TransitionStatus(a.Dir, StatusRunning); err != nil {
+		t.Fatalf("TransitionStatus: %v", err)
+	}
+
+	idx, err := readIndex(projectDir)
+	if err != nil {
+		t.Fatalf("readIndex: %v", err)
+	}
+	e := idx.Jobs[a.ID]
+	if e.Status != StatusRunning || e.StartedAt != "2026-02-27T14:32:05Z" {
+		t.Errorf("entry for %s = %+v", a.ID, e)
+	}
+	if len([]rune(e.Prompt)) != promptPreviewLen || !strings.HasSuffix(e.Prompt, "...") {
+		t.Errorf("prompt preview = %q, want %d runes ending in ...", e.Prompt, promptPreviewLen)
+	}
+	if idx.Jobs[b.ID].Status != StatusQueued {
+		t.Errorf("entry for %s = %+v, want queued", b.ID, idx.Jobs[b.ID])
+	}
+
+	if err := DeleteJob(b.Dir); err != nil {
+		t.Fatalf("DeleteJob: %v", err)
+	}
+	idx, _ = readIndex(projectDir)
+	if _, ok := idx.Jobs[b.ID]; ok || len(idx.Jobs) != 1 {
+		t.Errorf("index after DeleteJob = %v, want only %s", idx.Jobs, a.ID)
+	}
+}
+
+// TestIndexRebuiltAfterManualDeletion covers:
+//
+//	Scenario: A job dir removed by hand is dropped from the index on the next read
+//	Scenario: A job dir the index does not know is added on the next read
+func TestIndexRebuiltAfterManualDeletion(t *testing.T) {
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "proj-1")
+	var dirs []string
+	for i := range 3 {
+		j, err := NewJob(root, "proj-1", fmt.Sprintf("job-20260227-14320%d-a8f3b1c2", i))
+		if err != nil {
+			t.Fatalf("NewJob: %v", err)
+		}
+		dirs = append(dirs, j.Dir)
+	}
+
+	if err := os.RemoveAll(dirs[1]); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	entries, ok := ReadIndex(projectDir)
+	if !ok {
+		t.Fatal("ReadIndex: no index")
+	}
+	if _, ok := entries[filepath.Base(dirs[1])]; ok || len(entries) != 2 {
+		t.Errorf("entries after manual deletion = %v", entries)
+	}
+	// The rebuilt index is written back, so the next read needs no rebuild.
+	if idx, err := readIndex(projectDir); err != nil || !indexMatchesDirs(projectDir, idx) {
+		t.Errorf("index.json not rewritten: %v", err)
+	}
+
+	// A job dir written by hand (no manifest) shows up with its status.
+	manual := filepath.Join(projectDir, "job-20260227-150000-c2d3e4f5")
+	if err := os.MkdirAll(manual, 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(manual, "status"), []byte("done"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	entries, _ = ReadIndex(projectDir)
+	if e := entries["job-20260227-150000-c2d3e4f5"]; e.Status != StatusDone {
+		t.Errorf("manual job entry = %+v, want done", e)
+	}
+
+	// Without an index there is nothing to read; callers walk instead.
+	if err := os.Remove(filepath.Join(projectDir, IndexFile)); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, ok := ReadIndex(projectDir); ok {
+		t.Error("ReadIndex reported an index after index.json was removed")
+	}
+}
+
+// TestIndexLastWriterHoldsOlderManifest covers:
+//
+//	Scenario: Two writers of one job leave the newer status in index.json,
+//	whichever of them updates the index last
+func TestIndexLastWriterHoldsOlderManifest(t *testing.T) {
+	root := t.TempDir()
+	j, err := NewJob(root, "proj-1", "job-20260227-143205-a8f3b1c2")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := TransitionStatus(j.Dir, StatusRunning); err != nil {
+		t.Fatalf("TransitionStatus(running): %v", err)
+	}
+	// Writer A read the running manifest; writer B then finishes the job.
+	stale := LoadManifest(j.Dir)
+	if err := TransitionStatus(j.Dir, StatusDone); err != nil {
+		t.Fatalf("TransitionStatus(done): %v", err)
+	}
+	// A's index update lands after B's.
+	if err := updateIndex(j.Dir, stale); err != nil {
+		t.Fatalf("updateIndex: %v", err)
+	}
+
+	entries, ok := ReadIndex(filepath.Join(root, "proj-1"))
+	if !ok {
+		t.Fatal("ReadIndex: no index")
+	}
+	if got := entries[j.ID].Status; got != StatusDone {
+		t.Errorf("index status = %q, want done", got)
+	}
+}
+
+// indexHelperEnv makes TestIndexHelperProcess create jobs instead of
+// skipping; its value is "<root>:<worker>".
+const indexHelperEnv = "GOLEM_INDEX_HELPER"
+
+// TestIndexConcurrentProcesses covers:
+//
+//	Scenario: Two processes creating and starting jobs lose no index updates
+func TestIndexConcurrentProcesses(t *testing.T) {
+	root := t.TempDir()
+	const workers, perWorker = 2, 15
+
+	var cmds []*exec.Cmd
+	for w := range workers {
+		c := exec.Command(os.Args[0], "-test.run=^TestIndexHelperProcess$")
+		c.Env = append(os.Environ(), fmt.Sprintf("%s=%s:%d", indexHelperEnv, root, w))
+		if err := c.Start(); err != nil {
+			t.Fatalf("start helper: %v", err)
+		}
+		cmds = append(cmds, c)
+	}
+	for _, c := range cmds {
+		if err := c.Wait(); err != nil {
+			t.Fatalf("helper: %v", err)
+		}
+	}
+
+	projectDir := filepath.Join(root, "proj-1")
+	idx, err := readIndex(projectDir)
+	if err != nil {
+		t.Fatalf("readIndex: %v", err)
+	}
+	if len(idx.Jobs) != workers*perWorker {
+		t.Errorf("index has %d jobs, want %d", len(idx.Jobs), workers*perWorker)
+	}
+	for id, e := range idx.Jobs {
+		if e.Status != StatusRunning {
+			t.Errorf("%s: index status = %q, want running", id, e.Status)
+		}
+	}
+	if !indexMatchesDirs(projectDir, idx) {
+		t.Error("index does not match the job dirs")
+	}
+}
+
+// TestIndexHelperProcess is the worker process of
+// TestIndexConcurrentProcesses; it does nothing in a normal test run.
+func TestIndexHelperProcess(t *testing.T) {
+	spec := os.Getenv(indexHelperEnv)
+	if spec == "" {
+		return
+	}
+	root, worker, _ := strings.Cut(spec, ":")
+	w, _ := strconv.Atoi(worker)
+	for i := range 15 {
+		id := fmt.Sprintf("job-20260227-1432%02d-%08x", w, i)
+		j, err := NewJob(root, "proj-1", id)
+		if err != nil {
+			t.Fatalf("NewJob: %v", err)
+		}
+		if err := TransitionStatus(j.Dir, StatusRunning); err != nil {
+			t.Fatalf("TransitionStatus: %v", err)
+		}
+	}
+}
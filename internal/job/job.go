@@ -6,12 +6,21 @@ package job
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/events"
+	"github.com/veschin/GoLeM/internal/slot"
 )
 
 // Status represents the lifecycle state of a job.
@@ -25,6 +34,9 @@ const (
 	StatusTimeout         Status = "timeout"
 	StatusKilled          Status = "killed"
 	StatusPermissionError Status = "permission_error"
+	// StatusContextExceeded is a job whose prompt did not fit the model's
+	// context window; retrying it unchanged fails the same way.
+	StatusContextExceeded Status = "context_exceeded"
 )
 
 // validStatuses is the set of all recognised status values.
@@ -36,38 +48,111 @@ var validStatuses = map[Status]bool{
 	StatusTimeout:         true,
 	StatusKilled:          true,
 	StatusPermissionError: true,
+	StatusContextExceeded: true,
 }
 
 // allowedTransitions maps each status to the set of statuses it may legally
-// transition into.
+// transition into. Terminal statuses have no entry: they are absorbing.
+// A queued job can be killed before it starts, or fail to launch.
 var allowedTransitions = map[Status][]Status{
-	StatusQueued:  {StatusRunning},
-	StatusRunning: {StatusDone, StatusFailed, StatusTimeout, StatusKilled, StatusPermissionError},
+	StatusQueued:  {StatusRunning, StatusKilled, StatusFailed},
+	StatusRunning: {StatusDone, StatusFailed, StatusTimeout, StatusKilled, StatusPermissionError, StatusContextExceeded},
 }
 
+// statusLockFile is the per-job lock file held while a transition is
+// validated and written.
+const statusLockFile = ".status.lock"
+
+// ErrInvalidTransition is returned (wrapped) by StatusTransition when the
+// state machine does not allow moving from the current status to the
+// requested one, e.g. a late completion writer trying to overwrite "killed".
+// Use errors.Is to detect it.
+var ErrInvalidTransition = errors.New("invalid transition")
+
 // ErrNotFound is returned by FindJobDir when the job directory cannot be
 // located under any search path.
-var ErrNotFound = errors.New("err:not_found")
+var ErrNotFound error = &errs.NotFoundError{}
 
 // Job holds the metadata for a single subagent job.
 type Job struct {
 	ID        string
 	ProjectID string
 	Dir       string // absolute path to the job directory
+	// IDRetries is the number of job IDs NewJob drew again because their
+	// directory already existed.
+	IDRetries int
+}
+
+// maxIDAttempts bounds the job IDs NewJob tries before it gives up.
+const maxIDAttempts = 5
+
+// newJobID draws the job ID NewJob retries with; tests replace it.
+var newJobID = GenerateJobID
+
+// IDCollisionError is returned by NewJob when the directory of every job ID
+// it tried already existed.
+type IDCollisionError struct {
+	Dir      string // the project directory the jobs were created in
+	Attempts int
+}
+
+func (e *IDCollisionError) Error() string {
+	return fmt.Sprintf("create job dir: %d job IDs in a row already exist in %s", e.Attempts, e.Dir)
 }
 
 // NewJob creates a new job directory under subagentsRoot/<projectID>/<jobID>/,
-// writes the initial "queued" status file atomically, and returns the Job.
+// writes the initial job.json manifest and "queued" status file atomically,
+// and returns the Job. The directory and its initial files are created under
+// the subagent root lock (slot.WithLock), so concurrent glm processes never
+// see a job without its status.
+//
+// The job directory itself is created exclusively, so two jobs never share
+// one. If it already exists (a collision of two IDs drawn in the same
+// second, possibly by another machine sharing the directory), NewJob draws a
+// new ID, up to maxIDAttempts IDs in all, and records the retries in
+// Job.IDRetries. The returned Job's ID is the one used; callers must not
+// keep jobID. When every attempt collides it returns an *IDCollisionError.
 func NewJob(subagentsRoot, projectID, jobID string) (*Job, error) {
-	dir := filepath.Join(subagentsRoot, projectID, jobID)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return nil, fmt.Errorf("create job dir: %w", err)
+	projectDir := filepath.Join(subagentsRoot, projectID)
+	j := &Job{ID: jobID, ProjectID: projectID, Dir: filepath.Join(projectDir, jobID)}
+
+	if err := os.MkdirAll(subagentsRoot, 0o755); err != nil {
+		return nil, fmt.Errorf("create subagent root: %w", err)
 	}
+	err := slot.WithLock(subagentsRoot, func() error {
+		if err := os.MkdirAll(projectDir, 0o755); err != nil {
+			return fmt.Errorf("create project dir: %w", err)
+		}
+		for {
+			err := os.Mkdir(j.Dir, 0o755)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("create job dir: %w", err)
+			}
+			if j.IDRetries+1 >= maxIDAttempts {
+				return &IDCollisionError{Dir: projectDir, Attempts: maxIDAttempts}
+			}
+			j.IDRetries++
+			j.ID = newJobID()
+			j.Dir = filepath.Join(projectDir, j.ID)
+		}
+		dir := j.Dir
 
-	j := &Job{ID: jobID, ProjectID: projectID, Dir: dir}
-	if err := j.SetStatus(StatusQueued); err != nil {
+		createdAt := nowRFC3339()
+		if err := os.WriteFile(filepath.Join(dir, "created_at.txt"), []byte(createdAt), 0o644); err != nil {
+			return fmt.Errorf("write created_at.txt: %w", err)
+		}
+		if err := WriteManifest(dir, &Manifest{ID: j.ID, ProjectID: projectID, CreatedAt: createdAt}); err != nil {
+			return err
+		}
+		return j.SetStatus(StatusQueued)
+	})
+	if err != nil {
 		return nil, err
 	}
+	events.Emit(events.Event{Type: events.JobCreated, JobID: j.ID, ProjectID: projectID, Status: string(StatusQueued)})
 	return j, nil
 }
 
@@ -75,6 +160,17 @@ func NewJob(subagentsRoot, projectID, jobID string) (*Job, error) {
 // "job-YYYYMMDD-HHMMSS-XXXXXXXX" where XXXXXXXX is 4 random bytes encoded as
 // lowercase hex.  The timestamp is taken from the current wall clock.
 func GenerateJobID() string {
+	return generateID("job")
+}
+
+// GenerateChainID returns a new chain ID in the same format as job IDs but
+// with a "chain-" prefix: "chain-YYYYMMDD-HHMMSS-XXXXXXXX".
+func GenerateChainID() string {
+	return generateID("chain")
+}
+
+// generateID returns "<prefix>-YYYYMMDD-HHMMSS-XXXXXXXX".
+func generateID(prefix string) string {
 	now := time.Now().UTC()
 	date := now.Format("20060102")
 	timeOfDay := now.Format("150405")
@@ -86,7 +182,7 @@ func GenerateJobID() string {
 		panic(fmt.Sprintf("crypto/rand failure: %v", err))
 	}
 
-	return fmt.Sprintf("job-%s-%s-%s", date, timeOfDay, hex.EncodeToString(randomBytes))
+	return fmt.Sprintf("%s-%s-%s-%s", prefix, date, timeOfDay, hex.EncodeToString(randomBytes))
 }
 
 // ResolveProjectID derives the project identifier from an absolute directory
@@ -98,95 +194,363 @@ func ResolveProjectID(absPath string) string {
 	return fmt.Sprintf("%s-%d", base, sum)
 }
 
+// CanonicalDir returns dir as an absolute path with its symlinks evaluated,
+// the form a job's workdir is stored in and its project ID derived from. A
+// path whose symlinks cannot be evaluated, such as a missing one, is
+// returned absolute along with the error.
+func CanonicalDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs, err
+	}
+	return resolved, nil
+}
+
 // FindJobDir searches for jobID in the following order:
 //  1. subagentsRoot/<currentProjectID>/<jobID>   (current project scope)
 //  2. subagentsRoot/<jobID>                       (legacy flat layout)
 //  3. subagentsRoot/*/<jobID>                     (any other project directory)
 //
+// If the same job ID exists in more than one place (e.g. a manually copied
+// job dir), the first match in that order wins and a warning naming the
+// other locations is printed to stderr.
+//
 // Returns the absolute path to the job directory, or ErrNotFound.
 func FindJobDir(subagentsRoot, currentProjectID, jobID string) (string, error) {
-	// 1. Current project scope.
-	candidate := filepath.Join(subagentsRoot, currentProjectID, jobID)
-	if info, err := os.Stat(candidate); err == nil && info.IsDir() {
-		return candidate, nil
+	matches := findJobDirs(subagentsRoot, currentProjectID, jobID)
+	if len(matches) == 0 {
+		return "", ErrNotFound
 	}
+	if len(matches) > 1 {
+		warnf("warning: job %s exists in %d locations; using %s (also in %s)\n",
+			jobID, len(matches), matches[0], strings.Join(matches[1:], ", "))
+	}
+	return matches[0], nil
+}
 
-	// 2. Legacy flat layout.
-	candidate = filepath.Join(subagentsRoot, jobID)
-	if info, err := os.Stat(candidate); err == nil && info.IsDir() {
-		return candidate, nil
+// WarnOutput receives the warnings of this package, such as FindJobDir's
+// ambiguity warning; nil writes them to os.Stderr.
+var WarnOutput io.Writer
+
+// warnf writes a warning to WarnOutput.
+func warnf(format string, args ...any) {
+	w := WarnOutput
+	if w == nil {
+		w = os.Stderr
 	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// findJobDirs returns every directory named jobID in FindJobDir's search
+// order, without duplicates.
+func findJobDirs(subagentsRoot, currentProjectID, jobID string) []string {
+	var matches []string
+	seen := map[string]bool{}
+	add := func(candidate string) {
+		if seen[candidate] {
+			return
+		}
+		seen[candidate] = true
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			matches = append(matches, candidate)
+		}
+	}
+
+	// 1. Current project scope.
+	add(filepath.Join(subagentsRoot, currentProjectID, jobID))
+
+	// 2. Legacy flat layout.
+	add(filepath.Join(subagentsRoot, jobID))
 
 	// 3. Walk all sub-directories.
 	entries, err := os.ReadDir(subagentsRoot)
 	if err != nil {
-		return "", ErrNotFound
+		return matches
 	}
 	for _, e := range entries {
 		if !e.IsDir() {
 			continue
 		}
-		candidate = filepath.Join(subagentsRoot, e.Name(), jobID)
-		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
-			return candidate, nil
-		}
+		add(filepath.Join(subagentsRoot, e.Name(), jobID))
 	}
-
-	return "", ErrNotFound
+	return matches
 }
 
-// DeleteJob removes the entire job directory and all of its contents.
+// DeleteJob removes the entire job directory and all of its contents, and
+// drops it from its project's index.json.
 func DeleteJob(dir string) error {
-	return os.RemoveAll(dir)
+	if !events.Enabled() {
+		return removeJobDir(dir)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return removeJobDir(dir)
+	}
+	e := jobEvent(dir, events.JobDeleted)
+	if err := removeJobDir(dir); err != nil {
+		return err
+	}
+	events.Emit(e)
+	return nil
+}
+
+// removeJobDir removes dir and its index entry.
+func removeJobDir(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	_ = removeFromIndex(dir)
+	return nil
+}
+
+// EmitEvent emits a lifecycle event for the job in dir, identified from its
+// manifest. fill, if non-nil, sets the event-specific fields. It does nothing
+// when events are disabled.
+func EmitEvent(dir string, typ events.Type, fill func(e *events.Event)) {
+	if !events.Enabled() {
+		return
+	}
+	e := jobEvent(dir, typ)
+	if fill != nil {
+		fill(&e)
+	}
+	events.Emit(e)
+}
+
+// jobEvent returns an event of type typ carrying the job and project IDs.
+func jobEvent(dir string, typ events.Type) events.Event {
+	m := LoadManifest(dir)
+	return events.Event{Type: typ, JobID: m.ID, ProjectID: m.ProjectID}
 }
 
-// ReadStatus reads the "status" file inside dir and returns the parsed Status.
-// If the file is missing or contains an unrecognised value it returns
-// StatusFailed and logs a warning (warning is printed to stderr as a stub).
+// ReadStatus returns the job's Status, read from the job.json manifest first
+// and falling back to the legacy "status" file (which also wins if it was
+// written after the manifest).
+// An empty or unrecognised value is read again while the job's process is
+// alive (see StableStatus). If it stays so it returns StatusFailed and
+// writes a warning to WarnOutput.
 func ReadStatus(dir string) Status {
-	data, err := os.ReadFile(filepath.Join(dir, "status"))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "warning: job %s: cannot read status file: %v\n", dir, err)
+	s := StableStatus(dir)
+	if s == "" {
+		warnf("warning: job %s: cannot read status file\n", dir)
 		return StatusFailed
 	}
-	s := Status(data)
 	if !validStatuses[s] {
-		fmt.Fprintf(os.Stderr, "warning: job %s: unknown status %q, treating as failed\n", dir, s)
+		warnf("warning: job %s: unknown status %q, treating as failed\n", dir, s)
 		return StatusFailed
 	}
 	return s
 }
 
-// SetStatus atomically writes newStatus to the "status" file inside j.Dir.
-// It uses a temp file and os.Rename to guarantee atomicity.
+// statusRetryDelays are the pauses before StableStatus reads a status again.
+var statusRetryDelays = []time.Duration{5 * time.Millisecond, 20 * time.Millisecond}
+
+// readRawStatus reads the recorded status of dir; tests replace it to
+// simulate partial reads.
+var readRawStatus = currentStatus
+
+// StableStatus returns the raw status recorded for dir, "" when there is
+// none. A status file being replaced can read empty on some filesystems
+// (overlayfs) despite the atomic rename, so an empty or unknown value is
+// read again after each of statusRetryDelays while pid.txt names a live
+// process, until a known status turns up. The value it read last is
+// returned either way.
+func StableStatus(dir string) Status {
+	s := readRawStatus(dir)
+	if validStatuses[s] {
+		return s
+	}
+	if pid, err := readPID(dir); err != nil || pid <= 0 || !pidAlive(pid) {
+		return s
+	}
+	for _, d := range statusRetryDelays {
+		time.Sleep(d)
+		if s = readRawStatus(dir); validStatuses[s] {
+			return s
+		}
+	}
+	return s
+}
+
+// SetStatus atomically writes newStatus to the "status" file and the
+// manifest inside j.Dir.
 func (j *Job) SetStatus(newStatus Status) error {
-	return AtomicWrite(filepath.Join(j.Dir, "status"), []byte(newStatus))
+	return WriteStatus(j.Dir, newStatus)
+}
+
+// WriteStatus atomically writes status to dir/status and records it in the
+// job.json manifest. It uses a temp file and os.Rename to guarantee atomicity.
+// The status file holds the value and a newline, so a read cut short is
+// never a known status (see StableStatus).
+// Every change after the initial status emits a status_changed event.
+// It holds the job's status lock; unlike TransitionStatus it does not check
+// the state machine.
+func WriteStatus(dir string, status Status) error {
+	return slot.WithFileLock(filepath.Join(dir, statusLockFile), func() error {
+		return writeStatusLocked(dir, status)
+	})
+}
+
+// writeStatusLocked is WriteStatus for callers already holding the status
+// lock.
+func writeStatusLocked(dir string, status Status) error {
+	from := ""
+	if events.Enabled() {
+		from = string(currentStatus(dir))
+	}
+	if err := AtomicWrite(filepath.Join(dir, "status"), []byte(status+"\n")); err != nil {
+		return err
+	}
+	if err := updateManifest(dir, func(m *Manifest) { m.Status = status }); err != nil {
+		return err
+	}
+	if from != "" {
+		EmitEvent(dir, events.StatusChanged, func(e *events.Event) {
+			e.From = from
+			e.Status = string(status)
+		})
+	}
+	return nil
 }
 
 // StatusTransition validates and performs a status transition on j.
-// It returns an error if the transition is not permitted by the state machine.
+// It returns an error wrapping ErrInvalidTransition if the transition is not
+// permitted by the state machine.
 func (j *Job) StatusTransition(newStatus Status) error {
-	current := ReadStatus(j.Dir)
-	allowed := allowedTransitions[current]
-	for _, a := range allowed {
-		if a == newStatus {
-			return j.SetStatus(newStatus)
+	return TransitionStatus(j.Dir, newStatus)
+}
+
+// TransitionStatus moves the job in dir to newStatus if the state machine
+// allows it. The read-validate-write sequence runs under an exclusive lock on
+// dir/.status.lock, so concurrent writers (e.g. kill racing the completion
+// writer) cannot overwrite a terminal status.
+func TransitionStatus(dir string, newStatus Status) error {
+	return slot.WithFileLock(filepath.Join(dir, statusLockFile), func() error {
+		current := ReadStatus(dir)
+		if !CanTransition(current, newStatus) {
+			return fmt.Errorf("%w %s -> %s", ErrInvalidTransition, current, newStatus)
+		}
+		return writeStatusLocked(dir, newStatus)
+	})
+}
+
+// ClaimSlot moves the queued job in dir to "running", which is what takes
+// its slot: running jobs count against max_parallel. It emits slot_claimed
+// after the transition; an error means the job was no longer queued (e.g.
+// killed) and holds no slot.
+func ClaimSlot(dir string) error {
+	if err := TransitionStatus(dir, StatusRunning); err != nil {
+		return err
+	}
+	EmitEvent(dir, events.SlotClaimed, nil)
+	return nil
+}
+
+// LeaveRunning moves the job in dir from "running" to newStatus under the
+// same lock as TransitionStatus and reports whether it did. A job that is no
+// longer running is left alone, so when kill and reconciliation race to end
+// a job only one of them sees true and releases its slot (ReleaseJobSlot).
+func LeaveRunning(dir string, newStatus Status) (bool, error) {
+	left := false
+	err := slot.WithFileLock(filepath.Join(dir, statusLockFile), func() error {
+		if ReadStatus(dir) != StatusRunning {
+			return nil
+		}
+		if err := writeStatusLocked(dir, newStatus); err != nil {
+			return err
+		}
+		left = true
+		return nil
+	})
+	return left, err
+}
+
+// CanTransition reports whether the state machine allows from -> to.
+func CanTransition(from, to Status) bool {
+	for _, a := range allowedTransitions[from] {
+		if a == to {
+			return true
 		}
 	}
-	return fmt.Errorf("invalid transition %s -> %s", current, newStatus)
+	return false
 }
 
 // AtomicWrite writes data to path using a write-then-rename strategy so that
-// readers never observe a partial write.  The temporary file is placed at
-// path + ".tmp." + pid.
+// readers never observe a partial write, and so that the new content survives
+// a power loss once AtomicWrite returns: the temporary file is fsynced before
+// the rename and the directory after it. The temporary file is created next
+// to path, as path + ".tmp." + a random suffix, and removed on every error.
+//
+// When the rename fails because path is on another filesystem than its
+// directory (path is itself a bind mount), the content is copied into path
+// instead; readers may then see a partial write.
 func AtomicWrite(path string, data []byte) error {
-	tmp := fmt.Sprintf("%s.tmp.%d", path, os.Getpid())
-	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp.*")
+	if err != nil {
+		return fmt.Errorf("atomic write (temp): %w", err)
+	}
+	tmp := f.Name()
+	if err := writeSynced(f, data); err != nil {
+		_ = os.Remove(tmp)
 		return fmt.Errorf("atomic write (temp): %w", err)
 	}
 	if err := os.Rename(tmp, path); err != nil {
 		_ = os.Remove(tmp)
-		return fmt.Errorf("atomic write (rename): %w", err)
+		if !errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("atomic write (rename): %w", err)
+		}
+		if err := copyInPlace(path, data); err != nil {
+			return fmt.Errorf("atomic write (copy): %w", err)
+		}
 	}
+	syncDir(dir)
 	return nil
 }
+
+// AtomicWriteJSON writes v to path as indented JSON followed by a newline,
+// with AtomicWrite.
+func AtomicWriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", filepath.Base(path), err)
+	}
+	return AtomicWrite(path, append(data, '\n'))
+}
+
+// writeSynced writes data to f, makes it readable like os.WriteFile's files,
+// fsyncs and closes it.
+func writeSynced(f *os.File, data []byte) error {
+	_, err := f.Write(data)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copyInPlace overwrites path with data and fsyncs it.
+func copyInPlace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	return writeSynced(f, data)
+}
+
+// syncDir fsyncs dir so that a rename in it is durable. Errors are ignored:
+// some filesystems do not support syncing a directory.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
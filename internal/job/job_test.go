@@ -1,12 +1,14 @@
 package job
 
 import (
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -227,7 +229,7 @@ func TestCreateJobDirectoryWithInitialStatus(t *testing.T) {
 		t.Errorf("expected %s to be a directory", expectedDir)
 	}
 
-	assertFileContains(t, filepath.Join(expectedDir, "status"), "queued")
+	assertFileContains(t, filepath.Join(expectedDir, "status"), "queued\n")
 }
 
 // ---------------------------------------------------------------------------
@@ -244,7 +246,7 @@ func TestTransitionFromQueuedToRunning(t *testing.T) {
 		t.Fatalf("StatusTransition queued->running: %v", err)
 	}
 
-	assertFileContains(t, filepath.Join(dir, "status"), "running")
+	assertFileContains(t, filepath.Join(dir, "status"), "running\n")
 }
 
 // TestTransitionFromRunningToDone covers:
@@ -257,7 +259,7 @@ func TestTransitionFromRunningToDone(t *testing.T) {
 		t.Fatalf("StatusTransition running->done: %v", err)
 	}
 
-	assertFileContains(t, filepath.Join(dir, "status"), "done")
+	assertFileContains(t, filepath.Join(dir, "status"), "done\n")
 }
 
 // TestTransitionFromRunningToFailed covers:
@@ -270,7 +272,7 @@ func TestTransitionFromRunningToFailed(t *testing.T) {
 		t.Fatalf("StatusTransition running->failed: %v", err)
 	}
 
-	assertFileContains(t, filepath.Join(dir, "status"), "failed")
+	assertFileContains(t, filepath.Join(dir, "status"), "failed\n")
 }
 
 // TestTransitionFromRunningToTimeout covers:
@@ -283,7 +285,7 @@ func TestTransitionFromRunningToTimeout(t *testing.T) {
 		t.Fatalf("StatusTransition running->timeout: %v", err)
 	}
 
-	assertFileContains(t, filepath.Join(dir, "status"), "timeout")
+	assertFileContains(t, filepath.Join(dir, "status"), "timeout\n")
 }
 
 // TestTransitionFromRunningToKilled covers:
@@ -296,7 +298,7 @@ func TestTransitionFromRunningToKilled(t *testing.T) {
 		t.Fatalf("StatusTransition running->killed: %v", err)
 	}
 
-	assertFileContains(t, filepath.Join(dir, "status"), "killed")
+	assertFileContains(t, filepath.Join(dir, "status"), "killed\n")
 }
 
 // TestTransitionFromRunningToPermissionError covers:
@@ -309,7 +311,7 @@ func TestTransitionFromRunningToPermissionError(t *testing.T) {
 		t.Fatalf("StatusTransition running->permission_error: %v", err)
 	}
 
-	assertFileContains(t, filepath.Join(dir, "status"), "permission_error")
+	assertFileContains(t, filepath.Join(dir, "status"), "permission_error\n")
 }
 
 // ---------------------------------------------------------------------------
@@ -331,7 +333,7 @@ func TestStatusFileIsWrittenAtomically(t *testing.T) {
 	}
 
 	// The final status file must exist with the correct value.
-	assertFileContains(t, statusPath, "done")
+	assertFileContains(t, statusPath, "done\n")
 
 	// The temporary file must not remain on disk after a successful rename.
 	if _, err := os.Stat(expectedTmp); err == nil {
@@ -339,6 +341,110 @@ func TestStatusFileIsWrittenAtomically(t *testing.T) {
 	}
 }
 
+// tempFiles returns the AtomicWrite temporary files left in dir.
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+// TestAtomicWriteLeavesNoTempFileOnError covers a rename onto a directory and
+// a missing parent directory: both fail without leaving a temporary file.
+func TestAtomicWriteLeavesNoTempFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "status")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "keep"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AtomicWrite(target, []byte("done")); err == nil {
+		t.Error("AtomicWrite onto a non-empty directory succeeded")
+	}
+	if left := tempFiles(t, dir); len(left) != 0 {
+		t.Errorf("temporary files left after a failed rename: %v", left)
+	}
+
+	if err := AtomicWrite(filepath.Join(dir, "missing", "status"), []byte("done")); err == nil {
+		t.Error("AtomicWrite into a missing directory succeeded")
+	}
+	if err := AtomicWriteJSON(filepath.Join(dir, "bad.json"), func() {}); err == nil {
+		t.Error("AtomicWriteJSON of a func succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.json")); !os.IsNotExist(err) {
+		t.Errorf("bad.json exists after a failed encode: %v", err)
+	}
+	if left := tempFiles(t, dir); len(left) != 0 {
+		t.Errorf("temporary files left: %v", left)
+	}
+}
+
+// TestAtomicWriteIsNeverPartiallyVisible rewrites a file from several
+// goroutines while a reader checks that every read sees one whole version.
+func TestAtomicWriteIsNeverPartiallyVisible(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status")
+	versions := []string{strings.Repeat("a", 64<<10), strings.Repeat("b", 64<<10), strings.Repeat("c", 64<<10)}
+	if err := AtomicWrite(path, []byte(versions[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	readerDone := make(chan error, 1)
+	go func() {
+		reads := 0
+		for {
+			select {
+			case <-stop:
+				readerDone <- nil
+				return
+			default:
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				readerDone <- err
+				return
+			}
+			if s := string(data); s != versions[0] && s != versions[1] && s != versions[2] {
+				readerDone <- fmt.Errorf("read %d: partial content (%d bytes)", reads, len(data))
+				return
+			}
+			reads++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 3; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := AtomicWrite(path, []byte(versions[(w+i)%3])); err != nil {
+					t.Errorf("AtomicWrite: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	if err := <-readerDone; err != nil {
+		t.Fatal(err)
+	}
+	if left := tempFiles(t, dir); len(left) != 0 {
+		t.Errorf("temporary files left: %v", left)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+}
+
 // ---------------------------------------------------------------------------
 // AC6: Job artifacts
 // ---------------------------------------------------------------------------
@@ -494,6 +600,54 @@ func TestFindJobAcrossAllProjectDirectories(t *testing.T) {
 	}
 }
 
+// TestFindJobAmbiguousPrefersCurrentProject covers:
+//   Scenario: The same job ID in two projects resolves to the current one with a warning
+func TestFindJobAmbiguousPrefersCurrentProject(t *testing.T) {
+	root := t.TempDir()
+	currentProject := "my-express-app-1234567890"
+	otherProject := "other-project-9876543210"
+	jobID := "job-20260227-143205-a8f3b1c2"
+
+	currentDir := filepath.Join(root, currentProject, jobID)
+	otherDir := filepath.Join(root, otherProject, jobID)
+	for _, dir := range []string{currentDir, otherDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	var warn strings.Builder
+	prev := WarnOutput
+	WarnOutput = &warn
+	defer func() { WarnOutput = prev }()
+
+	got, err := FindJobDir(root, currentProject, jobID)
+	if err != nil {
+		t.Fatalf("FindJobDir: %v", err)
+	}
+	if got != currentDir {
+		t.Errorf("FindJobDir = %q, want %q", got, currentDir)
+	}
+	if !strings.Contains(warn.String(), "warning: job "+jobID) || !strings.Contains(warn.String(), otherDir) {
+		t.Errorf("expected ambiguity warning naming %q, got %q", otherDir, warn.String())
+	}
+
+	// A job that exists only once resolves silently.
+	warn.Reset()
+	if _, err := FindJobDir(root, otherProject, "job-20260227-143205-00000000"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := os.RemoveAll(currentDir); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if _, err := FindJobDir(root, currentProject, jobID); err != nil {
+		t.Fatalf("FindJobDir: %v", err)
+	}
+	if warn.Len() != 0 {
+		t.Errorf("unexpected warning for a unique job: %q", warn.String())
+	}
+}
+
 // TestJobNotFoundReturnsError covers:
 //   Scenario: Job not found returns error
 func TestJobNotFoundReturnsError(t *testing.T) {
@@ -574,6 +728,56 @@ func TestStatusFileContainsUnexpectedValue(t *testing.T) {
 	}
 }
 
+// stubStatusReads makes readRawStatus return reads one after the other,
+// repeating the last, without pauses between retries. It returns the number
+// of reads made so far.
+func stubStatusReads(t *testing.T, reads ...Status) *int {
+	t.Helper()
+	n := 0
+	prevRead, prevDelays, prevWarn := readRawStatus, statusRetryDelays, WarnOutput
+	readRawStatus = func(string) Status {
+		s := reads[min(n, len(reads)-1)]
+		n++
+		return s
+	}
+	statusRetryDelays = []time.Duration{0, 0}
+	WarnOutput = &strings.Builder{}
+	t.Cleanup(func() { readRawStatus, statusRetryDelays, WarnOutput = prevRead, prevDelays, prevWarn })
+	return &n
+}
+
+// TestReadStatusRetriesPartialReads covers:
+//
+//	Scenario: An empty or cut-short status read of a live job is read again
+//	Scenario: A job whose process is gone is not read again
+func TestReadStatusRetriesPartialReads(t *testing.T) {
+	dir := t.TempDir()
+	if err := WritePID(dir, os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+
+	reads := stubStatusReads(t, "", "runn", StatusRunning)
+	if got := ReadStatus(dir); got != StatusRunning || *reads != 3 {
+		t.Errorf("ReadStatus = %q after %d reads, want running after 3", got, *reads)
+	}
+	reads = stubStatusReads(t, "", StatusRunning)
+	if got, err := CheckJobPID(dir); got != "running" || err != nil || *reads != 2 {
+		t.Errorf("CheckJobPID = %q, %v after %d reads, want running after 2", got, err, *reads)
+	}
+	reads = stubStatusReads(t, "")
+	if got := ReadStatus(dir); got != StatusFailed || *reads != 3 {
+		t.Errorf("ReadStatus of a lasting empty read = %q after %d reads, want failed after 3", got, *reads)
+	}
+
+	if err := WritePID(dir, deadPID()); err != nil {
+		t.Fatal(err)
+	}
+	reads = stubStatusReads(t, "", StatusRunning)
+	if got := ReadStatus(dir); got != StatusFailed || *reads != 1 {
+		t.Errorf("ReadStatus of a dead job = %q after %d reads, want failed after 1", got, *reads)
+	}
+}
+
 // TestNewJobsAlwaysUseProjectScopedDirectories covers:
 //   Scenario: New jobs always use project-scoped directories
 func TestNewJobsAlwaysUseProjectScopedDirectories(t *testing.T) {
@@ -601,3 +805,241 @@ func TestNewJobsAlwaysUseProjectScopedDirectories(t *testing.T) {
 		t.Errorf("job was created at flat path %s — must be project-scoped", flatDir)
 	}
 }
+
+// TestConcurrentNewJobsLoseNoStatusFiles covers:
+//
+//	Scenario: 20 jobs created at once each get an intact queued status
+func TestConcurrentNewJobsLoseNoStatusFiles(t *testing.T) {
+	root := t.TempDir()
+	const n = 20
+
+	ids := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		ids[i] = fmt.Sprintf("job-20260227-143205-%08x", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = NewJob(root, "proj", ids[i])
+		}()
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		if errs[i] != nil {
+			t.Errorf("NewJob(%s): %v", id, errs[i])
+			continue
+		}
+		dir := filepath.Join(root, "proj", id)
+		data, err := os.ReadFile(filepath.Join(dir, "status"))
+		if err != nil {
+			t.Errorf("%s: status file lost: %v", id, err)
+			continue
+		}
+		if string(data) != string(StatusQueued)+"\n" {
+			t.Errorf("%s: status = %q, want queued", id, data)
+		}
+		m, err := ReadManifest(dir)
+		if err != nil {
+			t.Errorf("%s: manifest unreadable: %v", id, err)
+			continue
+		}
+		if m.ID != id || m.Status != StatusQueued || m.CreatedAt == "" {
+			t.Errorf("%s: corrupted manifest %+v", id, m)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "proj"))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	// Besides the job dirs the project holds index.json and its lock file.
+	dirs := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs++
+		}
+	}
+	if dirs != n {
+		t.Errorf("found %d job dirs, want %d", dirs, n)
+	}
+}
+
+// TestNewJobRetriesTakenID covers:
+//
+//	Scenario: An ID whose directory already exists is drawn again, not merged into
+func TestNewJobRetriesTakenID(t *testing.T) {
+	root := t.TempDir()
+	const forced = "job-20260227-143205-a8f3b1c2"
+	taken := filepath.Join(root, "proj", forced)
+	if err := os.MkdirAll(taken, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := NewJob(root, "proj", forced)
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if j.ID == forced || j.Dir == taken || j.IDRetries != 1 {
+		t.Errorf("NewJob = %+v, want a new ID after 1 retry", j)
+	}
+	if m, err := ReadManifest(j.Dir); err != nil || m.ID != j.ID {
+		t.Errorf("manifest of %s = %+v (%v)", j.Dir, m, err)
+	}
+	if _, err := os.Stat(filepath.Join(taken, "status")); err == nil {
+		t.Errorf("the taken dir was written to")
+	}
+
+	orig := newJobID
+	t.Cleanup(func() { newJobID = orig })
+	newJobID = func() string { return forced }
+	_, err = NewJob(root, "proj", forced)
+	var collision *IDCollisionError
+	if !errors.As(err, &collision) || collision.Attempts != maxIDAttempts {
+		t.Errorf("NewJob with every ID taken = %v, want *IDCollisionError after %d attempts", err, maxIDAttempts)
+	}
+}
+
+// TestNewJobParallelNoCollisions covers:
+//
+//	Scenario: 500 jobs created in parallel within the same seconds get 500 distinct dirs
+func TestNewJobParallelNoCollisions(t *testing.T) {
+	root := t.TempDir()
+	const n, workers = 500, 10
+
+	// A few workers keep the root lock busy without each of 500 goroutines
+	// polling it.
+	jobs := make([]*Job, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				jobs[i], errs[i] = NewJob(root, "proj", GenerateJobID())
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i, j := range jobs {
+		if errs[i] != nil {
+			t.Fatalf("NewJob: %v", errs[i])
+		}
+		if seen[j.Dir] {
+			t.Errorf("two jobs share %s", j.Dir)
+		}
+		seen[j.Dir] = true
+		if m, err := ReadManifest(j.Dir); err != nil || m.ID != j.ID {
+			t.Errorf("%s: manifest %+v (%v)", j.ID, m, err)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Transition validation under concurrency
+// ---------------------------------------------------------------------------
+
+// TestTerminalStatusesAreAbsorbing covers:
+//
+//	Scenario: A terminal status can never be overwritten
+func TestTerminalStatusesAreAbsorbing(t *testing.T) {
+	for _, terminal := range []Status{StatusDone, StatusFailed, StatusTimeout, StatusKilled, StatusPermissionError} {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "status"), string(terminal))
+
+		err := TransitionStatus(dir, StatusDone)
+		if !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%s -> done: got %v, want ErrInvalidTransition", terminal, err)
+		}
+		if got := ReadStatus(dir); got != terminal {
+			t.Errorf("%s was overwritten with %s", terminal, got)
+		}
+	}
+}
+
+// TestKillAndCompletionRaceNeverOverwritesTerminalStatus covers:
+//
+//	Scenario: kill and the completion writer race; exactly one wins
+func TestKillAndCompletionRaceNeverOverwritesTerminalStatus(t *testing.T) {
+	for i := 0; i < 25; i++ {
+		j, err := NewJob(t.TempDir(), "proj", fmt.Sprintf("job-20260227-143205-%08x", i))
+		if err != nil {
+			t.Fatalf("NewJob: %v", err)
+		}
+		if err := j.StatusTransition(StatusRunning); err != nil {
+			t.Fatalf("queued -> running: %v", err)
+		}
+
+		targets := []Status{StatusKilled, StatusDone}
+		errs := make([]error, len(targets))
+		var wg sync.WaitGroup
+		for k, target := range targets {
+			wg.Add(1)
+			go func(k int, target Status) {
+				defer wg.Done()
+				errs[k] = j.StatusTransition(target)
+			}(k, target)
+		}
+		wg.Wait()
+
+		var winner Status
+		wins := 0
+		for k, err := range errs {
+			switch {
+			case err == nil:
+				winner = targets[k]
+				wins++
+			case !errors.Is(err, ErrInvalidTransition):
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if wins != 1 {
+			t.Fatalf("iteration %d: %d transitions succeeded, want exactly 1 (%v)", i, wins, errs)
+		}
+		if got := ReadStatus(j.Dir); got != winner {
+			t.Errorf("iteration %d: status = %s, want winner %s", i, got, winner)
+		}
+		if m, _ := ReadManifest(j.Dir); m == nil || m.Status != winner {
+			t.Errorf("iteration %d: manifest disagrees with winner %s", i, winner)
+		}
+	}
+}
+
+// TestCanonicalDir covers:
+//
+//	Scenario: a relative path and a symlink resolve to the same absolute directory, and so to the same project ID
+//	Scenario: a missing path is returned absolute with an error
+func TestCanonicalDir(t *testing.T) {
+	real, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(real, "app")
+	link := filepath.Join(real, "app-link")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(project, link); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(real)
+
+	for _, dir := range []string{"app", "./app/", project, link} {
+		got, err := CanonicalDir(dir)
+		if err != nil || got != project {
+			t.Errorf("CanonicalDir(%q) = %q, %v; want %q", dir, got, err, project)
+		}
+		if ResolveProjectID(got) != ResolveProjectID(project) {
+			t.Errorf("project ID of %q differs from %q's", dir, project)
+		}
+	}
+
+	got, err := CanonicalDir("missing")
+	if err == nil || got != filepath.Join(real, "missing") {
+		t.Errorf("CanonicalDir(missing) = %q, %v; want the absolute path and an error", got, err)
+	}
+}
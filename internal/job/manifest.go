@@ -0,0 +1,370 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/slot"
+)
+
+// ManifestFile is the name of the machine-readable job manifest written
+// alongside the legacy per-field .txt files.
+const ManifestFile = "job.json"
+
+// Models records the model assigned to each Claude slot.
+type Models struct {
+	Opus   string `json:"opus,omitempty"`
+	Sonnet string `json:"sonnet,omitempty"`
+	Haiku  string `json:"haiku,omitempty"`
+}
+
+// Manifest is the single-file description of a job stored as job.json.
+// Timestamps are RFC3339 strings, empty when the event has not happened yet.
+type Manifest struct {
+	ID             string `json:"id"`
+	ProjectID      string `json:"project_id"`
+	Status         Status `json:"status"`
+	PID            int    `json:"pid,omitempty"`
+	Prompt         string `json:"prompt,omitempty"`
+	WorkDir        string `json:"workdir,omitempty"`
+	Models         Models `json:"models"`
+	PermissionMode string `json:"permission_mode,omitempty"`
+	CreatedAt      string `json:"created_at,omitempty"`
+	StartedAt      string `json:"started_at,omitempty"`
+	FinishedAt     string `json:"finished_at,omitempty"`
+	ExitCode       *int   `json:"exit_code,omitempty"`
+	TimeoutSecs    int    `json:"timeout_seconds,omitempty"`
+	ChainID        string `json:"chain_id,omitempty"`
+	ChainStep      int    `json:"chain_step,omitempty"`
+	ChainTotal     int    `json:"chain_total,omitempty"`
+	CaptureDiff    bool   `json:"capture_diff,omitempty"`
+	StrictResult   bool   `json:"strict_result,omitempty"`
+	BaseURL        string `json:"base_url,omitempty"`
+	// Deadline is when the job's timeout runs out: started_at plus the
+	// timeout. Reconciliation terminates a job still running past it, so the
+	// timeout holds even when the process supervising claude died.
+	Deadline string `json:"deadline,omitempty"`
+	// ClaudePID is the claude process of the job, which runs in a process
+	// group of its own; PID is the glm process supervising it.
+	ClaudePID int `json:"claude_pid,omitempty"`
+	// Confine is the confine_mode (warn or strict) of a job confined to its
+	// workdir with --confine or confine_to_workdir; empty otherwise.
+	Confine string `json:"confine,omitempty"`
+	// ClaudeVersion is the claude CLI version the job ran with, when known.
+	ClaudeVersion string `json:"claude_version,omitempty"`
+	// SessionID is the claude session the job ran in, for "claude --resume";
+	// empty until the output is parsed, or when claude did not report one.
+	SessionID string `json:"session_id,omitempty"`
+	// Git is the state of the working directory's repository when the job
+	// started; nil when the workdir is not a git repository.
+	Git *GitContext `json:"git,omitempty"`
+	// RetriedFrom is the job this one re-runs, and RetriedBy the job that
+	// re-ran this one; see LinkRetry.
+	RetriedFrom string `json:"retried_from,omitempty"`
+	RetriedBy   string `json:"retried_by,omitempty"`
+	// Priority orders the job for a free slot while it is queued; empty is
+	// normal.
+	Priority Priority `json:"priority,omitempty"`
+	// Notify is the shell command run once the job has finished (--notify
+	// or on_complete_cmd); see NotifyLogFile in package cmd.
+	Notify string `json:"notify,omitempty"`
+	// Template is the --template the prompt was rendered from; empty for a
+	// prompt given as is.
+	Template string `json:"template,omitempty"`
+	// ChainInjected is set for a chain step whose prompt has the previous
+	// step's output injected before it (see BuildChainPrompt in package
+	// cmd).
+	ChainInjected bool `json:"chain_injected,omitempty"`
+	// Depth is how deeply the job is nested: 1 for a job started outside
+	// any glm job, 2 for one started by a job's claude (GLM_DEPTH).
+	Depth int `json:"depth,omitempty"`
+	// Invocation is the glm command that created the job; nil for jobs
+	// created before it was recorded.
+	Invocation *Invocation `json:"invocation,omitempty"`
+}
+
+// Invocation records the glm process that created a job, so a job can be
+// traced back to the version and command line that produced it.
+type Invocation struct {
+	// GLMVersion is the version of the glm binary.
+	GLMVersion string `json:"glm_version"`
+	// Args is the command line, os.Args, with the prompts replaced by their
+	// SHA-256 and length when prompts are redacted.
+	Args []string `json:"args"`
+	// ConfigSources names where the config came from: the config and
+	// subagent directories, the API key's source and each model slot's
+	// setting.
+	ConfigSources map[string]string `json:"config_sources,omitempty"`
+	Hostname      string            `json:"hostname,omitempty"`
+}
+
+// GitContext records the git state a job started from.
+type GitContext struct {
+	// Head is the short SHA of HEAD.
+	Head string `json:"head"`
+	// Branch is the checked-out branch, empty for a detached HEAD.
+	Branch string `json:"branch,omitempty"`
+	// Dirty is true when the worktree had uncommitted or untracked changes.
+	Dirty bool `json:"dirty"`
+}
+
+// ChainFile is the legacy-style file recording a job's position in a chain.
+// It holds "chain_id=...", "step=N" and "total=M" lines.
+const ChainFile = "chain.txt"
+
+// ReadManifest reads and decodes dir/job.json. It returns an error when the
+// manifest is missing or malformed; use LoadManifest to fall back to the
+// legacy files.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", ManifestFile, err)
+	}
+	return &m, nil
+}
+
+// WriteManifest atomically writes m to dir/job.json and updates the job's
+// entry in its project's index.json. The index is only a cache that list
+// rebuilds when needed, so failing to update it is not an error.
+func WriteManifest(dir string, m *Manifest) error {
+	if err := AtomicWriteJSON(filepath.Join(dir, ManifestFile), m); err != nil {
+		return err
+	}
+	_ = updateIndex(dir, m)
+	return nil
+}
+
+// LoadManifest returns the job's manifest, reading job.json first and falling
+// back to the legacy per-field files for job directories written by older
+// versions. Fields the manifest leaves empty are also filled from the legacy
+// files, and the legacy status file wins when it was written after job.json.
+// It never returns nil.
+func LoadManifest(dir string) *Manifest {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		m = &Manifest{ID: filepath.Base(dir)}
+	}
+	fillFromLegacy(dir, m)
+	return m
+}
+
+// UpdateManifest loads the manifest (migrating legacy files if job.json does
+// not exist yet), applies fn, and writes it back atomically. It holds the
+// job's status lock like TransitionStatus, so an update racing a status
+// change never writes back the status it read before that change.
+func UpdateManifest(dir string, fn func(m *Manifest)) error {
+	return slot.WithFileLock(filepath.Join(dir, statusLockFile), func() error {
+		return updateManifest(dir, fn)
+	})
+}
+
+// updateManifest is UpdateManifest for callers already holding the status
+// lock.
+func updateManifest(dir string, fn func(m *Manifest)) error {
+	m := LoadManifest(dir)
+	fn(m)
+	return WriteManifest(dir, m)
+}
+
+// fillFromLegacy populates empty manifest fields from the legacy .txt files.
+func fillFromLegacy(dir string, m *Manifest) {
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	if s, ok := legacyStatus(dir, m.Status != ""); ok {
+		m.Status = s
+	}
+	if m.PID == 0 {
+		m.PID, _ = strconv.Atoi(read("pid.txt"))
+	}
+	if m.Prompt == "" {
+		m.Prompt = read("prompt.txt")
+	}
+	if m.WorkDir == "" {
+		m.WorkDir = read("workdir.txt")
+	}
+	if m.PermissionMode == "" {
+		m.PermissionMode = read("permission_mode.txt")
+	}
+	if m.Models == (Models{}) {
+		m.Models = parseLegacyModels(read("model.txt"))
+	}
+	if m.CreatedAt == "" {
+		m.CreatedAt = read("created_at.txt")
+	}
+	// The oldest job directories name the timestamp files without .txt.
+	if m.StartedAt == "" {
+		if m.StartedAt = read("started_at.txt"); m.StartedAt == "" {
+			m.StartedAt = read("started_at")
+		}
+	}
+	if m.FinishedAt == "" {
+		if m.FinishedAt = read("finished_at.txt"); m.FinishedAt == "" {
+			m.FinishedAt = read("finished_at")
+		}
+	}
+	if m.ExitCode == nil {
+		if ec, err := strconv.Atoi(read("exit_code.txt")); err == nil {
+			m.ExitCode = &ec
+		}
+	}
+	if m.ClaudeVersion == "" {
+		m.ClaudeVersion = read("claude_version.txt")
+	}
+	if m.SessionID == "" {
+		m.SessionID = read("session_id.txt")
+	}
+	if m.ChainID == "" {
+		m.ChainID, m.ChainStep, m.ChainTotal = parseChainFile(read(ChainFile))
+	}
+	if m.RetriedFrom == "" {
+		m.RetriedFrom = read(RetriedFromFile)
+	}
+	if m.RetriedBy == "" {
+		m.RetriedBy = read(RetriedByFile)
+	}
+}
+
+// parseChainFile parses the key=value lines of chain.txt.
+func parseChainFile(s string) (chainID string, step, total int) {
+	for _, line := range strings.Split(s, "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "chain_id":
+			chainID = v
+		case "step":
+			step, _ = strconv.Atoi(v)
+		case "total":
+			total, _ = strconv.Atoi(v)
+		}
+	}
+	return chainID, step, total
+}
+
+// WriteChainInfo records that the job in dir is step (1-based) of total in
+// chain chainID, both in chain.txt and in the manifest.
+func WriteChainInfo(dir, chainID string, step, total int) error {
+	content := fmt.Sprintf("chain_id=%s\nstep=%d\ntotal=%d\n", chainID, step, total)
+	if err := AtomicWrite(filepath.Join(dir, ChainFile), []byte(content)); err != nil {
+		return err
+	}
+	return UpdateManifest(dir, func(m *Manifest) {
+		m.ChainID = chainID
+		m.ChainStep = step
+		m.ChainTotal = total
+	})
+}
+
+// currentStatus returns the raw status recorded for dir (manifest first, then
+// the legacy status file), or "" when neither exists.
+func currentStatus(dir string) Status {
+	var s Status
+	if m, err := ReadManifest(dir); err == nil {
+		s = m.Status
+	}
+	if legacy, ok := legacyStatus(dir, s != ""); ok {
+		s = legacy
+	}
+	return s
+}
+
+// legacyStatus returns the content of the legacy status file when it should
+// take precedence: always when the manifest has no status, otherwise only if
+// the status file is at least as new as job.json (a writer that predates the
+// manifest updated it last).
+func legacyStatus(dir string, haveManifestStatus bool) (Status, bool) {
+	statusPath := filepath.Join(dir, "status")
+	data, err := os.ReadFile(statusPath)
+	if err != nil {
+		return "", false
+	}
+	if haveManifestStatus {
+		sInfo, sErr := os.Stat(statusPath)
+		mInfo, mErr := os.Stat(filepath.Join(dir, ManifestFile))
+		if sErr == nil && mErr == nil && mInfo.ModTime().After(sInfo.ModTime()) {
+			return "", false
+		}
+	}
+	return Status(strings.TrimSpace(string(data))), true
+}
+
+// parseLegacyModels parses the "opus=X sonnet=Y haiku=Z" format of model.txt.
+func parseLegacyModels(s string) Models {
+	var m Models
+	for _, field := range strings.Fields(s) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "opus":
+			m.Opus = v
+		case "sonnet":
+			m.Sonnet = v
+		case "haiku":
+			m.Haiku = v
+		}
+	}
+	return m
+}
+
+// WritePID records pid in pid.txt and in the manifest.
+func WritePID(dir string, pid int) error {
+	if err := os.WriteFile(filepath.Join(dir, "pid.txt"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		return err
+	}
+	return UpdateManifest(dir, func(m *Manifest) { m.PID = pid })
+}
+
+// nowRFC3339 returns the current UTC time formatted for manifest timestamps.
+func nowRFC3339() string {
+	return FormatTimestamp(time.Now())
+}
+
+// FormatTimestamp formats t as stored in job artifacts: RFC3339 in UTC, so
+// jobs created on machines in different timezones compare as plain text.
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// legacyTimestampLayouts are accepted by ParseTimestamp besides RFC3339; they
+// were written by older versions (date +%FT%T%z).
+var legacyTimestampLayouts = []string{
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+}
+
+// ParseTimestamp parses a timestamp from a job artifact. Whatever offset it
+// carries is honoured, so the result is the same instant for UTC and
+// local-offset files; compare and subtract the returned times rather than the
+// strings.
+func ParseTimestamp(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	t, err := time.Parse(time.RFC3339, raw)
+	if err == nil {
+		return t, nil
+	}
+	for _, layout := range legacyTimestampLayouts {
+		if lt, lerr := time.Parse(layout, raw); lerr == nil {
+			return lt, nil
+		}
+	}
+	return time.Time{}, err
+}
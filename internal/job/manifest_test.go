@@ -0,0 +1,188 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestNewJobWritesManifest covers:
+//
+//	Scenario: New jobs get a job.json manifest alongside the status file
+func TestNewJobWritesManifest(t *testing.T) {
+	root := t.TempDir()
+	j, err := NewJob(root, "proj-1", "job-20260227-143205-a8f3b1c2")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+
+	m, err := ReadManifest(j.Dir)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if m.ID != j.ID || m.ProjectID != "proj-1" {
+		t.Errorf("manifest id/project = %q/%q, want %q/%q", m.ID, m.ProjectID, j.ID, "proj-1")
+	}
+	if m.Status != StatusQueued {
+		t.Errorf("manifest status = %q, want queued", m.Status)
+	}
+	if _, err := time.Parse(time.RFC3339, m.CreatedAt); err != nil {
+		t.Errorf("manifest created_at %q is not RFC3339: %v", m.CreatedAt, err)
+	}
+	assertFileContains(t, filepath.Join(j.Dir, "status"), "queued\n")
+}
+
+// TestStatusTransitionUpdatesManifest covers:
+//
+//	Scenario: Every lifecycle transition is recorded in job.json
+func TestStatusTransitionUpdatesManifest(t *testing.T) {
+	j, err := NewJob(t.TempDir(), "proj-1", "job-20260227-143205-a8f3b1c2")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := WritePID(j.Dir, 4242); err != nil {
+		t.Fatalf("WritePID: %v", err)
+	}
+	for _, s := range []Status{StatusRunning, StatusDone} {
+		if err := j.StatusTransition(s); err != nil {
+			t.Fatalf("StatusTransition(%s): %v", s, err)
+		}
+		m, err := ReadManifest(j.Dir)
+		if err != nil {
+			t.Fatalf("ReadManifest: %v", err)
+		}
+		if m.Status != s {
+			t.Errorf("manifest status = %q, want %q", m.Status, s)
+		}
+		if m.PID != 4242 {
+			t.Errorf("manifest pid = %d, want 4242", m.PID)
+		}
+	}
+	assertFileContains(t, filepath.Join(j.Dir, "pid.txt"), "4242")
+}
+
+// TestUpdateManifestKeepsConcurrentStatus covers:
+//
+//	Scenario: A manifest update racing kill does not write back "running"
+func TestUpdateManifestKeepsConcurrentStatus(t *testing.T) {
+	j, err := NewJob(t.TempDir(), "proj-1", "job-20260227-143205-a8f3b1c2")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := j.StatusTransition(StatusRunning); err != nil {
+		t.Fatalf("StatusTransition(running): %v", err)
+	}
+
+	inside := make(chan struct{})
+	killed := make(chan error, 1)
+	go func() {
+		<-inside
+		killed <- TransitionStatus(j.Dir, StatusKilled)
+	}()
+	err = UpdateManifest(j.Dir, func(m *Manifest) {
+		close(inside)
+		// Give the transition time to run if it is not held off by the lock.
+		time.Sleep(100 * time.Millisecond)
+		m.ClaudePID = 4242
+	})
+	if err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+	if err := <-killed; err != nil {
+		t.Fatalf("TransitionStatus(killed): %v", err)
+	}
+
+	m, err := ReadManifest(j.Dir)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if m.Status != StatusKilled || m.ClaudePID != 4242 {
+		t.Errorf("manifest status/claude_pid = %q/%d, want killed/4242", m.Status, m.ClaudePID)
+	}
+	if got := ReadStatus(j.Dir); got != StatusKilled {
+		t.Errorf("ReadStatus = %q, want killed", got)
+	}
+}
+
+// TestLoadManifestMigratesLegacyJobDir covers:
+//
+//	Scenario: Old-format job directories without job.json are still readable
+func TestLoadManifestMigratesLegacyJobDir(t *testing.T) {
+	dir := copySeedDir(t, "job_running")
+
+	m := LoadManifest(dir)
+	if m.ID != "job_running" {
+		t.Errorf("ID = %q, want directory name", m.ID)
+	}
+	if m.Status != StatusRunning {
+		t.Errorf("Status = %q, want running", m.Status)
+	}
+	if m.PID != 51203 {
+		t.Errorf("PID = %d, want 51203", m.PID)
+	}
+	if m.StartedAt != "2026-02-27T15:10:22+03:00" {
+		t.Errorf("StartedAt = %q", m.StartedAt)
+	}
+	if m.Prompt == "" {
+		t.Error("Prompt should be read from prompt.txt")
+	}
+
+	// Updating a legacy job writes a complete manifest.
+	if err := UpdateManifest(dir, func(m *Manifest) { m.TimeoutSecs = 600 }); err != nil {
+		t.Fatalf("UpdateManifest: %v", err)
+	}
+	written, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest after migration: %v", err)
+	}
+	if written.PID != 51203 || written.Status != StatusRunning || written.TimeoutSecs != 600 {
+		t.Errorf("migrated manifest = %+v", written)
+	}
+}
+
+// TestLegacyModelFileIsParsed covers:
+//
+//	Scenario: model.txt "opus=X sonnet=Y haiku=Z" maps to manifest models
+func TestLegacyModelFileIsParsed(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "model.txt"), "opus=glm-4.7 sonnet=glm-4.5 haiku=glm-4")
+
+	got := LoadManifest(dir).Models
+	want := Models{Opus: "glm-4.7", Sonnet: "glm-4.5", Haiku: "glm-4"}
+	if got != want {
+		t.Errorf("Models = %+v, want %+v", got, want)
+	}
+}
+
+// TestReadStatusPrefersManifest covers:
+//
+//	Scenario: ReadStatus reads job.json when the legacy status file is gone
+func TestReadStatusPrefersManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteManifest(dir, &Manifest{ID: "job-x", Status: StatusDone}); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	if got := ReadStatus(dir); got != StatusDone {
+		t.Errorf("ReadStatus = %q, want done", got)
+	}
+}
+
+// TestReadStatusNewerLegacyFileWins covers:
+//
+//	Scenario: A status file written after job.json by an old writer is honoured
+func TestReadStatusNewerLegacyFileWins(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteManifest(dir, &Manifest{ID: "job-x", Status: StatusRunning}); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, ManifestFile), old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "status"), "killed")
+
+	if got := ReadStatus(dir); got != StatusKilled {
+		t.Errorf("ReadStatus = %q, want killed", got)
+	}
+}
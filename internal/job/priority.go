@@ -0,0 +1,59 @@
+package job
+
+import (
+	"strings"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
+)
+
+// Priority orders queued jobs for free slots (--priority); the empty
+// Priority is PriorityNormal.
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// priorityRanks maps each Priority to its rank; higher ranks get a slot first.
+var priorityRanks = map[Priority]int{
+	PriorityLow:    0,
+	PriorityNormal: 1,
+	PriorityHigh:   2,
+}
+
+// ParsePriority returns the Priority named s (low, normal or high, ignoring
+// case). It returns err:user for any other value.
+func ParsePriority(s string) (Priority, error) {
+	p := Priority(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := priorityRanks[p]; !ok {
+		return "", errs.User(`"Invalid priority: %s (must be one of: low, normal, high)"`, s)
+	}
+	return p, nil
+}
+
+// Rank returns p's rank: 0 for low, 1 for normal (and the empty Priority),
+// 2 for high.
+func (p Priority) Rank() int {
+	if r, ok := priorityRanks[p]; ok {
+		return r
+	}
+	return priorityRanks[PriorityNormal]
+}
+
+// EffectiveRank returns the rank a job of priority p created at created has
+// at now: its Rank raised by one for every full aging interval it has waited,
+// up to the rank of high, so a low priority job is not starved by a stream
+// of higher ones. aging <= 0 turns the raise off.
+func EffectiveRank(p Priority, created, now time.Time, aging time.Duration) int {
+	rank := p.Rank()
+	if aging > 0 && !created.IsZero() && now.After(created) {
+		rank += int(now.Sub(created) / aging)
+	}
+	if highest := PriorityHigh.Rank(); rank > highest {
+		rank = highest
+	}
+	return rank
+}
@@ -0,0 +1,51 @@
+package job
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParsePriority covers:
+//
+//	Scenario: ParsePriority accepts low, normal and high in any case and rejects the rest
+func TestParsePriority(t *testing.T) {
+	for in, want := range map[string]Priority{"low": PriorityLow, "Normal": PriorityNormal, " HIGH ": PriorityHigh} {
+		if got, err := ParsePriority(in); err != nil || got != want {
+			t.Errorf("ParsePriority(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil || !strings.HasPrefix(err.Error(), "err:user") {
+		t.Errorf("ParsePriority(urgent) = %v, want err:user", err)
+	}
+	if Priority("").Rank() != PriorityNormal.Rank() {
+		t.Error("empty priority does not rank as normal")
+	}
+}
+
+// TestEffectiveRank covers:
+//
+//	Scenario: a waiting job gains one rank per full aging interval, up to high
+func TestEffectiveRank(t *testing.T) {
+	created := time.Date(2026, 2, 27, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		p      Priority
+		waited time.Duration
+		aging  time.Duration
+		want   int
+	}{
+		{PriorityLow, 9 * time.Minute, 10 * time.Minute, 0},
+		{PriorityLow, 10 * time.Minute, 10 * time.Minute, 1},
+		{PriorityLow, time.Hour, 10 * time.Minute, 2},
+		{PriorityNormal, time.Hour, 0, 1},
+		{PriorityHigh, time.Hour, time.Minute, 2},
+	}
+	for _, tt := range tests {
+		if got := EffectiveRank(tt.p, created, created.Add(tt.waited), tt.aging); got != tt.want {
+			t.Errorf("EffectiveRank(%s, waited %s, aging %s) = %d, want %d", tt.p, tt.waited, tt.aging, got, tt.want)
+		}
+	}
+	if got := EffectiveRank(PriorityLow, time.Time{}, created, time.Minute); got != 0 {
+		t.Errorf("EffectiveRank without a creation time = %d, want 0", got)
+	}
+}
@@ -9,101 +9,310 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/slot"
 )
 
-// staleRecoveredMarker is written to a job's stderr to distinguish
+// StaleRecoveredMarker is written to a job's stderr to distinguish
 // auto-recovered jobs from manually killed jobs (for glm clean --stale).
-const staleRecoveredMarker = "__stale_recovered__"
+const StaleRecoveredMarker = "__stale_recovered__"
 
 // staleQueueThreshold is the duration after which a queued job is considered stuck.
 const staleQueueThreshold = 5 * time.Minute
 
-// Reconcile scans all job directories under subagentsDir, detects stale jobs
-// (dead PID, missing pid.txt, or stuck in queue), updates their status to
+// deadlineGrace is how long past its deadline a running job is left to end
+// on its own timeout before reconciliation terminates it.
+const deadlineGrace = 30 * time.Second
+
+// startSlack is how long after a job's started_at its claude may have been
+// started. A process that started later took over the PID of one of the
+// job's processes and is not terminated for it.
+const startSlack = time.Minute
+
+// Reconcile scans all job directories under subagentsDir, in both the
+// project-scoped and the legacy flat layout, detects stale jobs
+// (dead PID, missing pid.txt, or a flat job stuck in queue), updates their status to
 // "failed", appends a diagnostic message to stderr.txt, and resets the slot
-// counter file to the number of actually-running jobs.
+// counter file to the number of actually-running jobs. Every per-model
+// counter (.running_count.<model>) is rebuilt the same way from the jobs'
+// execution model (the sonnet slot of model.txt). A running job past its
+// deadline (see Manifest.Deadline) is terminated and marked "timeout" first,
+// whether or not the process supervising it is still alive.
 //
-// Reconcile is intended to be called exactly once at process startup.
+// Reconcile is intended to be called exactly once at process startup. The
+// pass holds the subagent root lock (slot.WithLock) so it never races job
+// creation in another glm process.
 // now is injected so tests can control the clock.
 func Reconcile(subagentsDir string, now time.Time) error {
+	if _, err := os.Stat(subagentsDir); err != nil {
+		return err
+	}
+	return slot.WithLock(subagentsDir, func() error {
+		return reconcile(subagentsDir, now)
+	})
+}
+
+// reconcile is the body of Reconcile, run under the root lock. Jobs are
+// found in both layouts: subagentsDir/<job> (legacy) and
+// subagentsDir/<project>/<job>.
+func reconcile(subagentsDir string, now time.Time) error {
 	entries, err := os.ReadDir(subagentsDir)
 	if err != nil {
 		return err
 	}
 	runningCount := 0
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+	perModel := map[string]int{}
+	visit := func(jobDir string, flat bool) error {
+		running, err := reconcileJob(jobDir, now, flat)
+		if err != nil || !running {
+			return err
 		}
-		jobDir := filepath.Join(subagentsDir, entry.Name())
-		// Skip special files/directories
-		if entry.Name() == ".running_count" || entry.Name() == ".counter.lock" {
+		runningCount++
+		if model := LoadManifest(jobDir).Models.Sonnet; model != "" {
+			perModel[model]++
+		}
+		return nil
+	}
+	for _, entry := range entries {
+		// Skip files and special directories such as lock dirs.
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
-		status := readStatus(jobDir)
-		if status == "running" {
-			pid, err := readPID(jobDir)
-			if err != nil || !pidAlive(pid) {
-				if err := writeStatus(jobDir, "failed"); err != nil {
-					return err
-				}
-				pidStr := strconv.Itoa(pid)
-				if err := appendStderr(jobDir, fmt.Sprintf("[GoLeM] Process died unexpectedly (PID %s)", pidStr)); err != nil {
-					return err
-				}
-				if err := appendStderr(jobDir, staleRecoveredMarker); err != nil {
-					return err
-				}
-			} else {
-				runningCount++
-			}
-		} else if status == "queued" {
-			stale, err := IsStaleQueued(jobDir, now)
-			if err != nil {
+		dir := filepath.Join(subagentsDir, entry.Name())
+		if isJobDir(dir) {
+			if err := visit(dir, true); err != nil {
 				return err
 			}
-			if stale {
-				if err := writeStatus(jobDir, "failed"); err != nil {
-					return err
-				}
-				if err := appendStderr(jobDir, "[GoLeM] Job stuck in queue for over 5 minutes"); err != nil {
-					return err
-				}
-				if err := appendStderr(jobDir, staleRecoveredMarker); err != nil {
+			continue
+		}
+		jobDirs, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, jd := range jobDirs {
+			if jd.IsDir() && !strings.HasPrefix(jd.Name(), ".") {
+				if err := visit(filepath.Join(dir, jd.Name()), false); err != nil {
 					return err
 				}
 			}
 		}
 	}
+	if err := writeModelSlotCounters(subagentsDir, perModel); err != nil {
+		return err
+	}
 	return writeSlotCounter(filepath.Join(subagentsDir, ".running_count"), runningCount)
 }
 
+// writeModelSlotCounters writes counts[model] to each model's counter and
+// resets counters of models with no running job to 0.
+func writeModelSlotCounters(subagentsDir string, counts map[string]int) error {
+	paths := map[string]int{}
+	existing, _ := filepath.Glob(filepath.Join(subagentsDir, slot.CounterFile+".*"))
+	for _, p := range existing {
+		if !strings.Contains(filepath.Base(p), ".tmp.") {
+			paths[p] = 0
+		}
+	}
+	for model, n := range counts {
+		paths[filepath.Join(subagentsDir, slot.ModelCounterFile(model))] = n
+	}
+	for p, n := range paths {
+		if err := writeSlotCounter(p, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isJobDir reports whether dir holds a job (a status file or a manifest)
+// rather than a project's jobs.
+func isJobDir(dir string) bool {
+	for _, name := range []string{"status", ManifestFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileJob is Reconcile's pass over the job at jobDir: an overdue job is
+// terminated and marked "timeout", a running job whose process is gone is
+// marked "failed", and so is a job of the legacy flat layout (flat) stuck in
+// the queue. Project-scoped jobs wait in the queue for as long as the
+// dispatcher (see cmd.DispatchQueued) takes. It reports whether the job is
+// still running and holds a slot.
+func reconcileJob(jobDir string, now time.Time, flat bool) (bool, error) {
+	switch readStatus(jobDir) {
+	case "running":
+		pid, err := readPID(jobDir)
+		if m := LoadManifest(jobDir); pastDeadline(m, now) {
+			_, err := enforceDeadline(jobDir, m, pid)
+			return false, err
+		}
+		if err == nil && pidAlive(pid) {
+			return true, nil
+		}
+		if err := writeStatus(jobDir, "failed"); err != nil {
+			return false, err
+		}
+		pidStr := strconv.Itoa(pid)
+		return false, appendStaleRecovered(jobDir, fmt.Sprintf("Process died unexpectedly (PID %s)", pidStr))
+	case "queued":
+		if !flat {
+			return false, nil
+		}
+		stale, err := IsStaleQueued(jobDir, now)
+		if err != nil || !stale {
+			return false, err
+		}
+		if err := writeStatus(jobDir, "failed"); err != nil {
+			return false, err
+		}
+		return false, appendStaleRecovered(jobDir, "Job stuck in queue for over 5 minutes")
+	}
+	return false, nil
+}
+
 // CheckJobPID reads the pid.txt for the job at jobDir, checks whether the
-// process is alive (via signal 0), and — if dead — updates status to "failed"
-// and appends a stderr message.  It does NOT perform a full reconciliation.
+// process is alive (via signal 0), and — if dead — updates status to "failed",
+// appends a stderr message and releases the job's slot (ReleaseJobSlot).  A
+// job past its deadline is terminated and marked "timeout" the same way (see
+// Reconcile). It does NOT perform a full reconciliation.
 // Returns the current (possibly updated) status string.
 func CheckJobPID(jobDir string) (string, error) {
+	return checkJobPID(jobDir, time.Now())
+}
+
+// checkJobPID is CheckJobPID with the clock injected, as Reconcile has it.
+func checkJobPID(jobDir string, now time.Time) (string, error) {
 	status := readStatus(jobDir)
 	if status != "running" {
 		return status, nil
 	}
 	pid, err := readPID(jobDir)
-	if err != nil || !pidAlive(pid) {
-		if err := writeStatus(jobDir, "failed"); err != nil {
+	if m := LoadManifest(jobDir); pastDeadline(m, now) {
+		left, err := enforceDeadline(jobDir, m, pid)
+		if err != nil {
 			return status, err
 		}
-		pidStr := strconv.Itoa(pid)
-		if err := appendStderr(jobDir, fmt.Sprintf("[GoLeM] Process died unexpectedly (PID %s)", pidStr)); err != nil {
-			return status, err
+		if !left {
+			return readStatus(jobDir), nil
 		}
-		if err := appendStderr(jobDir, staleRecoveredMarker); err != nil {
+		return string(StatusTimeout), ReleaseJobSlot(jobDir)
+	}
+	if err != nil || !pidAlive(pid) {
+		left, err := LeaveRunning(jobDir, StatusFailed)
+		if err != nil {
 			return status, err
 		}
-		return "failed", nil
+		if !left {
+			// The job ended (or was killed) while we looked.
+			return readStatus(jobDir), nil
+		}
+		pidStr := strconv.Itoa(pid)
+		if err := appendStaleRecovered(jobDir, fmt.Sprintf("Process died unexpectedly (PID %s)", pidStr)); err != nil {
+			return "failed", err
+		}
+		return "failed", ReleaseJobSlot(jobDir)
 	}
 	return status, nil
 }
 
+// pastDeadline reports whether the running job of m has a deadline that
+// passed more than deadlineGrace before now.
+func pastDeadline(m *Manifest, now time.Time) bool {
+	deadline, err := ParseTimestamp(m.Deadline)
+	return err == nil && now.Sub(deadline) > deadlineGrace
+}
+
+// enforceDeadline terminates the processes of the running job at jobDir,
+// whose deadline has passed: claude (Manifest.ClaudePID) and the glm process
+// supervising it (pid), each with its process group. A PID is only signalled
+// while it still names the job's process (see ownedBy). It then marks the job
+// "timeout" with the usual timeout message in stderr.txt and reports
+// whether it did (see LeaveRunning); the caller releases the slot.
+func enforceDeadline(jobDir string, m *Manifest, pid int) (bool, error) {
+	for _, p := range []int{m.ClaudePID, pid} {
+		if p > 0 && p != os.Getpid() && pidAlive(p) && ownedBy(p, m) {
+			terminateProcess(p)
+		}
+	}
+	left, err := LeaveRunning(jobDir, StatusTimeout)
+	if err != nil || !left {
+		return left, err
+	}
+	timeout := m.TimeoutSecs
+	if started, err := ParseTimestamp(m.StartedAt); err == nil {
+		if deadline, err := ParseTimestamp(m.Deadline); err == nil {
+			timeout = int(deadline.Sub(started).Seconds())
+		}
+	}
+	return true, AppendStderr(jobDir, fmt.Sprintf("Job exceeded %ds timeout", timeout))
+}
+
+// ownedBy reports whether pid can still be a process of the job of m: it
+// started no later than startSlack after the job's started_at. A PID reused
+// after the job's process died, e.g. after a reboot, started later. When the
+// start time cannot be read (no /proc) the PID is trusted as before.
+func ownedBy(pid int, m *Manifest) bool {
+	started, err := ParseTimestamp(m.StartedAt)
+	if err != nil {
+		return true
+	}
+	procStart, ok := processStartTime(pid)
+	return !ok || !procStart.After(started.Add(startSlack))
+}
+
+// terminateProcess sends SIGKILL to pid's process group when it leads one,
+// and to just pid otherwise, so the shell job a glm run belongs to is left
+// alone. The job already had its SIGTERM when its own timeout fired, so
+// nothing waits here: Reconcile holds the root lock while it runs.
+func terminateProcess(pid int) {
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+		return
+	}
+	_ = syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// ReleaseJobSlot gives back the slot a job held while it was running: it
+// decrements the slot counter of the subagents directory and the counter of
+// the job's execution model (see Reconcile), clamping at 0. Counters that do
+// not exist are left alone. Call it once per job, after LeaveRunning
+// reported true, so a job killed twice is released once.
+func ReleaseJobSlot(jobDir string) error {
+	root := slotRootOf(jobDir)
+	if root == "" {
+		return nil
+	}
+	managers := []*slot.SlotManager{slot.NewSlotManager(root, 0)}
+	if model := LoadManifest(jobDir).Models.Sonnet; model != "" {
+		managers = append(managers, slot.NewModelSlotManager(root, model, 0))
+	}
+	for _, sm := range managers {
+		if _, err := os.Stat(sm.CounterPath()); err != nil {
+			continue
+		}
+		if err := sm.ReleaseSlot(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slotRootOf returns the subagents directory holding jobDir's slot counter:
+// the parent of a legacy job, the grandparent of a project's job. It returns
+// "" when neither has a counter.
+func slotRootOf(jobDir string) string {
+	parent := filepath.Dir(jobDir)
+	for _, dir := range []string{parent, filepath.Dir(parent)} {
+		if _, err := os.Stat(filepath.Join(dir, slot.CounterFile)); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
 // IsStaleQueued reports whether the queued job at jobDir has been waiting
 // longer than staleQueueThreshold relative to now.
 func IsStaleQueued(jobDir string, now time.Time) (bool, error) {
@@ -111,53 +320,57 @@ func IsStaleQueued(jobDir string, now time.Time) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("read created_at.txt: %w", err)
 	}
-	createdAt, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	createdAt, err := ParseTimestamp(string(data))
 	if err != nil {
 		return false, fmt.Errorf("parse created_at.txt: %w", err)
 	}
 	return now.Sub(createdAt) > staleQueueThreshold, nil
 }
 
-// readStatus reads the "status" file inside jobDir and returns its trimmed
-// content.  Missing file returns "failed".
+// readStatus returns the job's status (manifest first, then the legacy
+// status file).  Missing or unrecognised status returns "failed".
 func readStatus(jobDir string) string {
-	data, err := os.ReadFile(filepath.Join(jobDir, "status"))
-	if err != nil {
-		return "failed"
-	}
-	s := strings.TrimSpace(string(data))
-	switch s {
-	case "queued", "running", "done", "failed", "killed", "timeout", "permission_error":
-		return s
-	default:
+	s := StableStatus(jobDir)
+	if !validStatuses[s] {
 		return "failed"
 	}
+	return string(s)
 }
 
-// writeStatus atomically writes status to jobDir/status using a tmp file.
+// writeStatus atomically writes status to jobDir/status and the manifest.
 func writeStatus(jobDir, status string) error {
-	tmp := fmt.Sprintf("%s.tmp.%d", filepath.Join(jobDir, "status"), os.Getpid())
-	if err := os.WriteFile(tmp, []byte(status), 0o644); err != nil {
-		return fmt.Errorf("atomic write (temp): %w", err)
-	}
-	if err := os.Rename(tmp, filepath.Join(jobDir, "status")); err != nil {
-		_ = os.Remove(tmp)
-		return fmt.Errorf("atomic write (rename): %w", err)
-	}
-	return nil
+	return WriteStatus(jobDir, Status(status))
 }
 
-// appendStderr appends msg (with trailing newline) to jobDir/stderr.txt.
-func appendStderr(jobDir, msg string) error {
-	f, err := os.OpenFile(filepath.Join(jobDir, "stderr.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	if _, err := f.WriteString(msg + "\n"); err != nil {
+// AppendStderr appends msg to jobDir/stderr.txt as a diagnostic line
+// "<timestamp> [GoLeM] msg". It never truncates and writes under the job's
+// status lock, so claude's own stderr and earlier diagnostics are kept.
+func AppendStderr(jobDir, msg string) error {
+	return appendStderrLines(jobDir, diagnosticLine(msg))
+}
+
+// appendStaleRecovered appends the diagnostic msg followed by
+// StaleRecoveredMarker, which glm clean --stale looks for.
+func appendStaleRecovered(jobDir, msg string) error {
+	return appendStderrLines(jobDir, diagnosticLine(msg), StaleRecoveredMarker)
+}
+
+// diagnosticLine prefixes msg with the current time and "[GoLeM]".
+func diagnosticLine(msg string) string {
+	return FormatTimestamp(time.Now()) + " [GoLeM] " + msg
+}
+
+// appendStderrLines appends lines to jobDir/stderr.txt under the status lock.
+func appendStderrLines(jobDir string, lines ...string) error {
+	return slot.WithFileLock(filepath.Join(jobDir, statusLockFile), func() error {
+		f, err := os.OpenFile(filepath.Join(jobDir, "stderr.txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
 		return err
-	}
-	return nil
+	})
 }
 
 // readPID reads jobDir/pid.txt and parses the integer PID.
@@ -183,6 +396,45 @@ func pidAlive(pid int) bool {
 	return proc.Signal(syscall.Signal(0)) == nil
 }
 
+// clockTicks is USER_HZ, the unit of the start time in /proc/<pid>/stat;
+// it is 100 on every Linux architecture Go supports.
+const clockTicks = 100
+
+// processStartTime returns when pid started, read from /proc/<pid>/stat
+// and the boot time in /proc/stat. ok is false where /proc is not
+// available.
+func processStartTime(pid int) (time.Time, bool) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}, false
+	}
+	// The fields after "(comm)" start with the state, field 3; the start
+	// time is field 22.
+	i := strings.LastIndexByte(string(data), ')')
+	fields := strings.Fields(string(data)[i+1:])
+	if i < 0 || len(fields) < 20 {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, line := range strings.Split(string(stat), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			boot, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				break
+			}
+			return time.Unix(boot, 0).Add(time.Duration(ticks) * time.Second / clockTicks), true
+		}
+	}
+	return time.Time{}, false
+}
+
 // readSlotCounter reads the integer in counterPath; returns 0 on any error.
 func readSlotCounter(counterPath string) int {
 	data, err := os.ReadFile(counterPath)
@@ -211,7 +463,7 @@ func writeSlotCounter(counterPath string, n int) error {
 
 // CleanStale removes all job directories under subagentsDir that were
 // auto-recovered by Reconcile (i.e. their stderr.txt contains
-// staleRecoveredMarker). Manually killed or otherwise failed jobs are left
+// StaleRecoveredMarker). Manually killed or otherwise failed jobs are left
 // intact.
 func CleanStale(subagentsDir string) error {
 	entries, err := os.ReadDir(subagentsDir)
@@ -232,7 +484,7 @@ func CleanStale(subagentsDir string) error {
 			// If stderr.txt doesn't exist, leave the job alone
 			continue
 		}
-		if strings.Contains(string(data), staleRecoveredMarker) {
+		if strings.Contains(string(data), StaleRecoveredMarker) {
 			if err := os.RemoveAll(jobDir); err != nil {
 				return err
 			}
@@ -2,9 +2,12 @@ package job
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -30,7 +33,7 @@ func makeJob(t *testing.T, base, jobID, status string, pid int, createdAt string
 		writeFile(t, filepath.Join(dir, "created_at.txt"), createdAt)
 	}
 	if staleRecovered {
-		appendToFile(t, filepath.Join(dir, "stderr.txt"), staleRecoveredMarker+"\n")
+		appendToFile(t, filepath.Join(dir, "stderr.txt"), StaleRecoveredMarker+"\n")
 	}
 	return dir
 }
@@ -238,6 +241,34 @@ func TestStuckQueuedJobGetsStderrAnnotation(t *testing.T) {
 	}
 }
 
+// TestReconcileKeepsClaudeStderr verifies that a job that failed with its own
+// stderr and is then reconciled keeps the original error next to the
+// timestamped reconcile message.
+func TestReconcileKeepsClaudeStderr(t *testing.T) {
+	base := t.TempDir()
+	jobDir := makeJob(t, base, "job-20260227-080000-keep1234", "running", deadPID(), "", false)
+	writeFile(t, filepath.Join(jobDir, "stderr.txt"), "Error: API overloaded (529)\n")
+
+	if err := Reconcile(base, time.Now()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := AppendStderr(jobDir, "Retry skipped"); err != nil {
+		t.Fatalf("AppendStderr: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(readFileContent(t, filepath.Join(jobDir, "stderr.txt")), "\n"), "\n")
+	if len(lines) != 4 || lines[0] != "Error: API overloaded (529)" || lines[2] != StaleRecoveredMarker {
+		t.Fatalf("stderr.txt lines = %q", lines)
+	}
+	diag := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z \[GoLeM\] `)
+	if !diag.MatchString(lines[1]) || !strings.HasSuffix(lines[1], "Process died unexpectedly (PID "+strconv.Itoa(deadPID())+")") {
+		t.Errorf("reconcile line = %q", lines[1])
+	}
+	if !diag.MatchString(lines[3]) || !strings.HasSuffix(lines[3], "[GoLeM] Retry skipped") {
+		t.Errorf("appended line = %q", lines[3])
+	}
+}
+
 // ---------------------------------------------------------------------------
 // AC5: Slot counter is reset to count of actually running jobs
 // ---------------------------------------------------------------------------
@@ -287,6 +318,45 @@ func TestAllStaleJobsResultInCounterResetToZero(t *testing.T) {
 	}
 }
 
+// TestPerModelSlotCountersAreRebuilt verifies that every
+// .running_count.<model> counter is rebuilt from the model.txt of alive
+// running jobs, and that counters of models with nothing running drop to 0.
+func TestPerModelSlotCountersAreRebuilt(t *testing.T) {
+	base := t.TempDir()
+	writeSlotCounterFile(t, filepath.Join(base, ".running_count.glm-5"), 4)
+	writeSlotCounterFile(t, filepath.Join(base, ".running_count.glm-4.5-air"), 2)
+
+	jobs := []struct {
+		id, model string
+		pid       int
+	}{
+		{"job-20260227-080000-a1a1a1a1", "glm-4.7", selfPID()},
+		{"job-20260227-080001-b2b2b2b2", "glm-4.7", selfPID()},
+		{"job-20260227-080002-c3c3c3c3", "glm-5", selfPID()},
+		{"job-20260227-080003-d4d4d4d4", "glm-5", deadPID()},
+	}
+	for _, j := range jobs {
+		dir := makeJob(t, base, j.id, "running", j.pid, "", false)
+		writeFile(t, filepath.Join(dir, "model.txt"), "opus=glm-5 sonnet="+j.model+" haiku=glm-4.5-air")
+	}
+
+	if err := Reconcile(base, time.Now()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	want := map[string]int{
+		".running_count":             3,
+		".running_count.glm-4.7":     2,
+		".running_count.glm-5":       1,
+		".running_count.glm-4.5-air": 0,
+	}
+	for name, n := range want {
+		if got := readFileContent(t, filepath.Join(base, name)); got != strconv.Itoa(n) {
+			t.Errorf("%s = %s, want %d", name, got, n)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // AC6: Per-command single-job PID check (CheckJobPID)
 // ---------------------------------------------------------------------------
@@ -318,6 +388,24 @@ func TestStatusCommandChecksIndividualJobPIDWithoutFullReconciliation(t *testing
 	}
 }
 
+// TestCheckJobPIDReleasesSlotOnce verifies that CheckJobPID releases the
+// slot of a job it fails for a dead PID, and only the first time.
+func TestCheckJobPIDReleasesSlotOnce(t *testing.T) {
+	base := t.TempDir()
+	counterPath := filepath.Join(base, ".running_count")
+	writeSlotCounterFile(t, counterPath, 2)
+	jobDir := makeJob(t, filepath.Join(base, "proj"), "job-20260227-080000-dead5678", "running", deadPID(), "", false)
+
+	for i := 0; i < 2; i++ {
+		if status, err := CheckJobPID(jobDir); err != nil || status != "failed" {
+			t.Fatalf("CheckJobPID #%d = %q, %v; want failed", i+1, status, err)
+		}
+		if got := readSlotCounter(counterPath); got != 1 {
+			t.Errorf("slot counter after CheckJobPID #%d = %d, want 1", i+1, got)
+		}
+	}
+}
+
 // TestStatusCommandReturnsRunningForAlivePID verifies that CheckJobPID returns
 // "running" and leaves the status file unchanged when the PID is alive.
 func TestStatusCommandReturnsRunningForAlivePID(t *testing.T) {
@@ -345,9 +433,9 @@ func TestStatusCommandReturnsRunningForAlivePID(t *testing.T) {
 // failed via glm kill is preserved.
 func TestCleanStaleRemovesOnlyAutoRecoveredJobs(t *testing.T) {
 	base := t.TempDir()
-	// Auto-recovered job: status=failed + staleRecoveredMarker in stderr.
+	// Auto-recovered job: status=failed + StaleRecoveredMarker in stderr.
 	autoRecoveredDir := makeJob(t, base, "job-20260227-080000-dead1234", "failed", 0, "", true)
-	// Manually killed job: status=failed but NO staleRecoveredMarker.
+	// Manually killed job: status=failed but NO StaleRecoveredMarker.
 	killedDir := makeJob(t, base, "job-20260227-100000-killed00", "failed", 0, "", false)
 	writeFile(t, filepath.Join(killedDir, "stderr.txt"), "Killed by user")
 
@@ -427,6 +515,155 @@ func TestPIDReuseByOSAcceptedAsFalsePositive(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Deadline watchdog
+// ---------------------------------------------------------------------------
+
+// startSleeper starts a long sleep leading its own process group, like
+// claude and the glm worker run, and returns it with a channel that closes
+// once it has exited.
+func startSleeper(t *testing.T) (*exec.Cmd, <-chan struct{}) {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start sleep: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+	return cmd, exited
+}
+
+// setDeadline records a job started at started with a 600s timeout, and
+// claudePID, in the manifest of the job at dir. It returns the deadline.
+func setDeadline(t *testing.T, dir string, started time.Time, claudePID int) time.Time {
+	t.Helper()
+	deadline := started.Add(600 * time.Second)
+	err := UpdateManifest(dir, func(m *Manifest) {
+		m.StartedAt = FormatTimestamp(started)
+		m.TimeoutSecs = 600
+		m.Deadline = FormatTimestamp(deadline)
+		m.ClaudePID = claudePID
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deadline
+}
+
+// assertTimedOut checks that the job at dir was marked timeout with the
+// timeout message and that its process exited.
+func assertTimedOut(t *testing.T, dir string, exited <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Error("process still alive after its deadline was enforced")
+	}
+	if got := readFileContent(t, filepath.Join(dir, "status")); got != "timeout" {
+		t.Errorf("status = %q, want timeout", got)
+	}
+	if got := readFileContent(t, filepath.Join(dir, "stderr.txt")); !strings.Contains(got, "[GoLeM] Job exceeded 600s timeout") {
+		t.Errorf("stderr.txt = %q, want the timeout message", got)
+	}
+}
+
+// TestReconcileTerminatesJobPastDeadline verifies that Reconcile kills the
+// process group of a running job whose deadline has passed, marks it timeout
+// and does not count it as running.
+func TestReconcileTerminatesJobPastDeadline(t *testing.T) {
+	base := t.TempDir()
+	counterPath := filepath.Join(base, ".running_count")
+	writeSlotCounterFile(t, counterPath, 1)
+	worker, exited := startSleeper(t)
+	dir := makeJob(t, base, "job-20260227-080000-overdue1", "running", worker.Process.Pid, "", false)
+	deadline := setDeadline(t, dir, time.Now(), 0)
+
+	if err := Reconcile(base, deadline.Add(time.Minute)); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	assertTimedOut(t, dir, exited)
+	if got := readSlotCounter(counterPath); got != 0 {
+		t.Errorf("slot counter = %d, want 0", got)
+	}
+}
+
+// TestReconcileTerminatesProjectJobPastDeadline verifies that the deadline
+// is enforced on a job in a project directory, where glm puts every job, and
+// that a running project job keeps its slot.
+func TestReconcileTerminatesProjectJobPastDeadline(t *testing.T) {
+	base := t.TempDir()
+	counterPath := filepath.Join(base, ".running_count")
+	writeSlotCounterFile(t, counterPath, 2)
+	worker, exited := startSleeper(t)
+	dir := makeJob(t, base, filepath.Join("proj", "job-20260227-080000-overdue4"), "running", worker.Process.Pid, "", false)
+	deadline := setDeadline(t, dir, time.Now(), 0)
+	makeJob(t, base, filepath.Join("proj", "job-20260227-080000-healthy1"), "running", os.Getpid(), "", false)
+
+	if err := Reconcile(base, deadline.Add(time.Minute)); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	assertTimedOut(t, dir, exited)
+	if got := readSlotCounter(counterPath); got != 1 {
+		t.Errorf("slot counter = %d, want 1", got)
+	}
+}
+
+// TestCheckJobPIDTerminatesOrphanedClaudePastDeadline verifies that
+// CheckJobPID still enforces the deadline when the glm process supervising
+// the job died and left claude running, and that a job within its deadline
+// (plus grace) is left alone.
+func TestCheckJobPIDTerminatesOrphanedClaudePastDeadline(t *testing.T) {
+	base := t.TempDir()
+	claudeProc, exited := startSleeper(t)
+	dir := makeJob(t, base, "job-20260227-080000-overdue2", "running", deadPID(), "", false)
+
+	// Within the grace the dead supervisor decides, as before.
+	deadline := setDeadline(t, dir, time.Now(), claudeProc.Process.Pid)
+	if status, err := checkJobPID(dir, deadline.Add(deadlineGrace/2)); err != nil || status != "failed" {
+		t.Fatalf("CheckJobPID within the grace = %q, %v; want failed", status, err)
+	}
+	writeFile(t, filepath.Join(dir, "status"), "running")
+	_ = os.Remove(filepath.Join(dir, "stderr.txt"))
+
+	if status, err := checkJobPID(dir, deadline.Add(time.Minute)); err != nil || status != "timeout" {
+		t.Fatalf("CheckJobPID = %q, %v; want timeout", status, err)
+	}
+	assertTimedOut(t, dir, exited)
+}
+
+// TestReconcileSparesReusedPID verifies that a job past its deadline whose
+// PIDs now belong to processes started long after it (reused PIDs) is marked
+// timeout without those processes being signalled.
+func TestReconcileSparesReusedPID(t *testing.T) {
+	if _, ok := processStartTime(os.Getpid()); !ok {
+		t.Skip("process start times need /proc")
+	}
+	base := t.TempDir()
+	worker, exited := startSleeper(t)
+	claudeProc, claudeExited := startSleeper(t)
+	dir := makeJob(t, base, "job-20260227-080000-overdue3", "running", worker.Process.Pid, "", false)
+	setDeadline(t, dir, time.Now().Add(-time.Hour), claudeProc.Process.Pid)
+
+	if err := Reconcile(base, time.Now()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	select {
+	case <-exited:
+		t.Error("a process that reused the job's PID was terminated")
+	case <-claudeExited:
+		t.Error("a process that reused claude's PID was terminated")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if got := readFileContent(t, filepath.Join(dir, "status")); got != "timeout" {
+		t.Errorf("status = %q, want timeout", got)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // IsStaleQueued unit tests
 // ---------------------------------------------------------------------------
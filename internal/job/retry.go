@@ -0,0 +1,35 @@
+package job
+
+import "path/filepath"
+
+// RetriedFromFile and RetriedByFile link a job to the job it re-runs and to
+// the job that re-ran it. Each holds a single job ID.
+const (
+	RetriedFromFile = "retried_from.txt"
+	RetriedByFile   = "retried_by.txt"
+)
+
+// LinkRetry records that the job in retryDir re-runs the job in origDir:
+// retried_by.txt and the manifest of the original name the retry, and
+// retried_from.txt and the manifest of the retry name the original. Job IDs
+// are the directory names.
+func LinkRetry(origDir, retryDir string) error {
+	origID, retryID := filepath.Base(origDir), filepath.Base(retryDir)
+	if err := AtomicWrite(filepath.Join(origDir, RetriedByFile), []byte(retryID)); err != nil {
+		return err
+	}
+	if err := UpdateManifest(origDir, func(m *Manifest) { m.RetriedBy = retryID }); err != nil {
+		return err
+	}
+	if err := AtomicWrite(filepath.Join(retryDir, RetriedFromFile), []byte(origID)); err != nil {
+		return err
+	}
+	return UpdateManifest(retryDir, func(m *Manifest) { m.RetriedFrom = origID })
+}
+
+// ReadRetryLinks returns the retry links of the job in dir: the job it
+// re-runs and the job that re-ran it, each empty when there is none.
+func ReadRetryLinks(dir string) (retriedFrom, retriedBy string) {
+	m := LoadManifest(dir)
+	return m.RetriedFrom, m.RetriedBy
+}
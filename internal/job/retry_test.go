@@ -0,0 +1,52 @@
+package job
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestLinkRetry covers:
+//
+//	Scenario: LinkRetry links both jobs in their link files, manifests and index
+func TestLinkRetry(t *testing.T) {
+	root := t.TempDir()
+	orig, err := NewJob(root, "proj-1", "job-20260227-143205-a8f3b1c2")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	retry, err := NewJob(root, "proj-1", "job-20260227-150000-b1c2d3e4")
+	if err != nil {
+		t.Fatalf("NewJob: %v", err)
+	}
+	if err := LinkRetry(orig.Dir, retry.Dir); err != nil {
+		t.Fatalf("LinkRetry: %v", err)
+	}
+
+	assertFileContains(t, filepath.Join(orig.Dir, RetriedByFile), retry.ID)
+	assertFileContains(t, filepath.Join(retry.Dir, RetriedFromFile), orig.ID)
+	if from, by := ReadRetryLinks(orig.Dir); from != "" || by != retry.ID {
+		t.Errorf("original links = %q, %q; want \"\", %q", from, by, retry.ID)
+	}
+	if from, by := ReadRetryLinks(retry.Dir); from != orig.ID || by != "" {
+		t.Errorf("retry links = %q, %q; want %q, \"\"", from, by, orig.ID)
+	}
+
+	idx, ok := ReadIndex(filepath.Join(root, "proj-1"))
+	if !ok {
+		t.Fatal("ReadIndex: no index")
+	}
+	if idx[orig.ID].RetriedBy != retry.ID || idx[retry.ID].RetriedFrom != orig.ID {
+		t.Errorf("index = %+v", idx)
+	}
+}
+
+// TestReadRetryLinksLegacyFiles covers:
+//
+//	Scenario: Link files without a manifest are still read
+func TestReadRetryLinksLegacyFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, RetriedFromFile), "job-20260227-143205-a8f3b1c2\n")
+	if from, by := ReadRetryLinks(dir); from != "job-20260227-143205-a8f3b1c2" || by != "" {
+		t.Errorf("ReadRetryLinks = %q, %q", from, by)
+	}
+}
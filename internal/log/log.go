@@ -1,6 +1,8 @@
 // Package log provides leveled, colored, optionally structured logging for GoLeM.
 // All log output goes to stderr. Supports human-readable format with ANSI colors,
-// JSON structured output (GLM_LOG_FORMAT=json), and file logging (GLM_LOG_FILE).
+// JSON structured output (GLM_LOG_FORMAT=json), logfmt (GLM_LOG_FORMAT=logfmt),
+// and file logging (GLM_LOG_FILE). Child loggers made with With attach
+// fields such as job_id to every line; ParseLine reads the lines back.
 package log
 
 import (
@@ -8,6 +10,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -22,25 +27,57 @@ const (
 	LevelError
 )
 
+// String returns the level's name: debug, info, warn or error.
+func (l Level) String() string {
+	return levelToString(l)
+}
+
 // Format represents the log output format.
 type Format int
 
 const (
 	FormatHuman Format = iota
 	FormatJSON
+	FormatLogfmt
 )
 
+// ParseFormat returns the Format named by a GLM_LOG_FORMAT value: "json",
+// "logfmt", or human-readable for anything else.
+func ParseFormat(s string) Format {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "json":
+		return FormatJSON
+	case "logfmt":
+		return FormatLogfmt
+	default:
+		return FormatHuman
+	}
+}
+
+// Fields are key/value pairs attached to every line of a logger (see With).
+// The keys level, msg and ts are reserved and ignored.
+type Fields map[string]any
+
 // Option is a functional option for Logger construction.
 type Option func(*Logger)
 
-// Logger is the structured logger for GoLeM.
+// Logger is the structured logger for GoLeM. A nil *Logger discards
+// everything, so callers may pass one around without checking.
 type Logger struct {
-	mu     sync.Mutex
-	level  Level
-	format Format
-	isTTY  bool
-	out    io.Writer
-	file   io.WriteCloser
+	mu         *sync.Mutex // shared with child loggers
+	level      Level
+	format     Format
+	fileFormat *Format // nil = format
+	isTTY      bool
+	out        io.Writer
+	file       io.WriteCloser
+	fields     []field // sorted by key
+}
+
+// field is one of a Logger's Fields.
+type field struct {
+	key   string
+	value any
 }
 
 // WithLevel sets the logging level.
@@ -50,13 +87,21 @@ func WithLevel(l Level) Option {
 	}
 }
 
-// WithFormat sets the log format (human or json).
+// WithFormat sets the log format (human, json or logfmt).
 func WithFormat(f Format) Option {
 	return func(lg *Logger) {
 		lg.format = f
 	}
 }
 
+// WithFileFormat sets the format of the lines written to the WithFile
+// writer; by default they match WithFormat.
+func WithFileFormat(f Format) Option {
+	return func(lg *Logger) {
+		lg.fileFormat = &f
+	}
+}
+
 // WithWriter sets the output writer (defaults to os.Stderr).
 func WithWriter(w io.Writer) Option {
 	return func(lg *Logger) {
@@ -81,6 +126,7 @@ func WithFile(w io.WriteCloser) Option {
 // New creates a new Logger with the given options.
 func New(opts ...Option) *Logger {
 	l := &Logger{
+		mu:     &sync.Mutex{},
 		level:  LevelInfo, // default level
 		format: FormatHuman,
 		isTTY:  false,
@@ -93,6 +139,31 @@ func New(opts ...Option) *Logger {
 	return l
 }
 
+// With returns a child logger that writes to the same destinations and adds
+// fields to every line, after the fields of l; a key l already has takes the
+// new value. With on a nil Logger returns nil.
+func (l *Logger) With(fields Fields) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	merged := map[string]any{}
+	for _, f := range l.fields {
+		merged[f.key] = f.value
+	}
+	for k, v := range fields {
+		if k != "level" && k != "msg" && k != "ts" && k != "" {
+			merged[k] = v
+		}
+	}
+	child.fields = make([]field, 0, len(merged))
+	for k, v := range merged {
+		child.fields = append(child.fields, field{key: k, value: v})
+	}
+	sort.Slice(child.fields, func(a, b int) bool { return child.fields[a].key < child.fields[b].key })
+	return &child
+}
+
 // Info logs a message at info level.
 func (l *Logger) Info(msg string) {
 	l.log(LevelInfo, "[+]", msg, "\x1b[32m")
@@ -115,38 +186,23 @@ func (l *Logger) Debug(msg string) {
 
 // log is the internal logging method.
 func (l *Logger) log(msgLevel Level, prefix, msg, colorCode string) {
+	if l == nil {
+		return
+	}
 	// Level filtering: only log if message level >= logger level
 	if msgLevel < l.level {
 		return
 	}
 
-	var output string
-
-	if l.format == FormatJSON {
-		// JSON format: {"level":"info","msg":"...","ts":"2006-01-02T15:04:05Z07:00"}\n
-		entry := struct {
-			Level string `json:"level"`
-			Msg   string `json:"msg"`
-			Ts    string `json:"ts"`
-		}{
-			Level: levelToString(msgLevel),
-			Msg:   msg,
-			Ts:    time.Now().Format(time.RFC3339),
-		}
-		data, err := json.Marshal(entry)
-		if err != nil {
-			output = fmt.Sprintf(`{"level":"error","msg":"failed to marshal JSON: %v"}\n`, err)
-		} else {
-			output = string(data) + "\n"
-		}
-	} else {
-		// Human format: "[prefix] message\n"
-		if l.isTTY && colorCode != "" {
-			// Color the entire line (prefix, space, message)
-			output = fmt.Sprintf("%s%s %s\x1b[0m\n", colorCode, prefix, msg)
-		} else {
-			output = fmt.Sprintf("%s %s\n", prefix, msg)
-		}
+	now := time.Now()
+	color := ""
+	if l.isTTY {
+		color = colorCode
+	}
+	output := l.render(l.format, msgLevel, prefix, msg, color, now)
+	fileOutput := output
+	if l.fileFormat != nil && (*l.fileFormat != l.format || color != "") {
+		fileOutput = l.render(*l.fileFormat, msgLevel, prefix, msg, "", now)
 	}
 
 	l.mu.Lock()
@@ -157,7 +213,7 @@ func (l *Logger) log(msgLevel Level, prefix, msg, colorCode string) {
 
 	// Write to file if configured
 	if l.file != nil {
-		if _, err := l.file.Write([]byte(output)); err != nil {
+		if _, err := l.file.Write([]byte(fileOutput)); err != nil {
 			// If file write fails, write warning to stdout first, then the original message
 			warning := fmt.Sprintf("[!] Cannot write to log file\n")
 			l.out.Write([]byte(warning))
@@ -165,6 +221,58 @@ func (l *Logger) log(msgLevel Level, prefix, msg, colorCode string) {
 	}
 }
 
+// render formats one log line, newline included, in format. colorCode
+// colors a human-readable line; it is empty for no color.
+func (l *Logger) render(format Format, msgLevel Level, prefix, msg, colorCode string, now time.Time) string {
+	switch format {
+	case FormatJSON:
+		// JSON format: {"level":"info","msg":"...","ts":"2006-01-02T15:04:05Z07:00",<fields>}\n
+		entry := map[string]any{
+			"level": levelToString(msgLevel),
+			"msg":   msg,
+			"ts":    now.Format(time.RFC3339),
+		}
+		for _, f := range l.fields {
+			entry[f.key] = f.value
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Sprintf(`{"level":"error","msg":"failed to marshal JSON: %v"}`+"\n", err)
+		}
+		return string(data) + "\n"
+
+	case FormatLogfmt:
+		// logfmt: ts=... level=info msg="..." <fields>\n
+		var b strings.Builder
+		fmt.Fprintf(&b, "ts=%s level=%s msg=%s", now.Format(time.RFC3339), levelToString(msgLevel), logfmtValue(msg))
+		for _, f := range l.fields {
+			fmt.Fprintf(&b, " %s=%s", f.key, logfmtValue(fmt.Sprint(f.value)))
+		}
+		return b.String() + "\n"
+
+	default:
+		// Human format: "[prefix] message key=value...\n"
+		line := prefix + " " + msg
+		for _, f := range l.fields {
+			line += " " + f.key + "=" + logfmtValue(fmt.Sprint(f.value))
+		}
+		if colorCode != "" {
+			// Color the entire line (prefix, space, message)
+			return colorCode + line + "\x1b[0m\n"
+		}
+		return line + "\n"
+	}
+}
+
+// logfmtValue returns s as a logfmt value: as is, or quoted when it is empty
+// or contains spaces, quotes, '=' or control characters.
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=\\") || strconv.Quote(s) != `"`+s+`"` {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
 // levelToString converts Level to its string representation.
 func levelToString(l Level) string {
 	switch l {
@@ -589,6 +589,66 @@ func TestConcurrentLogWritesFromGoroutinesAreSafe(t *testing.T) {
 	}
 }
 
+// =============================================================================
+// AC9 — Child loggers with fields
+// =============================================================================
+
+// Scenario: With() fields reach every line of the child and its children
+func TestWithPropagatesFields(t *testing.T) {
+	var buf bytes.Buffer
+	root := newLogger(t, &buf, false, true, false)
+	cmdLog := root.With(log.Fields{"command": "run"})
+	jobLog := cmdLog.With(log.Fields{"job_id": "job-20260101-000000-aaaaaaaa"})
+
+	root.Info("plain")
+	cmdLog.Info("command line")
+	jobLog.Debug("job line")
+	jobLog.With(log.Fields{"command": "start", "msg": "ignored"}).Warn("overridden")
+
+	want := []string{
+		"[+] plain",
+		"[+] command line command=run",
+		"[D] job line command=run job_id=job-20260101-000000-aaaaaaaa",
+		"[!] overridden command=start job_id=job-20260101-000000-aaaaaaaa",
+	}
+	lines := nonEmptyLines(buf.String())
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+
+	var nilLog *log.Logger
+	nilLog.With(log.Fields{"job_id": "x"}).Info("discarded") // must not panic
+}
+
+// Scenario: fields are written as JSON keys and logfmt pairs; the file has its own format
+func TestFieldsInStructuredFormats(t *testing.T) {
+	var jsonBuf bytes.Buffer
+	newLogger(t, &jsonBuf, false, false, true).With(log.Fields{"job_id": "job-1", "exit_code": 3}).Info("job finished")
+	var entry map[string]any
+	if err := json.Unmarshal(jsonBuf.Bytes(), &entry); err != nil {
+		t.Fatalf("not JSON: %q", jsonBuf.String())
+	}
+	if entry["job_id"] != "job-1" || entry["exit_code"] != float64(3) || entry["msg"] != "job finished" {
+		t.Errorf("JSON entry = %v", entry)
+	}
+
+	var stderrBuf, fileBuf bytes.Buffer
+	lg := log.New(log.WithWriter(&stderrBuf), log.WithFile(nopCloser{&fileBuf}), log.WithFileFormat(log.FormatLogfmt))
+	lg.With(log.Fields{"job_id": "job-1", "workdir": "/tmp/my repo"}).Warn("slow start")
+	if got := stderrBuf.String(); got != "[!] slow start job_id=job-1 workdir=\"/tmp/my repo\"\n" {
+		t.Errorf("stderr = %q", got)
+	}
+	line := fileBuf.String()
+	if !strings.HasPrefix(line, "ts=") || !strings.HasSuffix(line, ` level=warn msg="slow start" job_id=job-1 workdir="/tmp/my repo"`+"\n") {
+		t.Errorf("file line = %q", line)
+	}
+}
+
 // =============================================================================
 // Helpers
 // =============================================================================
@@ -644,5 +704,10 @@ func (e *errorWriteCloser) Close() error {
 	return nil
 }
 
+// nopCloser adds a no-op Close to a writer.
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
 // Ensure errorWriteCloser satisfies io.WriteCloser at compile time.
 var _ io.WriteCloser = (*errorWriteCloser)(nil)
@@ -0,0 +1,195 @@
+package log
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a log line read back by ParseLine.
+type Entry struct {
+	// Time is when the line was logged; zero for a human-readable line.
+	Time  time.Time
+	Level Level
+	Msg   string
+	// Fields holds the line's other key/value pairs, such as job_id and
+	// command, and the fields of a lifecycle event line (see package events).
+	Fields map[string]string
+}
+
+// ParseLevel returns the Level named s (debug, info, warn or warning,
+// error), ignoring case.
+func ParseLevel(s string) (Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, true
+	case "info":
+		return LevelInfo, true
+	case "warn", "warning":
+		return LevelWarn, true
+	case "error":
+		return LevelError, true
+	}
+	return LevelInfo, false
+}
+
+// ansiRe matches the ANSI color codes of a human-readable line logged to a
+// terminal.
+var ansiRe = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// humanPrefixes maps the prefixes of human-readable lines to their levels.
+var humanPrefixes = map[string]Level{
+	"[D]": LevelDebug,
+	"[+]": LevelInfo,
+	"[!]": LevelWarn,
+	"[x]": LevelError,
+}
+
+// ParseLine parses a line written in any Format: a JSON object, logfmt
+// ("ts=... level=... msg=..."), or human-readable ("[+] msg key=value").
+// A JSON lifecycle event without a level or msg is an info line whose Msg
+// is the event name. It reports false for a line in none of these formats,
+// which is returned as an info line with the whole line as Msg.
+func ParseLine(line string) (Entry, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(trimmed, "{"):
+		if e, ok := parseJSONLine(trimmed); ok {
+			return e, true
+		}
+	case strings.HasPrefix(trimmed, "ts=") || strings.HasPrefix(trimmed, "level="):
+		if e, ok := parseLogfmtLine(trimmed); ok {
+			return e, true
+		}
+	default:
+		if e, ok := parseHumanLine(ansiRe.ReplaceAllString(trimmed, "")); ok {
+			return e, true
+		}
+	}
+	return Entry{Level: LevelInfo, Msg: line, Fields: map[string]string{}}, false
+}
+
+// parseJSONLine parses a FormatJSON line or a lifecycle event.
+func parseJSONLine(line string) (Entry, bool) {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return Entry{}, false
+	}
+	e := Entry{Level: LevelInfo, Fields: map[string]string{}}
+	for k, v := range obj {
+		s, ok := v.(string)
+		if !ok {
+			data, _ := json.Marshal(v)
+			s = string(data)
+		}
+		switch k {
+		case "level":
+			e.Level, _ = ParseLevel(s)
+		case "msg":
+			e.Msg = s
+		case "ts":
+			e.Time, _ = time.Parse(time.RFC3339Nano, s)
+		default:
+			e.Fields[k] = s
+		}
+	}
+	if e.Msg == "" {
+		e.Msg = e.Fields["event"]
+	}
+	return e, true
+}
+
+// parseLogfmtLine parses a FormatLogfmt line.
+func parseLogfmtLine(line string) (Entry, bool) {
+	pairs, ok := parseLogfmt(line)
+	if !ok {
+		return Entry{}, false
+	}
+	e := Entry{Level: LevelInfo, Fields: map[string]string{}}
+	for _, p := range pairs {
+		switch p[0] {
+		case "level":
+			e.Level, _ = ParseLevel(p[1])
+		case "msg":
+			e.Msg = p[1]
+		case "ts":
+			e.Time, _ = time.Parse(time.RFC3339Nano, p[1])
+		default:
+			e.Fields[p[0]] = p[1]
+		}
+	}
+	return e, true
+}
+
+// humanFieldRe matches a trailing key=value of a human-readable line.
+var humanFieldRe = regexp.MustCompile(`\s([a-z][a-z0-9_]*)=("(?:[^"\\]|\\.)*"|\S+)$`)
+
+// parseHumanLine parses a FormatHuman line. Its trailing key=value words are
+// taken as fields.
+func parseHumanLine(line string) (Entry, bool) {
+	prefix, msg, _ := strings.Cut(line, " ")
+	level, ok := humanPrefixes[prefix]
+	if !ok {
+		return Entry{}, false
+	}
+	e := Entry{Level: level, Fields: map[string]string{}}
+	for {
+		m := humanFieldRe.FindStringSubmatchIndex(msg)
+		if m == nil {
+			break
+		}
+		key, value := msg[m[2]:m[3]], msg[m[4]:m[5]]
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				break
+			}
+			value = unquoted
+		}
+		e.Fields[key] = value
+		msg = msg[:m[0]]
+	}
+	e.Msg = msg
+	return e, true
+}
+
+// parseLogfmt splits a logfmt line into its key/value pairs.
+func parseLogfmt(line string) ([][2]string, bool) {
+	var pairs [][2]string
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		eq := strings.IndexByte(line[i:], '=')
+		if eq <= 0 {
+			return nil, false
+		}
+		key := line[i : i+eq]
+		if strings.ContainsAny(key, " \"") {
+			return nil, false
+		}
+		i += eq + 1
+		var value string
+		if i < len(line) && line[i] == '"' {
+			quoted, err := strconv.QuotedPrefix(line[i:])
+			if err != nil {
+				return nil, false
+			}
+			value, _ = strconv.Unquote(quoted)
+			i += len(quoted)
+		} else {
+			end := strings.IndexByte(line[i:], ' ')
+			if end < 0 {
+				end = len(line) - i
+			}
+			value = line[i : i+end]
+			i += end
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, len(pairs) > 0
+}
@@ -0,0 +1,48 @@
+package log_test
+
+import (
+	"testing"
+
+	"github.com/veschin/GoLeM/internal/log"
+)
+
+// Scenario: ParseLine reads lines of every format back
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		level  log.Level
+		msg    string
+		fields map[string]string
+		ok     bool
+	}{
+		{"logfmt", `ts=2026-01-01T10:00:00Z level=warn msg="slow start" job_id=job-1 workdir="/tmp/my repo"`,
+			log.LevelWarn, "slow start", map[string]string{"job_id": "job-1", "workdir": "/tmp/my repo"}, true},
+		{"JSON", `{"level":"debug","msg":"claude exited","ts":"2026-01-01T10:00:00Z","job_id":"job-1","exit_code":0}`,
+			log.LevelDebug, "claude exited", map[string]string{"job_id": "job-1", "exit_code": "0"}, true},
+		{"lifecycle event", `{"event":"job_created","job_id":"job-1","project_id":"p","ts":"2026-01-01T10:00:00Z"}`,
+			log.LevelInfo, "job_created", map[string]string{"event": "job_created", "job_id": "job-1", "project_id": "p"}, true},
+		{"human", "[x] Claude CLI not found command=run",
+			log.LevelError, "Claude CLI not found", map[string]string{"command": "run"}, true},
+		{"colored human", "\x1b[33m[!] Cleaned 3 stale jobs\x1b[0m",
+			log.LevelWarn, "Cleaned 3 stale jobs", map[string]string{}, true},
+		{"not a log line", "panic: something",
+			log.LevelInfo, "panic: something", map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := log.ParseLine(tt.line)
+			if ok != tt.ok || e.Level != tt.level || e.Msg != tt.msg {
+				t.Errorf("ParseLine = %v %q, %v; want %v %q, %v", e.Level, e.Msg, ok, tt.level, tt.msg, tt.ok)
+			}
+			if len(e.Fields) != len(tt.fields) {
+				t.Errorf("Fields = %v, want %v", e.Fields, tt.fields)
+			}
+			for k, v := range tt.fields {
+				if e.Fields[k] != v {
+					t.Errorf("Fields[%s] = %q, want %q", k, e.Fields[k], v)
+				}
+			}
+		})
+	}
+}
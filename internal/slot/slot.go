@@ -9,8 +9,11 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
+
+	"github.com/veschin/GoLeM/internal/errs"
 )
 
 const (
@@ -24,8 +27,16 @@ const (
 	PollInterval = 2
 	// StaleLockSeconds is the staleness threshold for mkdir-based locks.
 	StaleLockSeconds = 60
+	// RootLockFile is the advisory lock taken by WithLock.
+	RootLockFile = ".root.lock"
+	// LockTimeout is how long WithLock waits. It matches StaleLockSeconds:
+	// no healthy holder keeps a lock that long.
+	LockTimeout = StaleLockSeconds * time.Second
 )
 
+// lockRetryInterval is the polling interval while a lock is held elsewhere.
+const lockRetryInterval = 100 * time.Millisecond
+
 // JobStatus represents the lifecycle state of a subagent job.
 type JobStatus string
 
@@ -49,6 +60,7 @@ type Job struct {
 type SlotManager struct {
 	dir         string
 	maxParallel int
+	model       string // empty for the global counter
 }
 
 // NewSlotManager creates a SlotManager that stores its counter and lock files
@@ -57,14 +69,61 @@ func NewSlotManager(dir string, maxParallel int) *SlotManager {
 	return &SlotManager{dir: dir, maxParallel: maxParallel}
 }
 
+// NewModelSlotManager creates a SlotManager for one execution model. Its
+// counter and lock (ModelCounterFile, ModelLockFile) are independent of the
+// global ones and of every other model's.
+func NewModelSlotManager(dir, model string, maxParallel int) *SlotManager {
+	return &SlotManager{dir: dir, maxParallel: maxParallel, model: model}
+}
+
+// ModelCounterFile returns the counter filename for model:
+// ".running_count.<model>", or CounterFile when model is empty. Characters
+// outside [A-Za-z0-9._-] are replaced with "_".
+func ModelCounterFile(model string) string {
+	if model == "" {
+		return CounterFile
+	}
+	return CounterFile + "." + fileSafe(model)
+}
+
+// ModelLockFile returns the lock filename matching ModelCounterFile(model).
+func ModelLockFile(model string) string {
+	if model == "" {
+		return LockFile
+	}
+	return LockFile + "." + fileSafe(model)
+}
+
+// fileSafe maps s to a string usable as a file name suffix.
+func fileSafe(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '.' || c == '-' || c == '_'
+		if !ok {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
 // CounterPath returns the absolute path of the running counter file.
 func (sm *SlotManager) CounterPath() string {
-	return filepath.Join(sm.dir, CounterFile)
+	return filepath.Join(sm.dir, ModelCounterFile(sm.model))
 }
 
 // LockPath returns the absolute path of the exclusive lock file.
 func (sm *SlotManager) LockPath() string {
-	return filepath.Join(sm.dir, LockFile)
+	return filepath.Join(sm.dir, ModelLockFile(sm.model))
+}
+
+// LimitFor returns the max_parallel that applies to model: perModel[model]
+// when set, maxParallel otherwise.
+func LimitFor(model string, maxParallel int, perModel map[string]int) int {
+	if n, ok := perModel[model]; ok {
+		return n
+	}
+	return maxParallel
 }
 
 // Init ensures the counter file exists, creating it with value 0 if absent.
@@ -126,23 +185,79 @@ func (sm *SlotManager) writeCounter(n int) error {
 // withLock acquires an exclusive flock on LockPath, runs fn, then releases.
 // On platforms where flock is unavailable it falls back to mkdir-based locking.
 func (sm *SlotManager) withLock(fn func() error) error {
+	return WithFileLock(sm.LockPath(), fn)
+}
+
+// WithFileLock acquires an exclusive flock on lockPath (creating the file if
+// needed), runs fn, then releases. When flock is unavailable, or
+// LOCK_FALLBACK=true, it falls back to a mkdir-based lock at lockPath + ".d"
+// that is broken after StaleLockSeconds.
+func WithFileLock(lockPath string, fn func() error) error {
+	return withFileLock(lockPath, 0, fn)
+}
+
+// WithLock runs fn while holding the advisory lock dir/RootLockFile. Use it
+// around operations that touch several files under the subagent root and must
+// not interleave with another glm process, e.g. creating a job directory with
+// its initial status. It waits at most LockTimeout. The lock is not
+// reentrant: fn must not call WithLock on the same dir.
+func WithLock(dir string, fn func() error) error {
+	return WithLockTimeout(filepath.Join(dir, RootLockFile), LockTimeout, fn)
+}
+
+// WithLockTimeout is WithFileLock with a bound on the wait. If the lock is
+// still held after timeout it returns an err:timeout error without running
+// fn. A leftover mkdir lock is broken after StaleLockSeconds as usual; a
+// flock dies with its holder.
+func WithLockTimeout(lockPath string, timeout time.Duration, fn func() error) error {
+	return withFileLock(lockPath, timeout, fn)
+}
+
+// withFileLock implements WithFileLock and WithLockTimeout. timeout == 0
+// waits forever.
+func withFileLock(lockPath string, timeout time.Duration, fn func() error) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	timedOut := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	timeoutErr := func() error {
+		return errs.Timeout("\"Timed out after %s waiting for lock %s\"", timeout, lockPath)
+	}
+
 	// Check if fallback mode is forced
 	useFallback := os.Getenv("LOCK_FALLBACK") == "true"
 
 	if !useFallback {
 		// Try flock-based locking
-		f, err := os.OpenFile(sm.LockPath(), os.O_CREATE|os.O_RDWR, 0o644)
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
 		if err == nil {
 			defer f.Close()
-			if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err == nil {
-				defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
-				return fn()
+			how := syscall.LOCK_EX
+			if timeout > 0 {
+				how |= syscall.LOCK_NB
+			}
+			for {
+				err := syscall.Flock(int(f.Fd()), how)
+				if err == nil {
+					defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+					return fn()
+				}
+				if err != syscall.EWOULDBLOCK {
+					break // flock unsupported here; use the mkdir lock
+				}
+				if timedOut() {
+					return timeoutErr()
+				}
+				time.Sleep(lockRetryInterval)
 			}
 		}
 	}
 
 	// Fallback to mkdir-based locking
-	lockDir := mkdirLockPath(sm.LockPath())
+	lockDir := mkdirLockPath(lockPath)
 	for {
 		err := os.Mkdir(lockDir, 0o755)
 		if err == nil {
@@ -156,8 +271,11 @@ func (sm *SlotManager) withLock(fn func() error) error {
 				os.Remove(lockDir)
 				continue
 			}
+			if timedOut() {
+				return timeoutErr()
+			}
 			// Wait and retry
-			time.Sleep(100 * time.Millisecond)
+			time.Sleep(lockRetryInterval)
 			continue
 		}
 		return fmt.Errorf("mkdir lock failed: %w", err)
@@ -324,6 +442,28 @@ func mkdirLockPath(lockFile string) string {
 	return lockFile + ".d"
 }
 
+// StaleLocks returns the mkdir-based lock directories in dir (the fallback
+// of WithFileLock for LockFile, ModelLockFile and RootLockFile) that are older
+// than StaleLockSeconds, i.e. were left behind by a process that died while
+// holding them.
+func StaleLocks(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var stale []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || !strings.HasPrefix(name, ".") || !strings.Contains(name, ".lock") || !strings.HasSuffix(name, ".d") {
+			continue
+		}
+		if p := filepath.Join(dir, name); isStale(p) {
+			stale = append(stale, p)
+		}
+	}
+	return stale
+}
+
 // isStale reports whether a mkdir-based lock at dir is older than StaleLockSeconds.
 func isStale(dir string) bool {
 	info, err := os.Stat(dir)
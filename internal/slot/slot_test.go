@@ -383,6 +383,236 @@ func TestFallbackToMkdirLockingWhenFlockUnavailable(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Per-model slots
+// ---------------------------------------------------------------------------
+
+// TestModelCounterAndLockPaths verifies the per-model file names: the model is
+// a suffix of the global names, with unsafe characters replaced.
+func TestModelCounterAndLockPaths(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewModelSlotManager(dir, "glm-4.7", 2)
+
+	if got, want := sm.CounterPath(), filepath.Join(dir, ".running_count.glm-4.7"); got != want {
+		t.Errorf("CounterPath() = %q, want %q", got, want)
+	}
+	if got, want := sm.LockPath(), filepath.Join(dir, ".counter.lock.glm-4.7"); got != want {
+		t.Errorf("LockPath() = %q, want %q", got, want)
+	}
+	if got := ModelCounterFile("org/glm 5"); got != ".running_count.org_glm_5" {
+		t.Errorf("ModelCounterFile(unsafe) = %q", got)
+	}
+	if got := ModelCounterFile(""); got != CounterFile {
+		t.Errorf("ModelCounterFile(\"\") = %q, want %q", got, CounterFile)
+	}
+}
+
+// TestLimitForUsesOwnLimitOrFallsBack verifies that a model listed in the
+// per-model table gets its own limit and any other model the global one.
+func TestLimitForUsesOwnLimitOrFallsBack(t *testing.T) {
+	perModel := map[string]int{"glm-5": 1}
+	if got := LimitFor("glm-5", 3, perModel); got != 1 {
+		t.Errorf("LimitFor(glm-5) = %d, want 1", got)
+	}
+	if got := LimitFor("glm-4.7", 3, perModel); got != 3 {
+		t.Errorf("LimitFor(glm-4.7) = %d, want the global 3", got)
+	}
+}
+
+// TestModelCountersAreIndependentUnderConcurrency runs concurrent claims on
+// two models: each counter must see exactly its own claims, and the global
+// counter must stay untouched.
+func TestModelCountersAreIndependentUnderConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	models := []string{"glm-5", "glm-4.7"}
+
+	const perModel = 10
+	var wg sync.WaitGroup
+	for _, model := range models {
+		for range perModel {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := NewModelSlotManager(dir, model, 100).WaitForSlot(); err != nil {
+					t.Errorf("WaitForSlot(%s): %v", model, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, model := range models {
+		data, err := os.ReadFile(filepath.Join(dir, ModelCounterFile(model)))
+		if err != nil {
+			t.Fatalf("read %s counter: %v", model, err)
+		}
+		if got := strings.TrimSpace(string(data)); got != strconv.Itoa(perModel) {
+			t.Errorf("%s counter = %s, want %d (locking failed or counters shared)", model, got, perModel)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, CounterFile)); !os.IsNotExist(err) {
+		t.Errorf("global counter touched by per-model claims (stat err: %v)", err)
+	}
+}
+
+// TestFullModelDoesNotBlockOtherModel verifies that a model at its limit
+// blocks only its own waiters.
+func TestFullModelDoesNotBlockOtherModel(t *testing.T) {
+	dir := t.TempDir()
+	perModel := map[string]int{"glm-5": 1}
+	manager := func(model string) *SlotManager {
+		return NewModelSlotManager(dir, model, LimitFor(model, 3, perModel))
+	}
+
+	if err := manager("glm-5").WaitForSlot(); err != nil {
+		t.Fatalf("WaitForSlot(glm-5): %v", err)
+	}
+
+	start := time.Now()
+	if err := manager("glm-4.7").WaitForSlot(); err != nil {
+		t.Fatalf("WaitForSlot(glm-4.7): %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("glm-4.7 waited %v behind a full glm-5", elapsed)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		if err := manager("glm-5").ReleaseSlot(); err != nil {
+			fmt.Printf("goroutine ReleaseSlot error: %v\n", err)
+		}
+		close(released)
+	}()
+	if err := manager("glm-5").WaitForSlot(); err != nil {
+		t.Fatalf("second WaitForSlot(glm-5): %v", err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("second glm-5 claim succeeded before its slot was released")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// WithLock: advisory lock for multi-file critical sections
+// ---------------------------------------------------------------------------
+
+// TestWithLockSerializesCriticalSections runs 20 read-modify-write sections
+// concurrently, with flock and with the mkdir fallback; none may be lost.
+func TestWithLockSerializesCriticalSections(t *testing.T) {
+	for _, fallback := range []string{"false", "true"} {
+		t.Run("LOCK_FALLBACK="+fallback, func(t *testing.T) {
+			t.Setenv("LOCK_FALLBACK", fallback)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "shared")
+			writeFileOrFatal(t, path, "0")
+
+			const goroutines = 20
+			var wg sync.WaitGroup
+			for range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := WithLock(dir, func() error {
+						data, err := os.ReadFile(path)
+						if err != nil {
+							return err
+						}
+						n, err := strconv.Atoi(string(data))
+						if err != nil {
+							return err
+						}
+						return os.WriteFile(path, []byte(strconv.Itoa(n+1)), 0o644)
+					})
+					if err != nil {
+						t.Errorf("WithLock: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			data, _ := os.ReadFile(path)
+			if string(data) != strconv.Itoa(goroutines) {
+				t.Errorf("shared counter = %q, want %d (lost updates)", data, goroutines)
+			}
+		})
+	}
+}
+
+// TestWithLockTimeoutGivesUp verifies that a held lock makes WithLockTimeout
+// return err:timeout without running fn.
+func TestWithLockTimeoutGivesUp(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), RootLockFile)
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = WithFileLock(lockPath, func() error {
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	<-held
+
+	ran := false
+	start := time.Now()
+	err := WithLockTimeout(lockPath, 300*time.Millisecond, func() error {
+		ran = true
+		return nil
+	})
+	elapsed := time.Since(start)
+	close(release)
+	<-done
+
+	if err == nil || !strings.HasPrefix(err.Error(), "err:timeout") {
+		t.Errorf("WithLockTimeout on held lock: got %v, want err:timeout", err)
+	}
+	if ran {
+		t.Error("fn ran without the lock")
+	}
+	if elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("gave up after %v, want about 300ms", elapsed)
+	}
+}
+
+// TestWithLockBreaksStaleMkdirLock verifies that WithLock in fallback mode
+// breaks a mkdir lock older than StaleLockSeconds instead of timing out.
+func TestWithLockBreaksStaleMkdirLock(t *testing.T) {
+	t.Setenv("LOCK_FALLBACK", "true")
+	dir := t.TempDir()
+	lockDir := mkdirLockPath(filepath.Join(dir, RootLockFile))
+	if err := os.Mkdir(lockDir, 0o755); err != nil {
+		t.Fatalf("mkdir lock dir: %v", err)
+	}
+	staleTime := time.Now().Add(-(StaleLockSeconds + 1) * time.Second)
+	if err := os.Chtimes(lockDir, staleTime, staleTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	ran := false
+	if err := WithLock(dir, func() error { ran = true; return nil }); err != nil {
+		t.Fatalf("WithLock with stale mkdir lock: %v", err)
+	}
+	if !ran {
+		t.Error("fn did not run")
+	}
+	if _, err := os.Stat(lockDir); !os.IsNotExist(err) {
+		t.Errorf("lock dir not released after WithLock (stat err: %v)", err)
+	}
+}
+
+// writeFileOrFatal writes content to path.
+func writeFileOrFatal(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // AC6: Reconciliation at startup
 // ---------------------------------------------------------------------------
@@ -0,0 +1,398 @@
+package golem
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/config"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/log"
+)
+
+// Config is the GoLeM configuration: glm.toml, the API key and the GLM_*
+// environment overrides.
+type Config = config.Config
+
+// Job identifies a job created by Start.
+type Job = job.Job
+
+// Logger is glm's debug logger; see Options.Logger.
+type Logger = log.Logger
+
+// LaunchFunc starts the queued job in jobDir, which is already "running", in
+// a new process that calls ExecuteJob, and returns the PID of that process.
+type LaunchFunc = cmd.LaunchFunc
+
+// LoadOptions holds optional LoadConfig settings: the --subagent-dir
+// override and the project root a relative subagent_dir is resolved against.
+type LoadOptions = config.Options
+
+// Invocation records the command that created a job; see
+// Options.Invocation.
+type Invocation = job.Invocation
+
+// Priority orders queued jobs for free slots; see RunSpec.Priority.
+type Priority = job.Priority
+
+// The priorities of RunSpec.Priority.
+const (
+	PriorityLow    = job.PriorityLow
+	PriorityNormal = job.PriorityNormal
+	PriorityHigh   = job.PriorityHigh
+)
+
+// ParsePriority returns the Priority named s: low, normal or high.
+func ParsePriority(s string) (Priority, error) {
+	return job.ParsePriority(s)
+}
+
+// StandardDirs returns the configuration directory (GLM_CONFIG_DIR, else
+// $XDG_CONFIG_HOME/GoLeM, else ~/.config/GoLeM) and the default job
+// directory (~/.claude/subagents) glm uses. subagent_dir in glm.toml or
+// GLM_SUBAGENT_DIR replace the latter when the config is loaded.
+func StandardDirs() (configDir, subagentDir string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	configDir, _, err = config.ResolveConfigDir("")
+	if err != nil {
+		return "", "", err
+	}
+	return configDir, filepath.Join(home, ".claude", "subagents"), nil
+}
+
+// LoadConfig loads configDir/glm.toml, the API key and the environment
+// overrides as glm does, validates them and creates the subagent directory:
+// subagentDir unless subagent_dir, GLM_SUBAGENT_DIR or opts set another.
+func LoadConfig(configDir, subagentDir string, opts ...*LoadOptions) (*Config, error) {
+	o := LoadOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o = *opts[0]
+	}
+	return config.LoadWithOptions(configDir, subagentDir, o)
+}
+
+// ExitCode returns the exit code glm exits with for err: 0 for nil, the code
+// of its category (user, not_found, auth, rate_limit, ...) otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return errs.ExitCode(err)
+}
+
+// warnOutput receives the warnings of this package; see SetWarningOutput.
+var warnOutput io.Writer
+
+func init() {
+	SetWarningOutput(io.Discard)
+}
+
+// SetWarningOutput sets where warnings go that glm prints to stderr, such as
+// one about an outdated claude, a job file that does not parse or a
+// subagents directory over max_disk_mb. They are discarded by default.
+func SetWarningOutput(w io.Writer) {
+	warnOutput = w
+	claude.WarnOutput = w
+	job.WarnOutput = w
+}
+
+// Options holds optional Client settings.
+type Options struct {
+	// Launch starts the jobs Start queues once they get a slot. nil runs them
+	// in goroutines of this process.
+	Launch LaunchFunc
+	// ProjectDir is the directory whose project is searched first when a
+	// job ID is looked up (empty = none; job IDs are unique anyway).
+	ProjectDir string
+	// Logger receives debug lines about the jobs, each with the job's
+	// job_id field (nil = none).
+	Logger *Logger
+	// Invocation is recorded in the job.json of every job the Client
+	// creates, e.g. the glm version and command line (nil = none).
+	Invocation *Invocation
+}
+
+// Client runs and inspects jobs. It is safe for concurrent use.
+type Client struct {
+	cfg        *Config
+	launch     LaunchFunc
+	projectID  string
+	log        *log.Logger
+	invocation *Invocation
+
+	mu     sync.Mutex
+	active map[string]*activeJob
+}
+
+// activeJob is a job executing in this process, which Kill stops by
+// cancelling its context.
+type activeJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New returns a Client for cfg.
+func New(cfg *Config, opts ...*Options) *Client {
+	c := &Client{cfg: cfg, active: map[string]*activeJob{}}
+	if len(opts) > 0 && opts[0] != nil {
+		c.launch = opts[0].Launch
+		c.log = opts[0].Logger
+		c.invocation = opts[0].Invocation
+		if opts[0].ProjectDir != "" {
+			c.projectID = projectOf(opts[0].ProjectDir)
+		}
+	}
+	if c.launch == nil {
+		c.launch = c.launchInProcess
+	}
+	return c
+}
+
+// NewFromStandardFiles returns a Client for the configuration glm itself
+// uses (see StandardDirs).
+func NewFromStandardFiles(opts ...*Options) (*Client, error) {
+	configDir, subagentDir, err := StandardDirs()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadConfig(configDir, subagentDir)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg, opts...), nil
+}
+
+// Config returns the Client's configuration.
+func (c *Client) Config() *Config {
+	return c.cfg
+}
+
+// RunSpec describes a job. Empty fields fall back to the Config.
+type RunSpec struct {
+	// Prompt is the task for claude (required).
+	Prompt string
+	// Dir is the working directory claude runs in (default ".").
+	Dir string
+	// Timeout limits the job, rounded up to whole seconds (0 =
+	// default_timeout).
+	Timeout time.Duration
+	// Model sets the opus, sonnet and haiku models at once; OpusModel,
+	// SonnetModel and HaikuModel set one each.
+	Model       string
+	OpusModel   string
+	SonnetModel string
+	HaikuModel  string
+	// PermissionMode is claude's permission mode: bypassPermissions,
+	// acceptEdits, default or plan.
+	PermissionMode string
+	// BaseURL overrides base_url for this job.
+	BaseURL string
+	// Priority orders the job among queued jobs waiting for a slot (empty =
+	// normal); see ParsePriority.
+	Priority Priority
+	// Notify is a shell command run when the job has finished, with
+	// GLM_JOB_ID, GLM_STATUS, GLM_EXIT_CODE, GLM_JOB_DIR and GLM_DURATION
+	// set; its output goes to the job's notify.log. Start falls back to
+	// on_complete_cmd; Run runs no hook without it.
+	Notify string
+	// Template names the template Prompt was rendered from, recorded with
+	// the job for "glm prompt"; it is not rendered again.
+	Template string
+	// ContextFile is copied into the job dir, and the prompt claude gets
+	// points at the copy instead of holding the file (glm run --context);
+	// Run only. Should the copy fail, the file is put in the prompt.
+	ContextFile string
+	// CaptureDiff saves the git diff of Dir with the job.
+	CaptureDiff bool
+	// StrictResult fails a job that exits 0 but whose result matches one of
+	// result_failure_markers.
+	StrictResult bool
+	// Confine checks the prompt and, once the job has run, its changelog
+	// for paths outside Dir, as confine_to_workdir does; confine_mode says
+	// whether that is a warning or refuses and fails the job.
+	Confine bool
+	// AllowUnsafePaths lets a bypassPermissions job run in a system path,
+	// the home directory root or outside home.
+	AllowUnsafePaths bool
+	// AllowOverlap lets the job start although a running job works in Dir,
+	// above it or below it.
+	AllowOverlap bool
+	// AllowNested lets the job start although this process runs inside a
+	// glm job nested max_depth deep already (see cmd.NestingCheck).
+	AllowNested bool
+	// StrictDisk refuses the job when the subagents directory is over
+	// max_disk_mb; otherwise that is only a warning (see SetWarningOutput).
+	StrictDisk bool
+	// Keep retains the job directory after Run returns. Jobs of Start are
+	// always kept until their result is collected with "glm result" or
+	// cleaned up.
+	Keep bool
+}
+
+// prepare turns spec into the flags glm run and glm start work from and
+// applies their checks: prompt size, directory, timeout, base URL, nesting
+// depth, working directory safety, paths outside a confined job's directory,
+// overlap with running jobs and the max_disk_mb quota.
+// The directory becomes absolute, so that the job records where it runs.
+func (c *Client) prepare(spec RunSpec) (*cmd.Flags, error) {
+	flags := &cmd.Flags{
+		Prompt:           spec.Prompt,
+		Dir:              spec.Dir,
+		Timeout:          int(math.Ceil(spec.Timeout.Seconds())),
+		Model:            spec.Model,
+		OpusModel:        spec.OpusModel,
+		SonnetModel:      spec.SonnetModel,
+		HaikuModel:       spec.HaikuModel,
+		PermissionMode:   spec.PermissionMode,
+		BaseURL:          spec.BaseURL,
+		CaptureDiff:      spec.CaptureDiff,
+		StrictResult:     spec.StrictResult,
+		Confine:          spec.Confine,
+		Priority:         spec.Priority,
+		Notify:           spec.Notify,
+		Template:         spec.Template,
+		ContextFile:      spec.ContextFile,
+		AllowUnsafePaths: spec.AllowUnsafePaths,
+		AllowOverlap:     spec.AllowOverlap,
+		AllowNested:      spec.AllowNested,
+		StrictDisk:       spec.StrictDisk,
+		Keep:             spec.Keep,
+	}
+	if flags.Dir == "" {
+		flags.Dir = "."
+	}
+	if flags.Timeout <= 0 {
+		flags.Timeout = c.cfg.DefaultTimeout
+	}
+	if flags.BaseURL != "" {
+		if err := config.ValidateBaseURL(flags.BaseURL); err != nil {
+			return nil, errs.User(`"Invalid base URL: %s"`, err.Error())
+		}
+	}
+	if err := cmd.Validate(flags, &cmd.ValidateOptions{MaxPromptBytes: c.cfg.MaxPromptBytes}); err != nil {
+		return nil, err
+	}
+	if err := cmd.NestingCheck(c.cfg.MaxDepth, &cmd.NestingOptions{AllowNested: flags.AllowNested}); err != nil {
+		return nil, err
+	}
+	if err := cmd.SafetyCheck(flags.Dir, c.permissionMode(flags), &cmd.SafetyOptions{
+		AllowUnsafePaths: flags.AllowUnsafePaths || c.cfg.AllowUnsafePaths,
+	}); err != nil {
+		return nil, err
+	}
+	if err := cmd.OverlapCheck(c.cfg.SubagentDir, flags.Dir, &cmd.OverlapOptions{
+		AllowOverlap: flags.AllowOverlap || c.cfg.AllowOverlap,
+	}); err != nil {
+		return nil, err
+	}
+	if mode := c.confineMode(flags); mode != "" {
+		if err := cmd.ConfineCheck(flags.Prompt, flags.Dir, mode, warnOutput); err != nil {
+			return nil, err
+		}
+	}
+	if err := cmd.CheckDiskQuota(c.cfg.SubagentDir, c.cfg.MaxDiskMB, flags.StrictDisk, warnOutput); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// permissionMode returns the permission mode a job will run with: the
+// flag, else the configured default.
+func (c *Client) permissionMode(flags *cmd.Flags) string {
+	if flags.PermissionMode != "" {
+		return flags.PermissionMode
+	}
+	return c.cfg.PermissionMode
+}
+
+// confineMode returns the confine_mode of a job confined to its directory
+// by the flag or confine_to_workdir, else "".
+func (c *Client) confineMode(flags *cmd.Flags) string {
+	if flags.Confine || c.cfg.ConfineToWorkdir {
+		return c.cfg.ConfineMode
+	}
+	return ""
+}
+
+// claudeConfig creates the claude.Config of a job from the config and flags.
+// Its Log is the Client's logger scoped to the job in jobDir.
+func (c *Client) claudeConfig(flags *cmd.Flags, jobDir string) claude.Config {
+	cfg := c.cfg
+	models := cmd.ResolveModels(cfg, flags, cmd.StepPrefix{})
+
+	baseURL := cfg.ZaiBaseURL
+	if flags.BaseURL != "" {
+		baseURL = flags.BaseURL
+	}
+
+	return claude.Config{
+		ZAIAPIKey:       cfg.ZaiAPIKey,
+		ZAIBaseURL:      baseURL,
+		ZAIAPITimeoutMS: cfg.ZaiAPITimeoutMs,
+		ClaudePath:      cfg.ClaudePath,
+		OpusModel:       models.Opus.Model,
+		SonnetModel:     models.Sonnet.Model,
+		HaikuModel:      models.Haiku.Model,
+		PermissionMode:  c.permissionMode(flags),
+		Model:           models.Exec.Model,
+		Prompt:          flags.Prompt,
+		WorkDir:         flags.Dir,
+		TimeoutSecs:     flags.Timeout,
+		JobDir:          jobDir,
+		CaptureDiff:     flags.CaptureDiff || cfg.CaptureDiff,
+		DiffMaxBytes:    cfg.DiffMaxBytes,
+		StrictResult:    flags.StrictResult || cfg.StrictResult,
+		Confine:         c.confineMode(flags),
+		Priority:        flags.Priority,
+		Notify:          flags.Notify,
+		Template:        flags.Template,
+		Depth:           claude.NestingDepth() + 1,
+		Invocation:      c.invocation,
+		Log:             c.jobLog(jobDir),
+	}
+}
+
+// jobLog returns the Client's logger with the job_id field of the job in
+// jobDir, or the logger itself for "".
+func (c *Client) jobLog(jobDir string) *log.Logger {
+	if jobDir == "" {
+		return c.log
+	}
+	return c.log.With(log.Fields{"job_id": filepath.Base(jobDir)})
+}
+
+// track registers the job in jobDir as executing in this process and
+// returns the context it runs under and the function that unregisters it.
+func (c *Client) track(ctx context.Context, jobDir string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	a := &activeJob{cancel: cancel, done: make(chan struct{})}
+	id := filepath.Base(jobDir)
+	c.mu.Lock()
+	c.active[id] = a
+	c.mu.Unlock()
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.active, id)
+		c.mu.Unlock()
+		cancel()
+		close(a.done)
+	}
+}
+
+// projectOf returns the project ID of dir's canonical form (see
+// job.CanonicalDir).
+func projectOf(dir string) string {
+	canonical, _ := job.CanonicalDir(dir)
+	return job.ResolveProjectID(canonical)
+}
@@ -0,0 +1,34 @@
+// Package golem runs GoLeM jobs from Go programs: the same jobs, job
+// directories, queue and slot limits as the glm CLI, which is built on it.
+//
+// A Client is made from a Config, loaded from glm's standard files with
+// NewFromStandardFiles or from any directories with LoadConfig and New. Run
+// executes a job and waits for it; Start queues a job and returns at once,
+// launching it when max_parallel (or max_parallel_per_model) leaves a slot
+// free; Status, Result, List and Kill inspect and stop jobs, including ones
+// started by glm itself.
+//
+// The package never prints and never exits the process. Every method takes a
+// context: cancelling the context of Run stops claude's process group and the
+// job ends "killed", the other methods give up waiting.
+//
+// # Jobs started in this process
+//
+// Without Options.Launch, jobs promoted from the queue run in goroutines of
+// the calling process and are lost when it exits; a long-lived program that
+// wants jobs to outlive it passes a LaunchFunc that starts a process calling
+// ExecuteJob, as glm does with "glm _worker". A job run in this process
+// records this process's PID, so stop it with Client.Kill rather than
+// "glm kill", which signals the process group of that PID.
+//
+// # Stability
+//
+// From v1, the exported identifiers of this package follow semantic
+// versioning: they are not removed or changed incompatibly within a major
+// version. Struct types may gain fields, so build them with field names.
+// JobStatus, JobResult and ListItem are the documents of "glm status --json",
+// "glm result --json" and "glm list --json" and change only as those do, by
+// gaining fields. Config is glm.toml: it gains a field with each new key.
+// Errors read as glm prints them, and ExitCode and Result.ExitCode give the
+// CLI's exit codes, which do not change.
+package golem
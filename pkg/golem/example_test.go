@@ -0,0 +1,152 @@
+package golem_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/veschin/GoLeM/pkg/golem"
+)
+
+// fakeClaude stands in for the claude CLI: it answers every prompt at once,
+// except prompts mentioning "slow", which hang until killed.
+const fakeClaude = `#!/bin/sh
+case "$1" in --version) echo "2.1.0 (Claude Code)"; exit 0 ;; esac
+case "$*" in *slow*) sleep 30 ;; esac
+echo '{"result":"hello from claude"}'
+`
+
+// newExampleClient returns a Client whose config, job directory and claude
+// binary live under a temporary directory, and a project directory to run
+// jobs in. cleanup removes them.
+func newExampleClient() (client *golem.Client, project string, cleanup func()) {
+	base, err := os.MkdirTemp("", "golem-example-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	configDir := filepath.Join(base, "config")
+	project = filepath.Join(base, "project")
+	claudePath := filepath.Join(base, "claude")
+	for _, d := range []string{configDir, project} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			log.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(configDir, "zai_api_key"): "sk-example\n",
+		filepath.Join(configDir, "glm.toml"):    "permission_mode = \"acceptEdits\"\nclaude_path = \"" + claudePath + "\"\n",
+		claudePath:                              fakeClaude,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	cfg, err := golem.LoadConfig(configDir, filepath.Join(base, "subagents"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return golem.New(cfg), project, func() { os.RemoveAll(base) }
+}
+
+// waitFor polls jobID until its status is one of statuses.
+func waitFor(client *golem.Client, jobID string, statuses ...string) string {
+	for {
+		st, err := client.Status(context.Background(), jobID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			if st.Status == s {
+				return s
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func ExampleClient_Run() {
+	client, project, cleanup := newExampleClient()
+	defer cleanup()
+
+	res, err := client.Run(context.Background(), golem.RunSpec{
+		Prompt:  "Summarize README.md",
+		Dir:     project,
+		Timeout: time.Minute,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(res.Job.Status, res.ExitCode)
+	fmt.Println(res.Job.Stdout)
+	// Output:
+	// done 0
+	// hello from claude
+}
+
+func ExampleClient_Start() {
+	client, project, cleanup := newExampleClient()
+	defer cleanup()
+	ctx := context.Background()
+
+	j, err := client.Start(ctx, golem.RunSpec{Prompt: "Add tests for parser.go", Dir: project})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(waitFor(client, j.ID, "done", "failed", "timeout", "killed", "permission_error"))
+
+	res, err := client.Result(ctx, j.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(res.Stdout)
+	// Output:
+	// done
+	// hello from claude
+}
+
+func ExampleClient_List() {
+	client, project, cleanup := newExampleClient()
+	defer cleanup()
+	ctx := context.Background()
+
+	for _, prompt := range []string{"first", "second"} {
+		if _, err := client.Run(ctx, golem.RunSpec{Prompt: prompt, Dir: project, Keep: true}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	jobs, err := client.List(ctx, golem.Filter{Statuses: []string{"done"}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(jobs), "done jobs")
+	// Output:
+	// 2 done jobs
+}
+
+func ExampleClient_Kill() {
+	client, project, cleanup := newExampleClient()
+	defer cleanup()
+	ctx := context.Background()
+
+	j, err := client.Start(ctx, golem.RunSpec{Prompt: "a slow refactoring", Dir: project})
+	if err != nil {
+		log.Fatal(err)
+	}
+	waitFor(client, j.ID, "running")
+	if err := client.Kill(ctx, j.ID); err != nil {
+		log.Fatal(err)
+	}
+
+	st, err := client.Status(ctx, j.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(st.Status)
+	// Output:
+	// killed
+}
@@ -0,0 +1,140 @@
+package golem
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/job"
+)
+
+// JobStatus is a job's status, as "glm status --json" reports it.
+type JobStatus = cmd.JobStatusJSON
+
+// JobResult is a job's output, as "glm result --json" reports it.
+type JobResult = cmd.JobResultJSON
+
+// ListItem is one job of List, as "glm list --json" reports it.
+type ListItem = cmd.JobListItem
+
+// Status returns the status of jobID, which may be a unique part of the ID.
+// A running job whose process has died is marked "failed" first.
+func (c *Client) Status(ctx context.Context, jobID string) (JobStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return JobStatus{}, err
+	}
+	return cmd.JobStatus(c.cfg.SubagentDir, c.projectID, jobID)
+}
+
+// Result returns the output of jobID so far, whatever its status. Unlike
+// "glm result" it never deletes the job directory.
+func (c *Client) Result(ctx context.Context, jobID string) (JobResult, error) {
+	if err := ctx.Err(); err != nil {
+		return JobResult{}, err
+	}
+	res, err := cmd.JobResult(c.cfg.SubagentDir, c.projectID, jobID)
+	if errors.Is(err, job.ErrNotFound) {
+		return JobResult{}, errs.NotFound(`"Job not found: %s"`, jobID)
+	}
+	return res, err
+}
+
+// Filter selects the jobs of List. The zero Filter lists every job.
+type Filter struct {
+	// Statuses keeps jobs with one of these statuses (empty = all).
+	Statuses []string
+	// ProjectPrefix keeps jobs whose project ID starts with it.
+	ProjectPrefix string
+	// Since keeps jobs created at or after it (zero = no limit).
+	Since time.Time
+	// Chain lists the steps of one chain, in step order.
+	Chain string
+	// Offset skips this many matching jobs; Limit caps how many are
+	// returned (0 = unlimited).
+	Offset int
+	Limit  int
+	// Sort orders the jobs by "started" (the default), "status",
+	// "duration", "project" or "id"; Reverse flips the order.
+	Sort    string
+	Reverse bool
+}
+
+// List returns the jobs of every project that match f, newest first unless
+// f.Sort or f.Reverse asks otherwise.
+func (c *Client) List(ctx context.Context, f Filter) ([]ListItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var statuses []string
+	if len(f.Statuses) > 0 {
+		var err error
+		if statuses, err = cmd.ParseStatusFilter(strings.Join(f.Statuses, ",")); err != nil {
+			return nil, err
+		}
+	}
+	if f.Sort != "" {
+		if _, err := cmd.ParseListSort(f.Sort); err != nil {
+			return nil, err
+		}
+	}
+	return cmd.ListJobs(c.cfg.SubagentDir, &cmd.FilterOptions{
+		Statuses:      statuses,
+		ProjectPrefix: f.ProjectPrefix,
+		Since:         f.Since,
+		Chain:         f.Chain,
+		Offset:        f.Offset,
+		Limit:         f.Limit,
+		Sort:          f.Sort,
+		Reverse:       f.Reverse,
+	}), nil
+}
+
+// Kill stops jobID and marks it "killed". A queued job is only marked. A job
+// executing in this process is cancelled and Kill waits for it to settle;
+// any other running job gets SIGTERM and, if it has not exited within
+// kill_grace_seconds, SIGKILL sent to its process group, as with "glm kill".
+// Cancelling ctx cuts that wait short.
+func (c *Client) Kill(ctx context.Context, jobID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	id, err := job.ResolveJobID(c.cfg.SubagentDir, jobID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	a := c.active[id]
+	c.mu.Unlock()
+	if a != nil {
+		a.cancel()
+		select {
+		case <-a.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	signalFn := func(pid int, sig os.Signal) error {
+		if pid == os.Getpid() || pid == -os.Getpid() {
+			// The job ran in this process and has settled already.
+			return syscall.ESRCH
+		}
+		// pid is already negated for a process group.
+		return syscall.Kill(pid, sig.(syscall.Signal))
+	}
+	sleepFn := func() {
+		select {
+		case <-time.After(cmd.KillPollInterval):
+		case <-ctx.Done():
+		}
+	}
+	grace := time.Duration(c.cfg.KillGraceSeconds) * time.Second
+	return cmd.KillCmd(c.cfg.SubagentDir, c.projectID, id, signalFn, sleepFn, &cmd.KillOptions{Grace: grace})
+}
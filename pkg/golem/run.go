@@ -0,0 +1,307 @@
+package golem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/veschin/GoLeM/internal/claude"
+	"github.com/veschin/GoLeM/internal/cmd"
+	"github.com/veschin/GoLeM/internal/errs"
+	"github.com/veschin/GoLeM/internal/exitcode"
+	"github.com/veschin/GoLeM/internal/job"
+	"github.com/veschin/GoLeM/internal/log"
+)
+
+// Result is the outcome of Run.
+type Result struct {
+	// Job is the job's result, as "glm result --json" reports it.
+	Job JobResult
+	// ProjectID is the project the job ran in.
+	ProjectID string
+	// ExitCode is what glm run exits with: claude's exit code, 1 when
+	// StrictResult or a strict confinement failed the job, 130 when the
+	// context was cancelled, or the code of Err.
+	ExitCode int
+	// Err is the API error claude failed with, such as a rejected API key or
+	// a rate limit, or a *claude.WriteError when the job's results could not
+	// be written (exit 74); nil for any other outcome.
+	Err error
+	// Unsaved is claude's output when it could not be written to stdout.txt
+	// (see Err), so that it is not lost; "" otherwise.
+	Unsaved string
+	// Summary is the line "glm run --summary" prints.
+	Summary string
+	// Dir is the job directory while it is kept (see RunSpec.Keep and
+	// keep_jobs), or "" once the job has been deleted.
+	Dir string
+}
+
+// Run executes a job in this process and waits for it. The job counts
+// against max_parallel while it runs but does not wait for a slot.
+// Cancelling ctx stops claude's process group; the job then ends "killed"
+// with ExitCode 130.
+//
+// The returned error is only for a job that could not be created (invalid
+// spec, unsafe directory, unwritable job directory). A job that ran and
+// failed returns a nil error and its status in Result.
+func (c *Client) Run(ctx context.Context, spec RunSpec) (Result, error) {
+	flags, err := c.prepare(spec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	projectID := projectOf(flags.Dir)
+	j, err := job.NewJob(c.cfg.SubagentDir, projectID, job.GenerateJobID())
+	if err != nil {
+		return Result{}, err
+	}
+	if flags.ContextFile != "" {
+		if flags.Prompt, err = cmd.RunContextPrompt(j.Dir, flags.ContextFile, flags.Prompt, warnOutput); err != nil {
+			_ = job.DeleteJob(j.Dir)
+			return Result{}, err
+		}
+	}
+	runCtx, untrack := c.track(ctx, j.Dir)
+	_ = job.WritePID(j.Dir, os.Getpid())
+	_ = job.ClaimSlot(j.Dir)
+
+	claudeCfg := c.claudeConfig(flags, j.Dir)
+	claudeCfg.Log.With(log.Fields{"project_id": projectID, "workdir": flags.Dir, "id_retries": j.IDRetries}).Debug("job created")
+	exitCode, execErr := claude.ExecuteContext(runCtx, claudeCfg)
+	if exitCode == exitcode.Interrupted {
+		_ = job.AppendStderr(j.Dir, "Interrupted by user")
+	}
+	diskErr, _ := execErr.(*claude.WriteError)
+	if diskErr == nil {
+		exitCode, diskErr = c.settle(j.Dir, exitCode, claudeCfg)
+	}
+	untrack()
+	if flags.Notify != "" {
+		c.notify(j.Dir, flags.Notify, exitCode)
+	}
+
+	// A rejected API key, a rate limit or a prompt too long for the context
+	// window gets its own exit code, so callers can tell them from a task
+	// that failed.
+	stderrData, _ := os.ReadFile(filepath.Join(j.Dir, "stderr.txt"))
+	var apiErr error
+	if diskErr != nil {
+		apiErr, exitCode = diskErr, exitcode.DiskError
+	} else if exitCode != 0 && exitCode != exitcode.Interrupted {
+		apiErr = errs.FromStderr(string(stderrData))
+		if apiErr == nil && job.ReadStatus(j.Dir) == job.StatusContextExceeded {
+			apiErr = errs.ContextExceeded(`"Prompt exceeds the model's context window; split the task or run it as a chain (glm chain)"`)
+		}
+		if apiErr != nil {
+			exitCode = errs.ExitCode(apiErr)
+		}
+	}
+
+	res := Result{ProjectID: projectID, ExitCode: exitCode, Err: apiErr, Dir: j.Dir}
+	res.Job, _ = cmd.JobResult(c.cfg.SubagentDir, projectID, j.ID)
+	if diskErr != nil && res.Job.Stdout == "" {
+		res.Unsaved = diskErr.Stdout
+	}
+	res.Summary = cmd.RunSummary(j.Dir, j.ID, exitCode)
+	claudeCfg.Log.With(log.Fields{"status": res.Job.Status, "exit_code": exitCode}).Debug("job finished")
+	c.recordMetrics(j.Dir, claudeCfg, exitCode)
+
+	// Delete the job directory unless the retention policy keeps it.
+	if cmd.FinishJob(j.Dir, c.cfg.SubagentDir, flags.Keep || c.cfg.KeepJobs, c.cfg.RetentionDays) {
+		res.Dir = ""
+	}
+	return res, nil
+}
+
+// settle turns the finished claude run in jobDir into the job's final
+// status: it parses raw.json, maps the exit code and, with
+// run.StrictResult, fails a result that matches a failure marker, then
+// with run.Confine checks the changelog for files outside run.WorkDir. It
+// returns the exit code the job ends with, or 74 (exitcode.DiskError) and
+// the *claude.WriteError when the parsed results could not be written; the
+// job is then already failed.
+func (c *Client) settle(jobDir string, exitCode int, run claude.Config) (int, *claude.WriteError) {
+	if err := claude.ParseRawJSON(jobDir, &claude.ParseOptions{KeepANSI: !c.cfg.StripANSI}); err != nil {
+		if diskErr, ok := err.(*claude.WriteError); ok {
+			return exitcode.DiskError, diskErr
+		}
+	}
+
+	stderrData, _ := os.ReadFile(filepath.Join(jobDir, "stderr.txt"))
+	stdoutData, _ := os.ReadFile(filepath.Join(jobDir, "stdout.txt"))
+	finalStatus := claude.MapJobStatus(exitCode, string(stderrData), string(stdoutData))
+	if run.StrictResult {
+		if finalStatus = cmd.ApplyStrictResult(jobDir, finalStatus, c.cfg.ResultFailureMarkers); finalStatus != "done" && exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	if run.Confine != "" {
+		if finalStatus = cmd.ApplyConfinement(jobDir, finalStatus, run.WorkDir, run.Confine); finalStatus != "done" && exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	// A rejected transition means the job was killed meanwhile; keep that status.
+	_ = job.TransitionStatus(jobDir, job.Status(finalStatus))
+	return exitCode, nil
+}
+
+// Start queues a job and returns at once. The job is launched right away if
+// a slot is free, otherwise when a finishing job frees one; see
+// Options.Launch for where it runs. ctx only bounds the queueing.
+func (c *Client) Start(ctx context.Context, spec RunSpec) (*Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if spec.ContextFile != "" {
+		return nil, errs.User(`"--context is only supported by glm run"`)
+	}
+	flags, err := c.prepare(spec)
+	if err != nil {
+		return nil, err
+	}
+	queued := c.claudeConfig(flags, "")
+	if queued.Notify == "" {
+		queued.Notify = c.cfg.OnCompleteCmd
+	}
+	j, err := cmd.QueueJob(c.cfg.SubagentDir, projectOf(flags.Dir), queued)
+	if err != nil {
+		return nil, err
+	}
+	c.jobLog(j.Dir).With(log.Fields{"project_id": j.ProjectID, "workdir": flags.Dir, "id_retries": j.IDRetries}).Debug("job queued")
+	// The job is queued either way; a failed pass leaves it for the next one.
+	_, _ = c.Dispatch(ctx)
+	return j, nil
+}
+
+// DryRun is the claude invocation of a job; see Client.DryRun.
+type DryRun = cmd.DryRun
+
+// DryRun applies the checks of Run and Start to spec and returns the claude
+// invocation the job would run with: the argv, workdir, models, permission
+// mode, timeout and environment. No job is created and nothing runs.
+func (c *Client) DryRun(spec RunSpec) (*DryRun, error) {
+	flags, err := c.prepare(spec)
+	if err != nil {
+		return nil, err
+	}
+	if flags.ContextFile != "" {
+		path := filepath.Join("<job dir>", cmd.ContextDir, filepath.Base(flags.ContextFile))
+		flags.Prompt = cmd.BuildContextFilePrompt("", []string{path}, flags.Prompt)
+	}
+	return cmd.NewDryRun(c.claudeConfig(flags, ""))
+}
+
+// Dispatch launches queued jobs, highest priority and then oldest first,
+// while the slot limits allow, and returns how many it started. Start and
+// every finishing job dispatch by themselves; call it after raising
+// max_parallel or when a launched process died before it could.
+func (c *Client) Dispatch(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cmd.DispatchQueued(c.cfg.SubagentDir, c.cfg.MaxParallel, c.launch,
+		&cmd.DispatchOptions{
+			MaxParallelPerModel: c.cfg.MaxParallelPerModel,
+			PriorityAging:       time.Duration(c.cfg.PriorityAging) * time.Second,
+		})
+}
+
+// ExecuteJob runs the job in jobDir, which Dispatch has promoted to
+// "running", sets its final status and dispatches the next queued job into
+// the slot it frees. It is what a LaunchFunc's process calls; the job's
+// prompt and settings come from its job.json. It returns the job's exit
+// code. Errors are recorded in the job's stderr.txt.
+func (c *Client) ExecuteJob(ctx context.Context, jobDir string) int {
+	ctx, untrack := c.track(ctx, jobDir)
+	return c.execute(ctx, jobDir, untrack)
+}
+
+// execute is ExecuteJob for a job already tracked; untrack is called once
+// the job has settled.
+func (c *Client) execute(ctx context.Context, jobDir string, untrack func()) (exitCode int) {
+	defer untrack()
+	defer func() {
+		if r := recover(); r != nil {
+			claude.RecordPanic(jobDir, r, debug.Stack())
+			exitCode = 1
+		}
+	}()
+
+	m := job.LoadManifest(jobDir)
+	flags := &cmd.Flags{
+		Prompt:         m.Prompt,
+		Dir:            m.WorkDir,
+		Timeout:        m.TimeoutSecs,
+		OpusModel:      m.Models.Opus,
+		SonnetModel:    m.Models.Sonnet,
+		HaikuModel:     m.Models.Haiku,
+		PermissionMode: m.PermissionMode,
+		CaptureDiff:    m.CaptureDiff,
+		StrictResult:   m.StrictResult,
+		BaseURL:        m.BaseURL,
+		Priority:       m.Priority,
+		Template:       m.Template,
+	}
+	claudeCfg := c.claudeConfig(flags, jobDir)
+	if m.Depth > 0 {
+		// The depth of the glm that queued the job, not of this launcher.
+		claudeCfg.Depth = m.Depth
+	}
+	claudeCfg.Confine = m.Confine
+	exitCode, err := claude.ExecuteContext(ctx, claudeCfg)
+	diskErr, _ := err.(*claude.WriteError)
+	if err != nil && diskErr == nil {
+		if data, _ := os.ReadFile(filepath.Join(jobDir, "stderr.txt")); len(data) == 0 {
+			// Nobody sees a launched job's output; keep the reason with the job.
+			_ = job.AppendStderr(jobDir, err.Error())
+		}
+	}
+	if diskErr == nil {
+		exitCode, diskErr = c.settle(jobDir, exitCode, claudeCfg)
+	}
+	if diskErr != nil && !diskErr.Recorded {
+		// Not even the note fit; the log is all that is left of the failure.
+		claudeCfg.Log.With(log.Fields{"file": diskErr.File, "error": diskErr.Err.Error()}).Error("cannot record job failure")
+	}
+	claudeCfg.Log.With(log.Fields{"status": string(job.ReadStatus(jobDir)), "exit_code": exitCode}).Debug("job finished")
+	c.recordMetrics(jobDir, claudeCfg, exitCode)
+
+	_, _ = c.Dispatch(context.Background())
+	if m.Notify != "" {
+		c.notify(jobDir, m.Notify, exitCode)
+	}
+	return exitCode
+}
+
+// recordMetrics appends the finished job in jobDir to the metrics log when
+// metrics_enabled is set. A failed write is logged; the job is not affected.
+func (c *Client) recordMetrics(jobDir string, run claude.Config, exitCode int) {
+	if !c.cfg.MetricsEnabled {
+		return
+	}
+	if err := cmd.RecordJobMetrics(cmd.MetricsPath(c.cfg.ConfigDir), jobDir, run.Model, exitCode); err != nil {
+		run.Log.With(log.Fields{"error": err.Error()}).Warn("cannot record job metrics")
+	}
+}
+
+// notify runs the notify hook command of the finished job in jobDir (see
+// cmd.RunNotify). A failing hook is logged; the job is not affected.
+func (c *Client) notify(jobDir, command string, exitCode int) {
+	if err := cmd.RunNotify(jobDir, command, exitCode); err != nil {
+		c.jobLog(jobDir).With(log.Fields{"error": err.Error()}).Warn("notify hook failed")
+		return
+	}
+	c.jobLog(jobDir).Debug("notify hook ran")
+}
+
+// launchInProcess is the LaunchFunc used without Options.Launch: it runs
+// the job in a goroutine, tracked before it returns so that Kill finds it.
+// The job keeps the PID of this process.
+func (c *Client) launchInProcess(jobDir string) (int, error) {
+	ctx, untrack := c.track(context.Background(), jobDir)
+	go c.execute(ctx, jobDir, untrack)
+	return os.Getpid(), nil
+}